@@ -0,0 +1,379 @@
+package apisrvr
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/availableservers"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/cgsrch"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/consistenthash"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/coveragezone"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/crconfig"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/crstates"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/stats"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// ConsistentHashCoverageZonePath is the path of the endpoint which returns the cache the consistent hash selects for a request path from a client in the coverage zone, the same as Traffic Router's.
+const ConsistentHashCoverageZonePath = "/crs/consistenthash/cache/coveragezone"
+
+// StatsPath is the path of the endpoint which returns the routing stats, the same as Traffic Router's.
+const StatsPath = "/crs/stats"
+
+// LocationsPath is the path of the endpoint which returns the cache locations, the same as Traffic Router's.
+// Under it, "caches" returns the caches of every location, and "{location}/caches" the caches of one.
+const LocationsPath = "/crs/locations"
+
+// CoverageZoneCachesPath is the path of the endpoint which returns the available caches of a Delivery Service in a cache location, the same as Traffic Router's.
+const CoverageZoneCachesPath = "/crs/coveragezone/caches"
+
+// AppName is the name of the app in the stats endpoint.
+const AppName = "traffic_router_golang"
+
+// Cache is a cache in an API response. The JSON is the same as the Java Traffic Router's, for the fields this router has.
+type Cache struct {
+	ID               string                 `json:"id"`
+	FQDN             string                 `json:"fqdn"`
+	Port             int                    `json:"port"`
+	HTTPSPort        int                    `json:"httpsPort"`
+	IP4              string                 `json:"ip4,omitempty"`
+	IP6              string                 `json:"ip6,omitempty"`
+	Available        bool                   `json:"available"`
+	Capabilities     []string               `json:"capabilities"`
+	DeliveryServices []CacheDeliveryService `json:"deliveryServices"`
+	HashValues       []float64              `json:"hashValues"`
+}
+
+// CacheDeliveryService is a Delivery Service assigned to a Cache, and the FQDN the cache uses for it.
+type CacheDeliveryService struct {
+	DeliveryServiceID string `json:"deliveryServiceId"`
+	FQDN              string `json:"fqdn"`
+}
+
+// LocationCache is a cache in a locations API response. The JSON is the same as the Java Traffic Router's, for the fields this router has.
+type LocationCache struct {
+	CacheID     string   `json:"cacheId"`
+	FQDN        string   `json:"fqdn"`
+	IPAddresses []string `json:"ipAddresses"`
+	CacheOnline bool     `json:"cacheOnline"`
+}
+
+// writeNotFound writes a 404 with an empty object, the same as Traffic Router.
+func writeNotFound(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte("{}"))
+}
+
+func consistentHashCoverageZoneHandler(
+	crcThs crconfig.Ths,
+	availSrvrs availableservers.AvailableServers,
+	cgSrchThs cgsrch.Ths,
+	consistentHasherThs consistenthash.Ths,
+	cz coveragezone.CoverageZone,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		for _, param := range []string{"ip", "deliveryServiceId", "requestPath"} {
+			if _, ok := params[param]; !ok {
+				http.Error(w, "Required String parameter '"+param+"' is not present", http.StatusBadRequest)
+				return
+			}
+		}
+		ipStr := params.Get("ip")
+		dsName := tc.DeliveryServiceName(params.Get("deliveryServiceId"))
+		requestPath := params.Get("requestPath")
+
+		crc := crcThs.Get()
+		if crc == nil {
+			fmt.Println("ERROR consistent hash request before the CRConfig was loaded, returning 503")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if _, ok := crc.DeliveryServices[string(dsName)]; !ok {
+			fmt.Println("EVENT consistent hash request for unknown delivery service '" + string(dsName) + "', returning 404")
+			writeNotFound(w)
+			return
+		}
+
+		ip := net.ParseIP(ipStr)
+		if ip == nil {
+			writeNotFound(w)
+			return
+		}
+		// Like Traffic Router, this only uses the coverage zone, and never falls back to geolocation.
+		pos, ok := cz.Get(ip)
+		if !ok {
+			writeNotFound(w)
+			return
+		}
+		cgDat, ok := cgSrchThs.Get().Nearest(pos.Lat, pos.Lon)
+		if !ok {
+			writeNotFound(w)
+			return
+		}
+		srvrs, err := availSrvrs.Get(dsName, tc.CacheGroupName(cgDat.Obj))
+		if err != nil || len(srvrs) == 0 {
+			writeNotFound(w)
+			return
+		}
+
+		// Traffic Router hashes the request path without a query string.
+		consistentHasher := (*consistenthash.ConsistentHasher)(consistentHasherThs.Get())
+		cacheName, ok := consistentHasher.SelectCache(dsName, srvrs, requestPath, "")
+		if !ok {
+			writeNotFound(w)
+			return
+		}
+
+		bts, err := json.Marshal(makeCache(crc, cacheName, consistentHasher.CacheHashValues(cacheName)))
+		if err != nil {
+			fmt.Println("ERROR consistent hash request marshalling cache '" + string(cacheName) + "': " + err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(bts)
+	}
+}
+
+// writeJSON writes the given object as JSON.
+func writeJSON(w http.ResponseWriter, name string, obj interface{}) {
+	bts, err := json.Marshal(obj)
+	if err != nil {
+		fmt.Println("ERROR " + name + " request marshalling response: " + err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bts)
+}
+
+func statsHandler(routingStats *stats.Stats, version string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, "stats", tc.CRSStats{
+			App:   tc.CRSStatsApp{Name: AppName, Version: version},
+			Stats: routingStats.Get(),
+		})
+	}
+}
+
+func locationsHandler(crcThs crconfig.Ths) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		crc := crcThs.Get()
+		if crc == nil {
+			fmt.Println("ERROR locations request before the CRConfig was loaded, returning 503")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, "locations", map[string][]string{"locations": locations(crc)})
+	}
+}
+
+// locationCachesHandler serves the caches of every location, and the caches of a single location, under LocationsPath.
+func locationCachesHandler(crcThs crconfig.Ths, crsThs crstates.Ths) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		crc := crcThs.Get()
+		if crc == nil {
+			fmt.Println("ERROR location caches request before the CRConfig was loaded, returning 503")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		crs := crsThs.Get()
+
+		path := strings.TrimPrefix(r.URL.Path, LocationsPath+"/")
+		if path == "caches" {
+			all := map[string][]LocationCache{}
+			for _, location := range locations(crc) {
+				all[location] = locationCaches(crc, crs, location)
+			}
+			writeJSON(w, "location caches", map[string]map[string][]LocationCache{"locations": all})
+			return
+		}
+
+		location := strings.TrimSuffix(path, "/caches")
+		if location == path || strings.Contains(location, "/") {
+			writeNotFound(w)
+			return
+		}
+		if _, ok := crc.EdgeLocations[location]; !ok {
+			fmt.Println("EVENT location caches request for unknown location '" + location + "', returning 404")
+			writeNotFound(w)
+			return
+		}
+		writeJSON(w, "location caches", map[string][]LocationCache{"caches": locationCaches(crc, crs, location)})
+	}
+}
+
+// locations returns the sorted cache locations in the CRConfig.
+func locations(crc *tc.CRConfig) []string {
+	locations := []string{}
+	for location := range crc.EdgeLocations {
+		locations = append(locations, location)
+	}
+	sort.Strings(locations)
+	return locations
+}
+
+// locationCaches returns the caches in the CRConfig in the given location, sorted by name.
+// Caches are online if they're available in the given CRStates, which may be nil if they haven't been loaded.
+func locationCaches(crc *tc.CRConfig, crs *tc.CRStates, location string) []LocationCache {
+	caches := []LocationCache{}
+	for name, server := range crc.ContentServers {
+		if server.CacheGroup == nil || *server.CacheGroup != location {
+			continue
+		}
+		cache := LocationCache{CacheID: name, IPAddresses: []string{}}
+		if server.Fqdn != nil {
+			cache.FQDN = *server.Fqdn
+		}
+		if server.Ip != nil && *server.Ip != "" {
+			cache.IPAddresses = append(cache.IPAddresses, *server.Ip)
+		}
+		if server.Ip6 != nil && *server.Ip6 != "" {
+			cache.IPAddresses = append(cache.IPAddresses, strings.SplitN(*server.Ip6, "/", 2)[0])
+		}
+		if crs != nil {
+			cache.CacheOnline = crs.Caches[tc.CacheName(name)].IsAvailable
+		}
+		caches = append(caches, cache)
+	}
+	sort.Slice(caches, func(i, j int) bool { return caches[i].CacheID < caches[j].CacheID })
+	return caches
+}
+
+func coverageZoneCachesHandler(
+	crcThs crconfig.Ths,
+	availSrvrs availableservers.AvailableServers,
+	consistentHasherThs consistenthash.Ths,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		for _, param := range []string{"deliveryServiceId", "cacheLocationId"} {
+			if _, ok := params[param]; !ok {
+				http.Error(w, "Required String parameter '"+param+"' is not present", http.StatusBadRequest)
+				return
+			}
+		}
+
+		crc := crcThs.Get()
+		if crc == nil {
+			fmt.Println("ERROR coverage zone caches request before the CRConfig was loaded, returning 503")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		// Like Traffic Router, this returns a 404 with no body if there are no available caches.
+		srvrs, err := availSrvrs.Get(tc.DeliveryServiceName(params.Get("deliveryServiceId")), tc.CacheGroupName(params.Get("cacheLocationId")))
+		if err != nil || len(srvrs) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		consistentHasher := (*consistenthash.ConsistentHasher)(consistentHasherThs.Get())
+		caches := []Cache{}
+		for _, srvr := range srvrs {
+			caches = append(caches, makeCache(crc, srvr, consistentHasher.CacheHashValues(srvr)))
+		}
+		writeJSON(w, "coverage zone caches", caches)
+	}
+}
+
+// makeCache creates the API Cache of the given available cache in the CRConfig.
+func makeCache(crc *tc.CRConfig, cacheName tc.CacheName, hashValues []float64) Cache {
+	server := crc.ContentServers[string(cacheName)]
+	cache := Cache{
+		ID:               string(cacheName),
+		Port:             80,
+		HTTPSPort:        443,
+		Available:        true,
+		Capabilities:     server.Capabilities,
+		DeliveryServices: []CacheDeliveryService{},
+		HashValues:       hashValues,
+	}
+	if cache.Capabilities == nil {
+		cache.Capabilities = []string{}
+	}
+	if server.Fqdn != nil {
+		cache.FQDN = *server.Fqdn
+	}
+	if server.Port != nil {
+		cache.Port = *server.Port
+	}
+	if server.HttpsPort != nil {
+		cache.HTTPSPort = *server.HttpsPort
+	}
+	if server.Ip != nil {
+		cache.IP4 = *server.Ip
+	}
+	if server.Ip6 != nil {
+		cache.IP6 = strings.SplitN(*server.Ip6, "/", 2)[0]
+	}
+	for ds, fqdns := range server.DeliveryServices {
+		if len(fqdns) == 0 {
+			continue
+		}
+		cache.DeliveryServices = append(cache.DeliveryServices, CacheDeliveryService{DeliveryServiceID: ds, FQDN: fqdns[0]})
+	}
+	sort.Slice(cache.DeliveryServices, func(i, j int) bool {
+		return cache.DeliveryServices[i].DeliveryServiceID < cache.DeliveryServices[j].DeliveryServiceID
+	})
+	return cache
+}
+
+// Start starts serving the Traffic Router API on the given port, and returns the server.
+func Start(
+	crc crconfig.Ths,
+	availableServers availableservers.AvailableServers,
+	cgSrch cgsrch.Ths,
+	consistentHasher consistenthash.Ths,
+	cz coveragezone.CoverageZone,
+	crs crstates.Ths,
+	routingStats *stats.Stats,
+	version string,
+	port uint,
+) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc(ConsistentHashCoverageZonePath, consistentHashCoverageZoneHandler(crc, availableServers, cgSrch, consistentHasher, cz))
+	mux.HandleFunc(StatsPath, statsHandler(routingStats, version))
+	mux.HandleFunc(LocationsPath, locationsHandler(crc))
+	mux.HandleFunc(LocationsPath+"/", locationCachesHandler(crc, crs))
+	mux.HandleFunc(CoverageZoneCachesPath, coverageZoneCachesHandler(crc, availableServers, consistentHasher))
+
+	srvr := http.Server{}
+	srvr.Addr = ":" + strconv.Itoa(int(port))
+	srvr.Handler = mux
+	go func() {
+		err := srvr.ListenAndServe()
+		if err != nil {
+			fmt.Println("Serving API: " + err.Error())
+		}
+	}()
+	return &srvr
+}
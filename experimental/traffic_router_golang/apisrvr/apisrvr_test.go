@@ -0,0 +1,143 @@
+package apisrvr
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/availableservers"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/consistenthash"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/crconfig"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/crstates"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/stats"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+const testCRConfig = `{
+	"contentServers": {
+		"edge-1": {"cacheGroup": "cg-east", "fqdn": "edge-1.example.net", "ip": "192.0.2.1", "ip6": "2001:db8::1/64", "deliveryServices": {"ds": ["edge-1.ds.mycdn.example.net"]}},
+		"edge-2": {"cacheGroup": "cg-east", "fqdn": "edge-2.example.net", "ip": "192.0.2.2", "deliveryServices": {"ds": ["edge-2.ds.mycdn.example.net"]}},
+		"edge-3": {"cacheGroup": "cg-west", "fqdn": "edge-3.example.net", "ip": "192.0.2.3", "deliveryServices": {"ds": ["edge-3.ds.mycdn.example.net"]}}
+	},
+	"deliveryServices": {
+		"ds": {"domains": ["ds.mycdn.example.net"]}
+	},
+	"edgeLocations": {
+		"cg-west": {"latitude": 37, "longitude": -122},
+		"cg-east": {"latitude": 40, "longitude": -75}
+	}
+}`
+
+func testCRConfigThs(t *testing.T) crconfig.Ths {
+	crc := &tc.CRConfig{}
+	if err := json.Unmarshal([]byte(testCRConfig), crc); err != nil {
+		t.Fatalf("unmarshalling test CRConfig: %v", err)
+	}
+	crcThs := crconfig.NewThs()
+	crcThs.Set(crc)
+	return crcThs
+}
+
+func serveTest(handler http.HandlerFunc, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestLocations(t *testing.T) {
+	crcThs := testCRConfigThs(t)
+	crsThs := crstates.NewThs()
+	crsThs.Set(&tc.CRStates{Caches: map[tc.CacheName]tc.IsAvailable{"edge-1": {IsAvailable: true}}})
+
+	w := serveTest(locationsHandler(crcThs), LocationsPath)
+	if expected := `{"locations":["cg-east","cg-west"]}`; w.Body.String() != expected {
+		t.Errorf("expected locations %v, actual %v", expected, w.Body.String())
+	}
+
+	east := []LocationCache{
+		{CacheID: "edge-1", FQDN: "edge-1.example.net", IPAddresses: []string{"192.0.2.1", "2001:db8::1"}, CacheOnline: true},
+		{CacheID: "edge-2", FQDN: "edge-2.example.net", IPAddresses: []string{"192.0.2.2"}},
+	}
+	w = serveTest(locationCachesHandler(crcThs, crsThs), LocationsPath+"/cg-east/caches")
+	caches := map[string][]LocationCache{}
+	if err := json.Unmarshal(w.Body.Bytes(), &caches); err != nil || !reflect.DeepEqual(caches["caches"], east) {
+		t.Errorf("expected location caches %+v, actual %v %v", east, w.Body.String(), err)
+	}
+
+	w = serveTest(locationCachesHandler(crcThs, crsThs), LocationsPath+"/caches")
+	all := map[string]map[string][]LocationCache{}
+	if err := json.Unmarshal(w.Body.Bytes(), &all); err != nil || len(all["locations"]) != 2 || !reflect.DeepEqual(all["locations"]["cg-east"], east) {
+		t.Errorf("expected caches of every location, actual %v %v", w.Body.String(), err)
+	}
+
+	for _, path := range []string{LocationsPath + "/cg-north/caches", LocationsPath + "/cg-east", LocationsPath + "/cg-east/caches/edge-1"} {
+		if w = serveTest(locationCachesHandler(crcThs, crsThs), path); w.Code != http.StatusNotFound {
+			t.Errorf("expected %v to not be found, actual %v", path, w.Code)
+		}
+	}
+}
+
+func TestCoverageZoneCaches(t *testing.T) {
+	crcThs := testCRConfigThs(t)
+	consistentHasher, err := consistenthash.Create(crcThs.Get())
+	if err != nil {
+		t.Fatalf("creating consistent hasher: %v", err)
+	}
+	consistentHasherThs := consistenthash.NewThs()
+	consistentHasherThs.Set(consistentHasher)
+	availSrvrs := availableservers.New()
+	availSrvrs.Set(availableservers.AvailableServersMap{"ds": {"cg-east": {"edge-1"}}})
+	handler := coverageZoneCachesHandler(crcThs, availSrvrs, consistentHasherThs)
+
+	w := serveTest(handler, CoverageZoneCachesPath+"?deliveryServiceId=ds&cacheLocationId=cg-east")
+	caches := []Cache{}
+	if err := json.Unmarshal(w.Body.Bytes(), &caches); err != nil || len(caches) != 1 || caches[0].ID != "edge-1" || caches[0].IP6 != "2001:db8::1" {
+		t.Errorf("expected the available cache edge-1, actual %v %v", w.Body.String(), err)
+	}
+
+	w = serveTest(handler, CoverageZoneCachesPath+"?deliveryServiceId=ds&cacheLocationId=cg-west")
+	if w.Code != http.StatusNotFound || w.Body.Len() != 0 {
+		t.Errorf("expected location without available caches to be a 404 with no body, actual %v '%v'", w.Code, w.Body.String())
+	}
+	if w = serveTest(handler, CoverageZoneCachesPath+"?deliveryServiceId=ds"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected missing cacheLocationId to be a 400, actual %v", w.Code)
+	}
+}
+
+func TestStats(t *testing.T) {
+	routingStats := stats.New()
+	routingStats.SaveHTTP("tr.ds.mycdn.example.net", stats.ResultCZ, time.Millisecond)
+
+	w := serveTest(statsHandler(routingStats, "1.2.3"), StatsPath)
+	actual := tc.CRSStats{}
+	if err := json.Unmarshal(w.Body.Bytes(), &actual); err != nil {
+		t.Fatalf("unmarshalling stats: %v", err)
+	}
+	if actual.App.Name != AppName || actual.App.Version != "1.2.3" || actual.Stats.HTTPMap["tr.ds.mycdn.example.net"].CZCount != 1 {
+		t.Errorf("expected stats with the app and counts, actual %+v", actual)
+	}
+}
@@ -32,19 +32,32 @@ import (
 )
 
 type Cfg struct {
-	Port                  uint     `json:"port"`
-	Monitors              []*URL   `json:"monitors"`
-	ReqTimeout            Duration `json:"request_timeout_ms"`
-	CRConfigInterval      Duration `json:"crconfig_poll_interval_ms"`
-	CRStatesInterval      Duration `json:"crstates_poll_interval_ms"`
-	CDN                   string   `json:"cdn"`
-	TrafficOpsURI         *URL     `json:"traffic_ops_uri"`
-	TrafficOpsUser        string   `json:"traffic_ops_user"`
-	TrafficOpsPass        string   `json:"traffic_ops_pass"`
-	TrafficOpsInsecure    bool     `json:"traffic_ops_insecure"`
-	TrafficOpsClientCache bool     `json:"traffic_ops_client_cache"`
-	TrafficOpsTimeout     Duration `json:"traffic_ops_timeout_ms"`
-	CoverageZoneFile      string   `json:"coverage_zone_file"`
+	Port                     uint     `json:"port"`
+	HTTPSPort                uint     `json:"https_port"` // the HTTPS port, or 0 to not serve HTTPS
+	DNSPort                  uint     `json:"dns_port"`   // the DNS UDP and TCP port, or 0 to not serve DNS
+	APIPort                  uint     `json:"api_port"`   // the Traffic Router API port, or 0 to not serve the API
+	Monitors                 []*URL   `json:"monitors"`
+	ReqTimeout               Duration `json:"request_timeout_ms"`
+	CRConfigInterval         Duration `json:"crconfig_poll_interval_ms"`
+	CRStatesInterval         Duration `json:"crstates_poll_interval_ms"`
+	CDN                      string   `json:"cdn"`
+	TrafficOpsURI            *URL     `json:"traffic_ops_uri"`
+	TrafficOpsUser           string   `json:"traffic_ops_user"`
+	TrafficOpsPass           string   `json:"traffic_ops_pass"`
+	TrafficOpsInsecure       bool     `json:"traffic_ops_insecure"`
+	TrafficOpsClientCache    bool     `json:"traffic_ops_client_cache"`
+	TrafficOpsTimeout        Duration `json:"traffic_ops_timeout_ms"`
+	CoverageZoneFile         string   `json:"coverage_zone_file"`
+	GeolocationFile          string   `json:"geolocation_file"`                    // the MaxMind database file, or empty to use the CRConfig geolocation.polling.url
+	GeolocationInterval      Duration `json:"geolocation_poll_interval_ms"`        // the geolocation database poll interval, or 0 to use the CRConfig geolocation.polling.interval
+	DeepCoverageZoneFile     string   `json:"deep_coverage_zone_file"`             // the deep coverage zone file, or empty to use the CRConfig deepcoveragezone.polling.url
+	DeepCoverageZoneInterval Duration `json:"deep_coverage_zone_poll_interval_ms"` // the deep coverage zone poll interval, or 0 to use the CRConfig deepcoveragezone.polling.interval
+	SteeringFile             string   `json:"steering_file"`                       // the steering file, in the Traffic Ops steering API format, or empty to poll Traffic Ops
+	SteeringInterval         Duration `json:"steering_poll_interval_ms"`
+	FederationsFile          string   `json:"federations_file"` // the federations file, in the Traffic Ops federations/all API format, or empty to poll Traffic Ops
+	FederationsInterval      Duration `json:"federations_poll_interval_ms"`
+	SSLKeysFile              string   `json:"ssl_keys_file"` // the SSL keys file, in the Traffic Ops CDN SSL keys API format, or empty to poll Traffic Ops
+	SSLKeysInterval          Duration `json:"ssl_keys_poll_interval_ms"`
 	LogLocations
 }
 
@@ -0,0 +1,350 @@
+package consistenthash
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// DefaultHashCount is the number of hashes of a cache without a CRConfig hashCount, the same as Traffic Router's.
+const DefaultHashCount = 1000
+
+// Dispersion is the number of caches to select for a request, of which one is chosen, at random if Shuffled.
+type Dispersion struct {
+	Limit    int
+	Shuffled bool
+}
+
+// DefaultDispersion is the dispersion of Delivery Services without a CRConfig dispersion or maxDnsIpsForLocation.
+var DefaultDispersion = Dispersion{Limit: 1, Shuffled: true}
+
+// ConsistentHasher selects caches for requests to each Delivery Service by consistent hashing, using the cache hashes and Delivery Service hashing config of a CRConfig.
+// This selects caches the same way as the Java Traffic Router, so both select the same cache for the same request.
+type ConsistentHasher struct {
+	cacheHashes      map[tc.CacheName][]float64
+	deliveryServices map[tc.DeliveryServiceName]deliveryService
+}
+
+// deliveryService is the consistent hashing config of a Delivery Service.
+type deliveryService struct {
+	regexStr    string
+	regex       *regexp.Regexp // nil if regexStr is empty or invalid
+	queryParams map[string]struct{}
+	dispersion  Dispersion
+}
+
+// Create creates the ConsistentHasher of the given CRConfig.
+func Create(crc *tc.CRConfig) (*ConsistentHasher, error) {
+	if crc == nil {
+		return nil, errors.New("CRConfig is nil")
+	}
+	h := &ConsistentHasher{
+		cacheHashes:      make(map[tc.CacheName][]float64, len(crc.ContentServers)),
+		deliveryServices: make(map[tc.DeliveryServiceName]deliveryService, len(crc.DeliveryServices)),
+	}
+	for cacheNameStr, cache := range crc.ContentServers {
+		// like Traffic Router, the hash ID defaults to the server name, and a hash count less than 1 to the default.
+		hashID := cacheNameStr
+		if cache.HashId != nil {
+			hashID = *cache.HashId
+		}
+		hashCount := 0
+		if cache.HashCount != nil {
+			hashCount = *cache.HashCount
+		}
+		h.cacheHashes[tc.CacheName(cacheNameStr)] = HashValues(hashID, hashCount)
+	}
+
+	for dsNameStr, crcDS := range crc.DeliveryServices {
+		ds := deliveryService{queryParams: map[string]struct{}{}, dispersion: DefaultDispersion}
+		if crcDS.ConsistentHashRegex != nil && *crcDS.ConsistentHashRegex != "" {
+			ds.regexStr = *crcDS.ConsistentHashRegex
+			regex, err := regexp.Compile(ds.regexStr)
+			if err != nil {
+				// Traffic Router hashes the whole path if the regex fails, so that's not an error.
+				fmt.Println("WARNING delivery service '" + dsNameStr + "' consistent hash regex '" + ds.regexStr + "' failed to compile, hashing whole paths: " + err.Error())
+			}
+			ds.regex = regex
+		}
+		for _, param := range crcDS.ConsistentHashQueryParams {
+			if param != "" {
+				ds.queryParams[param] = struct{}{}
+			}
+		}
+		if crcDS.Dispersion != nil {
+			if crcDS.Dispersion.Limit != 0 {
+				ds.dispersion.Limit = crcDS.Dispersion.Limit
+			}
+			ds.dispersion.Shuffled = crcDS.Dispersion.Shuffled
+		} else if crcDS.MaxDNSIPsForLocation != nil {
+			ds.dispersion.Limit = *crcDS.MaxDNSIPsForLocation
+		}
+		h.deliveryServices[tc.DeliveryServiceName(dsNameStr)] = ds
+	}
+	return h, nil
+}
+
+// Hash returns the consistent hash of the given string, which is its MD5 sum as an unsigned integer, rounded to the nearest float64. This is the same as Traffic Router's MD5HashFunction.
+func Hash(s string) float64 {
+	sum := md5.Sum([]byte(s))
+	f, _ := new(big.Float).SetInt(new(big.Int).SetBytes(sum[:])).Float64()
+	return f
+}
+
+// HashValues returns the sorted, unique hashes of a cache with the given hash ID and count, which are its points on the hash ring.
+func HashValues(hashID string, hashCount int) []float64 {
+	if hashCount < 1 {
+		hashCount = DefaultHashCount
+	}
+	return WeightHashValues(hashID, hashCount)
+}
+
+// WeightHashValues returns the sorted, unique hashes of a hashable with the given hash ID and weight, which is the number of hashes.
+// Unlike HashValues, a weight less than 1 has no hashes. This is how Traffic Router hashes steering targets.
+func WeightHashValues(hashID string, weight int) []float64 {
+	hashCount := weight
+	if hashCount < 0 {
+		hashCount = 0
+	}
+	hashSet := make(map[float64]struct{}, hashCount)
+	for i := 0; i < hashCount; i++ {
+		hashSet[Hash(hashID+"--"+strconv.Itoa(i))] = struct{}{}
+	}
+	hashes := make([]float64, 0, len(hashSet))
+	for hash := range hashSet {
+		hashes = append(hashes, hash)
+	}
+	sort.Float64s(hashes)
+	return hashes
+}
+
+// CacheHashValues returns the hashes of the given cache, or nil if it isn't in the CRConfig.
+func (h *ConsistentHasher) CacheHashValues(cache tc.CacheName) []float64 {
+	return h.cacheHashes[cache]
+}
+
+// PathToHash returns the string to hash for a request to the given Delivery Service, with the given path and raw query string.
+// This is the Delivery Service's consistent hash regex capture groups of the path, or the whole path if it doesn't match,
+// followed by its consistent hash query parameters.
+func (h *ConsistentHasher) PathToHash(dsName tc.DeliveryServiceName, path string, rawQuery string) string {
+	return h.deliveryServices[dsName].pathToHash(path, rawQuery)
+}
+
+// SteeringPathToHash returns the string to hash for a request to the given target of the given steering Delivery Service, with the given path and raw query string.
+// Like Traffic Router, this is the same as the target's PathToHash, except with the steering Delivery Service's consistent hash regex, if it has one.
+func (h *ConsistentHasher) SteeringPathToHash(steeringDSName tc.DeliveryServiceName, targetDSName tc.DeliveryServiceName, path string, rawQuery string) string {
+	ds := h.deliveryServices[targetDSName]
+	if steeringDS := h.deliveryServices[steeringDSName]; steeringDS.regexStr != "" {
+		ds.regexStr = steeringDS.regexStr
+		ds.regex = steeringDS.regex
+	}
+	return ds.pathToHash(path, rawQuery)
+}
+
+// pathToHash returns the string to hash for a request to the Delivery Service, with the given path and raw query string.
+func (ds deliveryService) pathToHash(path string, rawQuery string) string {
+	pathToHash := ""
+	if path != "" {
+		pathToHash = ds.patternBasedHashString(path)
+	}
+	return pathToHash + ds.significantQueryParams(rawQuery)
+}
+
+// patternBasedHashString returns the concatenated capture groups of the Delivery Service's consistent hash regex in the path,
+// or the whole path if there is no regex, or it doesn't match or has no groups.
+func (ds deliveryService) patternBasedHashString(path string) string {
+	if ds.regex == nil || ds.regex.NumSubexp() == 0 {
+		return path
+	}
+	match := ds.regex.FindStringSubmatchIndex(path)
+	if match == nil {
+		return path
+	}
+	sb := strings.Builder{}
+	for i := 1; i <= ds.regex.NumSubexp(); i++ {
+		if match[2*i] < 0 {
+			// Traffic Router appends groups which didn't participate in the match as "null".
+			sb.WriteString("null")
+			continue
+		}
+		sb.WriteString(path[match[2*i]:match[2*i+1]])
+	}
+	return sb.String()
+}
+
+// significantQueryParams returns the sorted, concatenated, decoded 'key=value' query parameters of the raw query
+// which are in the Delivery Service's consistent hash query parameters.
+func (ds deliveryService) significantQueryParams(rawQuery string) string {
+	if rawQuery == "" || len(ds.queryParams) == 0 {
+		return ""
+	}
+	params := map[string]struct{}{}
+	for _, param := range strings.Split(rawQuery, "&") {
+		parts := strings.Split(param, "=")
+		// Traffic Router splits with Java's String.split, which drops trailing empty strings.
+		for len(parts) > 0 && parts[len(parts)-1] == "" {
+			parts = parts[:len(parts)-1]
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		for i, part := range parts {
+			decoded, err := url.QueryUnescape(part)
+			if err != nil {
+				fmt.Println("ERROR decoding query parameters '" + rawQuery + "': " + err.Error())
+				return ""
+			}
+			parts[i] = decoded
+		}
+		if _, ok := ds.queryParams[parts[0]]; ok {
+			params[strings.Join(parts, "=")] = struct{}{}
+		}
+	}
+	sorted := make([]string, 0, len(params))
+	for param := range params {
+		sorted = append(sorted, param)
+	}
+	sort.Strings(sorted)
+	return strings.Join(sorted, "")
+}
+
+// SelectCaches returns the caches, of the given caches, for the given string to hash for a request to the given Delivery Service.
+// This is the Delivery Service's dispersion limit of caches, nearest the hash of the string on the hash ring, nearest first, unless the dispersion is shuffled.
+// Caches not in the CRConfig are never selected.
+func (h *ConsistentHasher) SelectCaches(dsName tc.DeliveryServiceName, caches []tc.CacheName, pathToHash string) []tc.CacheName {
+	dispersion := DefaultDispersion
+	if ds, ok := h.deliveryServices[dsName]; ok {
+		dispersion = ds.dispersion
+	}
+
+	hashes := make([][]float64, len(caches))
+	for i, cache := range caches {
+		hashes[i] = h.cacheHashes[cache]
+	}
+	selected := []tc.CacheName{}
+	for _, i := range selectHashables(hashes, Hash(pathToHash)) {
+		if len(selected) >= dispersion.Limit {
+			break
+		}
+		selected = append(selected, caches[i])
+	}
+	if dispersion.Shuffled {
+		rand.Shuffle(len(selected), func(i, j int) { selected[i], selected[j] = selected[j], selected[i] })
+	}
+	return selected
+}
+
+// SelectCache returns the cache, of the given caches, for a request to the given Delivery Service with the given path and raw query string,
+// or false if there are no caches.
+func (h *ConsistentHasher) SelectCache(dsName tc.DeliveryServiceName, caches []tc.CacheName, path string, rawQuery string) (tc.CacheName, bool) {
+	selected := h.SelectCaches(dsName, caches, h.PathToHash(dsName, path, rawQuery))
+	if len(selected) == 0 {
+		return "", false
+	}
+	return selected[0], true
+}
+
+// selectHashables returns the indexes of the given hashables which have hashes, ordered by the distance of their nearest hash to the given hash.
+// Ties are ordered like Traffic Router, which increments the distance of a later hashable to the next float64.
+func selectHashables(hashables [][]float64, hash float64) []int {
+	type hashDelta struct {
+		delta float64
+		i     int
+	}
+	deltas := make([]hashDelta, 0, len(hashables))
+	used := make(map[float64]struct{}, len(hashables))
+	for i, hashes := range hashables {
+		if len(hashes) == 0 {
+			continue
+		}
+		delta := math.Abs(hash - hashes[closest(hashes, hash)])
+		for {
+			if _, ok := used[delta]; !ok {
+				break
+			}
+			delta = math.Nextafter(delta, math.Inf(1))
+		}
+		used[delta] = struct{}{}
+		deltas = append(deltas, hashDelta{delta: delta, i: i})
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i].delta < deltas[j].delta })
+	indexes := make([]int, 0, len(deltas))
+	for _, d := range deltas {
+		indexes = append(indexes, d.i)
+	}
+	return indexes
+}
+
+// OrderHashables returns the indexes of all the given hashables, in the order Traffic Router selects them for the given string to hash.
+// Hashables with hashes are ordered by the distance of their nearest hash to the hash of the string. Hashables without hashes
+// and with a negative order are before them, and those with a non-negative order are after them, each by order.
+func OrderHashables(hashables [][]float64, orders []int, pathToHash string) []int {
+	indexes := selectHashables(hashables, Hash(pathToHash))
+	before := []int{}
+	after := []int{}
+	for i, hashes := range hashables {
+		if len(hashes) != 0 {
+			continue
+		}
+		if orders[i] < 0 {
+			before = append(before, i)
+		} else {
+			after = append(after, i)
+		}
+	}
+	// Traffic Router prepends negative orders one at a time, from the greatest, so equal orders end up reversed.
+	sort.SliceStable(before, func(i, j int) bool { return orders[before[i]] > orders[before[j]] })
+	for i, j := 0, len(before)-1; i < j; i, j = i+1, j-1 {
+		before[i], before[j] = before[j], before[i]
+	}
+	sort.SliceStable(after, func(i, j int) bool { return orders[after[i]] < orders[after[j]] })
+	return append(append(before, indexes...), after...)
+}
+
+// closest returns the index of the number in the sorted numbers nearest the target, preferring the smaller number of equally near numbers.
+func closest(numbers []float64, target float64) int {
+	i := sort.SearchFloat64s(numbers, target)
+	if i < len(numbers) && numbers[i] == target {
+		return i
+	}
+	if i == len(numbers) {
+		return len(numbers) - 1
+	}
+	if i == 0 {
+		return 0
+	}
+	if math.Abs(numbers[i]-target) < math.Abs(numbers[i-1]-target) {
+		return i
+	}
+	return i - 1
+}
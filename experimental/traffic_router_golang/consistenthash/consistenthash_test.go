@@ -0,0 +1,132 @@
+package consistenthash
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// The expected hashes are Java's new BigInteger(1, md5(s)).doubleValue(), which is Traffic Router's MD5HashFunction.
+func TestHash(t *testing.T) {
+	expected := map[string]float64{
+		"":                 2.8194976848941264e+38,
+		"some-string":      1.6828118558073791e+38,
+		"hashId1--0":       2.020443487809749e+38,
+		"/some/path/thing": 2.7692428826145138e+38,
+	}
+	for s, expectedHash := range expected {
+		if hash := Hash(s); hash != expectedHash {
+			t.Errorf("expected hash of '%v' %v, actual %v", s, expectedHash, hash)
+		}
+	}
+
+	hashes := HashValues("edge-1", 100)
+	if len(hashes) != 100 || hashes[0] != 7.696427309133804e+35 || hashes[1] != 2.0564976857760226e+36 {
+		t.Errorf("expected 100 sorted hashes starting with 7.696427309133804e+35, 2.0564976857760226e+36, actual %v %v", len(hashes), hashes[:2])
+	}
+	if hashes := HashValues("edge-1", 0); len(hashes) != DefaultHashCount {
+		t.Errorf("expected hash count 0 to use the default %v, actual %v", DefaultHashCount, len(hashes))
+	}
+}
+
+const testCRConfig = `{
+	"contentServers": {
+		"edge-1": {"hashCount": 100},
+		"edge-2": {"hashCount": 100, "hashId": "edge-2-hash"},
+		"edge-3": {"hashCount": 100}
+	},
+	"deliveryServices": {
+		"ds-path": {"dispersion": {"limit": 1, "shuffled": "true"}},
+		"ds-regex": {
+			"consistentHashRegex": "/.*?(/.*?/).*?(.m3u8)",
+			"consistentHashQueryParams": ["b", "c"],
+			"dispersion": {"limit": 3, "shuffled": "false"}
+		}
+	}
+}`
+
+func TestSelectCaches(t *testing.T) {
+	crc := &tc.CRConfig{}
+	if err := json.Unmarshal([]byte(testCRConfig), crc); err != nil {
+		t.Fatalf("unmarshalling test CRConfig: %v", err)
+	}
+	h, err := Create(crc)
+	if err != nil {
+		t.Fatalf("creating consistent hasher: %v", err)
+	}
+	caches := []tc.CacheName{"edge-1", "edge-2", "edge-3"}
+
+	// the expected orders are those of Traffic Router's ConsistentHasher, for the same hash IDs and counts.
+	expectedOrders := map[string][]tc.CacheName{
+		"/some/path/thing":        {"edge-3", "edge-1", "edge-2"},
+		"/another/different/path": {"edge-1", "edge-3", "edge-2"},
+		"/a/b.m3u8":               {"edge-2", "edge-1", "edge-3"},
+		"/x/y/z.ts":               {"edge-2", "edge-1", "edge-3"},
+		"/x/y/z.tsb=2c=3":         {"edge-1", "edge-3", "edge-2"},
+	}
+	for pathToHash, expected := range expectedOrders {
+		if actual := h.SelectCaches("ds-regex", caches, pathToHash); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("expected caches for '%v' %v, actual %v", pathToHash, expected, actual)
+		}
+		if actual, ok := h.SelectCache("ds-path", caches, pathToHash, ""); !ok || actual != expected[0] {
+			t.Errorf("expected cache for '%v' %v, actual %v", pathToHash, expected[0], actual)
+		}
+	}
+
+	if selected := h.SelectCaches("ds-path", nil, "/some/path/thing"); len(selected) != 0 {
+		t.Errorf("expected no caches to select none, actual %v", selected)
+	}
+}
+
+func TestPathToHash(t *testing.T) {
+	crc := &tc.CRConfig{}
+	if err := json.Unmarshal([]byte(testCRConfig), crc); err != nil {
+		t.Fatalf("unmarshalling test CRConfig: %v", err)
+	}
+	h, err := Create(crc)
+	if err != nil {
+		t.Fatalf("creating consistent hasher: %v", err)
+	}
+
+	tests := []struct {
+		ds       tc.DeliveryServiceName
+		path     string
+		rawQuery string
+		expected string
+	}{
+		{"ds-regex", "/path12341234/some_stream_name1234/some_info4321.m3u8", "", "/some_stream_name1234/.m3u8"},
+		{"ds-regex", "/pathasdf1234/some_stream_name1234/some_other_info.m3u8", "a=1", "/some_stream_name1234/.m3u8"},
+		{"ds-regex", "/x/y/z.ts", "c=3&a=1&b=2", "/x/y/z.tsb=2c=3"},
+		{"ds-regex", "/x/y/z.ts", "c=%2F3&b=", "/x/y/z.tsbc=/3"},
+		{"ds-regex", "", "b=2", "b=2"},
+		{"ds-path", "/x/y/z.ts", "b=2", "/x/y/z.ts"},
+		{"unknown", "/x/y/z.ts", "b=2", "/x/y/z.ts"},
+	}
+	for _, test := range tests {
+		if actual := h.PathToHash(test.ds, test.path, test.rawQuery); actual != test.expected {
+			t.Errorf("expected path to hash for ds '%v' path '%v' query '%v' to be '%v', actual '%v'", test.ds, test.path, test.rawQuery, test.expected, actual)
+		}
+	}
+}
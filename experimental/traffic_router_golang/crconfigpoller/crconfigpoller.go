@@ -29,8 +29,10 @@ import (
 	"time"
 
 	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/cgsrch"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/consistenthash"
 	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/crconfig"
 	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/crconfigregex"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/dnszones"
 	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/fetch"
 	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/nextcache"
 
@@ -83,11 +85,13 @@ func createNextCacher(crc *tc.CRConfig) nextcache.NextCacher {
 }
 
 // TODO implement HTTP poller
-func Start(fetcher fetch.Fetcher, interval time.Duration) (crconfig.Ths, crconfigregex.Ths, cgsrch.Ths, nextcache.Ths, error) {
+func Start(fetcher fetch.Fetcher, interval time.Duration) (crconfig.Ths, crconfigregex.Ths, cgsrch.Ths, nextcache.Ths, consistenthash.Ths, dnszones.Ths, error) {
 	thsCrcRgx := crconfigregex.NewThs()
 	thsCrc := crconfig.NewThs()
 	thsCGSearcher := cgsrch.NewThs()
 	thsNextCacher := nextcache.NewThs()
+	thsConsistentHasher := consistenthash.NewThs()
+	thsDNSZones := dnszones.NewThs()
 	prevBts := []byte{}
 	prevCrc := (*tc.CRConfig)(nil)
 
@@ -125,7 +129,19 @@ func Start(fetcher fetch.Fetcher, interval time.Duration) (crconfig.Ths, crconfi
 			fmt.Println("ERROR not using invalid new CRConfig: failed to create Cachegroup searcher: " + err.Error())
 		}
 		nextCacher := createNextCacher(crc)
+		consistentHasher, err := consistenthash.Create(crc)
+		if err != nil {
+			fmt.Println("ERROR not using invalid new CRConfig: failed to create consistent hasher: " + err.Error())
+			return
+		}
+		dnsZones, err := dnszones.Create(crc)
+		if err != nil {
+			fmt.Println("ERROR not using invalid new CRConfig: failed to create DNS zones: " + err.Error())
+			return
+		}
 
+		thsDNSZones.Set(dnsZones)
+		thsConsistentHasher.Set(consistentHasher)
 		thsNextCacher.Set(nextCacher)
 		thsCGSearcher.Set(cgSearcher)
 		thsCrc.Set(crc)
@@ -143,5 +159,5 @@ func Start(fetcher fetch.Fetcher, interval time.Duration) (crconfig.Ths, crconfi
 			get()
 		}
 	}()
-	return thsCrc, thsCrcRgx, thsCGSearcher, thsNextCacher, nil
+	return thsCrc, thsCrcRgx, thsCGSearcher, thsNextCacher, thsConsistentHasher, thsDNSZones, nil
 }
@@ -0,0 +1,99 @@
+package deepcoveragezone
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"errors"
+	"net"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// JSONDeepCoverageZones is a Traffic Router deep coverage zone file.
+type JSONDeepCoverageZones struct {
+	DeepCoverageZones map[string]JSONDeepCoverageZoneLocation `json:"deepCoverageZones"`
+	CustomerName      string                                  `json:"customerName"`
+	Revision          string                                  `json:"revision"`
+}
+
+// JSONDeepCoverageZoneLocation is a location in a deep coverage zone file, with its client networks and the names of the deep caches in it.
+type JSONDeepCoverageZoneLocation struct {
+	Network  []string       `json:"network"`
+	Network6 []string       `json:"network6"`
+	Caches   []tc.CacheName `json:"caches"`
+}
+
+// DeepCoverageZone maps client networks to the deep caches in them.
+type DeepCoverageZone struct {
+	nets  []netCaches
+	net6s []netCaches
+}
+
+type netCaches struct {
+	net    *net.IPNet
+	caches []tc.CacheName
+}
+
+// Create creates the DeepCoverageZone of the given deep coverage zone file.
+func Create(jdcz JSONDeepCoverageZones) (*DeepCoverageZone, error) {
+	d := &DeepCoverageZone{}
+	for location, jloc := range jdcz.DeepCoverageZones {
+		for _, cidr := range jloc.Network {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, errors.New("parsing location '" + location + "' network '" + cidr + "': " + err.Error())
+			}
+			d.nets = append(d.nets, netCaches{net: network, caches: jloc.Caches})
+		}
+		for _, cidr := range jloc.Network6 {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, errors.New("parsing location '" + location + "' network6 '" + cidr + "': " + err.Error())
+			}
+			d.net6s = append(d.net6s, netCaches{net: network, caches: jloc.Caches})
+		}
+	}
+	return d, nil
+}
+
+// Get returns the names of the deep caches for the given client IP, from the most specific network containing it, and false if no network contains it.
+// A nil DeepCoverageZone has no networks.
+func (d *DeepCoverageZone) Get(ip net.IP) ([]tc.CacheName, bool) {
+	if d == nil {
+		return nil, false
+	}
+	nets := d.net6s
+	if ip.To4() != nil {
+		nets = d.nets
+	}
+	caches := []tc.CacheName(nil)
+	bestLen := -1
+	for _, nc := range nets {
+		if !nc.net.Contains(ip) {
+			continue
+		}
+		if prefixLen, _ := nc.net.Mask.Size(); prefixLen > bestLen {
+			caches = nc.caches
+			bestLen = prefixLen
+		}
+	}
+	return caches, bestLen >= 0
+}
@@ -0,0 +1,81 @@
+package deepcoveragezone
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+const testDeepCoverageZone = `{
+	"deepCoverageZones": {
+		"wide": {
+			"network": ["192.0.0.0/16"],
+			"network6": ["2001:db8::/32"],
+			"caches": ["deep-1", "deep-2"]
+		},
+		"narrow": {
+			"network": ["192.0.2.0/24"],
+			"network6": ["2001:db8:1::/48"],
+			"caches": ["deep-3"]
+		}
+	}
+}`
+
+func TestGet(t *testing.T) {
+	jdcz := JSONDeepCoverageZones{}
+	if err := json.Unmarshal([]byte(testDeepCoverageZone), &jdcz); err != nil {
+		t.Fatalf("unmarshalling test deep coverage zone: %v", err)
+	}
+	deepCZ, err := Create(jdcz)
+	if err != nil {
+		t.Fatalf("creating deep coverage zone: %v", err)
+	}
+
+	tests := []struct {
+		ip       string
+		expected []tc.CacheName
+	}{
+		{"192.0.2.1", []tc.CacheName{"deep-3"}},
+		{"192.0.3.1", []tc.CacheName{"deep-1", "deep-2"}},
+		{"2001:db8:1::1", []tc.CacheName{"deep-3"}},
+		{"2001:db8:2::1", []tc.CacheName{"deep-1", "deep-2"}},
+		{"198.51.100.1", nil},
+		{"2001:db9::1", nil},
+	}
+	for _, test := range tests {
+		caches, ok := deepCZ.Get(net.ParseIP(test.ip))
+		if ok != (test.expected != nil) || !reflect.DeepEqual(caches, test.expected) {
+			t.Errorf("expected ip %v to get deep caches %v, actual %v %v", test.ip, test.expected, caches, ok)
+		}
+	}
+
+	if _, ok := (*DeepCoverageZone)(nil).Get(net.ParseIP("192.0.2.1")); ok {
+		t.Error("expected nil deep coverage zone to have no networks")
+	}
+	if _, err := Create(JSONDeepCoverageZones{DeepCoverageZones: map[string]JSONDeepCoverageZoneLocation{"invalid": {Network: []string{"192.0.2.0/33"}}}}); err == nil {
+		t.Error("expected invalid network to error")
+	}
+}
@@ -0,0 +1,142 @@
+package deepcoveragezonepoller
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/crconfig"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/deepcoveragezone"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/fetch"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// DefaultInterval is the interval to poll the deep coverage zone file, if neither the config nor the CRConfig has one.
+const DefaultInterval = time.Minute
+
+// pollingURL returns the CRConfig's 'deepcoveragezone.polling.url', or the empty string if it has none.
+func pollingURL(crc *tc.CRConfig) string {
+	if crc == nil {
+		return ""
+	}
+	url, _ := crc.Config["deepcoveragezone.polling.url"].(string)
+	return url
+}
+
+// pollingInterval returns the CRConfig's 'deepcoveragezone.polling.interval' in milliseconds, or the default if it has none.
+func pollingInterval(crc *tc.CRConfig) time.Duration {
+	if crc == nil {
+		return DefaultInterval
+	}
+	intervalStr := ""
+	switch interval := crc.Config["deepcoveragezone.polling.interval"].(type) {
+	case string:
+		intervalStr = interval
+	case float64:
+		intervalStr = strconv.FormatFloat(interval, 'f', -1, 64)
+	}
+	ms, err := strconv.ParseInt(intervalStr, 10, 64)
+	if err != nil || ms <= 0 {
+		return DefaultInterval
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// newFetcher returns a fetcher of the given file location, which is an HTTP URL, a file URL, or a local path.
+func newFetcher(location string, timeout time.Duration, userAgent string) fetch.Fetcher {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return fetch.NewHTTP(location, timeout, userAgent)
+	}
+	return fetch.NewFile(strings.TrimPrefix(location, "file://"))
+}
+
+// Start polls the deep coverage zone file, and returns the threadsafe DeepCoverageZone, which is nil until one is loaded.
+// The file is read from the given file, if it isn't empty, or else from the CRConfig's deep coverage zone polling URL.
+// It is polled every interval, or the CRConfig's deep coverage zone polling interval if interval is 0, and reloaded when it changes.
+func Start(file string, crc crconfig.Ths, interval time.Duration, timeout time.Duration, userAgent string) deepcoveragezone.Ths {
+	thsDeepCZ := deepcoveragezone.NewThs()
+	prevLocation := ""
+	prevBts := []byte{}
+	fetcher := fetch.Fetcher(nil)
+
+	get := func() {
+		location := file
+		if location == "" {
+			location = pollingURL(crc.Get())
+		}
+		if location == "" {
+			fmt.Println("INFO deep coverage zone has no file or CRConfig URL, not deep caching.")
+			return
+		}
+		if location != prevLocation {
+			fetcher = newFetcher(location, timeout, userAgent)
+		}
+
+		newBts, err := fetcher.Fetch()
+		if err != nil {
+			fmt.Println("ERROR deep coverage zone '" + location + "' read error: " + err.Error())
+			return
+		}
+
+		if bytes.Equal(newBts, prevBts) {
+			fmt.Println("INFO deep coverage zone unchanged.")
+			return
+		}
+
+		fmt.Println("INFO deep coverage zone '" + location + "' changed.")
+		jdcz := deepcoveragezone.JSONDeepCoverageZones{}
+		if err := json.Unmarshal(newBts, &jdcz); err != nil {
+			fmt.Println("ERROR deep coverage zone '" + location + "' unmarshalling: " + err.Error())
+			return
+		}
+
+		deepCZ, err := deepcoveragezone.Create(jdcz)
+		if err != nil {
+			fmt.Println("ERROR not using invalid new deep coverage zone '" + location + "': " + err.Error())
+			return
+		}
+
+		thsDeepCZ.Set(deepCZ)
+		prevLocation = location
+		prevBts = newBts
+		fmt.Println("INFO deep coverage zone set new")
+	}
+
+	get()
+
+	go func() {
+		for {
+			if interval != 0 {
+				time.Sleep(interval)
+			} else {
+				time.Sleep(pollingInterval(crc.Get()))
+			}
+			get()
+		}
+	}()
+	return thsDeepCZ
+}
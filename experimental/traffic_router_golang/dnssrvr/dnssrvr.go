@@ -0,0 +1,281 @@
+package dnssrvr
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/availableservers"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/cgsrch"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/coveragezone"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/crconfig"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/crconfigregex"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/dnszones"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/federation"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/geolocation"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/httpsrvr"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/nextcache"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+
+	"github.com/miekg/dns"
+)
+
+// router answers DNS queries for the CDN.
+type router struct {
+	crcThs        crconfig.Ths
+	regexes       crconfigregex.Ths
+	zonesThs      dnszones.Ths
+	availSrvrs    availableservers.AvailableServers
+	cgSrchThs     cgsrch.Ths
+	nextCacherThs nextcache.Ths
+	cz            coveragezone.CoverageZone
+	geoThs        geolocation.Ths
+	fedThs        federation.Ths
+}
+
+func (rt *router) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := &dns.Msg{}
+	m.SetReply(r)
+	if len(r.Question) != 1 {
+		m.Rcode = dns.RcodeFormatError
+		writeMsg(w, m)
+		return
+	}
+	m.Rcode = rt.resolve(r.Question[0], clientIP(w.RemoteAddr()), m)
+	writeMsg(w, m)
+}
+
+func writeMsg(w dns.ResponseWriter, m *dns.Msg) {
+	if err := w.WriteMsg(m); err != nil {
+		log.Errorln("writing DNS response to " + w.RemoteAddr().String() + ": " + err.Error())
+	}
+}
+
+// clientIP returns the IP of the given DNS client address, or nil if it isn't a UDP or TCP address.
+func clientIP(addr net.Addr) net.IP {
+	switch addr := addr.(type) {
+	case *net.UDPAddr:
+		return addr.IP
+	case *net.TCPAddr:
+		return addr.IP
+	}
+	return nil
+}
+
+// resolve adds the answer to the given question from the given client to the message, and returns the response code.
+func (rt *router) resolve(q dns.Question, ip net.IP, m *dns.Msg) int {
+	zones := rt.zonesThs.Get()
+	if zones == nil {
+		fmt.Println("ERROR DNS request '" + q.Name + "' before DNS zones were loaded, returning SERVFAIL")
+		return dns.RcodeServerFailure
+	}
+	zone, ok := (*dnszones.Zones)(zones).Zone(q.Name)
+	if !ok {
+		fmt.Println("EVENT DNS request '" + q.Name + "' not in the CDN domain, returning REFUSED")
+		return dns.RcodeRefused
+	}
+	m.Authoritative = true
+	name := strings.ToLower(q.Name)
+
+	if rrs, ok := zones.Records[name]; ok {
+		answers := []dns.RR{}
+		for _, rr := range rrs {
+			if rrType := rr.Header().Rrtype; rrType == q.Qtype || rrType == dns.TypeCNAME || q.Qtype == dns.TypeANY {
+				answers = append(answers, rr)
+			}
+		}
+		return answer(m, zone, answers)
+	}
+
+	if name == zone.Name {
+		switch q.Qtype {
+		case dns.TypeSOA:
+			return answer(m, zone, []dns.RR{zone.SOA})
+		case dns.TypeNS:
+			for _, ns := range zone.NS {
+				m.Extra = append(m.Extra, zones.Records[ns.(*dns.NS).Ns]...)
+			}
+			return answer(m, zone, zone.NS)
+		}
+		return answer(m, zone, nil)
+	}
+
+	fqdnParts := strings.Split(strings.TrimSuffix(name, "."), ".")
+	if len(fqdnParts) < 3 {
+		fmt.Println("EVENT DNS request '" + q.Name + "' doesn't have enough parts (must be 'subsubdomain.subdomain.domain'), returning NXDOMAIN")
+		m.Ns = []dns.RR{zone.SOA}
+		return dns.RcodeNameError
+	}
+	subsubdomain := fqdnParts[0]
+	subdomain := fqdnParts[1]
+	domain := strings.Join(fqdnParts[2:], ".")
+
+	dsRegexes := (*crconfigregex.Regexes)(rt.regexes.Get())
+	dsName, ok := dsRegexes.DeliveryService(domain, subdomain, subsubdomain)
+	if !ok {
+		fmt.Println("EVENT DNS request '" + q.Name + "' has no match, returning NXDOMAIN")
+		m.Ns = []dns.RR{zone.SOA}
+		return dns.RcodeNameError
+	}
+	ds, ok := zones.DeliveryServices[dsName]
+	if !ok {
+		// should never happen, the regexes and zones are from the same CRConfig
+		fmt.Println("ERROR DNS request '" + q.Name + "' matched ds '" + string(dsName) + "' not found in DNS zones, returning SERVFAIL")
+		return dns.RcodeServerFailure
+	}
+
+	if q.Qtype != dns.TypeA && q.Qtype != dns.TypeAAAA && q.Qtype != dns.TypeANY {
+		return answer(m, zone, nil)
+	}
+
+	if !ds.DNS {
+		answers := []dns.RR{}
+		for _, addrs := range zones.Routers {
+			answers = append(answers, addrRRs(name, q.Qtype, addrs, ds)...)
+		}
+		return answer(m, zone, answers)
+	}
+
+	fmt.Println("EVENT DNS request from " + ip.String() + " for '" + q.Name + "' matched " + string(dsName))
+
+	crcDS := (*tc.CRConfigDeliveryService)(nil)
+	if crc := rt.crcThs.Get(); crc != nil {
+		if ds, ok := crc.DeliveryServices[string(dsName)]; ok {
+			crcDS = &ds
+		}
+	}
+
+	if mapping, ok := federation.Find(ip, dsName, crcDS, rt.cz, (*federation.Federations)(rt.fedThs.Get())); ok {
+		fmt.Println("EVENT DNS request from " + ip.String() + " for '" + q.Name + "' ds '" + string(dsName) + "' federated, returning CNAME '" + mapping.CName + "'")
+		return answer(m, zone, []dns.RR{federationRR(name, mapping)})
+	}
+
+	pos, ok := geolocation.Locate(ip, crcDS, rt.cz, (*geolocation.DB)(rt.geoThs.Get()), httpsrvr.DefaultPos)
+	if !ok {
+		// Like Traffic Router, geo-limited clients get no addresses, and DNS has no redirect.
+		fmt.Println("EVENT DNS request from " + ip.String() + " for '" + q.Name + "' ds '" + string(dsName) + "' geo-limited, returning no addresses")
+		return answer(m, zone, nil)
+	}
+
+	cgDat, ok := rt.cgSrchThs.Get().Nearest(pos.Lat, pos.Lon)
+	if !ok {
+		fmt.Println("ERROR DNS request from " + ip.String() + " has no nearest cachegroup (should only happen if there are no cachegroups)")
+		return dns.RcodeServerFailure
+	}
+	cg := tc.CacheGroupName(cgDat.Obj)
+
+	srvrs, err := rt.availSrvrs.Get(dsName, cg)
+	if err != nil || len(srvrs) == 0 {
+		fmt.Println("EVENT DNS request '" + q.Name + "' with cg '" + string(cg) + "' ds '" + string(dsName) + "' no available servers, returning SERVFAIL")
+		return dns.RcodeServerFailure
+	}
+
+	nextSrvrI, ok := rt.nextCacherThs.Get().NextCache(dsName)
+	if !ok {
+		// should never happen
+		fmt.Println("ERROR DNS request '" + q.Name + "' with cg '" + string(cg) + "' ds '" + string(dsName) + "' not found in Nextcacher, returning SERVFAIL")
+		return dns.RcodeServerFailure
+	}
+
+	numIPs := len(srvrs)
+	if ds.MaxIPs > 0 && ds.MaxIPs < numIPs {
+		numIPs = ds.MaxIPs
+	}
+	answers := []dns.RR{}
+	for i := 0; i < numIPs; i++ {
+		srvr := srvrs[(nextSrvrI+uint64(i))%uint64(len(srvrs))]
+		answers = append(answers, addrRRs(name, q.Qtype, zones.Caches[srvr], ds)...)
+	}
+	return answer(m, zone, answers)
+}
+
+// addrRRs returns the A or AAAA records of the given addresses for the given query type, with the Delivery Service TTLs.
+func addrRRs(name string, qtype uint16, addrs dnszones.Addrs, ds dnszones.DeliveryService) []dns.RR {
+	rrs := []dns.RR{}
+	if qtype == dns.TypeA || qtype == dns.TypeANY {
+		rrs = append(rrs, dnszones.AddrRRs(name, dnszones.Addrs{IP: addrs.IP}, false, ds.ATTL)...)
+	}
+	if qtype == dns.TypeAAAA || qtype == dns.TypeANY {
+		rrs = append(rrs, dnszones.AddrRRs(name, dnszones.Addrs{IP6: addrs.IP6}, ds.IP6, ds.AAAATTL)...)
+	}
+	return rrs
+}
+
+// federationRR returns the CNAME record of the given federation mapping.
+func federationRR(name string, mapping federation.Mapping) dns.RR {
+	return &dns.CNAME{
+		Hdr:    dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: uint32(mapping.TTL)},
+		Target: dns.Fqdn(mapping.CName),
+	}
+}
+
+// answer sets the answers in the message. If there are no answers, the zone's SOA is added to the authority section, to indicate the name has no data of the requested type.
+func answer(m *dns.Msg, zone dnszones.Zone, answers []dns.RR) int {
+	if len(answers) == 0 {
+		m.Ns = []dns.RR{zone.SOA}
+		return dns.RcodeSuccess
+	}
+	m.Answer = answers
+	return dns.RcodeSuccess
+}
+
+// Start starts serving DNS over UDP and TCP on the given port, and returns the servers.
+func Start(
+	crc crconfig.Ths,
+	regexes crconfigregex.Ths,
+	zones dnszones.Ths,
+	availableServers availableservers.AvailableServers,
+	cgSrch cgsrch.Ths,
+	nextCacher nextcache.Ths,
+	cz coveragezone.CoverageZone,
+	geo geolocation.Ths,
+	feds federation.Ths,
+	port uint,
+) []*dns.Server {
+	handler := &router{
+		crcThs:        crc,
+		regexes:       regexes,
+		zonesThs:      zones,
+		availSrvrs:    availableServers,
+		cgSrchThs:     cgSrch,
+		nextCacherThs: nextCacher,
+		cz:            cz,
+		geoThs:        geo,
+		fedThs:        feds,
+	}
+	srvrs := []*dns.Server{}
+	for _, network := range []string{"udp", "tcp"} {
+		srvr := &dns.Server{Addr: ":" + strconv.Itoa(int(port)), Net: network, Handler: handler}
+		go func(srvr *dns.Server) {
+			err := srvr.ListenAndServe()
+			if err != nil {
+				fmt.Println("Serving DNS " + srvr.Net + ": " + err.Error())
+			}
+		}(srvr)
+		srvrs = append(srvrs, srvr)
+	}
+	return srvrs
+}
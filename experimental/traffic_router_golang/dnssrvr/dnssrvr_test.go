@@ -0,0 +1,334 @@
+package dnssrvr
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"encoding/json"
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/availableservers"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/cgsrch"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/coveragezone"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/crconfig"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/crconfigregex"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/dnszones"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/federation"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/geolocation"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/nextcache"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+
+	"github.com/miekg/dns"
+)
+
+const testCRConfig = `{
+	"config": {
+		"domain_name": "mycdn.example.net",
+		"soa": {"admin": "traffic_ops", "expire": "604800", "minimum": "30", "refresh": "28800", "retry": "7200"},
+		"ttls": {"A": "3600", "AAAA": "3600", "NS": "3600", "SOA": "86400"}
+	},
+	"contentRouters": {
+		"tr-1": {"fqdn": "tr-1.mycdn.example.net", "ip": "192.0.2.1", "ip6": "2001:db8::1/64", "status": "ONLINE"},
+		"tr-2": {"fqdn": "tr-2.mycdn.example.net", "ip": "192.0.2.2", "status": "OFFLINE"}
+	},
+	"contentServers": {
+		"edge-1": {"cacheGroup": "cg-east", "ip": "198.51.100.1", "ip6": "2001:db8:1::1/64", "deliveryServices": {"dns-ds": [], "http-ds": []}},
+		"edge-2": {"cacheGroup": "cg-east", "ip": "198.51.100.2", "ip6": "2001:db8:1::2/64", "deliveryServices": {"dns-ds": [], "http-ds": []}},
+		"edge-3": {"cacheGroup": "cg-east", "ip": "198.51.100.3", "ip6": "2001:db8:1::3/64", "deliveryServices": {"dns-ds": [], "http-ds": []}}
+	},
+	"deliveryServices": {
+		"dns-ds": {
+			"domains": ["dns-ds.mycdn.example.net"],
+			"ip6RoutingEnabled": "true",
+			"matchsets": [{"protocol": "DNS", "matchlist": [{"regex": ".*\\.dns-ds\\..*", "match-type": "HOST"}]}],
+			"maxDnsIpsForLocation": 2,
+			"missLocation": {"lat": 41, "long": -74},
+			"routingName": "edge",
+			"staticDnsEntries": [{"name": "static", "ttl": 300, "type": "A_RECORD", "value": "203.0.113.1"}],
+			"ttls": {"A": "60", "AAAA": "120"}
+		},
+		"cz-only-ds": {
+			"coverageZoneOnly": "true",
+			"domains": ["cz-only-ds.mycdn.example.net"],
+			"matchsets": [{"protocol": "DNS", "matchlist": [{"regex": ".*\\.cz-only-ds\\..*", "match-type": "HOST"}]}],
+			"routingName": "edge"
+		},
+		"http-ds": {
+			"domains": ["http-ds.mycdn.example.net"],
+			"matchsets": [{"protocol": "HTTP", "matchlist": [{"regex": ".*\\.http-ds\\..*", "match-type": "HOST"}]}],
+			"routingName": "ccr"
+		}
+	},
+	"edgeLocations": {
+		"cg-east": {"latitude": 40, "longitude": -75},
+		"cg-west": {"latitude": 37, "longitude": -122}
+	},
+	"stats": {"CDN_name": "mycdn", "date": 1618300000}
+}`
+
+func testRouter(t *testing.T) *router {
+	crc := &tc.CRConfig{}
+	if err := json.Unmarshal([]byte(testCRConfig), crc); err != nil {
+		t.Fatalf("unmarshalling test CRConfig: %v", err)
+	}
+
+	crcThs := crconfig.NewThs()
+	crcThs.Set(crc)
+
+	zones, err := dnszones.Create(crc)
+	if err != nil {
+		t.Fatalf("creating DNS zones: %v", err)
+	}
+	zonesThs := dnszones.NewThs()
+	zonesThs.Set(zones)
+
+	regexes, err := crconfigregex.Get(crc)
+	if err != nil {
+		t.Fatalf("creating regexes: %v", err)
+	}
+	regexesThs := crconfigregex.NewThs()
+	regexesThs.Set(&regexes)
+
+	cgSearcher, err := cgsrch.Create(crc)
+	if err != nil {
+		t.Fatalf("creating cachegroup searcher: %v", err)
+	}
+	cgSrchThs := cgsrch.NewThs()
+	cgSrchThs.Set(cgSearcher)
+
+	nextCacherThs := nextcache.NewThs()
+	nextCacherThs.Set(nextcache.New([]tc.DeliveryServiceName{"cz-only-ds", "dns-ds", "http-ds"}))
+
+	availSrvrs := availableservers.New()
+	availSrvrs.Set(availableservers.AvailableServersMap{
+		"cz-only-ds": {"cg-east": {"edge-3"}},
+		"dns-ds":     {"cg-east": {"edge-1", "edge-2", "edge-3"}},
+	})
+
+	cz, err := coveragezone.New(coveragezone.JSONCoverageZones{CoverageZones: map[tc.CacheGroupName]coveragezone.JSONCoverageZoneCacheGroup{
+		"cg-east": {Coordinates: tc.CRConfigLatitudeLongitude{Lat: 40, Lon: -75}, Network: []string{"10.0.0.0/8"}},
+	}})
+	if err != nil {
+		t.Fatalf("creating coverage zone: %v", err)
+	}
+
+	feds, err := federation.Create(testFederations())
+	if err != nil {
+		t.Fatalf("creating federations: %v", err)
+	}
+	fedThs := federation.NewThs()
+	fedThs.Set(feds)
+
+	return &router{
+		crcThs:        crcThs,
+		regexes:       regexesThs,
+		zonesThs:      zonesThs,
+		availSrvrs:    availSrvrs,
+		cgSrchThs:     cgSrchThs,
+		nextCacherThs: nextCacherThs,
+		cz:            cz,
+		geoThs:        geolocation.NewThs(),
+		fedThs:        fedThs,
+	}
+}
+
+func testFederations() []tc.AllDeliveryServiceFederationsMapping {
+	wide := "wide.fed.example.net."
+	narrow := "narrow.fed.example.net"
+	wideTTL := 300
+	narrowTTL := 30
+	return []tc.AllDeliveryServiceFederationsMapping{
+		{DeliveryService: "dns-ds", Mappings: []tc.FederationResolverMapping{
+			{CName: &wide, TTL: &wideTTL, ResolverMapping: tc.ResolverMapping{Resolve4: []string{"203.0.113.0/24"}, Resolve6: []string{"2001:db8:f::/48"}}},
+			{CName: &narrow, TTL: &narrowTTL, ResolverMapping: tc.ResolverMapping{Resolve4: []string{"203.0.113.128/25", "10.1.2.3"}, Resolve6: []string{"2001:db8:f:1::/64"}}},
+		}},
+		{DeliveryService: "cz-only-ds", Mappings: []tc.FederationResolverMapping{
+			{CName: &wide, TTL: &wideTTL, ResolverMapping: tc.ResolverMapping{Resolve4: []string{"203.0.113.0/24"}}},
+		}},
+	}
+}
+
+func resolveTest(rt *router, name string, qtype uint16) (*dns.Msg, int) {
+	return resolveTestFrom(rt, name, qtype, "10.1.2.3")
+}
+
+func resolveTestFrom(rt *router, name string, qtype uint16, ip string) (*dns.Msg, int) {
+	m := &dns.Msg{}
+	rcode := rt.resolve(dns.Question{Name: name, Qtype: qtype, Qclass: dns.ClassINET}, net.ParseIP(ip), m)
+	return m, rcode
+}
+
+func answerValues(m *dns.Msg) []string {
+	vals := []string{}
+	for _, rr := range m.Answer {
+		switch rr := rr.(type) {
+		case *dns.A:
+			vals = append(vals, rr.A.String())
+		case *dns.AAAA:
+			vals = append(vals, rr.AAAA.String())
+		case *dns.NS:
+			vals = append(vals, rr.Ns)
+		case *dns.CNAME:
+			vals = append(vals, rr.Target)
+		case *dns.SOA:
+			vals = append(vals, rr.Ns+" "+rr.Mbox)
+		}
+	}
+	sort.Strings(vals)
+	return vals
+}
+
+func TestResolveDNSDeliveryService(t *testing.T) {
+	rt := testRouter(t)
+
+	m, rcode := resolveTest(rt, "edge.dns-ds.mycdn.example.net.", dns.TypeA)
+	if rcode != dns.RcodeSuccess || !m.Authoritative {
+		t.Fatalf("expected authoritative success, actual rcode %v authoritative %v", rcode, m.Authoritative)
+	}
+	if len(m.Answer) != 2 {
+		t.Fatalf("expected maxDnsIpsForLocation 2 answers, actual %v", answerValues(m))
+	}
+	if ttl := m.Answer[0].Header().Ttl; ttl != 60 {
+		t.Errorf("expected delivery service A TTL 60, actual %v", ttl)
+	}
+	first := answerValues(m)
+
+	m, _ = resolveTest(rt, "EDGE.dns-ds.mycdn.example.net.", dns.TypeA)
+	if second := answerValues(m); len(second) != 2 || (first[0] == second[0] && first[1] == second[1]) {
+		t.Errorf("expected successive answers to rotate caches, actual %v then %v", first, second)
+	}
+
+	m, _ = resolveTest(rt, "edge.dns-ds.mycdn.example.net.", dns.TypeAAAA)
+	if len(m.Answer) != 2 || m.Answer[0].Header().Ttl != 120 {
+		t.Errorf("expected 2 AAAA answers with TTL 120, actual %v", m.Answer)
+	}
+
+	m, _ = resolveTest(rt, "static.dns-ds.mycdn.example.net.", dns.TypeA)
+	if vals := answerValues(m); len(vals) != 1 || vals[0] != "203.0.113.1" || m.Answer[0].Header().Ttl != 300 {
+		t.Errorf("expected static entry 203.0.113.1 with TTL 300, actual %v", m.Answer)
+	}
+}
+
+func TestResolveHTTPDeliveryService(t *testing.T) {
+	rt := testRouter(t)
+
+	m, rcode := resolveTest(rt, "ccr.http-ds.mycdn.example.net.", dns.TypeA)
+	if vals := answerValues(m); rcode != dns.RcodeSuccess || len(vals) != 1 || vals[0] != "192.0.2.1" {
+		t.Errorf("expected HTTP delivery service to resolve to the online Traffic Router, actual %v %v", rcode, vals)
+	}
+	if ttl := m.Answer[0].Header().Ttl; ttl != 3600 {
+		t.Errorf("expected CDN A TTL 3600, actual %v", ttl)
+	}
+
+	m, rcode = resolveTest(rt, "ccr.http-ds.mycdn.example.net.", dns.TypeAAAA)
+	if rcode != dns.RcodeSuccess || len(m.Answer) != 0 || len(m.Ns) != 1 {
+		t.Errorf("expected AAAA of delivery service without IPv6 routing to have no data, actual %v %v %v", rcode, m.Answer, m.Ns)
+	}
+}
+
+func TestResolveZone(t *testing.T) {
+	rt := testRouter(t)
+
+	m, _ := resolveTest(rt, "mycdn.example.net.", dns.TypeNS)
+	if vals := answerValues(m); len(vals) != 1 || vals[0] != "tr-1.mycdn.example.net." {
+		t.Errorf("expected NS of the online Traffic Router, actual %v", vals)
+	}
+	if len(m.Extra) != 2 {
+		t.Errorf("expected A and AAAA glue records, actual %v", m.Extra)
+	}
+
+	m, _ = resolveTest(rt, "dns-ds.mycdn.example.net.", dns.TypeSOA)
+	if vals := answerValues(m); len(vals) != 1 || vals[0] != "tr-1.mycdn.example.net. traffic_ops.dns-ds.mycdn.example.net." {
+		t.Errorf("expected delivery service zone SOA, actual %v", vals)
+	}
+	if soa := m.Answer[0].(*dns.SOA); soa.Serial != 1618300000 || soa.Minttl != 30 || soa.Hdr.Ttl != 86400 {
+		t.Errorf("expected SOA values from the CRConfig, actual %v", soa)
+	}
+
+	m, _ = resolveTest(rt, "tr-1.mycdn.example.net.", dns.TypeA)
+	if vals := answerValues(m); len(vals) != 1 || vals[0] != "192.0.2.1" {
+		t.Errorf("expected Traffic Router address, actual %v", vals)
+	}
+
+	if m, rcode := resolveTest(rt, "nope.nope.mycdn.example.net.", dns.TypeA); rcode != dns.RcodeNameError || len(m.Ns) != 1 {
+		t.Errorf("expected unknown name to be NXDOMAIN with SOA, actual %v %v", rcode, m.Ns)
+	}
+	if m, rcode := resolveTest(rt, "www.example.com.", dns.TypeA); rcode != dns.RcodeRefused || m.Authoritative {
+		t.Errorf("expected name outside the CDN to be refused, actual %v", rcode)
+	}
+}
+
+func TestResolveGeoLimit(t *testing.T) {
+	rt := testRouter(t)
+
+	m, rcode := resolveTest(rt, "edge.cz-only-ds.mycdn.example.net.", dns.TypeA)
+	if vals := answerValues(m); rcode != dns.RcodeSuccess || len(vals) != 1 || vals[0] != "198.51.100.3" {
+		t.Errorf("expected coverage zone client to resolve coverage zone only delivery service, actual %v %v", rcode, vals)
+	}
+
+	m, rcode = resolveTestFrom(rt, "edge.cz-only-ds.mycdn.example.net.", dns.TypeA, "192.0.2.200")
+	if rcode != dns.RcodeSuccess || len(m.Answer) != 0 || len(m.Ns) != 1 {
+		t.Errorf("expected client outside the coverage zone to get no addresses, actual %v %v %v", rcode, m.Answer, m.Ns)
+	}
+
+	m, _ = resolveTestFrom(rt, "edge.dns-ds.mycdn.example.net.", dns.TypeA, "192.0.2.200")
+	if len(m.Answer) != 2 {
+		t.Errorf("expected client outside the coverage zone to be routed from the miss location, actual %v", answerValues(m))
+	}
+}
+
+func TestResolveFederation(t *testing.T) {
+	rt := testRouter(t)
+
+	tests := []struct {
+		ip            string
+		expectedCName string
+		expectedTTL   uint32
+	}{
+		{"203.0.113.1", "wide.fed.example.net.", 300},
+		{"203.0.113.129", "narrow.fed.example.net.", 30},
+		{"2001:db8:f::1", "wide.fed.example.net.", 300},
+		{"2001:db8:f:1::1", "narrow.fed.example.net.", 30},
+	}
+	for _, test := range tests {
+		m, rcode := resolveTestFrom(rt, "edge.dns-ds.mycdn.example.net.", dns.TypeA, test.ip)
+		if vals := answerValues(m); rcode != dns.RcodeSuccess || len(vals) != 1 || vals[0] != test.expectedCName || m.Answer[0].Header().Ttl != test.expectedTTL {
+			t.Errorf("expected resolver %v to get federation CNAME '%v' TTL %v, actual %v %v", test.ip, test.expectedCName, test.expectedTTL, rcode, m.Answer)
+		}
+	}
+
+	m, _ := resolveTest(rt, "edge.dns-ds.mycdn.example.net.", dns.TypeA)
+	if len(m.Answer) != 2 {
+		t.Errorf("expected federated resolver in the coverage zone to get caches, actual %v", answerValues(m))
+	}
+
+	m, _ = resolveTestFrom(rt, "edge.cz-only-ds.mycdn.example.net.", dns.TypeA, "203.0.113.1")
+	if len(m.Answer) != 0 {
+		t.Errorf("expected coverage zone only delivery service to not be federated, actual %v", answerValues(m))
+	}
+
+	m, _ = resolveTestFrom(rt, "edge.dns-ds.mycdn.example.net.", dns.TypeA, "198.51.100.200")
+	if vals := answerValues(m); len(vals) != 2 {
+		t.Errorf("expected resolver without a federation to get caches, actual %v", vals)
+	}
+}
@@ -0,0 +1,326 @@
+package dnszones
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+
+	"github.com/miekg/dns"
+)
+
+// Default TTLs and SOA values, used when the CRConfig doesn't have them. These match the Traffic Ops Parameter defaults.
+const (
+	DefaultAddressTTL = 30
+	DefaultNSTTL      = 3600
+	DefaultSOATTL     = 86400
+
+	DefaultSOAAdmin   = "traffic_ops"
+	DefaultSOARefresh = 28800
+	DefaultSOARetry   = 7200
+	DefaultSOAExpire  = 604800
+	DefaultSOAMinimum = 30
+)
+
+// DNSProtocol is the CRConfig match set protocol of DNS Delivery Services.
+const DNSProtocol = "DNS"
+
+// Zones is the DNS data of a CDN, created from its CRConfig, used to answer DNS queries. All names are lowercase and fully qualified.
+type Zones struct {
+	// Zones is the CDN domain zone and the zones of each Delivery Service, by name.
+	Zones map[string]Zone
+	// Records are the records of names with fixed records, which are the static DNS entries and Traffic Router addresses, by name.
+	Records map[string][]dns.RR
+	// DeliveryServices are the DNS data of each Delivery Service.
+	DeliveryServices map[tc.DeliveryServiceName]DeliveryService
+	// Caches are the addresses of each cache.
+	Caches map[tc.CacheName]Addrs
+	// Routers are the addresses of the online Traffic Routers, which HTTP Delivery Service names resolve to.
+	Routers []Addrs
+}
+
+// Zone is a zone the CDN is authoritative for.
+type Zone struct {
+	Name string
+	SOA  *dns.SOA
+	NS   []dns.RR
+}
+
+// DeliveryService is the DNS data of a Delivery Service.
+type DeliveryService struct {
+	// DNS is whether the Delivery Service is DNS routed. Names of HTTP routed Delivery Services resolve to Traffic Routers.
+	DNS bool
+	// IP6 is whether the Delivery Service is routed over IPv6, and answers AAAA queries.
+	IP6 bool
+	// MaxIPs is the maximum number of cache addresses in a DNS answer, or 0 for all available caches.
+	MaxIPs  int
+	ATTL    uint32
+	AAAATTL uint32
+}
+
+// Addrs are the IPv4 and IPv6 addresses of a server, either of which may be nil.
+type Addrs struct {
+	IP  net.IP
+	IP6 net.IP
+}
+
+// Zone returns the zone the given name is in, which is the zone with the longest name the name is in, or false if the CDN isn't authoritative for the name.
+func (z *Zones) Zone(name string) (Zone, bool) {
+	name = dns.Fqdn(strings.ToLower(name))
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if zone, ok := z.Zones[name[off:]]; ok {
+			return zone, true
+		}
+	}
+	return Zone{}, false
+}
+
+// Create creates the DNS zones of the given CRConfig.
+func Create(crc *tc.CRConfig) (*Zones, error) {
+	if crc == nil {
+		return nil, errors.New("CRConfig is nil")
+	}
+	domainI, ok := crc.Config["domain_name"]
+	if !ok {
+		return nil, errors.New("CRConfig missing config domain_name")
+	}
+	domain, ok := domainI.(string)
+	if !ok || domain == "" {
+		return nil, errors.New("CRConfig config domain_name is not a string")
+	}
+	domain = dns.Fqdn(strings.ToLower(domain))
+
+	cdnSOA := &tc.SOA{}
+	if err := getConfigObj(crc, "soa", cdnSOA); err != nil {
+		return nil, errors.New("CRConfig config soa: " + err.Error())
+	}
+	cdnTTLs := &tc.CRConfigTTL{}
+	if err := getConfigObj(crc, "ttls", cdnTTLs); err != nil {
+		return nil, errors.New("CRConfig config ttls: " + err.Error())
+	}
+
+	zones := &Zones{
+		Zones:            map[string]Zone{},
+		Records:          map[string][]dns.RR{},
+		DeliveryServices: map[tc.DeliveryServiceName]DeliveryService{},
+		Caches:           map[tc.CacheName]Addrs{},
+	}
+
+	nsTTL := ttl(DefaultNSTTL, cdnTTLs.NSSeconds)
+	nsNames := []string{}
+	for _, router := range crc.ContentRouters {
+		if router.FQDN == nil || router.ServerStatus == nil {
+			continue
+		}
+		if status := tc.CacheStatus(*router.ServerStatus); status != tc.CacheStatusOnline && status != tc.CacheStatusReported {
+			continue
+		}
+		addrs := Addrs{IP: parseIP(router.IP), IP6: parseIP(router.IP6)}
+		nsName := dns.Fqdn(strings.ToLower(*router.FQDN))
+		nsNames = append(nsNames, nsName)
+		zones.Routers = append(zones.Routers, addrs)
+		zones.Records[nsName] = append(zones.Records[nsName], AddrRRs(nsName, addrs, true, nsTTL)...)
+	}
+	if len(nsNames) == 0 {
+		return nil, errors.New("CRConfig has no online Traffic Routers")
+	}
+	sort.Strings(nsNames)
+
+	serial := uint32(0)
+	if crc.Stats.DateUnixSeconds != nil {
+		serial = uint32(*crc.Stats.DateUnixSeconds)
+	}
+	zones.Zones[domain] = createZone(domain, nsNames, nsTTL, ttl(DefaultSOATTL, cdnTTLs.SOASeconds), cdnSOA, cdnSOA, serial)
+
+	for dsNameStr, ds := range crc.DeliveryServices {
+		dsName := tc.DeliveryServiceName(dsNameStr)
+		dsDNS := DeliveryService{
+			DNS:     len(ds.MatchSets) > 0 && ds.MatchSets[0] != nil && ds.MatchSets[0].Protocol == DNSProtocol,
+			IP6:     ds.IP6RoutingEnabled != nil && *ds.IP6RoutingEnabled,
+			ATTL:    ttl(DefaultAddressTTL, cdnTTLs.ASeconds, intStrPtr(ds.TTL), dsTTL(ds.TTLs, func(t *tc.CRConfigTTL) *string { return t.ASeconds })),
+			AAAATTL: ttl(DefaultAddressTTL, cdnTTLs.AAAASeconds, intStrPtr(ds.TTL), dsTTL(ds.TTLs, func(t *tc.CRConfigTTL) *string { return t.AAAASeconds })),
+		}
+		if ds.MaxDNSIPsForLocation != nil && *ds.MaxDNSIPsForLocation > 0 {
+			dsDNS.MaxIPs = *ds.MaxDNSIPsForLocation
+		}
+		zones.DeliveryServices[dsName] = dsDNS
+
+		if len(ds.Domains) == 0 {
+			continue
+		}
+		dsDomain := dns.Fqdn(strings.ToLower(ds.Domains[0]))
+		if !dns.IsSubDomain(domain, dsDomain) {
+			return nil, errors.New("CRConfig delivery service '" + dsNameStr + "' domain '" + dsDomain + "' is not in the CDN domain '" + domain + "'")
+		}
+		if dsDomain != domain {
+			dsSOA := cdnSOA
+			if ds.Soa != nil {
+				dsSOA = ds.Soa
+			}
+			dsNSTTL := ttl(nsTTL, dsTTL(ds.TTLs, func(t *tc.CRConfigTTL) *string { return t.NSSeconds }))
+			dsSOATTL := ttl(DefaultSOATTL, cdnTTLs.SOASeconds, dsTTL(ds.TTLs, func(t *tc.CRConfigTTL) *string { return t.SOASeconds }))
+			zones.Zones[dsDomain] = createZone(dsDomain, nsNames, dsNSTTL, dsSOATTL, dsSOA, cdnSOA, serial)
+		}
+
+		for _, entry := range ds.StaticDNSEntries {
+			rr, err := staticEntryRR(entry, dsDomain)
+			if err != nil {
+				return nil, errors.New("CRConfig delivery service '" + dsNameStr + "' static DNS entry '" + entry.Name + "': " + err.Error())
+			}
+			name := rr.Header().Name
+			zones.Records[name] = append(zones.Records[name], rr)
+		}
+	}
+
+	for cacheNameStr, cache := range crc.ContentServers {
+		zones.Caches[tc.CacheName(cacheNameStr)] = Addrs{IP: parseIP(cache.Ip), IP6: parseIP(cache.Ip6)}
+	}
+	return zones, nil
+}
+
+// AddrRRs returns the A record, and the AAAA record if ip6 is true, of the given addresses, for those which aren't nil.
+func AddrRRs(name string, addrs Addrs, ip6 bool, ttl uint32) []dns.RR {
+	rrs := []dns.RR{}
+	if addrs.IP != nil {
+		rrs = append(rrs, &dns.A{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl}, A: addrs.IP})
+	}
+	if ip6 && addrs.IP6 != nil {
+		rrs = append(rrs, &dns.AAAA{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: ttl}, AAAA: addrs.IP6})
+	}
+	return rrs
+}
+
+// createZone creates the zone with the given name, served by the given name servers. Values missing from the soa are taken from the defaultSOA, which may be the same.
+func createZone(name string, nsNames []string, nsTTL uint32, soaTTL uint32, soa *tc.SOA, defaultSOA *tc.SOA, serial uint32) Zone {
+	admin := DefaultSOAAdmin
+	if soa.Admin != nil && *soa.Admin != "" {
+		admin = *soa.Admin
+	} else if defaultSOA.Admin != nil && *defaultSOA.Admin != "" {
+		admin = *defaultSOA.Admin
+	}
+	// like Traffic Router, an admin without a domain is in the zone's domain.
+	if !strings.Contains(strings.TrimSuffix(admin, "."), ".") {
+		admin = admin + "." + name
+	}
+
+	zone := Zone{Name: name}
+	zone.SOA = &dns.SOA{
+		Hdr:     dns.RR_Header{Name: name, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: soaTTL},
+		Ns:      nsNames[0],
+		Mbox:    dns.Fqdn(strings.ToLower(admin)),
+		Serial:  serial,
+		Refresh: ttl(DefaultSOARefresh, defaultSOA.RefreshSeconds, soa.RefreshSeconds),
+		Retry:   ttl(DefaultSOARetry, defaultSOA.RetrySeconds, soa.RetrySeconds),
+		Expire:  ttl(DefaultSOAExpire, defaultSOA.ExpireSeconds, soa.ExpireSeconds),
+		Minttl:  ttl(DefaultSOAMinimum, defaultSOA.MinimumSeconds, soa.MinimumSeconds),
+	}
+	for _, nsName := range nsNames {
+		zone.NS = append(zone.NS, &dns.NS{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: nsTTL}, Ns: nsName})
+	}
+	return zone
+}
+
+// staticEntryRR returns the record of the given static DNS entry, whose name is relative to the Delivery Service domain.
+func staticEntryRR(entry tc.CRConfigStaticDNSEntry, dsDomain string) (dns.RR, error) {
+	hdr := dns.RR_Header{Name: dns.Fqdn(strings.ToLower(entry.Name + "." + dsDomain)), Class: dns.ClassINET, Ttl: uint32(entry.TTL)}
+	switch strings.ToUpper(entry.Type) {
+	case "A", "A_RECORD":
+		ip := net.ParseIP(entry.Value).To4()
+		if ip == nil {
+			return nil, errors.New("invalid IPv4 address '" + entry.Value + "'")
+		}
+		hdr.Rrtype = dns.TypeA
+		return &dns.A{Hdr: hdr, A: ip}, nil
+	case "AAAA", "AAAA_RECORD":
+		ip := net.ParseIP(entry.Value)
+		if ip == nil || ip.To4() != nil {
+			return nil, errors.New("invalid IPv6 address '" + entry.Value + "'")
+		}
+		hdr.Rrtype = dns.TypeAAAA
+		return &dns.AAAA{Hdr: hdr, AAAA: ip}, nil
+	case "CNAME", "CNAME_RECORD":
+		hdr.Rrtype = dns.TypeCNAME
+		return &dns.CNAME{Hdr: hdr, Target: dns.Fqdn(entry.Value)}, nil
+	case "TXT", "TXT_RECORD":
+		hdr.Rrtype = dns.TypeTXT
+		return &dns.TXT{Hdr: hdr, Txt: []string{entry.Value}}, nil
+	}
+	return nil, errors.New("unsupported type '" + entry.Type + "'")
+}
+
+// getConfigObj deserializes the CRConfig config value with the given key into obj, if it exists. The CRConfig config is untyped, so this serializes and deserializes it.
+func getConfigObj(crc *tc.CRConfig, key string, obj interface{}) error {
+	val, ok := crc.Config[key]
+	if !ok {
+		return nil
+	}
+	bts, err := json.Marshal(val)
+	if err != nil {
+		return errors.New("serializing: " + err.Error())
+	}
+	if err := json.Unmarshal(bts, obj); err != nil {
+		return errors.New("deserializing: " + err.Error())
+	}
+	return nil
+}
+
+// ttl returns the last of the given values which is a number of seconds, or the default if none are.
+func ttl(def uint32, vals ...*string) uint32 {
+	for i := len(vals) - 1; i >= 0; i-- {
+		if vals[i] == nil {
+			continue
+		}
+		if v, err := strconv.ParseUint(*vals[i], 10, 32); err == nil {
+			return uint32(v)
+		}
+	}
+	return def
+}
+
+// dsTTL returns the TTL of the given Delivery Service TTLs, or nil if the Delivery Service has no TTLs.
+func dsTTL(ttls *tc.CRConfigTTL, get func(*tc.CRConfigTTL) *string) *string {
+	if ttls == nil {
+		return nil
+	}
+	return get(ttls)
+}
+
+func intStrPtr(i *int) *string {
+	if i == nil {
+		return nil
+	}
+	s := strconv.Itoa(*i)
+	return &s
+}
+
+// parseIP parses the given CRConfig IP, which may have a CIDR suffix, returning nil if it's nil or invalid.
+func parseIP(ipStr *string) net.IP {
+	if ipStr == nil {
+		return nil
+	}
+	return net.ParseIP(strings.SplitN(*ipStr, "/", 2)[0])
+}
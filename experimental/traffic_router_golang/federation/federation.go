@@ -0,0 +1,161 @@
+package federation
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/coveragezone"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// Mapping is the federation answer for the resolvers of a federation mapping.
+type Mapping struct {
+	CName string
+	TTL   int
+}
+
+// Federations are the federation mappings of resolver networks, by Delivery Service, from the Traffic Ops federations data.
+type Federations struct {
+	dses map[tc.DeliveryServiceName]*resolvers
+}
+
+// resolvers are the federation mappings of a Delivery Service's IPv4 and IPv6 resolver networks.
+type resolvers struct {
+	v4 cidrIndex
+	v6 cidrIndex
+}
+
+// cidrIndex indexes mappings by the prefix length and network address of their resolver networks.
+type cidrIndex struct {
+	prefixLens []int // descending, so the first match is the longest prefix
+	nets       map[int]map[string]Mapping
+}
+
+// Create creates the Federations of the given Traffic Ops federations data.
+// Resolvers may be networks in CIDR notation or single addresses. If a network is in multiple mappings of a Delivery Service, the first is used.
+func Create(feds []tc.AllDeliveryServiceFederationsMapping) (*Federations, error) {
+	f := &Federations{dses: map[tc.DeliveryServiceName]*resolvers{}}
+	for _, fed := range feds {
+		rs, ok := f.dses[fed.DeliveryService]
+		if !ok {
+			rs = &resolvers{}
+			f.dses[fed.DeliveryService] = rs
+		}
+		for _, tcMapping := range fed.Mappings {
+			if tcMapping.CName == nil || tcMapping.TTL == nil {
+				return nil, errors.New("delivery service '" + string(fed.DeliveryService) + "' federation mapping missing cname or ttl")
+			}
+			mapping := Mapping{CName: *tcMapping.CName, TTL: *tcMapping.TTL}
+			for _, resolver := range append(append([]string{}, tcMapping.Resolve4...), tcMapping.Resolve6...) {
+				network, err := parseResolver(resolver)
+				if err != nil {
+					return nil, errors.New("delivery service '" + string(fed.DeliveryService) + "' federation resolver '" + resolver + "': " + err.Error())
+				}
+				if network.IP.To4() != nil {
+					rs.v4.add(network, mapping)
+				} else {
+					rs.v6.add(network, mapping)
+				}
+			}
+		}
+	}
+	return f, nil
+}
+
+// parseResolver parses the given resolver network in CIDR notation, or address, which is a network of only itself.
+func parseResolver(resolver string) (*net.IPNet, error) {
+	resolver = strings.TrimSpace(resolver)
+	if strings.Contains(resolver, "/") {
+		_, network, err := net.ParseCIDR(resolver)
+		return network, err
+	}
+	ip := net.ParseIP(resolver)
+	if ip == nil {
+		return nil, errors.New("invalid IP address")
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+func (c *cidrIndex) add(network *net.IPNet, mapping Mapping) {
+	prefixLen, _ := network.Mask.Size()
+	if c.nets == nil {
+		c.nets = map[int]map[string]Mapping{}
+	}
+	nets, ok := c.nets[prefixLen]
+	if !ok {
+		nets = map[string]Mapping{}
+		c.nets[prefixLen] = nets
+		c.prefixLens = append(c.prefixLens, prefixLen)
+		sort.Sort(sort.Reverse(sort.IntSlice(c.prefixLens)))
+	}
+	if _, ok := nets[network.IP.String()]; !ok {
+		nets[network.IP.String()] = mapping
+	}
+}
+
+// get returns the mapping of the longest prefix network containing the given IP, which must be the length of the indexed networks' addresses.
+func (c *cidrIndex) get(ip net.IP) (Mapping, bool) {
+	for _, prefixLen := range c.prefixLens {
+		if mapping, ok := c.nets[prefixLen][ip.Mask(net.CIDRMask(prefixLen, len(ip)*8)).String()]; ok {
+			return mapping, true
+		}
+	}
+	return Mapping{}, false
+}
+
+// Get returns the mapping of the longest prefix resolver network of the Delivery Service containing the given IP, and false if none do.
+// A nil Federations has no mappings.
+func (f *Federations) Get(ds tc.DeliveryServiceName, ip net.IP) (Mapping, bool) {
+	if f == nil {
+		return Mapping{}, false
+	}
+	rs, ok := f.dses[ds]
+	if !ok {
+		return Mapping{}, false
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return rs.v4.get(ip4)
+	}
+	if ip16 := ip.To16(); ip16 != nil {
+		return rs.v6.get(ip16)
+	}
+	return Mapping{}, false
+}
+
+// Find returns the federation mapping to answer the client at the given IP with, for the given Delivery Service, and false if it isn't federated.
+// Like Traffic Router, clients in the coverage zone, and clients of coverageZoneOnly Delivery Services, are never federated. The ds may be nil.
+func Find(ip net.IP, dsName tc.DeliveryServiceName, ds *tc.CRConfigDeliveryService, cz coveragezone.CoverageZone, feds *Federations) (Mapping, bool) {
+	if _, ok := cz.Get(ip); ok {
+		return Mapping{}, false
+	}
+	if ds != nil && ds.CoverageZoneOnly {
+		return Mapping{}, false
+	}
+	return feds.Get(dsName, ip)
+}
@@ -0,0 +1,131 @@
+package federation
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/coveragezone"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+const testFederations = `[
+	{
+		"deliveryService": "fed-ds",
+		"mappings": [
+			{"cname": "wide.fed.example.net.", "ttl": 60, "resolve4": ["192.0.0.0/8"], "resolve6": ["2001:db8::/32"]},
+			{"cname": "narrow.fed.example.net.", "ttl": 30, "resolve4": ["192.0.2.0/24"], "resolve6": ["2001:db8:1::/48"]},
+			{"cname": "host.fed.example.net.", "ttl": 10, "resolve4": ["192.0.2.1"], "resolve6": ["2001:db8:1::1"]},
+			{"cname": "duplicate.fed.example.net.", "ttl": 5, "resolve4": ["192.0.2.0/24"]}
+		]
+	},
+	{
+		"deliveryService": "other-ds",
+		"mappings": [
+			{"cname": "other.fed.example.net.", "ttl": 60, "resolve4": ["198.51.100.0/24"]}
+		]
+	}
+]`
+
+func testFeds(t *testing.T) *Federations {
+	tcFeds := []tc.AllDeliveryServiceFederationsMapping{}
+	if err := json.Unmarshal([]byte(testFederations), &tcFeds); err != nil {
+		t.Fatalf("unmarshalling test federations: %v", err)
+	}
+	feds, err := Create(tcFeds)
+	if err != nil {
+		t.Fatalf("creating federations: %v", err)
+	}
+	return feds
+}
+
+func TestGet(t *testing.T) {
+	feds := testFeds(t)
+
+	tests := []struct {
+		ds            tc.DeliveryServiceName
+		ip            string
+		expectedCName string
+		expectedTTL   int
+	}{
+		{"fed-ds", "192.0.2.1", "host.fed.example.net.", 10},
+		{"fed-ds", "192.0.2.2", "narrow.fed.example.net.", 30},
+		{"fed-ds", "192.0.3.1", "wide.fed.example.net.", 60},
+		{"fed-ds", "::ffff:192.0.2.2", "narrow.fed.example.net.", 30},
+		{"fed-ds", "2001:db8:1::1", "host.fed.example.net.", 10},
+		{"fed-ds", "2001:db8:1::2", "narrow.fed.example.net.", 30},
+		{"fed-ds", "2001:db8:2::1", "wide.fed.example.net.", 60},
+		{"fed-ds", "10.0.0.1", "", 0},
+		{"fed-ds", "2001:db9::1", "", 0},
+		{"fed-ds", "198.51.100.1", "", 0},
+		{"other-ds", "198.51.100.1", "other.fed.example.net.", 60},
+		{"other-ds", "192.0.2.1", "", 0},
+		{"not-fed-ds", "192.0.2.1", "", 0},
+	}
+	for _, test := range tests {
+		mapping, ok := feds.Get(test.ds, net.ParseIP(test.ip))
+		if ok != (test.expectedCName != "") || mapping.CName != test.expectedCName || mapping.TTL != test.expectedTTL {
+			t.Errorf("expected ds '%v' ip %v to get '%v' %v, actual %+v %v", test.ds, test.ip, test.expectedCName, test.expectedTTL, mapping, ok)
+		}
+	}
+
+	if _, ok := (*Federations)(nil).Get("fed-ds", net.ParseIP("192.0.2.1")); ok {
+		t.Error("expected nil federations to have no mappings")
+	}
+}
+
+func TestCreateInvalid(t *testing.T) {
+	cname := "fed.example.net."
+	ttl := 60
+	invalid := []tc.AllDeliveryServiceFederationsMapping{{DeliveryService: "ds", Mappings: []tc.FederationResolverMapping{
+		{CName: &cname, TTL: &ttl, ResolverMapping: tc.ResolverMapping{Resolve4: []string{"192.0.2.0/33"}}},
+	}}}
+	if _, err := Create(invalid); err == nil {
+		t.Error("expected invalid resolver network to error")
+	}
+	invalid[0].Mappings[0] = tc.FederationResolverMapping{CName: &cname, ResolverMapping: tc.ResolverMapping{Resolve4: []string{"192.0.2.0/24"}}}
+	if _, err := Create(invalid); err == nil {
+		t.Error("expected mapping without a ttl to error")
+	}
+}
+
+func TestFind(t *testing.T) {
+	feds := testFeds(t)
+	cz, err := coveragezone.New(coveragezone.JSONCoverageZones{CoverageZones: map[tc.CacheGroupName]coveragezone.JSONCoverageZoneCacheGroup{
+		"cg-east": {Coordinates: tc.CRConfigLatitudeLongitude{Lat: 40, Lon: -75}, Network: []string{"192.0.2.128/25"}},
+	}})
+	if err != nil {
+		t.Fatalf("creating coverage zone: %v", err)
+	}
+
+	if mapping, ok := Find(net.ParseIP("192.0.2.1"), "fed-ds", nil, cz, feds); !ok || mapping.CName != "host.fed.example.net." {
+		t.Errorf("expected client outside the coverage zone to be federated, actual %+v %v", mapping, ok)
+	}
+	if mapping, ok := Find(net.ParseIP("192.0.2.129"), "fed-ds", nil, cz, feds); ok {
+		t.Errorf("expected client in the coverage zone to not be federated, actual %+v", mapping)
+	}
+	if mapping, ok := Find(net.ParseIP("192.0.2.1"), "fed-ds", &tc.CRConfigDeliveryService{CoverageZoneOnly: true}, cz, feds); ok {
+		t.Errorf("expected coverageZoneOnly delivery service to not be federated, actual %+v", mapping)
+	}
+}
@@ -0,0 +1,85 @@
+package federationpoller
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/federation"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/fetch"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/toutil"
+)
+
+// DefaultInterval is the interval to poll the federations data, if the given interval is 0.
+const DefaultInterval = time.Minute
+
+// Start polls the federations data with the given fetcher every interval, and returns the threadsafe Federations, which are nil until the data is first fetched.
+// The fetched data must be a Traffic Ops federations/all API response.
+func Start(fetcher fetch.Fetcher, interval time.Duration) federation.Ths {
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	thsFeds := federation.NewThs()
+	prevBts := []byte{}
+
+	get := func() {
+		newBts, err := fetcher.Fetch()
+		if err != nil {
+			fmt.Println("ERROR federations read error: " + err.Error())
+			return
+		}
+
+		if bytes.Equal(newBts, prevBts) {
+			fmt.Println("INFO federations unchanged.")
+			return
+		}
+
+		fmt.Println("INFO federations changed.")
+		resp := toutil.FederationsResponse{}
+		if err := json.Unmarshal(newBts, &resp); err != nil {
+			fmt.Println("ERROR federations unmarshalling: " + err.Error())
+			return
+		}
+
+		feds, err := federation.Create(resp.Response)
+		if err != nil {
+			fmt.Println("ERROR not using invalid new federations: " + err.Error())
+			return
+		}
+
+		thsFeds.Set(feds)
+		prevBts = newBts
+		fmt.Println("INFO federations set new")
+	}
+
+	get()
+
+	go func() {
+		for {
+			time.Sleep(interval)
+			get()
+		}
+	}()
+	return thsFeds
+}
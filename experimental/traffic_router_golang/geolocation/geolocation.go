@@ -0,0 +1,156 @@
+package geolocation
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/coveragezone"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Location is the geolocation of an IP.
+type Location struct {
+	Pos         tc.CRConfigLatitudeLongitude
+	CountryCode string
+}
+
+// Geolocator is the interface that wraps the Get method.
+//
+// Get returns the location of the given IP, and false if it isn't found.
+type Geolocator interface {
+	Get(ip net.IP) (Location, bool)
+}
+
+// DB is a MaxMind GeoIP2 or GeoLite2 City database. It is safe for concurrent use.
+type DB struct {
+	reader *maxminddb.Reader
+}
+
+// record is the part of a GeoIP2 City database record used to route clients.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+// gzipMagic is the header of gzipped data. Traffic Ops usually serves the database gzipped.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// New creates a DB from the bytes of a MaxMind database file, which may be gzipped.
+func New(bts []byte) (*DB, error) {
+	if bytes.HasPrefix(bts, gzipMagic) {
+		gz, err := gzip.NewReader(bytes.NewReader(bts))
+		if err != nil {
+			return nil, errors.New("creating gzip reader: " + err.Error())
+		}
+		bts, err = ioutil.ReadAll(gz)
+		if err != nil {
+			return nil, errors.New("decompressing: " + err.Error())
+		}
+	}
+	reader, err := maxminddb.FromBytes(bts)
+	if err != nil {
+		return nil, errors.New("reading MaxMind database: " + err.Error())
+	}
+	return &DB{reader: reader}, nil
+}
+
+// Get returns the location of the given IP in the database, and false if it isn't found or has no coordinates. A nil DB finds nothing.
+func (db *DB) Get(ip net.IP) (Location, bool) {
+	if db == nil || ip == nil {
+		return Location{}, false
+	}
+	rec := record{}
+	if err := db.reader.Lookup(ip, &rec); err != nil {
+		fmt.Println("ERROR geolocation lookup of " + ip.String() + ": " + err.Error())
+		return Location{}, false
+	}
+	if rec.Location.Latitude == nil || rec.Location.Longitude == nil {
+		return Location{}, false
+	}
+	return Location{
+		Pos:         tc.CRConfigLatitudeLongitude{Lat: *rec.Location.Latitude, Lon: *rec.Location.Longitude},
+		CountryCode: rec.Country.ISOCode,
+	}, true
+}
+
+// Locate returns the position to route a client with the given IP to the given Delivery Service from, and false if the Delivery Service's geo-limit blocks the client.
+//
+// Like Traffic Router, clients in the coverage zone are never blocked. Other clients are blocked if the Delivery Service is coverageZoneOnly,
+// or if it has geoEnabled countries and the geolocated client isn't in one of them. Clients which aren't geolocated are routed from the
+// Delivery Service's missLocation, or else the given default.
+//
+// The ds may be nil, in which case the client is never blocked. The geo may be nil, in which case clients are never geolocated.
+func Locate(ip net.IP, ds *tc.CRConfigDeliveryService, cz coveragezone.CoverageZone, geo Geolocator, defaultPos tc.CRConfigLatitudeLongitude) (tc.CRConfigLatitudeLongitude, bool) {
+	if pos, ok := cz.Get(ip); ok {
+		return pos, true
+	}
+	if ds != nil && ds.CoverageZoneOnly {
+		return tc.CRConfigLatitudeLongitude{}, false
+	}
+	if geo != nil {
+		if loc, ok := geo.Get(ip); ok {
+			if ds != nil && !countryAllowed(ds.GeoEnabled, loc.CountryCode) {
+				return tc.CRConfigLatitudeLongitude{}, false
+			}
+			return loc.Pos, true
+		}
+	}
+	if ds != nil && ds.MissLocation != nil {
+		return tc.CRConfigLatitudeLongitude{Lat: ds.MissLocation.Lat, Lon: ds.MissLocation.Lon}, true
+	}
+	return defaultPos, true
+}
+
+// countryAllowed returns whether the given country code is one of the geoEnabled countries, or there are none.
+func countryAllowed(geoEnabled []tc.CRConfigGeoEnabled, countryCode string) bool {
+	if len(geoEnabled) == 0 {
+		return true
+	}
+	for _, enabled := range geoEnabled {
+		if strings.EqualFold(enabled.CountryCode, countryCode) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedirectURL returns the URL to redirect HTTP clients blocked by the Delivery Service's geo-limit to, and false if it has none.
+func RedirectURL(ds *tc.CRConfigDeliveryService) (string, bool) {
+	if ds == nil || ds.GeoLimitRedirectURL == nil || *ds.GeoLimitRedirectURL == "" {
+		return "", false
+	}
+	return *ds.GeoLimitRedirectURL, true
+}
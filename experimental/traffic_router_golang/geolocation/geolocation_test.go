@@ -0,0 +1,147 @@
+package geolocation
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/coveragezone"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// testGeolocator is a Geolocator of IP strings.
+type testGeolocator map[string]Location
+
+func (g testGeolocator) Get(ip net.IP) (Location, bool) {
+	loc, ok := g[ip.String()]
+	return loc, ok
+}
+
+func TestLocate(t *testing.T) {
+	cz, err := coveragezone.New(coveragezone.JSONCoverageZones{CoverageZones: map[tc.CacheGroupName]coveragezone.JSONCoverageZoneCacheGroup{
+		"cg-east": {Coordinates: tc.CRConfigLatitudeLongitude{Lat: 40, Lon: -75}, Network: []string{"10.0.0.0/8"}},
+	}})
+	if err != nil {
+		t.Fatalf("creating coverage zone: %v", err)
+	}
+	geo := testGeolocator{
+		"192.0.2.1": {Pos: tc.CRConfigLatitudeLongitude{Lat: 51, Lon: 0}, CountryCode: "GB"},
+		"192.0.2.2": {Pos: tc.CRConfigLatitudeLongitude{Lat: 37, Lon: -122}, CountryCode: "US"},
+	}
+	defaultPos := tc.CRConfigLatitudeLongitude{Lat: 1, Lon: 2}
+	redirectURL := "http://example.net/blocked.html"
+
+	unlimited := &tc.CRConfigDeliveryService{MissLocation: &tc.CRConfigLatitudeLongitudeShort{Lat: 3, Lon: 4}}
+	czOnly := &tc.CRConfigDeliveryService{CoverageZoneOnly: true}
+	usOnly := &tc.CRConfigDeliveryService{GeoEnabled: []tc.CRConfigGeoEnabled{{CountryCode: "us"}}, GeoLimitRedirectURL: &redirectURL}
+
+	tests := []struct {
+		ip          string
+		ds          *tc.CRConfigDeliveryService
+		geo         Geolocator
+		expectedPos tc.CRConfigLatitudeLongitude
+		expectedOK  bool
+	}{
+		{"10.1.2.3", czOnly, geo, tc.CRConfigLatitudeLongitude{Lat: 40, Lon: -75}, true},
+		{"192.0.2.1", czOnly, geo, tc.CRConfigLatitudeLongitude{}, false},
+		{"192.0.2.1", unlimited, geo, tc.CRConfigLatitudeLongitude{Lat: 51, Lon: 0}, true},
+		{"192.0.2.1", usOnly, geo, tc.CRConfigLatitudeLongitude{}, false},
+		{"192.0.2.2", usOnly, geo, tc.CRConfigLatitudeLongitude{Lat: 37, Lon: -122}, true},
+		{"10.1.2.3", usOnly, geo, tc.CRConfigLatitudeLongitude{Lat: 40, Lon: -75}, true},
+		{"192.0.2.3", usOnly, geo, defaultPos, true},
+		{"192.0.2.3", unlimited, geo, tc.CRConfigLatitudeLongitude{Lat: 3, Lon: 4}, true},
+		{"192.0.2.1", unlimited, nil, tc.CRConfigLatitudeLongitude{Lat: 3, Lon: 4}, true},
+		{"192.0.2.1", nil, geo, tc.CRConfigLatitudeLongitude{Lat: 51, Lon: 0}, true},
+		{"192.0.2.1", unlimited, (*DB)(nil), tc.CRConfigLatitudeLongitude{Lat: 3, Lon: 4}, true},
+	}
+	for _, test := range tests {
+		pos, ok := Locate(net.ParseIP(test.ip), test.ds, cz, test.geo, defaultPos)
+		if ok != test.expectedOK || pos.Lat != test.expectedPos.Lat || pos.Lon != test.expectedPos.Lon {
+			t.Errorf("expected %v ds %+v to locate %v %v, actual %v %v", test.ip, test.ds, test.expectedPos, test.expectedOK, pos, ok)
+		}
+	}
+
+	if url, ok := RedirectURL(usOnly); !ok || url != redirectURL {
+		t.Errorf("expected redirect URL '%v', actual '%v' %v", redirectURL, url, ok)
+	}
+	if url, ok := RedirectURL(czOnly); ok {
+		t.Errorf("expected no redirect URL, actual '%v'", url)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	if _, err := New([]byte("not a database")); err == nil {
+		t.Error("expected invalid database to error")
+	}
+
+	buf := bytes.Buffer{}
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte("not a database"))
+	gz.Close()
+	if _, err := New(buf.Bytes()); err == nil {
+		t.Error("expected invalid gzipped database to error")
+	}
+}
+
+// testDBPath is a GeoIP2 City database of documentation networks: 192.0.2.0/24 in GB at 51.5142,-0.0931,
+// 198.51.100.0/24 in US with no location, and 2001:db8:1::/48 in US at 37.751,-97.822. See testdata/README.md.
+const testDBPath = "testdata/city-test.mmdb"
+
+func TestDBGet(t *testing.T) {
+	bts, err := ioutil.ReadFile(testDBPath)
+	if err != nil {
+		t.Fatalf("reading test database: %v", err)
+	}
+	gzipped := bytes.Buffer{}
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write(bts)
+	gz.Close()
+
+	for name, dbBytes := range map[string][]byte{"plain": bts, "gzipped": gzipped.Bytes()} {
+		db, err := New(dbBytes)
+		if err != nil {
+			t.Fatalf("creating %v database: %v", name, err)
+		}
+
+		tests := []struct {
+			ip         string
+			expected   Location
+			expectedOK bool
+		}{
+			{"192.0.2.1", Location{Pos: tc.CRConfigLatitudeLongitude{Lat: 51.5142, Lon: -0.0931}, CountryCode: "GB"}, true},
+			{"2001:db8:1::1", Location{Pos: tc.CRConfigLatitudeLongitude{Lat: 37.751, Lon: -97.822}, CountryCode: "US"}, true},
+			{"198.51.100.1", Location{}, false},
+			{"203.0.113.1", Location{}, false},
+			{"2001:db8:2::1", Location{}, false},
+		}
+		for _, test := range tests {
+			loc, ok := db.Get(net.ParseIP(test.ip))
+			if ok != test.expectedOK || loc.CountryCode != test.expected.CountryCode || loc.Pos.Lat != test.expected.Pos.Lat || loc.Pos.Lon != test.expected.Pos.Lon {
+				t.Errorf("%v database: expected %v to be %+v %v, actual %+v %v", name, test.ip, test.expected, test.expectedOK, loc, ok)
+			}
+		}
+	}
+}
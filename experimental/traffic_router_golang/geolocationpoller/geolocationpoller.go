@@ -0,0 +1,139 @@
+package geolocationpoller
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/crconfig"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/fetch"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/geolocation"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// DefaultInterval is the interval to poll the geolocation database, if neither the config nor the CRConfig has one. This is the same as Traffic Router's.
+const DefaultInterval = 24 * time.Hour
+
+// pollingURL returns the CRConfig's geolocation database URL, preferring 'alt.geolocation.polling.url' like Traffic Router, or the empty string if it has none.
+func pollingURL(crc *tc.CRConfig) string {
+	if crc == nil {
+		return ""
+	}
+	for _, key := range []string{"alt.geolocation.polling.url", "geolocation.polling.url"} {
+		if url, ok := crc.Config[key].(string); ok && url != "" {
+			return url
+		}
+	}
+	return ""
+}
+
+// pollingInterval returns the CRConfig's 'geolocation.polling.interval' in milliseconds, or the default if it has none.
+func pollingInterval(crc *tc.CRConfig) time.Duration {
+	if crc == nil {
+		return DefaultInterval
+	}
+	intervalStr := ""
+	switch interval := crc.Config["geolocation.polling.interval"].(type) {
+	case string:
+		intervalStr = interval
+	case float64:
+		intervalStr = strconv.FormatFloat(interval, 'f', -1, 64)
+	}
+	ms, err := strconv.ParseInt(intervalStr, 10, 64)
+	if err != nil || ms <= 0 {
+		return DefaultInterval
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// newFetcher returns a fetcher of the given database location, which is an HTTP URL, a file URL, or a local path.
+func newFetcher(location string, timeout time.Duration, userAgent string) fetch.Fetcher {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return fetch.NewHTTP(location, timeout, userAgent)
+	}
+	return fetch.NewFile(strings.TrimPrefix(location, "file://"))
+}
+
+// Start polls the geolocation database, and returns the threadsafe database, which is nil until one is loaded.
+// The database is read from the given file, if it isn't empty, or else from the CRConfig's geolocation polling URL.
+// It is polled every interval, or the CRConfig's geolocation polling interval if interval is 0, and reloaded when it changes.
+func Start(file string, crc crconfig.Ths, interval time.Duration, timeout time.Duration, userAgent string) geolocation.Ths {
+	thsGeo := geolocation.NewThs()
+	prevLocation := ""
+	prevBts := []byte{}
+	fetcher := fetch.Fetcher(nil)
+
+	get := func() {
+		location := file
+		if location == "" {
+			location = pollingURL(crc.Get())
+		}
+		if location == "" {
+			fmt.Println("INFO geolocation database has no file or CRConfig URL, not geolocating.")
+			return
+		}
+		if location != prevLocation {
+			fetcher = newFetcher(location, timeout, userAgent)
+		}
+
+		newBts, err := fetcher.Fetch()
+		if err != nil {
+			fmt.Println("ERROR geolocation database '" + location + "' read error: " + err.Error())
+			return
+		}
+
+		if bytes.Equal(newBts, prevBts) {
+			fmt.Println("INFO geolocation database unchanged.")
+			return
+		}
+
+		fmt.Println("INFO geolocation database '" + location + "' changed.")
+		db, err := geolocation.New(newBts)
+		if err != nil {
+			fmt.Println("ERROR not using invalid new geolocation database '" + location + "': " + err.Error())
+			return
+		}
+
+		thsGeo.Set(db)
+		prevLocation = location
+		prevBts = newBts
+		fmt.Println("INFO geolocation database set new")
+	}
+
+	get()
+
+	go func() {
+		for {
+			if interval != 0 {
+				time.Sleep(interval)
+			} else {
+				time.Sleep(pollingInterval(crc.Get()))
+			}
+			get()
+		}
+	}()
+	return thsGeo
+}
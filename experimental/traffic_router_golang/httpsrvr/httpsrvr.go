@@ -21,17 +21,28 @@ package httpsrvr
  */
 
 import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/availableservers"
 	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/cgsrch"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/consistenthash"
 	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/coveragezone"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/crconfig"
 	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/crconfigregex"
-	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/nextcache"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/deepcoveragezone"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/federation"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/geolocation"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/sslkeys"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/stats"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/steering"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
 	"github.com/apache/trafficcontrol/lib/go-tc"
@@ -44,129 +55,468 @@ var DefaultPos = tc.CRConfigLatitudeLongitude{Lat: 39.579244, Lon: -104.934282}
 // TODO config
 const UseXForwardedFor = true
 
-func getHandler(
-	regexes crconfigregex.Ths,
-	availSrvrs availableservers.AvailableServers,
-	cgSrchThs cgsrch.Ths,
-	nextCacherThs nextcache.Ths,
-	cz coveragezone.CoverageZone,
-) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// host := r.Header.Get("Host")
-
-		// TODO parse subdomains more efficiently
-		fqdnParts := strings.Split(r.Host, ".")
-		if len(fqdnParts) < 3 {
-			fmt.Println("EVENT request '" + r.Host + "' doesn't have enough parts (must be 'subsubdomain.subdomain.domain'), returning 404")
-			w.WriteHeader(http.StatusNotFound)
-			return
-		}
+// SteeringOptionHeader is the request header naming the target of a steering Delivery Service to route to, the same as Traffic Router's.
+const SteeringOptionHeader = "X-TC-Steering-Option"
 
-		subsubdomain := fqdnParts[0]
-		subdomain := fqdnParts[1]
-		domain := strings.Join(fqdnParts[2:len(fqdnParts)-1], ".")
+// RedirectQueryParam is the query parameter which, if 'false', makes client steering respond 200 with the locations, rather than redirecting to the first, the same as Traffic Router's.
+const RedirectQueryParam = "trred"
 
-		fmt.Println("DEBUG request '" + r.Host + "' split ssd '" + subsubdomain + "' sd '" + subdomain + "' d '" + domain + "'")
+// errGeoLimited is returned when the client is blocked by the Delivery Service's geo-limit.
+var errGeoLimited = errors.New("client geo-limited")
 
-		dsRegexes := (*crconfigregex.Regexes)(regexes.Get())
+// router routes HTTP requests to caches.
+type router struct {
+	crcThs              crconfig.Ths
+	regexes             crconfigregex.Ths
+	availSrvrs          availableservers.AvailableServers
+	cgSrchThs           cgsrch.Ths
+	consistentHasherThs consistenthash.Ths
+	cz                  coveragezone.CoverageZone
+	geoThs              geolocation.Ths
+	deepCZThs           deepcoveragezone.Ths
+	steeringThs         steering.Ths
+	fedThs              federation.Ths
+	certsThs            sslkeys.Ths
+	stats               *stats.Stats
+}
 
-		dsName, ok := dsRegexes.DeliveryService(domain, subdomain, subsubdomain)
-		if !ok {
-			fmt.Println("EVENT request '" + r.Host + "' has no match, returning 404")
-			w.WriteHeader(http.StatusNotFound)
-			return
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	result := rt.serve(w, r)
+	rt.stats.SaveHTTP(requestHost(r), result, time.Since(start))
+}
+
+// requestHost returns the host of the request, without the port.
+func requestHost(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.Host); err == nil {
+		return host
+	}
+	return r.Host
+}
+
+// serve routes the request, and returns the result.
+func (rt *router) serve(w http.ResponseWriter, r *http.Request) stats.ResultType {
+	// host := r.Header.Get("Host")
+
+	// TODO parse subdomains more efficiently
+	fqdnParts := strings.Split(r.Host, ".")
+	if len(fqdnParts) < 3 {
+		fmt.Println("EVENT request '" + r.Host + "' doesn't have enough parts (must be 'subsubdomain.subdomain.domain'), returning 404")
+		w.WriteHeader(http.StatusNotFound)
+		return stats.ResultDSMiss
+	}
+
+	subsubdomain := fqdnParts[0]
+	subdomain := fqdnParts[1]
+	domain := strings.Join(fqdnParts[2:len(fqdnParts)-1], ".")
+
+	fmt.Println("DEBUG request '" + r.Host + "' split ssd '" + subsubdomain + "' sd '" + subdomain + "' d '" + domain + "'")
+
+	dsRegexes := (*crconfigregex.Regexes)(rt.regexes.Get())
+
+	dsName, ok := dsRegexes.DeliveryService(domain, subdomain, subsubdomain)
+	if !ok {
+		fmt.Println("EVENT request '" + r.Host + "' has no match, returning 404")
+		w.WriteHeader(http.StatusNotFound)
+		return stats.ResultDSMiss
+	}
+
+	fmt.Println("EVENT " + r.RemoteAddr + " request '" + r.Host + "' matched " + string(dsName))
+
+	ipStr := r.Header.Get("X-Forwarded-For")
+	if ipStr == "" {
+		err := error(nil)
+		ipStr, _, err = net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			fmt.Println("ERROR request from" + r.RemoteAddr + " failed to parse: " + err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return stats.ResultError
 		}
+	}
 
-		fmt.Println("EVENT " + r.RemoteAddr + " request '" + r.Host + "' matched " + string(dsName))
+	fmt.Println("DEBUG " + r.RemoteAddr + " IP '" + ipStr + "'")
 
-		ipStr := r.Header.Get("X-Forwarded-For")
-		if ipStr == "" {
-			err := error(nil)
-			ipStr, _, err = net.SplitHostPort(r.RemoteAddr)
-			if err != nil {
-				fmt.Println("ERROR request from" + r.RemoteAddr + " failed to parse: " + err.Error())
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		fmt.Println("ERROR request from" + r.RemoteAddr + " IP failed to parse.")
+		w.WriteHeader(http.StatusInternalServerError)
+		return stats.ResultError
+	}
+
+	crc := rt.crcThs.Get()
+	if tlsMismatch(r, deliveryService(crc, dsName)) {
+		fmt.Println("EVENT request '" + r.Host + "' ds '" + string(dsName) + "' doesn't accept the request protocol, returning 503")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return stats.ResultError
+	}
+
+	steer, ok := (*steering.Steerings)(rt.steeringThs.Get()).Get(dsName)
+	if !ok {
+		return rt.route(w, r, crc, dsName, ip, subdomain+"."+domain)
+	} else if steer.ClientSteering {
+		return rt.routeClientSteering(w, r, crc, dsName, steer, ip)
+	}
+	return rt.routeSteering(w, r, crc, dsName, steer, ip)
+}
+
+// route redirects the request from the client IP to the given Delivery Service to its cache, with the given host suffix,
+// or to the federation CNAME if the client is federated, and returns the result.
+func (rt *router) route(w http.ResponseWriter, r *http.Request, crc *tc.CRConfig, dsName tc.DeliveryServiceName, ip net.IP, host string) stats.ResultType {
+	ds := deliveryService(crc, dsName)
+	scheme := rt.scheme(r, dsName, ds)
+	if mapping, ok := federation.Find(ip, dsName, ds, rt.cz, (*federation.Federations)(rt.fedThs.Get())); ok {
+		fmt.Println("EVENT request from" + r.RemoteAddr + " IP " + ip.String() + " ds '" + string(dsName) + "' federated, redirecting to '" + mapping.CName + "'")
+		w.Header().Add("Location", requestURL(scheme, strings.TrimSuffix(mapping.CName, "."), r))
+		w.WriteHeader(http.StatusFound)
+		return stats.ResultFed
+	}
+
+	consistentHasher := (*consistenthash.ConsistentHasher)(rt.consistentHasherThs.Get())
+	srvr, _, result, status, err := rt.selectCache(crc, dsName, ip, consistentHasher.PathToHash(dsName, r.URL.Path, r.URL.RawQuery))
+	if err == errGeoLimited {
+		if redirectURL, ok := geolocation.RedirectURL(ds); ok {
+			fmt.Println("EVENT request from" + r.RemoteAddr + " IP " + ip.String() + " ds '" + string(dsName) + "' geo-limited, redirecting to '" + redirectURL + "'")
+			w.Header().Add("Location", redirectURL)
+			w.WriteHeader(http.StatusFound)
+			return stats.ResultGeoRedirect
 		}
+		fmt.Println("EVENT request from" + r.RemoteAddr + " IP " + ip.String() + " ds '" + string(dsName) + "' geo-limited with no redirect URL, returning 503")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return result
+	} else if err != nil {
+		fmt.Println("EVENT request '" + r.Host + "' ds '" + string(dsName) + "' " + err.Error() + ", returning " + strconv.Itoa(status))
+		w.WriteHeader(status)
+		return result
+	}
 
-		fmt.Println("DEBUG " + r.RemoteAddr + " IP '" + ipStr + "'")
+	w.Header().Add("Location", cacheURL(scheme, srvr, host, r))
+	w.WriteHeader(http.StatusFound)
+	return result
+}
 
-		ip := net.ParseIP(ipStr)
-		if ip == nil {
-			fmt.Println("ERROR request from" + r.RemoteAddr + " IP failed to parse.")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+// routeSteering redirects the request from the client IP to the given STEERING Delivery Service to a cache of its first target with an available cache.
+// The targets are the one in the steering option header, or else the target of the first filter matching the path, or else all targets in the order
+// Traffic Router selects them by consistent hash. Targets the client is geo-limited from, or which have no available caches, are skipped.
+// It returns the result of the target routed to.
+func (rt *router) routeSteering(w http.ResponseWriter, r *http.Request, crc *tc.CRConfig, dsName tc.DeliveryServiceName, steer steering.Steering, ip net.IP) stats.ResultType {
+	consistentHasher := (*consistenthash.ConsistentHasher)(rt.consistentHasherThs.Get())
+	targets := []tc.DeliveryServiceName{}
+	if option := tc.DeliveryServiceName(r.Header.Get(SteeringOptionHeader)); option != "" {
+		if !steer.HasTarget(option) {
+			fmt.Println("EVENT request '" + r.Host + "' steering ds '" + string(dsName) + "' option '" + string(option) + "' is not a target, returning 404")
+			w.WriteHeader(http.StatusNotFound)
+			return stats.ResultError
+		}
+		targets = append(targets, option)
+	} else if bypass, ok := steer.Bypass(r.URL.Path); ok && deliveryService(crc, bypass) != nil {
+		targets = append(targets, bypass)
+	} else {
+		for _, target := range steer.OrderTargets(consistentHasher.PathToHash(dsName, r.URL.Path, r.URL.RawQuery)) {
+			targets = append(targets, target.DeliveryService)
 		}
+	}
 
-		pos, ok := cz.Get(ip)
+	for _, target := range targets {
+		host, ok := targetHost(crc, target)
 		if !ok {
-			pos = DefaultPos
-			log.Warnln("request from" + r.RemoteAddr + " IP " + ip.String() + " not found, using default")
+			// targets might not be in the CRConfig yet
+			continue
+		}
+		targetDS := deliveryService(crc, target)
+		if tlsMismatch(r, targetDS) {
+			fmt.Println("EVENT request '" + r.Host + "' steering ds '" + string(dsName) + "' target '" + string(target) + "' doesn't accept the request protocol, trying the next target")
+			continue
 		}
-		log.Infof("LATLON: Request from"+r.RemoteAddr+" IP "+ip.String()+" got %+v\n", pos)
+		srvr, _, result, _, err := rt.selectCache(crc, target, ip, consistentHasher.SteeringPathToHash(dsName, target, r.URL.Path, r.URL.RawQuery))
+		if err != nil {
+			fmt.Println("EVENT request '" + r.Host + "' steering ds '" + string(dsName) + "' target '" + string(target) + "' " + err.Error() + ", trying the next target")
+			continue
+		}
+		w.Header().Add("Location", cacheURL(rt.scheme(r, target, targetDS), srvr, host, r))
+		w.WriteHeader(http.StatusFound)
+		return result
+	}
+
+	fmt.Println("EVENT request '" + r.Host + "' steering ds '" + string(dsName) + "' no target has an available cache, returning 503")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	return stats.ResultMiss
+}
 
-		cgSrch := cgSrchThs.Get()
-		cgDat, ok := cgSrch.Nearest(pos.Lat, pos.Lon)
+// routeClientSteering responds to the request from the client IP to the given CLIENT_STEERING Delivery Service with the locations of a cache of each target
+// with an available cache, the same as Traffic Router. The locations are in the order Traffic Router selects the targets by consistent hash, and then by distance
+// from the client, through the cache, to the target's origin location, if targets have locations. It returns the result of the targets.
+func (rt *router) routeClientSteering(w http.ResponseWriter, r *http.Request, crc *tc.CRConfig, dsName tc.DeliveryServiceName, steer steering.Steering, ip net.IP) stats.ResultType {
+	consistentHasher := (*consistenthash.ConsistentHasher)(rt.consistentHasherThs.Get())
+	results := []steering.Result{}
+	result := stats.ResultMiss
+	for _, target := range steer.OrderTargets(consistentHasher.PathToHash(dsName, r.URL.Path, r.URL.RawQuery)) {
+		host, ok := targetHost(crc, target.DeliveryService)
 		if !ok {
-			fmt.Println("ERROR request from" + r.RemoteAddr + " has no nearest cachegroup (should only happen if there are no cachegroups)")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+			// targets might not be in the CRConfig yet
+			continue
 		}
-		cg := tc.CacheGroupName(cgDat.Obj)
-
-		srvrs, err := availSrvrs.Get(dsName, cg)
+		targetDS := deliveryService(crc, target.DeliveryService)
+		if tlsMismatch(r, targetDS) {
+			fmt.Println("EVENT request '" + r.Host + "' client steering ds '" + string(dsName) + "' target '" + string(target.DeliveryService) + "' doesn't accept the request protocol, skipping")
+			continue
+		}
+		srvr, cachePos, targetResult, _, err := rt.selectCache(crc, target.DeliveryService, ip, consistentHasher.SteeringPathToHash(dsName, target.DeliveryService, r.URL.Path, r.URL.RawQuery))
 		if err != nil {
-			fmt.Println("EVENT request '" + r.Host + "' with cg '" + string(cg) + "' ds '" + string(dsName) + "' failed to get available servers, returning 404: " + err.Error())
-			w.WriteHeader(http.StatusNotFound)
-			return
+			fmt.Println("EVENT request '" + r.Host + "' client steering ds '" + string(dsName) + "' target '" + string(target.DeliveryService) + "' " + err.Error() + ", skipping")
+			continue
 		}
+		result = targetResult
+		results = append(results, steering.Result{Target: target, Cache: srvr, CachePos: cachePos, URL: cacheURL(rt.scheme(r, target.DeliveryService, targetDS), srvr, host, r)})
+	}
+	if len(results) == 0 {
+		fmt.Println("EVENT request '" + r.Host + "' client steering ds '" + string(dsName) + "' no target has an available cache, returning 503")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return result
+	}
 
-		fmt.Printf("DEBUG GOT AVAILABLE SERVERS %+v\n", srvrs)
+	if clientPos, ok := geolocation.Locate(ip, deliveryService(crc, dsName), rt.cz, (*geolocation.DB)(rt.geoThs.Get()), DefaultPos); ok {
+		steering.SortByGeo(results, clientPos)
+	}
 
-		if len(srvrs) == 0 {
-			fmt.Println("EVENT request '" + r.Host + "' with cg '" + string(cg) + "' ds '" + string(dsName) + "' no available servers, returning 500")
-			w.WriteHeader(http.StatusInternalServerError) // TODO better code?
-			return
-		}
+	locations := struct {
+		Locations []string `json:"locations"`
+	}{Locations: make([]string, 0, len(results))}
+	for _, result := range results {
+		locations.Locations = append(locations.Locations, result.URL)
+	}
+	bts, err := json.Marshal(locations)
+	if err != nil {
+		fmt.Println("ERROR request '" + r.Host + "' client steering ds '" + string(dsName) + "' marshalling locations, returning 500: " + err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return stats.ResultError
+	}
 
-		nextCacher := nextCacherThs.Get()
-		nextSrvrI, ok := nextCacher.NextCache(dsName)
-		if !ok {
-			// should never happen
-			fmt.Println("ERROR request '" + r.Host + "' with cg '" + string(cg) + "' ds '" + string(dsName) + "' not found in Nextcacher, returning 500")
-			w.WriteHeader(http.StatusInternalServerError) // TODO better code?
-			return
+	w.Header().Set("Content-Type", "application/json")
+	if strings.EqualFold(r.URL.Query().Get(RedirectQueryParam), "false") {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.Header().Add("Location", locations.Locations[0])
+		w.WriteHeader(http.StatusFound)
+	}
+	if r.Method != http.MethodHead {
+		w.Write(bts)
+	}
+	return result
+}
+
+// selectCache returns the cache for a request from the client IP to the given Delivery Service with the given string to hash, the location of its Cache Group,
+// and the result. If there is no cache, it returns an error and the HTTP status code to respond with. If the client is geo-limited, the error is errGeoLimited.
+func (rt *router) selectCache(crc *tc.CRConfig, dsName tc.DeliveryServiceName, ip net.IP, pathToHash string) (tc.CacheName, tc.CRConfigLatitudeLongitude, stats.ResultType, int, error) {
+	if ds := deliveryService(crc, dsName); ds != nil && ds.DeepCachingType != nil && *ds.DeepCachingType == tc.DeepCachingTypeAlways {
+		if srvr, cgPos, ok := rt.selectDeepCache(crc, dsName, ip, pathToHash); ok {
+			return srvr, cgPos, stats.ResultDeepCZ, 0, nil
 		}
+	}
+
+	result := stats.ResultCZ
+	pos, ok := rt.cz.Get(ip)
+	if !ok {
+		result = stats.ResultGeo
+		pos, ok = geolocation.Locate(ip, deliveryService(crc, dsName), rt.cz, (*geolocation.DB)(rt.geoThs.Get()), DefaultPos)
+	}
+	if !ok {
+		return "", tc.CRConfigLatitudeLongitude{}, stats.ResultMiss, http.StatusServiceUnavailable, errGeoLimited
+	}
+	log.Infof("LATLON: Request from IP "+ip.String()+" got %+v\n", pos)
+
+	cgSrch := rt.cgSrchThs.Get()
+	cgDat, ok := cgSrch.Nearest(pos.Lat, pos.Lon)
+	if !ok {
+		return "", tc.CRConfigLatitudeLongitude{}, stats.ResultError, http.StatusInternalServerError, errors.New("has no nearest cachegroup (should only happen if there are no cachegroups)")
+	}
+	cg := tc.CacheGroupName(cgDat.Obj)
+	cgPos := tc.CRConfigLatitudeLongitude{Lat: cgDat.Lat, Lon: cgDat.Lon}
+
+	srvrs, err := rt.availSrvrs.Get(dsName, cg)
+	if err != nil {
+		return "", cgPos, stats.ResultMiss, http.StatusNotFound, errors.New("with cg '" + string(cg) + "' failed to get available servers: " + err.Error())
+	}
+
+	fmt.Printf("DEBUG GOT AVAILABLE SERVERS %+v\n", srvrs)
+
+	if len(srvrs) == 0 {
+		return "", cgPos, stats.ResultMiss, http.StatusInternalServerError, errors.New("with cg '" + string(cg) + "' no available servers") // TODO better code?
+	}
+
+	consistentHasher := (*consistenthash.ConsistentHasher)(rt.consistentHasherThs.Get())
+	selected := consistentHasher.SelectCaches(dsName, srvrs, pathToHash)
+	if len(selected) == 0 {
+		// should never happen, unless the dispersion limit is 0
+		return "", cgPos, stats.ResultError, http.StatusInternalServerError, errors.New("with cg '" + string(cg) + "' consistent hash selected no servers") // TODO better code?
+	}
+	return selected[0], cgPos, result, 0, nil
+}
 
-		srvr := srvrs[nextSrvrI%uint64(len(srvrs))]
+// selectDeepCache returns the deep cache for a request from the client IP to the given Delivery Service with the given string to hash, and the location of its Cache Group.
+// It returns false if the client isn't in the deep coverage zone, or none of its deep caches are available for the Delivery Service, and the request should fall back to the Cache Group nearest the client, like Traffic Router.
+func (rt *router) selectDeepCache(crc *tc.CRConfig, dsName tc.DeliveryServiceName, ip net.IP, pathToHash string) (tc.CacheName, tc.CRConfigLatitudeLongitude, bool) {
+	deepCaches, ok := (*deepcoveragezone.DeepCoverageZone)(rt.deepCZThs.Get()).Get(ip)
+	if !ok {
+		return "", tc.CRConfigLatitudeLongitude{}, false
+	}
 
-		newURL := string(srvr) + "." + subdomain + "." + domain + r.URL.Path
-		if r.URL.RawQuery != "" {
-			newURL += "?" + r.URL.RawQuery
+	available := []tc.CacheName{}
+	for _, deepCache := range deepCaches {
+		server, ok := crc.ContentServers[string(deepCache)]
+		if !ok || server.CacheGroup == nil {
+			continue
+		}
+		srvrs, err := rt.availSrvrs.Get(dsName, tc.CacheGroupName(*server.CacheGroup))
+		if err != nil {
+			continue
 		}
+		for _, srvr := range srvrs {
+			if srvr == deepCache {
+				available = append(available, deepCache)
+				break
+			}
+		}
+	}
+	if len(available) == 0 {
+		return "", tc.CRConfigLatitudeLongitude{}, false
+	}
 
-		w.Header().Add("Location", newURL)
-		w.WriteHeader(http.StatusFound)
+	consistentHasher := (*consistenthash.ConsistentHasher)(rt.consistentHasherThs.Get())
+	selected := consistentHasher.SelectCaches(dsName, available, pathToHash)
+	if len(selected) == 0 {
+		return "", tc.CRConfigLatitudeLongitude{}, false
 	}
+	return selected[0], crc.EdgeLocations[*crc.ContentServers[string(selected[0])].CacheGroup], true
 }
 
+// deliveryService returns the given Delivery Service in the CRConfig, or nil if it or the CRConfig doesn't exist.
+func deliveryService(crc *tc.CRConfig, dsName tc.DeliveryServiceName) *tc.CRConfigDeliveryService {
+	if crc == nil {
+		return nil
+	}
+	ds, ok := crc.DeliveryServices[string(dsName)]
+	if !ok {
+		return nil
+	}
+	return &ds
+}
+
+// targetHost returns the domain of the given steering target in the CRConfig, which follows the cache name in its URLs, and false if it isn't in the CRConfig.
+func targetHost(crc *tc.CRConfig, target tc.DeliveryServiceName) (string, bool) {
+	ds := deliveryService(crc, target)
+	if ds == nil || len(ds.Domains) == 0 {
+		return "", false
+	}
+	return ds.Domains[0], true
+}
+
+// tlsMismatch returns whether the Delivery Service doesn't accept the request's protocol, like Traffic Router: HTTPS requests
+// to Delivery Services without SSL enabled, and HTTP requests to Delivery Services which don't accept HTTP. The ds may be nil.
+func tlsMismatch(r *http.Request, ds *tc.CRConfigDeliveryService) bool {
+	if ds == nil {
+		return false
+	}
+	if r.TLS != nil {
+		return !ds.SSLEnabled
+	}
+	return ds.Protocol != nil && ds.Protocol.AcceptHTTP != nil && !*ds.Protocol.AcceptHTTP
+}
+
+// scheme returns the scheme to redirect the request to the Delivery Service's caches with, like Traffic Router: HTTPS if the Delivery Service
+// accepts HTTPS and has a certificate, and the request is HTTPS or the Delivery Service redirects HTTP to HTTPS. The ds may be nil.
+func (rt *router) scheme(r *http.Request, dsName tc.DeliveryServiceName, ds *tc.CRConfigDeliveryService) string {
+	if ds == nil || ds.Protocol == nil || !ds.Protocol.AcceptHTTPS || !ds.SSLEnabled || !(*sslkeys.Certificates)(rt.certsThs.Get()).HasDeliveryService(dsName) {
+		return "http"
+	}
+	if r.TLS != nil || ds.Protocol.RedirectOnHTTPS {
+		return "https"
+	}
+	return "http"
+}
+
+// cacheURL returns the URL to redirect the request to the given cache, with the given scheme and host suffix.
+func cacheURL(scheme string, srvr tc.CacheName, host string, r *http.Request) string {
+	return requestURL(scheme, string(srvr)+"."+host, r)
+}
+
+// requestURL returns the URL to redirect the request to the given host, with the given scheme.
+func requestURL(scheme string, host string, r *http.Request) string {
+	newURL := scheme + "://" + host + r.URL.Path
+	if r.URL.RawQuery != "" {
+		newURL += "?" + r.URL.RawQuery
+	}
+	return newURL
+}
+
+// Start starts serving HTTP on the given port, and HTTPS on the given HTTPS port if it isn't 0, and returns the servers.
+// HTTPS connections are served the certificate of their TLS server name, from the latest certificates.
 func Start(
+	crc crconfig.Ths,
 	regexes crconfigregex.Ths,
 	availableServers availableservers.AvailableServers,
 	cgSrch cgsrch.Ths,
-	nextCacher nextcache.Ths,
+	consistentHasher consistenthash.Ths,
 	cz coveragezone.CoverageZone,
+	geo geolocation.Ths,
+	deepCZ deepcoveragezone.Ths,
+	steerings steering.Ths,
+	feds federation.Ths,
+	certs sslkeys.Ths,
+	routingStats *stats.Stats,
 	port uint,
-) *http.Server {
-	srvr := http.Server{}
-	srvr.Addr = ":" + strconv.Itoa(int(port))
-	srvr.Handler = getHandler(regexes, availableServers, cgSrch, nextCacher, cz)
+	httpsPort uint,
+) []*http.Server {
+	handler := &router{
+		crcThs:              crc,
+		regexes:             regexes,
+		availSrvrs:          availableServers,
+		cgSrchThs:           cgSrch,
+		consistentHasherThs: consistentHasher,
+		cz:                  cz,
+		geoThs:              geo,
+		deepCZThs:           deepCZ,
+		steeringThs:         steerings,
+		fedThs:              feds,
+		certsThs:            certs,
+		stats:               routingStats,
+	}
+
+	srvr := &http.Server{Addr: ":" + strconv.Itoa(int(port)), Handler: handler}
 	go func() {
 		err := srvr.ListenAndServe()
 		if err != nil {
 			fmt.Println("Serving: " + err.Error())
 		}
 	}()
-	return &srvr
+	srvrs := []*http.Server{srvr}
+	if httpsPort == 0 {
+		return srvrs
+	}
+
+	tlsSrvr := &http.Server{
+		Addr:    ":" + strconv.Itoa(int(httpsPort)),
+		Handler: handler,
+		TLSConfig: &tls.Config{
+			GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return getCertificate(certs, hello)
+			},
+		},
+	}
+	go func() {
+		err := tlsSrvr.ListenAndServeTLS("", "")
+		if err != nil {
+			fmt.Println("Serving HTTPS: " + err.Error())
+		}
+	}()
+	return append(srvrs, tlsSrvr)
+}
+
+// getCertificate returns the certificate for the TLS server name of the given client hello, from the latest certificates.
+func getCertificate(certs sslkeys.Ths, hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, ok := (*sslkeys.Certificates)(certs.Get()).Get(hello.ServerName)
+	if !ok {
+		fmt.Println("EVENT HTTPS connection from " + hello.Conn.RemoteAddr().String() + " server name '" + hello.ServerName + "' has no certificate")
+		return nil, errors.New("no certificate for server name '" + hello.ServerName + "'")
+	}
+	return cert, nil
 }
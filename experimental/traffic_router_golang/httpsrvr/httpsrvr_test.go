@@ -0,0 +1,441 @@
+package httpsrvr
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/availableservers"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/cgsrch"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/consistenthash"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/coveragezone"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/crconfig"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/crconfigregex"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/deepcoveragezone"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/federation"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/geolocation"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/sslkeys"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/stats"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/steering"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+const testCRConfig = `{
+	"contentServers": {
+		"edge-1": {"cacheGroup": "cg-east", "deliveryServices": {"target-b": []}},
+		"edge-2": {"cacheGroup": "cg-east", "deliveryServices": {"target-c": []}},
+		"edge-3": {"cacheGroup": "cg-east", "deliveryServices": {"https-ds": [], "https-only-ds": []}},
+		"edge-4": {"cacheGroup": "cg-east", "deliveryServices": {"deep-ds": []}},
+		"deep-1": {"cacheGroup": "cg-deep", "deliveryServices": {"deep-ds": []}},
+		"deep-2": {"cacheGroup": "cg-deep", "deliveryServices": {"deep-ds": []}}
+	},
+	"deliveryServices": {
+		"steer": {"domains": ["steer.mycdn.example.net"], "matchsets": [{"protocol": "HTTP", "matchlist": [{"regex": ".*\\.steer\\..*", "match-type": "HOST"}]}]},
+		"client-steer": {"domains": ["client-steer.mycdn.example.net"], "matchsets": [{"protocol": "HTTP", "matchlist": [{"regex": ".*\\.client-steer\\..*", "match-type": "HOST"}]}]},
+		"target-a": {"domains": ["target-a.mycdn.example.net"], "matchsets": [{"protocol": "HTTP", "matchlist": [{"regex": ".*\\.target-a\\..*", "match-type": "HOST"}]}]},
+		"target-b": {"domains": ["target-b.mycdn.example.net"], "matchsets": [{"protocol": "HTTP", "matchlist": [{"regex": ".*\\.target-b\\..*", "match-type": "HOST"}]}]},
+		"target-c": {"domains": ["target-c.mycdn.example.net"], "matchsets": [{"protocol": "HTTP", "matchlist": [{"regex": ".*\\.target-c\\..*", "match-type": "HOST"}]}]},
+		"https-ds": {"domains": ["https-ds.mycdn.example.net"], "sslEnabled": "true", "protocol": {"acceptHttps": "true", "redirectToHttps": "true"}, "matchsets": [{"protocol": "HTTP", "matchlist": [{"regex": ".*\\.https-ds\\..*", "match-type": "HOST"}]}]},
+		"deep-ds": {"domains": ["deep-ds.mycdn.example.net"], "deepCachingType": "ALWAYS", "matchsets": [{"protocol": "HTTP", "matchlist": [{"regex": ".*\\.deep-ds\\..*", "match-type": "HOST"}]}]},
+		"https-only-ds": {"domains": ["https-only-ds.mycdn.example.net"], "sslEnabled": "true", "protocol": {"acceptHttp": "false", "acceptHttps": "true"}, "matchsets": [{"protocol": "HTTP", "matchlist": [{"regex": ".*\\.https-only-ds\\..*", "match-type": "HOST"}]}]}
+	},
+	"edgeLocations": {
+		"cg-east": {"latitude": 40, "longitude": -75}
+	}
+}`
+
+func testRouter(t *testing.T) *router {
+	crc := &tc.CRConfig{}
+	if err := json.Unmarshal([]byte(testCRConfig), crc); err != nil {
+		t.Fatalf("unmarshalling test CRConfig: %v", err)
+	}
+	crcThs := crconfig.NewThs()
+	crcThs.Set(crc)
+
+	regexes, err := crconfigregex.Get(crc)
+	if err != nil {
+		t.Fatalf("creating regexes: %v", err)
+	}
+	regexesThs := crconfigregex.NewThs()
+	regexesThs.Set(&regexes)
+
+	cgSearcher, err := cgsrch.Create(crc)
+	if err != nil {
+		t.Fatalf("creating cachegroup searcher: %v", err)
+	}
+	cgSrchThs := cgsrch.NewThs()
+	cgSrchThs.Set(cgSearcher)
+
+	consistentHasher, err := consistenthash.Create(crc)
+	if err != nil {
+		t.Fatalf("creating consistent hasher: %v", err)
+	}
+	consistentHasherThs := consistenthash.NewThs()
+	consistentHasherThs.Set(consistentHasher)
+
+	availSrvrs := availableservers.New()
+	availSrvrs.Set(availableservers.AvailableServersMap{
+		"target-a":      {"cg-east": {}},
+		"target-b":      {"cg-east": {"edge-1"}},
+		"target-c":      {"cg-east": {"edge-2"}},
+		"https-ds":      {"cg-east": {"edge-3"}},
+		"https-only-ds": {"cg-east": {"edge-3"}},
+		"deep-ds":       {"cg-east": {"edge-4"}, "cg-deep": {"deep-1"}},
+	})
+
+	cz, err := coveragezone.New(coveragezone.JSONCoverageZones{CoverageZones: map[tc.CacheGroupName]coveragezone.JSONCoverageZoneCacheGroup{
+		"cg-east": {Coordinates: tc.CRConfigLatitudeLongitude{Lat: 40, Lon: -75}, Network: []string{"10.0.0.0/8"}},
+	}})
+	if err != nil {
+		t.Fatalf("creating coverage zone: %v", err)
+	}
+
+	steerings, err := steering.Create([]tc.Steering{
+		{
+			DeliveryService: "steer",
+			Targets: []tc.SteeringSteeringTarget{
+				{DeliveryService: "target-a", Order: -1},
+				{DeliveryService: "target-b", Order: 0},
+				{DeliveryService: "target-c", Order: 1},
+			},
+			Filters: []tc.SteeringFilter{{DeliveryService: "target-c", Pattern: "/c/.*"}},
+		},
+		{
+			DeliveryService: "client-steer",
+			ClientSteering:  true,
+			Targets: []tc.SteeringSteeringTarget{
+				{DeliveryService: "target-c", Order: -1},
+				{DeliveryService: "target-a", Order: 0},
+				{DeliveryService: "target-b", Order: 1},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("creating steering: %v", err)
+	}
+	steeringThs := steering.NewThs()
+	steeringThs.Set(steerings)
+
+	cname := "fed.example.net."
+	ttl := 60
+	feds, err := federation.Create([]tc.AllDeliveryServiceFederationsMapping{
+		{DeliveryService: "target-b", Mappings: []tc.FederationResolverMapping{
+			{CName: &cname, TTL: &ttl, ResolverMapping: tc.ResolverMapping{Resolve4: []string{"203.0.113.0/24"}, Resolve6: []string{"2001:db8::/32"}}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("creating federations: %v", err)
+	}
+	fedThs := federation.NewThs()
+	fedThs.Set(feds)
+
+	deepCZ, err := deepcoveragezone.Create(deepcoveragezone.JSONDeepCoverageZones{DeepCoverageZones: map[string]deepcoveragezone.JSONDeepCoverageZoneLocation{
+		"deep-available":   {Network: []string{"10.1.0.0/16"}, Caches: []tc.CacheName{"deep-2", "deep-1"}},
+		"deep-unavailable": {Network: []string{"10.2.0.0/16"}, Caches: []tc.CacheName{"deep-2"}},
+	}})
+	if err != nil {
+		t.Fatalf("creating deep coverage zone: %v", err)
+	}
+	deepCZThs := deepcoveragezone.NewThs()
+	deepCZThs.Set(deepCZ)
+
+	certs, errs := sslkeys.Create([]tc.CDNSSLKeys{
+		{DeliveryService: "https-ds", Hostname: "*.https-ds.mycdn.example.net", Certificate: testCertificate(t, "*.https-ds.mycdn.example.net")},
+		{DeliveryService: "https-only-ds", Hostname: "*.https-only-ds.mycdn.example.net", Certificate: testCertificate(t, "*.https-only-ds.mycdn.example.net")},
+	})
+	if len(errs) != 0 {
+		t.Fatalf("creating certificates: %v", errs)
+	}
+	certsThs := sslkeys.NewThs()
+	certsThs.Set(certs)
+
+	return &router{
+		crcThs:              crcThs,
+		regexes:             regexesThs,
+		availSrvrs:          availSrvrs,
+		cgSrchThs:           cgSrchThs,
+		consistentHasherThs: consistentHasherThs,
+		cz:                  cz,
+		geoThs:              geolocation.NewThs(),
+		deepCZThs:           deepCZThs,
+		steeringThs:         steeringThs,
+		fedThs:              fedThs,
+		certsThs:            certsThs,
+		stats:               stats.New(),
+	}
+}
+
+// testCertificate returns a self-signed certificate and key for the given hostname, base64 encoded like the Traffic Ops CDN SSL keys.
+func testCertificate(t *testing.T, hostname string) tc.CDNSSLKeysCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: hostname},
+		DNSNames:     []string{hostname},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	crtDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshalling key: %v", err)
+	}
+	return tc.CDNSSLKeysCertificate{
+		Crt: base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crtDER})),
+		Key: base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+	}
+}
+
+func serveTest(rt *router, host string, path string, header http.Header) *httptest.ResponseRecorder {
+	return serveTestFrom(rt, host, path, header, "10.1.2.3:12345")
+}
+
+func serveTestFrom(rt *router, host string, path string, header http.Header, remoteAddr string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "http://"+host+path, nil)
+	r.Host = host
+	r.RemoteAddr = remoteAddr
+	for name, vals := range header {
+		for _, val := range vals {
+			r.Header.Add(name, val)
+		}
+	}
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	return w
+}
+
+func TestSteering(t *testing.T) {
+	rt := testRouter(t)
+
+	w := serveTest(rt, "tr.steer.mycdn.example.net", "/some/path", nil)
+	if location := w.Header().Get("Location"); w.Code != http.StatusFound || location != "http://edge-1.target-b.mycdn.example.net/some/path" {
+		t.Errorf("expected redirect to the first target with available caches, actual %v '%v'", w.Code, location)
+	}
+
+	w = serveTest(rt, "tr.steer.mycdn.example.net", "/c/path", nil)
+	if location := w.Header().Get("Location"); w.Code != http.StatusFound || location != "http://edge-2.target-c.mycdn.example.net/c/path" {
+		t.Errorf("expected redirect to the filter target, actual %v '%v'", w.Code, location)
+	}
+
+	w = serveTest(rt, "tr.steer.mycdn.example.net", "/some/path", http.Header{SteeringOptionHeader: {"target-c"}})
+	if location := w.Header().Get("Location"); w.Code != http.StatusFound || location != "http://edge-2.target-c.mycdn.example.net/some/path" {
+		t.Errorf("expected redirect to the steering option target, actual %v '%v'", w.Code, location)
+	}
+
+	w = serveTest(rt, "tr.steer.mycdn.example.net", "/some/path", http.Header{SteeringOptionHeader: {"not-a-target"}})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected steering option which isn't a target to be 404, actual %v", w.Code)
+	}
+}
+
+func TestClientSteering(t *testing.T) {
+	rt := testRouter(t)
+
+	w := serveTest(rt, "tr.client-steer.mycdn.example.net", "/some/path?a=b", nil)
+	locations := struct {
+		Locations []string `json:"locations"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &locations); err != nil {
+		t.Fatalf("unmarshalling client steering response: %v", err)
+	}
+	expected := []string{"http://edge-2.target-c.mycdn.example.net/some/path?a=b", "http://edge-1.target-b.mycdn.example.net/some/path?a=b"}
+	if !reflect.DeepEqual(locations.Locations, expected) {
+		t.Errorf("expected locations of targets with available caches %v, actual %v", expected, locations.Locations)
+	}
+	if location := w.Header().Get("Location"); w.Code != http.StatusFound || location != expected[0] {
+		t.Errorf("expected redirect to the first location, actual %v '%v'", w.Code, location)
+	}
+
+	w = serveTest(rt, "tr.client-steer.mycdn.example.net", "/some/path?"+RedirectQueryParam+"=false", nil)
+	if location := w.Header().Get("Location"); w.Code != http.StatusOK || location != "" {
+		t.Errorf("expected '%v=false' to return 200 without redirecting, actual %v '%v'", RedirectQueryParam, w.Code, location)
+	}
+}
+
+func TestNotSteering(t *testing.T) {
+	rt := testRouter(t)
+
+	w := serveTest(rt, "tr.target-a.mycdn.example.net", "/some/path", nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected delivery service without available caches to be 500, actual %v", w.Code)
+	}
+
+	w = serveTest(rt, "tr.target-b.mycdn.example.net", "/some/path", nil)
+	if location := w.Header().Get("Location"); w.Code != http.StatusFound || location != "http://edge-1.target-b.mycdn.example/some/path" {
+		t.Errorf("expected redirect to the delivery service cache, actual %v '%v'", w.Code, location)
+	}
+}
+
+func TestFederation(t *testing.T) {
+	rt := testRouter(t)
+
+	for _, remoteAddr := range []string{"203.0.113.1:12345", "[2001:db8::1]:12345"} {
+		w := serveTestFrom(rt, "tr.target-b.mycdn.example.net", "/some/path?a=b", nil, remoteAddr)
+		if location := w.Header().Get("Location"); w.Code != http.StatusFound || location != "http://fed.example.net/some/path?a=b" {
+			t.Errorf("expected federated client %v to be redirected to the federation CNAME, actual %v '%v'", remoteAddr, w.Code, location)
+		}
+	}
+
+	w := serveTestFrom(rt, "tr.target-b.mycdn.example.net", "/some/path", nil, "198.51.100.1:12345")
+	if location := w.Header().Get("Location"); w.Code != http.StatusFound || location != "http://edge-1.target-b.mycdn.example/some/path" {
+		t.Errorf("expected client without a federation to be redirected to the cache, actual %v '%v'", w.Code, location)
+	}
+}
+
+func TestDeepCaching(t *testing.T) {
+	rt := testRouter(t)
+
+	w := serveTestFrom(rt, "tr.deep-ds.mycdn.example.net", "/some/path", nil, "10.1.2.3:12345")
+	if location := w.Header().Get("Location"); w.Code != http.StatusFound || location != "http://deep-1.deep-ds.mycdn.example/some/path" {
+		t.Errorf("expected client in the deep coverage zone to be redirected to the available deep cache, actual %v '%v'", w.Code, location)
+	}
+
+	w = serveTestFrom(rt, "tr.deep-ds.mycdn.example.net", "/some/path", nil, "10.2.3.4:12345")
+	if location := w.Header().Get("Location"); w.Code != http.StatusFound || location != "http://edge-4.deep-ds.mycdn.example/some/path" {
+		t.Errorf("expected client whose deep caches are unavailable to fall back to the cachegroup cache, actual %v '%v'", w.Code, location)
+	}
+
+	w = serveTestFrom(rt, "tr.deep-ds.mycdn.example.net", "/some/path", nil, "10.3.4.5:12345")
+	if location := w.Header().Get("Location"); w.Code != http.StatusFound || location != "http://edge-4.deep-ds.mycdn.example/some/path" {
+		t.Errorf("expected client outside the deep coverage zone to be redirected to the cachegroup cache, actual %v '%v'", w.Code, location)
+	}
+
+	rt.availSrvrs.Set(availableservers.AvailableServersMap{"target-b": {"cg-deep": {"deep-1"}, "cg-east": {"edge-1"}}})
+	w = serveTestFrom(rt, "tr.target-b.mycdn.example.net", "/some/path", nil, "10.1.2.3:12345")
+	if location := w.Header().Get("Location"); w.Code != http.StatusFound || location != "http://edge-1.target-b.mycdn.example/some/path" {
+		t.Errorf("expected delivery service which never deep caches to be redirected to the cachegroup cache, actual %v '%v'", w.Code, location)
+	}
+
+	if stat := rt.stats.Get().HTTPMap["tr.deep-ds.mycdn.example.net"]; stat.DeepCZCount != 1 || stat.CZCount != 2 {
+		t.Errorf("expected 1 deep coverage zone and 2 coverage zone results, actual %+v", stat)
+	}
+}
+
+func TestStats(t *testing.T) {
+	rt := testRouter(t)
+
+	serveTest(rt, "tr.target-b.mycdn.example.net:8080", "/some/path", nil)
+	serveTestFrom(rt, "TR.target-b.mycdn.example.net", "/some/path", nil, "198.51.100.1:12345")
+	serveTestFrom(rt, "tr.target-b.mycdn.example.net", "/some/path", nil, "203.0.113.1:12345")
+	serveTest(rt, "tr.target-a.mycdn.example.net", "/some/path", nil)
+	serveTest(rt, "tr.steer.mycdn.example.net", "/some/path", nil)
+	serveTest(rt, "tr.not-a-ds.mycdn.example.net", "/some/path", nil)
+
+	actual := rt.stats.Get()
+	expected := map[string]tc.CRSStatsStat{
+		"tr.target-b.mycdn.example.net": {CZCount: 1, GeoCount: 1, FedCount: 1},
+		"tr.target-a.mycdn.example.net": {MissCount: 1},
+		"tr.steer.mycdn.example.net":    {CZCount: 1},
+	}
+	if len(actual.HTTPMap) != len(expected) {
+		t.Errorf("expected stats hosts %v, actual %v", expected, actual.HTTPMap)
+	}
+	for host, stat := range expected {
+		if actual.HTTPMap[host] != stat {
+			t.Errorf("expected host '%v' stats %+v, actual %+v", host, stat, actual.HTTPMap[host])
+		}
+	}
+	if actual.TotalHTTPCount != 5 || actual.TotalDSMissCount != 1 {
+		t.Errorf("expected 5 requests and 1 delivery service miss, actual %v %v", actual.TotalHTTPCount, actual.TotalDSMissCount)
+	}
+}
+
+func TestProtocol(t *testing.T) {
+	rt := testRouter(t)
+
+	serveProtocolTest := func(host string, secure bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "http://"+host+"/some/path", nil)
+		r.RemoteAddr = "10.1.2.3:12345"
+		if secure {
+			r.TLS = &tls.ConnectionState{ServerName: host}
+		}
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		host             string
+		secure           bool
+		expectedCode     int
+		expectedLocation string
+	}{
+		{"tr.https-ds.mycdn.example.net", false, http.StatusFound, "https://edge-3.https-ds.mycdn.example/some/path"},
+		{"tr.https-ds.mycdn.example.net", true, http.StatusFound, "https://edge-3.https-ds.mycdn.example/some/path"},
+		{"tr.https-only-ds.mycdn.example.net", false, http.StatusServiceUnavailable, ""},
+		{"tr.https-only-ds.mycdn.example.net", true, http.StatusFound, "https://edge-3.https-only-ds.mycdn.example/some/path"},
+		{"tr.target-b.mycdn.example.net", false, http.StatusFound, "http://edge-1.target-b.mycdn.example/some/path"},
+		{"tr.target-b.mycdn.example.net", true, http.StatusServiceUnavailable, ""},
+	}
+	for _, test := range tests {
+		w := serveProtocolTest(test.host, test.secure)
+		if location := w.Header().Get("Location"); w.Code != test.expectedCode || location != test.expectedLocation {
+			t.Errorf("expected '%v' secure %v to return %v '%v', actual %v '%v'", test.host, test.secure, test.expectedCode, test.expectedLocation, w.Code, location)
+		}
+	}
+
+	// without its certificate, a delivery service isn't redirected to HTTPS.
+	rt.certsThs = sslkeys.NewThs()
+	if w := serveProtocolTest("tr.https-ds.mycdn.example.net", false); w.Header().Get("Location") != "http://edge-3.https-ds.mycdn.example/some/path" {
+		t.Errorf("expected delivery service without a certificate to redirect to HTTP, actual %v '%v'", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestGetCertificate(t *testing.T) {
+	rt := testRouter(t)
+	conn, _ := net.Pipe()
+	defer conn.Close()
+
+	if _, err := getCertificate(rt.certsThs, &tls.ClientHelloInfo{ServerName: "tr.https-ds.mycdn.example.net", Conn: conn}); err != nil {
+		t.Errorf("expected certificate for delivery service server name, actual error %v", err)
+	}
+	if _, err := getCertificate(rt.certsThs, &tls.ClientHelloInfo{ServerName: "tr.target-b.mycdn.example.net", Conn: conn}); err == nil {
+		t.Error("expected server name without a certificate to error")
+	}
+
+	certs, _ := sslkeys.Create([]tc.CDNSSLKeys{{DeliveryService: "target-b", Hostname: "*.target-b.mycdn.example.net", Certificate: testCertificate(t, "*.target-b.mycdn.example.net")}})
+	rt.certsThs.Set(certs)
+	if _, err := getCertificate(rt.certsThs, &tls.ClientHelloInfo{ServerName: "tr.target-b.mycdn.example.net", Conn: conn}); err != nil {
+		t.Errorf("expected new certificates to be used without restarting, actual error %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package sslkeys
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// Certificates are the Delivery Service certificates, by their hostnames, from the Traffic Ops CDN SSL keys data.
+type Certificates struct {
+	hosts map[string]*tls.Certificate
+	dses  map[tc.DeliveryServiceName]struct{}
+}
+
+// Create creates the Certificates of the given Traffic Ops CDN SSL keys data, whose certificates and keys are base64 encoded PEM.
+// Invalid certificates are skipped, and their errors returned.
+func Create(keys []tc.CDNSSLKeys) (*Certificates, []error) {
+	c := &Certificates{hosts: map[string]*tls.Certificate{}, dses: map[tc.DeliveryServiceName]struct{}{}}
+	errs := []error{}
+	for _, key := range keys {
+		cert, err := parse(key.Certificate)
+		if err != nil {
+			errs = append(errs, errors.New("delivery service '"+key.DeliveryService+"' hostname '"+key.Hostname+"': "+err.Error()))
+			continue
+		}
+		c.hosts[strings.ToLower(key.Hostname)] = cert
+		c.dses[tc.DeliveryServiceName(key.DeliveryService)] = struct{}{}
+	}
+	return c, errs
+}
+
+// parse parses the given base64 encoded PEM certificate chain and key.
+func parse(cert tc.CDNSSLKeysCertificate) (*tls.Certificate, error) {
+	crt, err := decode(cert.Crt)
+	if err != nil {
+		return nil, errors.New("decoding certificate: " + err.Error())
+	}
+	key, err := decode(cert.Key)
+	if err != nil {
+		return nil, errors.New("decoding key: " + err.Error())
+	}
+	tlsCert, err := tls.X509KeyPair(crt, key)
+	if err != nil {
+		return nil, errors.New("parsing certificate and key: " + err.Error())
+	}
+	return &tlsCert, nil
+}
+
+// decode decodes base64 which may be split into lines, like Traffic Router.
+func decode(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
+
+// Get returns the certificate for the given TLS server name, which is the certificate with that hostname,
+// or else the wildcard hostname of its parent domain, and false if there's none. A nil Certificates has none.
+func (c *Certificates) Get(serverName string) (*tls.Certificate, bool) {
+	if c == nil {
+		return nil, false
+	}
+	serverName = strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if cert, ok := c.hosts[serverName]; ok {
+		return cert, true
+	}
+	if i := strings.Index(serverName, "."); i >= 0 {
+		if cert, ok := c.hosts["*"+serverName[i:]]; ok {
+			return cert, true
+		}
+	}
+	return nil, false
+}
+
+// HasDeliveryService returns whether the given Delivery Service has a certificate. A nil Certificates has none.
+func (c *Certificates) HasDeliveryService(ds tc.DeliveryServiceName) bool {
+	if c == nil {
+		return false
+	}
+	_, ok := c.dses[ds]
+	return ok
+}
@@ -0,0 +1,114 @@
+package sslkeys
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// testCertificate returns a self-signed certificate and key for the given hostname, base64 encoded like the Traffic Ops CDN SSL keys.
+func testCertificate(t *testing.T, hostname string) tc.CDNSSLKeysCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: hostname},
+		DNSNames:     []string{hostname},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	crtDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshalling key: %v", err)
+	}
+	return tc.CDNSSLKeysCertificate{
+		Crt: base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crtDER})),
+		Key: base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+	}
+}
+
+func commonName(cert *tls.Certificate) string {
+	x509Cert, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return ""
+	}
+	return x509Cert.Subject.CommonName
+}
+
+func TestGet(t *testing.T) {
+	wildcard := testCertificate(t, "*.https-ds.mycdn.example.net")
+	// Traffic Router accepts base64 split into lines.
+	wildcard.Crt = wildcard.Crt[:64] + "\n" + wildcard.Crt[64:]
+	certs, errs := Create([]tc.CDNSSLKeys{
+		{DeliveryService: "https-ds", Hostname: "*.https-ds.mycdn.example.net", Certificate: wildcard},
+		{DeliveryService: "dns-ds", Hostname: "Edge.DNS-ds.mycdn.example.net", Certificate: testCertificate(t, "edge.dns-ds.mycdn.example.net")},
+		{DeliveryService: "invalid-ds", Hostname: "*.invalid-ds.mycdn.example.net", Certificate: tc.CDNSSLKeysCertificate{Crt: "not base64", Key: "bm90IGEga2V5"}},
+	})
+	if len(errs) != 1 {
+		t.Errorf("expected the invalid certificate to error, actual %v", errs)
+	}
+
+	tests := []struct {
+		serverName string
+		expected   string
+	}{
+		{"tr.https-ds.mycdn.example.net", "*.https-ds.mycdn.example.net"},
+		{"TR.HTTPS-DS.mycdn.example.net.", "*.https-ds.mycdn.example.net"},
+		{"edge.dns-ds.mycdn.example.net", "edge.dns-ds.mycdn.example.net"},
+		{"other.dns-ds.mycdn.example.net", ""},
+		{"a.tr.https-ds.mycdn.example.net", ""},
+		{"tr.invalid-ds.mycdn.example.net", ""},
+	}
+	for _, test := range tests {
+		actual := ""
+		if cert, ok := certs.Get(test.serverName); ok {
+			actual = commonName(cert)
+		}
+		if actual != test.expected {
+			t.Errorf("expected server name '%v' to get certificate '%v', actual '%v'", test.serverName, test.expected, actual)
+		}
+	}
+
+	if !certs.HasDeliveryService("https-ds") || certs.HasDeliveryService("invalid-ds") {
+		t.Error("expected only delivery services with valid certificates to have certificates")
+	}
+	if _, ok := (*Certificates)(nil).Get("tr.https-ds.mycdn.example.net"); ok || (*Certificates)(nil).HasDeliveryService("https-ds") {
+		t.Error("expected nil certificates to have no certificates")
+	}
+}
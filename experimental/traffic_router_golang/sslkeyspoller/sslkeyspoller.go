@@ -0,0 +1,85 @@
+package sslkeyspoller
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/fetch"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/sslkeys"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// DefaultInterval is the interval to poll the SSL keys, if the given interval is 0.
+const DefaultInterval = time.Minute
+
+// Start polls the SSL keys with the given fetcher every interval, and returns the threadsafe Certificates, which are nil until the keys are first fetched.
+// The fetched data must be a Traffic Ops CDN SSL keys API response. New certificates are used by new connections, without restarting the server.
+func Start(fetcher fetch.Fetcher, interval time.Duration) sslkeys.Ths {
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	thsCerts := sslkeys.NewThs()
+	prevBts := []byte{}
+
+	get := func() {
+		newBts, err := fetcher.Fetch()
+		if err != nil {
+			fmt.Println("ERROR SSL keys read error: " + err.Error())
+			return
+		}
+
+		if bytes.Equal(newBts, prevBts) {
+			fmt.Println("INFO SSL keys unchanged.")
+			return
+		}
+
+		fmt.Println("INFO SSL keys changed.")
+		resp := tc.CDNSSLKeysResponse{}
+		if err := json.Unmarshal(newBts, &resp); err != nil {
+			fmt.Println("ERROR SSL keys unmarshalling: " + err.Error())
+			return
+		}
+
+		certs, errs := sslkeys.Create(resp.Response)
+		for _, err := range errs {
+			fmt.Println("ERROR not using invalid new SSL key: " + err.Error())
+		}
+
+		thsCerts.Set(certs)
+		prevBts = newBts
+		fmt.Println("INFO SSL keys set new")
+	}
+
+	get()
+
+	go func() {
+		for {
+			time.Sleep(interval)
+			get()
+		}
+	}()
+	return thsCerts
+}
@@ -0,0 +1,146 @@
+package stats
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// ResultType is the result of routing a request, the same as Traffic Router's.
+type ResultType int
+
+const (
+	ResultError ResultType = iota
+	ResultCZ
+	ResultGeo
+	ResultMiss
+	ResultStaticRoute
+	ResultDSRedirect
+	// ResultDSMiss is a request which didn't match a Delivery Service. Like Traffic Router, it's only counted in the total DS miss count.
+	ResultDSMiss
+	ResultFed
+	// ResultGeoRedirect is a geo-limited request redirected to the Delivery Service's geo-limit redirect URL. Like Traffic Router, it has no tally.
+	ResultGeoRedirect
+	// ResultDeepCZ is a request routed to a deep cache by the deep coverage zone.
+	ResultDeepCZ
+)
+
+// Stats are the counts of the routing results, by request host. They're safe for concurrent use, and never lock in the request path.
+type Stats struct {
+	httpCount   uint64
+	httpTimeMS  uint64
+	dsMissCount uint64
+	startTime   time.Time
+	http        *sync.Map // map[string]*tallies
+}
+
+// tallies are the counts of each result type of a host, which are only accessed atomically.
+type tallies struct {
+	cz          uint64
+	geo         uint64
+	deepCZ      uint64
+	miss        uint64
+	dsr         uint64
+	err         uint64
+	staticRoute uint64
+	fed         uint64
+}
+
+// New returns new Stats, with the app start time of now.
+func New() *Stats {
+	return &Stats{startTime: time.Now(), http: &sync.Map{}}
+}
+
+// SaveHTTP counts the result of an HTTP request for the given host, which took the given duration to route.
+func (s *Stats) SaveHTTP(host string, result ResultType, duration time.Duration) {
+	if result == ResultDSMiss {
+		atomic.AddUint64(&s.dsMissCount, 1)
+		return
+	}
+	atomic.AddUint64(&s.httpCount, 1)
+	atomic.AddUint64(&s.httpTimeMS, uint64(duration/time.Millisecond))
+
+	host = strings.ToLower(host)
+	t, ok := s.http.Load(host)
+	if !ok {
+		t, _ = s.http.LoadOrStore(host, &tallies{})
+	}
+	t.(*tallies).inc(result)
+}
+
+func (t *tallies) inc(result ResultType) {
+	switch result {
+	case ResultError:
+		atomic.AddUint64(&t.err, 1)
+	case ResultCZ:
+		atomic.AddUint64(&t.cz, 1)
+	case ResultGeo:
+		atomic.AddUint64(&t.geo, 1)
+	case ResultDeepCZ:
+		atomic.AddUint64(&t.deepCZ, 1)
+	case ResultMiss:
+		atomic.AddUint64(&t.miss, 1)
+	case ResultDSRedirect:
+		atomic.AddUint64(&t.dsr, 1)
+	case ResultStaticRoute:
+		atomic.AddUint64(&t.staticRoute, 1)
+	case ResultFed:
+		atomic.AddUint64(&t.fed, 1)
+	}
+}
+
+func (t *tallies) stat() tc.CRSStatsStat {
+	return tc.CRSStatsStat{
+		CZCount:          atomic.LoadUint64(&t.cz),
+		GeoCount:         atomic.LoadUint64(&t.geo),
+		DeepCZCount:      atomic.LoadUint64(&t.deepCZ),
+		MissCount:        atomic.LoadUint64(&t.miss),
+		DSRCount:         atomic.LoadUint64(&t.dsr),
+		ErrCount:         atomic.LoadUint64(&t.err),
+		StaticRouteCount: atomic.LoadUint64(&t.staticRoute),
+		FedCount:         atomic.LoadUint64(&t.fed),
+	}
+}
+
+// Get returns the stats, in the format of Traffic Router's stats endpoint. Counts saved concurrently may or may not be included.
+func (s *Stats) Get() tc.CRSStatsStats {
+	httpMap := map[string]tc.CRSStatsStat{}
+	s.http.Range(func(host, t interface{}) bool {
+		httpMap[host.(string)] = t.(*tallies).stat()
+		return true
+	})
+	stats := tc.CRSStatsStats{
+		DNSMap:           map[string]tc.CRSStatsStat{},
+		HTTPMap:          httpMap,
+		TotalHTTPCount:   atomic.LoadUint64(&s.httpCount),
+		TotalDSMissCount: atomic.LoadUint64(&s.dsMissCount),
+		AppStartTime:     uint64(s.startTime.UnixNano() / int64(time.Millisecond)),
+	}
+	if stats.TotalHTTPCount > 0 {
+		stats.AverageHttpTime = atomic.LoadUint64(&s.httpTimeMS) / stats.TotalHTTPCount
+	}
+	return stats
+}
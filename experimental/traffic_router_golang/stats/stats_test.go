@@ -0,0 +1,82 @@
+package stats
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+func TestSaveHTTP(t *testing.T) {
+	s := New()
+
+	const goroutines = 10
+	const requests = 100
+	wg := sync.WaitGroup{}
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < requests; j++ {
+				s.SaveHTTP("tr.ds.mycdn.example.net", ResultCZ, 2*time.Millisecond)
+				s.Get()
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.SaveHTTP("TR.DS.mycdn.example.net", ResultGeo, 0)
+	s.SaveHTTP("tr.ds.mycdn.example.net", ResultDeepCZ, 0)
+	s.SaveHTTP("tr.ds.mycdn.example.net", ResultMiss, 0)
+	s.SaveHTTP("tr.ds.mycdn.example.net", ResultError, 0)
+	s.SaveHTTP("tr.other.mycdn.example.net", ResultFed, 0)
+	s.SaveHTTP("tr.other.mycdn.example.net", ResultGeoRedirect, 0)
+	s.SaveHTTP("tr.nope.mycdn.example.net", ResultDSMiss, 0)
+
+	stats := s.Get()
+	expected := map[string]tc.CRSStatsStat{
+		"tr.ds.mycdn.example.net":    {CZCount: goroutines * requests, GeoCount: 1, DeepCZCount: 1, MissCount: 1, ErrCount: 1},
+		"tr.other.mycdn.example.net": {FedCount: 1},
+	}
+	if len(stats.HTTPMap) != len(expected) {
+		t.Errorf("expected hosts %v, actual %v", expected, stats.HTTPMap)
+	}
+	for host, stat := range expected {
+		if stats.HTTPMap[host] != stat {
+			t.Errorf("expected host '%v' stats %+v, actual %+v", host, stat, stats.HTTPMap[host])
+		}
+	}
+	if stats.TotalHTTPCount != goroutines*requests+6 {
+		t.Errorf("expected total HTTP count %v, actual %v", goroutines*requests+6, stats.TotalHTTPCount)
+	}
+	if stats.TotalDSMissCount != 1 {
+		t.Errorf("expected DS misses to only be counted in the total DS miss count, actual %v", stats.TotalDSMissCount)
+	}
+	if stats.AverageHttpTime != 1 {
+		t.Errorf("expected average HTTP time 1ms, actual %v", stats.AverageHttpTime)
+	}
+	if stats.AppStartTime == 0 || stats.DNSMap == nil {
+		t.Errorf("expected app start time and DNS map, actual %+v", stats)
+	}
+}
@@ -0,0 +1,216 @@
+package steering
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"sort"
+
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/consistenthash"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// MeanEarthRadiusKm is the radius used to calculate distances between locations, the same as Traffic Router's.
+const MeanEarthRadiusKm = 6371.0
+
+// Steerings are the steering Delivery Services, from the Traffic Ops steering data.
+type Steerings struct {
+	steerings map[tc.DeliveryServiceName]Steering
+}
+
+// Steering is a STEERING or CLIENT_STEERING Delivery Service.
+type Steering struct {
+	ClientSteering bool
+	Targets        []Target
+	filters        []filter
+}
+
+// Target is a target Delivery Service of a steering Delivery Service.
+type Target struct {
+	DeliveryService tc.DeliveryServiceName
+	Order           int
+	GeoOrder        int
+	// Pos is the origin location of the target, or nil if it has none.
+	Pos    *tc.CRConfigLatitudeLongitude
+	hashes []float64
+}
+
+// filter steers requests whose paths match the regex to the target Delivery Service.
+type filter struct {
+	deliveryService tc.DeliveryServiceName
+	regex           *regexp.Regexp
+}
+
+// Create creates the Steerings of the given Traffic Ops steering data.
+func Create(steerings []tc.Steering) (*Steerings, error) {
+	s := &Steerings{steerings: make(map[tc.DeliveryServiceName]Steering, len(steerings))}
+	for _, tcSteering := range steerings {
+		steering := Steering{ClientSteering: tcSteering.ClientSteering}
+		for _, tcTarget := range tcSteering.Targets {
+			target := Target{
+				DeliveryService: tcTarget.DeliveryService,
+				Order:           int(tcTarget.Order),
+				// like Traffic Router, the weight is the number of hashes, and unweighted targets are ordered by their order.
+				hashes: consistenthash.WeightHashValues(string(tcTarget.DeliveryService), int(tcTarget.Weight)),
+			}
+			if tcTarget.GeoOrder != nil {
+				target.GeoOrder = *tcTarget.GeoOrder
+			}
+			// Traffic Router considers a latitude or longitude of 0 to be no location.
+			if tcTarget.Latitude != nil && tcTarget.Longitude != nil && *tcTarget.Latitude != 0 && *tcTarget.Longitude != 0 {
+				target.Pos = &tc.CRConfigLatitudeLongitude{Lat: *tcTarget.Latitude, Lon: *tcTarget.Longitude}
+			}
+			steering.Targets = append(steering.Targets, target)
+		}
+		for _, tcFilter := range tcSteering.Filters {
+			// Traffic Router filters match whole paths.
+			regex, err := regexp.Compile(`^(?:` + tcFilter.Pattern + `)$`)
+			if err != nil {
+				return nil, errors.New("steering delivery service '" + string(tcSteering.DeliveryService) + "' filter pattern '" + tcFilter.Pattern + "': " + err.Error())
+			}
+			steering.filters = append(steering.filters, filter{deliveryService: tcFilter.DeliveryService, regex: regex})
+		}
+		s.steerings[tcSteering.DeliveryService] = steering
+	}
+	return s, nil
+}
+
+// Get returns the Steering of the given Delivery Service, and false if it isn't a steering Delivery Service. A nil Steerings has none.
+func (s *Steerings) Get(ds tc.DeliveryServiceName) (Steering, bool) {
+	if s == nil {
+		return Steering{}, false
+	}
+	steering, ok := s.steerings[ds]
+	return steering, ok
+}
+
+// HasTarget returns whether the given Delivery Service is a target of the steering Delivery Service.
+func (s Steering) HasTarget(ds tc.DeliveryServiceName) bool {
+	for _, target := range s.Targets {
+		if target.DeliveryService == ds {
+			return true
+		}
+	}
+	return false
+}
+
+// Bypass returns the target of the first filter matching the given request path, and false if none match.
+func (s Steering) Bypass(path string) (tc.DeliveryServiceName, bool) {
+	for _, filter := range s.filters {
+		if filter.regex.MatchString(path) && s.HasTarget(filter.deliveryService) {
+			return filter.deliveryService, true
+		}
+	}
+	return "", false
+}
+
+// OrderTargets returns the targets in the order to steer a request with the given string to hash to them, the same as Traffic Router.
+func (s Steering) OrderTargets(pathToHash string) []Target {
+	hashes := make([][]float64, len(s.Targets))
+	orders := make([]int, len(s.Targets))
+	for i, target := range s.Targets {
+		hashes[i] = target.hashes
+		orders[i] = target.Order
+	}
+	targets := make([]Target, 0, len(s.Targets))
+	for _, i := range consistenthash.OrderHashables(hashes, orders, pathToHash) {
+		targets = append(targets, s.Targets[i])
+	}
+	return targets
+}
+
+// Result is a target a client steering request is steered to, and the cache selected for it.
+type Result struct {
+	Target   Target
+	Cache    tc.CacheName
+	CachePos tc.CRConfigLatitudeLongitude
+	URL      string
+}
+
+// SortByGeo sorts the given results by the distance from the client, through their cache, to their target's origin,
+// and then by their targets' order, the same as Traffic Router. Results are unchanged if no target has a location.
+func SortByGeo(results []Result, clientPos tc.CRConfigLatitudeLongitude) {
+	hasPos := false
+	for _, result := range results {
+		if result.Target.Pos != nil {
+			hasPos = true
+			break
+		}
+	}
+	if !hasPos {
+		return
+	}
+	sort.SliceStable(results, func(i, j int) bool { return geoCompare(results[i], results[j], clientPos) < 0 })
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Target.Order < results[j].Target.Order })
+}
+
+// geoCompare compares results like Traffic Router's SteeringGeolocationComparator.
+func geoCompare(a Result, b Result, clientPos tc.CRConfigLatitudeLongitude) int {
+	// targets without origin locations are farther than those with them.
+	if a.Target.Pos == nil && b.Target.Pos == nil {
+		return 0
+	}
+	if b.Target.Pos == nil {
+		return -1
+	}
+	if a.Target.Pos == nil {
+		return 1
+	}
+
+	if samePos(a.CachePos, b.CachePos) && samePos(*a.Target.Pos, *b.Target.Pos) {
+		return compareFloat(float64(a.Target.GeoOrder), float64(b.Target.GeoOrder))
+	}
+
+	clientToCacheA := Distance(clientPos, a.CachePos)
+	clientToCacheB := Distance(clientPos, b.CachePos)
+	totalA := clientToCacheA + Distance(a.CachePos, *a.Target.Pos)
+	totalB := clientToCacheB + Distance(b.CachePos, *b.Target.Pos)
+	if totalA != totalB {
+		return compareFloat(totalA, totalB)
+	}
+	return compareFloat(clientToCacheA, clientToCacheB)
+}
+
+func samePos(a tc.CRConfigLatitudeLongitude, b tc.CRConfigLatitudeLongitude) bool {
+	return a.Lat == b.Lat && a.Lon == b.Lon
+}
+
+func compareFloat(a float64, b float64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// Distance returns the great-circle distance between the given locations in kilometers, by the haversine formula, the same as Traffic Router.
+func Distance(a tc.CRConfigLatitudeLongitude, b tc.CRConfigLatitudeLongitude) float64 {
+	toRadians := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRadians(a.Lat - b.Lat)
+	dLon := toRadians(a.Lon - b.Lon)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRadians(a.Lat))*math.Cos(toRadians(b.Lat))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return MeanEarthRadiusKm * 2 * math.Atan2(math.Sqrt(h), math.Sqrt(1-h))
+}
@@ -0,0 +1,141 @@
+package steering
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+const testSteering = `[
+	{
+		"deliveryService": "steering-ds",
+		"clientSteering": false,
+		"targets": [
+			{"deliveryService": "last", "order": 5, "weight": 0},
+			{"deliveryService": "second", "order": -1, "weight": 0},
+			{"deliveryService": "first", "order": -2, "weight": 0},
+			{"deliveryService": "weighted", "order": 0, "weight": 10},
+			{"deliveryService": "after", "order": 1, "weight": 0}
+		],
+		"filters": [
+			{"deliveryService": "after", "pattern": "/live/.*"},
+			{"deliveryService": "not-a-target", "pattern": ".*"}
+		]
+	},
+	{
+		"deliveryService": "client-steering-ds",
+		"clientSteering": true,
+		"targets": [
+			{"deliveryService": "east", "order": 0, "weight": 100, "latitude": 40, "longitude": -75},
+			{"deliveryService": "west", "order": 0, "weight": 100, "latitude": 37, "longitude": -122}
+		],
+		"filters": []
+	}
+]`
+
+func testSteerings(t *testing.T) *Steerings {
+	tcSteerings := []tc.Steering{}
+	if err := json.Unmarshal([]byte(testSteering), &tcSteerings); err != nil {
+		t.Fatalf("unmarshalling test steering: %v", err)
+	}
+	s, err := Create(tcSteerings)
+	if err != nil {
+		t.Fatalf("creating steerings: %v", err)
+	}
+	return s
+}
+
+func targetNames(targets []Target) []tc.DeliveryServiceName {
+	names := []tc.DeliveryServiceName{}
+	for _, target := range targets {
+		names = append(names, target.DeliveryService)
+	}
+	return names
+}
+
+func TestOrderTargets(t *testing.T) {
+	s := testSteerings(t)
+	steering, ok := s.Get("steering-ds")
+	if !ok || steering.ClientSteering {
+		t.Fatalf("expected steering-ds to be steering, actual %v %+v", ok, steering)
+	}
+	if _, ok := s.Get("not-steering"); ok {
+		t.Error("expected unknown delivery service to not be steering")
+	}
+	if _, ok := (*Steerings)(nil).Get("steering-ds"); ok {
+		t.Error("expected nil steerings to have no steering")
+	}
+
+	expected := []tc.DeliveryServiceName{"first", "second", "weighted", "after", "last"}
+	for _, path := range []string{"/some/path", "/another/path"} {
+		if actual := targetNames(steering.OrderTargets(path)); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("expected targets for '%v' ordered %v, actual %v", path, expected, actual)
+		}
+	}
+}
+
+func TestBypass(t *testing.T) {
+	steering, _ := testSteerings(t).Get("steering-ds")
+	if target, ok := steering.Bypass("/live/stream.m3u8"); !ok || target != "after" {
+		t.Errorf("expected filter to steer to 'after', actual '%v' %v", target, ok)
+	}
+	if target, ok := steering.Bypass("/vod/live/stream.m3u8"); ok {
+		t.Errorf("expected filters to match whole paths, and not steer to non-targets, actual '%v'", target)
+	}
+
+	if _, err := Create([]tc.Steering{{DeliveryService: "ds", Filters: []tc.SteeringFilter{{DeliveryService: "ds", Pattern: "("}}}}); err == nil {
+		t.Error("expected invalid filter pattern to error")
+	}
+}
+
+func TestSortByGeo(t *testing.T) {
+	steering, _ := testSteerings(t).Get("client-steering-ds")
+	east := steering.Targets[0]
+	west := steering.Targets[1]
+	eastCache := tc.CRConfigLatitudeLongitude{Lat: 40, Lon: -75}
+	westCache := tc.CRConfigLatitudeLongitude{Lat: 37, Lon: -122}
+
+	results := []Result{{Target: east, Cache: "edge-east", CachePos: eastCache}, {Target: west, Cache: "edge-west", CachePos: westCache}}
+	SortByGeo(results, tc.CRConfigLatitudeLongitude{Lat: 38, Lon: -121})
+	if results[0].Cache != "edge-west" {
+		t.Errorf("expected the target nearest the client first, actual %+v", results)
+	}
+	SortByGeo(results, tc.CRConfigLatitudeLongitude{Lat: 41, Lon: -74})
+	if results[0].Cache != "edge-east" {
+		t.Errorf("expected the target nearest the client first, actual %+v", results)
+	}
+
+	results[0].Target.Pos = nil
+	SortByGeo(results, tc.CRConfigLatitudeLongitude{Lat: 41, Lon: -74})
+	if results[0].Cache != "edge-west" {
+		t.Errorf("expected targets without locations last, actual %+v", results)
+	}
+
+	// New York to Los Angeles is about 3936km by the haversine formula.
+	if d := Distance(tc.CRConfigLatitudeLongitude{Lat: 40.7128, Lon: -74.0060}, tc.CRConfigLatitudeLongitude{Lat: 34.0522, Lon: -118.2437}); math.Abs(d-3936) > 5 {
+		t.Errorf("expected New York to Los Angeles about 3936km, actual %v", d)
+	}
+}
@@ -0,0 +1,85 @@
+package steeringpoller
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/fetch"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/steering"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/toutil"
+)
+
+// DefaultInterval is the interval to poll the steering data, if the given interval is 0.
+const DefaultInterval = time.Minute
+
+// Start polls the steering data with the given fetcher every interval, and returns the threadsafe Steerings, which are nil until the data is first fetched.
+// The fetched data must be a Traffic Ops steering API response.
+func Start(fetcher fetch.Fetcher, interval time.Duration) steering.Ths {
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	thsSteerings := steering.NewThs()
+	prevBts := []byte{}
+
+	get := func() {
+		newBts, err := fetcher.Fetch()
+		if err != nil {
+			fmt.Println("ERROR steering read error: " + err.Error())
+			return
+		}
+
+		if bytes.Equal(newBts, prevBts) {
+			fmt.Println("INFO steering unchanged.")
+			return
+		}
+
+		fmt.Println("INFO steering changed.")
+		resp := toutil.SteeringResponse{}
+		if err := json.Unmarshal(newBts, &resp); err != nil {
+			fmt.Println("ERROR steering unmarshalling: " + err.Error())
+			return
+		}
+
+		steerings, err := steering.Create(resp.Response)
+		if err != nil {
+			fmt.Println("ERROR not using invalid new steering: " + err.Error())
+			return
+		}
+
+		thsSteerings.Set(steerings)
+		prevBts = newBts
+		fmt.Println("INFO steering set new")
+	}
+
+	get()
+
+	go func() {
+		for {
+			time.Sleep(interval)
+			get()
+		}
+	}()
+	return thsSteerings
+}
@@ -21,10 +21,13 @@ package toutil
  */
 
 import (
+	"encoding/json"
 	"errors"
 	"net/url"
 	"strconv"
 
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/fetch"
+
 	"github.com/apache/trafficcontrol/lib/go-tc"
 	client "github.com/apache/trafficcontrol/traffic_ops/v3-client"
 )
@@ -68,3 +71,78 @@ func GetMonitorURIs(toc *client.Session, cdn string) ([]string, error) {
 	}
 	return monitors, nil
 }
+
+// SteeringResponse is the Traffic Ops steering API response, which is also the format of steering files.
+type SteeringResponse struct {
+	Response []tc.Steering `json:"response"`
+}
+
+type steeringFetcher struct {
+	toc *client.Session
+}
+
+// NewSteeringFetcher returns a Fetcher of the steering data of all Delivery Services from Traffic Ops, as a SteeringResponse.
+func NewSteeringFetcher(toc *client.Session) fetch.Fetcher {
+	return steeringFetcher{toc: toc}
+}
+
+func (f steeringFetcher) Fetch() ([]byte, error) {
+	steerings, _, err := f.toc.SteeringWithHdr(nil)
+	if err != nil {
+		return nil, errors.New("getting steering from Traffic Ops: " + err.Error())
+	}
+	bts, err := json.Marshal(SteeringResponse{Response: steerings})
+	if err != nil {
+		return nil, errors.New("marshalling steering: " + err.Error())
+	}
+	return bts, nil
+}
+
+// FederationsResponse is the Traffic Ops federations/all API response, which is also the format of federations files.
+type FederationsResponse struct {
+	Response []tc.AllDeliveryServiceFederationsMapping `json:"response"`
+}
+
+type federationsFetcher struct {
+	toc *client.Session
+	cdn string
+}
+
+// NewFederationsFetcher returns a Fetcher of the federation mappings of all Delivery Services in the given CDN from Traffic Ops, as a FederationsResponse.
+func NewFederationsFetcher(toc *client.Session, cdn string) fetch.Fetcher {
+	return federationsFetcher{toc: toc, cdn: cdn}
+}
+
+func (f federationsFetcher) Fetch() ([]byte, error) {
+	feds, _, err := f.toc.AllFederationsForCDNWithHdr(f.cdn, nil)
+	if err != nil {
+		return nil, errors.New("getting federations from Traffic Ops: " + err.Error())
+	}
+	bts, err := json.Marshal(FederationsResponse{Response: feds})
+	if err != nil {
+		return nil, errors.New("marshalling federations: " + err.Error())
+	}
+	return bts, nil
+}
+
+type sslKeysFetcher struct {
+	toc *client.Session
+	cdn string
+}
+
+// NewSSLKeysFetcher returns a Fetcher of the Delivery Service SSL keys of the given CDN from Traffic Ops, as a tc.CDNSSLKeysResponse.
+func NewSSLKeysFetcher(toc *client.Session, cdn string) fetch.Fetcher {
+	return sslKeysFetcher{toc: toc, cdn: cdn}
+}
+
+func (f sslKeysFetcher) Fetch() ([]byte, error) {
+	keys, _, err := f.toc.GetCDNSSLKeysWithHdr(f.cdn, nil)
+	if err != nil {
+		return nil, errors.New("getting SSL keys from Traffic Ops: " + err.Error())
+	}
+	bts, err := json.Marshal(tc.CDNSSLKeysResponse{Response: keys})
+	if err != nil {
+		return nil, errors.New("marshalling SSL keys: " + err.Error())
+	}
+	return bts, nil
+}
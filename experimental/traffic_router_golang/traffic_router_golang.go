@@ -27,13 +27,21 @@ import (
 	"os"
 	"time"
 
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/apisrvr"
 	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/availableservers"
 	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/config"
 	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/coveragezone"
 	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/crconfigpoller"
 	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/crstatespoller"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/deepcoveragezonepoller"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/dnssrvr"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/federationpoller"
 	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/fetch"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/geolocationpoller"
 	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/httpsrvr"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/sslkeyspoller"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/stats"
+	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/steeringpoller"
 	"github.com/apache/trafficcontrol/experimental/traffic_router_golang/toutil"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
@@ -106,7 +114,7 @@ func main() {
 	// crconfigFetcher := fetch.NewFile("./crconfig.json")
 	// crstatesFetcher := fetch.NewFile("./crstates.json")
 
-	thsCRConfig, thsCRConfigRegexes, thsCGSearcher, thsNextCacher, err := crconfigpoller.Start(crconfigFetcher, time.Duration(cfg.CRConfigInterval))
+	thsCRConfig, thsCRConfigRegexes, thsCGSearcher, thsNextCacher, thsConsistentHasher, thsDNSZones, err := crconfigpoller.Start(crconfigFetcher, time.Duration(cfg.CRConfigInterval))
 	if err != nil {
 		fmt.Println("Could not get initial CRConfig: ", err)
 	}
@@ -116,7 +124,37 @@ func main() {
 		fmt.Println("Could not get initial CRStates from: ", err)
 	}
 
-	httpsrvr.Start(thsCRConfigRegexes, availableServers, thsCGSearcher, thsNextCacher, cz, cfg.Port)
+	thsGeolocation := geolocationpoller.Start(cfg.GeolocationFile, thsCRConfig, time.Duration(cfg.GeolocationInterval), time.Duration(cfg.ReqTimeout), UserAgent)
+
+	thsDeepCoverageZone := deepcoveragezonepoller.Start(cfg.DeepCoverageZoneFile, thsCRConfig, time.Duration(cfg.DeepCoverageZoneInterval), time.Duration(cfg.ReqTimeout), UserAgent)
+
+	steeringFetcher := toutil.NewSteeringFetcher(toClient)
+	if cfg.SteeringFile != "" {
+		steeringFetcher = fetch.NewFile(cfg.SteeringFile)
+	}
+	thsSteerings := steeringpoller.Start(steeringFetcher, time.Duration(cfg.SteeringInterval))
+
+	federationsFetcher := toutil.NewFederationsFetcher(toClient, cfg.CDN)
+	if cfg.FederationsFile != "" {
+		federationsFetcher = fetch.NewFile(cfg.FederationsFile)
+	}
+	thsFederations := federationpoller.Start(federationsFetcher, time.Duration(cfg.FederationsInterval))
+
+	sslKeysFetcher := toutil.NewSSLKeysFetcher(toClient, cfg.CDN)
+	if cfg.SSLKeysFile != "" {
+		sslKeysFetcher = fetch.NewFile(cfg.SSLKeysFile)
+	}
+	thsCertificates := sslkeyspoller.Start(sslKeysFetcher, time.Duration(cfg.SSLKeysInterval))
+
+	routingStats := stats.New()
+
+	httpsrvr.Start(thsCRConfig, thsCRConfigRegexes, availableServers, thsCGSearcher, thsConsistentHasher, cz, thsGeolocation, thsDeepCoverageZone, thsSteerings, thsFederations, thsCertificates, routingStats, cfg.Port, cfg.HTTPSPort)
+	if cfg.APIPort != 0 {
+		apisrvr.Start(thsCRConfig, availableServers, thsCGSearcher, thsConsistentHasher, cz, thsCRStates, routingStats, Version, cfg.APIPort)
+	}
+	if cfg.DNSPort != 0 {
+		dnssrvr.Start(thsCRConfig, thsCRConfigRegexes, thsDNSZones, availableServers, thsCGSearcher, thsNextCacher, cz, thsGeolocation, thsFederations, cfg.DNSPort)
+	}
 
 	// debug
 	for {
@@ -40,6 +40,7 @@ require (
 	github.com/go-ozzo/ozzo-validation v3.0.3-0.20180119232150-44af65fe9adf+incompatible
 	github.com/go-sql-driver/mysql v1.5.0 // indirect
 	github.com/gofrs/flock v0.7.2-0.20190320160742-5135e617513b
+	github.com/golang/snappy v0.0.4
 	github.com/google/uuid v1.1.2
 	github.com/hydrogen18/stoppableListener v0.0.0-20151210151943-dadc9ccc400c
 	github.com/influxdata/influxdb v1.1.1-0.20170104212736-6a94d200c826
@@ -57,6 +58,7 @@ require (
 	github.com/ogier/pflag v0.0.2-0.20201025181535-73e519546fc0
 	github.com/onsi/ginkgo v1.14.2
 	github.com/onsi/gomega v1.10.3
+	github.com/oschwald/maxminddb-golang v1.3.1
 	github.com/pborman/getopt/v2 v2.1.0
 	github.com/pkg/errors v0.8.2-0.20190227000051-27936f6d90f9
 	github.com/stretchr/testify v1.6.1 // indirect
@@ -15,6 +15,7 @@ package cache
 */
 
 import (
+	"io"
 	"net/http"
 	"os"
 	"strconv"
@@ -23,6 +24,8 @@ import (
 	"unsafe"
 
 	"github.com/apache/trafficcontrol/grove/cachedata"
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/parenthealth"
 	"github.com/apache/trafficcontrol/grove/plugin"
 
 	"github.com/apache/trafficcontrol/grove/remap"
@@ -69,6 +72,7 @@ type Handler struct {
 	httpConns       *web.ConnMap
 	httpsConns      *web.ConnMap
 	interfaceName   string
+	parentHealth    *parenthealth.Registry
 	requestID       uint64 // Atomic - DO NOT access or modify without atomic operations
 	// keyThrottlers     Throttlers
 	// nocacheThrottlers Throttlers
@@ -112,6 +116,7 @@ func NewHandler(
 	httpConns *web.ConnMap,
 	httpsConns *web.ConnMap,
 	interfaceName string,
+	parentHealth *parenthealth.Registry,
 ) *Handler {
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -134,6 +139,7 @@ func NewHandler(
 		httpConns:       httpConns,
 		httpsConns:      httpsConns,
 		interfaceName:   interfaceName,
+		parentHealth:    parentHealth,
 		// keyThrottlers:     NewThrottlers(keyLimit),
 		// nocacheThrottlers: NewThrottlers(nocacheLimit),
 	}
@@ -166,7 +172,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	reqID := atomic.AddUint64(&h.requestID, 1)
 	pluginContext := copyPluginContext(h.pluginContext) // must give each request a copy, because they can modify in parallel
 	srvrData := cachedata.SrvrData{Hostname: h.hostname, Port: h.port, Scheme: h.scheme}
-	onReqData := plugin.OnRequestData{W: w, R: r, Stats: h.stats, StatRules: h.remapper.StatRules(), HTTPConns: h.httpConns, HTTPSConns: h.httpsConns, InterfaceName: h.interfaceName, SrvrData: srvrData, RequestID: reqID}
+	onReqData := plugin.OnRequestData{W: w, R: r, Stats: h.stats, StatRules: h.remapper.StatRules(), HTTPConns: h.httpConns, HTTPSConns: h.httpsConns, InterfaceName: h.interfaceName, SrvrData: srvrData, RequestID: reqID, ParentHealth: h.parentHealth}
 	stop := h.plugins.OnRequest(h.remapper.PluginCfg(), pluginContext, onReqData)
 	if stop {
 		return
@@ -223,9 +229,14 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	connectionClose := h.connectionClose || remappingProducer.ConnectionClose()
 
-	beforeCacheLookUpData := plugin.BeforeCacheLookUpData{Req: r, DefaultCacheKey: remappingProducer.CacheKey(), CacheKeyOverrideFunc: remappingProducer.OverrideCacheKey}
+	beforeCacheLookUpData := plugin.BeforeCacheLookUpData{Req: r, DefaultCacheKey: remappingProducer.CacheKey(), CacheKeyOverrideFunc: remappingProducer.OverrideCacheKey, SliceFunc: remappingProducer.Slice}
 	h.plugins.OnBeforeCacheLookup(remappingProducer.PluginCfg(), pluginContext, beforeCacheLookUpData)
 
+	if blockSize := remappingProducer.SliceBlockSize(); blockSize > 0 && r.Method == http.MethodGet {
+		h.serveSliced(r, reqHeader, reqTime, reqCacheControl, remappingProducer, blockSize, responder, pluginContext, connectionClose, reqID)
+		return
+	}
+
 	cacheKey := remappingProducer.CacheKey()
 	retrier := NewRetrier(h, reqHeader, reqTime, reqCacheControl, remappingProducer, reqID)
 
@@ -254,6 +265,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		codePtr, hdrsPtr, bodyPtr := cacheObj.Code, cacheObj.RespHeaders, cacheObj.Body
 		responder.SetResponse(&codePtr, &hdrsPtr, &bodyPtr, connectionClose)
 		responder.OriginReqSuccess = true
+		responder.Negative = cacheObj.Negative()
 		responder.ProxyStr = cacheObj.ProxyURL
 		if reqHost != nil {
 			responder.ToFQDN = *reqHost
@@ -265,7 +277,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	reqHeaders := r.Header
-	canReuseStored := rfc.CanReuseStored(reqHeaders, cacheObj.RespHeaders, reqCacheControl, cacheObj.RespCacheControl, cacheObj.ReqHeaders, cacheObj.ReqRespTime, cacheObj.RespRespTime, h.strictRFC)
+	canReuseStored := cacheobj.ReuseStored(reqHeaders, reqCacheControl, cacheObj, h.strictRFC)
 
 	if canReuseStored != rfc.ReuseCan { // run the BeforeParentRequest hook for revalidations / ReuseCannot
 		beforeParentRequestData := plugin.BeforeParentRequestData{Req: r, RemapRule: remappingProducer.Name()}
@@ -307,6 +319,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	responder.SetResponse(&codePtr, &hdrsPtr, &bodyPtr, connectionClose)
 	responder.OriginReqSuccess = true
 	responder.Reuse = canReuseStored
+	responder.Negative = cacheObj.Negative()
 	responder.OriginCode = cacheObj.OriginCode
 	responder.OriginBytes = cacheObj.Size
 	responder.ProxyStr = cacheObj.ProxyURL
@@ -317,3 +330,42 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.plugins.OnBeforeRespond(remappingProducer.PluginCfg(), pluginContext, beforeRespData)
 	responder.Do()
 }
+
+// serveSliced serves a request for an object which is sliced, that is, fetched from the parent and cached in blocks. See Slicer.
+func (h *Handler) serveSliced(r *http.Request, reqHeader http.Header, reqTime time.Time, reqCacheControl rfc.CacheControlMap, remappingProducer *remap.RemappingProducer, blockSize int64, responder *Responder, pluginContext map[string]*interface{}, connectionClose bool, reqID uint64) {
+	beforeParentRequestData := plugin.BeforeParentRequestData{Req: r, RemapRule: remappingProducer.Name()}
+	h.plugins.OnBeforeParentRequest(remappingProducer.PluginCfg(), pluginContext, beforeParentRequestData)
+
+	resp, err := NewSlicer(h, r, reqTime, reqCacheControl, remappingProducer, blockSize, reqID).Get(reqHeader.Get("Range"))
+	if err != nil {
+		log.Errorf("slice get error: %v (reqid %v)\n", err, reqID)
+		responder.OriginConnectFailed = true
+		responder.Do()
+		return
+	}
+	log.Debugf("cache.Handler.serveSliced: '%v' responding with %v (reqid %v)\n", remappingProducer.CacheKey(), resp.Code, reqID)
+
+	codePtr, hdrsPtr, bodyPtr := resp.Code, resp.Hdr, resp.Body
+	if resp.Sliced() {
+		// the body is streamed from the blocks, so plugins can't modify it, and the reuse and bytes are only known once it's written.
+		responder.SetStreamResponse(&codePtr, &hdrsPtr, func(w io.Writer) (uint64, error) {
+			bytesWritten, err := resp.WriteBody(w)
+			responder.Reuse = resp.Reuse
+			responder.OriginBytes = bytesWritten
+			return bytesWritten, err
+		}, connectionClose)
+	} else {
+		responder.SetResponse(&codePtr, &hdrsPtr, &bodyPtr, connectionClose)
+		responder.OriginBytes = uint64(len(resp.Body))
+	}
+	responder.OriginReqSuccess = true
+	responder.Reuse = resp.Reuse
+	responder.OriginCode = resp.Obj.OriginCode
+	responder.ProxyStr = resp.ProxyStr
+	if resp.ReqHost != nil {
+		responder.ToFQDN = *resp.ReqHost
+	}
+	beforeRespData := plugin.BeforeRespondData{Req: r, CacheObj: resp.Obj, Code: &codePtr, Hdr: &hdrsPtr, Body: &bodyPtr, RemapRule: remappingProducer.Name()}
+	h.plugins.OnBeforeRespond(remappingProducer.PluginCfg(), pluginContext, beforeRespData)
+	responder.Do()
+}
@@ -15,6 +15,7 @@ package cache
 */
 
 import (
+	"io"
 	"net/http"
 
 	"github.com/apache/trafficcontrol/grove/cachedata"
@@ -88,6 +89,17 @@ func (r *Responder) SetResponse(code *int, hdrs *http.Header, body *[]byte, conn
 	}
 }
 
+// SetStreamResponse is like SetResponse, but the body is written by writeBody, rather than held in memory. The writeBody func is not called for HEAD requests.
+func (r *Responder) SetStreamResponse(code *int, hdrs *http.Header, writeBody func(w io.Writer) (uint64, error), connectionClose bool) {
+	r.ResponseCode = code
+	r.F = func() (uint64, error) {
+		if _, err := web.Respond(r.W, *code, *hdrs, nil, connectionClose); err != nil || r.Req.Method == http.MethodHead {
+			return 0, err
+		}
+		return writeBody(r.W)
+	}
+}
+
 // Do responds to the client, according to the data in r, with the given code, headers, and body. It additionally writes to the event log, and adds statistics about this request. This should always be called for the final response to a client, in order to properly log, stat, and other final operations.
 // For cache misses, reuse should be ReuseCannot.
 // For parent connect failures, originCode should be 0.
@@ -100,7 +112,8 @@ func (r *Responder) Do() {
 	web.TryFlush(r.W) // TODO remove? Let plugins do it, if they need to?
 
 	respSuccess := err != nil
-	respData := cachedata.RespData{RespCode: *r.ResponseCode, BytesWritten: bytesSent, RespSuccess: respSuccess, CacheHit: isCacheHit(r.Reuse, r.OriginCode)}
+	cacheHit := isCacheHit(r.Reuse, r.OriginCode)
+	respData := cachedata.RespData{RespCode: *r.ResponseCode, BytesWritten: bytesSent, RespSuccess: respSuccess, CacheHit: cacheHit, NegativeCacheHit: cacheHit && r.Negative}
 	arData := plugin.AfterRespondData{W: r.W, Stats: r.Stats, ReqData: r.ReqData, SrvrData: r.SrvrData, ParentRespData: r.ParentRespData, RespData: respData, RequestID: r.RequestID}
 	r.Plugins.OnAfterRespond(r.PluginCfg, r.PluginContext, arData)
 }
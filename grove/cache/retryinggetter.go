@@ -22,7 +22,9 @@ import (
 
 	"github.com/apache/trafficcontrol/grove/cacheobj"
 	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/parenthealth"
 	"github.com/apache/trafficcontrol/grove/remap"
+	"github.com/apache/trafficcontrol/grove/remapdata"
 	"github.com/apache/trafficcontrol/grove/thread"
 	"github.com/apache/trafficcontrol/grove/web"
 
@@ -60,7 +62,7 @@ func (r *Retrier) Get(req *http.Request, obj *cacheobj.CacheObj) (*cacheobj.Cach
 			return cacheobj.CanReuse(r.ReqHdr, r.ReqCacheControl, cacheObj, r.H.strictRFC, true)
 		}
 		getAndCache := func() *cacheobj.CacheObj {
-			return GetAndCache(remapping.Request, remapping.ProxyURL, remapping.CacheKey, remapping.Name, remapping.Request.Header, r.ReqTime, r.H.strictRFC, remapping.Cache, r.H.ruleThrottlers[remapping.Name], obj, remapping.Timeout, retryFailures, remapping.RetryNum, remapping.RetryCodes, remapping.Transport, r.ReqID)
+			return GetAndCache(remapping.Request, remapping.ProxyURL, remapping.CacheKey, remapping.Name, remapping.Request.Header, r.ReqTime, r.H.strictRFC, remapping.Cache, r.H.ruleThrottlers[remapping.Name], obj, remapping.Timeout, retryFailures, remapping.RetryNum, remapping.RetryCodes, remapping.NegativeCache, remapping.Transport, remapping.Health, r.ReqID)
 		}
 		gotObj, getReqID := r.H.getter.Get(remapping.CacheKey, getAndCache, canReuse, r.ReqID)
 
@@ -104,6 +106,8 @@ const ModifiedSinceHdr = "If-Modified-Since"
 
 // GetAndCache makes a client request for the given `http.Request` and caches it if `CanCache`.
 // THe `ruleThrottler` may be nil, in which case the request will be unthrottled.
+// The result of the parent request is reported to the `parentHealth`, which may be nil.
+// Error responses are negatively cached per the `negativeCache`, which may be nil. Failures which will be retried are never cached.
 func GetAndCache(
 	req *http.Request,
 	proxyURL *url.URL,
@@ -119,7 +123,9 @@ func GetAndCache(
 	cacheFailure bool,
 	retryNum int,
 	retryCodes map[int]struct{},
+	negativeCache *remapdata.NegativeCache,
 	transport *http.Transport,
+	parentHealth *parenthealth.Parent,
 	reqID uint64,
 ) *cacheobj.CacheObj {
 	// TODO this is awkward, with 'revalidateObj' indicating whether the request is a Revalidate. Should Getting and Caching be split up? How?
@@ -141,11 +147,28 @@ func GetAndCache(
 
 		if err != nil {
 			log.Errorf("Parent error for URI %v %v %v cacheKey %v rule %v parent %v error %v (reqid %v)\n", req.URL.Scheme, req.URL.Host, req.URL.EscapedPath(), cacheKey, remapName, proxyURLStr, err, reqID)
+			if web.IsTimeout(err) {
+				parentHealth.Timeout()
+			} else {
+				parentHealth.Failure()
+			}
 			code := CodeConnectFailure
 			body := []byte(http.StatusText(code))
-			return cacheobj.New(reqHeader, body, code, code, proxyURLStr, respHeader, reqTime, reqRespTime, reqRespTime, time.Time{})
+			obj := cacheobj.New(reqHeader, body, code, code, proxyURLStr, respHeader, reqTime, reqRespTime, reqRespTime, time.Time{})
+			if ttl, ok := negativeCacheTTL(negativeCache, req.Method, reqHeader, code, respHeader, body, strictRFC); ok && cacheFailure {
+				log.Debugf("GetAndCache negatively caching connect failure %v for %v (reqid %v)\n", cacheKey, ttl, reqID)
+				obj.NegativeExpiry = reqRespTime.Add(ttl)
+				cache.Add(cacheKey, obj)
+			}
+			return obj
+		}
+		_, isRetryCode := retryCodes[respCode]
+		if isRetryCode {
+			parentHealth.Failure()
+		} else {
+			parentHealth.Success()
 		}
-		if _, ok := retryCodes[respCode]; ok && !cacheFailure {
+		if isRetryCode && !cacheFailure {
 			return cacheobj.New(reqHeader, respBody, respCode, respCode, proxyURLStr, respHeader, reqTime, reqRespTime, reqRespTime, time.Time{})
 		}
 
@@ -167,7 +190,10 @@ func GetAndCache(
 		if revalidateObj == nil || respCode != http.StatusNotModified {
 			log.Debugf("GetAndCache new %v (reqid %v)\n", cacheKey, reqID)
 			obj = cacheobj.New(reqHeader, respBody, respCode, respCode, proxyURLStr, respHeader, reqTime, reqRespTime, respRespTime, lastModified)
-			if !rfc.CanCache(req.Method, reqHeader, respCode, respHeader, strictRFC) {
+			if ttl, ok := negativeCacheTTL(negativeCache, req.Method, reqHeader, respCode, respHeader, respBody, strictRFC); ok {
+				log.Debugf("GetAndCache negatively caching %v code %v for %v (reqid %v)\n", cacheKey, respCode, ttl, reqID)
+				obj.NegativeExpiry = reqRespTime.Add(ttl) // local time, so the expiry isn't affected by parent clock skew
+			} else if !rfc.CanCache(req.Method, reqHeader, respCode, respHeader, strictRFC) {
 				return obj // return without caching
 			}
 		} else {
@@ -203,3 +229,25 @@ func GetAndCache(
 	ruleThrottler.Throttle(func() { c = get() })
 	return c
 }
+
+// negativeCacheTTL returns how long to negatively cache the response, and whether it should be. Responses are only negatively cached if the rule has a TTL for their code, and the parent didn't give them an explicit freshness lifetime or forbid shared caches from storing or reusing them. An explicit lifetime takes precedence over the negative TTL, and is handled per RFC 7234 like any other response.
+func negativeCacheTTL(negativeCache *remapdata.NegativeCache, reqMethod string, reqHeader http.Header, code int, respHeader http.Header, body []byte, strictRFC bool) (time.Duration, bool) {
+	if _, ok := rfc.CacheableRequestMethods[reqMethod]; !ok {
+		return 0, false
+	}
+	ttl, ok := negativeCache.TTL(code, len(body))
+	if !ok {
+		return 0, false
+	}
+	respCC := rfc.ParseCacheControl(respHeader)
+	if respCC.Has("no-store") || respCC.Has("private") || respCC.Has("no-cache") {
+		return 0, false
+	}
+	if respCC.Has("max-age") || respCC.Has("s-maxage") || respHeader.Get("Expires") != "" {
+		return 0, false
+	}
+	if strictRFC && rfc.ParseCacheControl(reqHeader).Has("no-store") {
+		return 0, false
+	}
+	return ttl, true
+}
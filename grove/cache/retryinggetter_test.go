@@ -0,0 +1,197 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/memcache"
+	"github.com/apache/trafficcontrol/grove/plugin"
+	"github.com/apache/trafficcontrol/grove/remap"
+	"github.com/apache/trafficcontrol/grove/remapdata"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+)
+
+// errorOrigin responds to every request with its code and headers, after waiting for release to be closed, and counts the requests it receives.
+type errorOrigin struct {
+	code     int
+	hdr      http.Header
+	release  chan struct{}
+	requests uint64
+}
+
+func (o *errorOrigin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddUint64(&o.requests, 1)
+	<-o.release
+	for name, vals := range o.hdr {
+		w.Header()[name] = vals
+	}
+	w.Header().Set("Date", time.Now().Format(http.TimeFormat))
+	w.WriteHeader(o.code)
+	w.Write([]byte(http.StatusText(o.code)))
+}
+
+func newErrorOrigin(code int, hdr http.Header) *errorOrigin {
+	o := &errorOrigin{code: code, hdr: hdr, release: make(chan struct{})}
+	close(o.release)
+	return o
+}
+
+// newTestRetrier returns a Retrier for a request for path, of a rule with the given negative caching config.
+func newTestRetrier(t *testing.T, originURL string, negativeCacheJSON *remapdata.NegativeCacheJSON) *Retrier {
+	selection := remapdata.ParentSelectionTypeRoundRobin
+	retryNum := 0
+	timeout := 10 * time.Second
+	rule := remapdata.RemapRule{
+		ParentSelection: &selection,
+		Timeout:         &timeout,
+		RetryCodes:      map[int]struct{}{},
+		RoundRobin:      new(uint64),
+		Cache:           memcache.New(1<<20, nil),
+	}
+	rule.Name = "negative-test"
+	rule.From = "http://grove.example"
+	rule.RetryNum = &retryNum
+	if negativeCacheJSON != nil {
+		nc, err := negativeCacheJSON.ToNegativeCache()
+		if err != nil {
+			t.Fatalf("creating negative cache: %v", err)
+		}
+		rule.NegativeCache = nc
+	}
+	to := remapdata.RemapRuleTo{Transport: &http.Transport{}}
+	to.URL = originURL
+	rule.To = []remapdata.RemapRuleTo{to}
+
+	remapper := remap.NewHTTPRequestRemapper([]remapdata.RemapRule{rule}, nil, &remapdata.RemapRulesStats{})
+	h := NewHandler(remapper, 10, nil, "http", "80", nil, false, false, plugin.Get(nil), nil, nil, nil, "", nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Host = "grove.example"
+	producer, err := remapper.RemappingProducer(req, "http")
+	if err != nil {
+		t.Fatalf("creating remapping producer: %v", err)
+	}
+	return NewRetrier(h, req.Header, time.Now(), rfc.ParseCacheControl(req.Header), producer, 1)
+}
+
+func testReq() *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Host = "grove.example"
+	return req
+}
+
+func TestRetrierNegativeCache(t *testing.T) {
+	origin := newErrorOrigin(http.StatusNotFound, nil)
+	server := httptest.NewServer(origin)
+	defer server.Close()
+
+	retrier := newTestRetrier(t, server.URL, &remapdata.NegativeCacheJSON{TTLsMS: map[string]int{"404": 60000}})
+	obj, _, err := retrier.Get(testReq(), nil)
+	if err != nil {
+		t.Fatalf("Retrier.Get expected nil error, actual %v", err)
+	}
+	if obj.Code != http.StatusNotFound || !obj.Negative() {
+		t.Fatalf("Retrier.Get expected negatively cached 404, actual code %v negative %v", obj.Code, obj.Negative())
+	}
+
+	cached, ok := retrier.RemappingProducer.Cache().Get(retrier.RemappingProducer.CacheKey())
+	if !ok {
+		t.Fatalf("Retrier.Get expected 404 to be cached, actual not cached")
+	}
+	if reuse := cacheobj.ReuseStored(http.Header{}, rfc.CacheControlMap{}, cached, false); reuse != rfc.ReuseCan {
+		t.Errorf("ReuseStored of fresh negative object expected %v, actual %v", rfc.ReuseCan, reuse)
+	}
+	if reuse := cacheobj.ReuseStored(http.Header{}, rfc.CacheControlMap{"no-cache": ""}, cached, true); reuse != rfc.ReuseCannot {
+		t.Errorf("ReuseStored of negative object with strict no-cache request expected %v, actual %v", rfc.ReuseCannot, reuse)
+	}
+
+	expired := *cached
+	expired.NegativeExpiry = time.Now().Add(-time.Second)
+	if reuse := cacheobj.ReuseStored(http.Header{}, rfc.CacheControlMap{}, &expired, false); reuse != rfc.ReuseCannot {
+		t.Errorf("ReuseStored of expired negative object expected %v, actual %v", rfc.ReuseCannot, reuse)
+	}
+}
+
+func TestRetrierNegativeCacheOriginCacheControl(t *testing.T) {
+	tests := []struct {
+		cacheControl string
+		cached       bool
+	}{
+		{cacheControl: "no-store", cached: false},
+		{cacheControl: "private", cached: false},
+		{cacheControl: "max-age=60", cached: true}, // explicit lifetime: cached per RFC, not negatively
+	}
+	for _, test := range tests {
+		origin := newErrorOrigin(http.StatusServiceUnavailable, http.Header{"Cache-Control": {test.cacheControl}})
+		server := httptest.NewServer(origin)
+
+		retrier := newTestRetrier(t, server.URL, &remapdata.NegativeCacheJSON{TTLsMS: map[string]int{"5xx": 60000}})
+		obj, _, err := retrier.Get(testReq(), nil)
+		server.Close()
+		if err != nil {
+			t.Fatalf("Retrier.Get expected nil error, actual %v", err)
+		}
+		if obj.Negative() {
+			t.Errorf("Retrier.Get with origin Cache-Control '%v' expected not negatively cached, actual negative", test.cacheControl)
+		}
+		if _, cached := retrier.RemappingProducer.Cache().Get(retrier.RemappingProducer.CacheKey()); cached != test.cached {
+			t.Errorf("Retrier.Get with origin Cache-Control '%v' expected cached %v, actual %v", test.cacheControl, test.cached, cached)
+		}
+	}
+}
+
+func TestRetrierNegativeCacheCollapse(t *testing.T) {
+	origin := &errorOrigin{code: http.StatusServiceUnavailable, release: make(chan struct{})}
+	server := httptest.NewServer(origin)
+	defer server.Close()
+
+	retrier := newTestRetrier(t, server.URL, &remapdata.NegativeCacheJSON{TTLsMS: map[string]int{"5xx": 60000}})
+	const concurrent = 5
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrent; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// each request needs its own producer, because producers count their own retries
+			r := *retrier
+			r.RemappingProducer = retrier.RemappingProducer.ForKey(retrier.RemappingProducer.CacheKey())
+			obj, _, err := r.Get(testReq(), nil)
+			if err != nil {
+				t.Errorf("Retrier.Get expected nil error, actual %v", err)
+			} else if !obj.Negative() {
+				t.Errorf("Retrier.Get expected negatively cached 503, actual not negative")
+			}
+		}()
+	}
+	// wait for the author request to reach the origin, so the rest become waiters, then release it.
+	for atomic.LoadUint64(&origin.requests) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(origin.release)
+	wg.Wait()
+
+	if requests := atomic.LoadUint64(&origin.requests); requests != 1 {
+		t.Errorf("concurrent Retrier.Get of a negatively cached 503 expected 1 origin request, actual %v", requests)
+	}
+}
@@ -0,0 +1,485 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/remap"
+	"github.com/apache/trafficcontrol/grove/web"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+)
+
+// SliceKeyParam is the query parameter appended to the cache key of each block of a sliced object, with the block number as its value.
+const SliceKeyParam = "grove_slice_block"
+
+// BlockCacheKey returns the cache key of the given block of the object with the given cache key.
+func BlockCacheKey(cacheKey string, block int64) string {
+	sep := "?"
+	if strings.Contains(cacheKey, "?") {
+		sep = "&"
+	}
+	return cacheKey + sep + SliceKeyParam + "=" + strconv.FormatInt(block, 10)
+}
+
+// blockCache is the cache blocks are added to when they're fetched. Whole objects, returned by parents which ignore the block Range, are added under the object's own key instead of the block's, so they're never read as a block.
+type blockCache struct {
+	icache.Cache
+	objKey string
+}
+
+func (c blockCache) Add(key string, val *cacheobj.CacheObj) bool {
+	if val.Code == http.StatusOK {
+		key = c.objKey
+	}
+	return c.Cache.Add(key, val)
+}
+
+// SlicedResp is the response to a client request for a sliced object. The body of a sliced response is not held in memory; it is written by WriteBody, which fetches each block as it's written, so a request for a large object only ever holds a block or two of it in memory.
+type SlicedResp struct {
+	Code int
+	Hdr  http.Header
+	// Body is the body of responses which aren't assembled from blocks, such as errors, or objects the parent didn't return in blocks. It is nil for responses assembled from blocks.
+	Body []byte
+	// Obj is the first block fetched, used for its validators and request data. It is never nil.
+	Obj *cacheobj.CacheObj
+	// Reuse is ReuseCan if every block was served from the cache, else ReuseCannot. For responses assembled from blocks, it is only known after WriteBody.
+	Reuse    rfc.Reuse
+	ProxyStr string
+	ReqHost  *string
+
+	slicer *Slicer
+	// first is the first block fetched, which every other block must be consistent with.
+	first *block
+	// fetched is the blocks fetched before responding, by block number.
+	fetched map[int64]*block
+	// start and end are the first and last byte of the range, inclusive.
+	start int64
+	end   int64
+}
+
+// Sliced returns whether the response body is assembled from blocks, and must be written with WriteBody.
+func (r *SlicedResp) Sliced() bool { return r.first != nil }
+
+// WriteBody writes the response body to w, and returns the number of bytes written. The blocks of sliced responses are fetched as they're written, and checked against the first block. If a block is inconsistent with it even after refetching the block from the parent, i.e. the object changed at the parent since the response headers were determined, ErrSliceInconsistent is returned with the body incomplete, and the first block is refetched, so the next request gets consistent blocks.
+func (r *SlicedResp) WriteBody(w io.Writer) (uint64, error) {
+	if !r.Sliced() {
+		n, err := w.Write(r.Body)
+		return uint64(n), err
+	}
+	s := r.slicer
+	written := uint64(0)
+	firstBlockNum, lastBlockNum := r.start/s.BlockSize, r.end/s.BlockSize
+	for blockNum := firstBlockNum; blockNum <= lastBlockNum; blockNum++ {
+		b, err := r.block(blockNum)
+		if err != nil {
+			return written, err
+		}
+		if !b.hit {
+			r.Reuse = rfc.ReuseCannot
+		}
+		blockEnd := b.start + int64(len(b.obj.Body)) - 1
+		from := max64(r.start, b.start) - b.start
+		to := min64(r.end, blockEnd) - b.start
+		if from > to {
+			continue
+		}
+		n, err := w.Write(b.obj.Body[from : to+1])
+		written += uint64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// block returns the given block of the response, fetching it if it wasn't already fetched, and refetching it from the parent if the cached block is inconsistent with the first block.
+func (r *SlicedResp) block(blockNum int64) (*block, error) {
+	s := r.slicer
+	if b, ok := r.fetched[blockNum]; ok {
+		return b, nil
+	}
+	for _, fresh := range []bool{false, true} {
+		b, err := s.getBlock(blockNum, fresh)
+		if err != nil {
+			return nil, err
+		}
+		if consistentBlocks(r.first, b, blockNum*s.BlockSize) {
+			return b, nil
+		}
+		log.Warnf("slice: block %v of '%v' is inconsistent with block %v, refetch %v (reqid %v)\n", blockNum, s.RemappingProducer.CacheKey(), r.first.start/s.BlockSize, !fresh, s.ReqID)
+	}
+	// the first block is stale, but its headers were already sent. Refetch it, so it doesn't stay stale in the cache.
+	if _, err := s.getBlock(r.first.start/s.BlockSize, true); err != nil {
+		log.Errorf("slice: refetching stale block %v of '%v': %v (reqid %v)\n", r.first.start/s.BlockSize, s.RemappingProducer.CacheKey(), err, s.ReqID)
+	}
+	return nil, ErrSliceInconsistent
+}
+
+// Slicer serves requests for large objects by requesting them from the parent in fixed-size blocks, with Range requests, and caching each block under its own key. Client ranges are assembled from cached blocks and fetched blocks, so a small range of a large object never requires fetching or storing the whole object.
+type Slicer struct {
+	H                 *Handler
+	Req               *http.Request
+	ReqTime           time.Time
+	ReqCacheControl   rfc.CacheControlMap
+	RemappingProducer *remap.RemappingProducer
+	BlockSize         int64
+	ReqID             uint64
+}
+
+func NewSlicer(h *Handler, req *http.Request, reqTime time.Time, reqCacheControl rfc.CacheControlMap, remappingProducer *remap.RemappingProducer, blockSize int64, reqID uint64) *Slicer {
+	return &Slicer{
+		H:                 h,
+		Req:               req,
+		ReqTime:           reqTime,
+		ReqCacheControl:   reqCacheControl,
+		RemappingProducer: remappingProducer,
+		BlockSize:         blockSize,
+		ReqID:             reqID,
+	}
+}
+
+// ErrSliceInconsistent is returned when the blocks of an object have different validators or sizes, even after refetching them all from the parent, i.e. the object is changing faster than it can be fetched.
+var ErrSliceInconsistent = errors.New("sliced object blocks are inconsistent")
+
+// block is a single block of a sliced object, as returned by the parent.
+type block struct {
+	obj *cacheobj.CacheObj
+	// start is the offset in the object of the first byte of obj.Body.
+	start int64
+	// total is the total size of the object.
+	total int64
+	// hit is whether the block was served from the cache.
+	hit     bool
+	reqHost *string
+}
+
+// Get returns the response for the client's Range header, which may be empty to request the whole object. Responses from the parent which aren't blocks, e.g. errors or 404s, are returned as they are.
+// Only the first and last blocks of the range are fetched; the rest are fetched as they're written by the response's WriteBody.
+func (s *Slicer) Get(rangeHdr string) (*SlicedResp, error) {
+	byteRange, hasRange := parseSliceRange(rangeHdr)
+
+	if whole, ok := s.cachedWhole(); ok {
+		return s.respondWhole(whole, byteRange, hasRange), nil
+	}
+
+	firstBlockNum := int64(0)
+	if hasRange && byteRange.Start >= 0 {
+		firstBlockNum = byteRange.Start / s.BlockSize
+	}
+
+	for _, fresh := range []bool{false, true} {
+		first, err := s.getBlock(firstBlockNum, fresh)
+		if err != nil {
+			return nil, err
+		}
+		if first.obj.Code != http.StatusPartialContent {
+			if first.obj.Code == http.StatusOK {
+				// the parent ignored the Range, and returned the whole object.
+				return s.respondWhole(first, byteRange, hasRange), nil
+			}
+			return s.respondUnsliced(first), nil
+		}
+
+		start, end, ok := byteRange.resolve(first.total, hasRange)
+		if !ok {
+			return s.respondUnsatisfiable(first), nil
+		}
+
+		// check the first and last blocks of the range before responding, so a changed object size or validator is caught while the whole response can still be refetched. Suffix ranges don't start in the first block fetched, which is only used for the object size.
+		fetched := map[int64]*block{firstBlockNum: first}
+		consistent := true
+		for _, blockNum := range []int64{start / s.BlockSize, end / s.BlockSize} {
+			if _, ok := fetched[blockNum]; ok {
+				continue
+			}
+			b, err := s.getBlock(blockNum, fresh)
+			if err != nil {
+				return nil, err
+			}
+			if !consistentBlocks(first, b, blockNum*s.BlockSize) {
+				log.Warnf("slice: block %v of '%v' is inconsistent with block %v, refetch %v (reqid %v)\n", blockNum, s.RemappingProducer.CacheKey(), firstBlockNum, !fresh, s.ReqID)
+				consistent = false
+				break
+			}
+			fetched[blockNum] = b
+		}
+		if consistent {
+			return s.respond(first, fetched, start, end, hasRange), nil
+		}
+		// a cached block is stale with respect to another, so refetch the blocks from the parent, overwriting the cached blocks.
+	}
+	return nil, ErrSliceInconsistent
+}
+
+// cachedWhole returns the whole object, if a parent which ignored the block Range returned it, and it's cached and may be reused without revalidating. Whole objects which must be revalidated are refetched as blocks, in case the parent now supports Range requests.
+func (s *Slicer) cachedWhole() (*block, bool) {
+	obj, ok := s.RemappingProducer.Cache().Get(s.RemappingProducer.CacheKey())
+	if !ok || obj.Code != http.StatusOK || cacheobj.ReuseStored(s.Req.Header, s.ReqCacheControl, obj, s.H.strictRFC) != rfc.ReuseCan {
+		return nil, false
+	}
+	log.Debugf("slice: '%v' whole object cache hit (reqid %v)\n", s.RemappingProducer.CacheKey(), s.ReqID)
+	b, err := newBlock(obj, true, nil)
+	return b, err == nil
+}
+
+// getBlock returns the given block, from the cache if possible, else from the parent. If fresh is true, the cache is bypassed.
+func (s *Slicer) getBlock(blockNum int64, fresh bool) (*block, error) {
+	key := BlockCacheKey(s.RemappingProducer.CacheKey(), blockNum)
+	cache := s.RemappingProducer.Cache()
+
+	revalidateObj := (*cacheobj.CacheObj)(nil)
+	canStale := false
+	cachedObj, ok := (*cacheobj.CacheObj)(nil), false
+	if !fresh {
+		cachedObj, ok = cache.Get(key)
+	}
+	if ok && cachedObj.Code == http.StatusOK {
+		ok = false // a whole object cached under the block key, before whole objects were cached under their own key
+	}
+	if ok {
+		switch cacheobj.ReuseStored(s.Req.Header, s.ReqCacheControl, cachedObj, s.H.strictRFC) {
+		case rfc.ReuseCan:
+			log.Debugf("slice: '%v' cache hit (reqid %v)\n", key, s.ReqID)
+			return newBlock(cachedObj, true, nil)
+		case rfc.ReuseMustRevalidate:
+			revalidateObj = cachedObj
+		case rfc.ReuseMustRevalidateCanStale:
+			revalidateObj = cachedObj
+			canStale = true
+		}
+	}
+
+	start := blockNum * s.BlockSize
+	blockReq := s.Req.Clone(s.Req.Context())
+	blockReq.Header.Set("Range", "bytes="+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(start+s.BlockSize-1, 10))
+
+	producer := s.RemappingProducer.ForKey(key).WithCache(blockCache{Cache: cache, objKey: s.RemappingProducer.CacheKey()})
+	retrier := NewRetrier(s.H, web.CopyHeader(blockReq.Header), s.ReqTime, s.ReqCacheControl, producer, s.ReqID)
+	obj, reqHost, err := retrier.Get(blockReq, revalidateObj)
+	if err != nil {
+		if canStale {
+			log.Errorf("slice: getting '%v' error - serving stale as allowed: %v (reqid %v)\n", key, err, s.ReqID)
+			return newBlock(revalidateObj, true, nil)
+		}
+		return nil, errors.New("getting block '" + key + "': " + err.Error())
+	}
+	return newBlock(obj, revalidateObj != nil && obj.OriginCode == http.StatusNotModified, reqHost)
+}
+
+func newBlock(obj *cacheobj.CacheObj, hit bool, reqHost *string) (*block, error) {
+	b := &block{obj: obj, hit: hit, reqHost: reqHost}
+	switch obj.Code {
+	case http.StatusPartialContent:
+		start, total, err := parseContentRange(obj.RespHeaders.Get("Content-Range"))
+		if err != nil {
+			return nil, errors.New("parsing block Content-Range: " + err.Error())
+		}
+		b.start = start
+		b.total = total
+	case http.StatusOK:
+		b.total = int64(len(obj.Body))
+	}
+	return b, nil
+}
+
+// consistentBlocks returns whether the block b is the block starting at the given offset, of the same object as the block first, according to its size and validators.
+func consistentBlocks(first *block, b *block, start int64) bool {
+	return b.obj.Code == http.StatusPartialContent &&
+		b.start == start &&
+		b.total == first.total &&
+		b.obj.RespHeaders.Get("ETag") == first.obj.RespHeaders.Get("ETag") &&
+		b.obj.RespHeaders.Get("Last-Modified") == first.obj.RespHeaders.Get("Last-Modified")
+}
+
+// respond returns the response for the bytes from start to end inclusive, whose body is written from the blocks by WriteBody.
+func (s *Slicer) respond(first *block, fetched map[int64]*block, start int64, end int64, hasRange bool) *SlicedResp {
+	reuse := rfc.ReuseCan
+	for _, b := range fetched {
+		if !b.hit {
+			reuse = rfc.ReuseCannot
+		}
+	}
+	hdr := s.respHeader(first, start, end, hasRange)
+	code := http.StatusOK
+	if hasRange {
+		code = http.StatusPartialContent
+	}
+	return &SlicedResp{Code: code, Hdr: hdr, Obj: first.obj, Reuse: reuse, ProxyStr: first.obj.ProxyURL, ReqHost: first.reqHost, slicer: s, first: first, fetched: fetched, start: start, end: end}
+}
+
+// respondWhole returns the response for the client range of a whole object returned by the parent.
+func (s *Slicer) respondWhole(b *block, byteRange sliceRange, hasRange bool) *SlicedResp {
+	start, end, ok := byteRange.resolve(b.total, hasRange)
+	if !ok {
+		return s.respondUnsatisfiable(b)
+	}
+	reuse := rfc.ReuseCannot
+	if b.hit {
+		reuse = rfc.ReuseCan
+	}
+	code := http.StatusOK
+	if hasRange {
+		code = http.StatusPartialContent
+	}
+	return &SlicedResp{Code: code, Hdr: s.respHeader(b, start, end, hasRange), Body: b.obj.Body[start : end+1], Obj: b.obj, Reuse: reuse, ProxyStr: b.obj.ProxyURL, ReqHost: b.reqHost}
+}
+
+// respHeader returns the response headers for the bytes from start to end inclusive of the object of the given block.
+func (s *Slicer) respHeader(first *block, start int64, end int64, hasRange bool) http.Header {
+	hdr := web.CopyHeader(first.obj.RespHeaders)
+	hdr.Del("Content-Range")
+	hdr.Set("Accept-Ranges", "bytes")
+	hdr.Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	if hasRange {
+		hdr.Set("Content-Range", "bytes "+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(end, 10)+"/"+strconv.FormatInt(first.total, 10))
+	}
+	return hdr
+}
+
+// respondUnsliced returns the parent's response as-is, for responses which aren't blocks, such as errors.
+func (s *Slicer) respondUnsliced(b *block) *SlicedResp {
+	reuse := rfc.ReuseCannot
+	if b.hit {
+		reuse = rfc.ReuseCan
+	}
+	return &SlicedResp{Code: b.obj.Code, Hdr: b.obj.RespHeaders, Body: b.obj.Body, Obj: b.obj, Reuse: reuse, ProxyStr: b.obj.ProxyURL, ReqHost: b.reqHost}
+}
+
+func (s *Slicer) respondUnsatisfiable(first *block) *SlicedResp {
+	hdr := web.CopyHeader(first.obj.RespHeaders)
+	hdr.Set("Content-Range", "bytes */"+strconv.FormatInt(first.total, 10))
+	hdr.Del("Content-Length")
+	return &SlicedResp{Code: http.StatusRequestedRangeNotSatisfiable, Hdr: hdr, Body: nil, Obj: first.obj, Reuse: rfc.ReuseCannot, ProxyStr: first.obj.ProxyURL, ReqHost: first.reqHost}
+}
+
+// sliceRange is a client byte range. A Start of -1 means End is a suffix length, and an End of -1 means until the end of the object.
+type sliceRange struct {
+	Start int64
+	End   int64
+}
+
+// parseSliceRange parses the given Range header, and returns whether it was a valid byte range. Multiple ranges are coalesced into a single range from the first start to the last end, as permitted by RFC 7233§4.1. Invalid Range headers are ignored, as required by RFC 7233§3.1.
+func parseSliceRange(hdr string) (sliceRange, bool) {
+	if !strings.HasPrefix(hdr, "bytes=") {
+		return sliceRange{}, false
+	}
+	coalesced := sliceRange{}
+	for i, rangeStr := range strings.Split(strings.TrimPrefix(hdr, "bytes="), ",") {
+		parts := strings.Split(strings.TrimSpace(rangeStr), "-")
+		if len(parts) != 2 || (parts[0] == "" && parts[1] == "") {
+			return sliceRange{}, false
+		}
+		r := sliceRange{Start: -1, End: -1}
+		if parts[0] != "" {
+			start, err := strconv.ParseInt(parts[0], 10, 64)
+			if err != nil || start < 0 {
+				return sliceRange{}, false
+			}
+			r.Start = start
+		}
+		if parts[1] != "" {
+			end, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil || end < 0 || (r.Start >= 0 && end < r.Start) {
+				return sliceRange{}, false
+			}
+			r.End = end
+		}
+		if i == 0 {
+			coalesced = r
+			continue
+		}
+		if r.Start < 0 || coalesced.Start < 0 {
+			return sliceRange{}, false // suffix ranges can't be coalesced without knowing the size
+		}
+		coalesced.Start = min64(coalesced.Start, r.Start)
+		if coalesced.End >= 0 && (r.End < 0 || r.End > coalesced.End) {
+			coalesced.End = r.End
+		}
+	}
+	return coalesced, true
+}
+
+// resolve returns the absolute first and last byte of the range, for an object of the given total size, and whether the range is satisfiable. If hasRange is false, the whole object is returned.
+func (r sliceRange) resolve(total int64, hasRange bool) (int64, int64, bool) {
+	if !hasRange {
+		if total == 0 {
+			return 0, -1, true
+		}
+		return 0, total - 1, true
+	}
+	start, end := r.Start, r.End
+	if start < 0 {
+		if end == 0 {
+			return 0, 0, false
+		}
+		start = max64(total-end, 0)
+		end = total - 1
+	}
+	if end < 0 || end >= total {
+		end = total - 1
+	}
+	if start >= total {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// parseContentRange parses a Content-Range header of the form `bytes start-end/total`, and returns the start and total.
+func parseContentRange(hdr string) (int64, int64, error) {
+	if !strings.HasPrefix(hdr, "bytes ") {
+		return 0, 0, errors.New("malformed Content-Range '" + hdr + "'")
+	}
+	rangeAndTotal := strings.SplitN(strings.TrimPrefix(hdr, "bytes "), "/", 2)
+	if len(rangeAndTotal) != 2 {
+		return 0, 0, errors.New("malformed Content-Range '" + hdr + "'")
+	}
+	startEnd := strings.SplitN(rangeAndTotal[0], "-", 2)
+	if len(startEnd) != 2 {
+		return 0, 0, errors.New("malformed Content-Range '" + hdr + "'")
+	}
+	start, err := strconv.ParseInt(startEnd[0], 10, 64)
+	if err != nil {
+		return 0, 0, errors.New("malformed Content-Range start '" + hdr + "'")
+	}
+	total, err := strconv.ParseInt(rangeAndTotal[1], 10, 64)
+	if err != nil {
+		return 0, 0, errors.New("malformed or unknown Content-Range total '" + hdr + "'")
+	}
+	return start, total, nil
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,381 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/memcache"
+	"github.com/apache/trafficcontrol/grove/plugin"
+	"github.com/apache/trafficcontrol/grove/remap"
+	"github.com/apache/trafficcontrol/grove/remapdata"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+)
+
+func TestParseSliceRange(t *testing.T) {
+	tests := []struct {
+		hdr      string
+		expected sliceRange
+		ok       bool
+	}{
+		{hdr: "", ok: false},
+		{hdr: "items=0-1", ok: false},
+		{hdr: "bytes=0-99", expected: sliceRange{Start: 0, End: 99}, ok: true},
+		{hdr: "bytes=100-", expected: sliceRange{Start: 100, End: -1}, ok: true},
+		{hdr: "bytes=-100", expected: sliceRange{Start: -1, End: 100}, ok: true},
+		{hdr: "bytes=10-20, 50-60", expected: sliceRange{Start: 10, End: 60}, ok: true},
+		{hdr: "bytes=50-60,10-", expected: sliceRange{Start: 10, End: -1}, ok: true},
+		{hdr: "bytes=20-10", ok: false},
+		{hdr: "bytes=-", ok: false},
+		{hdr: "bytes=0-10,-5", ok: false},
+		{hdr: "bytes=a-b", ok: false},
+	}
+	for _, test := range tests {
+		actual, ok := parseSliceRange(test.hdr)
+		if ok != test.ok || (ok && actual != test.expected) {
+			t.Errorf("parseSliceRange('%v') expected %+v %v, actual %+v %v", test.hdr, test.expected, test.ok, actual, ok)
+		}
+	}
+}
+
+func TestSliceRangeResolve(t *testing.T) {
+	tests := []struct {
+		r          sliceRange
+		total      int64
+		start, end int64
+		ok         bool
+	}{
+		{r: sliceRange{Start: 0, End: 99}, total: 1000, start: 0, end: 99, ok: true},
+		{r: sliceRange{Start: 900, End: -1}, total: 1000, start: 900, end: 999, ok: true},
+		{r: sliceRange{Start: 900, End: 5000}, total: 1000, start: 900, end: 999, ok: true},
+		{r: sliceRange{Start: -1, End: 100}, total: 1000, start: 900, end: 999, ok: true},
+		{r: sliceRange{Start: -1, End: 5000}, total: 1000, start: 0, end: 999, ok: true},
+		{r: sliceRange{Start: 1000, End: -1}, total: 1000, ok: false},
+		{r: sliceRange{Start: -1, End: 0}, total: 1000, ok: false},
+	}
+	for _, test := range tests {
+		start, end, ok := test.r.resolve(test.total, true)
+		if ok != test.ok || (ok && (start != test.start || end != test.end)) {
+			t.Errorf("sliceRange%+v.resolve(%v) expected %v %v %v, actual %v %v %v", test.r, test.total, test.start, test.end, test.ok, start, end, ok)
+		}
+	}
+}
+
+func TestBlockCacheKey(t *testing.T) {
+	if expected, actual := "GET:http://o.example/a?grove_slice_block=3", BlockCacheKey("GET:http://o.example/a", 3); expected != actual {
+		t.Errorf("BlockCacheKey expected %v, actual %v", expected, actual)
+	}
+	if expected, actual := "GET:http://o.example/a?b=c&grove_slice_block=0", BlockCacheKey("GET:http://o.example/a?b=c", 0); expected != actual {
+		t.Errorf("BlockCacheKey expected %v, actual %v", expected, actual)
+	}
+}
+
+// testOrigin serves a single object, supporting Range requests unless ignoreRange is set, and counts the requests it receives.
+type testOrigin struct {
+	m           sync.Mutex
+	body        []byte
+	etag        string
+	ignoreRange bool
+	requests    uint64
+}
+
+func (o *testOrigin) set(body []byte, etag string) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	o.body = body
+	o.etag = etag
+}
+
+func (o *testOrigin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddUint64(&o.requests, 1)
+	if r.URL.Path != "/obj" {
+		http.NotFound(w, r)
+		return
+	}
+	o.m.Lock()
+	body, etag := o.body, o.etag
+	o.m.Unlock()
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "max-age=60")
+	w.Header().Set("Date", time.Now().Format(http.TimeFormat))
+	if o.ignoreRange {
+		w.Write(body)
+		return
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+}
+
+func testBody(size int) []byte {
+	body := make([]byte, size)
+	for i := range body {
+		body[i] = byte(i % 251)
+	}
+	return body
+}
+
+func newTestSlicer(t *testing.T, originURL string, cacheBytes uint64, blockSize int64, path string) *Slicer {
+	selection := remapdata.ParentSelectionTypeRoundRobin
+	retryNum := 0
+	timeout := 10 * time.Second
+	rule := remapdata.RemapRule{
+		ParentSelection: &selection,
+		Timeout:         &timeout,
+		RetryCodes:      map[int]struct{}{},
+		RoundRobin:      new(uint64),
+		Cache:           memcache.New(cacheBytes, nil),
+	}
+	rule.Name = "slice-test"
+	rule.From = "http://grove.example"
+	rule.RetryNum = &retryNum
+	to := remapdata.RemapRuleTo{Transport: &http.Transport{}}
+	to.URL = originURL
+	rule.To = []remapdata.RemapRuleTo{to}
+
+	remapper := remap.NewHTTPRequestRemapper([]remapdata.RemapRule{rule}, nil, &remapdata.RemapRulesStats{})
+	h := NewHandler(remapper, 10, nil, "http", "80", nil, false, false, plugin.Get(nil), nil, nil, nil, "", nil)
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Host = "grove.example"
+	producer, err := remapper.RemappingProducer(req, "http")
+	if err != nil {
+		t.Fatalf("creating remapping producer: %v", err)
+	}
+	producer.Slice(blockSize)
+	return NewSlicer(h, req, time.Now(), rfc.ParseCacheControl(req.Header), producer, blockSize, 1)
+}
+
+func TestSlicerGet(t *testing.T) {
+	body := testBody(10000)
+	origin := &testOrigin{}
+	origin.set(body, `"v1"`)
+	server := httptest.NewServer(origin)
+	defer server.Close()
+
+	const blockSize = 1000
+	slicer := newTestSlicer(t, server.URL, 1<<20, blockSize, "/obj")
+
+	tests := []struct {
+		rangeHdr     string
+		code         int
+		start, end   int
+		contentRange string
+	}{
+		{rangeHdr: "bytes=1500-3499", code: http.StatusPartialContent, start: 1500, end: 3499, contentRange: "bytes 1500-3499/10000"},
+		{rangeHdr: "bytes=2000-2999", code: http.StatusPartialContent, start: 2000, end: 2999, contentRange: "bytes 2000-2999/10000"},
+		{rangeHdr: "bytes=9990-", code: http.StatusPartialContent, start: 9990, end: 9999, contentRange: "bytes 9990-9999/10000"},
+		{rangeHdr: "bytes=-10", code: http.StatusPartialContent, start: 9990, end: 9999, contentRange: "bytes 9990-9999/10000"},
+		{rangeHdr: "", code: http.StatusOK, start: 0, end: 9999},
+		{rangeHdr: "bytes=20000-", code: http.StatusRequestedRangeNotSatisfiable, contentRange: "bytes */10000"},
+	}
+	for _, test := range tests {
+		resp, err := slicer.Get(test.rangeHdr)
+		if err != nil {
+			t.Fatalf("Slicer.Get('%v') expected nil error, actual %v", test.rangeHdr, err)
+		}
+		if resp.Code != test.code {
+			t.Errorf("Slicer.Get('%v') expected code %v, actual %v", test.rangeHdr, test.code, resp.Code)
+			continue
+		}
+		if actual := resp.Hdr.Get("Content-Range"); actual != test.contentRange {
+			t.Errorf("Slicer.Get('%v') expected Content-Range '%v', actual '%v'", test.rangeHdr, test.contentRange, actual)
+		}
+		if test.code == http.StatusRequestedRangeNotSatisfiable {
+			continue
+		}
+		if actual := sliceBody(t, resp); !bytes.Equal(actual, body[test.start:test.end+1]) {
+			t.Errorf("Slicer.Get('%v') expected body bytes %v-%v, actual len %v", test.rangeHdr, test.start, test.end, len(actual))
+		}
+		if actual := resp.Hdr.Get("Content-Length"); actual != strconv.Itoa(test.end-test.start+1) {
+			t.Errorf("Slicer.Get('%v') expected Content-Length %v, actual %v", test.rangeHdr, test.end-test.start+1, actual)
+		}
+	}
+
+	// every block has now been fetched once, plus the unsatisfiable block, so further requests must be served entirely from the cache.
+	if requests := atomic.LoadUint64(&origin.requests); requests != 11 {
+		t.Errorf("Slicer.Get expected 11 block requests to the origin, actual %v", requests)
+	}
+	resp, err := slicer.Get("bytes=0-9999")
+	if err != nil {
+		t.Fatalf("Slicer.Get expected nil error, actual %v", err)
+	}
+	sliceBody(t, resp)
+	if resp.Reuse != rfc.ReuseCan {
+		t.Errorf("Slicer.Get of cached blocks expected reuse %v, actual %v", rfc.ReuseCan, resp.Reuse)
+	}
+	if requests := atomic.LoadUint64(&origin.requests); requests != 11 {
+		t.Errorf("Slicer.Get of cached blocks expected no new origin requests, actual %v total", requests)
+	}
+	if _, ok := slicer.RemappingProducer.Cache().Get(BlockCacheKey(slicer.RemappingProducer.CacheKey(), 0)); !ok {
+		t.Errorf("Slicer.Get expected block 0 to be cached under its block key, actual not cached")
+	}
+}
+
+func TestSlicerGetInconsistent(t *testing.T) {
+	origin := &testOrigin{}
+	origin.set(testBody(3000), `"v1"`)
+	server := httptest.NewServer(origin)
+	defer server.Close()
+
+	const blockSize = 1000
+	slicer := newTestSlicer(t, server.URL, 1<<20, blockSize, "/obj")
+	resp, err := slicer.Get("bytes=0-999")
+	if err != nil {
+		t.Fatalf("Slicer.Get expected nil error, actual %v", err)
+	}
+	sliceBody(t, resp)
+
+	// the object changes at the origin, but block 0 is still cached. The new block 1 is inconsistent with it, so all blocks must be refetched.
+	newBody := bytes.Repeat([]byte("x"), 3000)
+	origin.set(newBody, `"v2"`)
+	resp, err = slicer.Get("bytes=500-1499")
+	if err != nil {
+		t.Fatalf("Slicer.Get expected nil error, actual %v", err)
+	}
+	if !bytes.Equal(sliceBody(t, resp), newBody[500:1500]) {
+		t.Errorf("Slicer.Get of a changed object expected the new object's bytes, actual mixed or old bytes")
+	}
+	if etag := resp.Hdr.Get("ETag"); etag != `"v2"` {
+		t.Errorf("Slicer.Get of a changed object expected ETag v2, actual %v", etag)
+	}
+}
+
+func TestSlicerWriteBodyStreams(t *testing.T) {
+	body := testBody(5000)
+	origin := &testOrigin{}
+	origin.set(body, `"v1"`)
+	server := httptest.NewServer(origin)
+	defer server.Close()
+
+	const blockSize = 1000
+	slicer := newTestSlicer(t, server.URL, 1<<20, blockSize, "/obj")
+	resp, err := slicer.Get("")
+	if err != nil {
+		t.Fatalf("Slicer.Get expected nil error, actual %v", err)
+	}
+	if !resp.Sliced() || resp.Body != nil {
+		t.Fatalf("Slicer.Get expected a sliced response without a body, actual sliced %v body len %v", resp.Sliced(), len(resp.Body))
+	}
+	// only the first and last blocks are fetched before the body is written.
+	if requests := atomic.LoadUint64(&origin.requests); requests != 2 {
+		t.Errorf("Slicer.Get expected 2 block requests before writing the body, actual %v", requests)
+	}
+	if actual := sliceBody(t, resp); !bytes.Equal(actual, body) {
+		t.Errorf("SlicedResp.WriteBody expected the whole object, actual len %v", len(actual))
+	}
+	if requests := atomic.LoadUint64(&origin.requests); requests != 5 {
+		t.Errorf("SlicedResp.WriteBody expected 5 block requests, actual %v", requests)
+	}
+}
+
+func TestSlicerWriteBodyInconsistent(t *testing.T) {
+	origin := &testOrigin{}
+	origin.set(testBody(3000), `"v1"`)
+	server := httptest.NewServer(origin)
+	defer server.Close()
+
+	const blockSize = 1000
+	slicer := newTestSlicer(t, server.URL, 1<<20, blockSize, "/obj")
+	resp, err := slicer.Get("")
+	if err != nil {
+		t.Fatalf("Slicer.Get expected nil error, actual %v", err)
+	}
+
+	// the object changes after the headers were determined, so the middle block can't be written.
+	newBody := bytes.Repeat([]byte("x"), 3000)
+	origin.set(newBody, `"v2"`)
+	buf := &bytes.Buffer{}
+	if _, err := resp.WriteBody(buf); err != ErrSliceInconsistent {
+		t.Fatalf("SlicedResp.WriteBody of a changed object expected ErrSliceInconsistent, actual %v", err)
+	}
+
+	// the stale first block was refetched, so the next request gets the new object.
+	resp, err = slicer.Get("")
+	if err != nil {
+		t.Fatalf("Slicer.Get expected nil error, actual %v", err)
+	}
+	if actual := sliceBody(t, resp); !bytes.Equal(actual, newBody) {
+		t.Errorf("Slicer.Get after an inconsistent response expected the new object, actual mixed or old bytes")
+	}
+}
+
+func TestSlicerGetWhole(t *testing.T) {
+	body := testBody(3000)
+	origin := &testOrigin{ignoreRange: true}
+	origin.set(body, `"v1"`)
+	server := httptest.NewServer(origin)
+	defer server.Close()
+
+	slicer := newTestSlicer(t, server.URL, 1<<20, 1000, "/obj")
+	for _, rng := range []struct {
+		hdr        string
+		start, end int
+	}{{"bytes=1500-1599", 1500, 1599}, {"bytes=0-99", 0, 99}, {"bytes=2500-", 2500, 2999}} {
+		resp, err := slicer.Get(rng.hdr)
+		if err != nil {
+			t.Fatalf("Slicer.Get('%v') expected nil error, actual %v", rng.hdr, err)
+		}
+		if resp.Code != http.StatusPartialContent || resp.Sliced() {
+			t.Errorf("Slicer.Get('%v') of a whole object expected an unsliced %v, actual sliced %v code %v", rng.hdr, http.StatusPartialContent, resp.Sliced(), resp.Code)
+		}
+		if actual := sliceBody(t, resp); !bytes.Equal(actual, body[rng.start:rng.end+1]) {
+			t.Errorf("Slicer.Get('%v') of a whole object expected body bytes %v-%v, actual len %v", rng.hdr, rng.start, rng.end, len(actual))
+		}
+	}
+
+	// the whole object is cached under its own key, and served from there, not as a block.
+	if requests := atomic.LoadUint64(&origin.requests); requests != 1 {
+		t.Errorf("Slicer.Get of a cached whole object expected 1 origin request, actual %v", requests)
+	}
+	cache, key := slicer.RemappingProducer.Cache(), slicer.RemappingProducer.CacheKey()
+	if obj, ok := cache.Get(key); !ok || len(obj.Body) != len(body) {
+		t.Errorf("Slicer.Get expected the whole object to be cached under its own key")
+	}
+	for _, blockNum := range []int64{0, 1} {
+		if _, ok := cache.Get(BlockCacheKey(key, blockNum)); ok {
+			t.Errorf("Slicer.Get expected the whole object not to be cached under block %v's key", blockNum)
+		}
+	}
+}
+
+func TestSlicerGetNotFound(t *testing.T) {
+	origin := &testOrigin{}
+	server := httptest.NewServer(origin)
+	defer server.Close()
+
+	slicer := newTestSlicer(t, server.URL, 1<<20, 1000, "/missing")
+	resp, err := slicer.Get("bytes=0-10")
+	if err != nil {
+		t.Fatalf("Slicer.Get expected nil error, actual %v", err)
+	}
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("Slicer.Get of a missing object expected code %v, actual %v", http.StatusNotFound, resp.Code)
+	}
+}
+
+func sliceBody(t *testing.T, resp *SlicedResp) []byte {
+	buf := &bytes.Buffer{}
+	if _, err := resp.WriteBody(buf); err != nil {
+		t.Fatalf("SlicedResp.WriteBody expected nil error, actual %v", err)
+	}
+	return buf.Bytes()
+}
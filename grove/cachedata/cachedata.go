@@ -33,6 +33,8 @@ type ParentRespData struct {
 	OriginConnectFailed bool
 	OriginBytes         uint64
 	ProxyStr            string
+	// Negative is whether the response is a negatively cached object, that is, an error response cached for its remap rule's negative caching TTL.
+	Negative bool
 }
 
 // HandlerData contains data generally held by the Handler, and known as soon as the request is received.
@@ -55,4 +57,6 @@ type RespData struct {
 	BytesWritten uint64
 	RespSuccess  bool
 	CacheHit     bool
+	// NegativeCacheHit is whether the response was a cache hit of a negatively cached object. These are also cache hits, but are counted separately in stats.
+	NegativeCacheHit bool
 }
@@ -35,6 +35,13 @@ type CacheObj struct {
 	LastModified     time.Time // the origin LastModified if it exists, or Date if it doesn't
 	Size             uint64
 	HitCount         uint64 // the number of times this object was hit
+	// NegativeExpiry is when the object expires, if it was negatively cached, that is, cached for a configured TTL because of its error code, rather than per its HTTP cache headers. It is zero for all other objects.
+	NegativeExpiry time.Time
+}
+
+// Negative returns whether the object was negatively cached.
+func (c *CacheObj) Negative() bool {
+	return !c.NegativeExpiry.IsZero()
 }
 
 // ComputeSize computes the size of the given CacheObj. This computation is expensive, as the headers must be iterated over. Thus, the size should be computed once and stored, not computed on-the-fly for every new request for the cached object.
@@ -75,6 +82,20 @@ func CanReuse(
 	strictRFC bool,
 	revalidateCanReuse bool,
 ) bool {
-	canReuse := rfc.CanReuseStored(reqHeader, cacheObj.RespHeaders, reqCacheControl, cacheObj.RespCacheControl, cacheObj.ReqHeaders, cacheObj.ReqRespTime, cacheObj.RespRespTime, strictRFC)
+	canReuse := ReuseStored(reqHeader, reqCacheControl, cacheObj, strictRFC)
 	return canReuse == rfc.ReuseCan || (canReuse == rfc.ReuseMustRevalidate && revalidateCanReuse)
 }
+
+// ReuseStored returns whether the stored cacheObj can be reused for the request. Negatively cached objects can be reused until they expire, after which they must be fetched anew, since there is nothing to revalidate. All other objects are reused per github.com/apache/trafficcontrol/lib/go-rfc.CanReuseStored.
+func ReuseStored(reqHeader http.Header, reqCacheControl rfc.CacheControlMap, cacheObj *CacheObj, strictRFC bool) rfc.Reuse {
+	if !cacheObj.Negative() {
+		return rfc.CanReuseStored(reqHeader, cacheObj.RespHeaders, reqCacheControl, cacheObj.RespCacheControl, cacheObj.ReqHeaders, cacheObj.ReqRespTime, cacheObj.RespRespTime, strictRFC)
+	}
+	if strictRFC && reqCacheControl.Has("no-cache") {
+		return rfc.ReuseCannot
+	}
+	if time.Now().Before(cacheObj.NegativeExpiry) {
+		return rfc.ReuseCan
+	}
+	return rfc.ReuseCannot
+}
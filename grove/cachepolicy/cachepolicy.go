@@ -0,0 +1,219 @@
+package cachepolicy
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// cachepolicy provides the admission and eviction policies used by icache.Cache implementations.
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+
+	"github.com/apache/trafficcontrol/grove/config"
+	"github.com/apache/trafficcontrol/grove/lru"
+)
+
+// Evictor orders cached keys for eviction. Implementations must be safe for concurrent use.
+type Evictor interface {
+	// Add adds the key with the given size, or marks it as used if it already exists. Returns the old size, or 0 if the key didn't exist.
+	Add(key string, size uint64) uint64
+	// RemoveOldest removes the next key to evict, and returns its key, size, and true; or false if there are no keys.
+	RemoveOldest() (string, uint64, bool)
+	// Oldest returns the next key to evict, without removing it.
+	Oldest() (string, uint64, bool)
+	Contains(key string) bool
+	Keys() []string
+}
+
+// Admitter decides whether new objects are added to a full cache. Implementations must be safe for concurrent use.
+type Admitter interface {
+	// Record records a request for the given key, whether or not it was cached.
+	Record(key string)
+	// Admit returns whether the candidate key should be added, at the cost of evicting the victim key.
+	Admit(candidate string, victim string) bool
+}
+
+type EvictionType string
+
+const (
+	EvictionTypeLRU     = EvictionType("lru")
+	EvictionTypeSLRU    = EvictionType("slru")
+	EvictionTypeInvalid = EvictionType("")
+)
+
+func EvictionTypeFromString(s string) EvictionType {
+	switch strings.ToLower(s) {
+	case "", "lru":
+		return EvictionTypeLRU
+	case "slru":
+		return EvictionTypeSLRU
+	default:
+		return EvictionTypeInvalid
+	}
+}
+
+type AdmissionType string
+
+const (
+	AdmissionTypeAll     = AdmissionType("all")
+	AdmissionTypeTinyLFU = AdmissionType("tinylfu")
+	AdmissionTypeInvalid = AdmissionType("")
+)
+
+func AdmissionTypeFromString(s string) AdmissionType {
+	switch strings.ToLower(s) {
+	case "", "all":
+		return AdmissionTypeAll
+	case "tinylfu":
+		return AdmissionTypeTinyLFU
+	default:
+		return AdmissionTypeInvalid
+	}
+}
+
+const DefaultProtectedRatio = 0.8
+
+// DefaultSketchWidth is the default number of counters in each row of the TinyLFU sketch. It should be on the order of the number of objects in the cache.
+const DefaultSketchWidth = 1 << 16
+
+// Policy is the admission and eviction policy of a cache.
+type Policy struct {
+	Evictor
+	// Admitter may be nil, in which case all objects are admitted.
+	Admitter Admitter
+	Stats    *Stats
+	Name     string
+}
+
+// Default returns an LRU policy which admits everything.
+func Default() *Policy {
+	return &Policy{Evictor: lru.NewLRU(), Stats: &Stats{}, Name: string(EvictionTypeLRU)}
+}
+
+// New creates a new Policy from the given config, for a cache of the given capacity. The stats may be shared by multiple policies, for example when a cache is split across multiple files; if nil, new stats are created.
+func New(cfg config.CachePolicy, capacityBytes uint64, stats *Stats) (*Policy, error) {
+	if stats == nil {
+		stats = &Stats{}
+	}
+	p := &Policy{Stats: stats}
+
+	switch EvictionTypeFromString(cfg.Eviction) {
+	case EvictionTypeLRU:
+		p.Evictor = lru.NewLRU()
+		p.Name = string(EvictionTypeLRU)
+	case EvictionTypeSLRU:
+		ratio := cfg.ProtectedRatio
+		if ratio == 0 {
+			ratio = DefaultProtectedRatio
+		}
+		if ratio < 0 || ratio > 1 {
+			return nil, errors.New("protected ratio must be between 0 and 1")
+		}
+		p.Evictor = lru.NewSLRU(uint64(float64(capacityBytes) * ratio))
+		p.Name = string(EvictionTypeSLRU)
+	default:
+		return nil, errors.New("unknown eviction '" + cfg.Eviction + "'")
+	}
+
+	switch AdmissionTypeFromString(cfg.Admission) {
+	case AdmissionTypeAll:
+	case AdmissionTypeTinyLFU:
+		width := cfg.SketchWidth
+		if width == 0 {
+			width = DefaultSketchWidth
+		}
+		if width < 0 {
+			return nil, errors.New("sketch width must be positive")
+		}
+		p.Admitter = NewTinyLFU(width)
+		p.Name = string(AdmissionTypeTinyLFU) + "+" + p.Name
+	default:
+		return nil, errors.New("unknown admission '" + cfg.Admission + "'")
+	}
+	return p, nil
+}
+
+// Admit returns whether the key of the given size should be added to the cache, which currently holds sizeBytes of maxSizeBytes. Objects are always admitted if they're already in the cache (i.e. they're being updated), if they fit, or if there's no Admitter.
+func (p *Policy) Admit(key string, size uint64, sizeBytes uint64, maxSizeBytes uint64) bool {
+	if p.Evictor.Contains(key) {
+		return true
+	}
+	if p.Admitter == nil || sizeBytes+size <= maxSizeBytes {
+		p.Stats.AddAdmitted()
+		return true
+	}
+	victim, _, ok := p.Evictor.Oldest()
+	if !ok || p.Admitter.Admit(key, victim) {
+		p.Stats.AddAdmitted()
+		return true
+	}
+	p.Stats.AddRejected()
+	return false
+}
+
+// Record records a request for the key, and whether it was a hit.
+func (p *Policy) Record(key string, hit bool) {
+	if p.Admitter != nil {
+		p.Admitter.Record(key)
+	}
+	if hit {
+		p.Stats.AddHit()
+	} else {
+		p.Stats.AddMiss()
+	}
+}
+
+// TierStats are the policy stats of one tier of a cache, for example the memory or disk tier of a disk cache.
+type TierStats struct {
+	Tier   string
+	Policy string
+	Stats  *Stats
+}
+
+// Stats are the counters of a Policy. All members are atomic, and MUST NOT be accessed without sync/atomic.
+type Stats struct {
+	hits      uint64
+	misses    uint64
+	admitted  uint64
+	rejected  uint64
+	evictions uint64
+}
+
+func (s *Stats) AddHit()        { atomic.AddUint64(&s.hits, 1) }
+func (s *Stats) AddMiss()       { atomic.AddUint64(&s.misses, 1) }
+func (s *Stats) AddAdmitted()   { atomic.AddUint64(&s.admitted, 1) }
+func (s *Stats) AddRejected()   { atomic.AddUint64(&s.rejected, 1) }
+func (s *Stats) AddEviction()   { atomic.AddUint64(&s.evictions, 1) }
+func (s *Stats) Hits() uint64   { return atomic.LoadUint64(&s.hits) }
+func (s *Stats) Misses() uint64 { return atomic.LoadUint64(&s.misses) }
+func (s *Stats) Admitted() uint64 {
+	return atomic.LoadUint64(&s.admitted)
+}
+func (s *Stats) Rejected() uint64 {
+	return atomic.LoadUint64(&s.rejected)
+}
+func (s *Stats) Evictions() uint64 {
+	return atomic.LoadUint64(&s.evictions)
+}
+
+// HitRatio returns the ratio of hits to requests, or 0 if there have been no requests.
+func (s *Stats) HitRatio() float64 {
+	hits := s.Hits()
+	total := hits + s.Misses()
+	if total == 0 {
+		return 0
+	}
+	return float64(hits) / float64(total)
+}
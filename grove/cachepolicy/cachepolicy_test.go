@@ -0,0 +1,213 @@
+package cachepolicy
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/apache/trafficcontrol/grove/config"
+)
+
+// traceFile defaults to a synthetic trace, described in testdata/README.md.
+var traceFile = flag.String("trace", "testdata/synthetic_trace.txt", "the access trace to benchmark policies against")
+
+// traceCapacity is the cache size used when simulating the test trace. It's small relative to the trace's working set, so the policies differ.
+const traceCapacity = 100 * 1000 * 1000
+
+func loadTestTrace(t testing.TB) []Access {
+	f, err := os.Open(*traceFile)
+	if err != nil {
+		t.Fatalf("opening trace '%v': %v", *traceFile, err)
+	}
+	defer f.Close()
+	trace, err := LoadTrace(f)
+	if err != nil {
+		t.Fatalf("loading trace '%v': %v", *traceFile, err)
+	}
+	return trace
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		cfg  config.CachePolicy
+		name string
+		err  bool
+	}{
+		{cfg: config.CachePolicy{}, name: "lru"},
+		{cfg: config.CachePolicy{Eviction: "SLRU"}, name: "slru"},
+		{cfg: config.CachePolicy{Eviction: "slru", Admission: "tinylfu"}, name: "tinylfu+slru"},
+		{cfg: config.CachePolicy{Admission: "all"}, name: "lru"},
+		{cfg: config.CachePolicy{Eviction: "fifo"}, err: true},
+		{cfg: config.CachePolicy{Admission: "never"}, err: true},
+		{cfg: config.CachePolicy{Eviction: "slru", ProtectedRatio: 1.5}, err: true},
+	}
+	for _, test := range tests {
+		p, err := New(test.cfg, 1000, nil)
+		if test.err {
+			if err == nil {
+				t.Errorf("New(%+v) expected error, actual nil", test.cfg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("New(%+v) expected nil error, actual %v", test.cfg, err)
+			continue
+		}
+		if p.Name != test.name {
+			t.Errorf("New(%+v) expected name %v, actual %v", test.cfg, test.name, p.Name)
+		}
+	}
+}
+
+func TestCountMinSketch(t *testing.T) {
+	s := NewCountMinSketch(1000)
+	for i := 0; i < 5; i++ {
+		s.Increment("foo")
+	}
+	s.Increment("bar")
+	if est := s.Estimate("foo"); est < 5 {
+		t.Errorf("CountMinSketch.Estimate expected >= 5, actual %v", est)
+	}
+	if est := s.Estimate("bar"); est < 1 {
+		t.Errorf("CountMinSketch.Estimate expected >= 1, actual %v", est)
+	}
+	for i := 0; i < MaxSketchCount*2; i++ {
+		s.Increment("baz")
+	}
+	if est := s.Estimate("baz"); est != MaxSketchCount {
+		t.Errorf("CountMinSketch.Estimate expected saturated %v, actual %v", MaxSketchCount, est)
+	}
+}
+
+func TestCountMinSketchAging(t *testing.T) {
+	s := NewCountMinSketch(16)
+	for i := 0; i < 8; i++ {
+		s.Increment("foo")
+	}
+	before := s.Estimate("foo")
+	for i := 0; i < 16*SampleFactor; i++ {
+		s.Increment("other" + strconv.Itoa(i))
+	}
+	if after := s.Estimate("foo"); after >= before {
+		t.Errorf("CountMinSketch.Estimate after aging expected < %v, actual %v", before, after)
+	}
+}
+
+func TestTinyLFUAdmit(t *testing.T) {
+	p, err := New(config.CachePolicy{Admission: "tinylfu", SketchWidth: 1024}, 2, nil)
+	if err != nil {
+		t.Fatalf("New expected nil error, actual %v", err)
+	}
+
+	p.Record("popular", false)
+	if !p.Admit("popular", 1, 0, 2) {
+		t.Fatalf("Policy.Admit with free space expected true, actual false")
+	}
+	p.Add("popular", 1)
+	p.Record("popular", true)
+	p.Record("popular", true)
+
+	p.Record("once", false)
+	if p.Admit("once", 1, 2, 2) {
+		t.Errorf("Policy.Admit of a less frequent key than the victim expected false, actual true")
+	}
+	if !p.Admit("popular", 1, 2, 2) {
+		t.Errorf("Policy.Admit of an existing key expected true, actual false")
+	}
+
+	for i := 0; i < 5; i++ {
+		p.Record("newpopular", false)
+	}
+	if !p.Admit("newpopular", 1, 2, 2) {
+		t.Errorf("Policy.Admit of a more frequent key than the victim expected true, actual false")
+	}
+
+	if p.Stats.Rejected() != 1 {
+		t.Errorf("Policy.Stats.Rejected expected 1, actual %v", p.Stats.Rejected())
+	}
+	if p.Stats.Hits() != 2 || p.Stats.Misses() != 7 {
+		t.Errorf("Policy.Stats expected 2 hits 7 misses, actual %v hits %v misses", p.Stats.Hits(), p.Stats.Misses())
+	}
+}
+
+func TestLoadTrace(t *testing.T) {
+	trace, err := LoadTrace(strings.NewReader("# comment\n/foo 100\n\n/bar\n"))
+	if err != nil {
+		t.Fatalf("LoadTrace expected nil error, actual %v", err)
+	}
+	if len(trace) != 2 || trace[0] != (Access{Key: "/foo", Size: 100}) || trace[1] != (Access{Key: "/bar", Size: 1}) {
+		t.Errorf("LoadTrace expected [/foo 100, /bar 1], actual %+v", trace)
+	}
+	if _, err := LoadTrace(strings.NewReader("/foo bar\n")); err == nil {
+		t.Errorf("LoadTrace with malformed size expected error, actual nil")
+	}
+}
+
+// TestSimulateTrace verifies TinyLFU and SLRU outperform plain LRU on a trace with one-hit-wonder scans.
+func TestSimulateTrace(t *testing.T) {
+	trace := loadTestTrace(t)
+	ratios := map[string]float64{}
+	for _, cfg := range []config.CachePolicy{
+		{Eviction: "lru"},
+		{Eviction: "slru"},
+		{Eviction: "slru", Admission: "tinylfu"},
+	} {
+		p, err := New(cfg, traceCapacity, nil)
+		if err != nil {
+			t.Fatalf("New(%+v) expected nil error, actual %v", cfg, err)
+		}
+		ratios[p.Name] = Simulate(p, traceCapacity, trace).HitRatio()
+	}
+	if ratios["slru"] <= ratios["lru"] {
+		t.Errorf("Simulate expected slru hit ratio > lru %v, actual %v", ratios["lru"], ratios["slru"])
+	}
+	if ratios["tinylfu+slru"] <= ratios["lru"] {
+		t.Errorf("Simulate expected tinylfu+slru hit ratio > lru %v, actual %v", ratios["lru"], ratios["tinylfu+slru"])
+	}
+}
+
+func benchmarkTrace(b *testing.B, cfg config.CachePolicy) {
+	trace := loadTestTrace(b)
+	hitRatio := 0.0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p, err := New(cfg, traceCapacity, nil)
+		if err != nil {
+			b.Fatalf("New(%+v) expected nil error, actual %v", cfg, err)
+		}
+		hitRatio = Simulate(p, traceCapacity, trace).HitRatio()
+	}
+	b.ReportMetric(hitRatio, "hit-ratio")
+}
+
+func BenchmarkTraceLRU(b *testing.B) {
+	benchmarkTrace(b, config.CachePolicy{Eviction: "lru"})
+}
+
+func BenchmarkTraceSLRU(b *testing.B) {
+	benchmarkTrace(b, config.CachePolicy{Eviction: "slru"})
+}
+
+func BenchmarkTraceTinyLFULRU(b *testing.B) {
+	benchmarkTrace(b, config.CachePolicy{Eviction: "lru", Admission: "tinylfu"})
+}
+
+func BenchmarkTraceTinyLFUSLRU(b *testing.B) {
+	benchmarkTrace(b, config.CachePolicy{Eviction: "slru", Admission: "tinylfu"})
+}
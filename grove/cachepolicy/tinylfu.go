@@ -0,0 +1,123 @@
+package cachepolicy
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"sync"
+
+	"github.com/dchest/siphash"
+)
+
+// SketchDepth is the number of rows in the count-min sketch.
+const SketchDepth = 4
+
+// MaxSketchCount is the maximum value of a sketch counter. TinyLFU only needs to distinguish frequencies up to about the sample size divided by the cache size, so small counters suffice.
+const MaxSketchCount = 15
+
+// SampleFactor is the number of recorded requests, as a multiple of the sketch width, after which all counters are halved. This ages the sketch, so keys which were popular long ago don't stay admitted forever.
+const SampleFactor = 10
+
+// TinyLFU is an Admitter which admits a candidate only if it has been requested more frequently than the victim it would evict. Frequencies are approximated by a count-min sketch, which is periodically aged.
+//
+// See "TinyLFU: A Highly Efficient Cache Admission Policy" by Einziger, Friedman, and Manes.
+type TinyLFU struct {
+	sketch *CountMinSketch
+}
+
+func NewTinyLFU(width int) *TinyLFU {
+	return &TinyLFU{sketch: NewCountMinSketch(width)}
+}
+
+func (t *TinyLFU) Record(key string) {
+	t.sketch.Increment(key)
+}
+
+func (t *TinyLFU) Admit(candidate string, victim string) bool {
+	return t.sketch.Estimate(candidate) > t.sketch.Estimate(victim)
+}
+
+// CountMinSketch approximates the number of times keys have been seen, in constant space. Estimates never undercount, except by aging. It is safe for concurrent use.
+type CountMinSketch struct {
+	rows      [SketchDepth][]uint8
+	mask      uint64
+	additions int
+	sampleMax int
+	m         sync.Mutex
+}
+
+// NewCountMinSketch creates a new sketch with the given number of counters per row, rounded up to a power of 2.
+func NewCountMinSketch(width int) *CountMinSketch {
+	w := 1
+	for w < width {
+		w <<= 1
+	}
+	s := &CountMinSketch{mask: uint64(w - 1), sampleMax: w * SampleFactor}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, w)
+	}
+	return s
+}
+
+// indexes returns the counter index of the key in each row. Each row uses a different half of one of two 64-bit hashes, so only two hashes are computed per key.
+func (s *CountMinSketch) indexes(key string) [SketchDepth]uint64 {
+	h0 := siphash.Hash(0, 0, []byte(key))
+	h1 := siphash.Hash(1, 1, []byte(key))
+	return [SketchDepth]uint64{
+		h0 & s.mask,
+		(h0 >> 32) & s.mask,
+		h1 & s.mask,
+		(h1 >> 32) & s.mask,
+	}
+}
+
+// Increment increments the count of the given key, aging the sketch if the sample size is reached.
+func (s *CountMinSketch) Increment(key string) {
+	idxs := s.indexes(key)
+	s.m.Lock()
+	defer s.m.Unlock()
+	for i, idx := range idxs {
+		if s.rows[i][idx] < MaxSketchCount {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.sampleMax {
+		s.age()
+	}
+}
+
+// Estimate returns the estimated count of the given key.
+func (s *CountMinSketch) Estimate(key string) uint8 {
+	idxs := s.indexes(key)
+	s.m.Lock()
+	defer s.m.Unlock()
+	min := uint8(MaxSketchCount)
+	for i, idx := range idxs {
+		if s.rows[i][idx] < min {
+			min = s.rows[i][idx]
+		}
+	}
+	return min
+}
+
+// age halves every counter. Must be called with the mutex locked.
+func (s *CountMinSketch) age() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
@@ -0,0 +1,84 @@
+package cachepolicy
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Access is a single request in an access trace.
+type Access struct {
+	Key  string
+	Size uint64
+}
+
+// LoadTrace reads an access trace, for simulating policies. The trace has one request per line, of the form `key size`, where the size in bytes is optional and defaults to 1. Blank lines and lines beginning with `#` are ignored.
+func LoadTrace(r io.Reader) ([]Access, error) {
+	trace := []Access{}
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		access := Access{Key: fields[0], Size: 1}
+		if len(fields) > 1 {
+			size, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return nil, errors.New("line " + strconv.Itoa(lineNum) + ": malformed size '" + fields[1] + "'")
+			}
+			access.Size = size
+		}
+		trace = append(trace, access)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New("reading trace: " + err.Error())
+	}
+	return trace, nil
+}
+
+// Simulate replays the trace against a cache of capacityBytes using the given policy, the same way MemCache uses its policy, and returns the policy's stats. This allows comparing the hit ratios of policies for a recorded workload, without a real cache.
+func Simulate(policy *Policy, capacityBytes uint64, trace []Access) *Stats {
+	sizeBytes := uint64(0)
+	for _, access := range trace {
+		if policy.Contains(access.Key) {
+			policy.Add(access.Key, access.Size)
+			policy.Record(access.Key, true)
+			continue
+		}
+		policy.Record(access.Key, false)
+		if !policy.Admit(access.Key, access.Size, sizeBytes, capacityBytes) {
+			continue
+		}
+		sizeBytes += access.Size
+		policy.Add(access.Key, access.Size)
+		for sizeBytes > capacityBytes {
+			_, size, ok := policy.RemoveOldest()
+			if !ok {
+				break
+			}
+			sizeBytes -= size
+			policy.Stats.AddEviction()
+		}
+	}
+	return policy.Stats
+}
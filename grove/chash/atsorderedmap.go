@@ -21,6 +21,8 @@ import (
 	"sort"
 	"strconv"
 	"time"
+
+	"github.com/apache/trafficcontrol/grove/parenthealth"
 )
 
 // func NewATSHashRing(vals []string) HashRing {
@@ -46,6 +48,8 @@ type ATSConsistentHashNode struct {
 	Name      string
 	ProxyURL  *url.URL
 	Transport *http.Transport
+	// Health is the shared health of the parent. It may be nil, in which case the parent is always available.
+	Health *parenthealth.Parent
 	// pRecord fields (ParentSelection.h)
 	Hostname  string
 	Port      int
@@ -61,6 +61,10 @@ type Config struct {
 	CacheFiles           map[string][]CacheFile `json:"cache_files"`
 	// FileMemBytes is the amount of memory to use as an LRU in front of each name in CacheFiles, that is, each named group of files. E.g. if there are 10 files, the amount of memory used will be 10*FileMemBytes+CacheSizeBytes.
 	FileMemBytes int `json:"file_mem_bytes"`
+	// CachePolicy is the admission and eviction policy of the default memory cache.
+	CachePolicy CachePolicy `json:"cache_policy"`
+	// CachePolicies are the admission and eviction policies of each name in CacheFiles. Names without a policy use LRU and admit everything.
+	CachePolicies map[string]CachePolicy `json:"cache_policies"`
 }
 
 type CacheFile struct {
@@ -68,6 +72,18 @@ type CacheFile struct {
 	Bytes uint64 `json:"size_bytes"`
 }
 
+// CachePolicy is the admission and eviction policy of a cache. The zero value is LRU eviction, admitting every object.
+type CachePolicy struct {
+	// Eviction is the eviction policy, "lru" or "slru".
+	Eviction string `json:"eviction"`
+	// Admission is the admission policy, "all" or "tinylfu".
+	Admission string `json:"admission"`
+	// ProtectedRatio is the fraction of the cache size used for the SLRU protected segment.
+	ProtectedRatio float64 `json:"protected_ratio"`
+	// SketchWidth is the number of counters in each row of the TinyLFU count-min sketch. It should be about the number of objects the cache holds.
+	SketchWidth int `json:"sketch_width"`
+}
+
 func (c Config) ErrorLog() log.LogLocation {
 	return log.LogLocation(c.LogLocationError)
 }
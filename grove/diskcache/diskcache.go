@@ -22,7 +22,7 @@ import (
 	"time"
 
 	"github.com/apache/trafficcontrol/grove/cacheobj"
-	"github.com/apache/trafficcontrol/grove/lru"
+	"github.com/apache/trafficcontrol/grove/cachepolicy"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
 
@@ -33,12 +33,17 @@ type DiskCache struct {
 	db           *bolt.DB
 	sizeBytes    uint64
 	maxSizeBytes uint64
-	lru          *lru.LRU
+	lru          *cachepolicy.Policy
 }
 
 const BucketName = "b"
 
-func New(path string, cacheSizeBytes uint64) (*DiskCache, error) {
+// New creates a new DiskCache with the given file path, capacity, and policy. If policy is nil, the cache uses LRU eviction and admits every object.
+func New(path string, cacheSizeBytes uint64, policy *cachepolicy.Policy) (*DiskCache, error) {
+	if policy == nil {
+		policy = cachepolicy.Default()
+	}
+
 	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
 	if err != nil {
 		return nil, errors.New("opening database '" + path + "': " + err.Error())
@@ -54,7 +59,7 @@ func New(path string, cacheSizeBytes uint64) (*DiskCache, error) {
 		return nil, errors.New("creating bucket for database '" + path + "': " + err.Error())
 	}
 
-	return &DiskCache{db: db, maxSizeBytes: cacheSizeBytes, lru: lru.NewLRU(), sizeBytes: 0}, nil
+	return &DiskCache{db: db, maxSizeBytes: cacheSizeBytes, lru: policy, sizeBytes: 0}, nil
 }
 
 // ResetAfterRestart rebuilds the LRU with an arbirtrary order and sets sizeBytes. This seems crazy, but it is better than doing nothing, sice gc is based on the LRU and sizeBytes. In the future, we may want to periodically sync the LRU to disk, but we'll still need to iterate over all keys in the disk DB to avoid orphaning objects.
@@ -94,6 +99,11 @@ func (c *DiskCache) Add(key string, val *cacheobj.CacheObj) bool {
 	}
 	valBytes := buf.Bytes()
 
+	if !c.lru.Admit(key, uint64(len(valBytes)), atomic.LoadUint64(&c.sizeBytes), c.maxSizeBytes) {
+		log.Debugf("DiskCache.Add key '%v' not admitted by policy %v\n", key, c.lru.Name)
+		return eviction
+	}
+
 	err := c.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketName))
 		if b == nil {
@@ -143,6 +153,7 @@ func (c *DiskCache) gc(cacheSizeBytes uint64) {
 		if err != nil {
 			log.Errorln("removing '" + key + "' from cache: " + err.Error())
 		}
+		c.lru.Stats.AddEviction()
 
 		cacheSizeBytes = atomic.AddUint64(&c.sizeBytes, ^uint64(sizeBytes-1)) // subtract sizeBytes
 	}
@@ -151,6 +162,7 @@ func (c *DiskCache) gc(cacheSizeBytes uint64) {
 // Get takes a key, and returns its value, and whether it was found, and updates the lru-ness and hitcount
 func (c *DiskCache) Get(key string) (*cacheobj.CacheObj, bool) {
 	val, found := c.Peek(key)
+	c.lru.Record(key, found)
 	if found {
 		c.lru.Add(key, val.Size) // TODO directly call c.ll.MoveToFront
 		log.Debugln("DiskCache.Get getting '" + key + "' from cache and updating LRU")
@@ -211,3 +223,9 @@ func (c *DiskCache) Keys() []string {
 func (c *DiskCache) Capacity() uint64 {
 	return c.maxSizeBytes
 }
+
+const PolicyTier = "disk"
+
+func (c *DiskCache) PolicyStats() []cachepolicy.TierStats {
+	return []cachepolicy.TierStats{{Tier: PolicyTier, Policy: c.lru.Name, Stats: c.lru.Stats}}
+}
@@ -18,6 +18,7 @@ import (
 	"errors"
 
 	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/cachepolicy"
 	"github.com/apache/trafficcontrol/grove/config"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
@@ -28,10 +29,16 @@ import (
 // MultiDiskCache is a disk cache using multiple files. It exists primarily to allow caching across multiple physical disks, but may be used for other purposes. For example, it may be more performant to use multiple files, or it may be advantageous to keep each remap rule in its own file. Keys are evenly distributed across the given files via consistent hashing.
 type MultiDiskCache []*DiskCache
 
-func NewMulti(files []config.CacheFile) (*MultiDiskCache, error) {
+// NewMulti creates a new MultiDiskCache of the given files. Each file has its own instance of the given policy, but they share stats.
+func NewMulti(files []config.CacheFile, policyCfg config.CachePolicy) (*MultiDiskCache, error) {
 	caches := make([]*DiskCache, len(files), len(files))
+	policyStats := &cachepolicy.Stats{}
 	for i, file := range files {
-		cache, err := New(file.Path, file.Bytes)
+		policy, err := cachepolicy.New(policyCfg, file.Bytes, policyStats)
+		if err != nil {
+			return nil, errors.New("creating disk cache '" + file.Path + "' policy: " + err.Error())
+		}
+		cache, err := New(file.Path, file.Bytes, policy)
 		if err != nil {
 			return nil, errors.New("creating disk cache '" + file.Path + "': " + err.Error())
 		}
@@ -89,6 +96,14 @@ func (c *MultiDiskCache) Keys() []string {
 	return arr
 }
 
+// PolicyStats returns the stats of the first file's policy. The stats are shared by all files.
+func (c *MultiDiskCache) PolicyStats() []cachepolicy.TierStats {
+	if len(*c) == 0 {
+		return nil
+	}
+	return (*c)[0].PolicyStats()
+}
+
 func (c *MultiDiskCache) Capacity() uint64 {
 	sum := uint64(0)
 	for _, cache := range *c {
@@ -37,10 +37,12 @@ import (
 	"github.com/apache/trafficcontrol/lib/go-log"
 
 	"github.com/apache/trafficcontrol/grove/cache"
+	"github.com/apache/trafficcontrol/grove/cachepolicy"
 	"github.com/apache/trafficcontrol/grove/config"
 	"github.com/apache/trafficcontrol/grove/diskcache"
 	"github.com/apache/trafficcontrol/grove/icache"
 	"github.com/apache/trafficcontrol/grove/memcache"
+	"github.com/apache/trafficcontrol/grove/parenthealth"
 	"github.com/apache/trafficcontrol/grove/plugin"
 	"github.com/apache/trafficcontrol/grove/remap"
 	"github.com/apache/trafficcontrol/grove/remapdata"
@@ -81,7 +83,7 @@ func main() {
 	}
 	log.Init(eventW, errW, warnW, infoW, debugW)
 
-	caches, err := createCaches(cfg.CacheFiles, uint64(cfg.FileMemBytes), uint64(cfg.CacheSizeBytes))
+	caches, err := createCaches(cfg.CacheFiles, uint64(cfg.FileMemBytes), uint64(cfg.CacheSizeBytes), cfg.CachePolicy, cfg.CachePolicies)
 	if err != nil {
 		log.Errorln("starting service: creating caches: " + err.Error())
 		os.Exit(1)
@@ -93,8 +95,10 @@ func main() {
 	reqIdleConnTimeout := time.Duration(cfg.ReqIdleConnTimeoutMS) * time.Millisecond
 	baseTransport := remap.NewRemappingTransport(reqTimeout, reqKeepAlive, reqMaxIdleConns, reqIdleConnTimeout)
 
+	parentHealth := parenthealth.NewRegistry()
+
 	plugins := plugin.Get(cfg.Plugins)
-	remapper, err := remap.LoadRemapper(cfg.RemapRulesFile, plugins.LoadFuncs(), caches, baseTransport)
+	remapper, err := remap.LoadRemapper(cfg.RemapRulesFile, plugins.LoadFuncs(), caches, baseTransport, parentHealth)
 	if err != nil {
 		log.Errorf("starting service: loading remap rules: %v\n", err)
 		os.Exit(1)
@@ -148,6 +152,7 @@ func main() {
 			httpConns,
 			httpsConns,
 			cfg.InterfaceName,
+			parentHealth,
 		))
 	}
 
@@ -195,7 +200,7 @@ func main() {
 
 		plugins = plugin.Get(cfg.Plugins)
 		oldRemapper := remapper
-		remapper, err = remap.LoadRemapper(cfg.RemapRulesFile, plugins.LoadFuncs(), caches, baseTransport)
+		remapper, err = remap.LoadRemapper(cfg.RemapRulesFile, plugins.LoadFuncs(), caches, baseTransport, parentHealth)
 		if err != nil {
 			log.Errorln("reloading config: failed to load remap rules, keeping existing rules: " + err.Error())
 			remapper = oldRemapper
@@ -235,6 +240,7 @@ func main() {
 			httpConns,
 			httpsConns,
 			cfg.InterfaceName,
+			parentHealth,
 		)
 		httpHandler.Set(httpCacheHandler)
 
@@ -252,6 +258,7 @@ func main() {
 			httpConns,
 			httpsConns,
 			cfg.InterfaceName,
+			parentHealth,
 		)
 		httpsHandler.Set(httpsCacheHandler)
 
@@ -381,23 +388,41 @@ func loadCerts(rules []remapdata.RemapRule) ([]tls.Certificate, error) {
 }
 
 // createCaches creates the caches specified in the config. The nameFiles is the map of names to groups of files, nameMemBytes is the amount of memory to use for each named group, and memCacheBytes is the amount of memory to use for the default memory cache.
-func createCaches(nameFiles map[string][]config.CacheFile, nameMemBytes uint64, memCacheBytes uint64) (map[string]icache.Cache, error) {
+// The memCachePolicy is the policy of the default memory cache, and namePolicies are the policies of each named group, used for both its memory and disk tiers.
+func createCaches(nameFiles map[string][]config.CacheFile, nameMemBytes uint64, memCacheBytes uint64, memCachePolicy config.CachePolicy, namePolicies map[string]config.CachePolicy) (map[string]icache.Cache, error) {
+	for name := range namePolicies {
+		if _, ok := nameFiles[name]; !ok {
+			return nil, errors.New("cache policy for '" + name + "': no cache files with that name")
+		}
+	}
+
 	caches := map[string]icache.Cache{}
-	caches[""] = memcache.New(memCacheBytes) // default empty names to the mem cache
+	policy, err := cachepolicy.New(memCachePolicy, memCacheBytes, nil)
+	if err != nil {
+		return nil, errors.New("creating default memory cache policy: " + err.Error())
+	}
+	caches[""] = memcache.New(memCacheBytes, policy) // default empty names to the mem cache
 
 	for name, files := range nameFiles {
-		multiDiskCache, err := diskcache.NewMulti(files)
+		multiDiskCache, err := diskcache.NewMulti(files, namePolicies[name])
 		if err != nil {
 			return nil, errors.New("creating cache '" + name + "': " + err.Error())
 		}
-		caches[name] = tiercache.New(memcache.New(nameMemBytes), multiDiskCache)
+		memPolicy, err := cachepolicy.New(namePolicies[name], nameMemBytes, nil)
+		if err != nil {
+			return nil, errors.New("creating cache '" + name + "' memory policy: " + err.Error())
+		}
+		caches[name] = tiercache.New(memcache.New(nameMemBytes, memPolicy), multiDiskCache)
 	}
 
 	return caches, nil
 }
 
 func cachesChanged(oldCfg, newCfg config.Config) bool {
-	return oldCfg.FileMemBytes == newCfg.FileMemBytes &&
+	storageChanged := oldCfg.FileMemBytes == newCfg.FileMemBytes &&
 		oldCfg.CacheSizeBytes != newCfg.CacheSizeBytes &&
 		!reflect.DeepEqual(oldCfg.CacheFiles, newCfg.CacheFiles)
+	policiesChanged := !reflect.DeepEqual(oldCfg.CachePolicy, newCfg.CachePolicy) ||
+		!reflect.DeepEqual(oldCfg.CachePolicies, newCfg.CachePolicies)
+	return storageChanged || policiesChanged
 }
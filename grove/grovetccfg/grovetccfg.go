@@ -17,16 +17,13 @@ package main
 import (
 	"compress/gzip"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
-	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"reflect"
 	"sort"
@@ -35,10 +32,9 @@ import (
 	"time"
 
 	"github.com/apache/trafficcontrol/lib/go-tc"
-	to "github.com/apache/trafficcontrol/traffic_ops/v2-client"
+	to "github.com/apache/trafficcontrol/traffic_ops/v3-client"
 
 	"github.com/apache/trafficcontrol/grove/config"
-	"github.com/apache/trafficcontrol/grove/remap"
 	"github.com/apache/trafficcontrol/grove/remapdata"
 	"github.com/apache/trafficcontrol/grove/web"
 )
@@ -52,6 +48,7 @@ const GroveConfigPath = "/etc/grove/" + GroveConfigFile
 const ConfigHistory = "cfg_history/"
 const RemapHistory = "remap_history/"
 const GroveProfileType = "GROVE_PROFILE"
+const DefaultPollInterval = time.Minute
 
 // Exit codes are defined in the documentation, DO NOT change to iota, to avoid ambiguity.
 const (
@@ -68,14 +65,6 @@ func AvailableStatuses() map[string]struct{} {
 	}
 }
 
-func GetRemapPath() (string, error) {
-	cfg, err := config.LoadConfig(GroveConfigPath)
-	if err != nil {
-		return "", errors.New("loading Grove config file: " + err.Error())
-	}
-	return cfg.RemapRulesFile, nil
-}
-
 // CopyAndGzipFile reads the src file, gzips the contents, and writes the result to dst.
 func CopyAndGzipFile(src, dst string) error {
 	srcF, err := os.Open(src)
@@ -156,35 +145,6 @@ func WriteAndBackup(path string, backupDirectory string, bts []byte) error {
 	return nil
 }
 
-// hasUpdatePending returns whether an update is pending, the revalPending status (which will be needed later in the clear update POST), and any error.
-func hasUpdatePending(toc *to.Session, hostname string) (bool, bool, error) {
-	upd, _, err := toc.GetServerByHostName(hostname)
-	if err != nil {
-		return false, false, errors.New("getting update from Traffic Ops: " + err.Error())
-	} else if len(upd) != 1 {
-		return false, false, fmt.Errorf("Want exactly one server with hostname '%s', got %d", hostname, len(upd))
-	}
-	return upd[0].UpdPending, upd[0].RevalPending, nil
-}
-
-// clearUpdatePending clears the given host's update pending flag in Traffic Ops. It takes the host to clear, and the old revalPending flag to send.
-func clearUpdatePending(toc *to.Session, hostname string, revalPending bool) error {
-	srv, _, err := toc.GetServerByHostName(hostname)
-	if err != nil {
-		return fmt.Errorf("Failed to update reval_pending: %v", err)
-	} else if len(srv) != 1 {
-		return fmt.Errorf("Want exactly one server with hostname '%s', got '%d'", hostname, len(srv))
-	}
-
-	srv[0].RevalPending = revalPending
-	srv[0].UpdPending = false
-	alerts, _, err := toc.UpdateServerByID(srv[0].ID, srv[0])
-	if err != nil {
-		return fmt.Errorf("setting update pending on Traffic Ops: %v (Alerts: %+v)", err, alerts.Alerts)
-	}
-	return nil
-}
-
 func main() {
 	toURL := flag.String("tourl", "", "The Traffic Ops URL")
 	toUser := flag.String("touser", "", "The Traffic Ops username")
@@ -192,10 +152,13 @@ func main() {
 	pretty := flag.Bool("pretty", false, "Whether to pretty-print output")
 	ignoreUpdateFlag := flag.Bool("ignore-update-flag", false, "Whether to fetch and apply the config, without checking or updating the Traffic Ops Update Pending flag")
 	host := flag.String("host", "", "The hostname of the server whose config to generate")
-	// api := flag.String("api", "1.2", "API version. Determines whether to use /api/1.3/configs/ or older, less efficient 1.2 APIs")
 	toInsecure := flag.Bool("insecure", false, "Whether to allow invalid certificates with Traffic Ops")
 	certDir := flag.String("certdir", DefaultCertificateDir, "Directory to save certificates to")
 	noServiceReload := flag.Bool("no-service-reload", false, "Whether to avoid trying to reload the Grove service")
+	grovePIDFile := flag.String("grove-pid-file", "", "The Grove pid file. If set, Grove is reloaded by sending it SIGHUP, rather than by reloading the service")
+	cfgPath := flag.String("cfg", GroveConfigPath, "The Grove config file")
+	daemon := flag.Bool("daemon", false, "Whether to run as a daemon, polling Traffic Ops for updates, rather than checking once and exiting")
+	interval := flag.Duration("interval", DefaultPollInterval, "How often to poll Traffic Ops for updates, in daemon mode")
 	flag.Parse()
 
 	if host == nil || *host == "" {
@@ -216,149 +179,52 @@ func main() {
 		os.Exit(ExitError)
 	}
 
-	revalPendingStatus := false
-	if !*ignoreUpdateFlag {
-		needsUpdate := false
-		needsUpdate, revalPendingStatus, err = hasUpdatePending(toc, *host)
-		if err != nil {
-			fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error checking Traffic Ops update pending: " + err.Error())
-			os.Exit(ExitError)
-		}
-		if !needsUpdate {
-			os.Exit(ExitSuccess) // if no error and no update necessary, return success and print nothing
-		}
-	}
-
-	// TODO remove this once converted to 1.3 API
-	// using the 1.2 API
-	var hostServer tc.Server
-	var hostProfile tc.Profile
-	var ok bool
-	var profiles map[string]tc.Profile
-	var servers map[string]tc.Server
-
-	serversArr, _, err := toc.GetServers()
-	if err != nil {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error getting Traffic Ops Servers: " + err.Error())
-		os.Exit(ExitError)
-	}
-	servers = makeServersHostnameMap(serversArr)
-
-	hostServer, ok = servers[*host]
-	if !ok {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error: host '" + *host + "' not in Servers\n")
-		os.Exit(ExitError)
-	}
-
-	profilesArr, _, err := toc.GetProfiles()
-	if err != nil {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error getting Traffic Ops Profiles: " + err.Error())
-		os.Exit(ExitError)
-	}
-	profiles = makeProfileNameMap(profilesArr)
-
-	hostProfile, ok = profiles[hostServer.Profile]
-	if !ok {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error: profile '" + hostServer.Profile + "' not in Profiles\n")
-		os.Exit(ExitError)
+	updater := &Updater{
+		TO:               toc,
+		Host:             *host,
+		CfgPath:          *cfgPath,
+		CertDir:          *certDir,
+		Pretty:           *pretty,
+		IgnoreUpdateFlag: *ignoreUpdateFlag,
 	}
-	// end of API 1.2 stuff
-
-	if hostProfile.Type == GroveProfileType {
-		updateRequired, cfg, err := createGroveCfg(toc, hostServer)
-		if err != nil {
-			fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error getting config rules for '" + GroveConfigPath + "' :" + err.Error())
-			os.Exit(ExitError)
-		}
-		if updateRequired {
-			cfgBytes := []byte{}
-			if *pretty {
-				cfgBytes, err = json.MarshalIndent(cfg, "", "  ")
-			} else {
-				cfgBytes, err = json.Marshal(cfg)
-			}
-			if err != nil {
-				fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error creating JSON Remap Rules: " + err.Error())
-				os.Exit(ExitError)
-			}
-			if err := WriteAndBackup(GroveConfigPath, ConfigHistory, cfgBytes); err != nil {
-				fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error writing new config file: " + err.Error())
-				os.Exit(ExitError)
-			}
+	if !*noServiceReload {
+		updater.Reload = serviceReloader
+		if *grovePIDFile != "" {
+			updater.Reload = signalReloader(*grovePIDFile)
 		}
-	} else {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Warning: the profile '" + hostServer.Profile + "' is not a '" + GroveProfileType + "', will not build a config from it.")
-	}
-
-	rules := remap.RemapRules{}
-	// if *api == "1.3" {
-	// 	rules, err = createRulesNewAPI(toc, *host, *certDir)
-	// } else {
-	rules, err = createRulesOldAPI(toc, *host, *certDir, servers) // TODO remove once 1.3 / traffic_ops_golang is deployed to production.
-	// }
-	if err != nil {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error creating rules: " + err.Error())
-		os.Exit(ExitError)
-	}
-
-	jsonRules, err := remap.RemapRulesToJSON(rules)
-	if err != nil {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error creating JSON Remap Rules: " + err.Error())
-		os.Exit(ExitError)
 	}
 
-	bts := []byte{}
-	if *pretty {
-		bts, err = json.MarshalIndent(jsonRules, "", "  ")
-	} else {
-		bts, err = json.Marshal(jsonRules)
+	if *daemon {
+		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Polling Traffic Ops every " + interval.String())
+		RunDaemon(updater, *interval, nil)
+		os.Exit(ExitSuccess)
 	}
 
-	if err != nil {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error marshalling rules JSON: " + err.Error())
-		os.Exit(ExitError)
-	}
-
-	// TODO add app/option to print config to stdout
-
-	remapPath, err := GetRemapPath()
-	if err != nil {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error getting remap config path: " + err.Error())
-		os.Exit(ExitError)
-	}
-
-	if err := WriteAndBackup(remapPath, RemapHistory, bts); err != nil {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error writing new config file: " + err.Error())
-		os.Exit(ExitError)
-	}
-
-	if !*noServiceReload {
-		if err := exec.Command("service", "grove", "reload").Run(); err != nil {
-			fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error restarting grove service (but successfully updated config file): " + err.Error())
+	if _, err := updater.Update(); err != nil {
+		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error " + err.Error())
+		switch err.(type) {
+		case ReloadError:
 			os.Exit(ExitErrorReloadingService)
-		}
-	}
-
-	if !*ignoreUpdateFlag {
-		if err := clearUpdatePending(toc, *host, revalPendingStatus); err != nil {
-			fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error clearing update pending flag in Traffic Ops (but successfully updated config): " + err.Error())
+		case ClearUpdateFlagError:
 			os.Exit(ExitErrorClearingUpdateFlag)
+		default:
+			os.Exit(ExitError)
 		}
 	}
-
-	os.Exit(ExitSuccess)
+	os.Exit(ExitSuccess) // if no error, whether or not an update was necessary, return success
 }
 
-func createGroveCfg(toc *to.Session, server tc.Server) (bool, config.Config, error) {
+// createGroveCfg creates the Grove config from the given profile parameters. Returns whether the config differs from the existing config file at cfgPath, the new config, and any error.
+func createGroveCfg(serverParameters []tc.Parameter, cfgPath string) (bool, config.Config, error) {
 	var newCfg config.Config
 	var currCfg config.Config
 	var pluginParams = []string{}
 
 	// load the servers current config parameters.
-	if _, err := os.Stat(GroveConfigPath); err == nil {
-		currCfg, err = config.LoadConfig(GroveConfigPath)
+	if _, err := os.Stat(cfgPath); err == nil {
+		currCfg, err = config.LoadConfig(cfgPath)
 		if err != nil {
-			fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error loading current config from '" + GroveConfigPath + "' " + err.Error())
+			fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error loading current config from '" + cfgPath + "' " + err.Error())
 			return false, currCfg, err
 		} else {
 			// make sure this array is sorted for later comparison
@@ -366,35 +232,30 @@ func createGroveCfg(toc *to.Session, server tc.Server) (bool, config.Config, err
 		}
 	}
 
-	serverParameters, _, err := toc.GetParametersByProfileName(server.Profile)
-	if err != nil {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error getting Traffic Ops Parameters for host '" + server.HostName + "' profile '" + server.Profile + "': " + err.Error())
-		return false, currCfg, err
-	} else {
-		// load config parameters from the servers profile
-		for _, p := range serverParameters {
-			if p.ConfigFile == GroveConfigFile {
-				if p.Name == "plugins" {
-					pluginParams = append(pluginParams, p.Value)
-				} else {
-					err := setConfigParameter(&newCfg, p.Name, p.Value)
-					if err != nil {
-						fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error setting config parameter '" + p.Name + "' :" + err.Error())
-						return false, currCfg, err
-					}
+	// load config parameters from the servers profile
+	for _, p := range serverParameters {
+		if p.ConfigFile == GroveConfigFile {
+			if p.Name == "plugins" {
+				pluginParams = append(pluginParams, p.Value)
+			} else {
+				err := setConfigParameter(&newCfg, p.Name, p.Value)
+				if err != nil {
+					fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error setting config parameter '" + p.Name + "' :" + err.Error())
+					return false, currCfg, err
 				}
 			}
 		}
-		sort.Strings(pluginParams)
-		newCfg.Plugins = pluginParams
 	}
+	sort.Strings(pluginParams)
+	newCfg.Plugins = pluginParams
+
 	// no update is required if the configs are the same
 	areEqual := reflect.DeepEqual(newCfg, currCfg)
 	if areEqual == true {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " There are no changes needed to '" + GroveConfigPath + "'")
+		fmt.Println(time.Now().Format(time.RFC3339Nano) + " There are no changes needed to '" + cfgPath + "'")
 		return false, currCfg, nil
 	} else { // updates are required, send the new config
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Config updates are required to '" + GroveConfigPath + "'")
+		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Config updates are required to '" + cfgPath + "'")
 		return true, newCfg, nil
 	}
 }
@@ -455,214 +316,6 @@ func setConfigParameter(cfg *config.Config, name string, value string) error {
 	return err
 }
 
-func createRulesOldAPI(toc *to.Session, host string, certDir string, servers map[string]tc.Server) (remap.RemapRules, error) {
-	cachegroupsArr, _, err := toc.GetCacheGroupsNullable()
-	if err != nil {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error getting Traffic Ops Cachegroups: " + err.Error())
-		os.Exit(1)
-	}
-	cachegroups := makeCachegroupsNameMap(cachegroupsArr)
-
-	hostServer, ok := servers[host]
-	if !ok {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error: host '" + host + "' not in Servers\n")
-		os.Exit(1)
-	}
-
-	deliveryservices, _, err := toc.GetDeliveryServicesByServer(hostServer.ID)
-	if err != nil {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error getting Traffic Ops Deliveryservices: " + err.Error())
-		os.Exit(1)
-	}
-
-	deliveryserviceRegexArr, _, err := toc.GetDeliveryServiceRegexes()
-	if err != nil {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error getting Traffic Ops Deliveryservice Regexes: " + err.Error())
-		os.Exit(1)
-	}
-	deliveryserviceRegexes := makeDeliveryserviceRegexMap(deliveryserviceRegexArr)
-
-	cdnsArr, _, err := toc.GetCDNs()
-	if err != nil {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error getting Traffic Ops CDNs: " + err.Error())
-		os.Exit(1)
-	}
-	cdns := makeCDNMap(cdnsArr)
-
-	serverParameters, _, err := toc.GetParametersByProfileName(hostServer.Profile)
-	if err != nil {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error getting Traffic Ops Parameters for host '" + host + "' profile '" + hostServer.Profile + "': " + err.Error())
-		os.Exit(1)
-	}
-
-	parents, err := getParents(host, servers, cachegroups)
-	if err != nil {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error getting '" + host + "' parents: " + err.Error())
-		os.Exit(1)
-	}
-
-	sameCDN := func(s tc.Server) bool {
-		return s.CDNName == hostServer.CDNName
-	}
-
-	serverAvailable := func(s tc.Server) bool {
-		status := strings.ToLower(s.Status)
-		statuses := AvailableStatuses()
-		_, ok := statuses[status]
-		return ok
-	}
-
-	parents = filterParents(parents, sameCDN)
-	parents = filterParents(parents, serverAvailable)
-
-	cdnSSLKeys, _, err := toc.GetCDNSSLKeys(hostServer.CDNName)
-	if err != nil {
-		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error getting '" + hostServer.CDNName + "' SSL keys: " + err.Error())
-		os.Exit(1)
-	}
-	dsCerts := makeDSCertMap(cdnSSLKeys)
-
-	return createRulesOld(host, deliveryservices, parents, deliveryserviceRegexes, cdns, serverParameters, dsCerts, certDir)
-}
-
-// func createRulesNewAPI(toc *to.Session, host string, certDir string) (remap.RemapRules, error) {
-// 	cacheCfg, err := toc.CacheConfig(host)
-// 	if err != nil {
-// 		fmt.Printf("Error getting Traffic Ops Cache Config: %v\n", err)
-// 		os.Exit(1)
-// 	}
-
-// 	rules := []remapdata.RemapRule{}
-
-// 	allowedIPs, err := makeAllowIP(cacheCfg.AllowIP)
-// 	if err != nil {
-// 		return remap.RemapRules{}, fmt.Errorf("creating allowed IPs: %v", err)
-// 	}
-
-// 	cdnSSLKeys, err := toc.CDNSSLKeys(cacheCfg.CDN)
-// 	if err != nil {
-// 		fmt.Printf("Error getting %v SSL keys: %v\n", cacheCfg.CDN, err)
-// 		os.Exit(1)
-// 	}
-// 	dsCerts := makeDSCertMap(cdnSSLKeys)
-
-// 	weight := DefaultRuleWeight
-// 	retryNum := DefaultRetryNum
-// 	timeout := DefaultTimeout
-// 	parentSelection := DefaultRuleParentSelection
-
-// 	for _, ds := range cacheCfg.DeliveryServices {
-// 		protocol := ds.Protocol
-// 		queryStringRule, err := getQueryStringRule(ds.QueryStringIgnore)
-// 		if err != nil {
-// 			return remap.RemapRules{}, fmt.Errorf("getting deliveryservice %v Query String Rule: %v", ds.XMLID, err)
-// 		}
-
-// 		protocolStrs := []ProtocolStr{}
-// 		switch protocol {
-// 		case ProtocolHTTP:
-// 			protocolStrs = append(protocolStrs, ProtocolStr{From: "http", To: "http"})
-// 		case ProtocolHTTPS:
-// 			protocolStrs = append(protocolStrs, ProtocolStr{From: "https", To: "https"})
-// 		case ProtocolHTTPAndHTTPS:
-// 			protocolStrs = append(protocolStrs, ProtocolStr{From: "http", To: "http"})
-// 			protocolStrs = append(protocolStrs, ProtocolStr{From: "https", To: "https"})
-// 		case ProtocolHTTPToHTTPS:
-// 			protocolStrs = append(protocolStrs, ProtocolStr{From: "http", To: "https"})
-// 			protocolStrs = append(protocolStrs, ProtocolStr{From: "https", To: "https"})
-// 		}
-
-// 		cert, hasCert := dsCerts[ds.XMLID]
-// 		// DEBUG
-// 		// if protocol != ProtocolHTTP {
-// 		// 	if !hasCert {
-// 		// 		fmt.Fprint(os.Stderr, "HTTPS delivery service: "+ds.XMLID+" has no certificate!\n")
-// 		// 	} else if err := createCertificateFiles(cert, certDir); err != nil {
-// 		// 		fmt.Fprint(os.Stderr, "HTTPS delivery service "+ds.XMLID+" failed to create certificate: "+err.Error()+"\n")
-// 		// 	}
-// 		// }
-
-// 		dsType := strings.ToLower(ds.Type)
-// 		if !strings.HasPrefix(dsType, "http") && !strings.HasPrefix(dsType, "dns") {
-// 			fmt.Printf("createRules skipping deliveryservice %v - unknown type %v", ds.XMLID, ds.Type)
-// 			continue
-// 		}
-
-// 		for _, protocolStr := range protocolStrs {
-// 			for _, dsRegex := range ds.Regexes {
-// 				rule := remapdata.RemapRule{}
-// 				pattern, patternLiteralRegex := trimLiteralRegex(dsRegex)
-// 				rule.Name = fmt.Sprintf("%s.%s.%s.%s", ds.XMLID, protocolStr.From, protocolStr.To, pattern)
-// 				rule.From = buildFrom(protocolStr.From, pattern, patternLiteralRegex, host, dsType, cacheCfg.Domain)
-
-// 				if protocolStr.From == "https" && hasCert {
-// 					rule.CertificateFile = getCertFileName(cert, certDir)
-// 					rule.CertificateKeyFile = getCertKeyFileName(cert, certDir)
-// 					// fmt.Fprintf(os.Stderr, "HTTPS delivery service: "+ds.XMLID+" certificate %+v\n", cert)
-// 				}
-
-// 				for _, parent := range cacheCfg.Parents {
-// 					to, proxyURLStr := buildToNew(parent, protocolStr.To, ds.OriginFQDN, dsType)
-// 					proxyURL, err := url.Parse(proxyURLStr)
-// 					if err != nil {
-// 						return remap.RemapRules{}, fmt.Errorf("error parsing deliveryservice %v parent %v proxy_url: %v", ds.XMLID, parent.Host, proxyURLStr)
-// 					}
-
-// 					ruleTo := remapdata.RemapRuleTo{
-// 						RemapRuleToBase: remapdata.RemapRuleToBase{
-// 							URL:      to,
-// 							Weight:   &weight,
-// 							RetryNum: &retryNum,
-// 						},
-// 						ProxyURL:   proxyURL,
-// 						RetryCodes: DefaultRetryCodes(),
-// 						Timeout:    &timeout,
-// 					}
-// 					rule.To = append(rule.To, ruleTo)
-// 					// TODO get from TO?
-// 					rule.RetryNum = &retryNum
-// 					rule.Timeout = &timeout
-// 					rule.RetryCodes = DefaultRetryCodes()
-// 					rule.QueryString = queryStringRule
-// 					rule.DSCP = ds.DSCP
-// 					if err != nil {
-// 						return remap.RemapRules{}, err
-// 					}
-// 					rule.ConnectionClose = DefaultRuleConnectionClose
-// 					rule.ParentSelection = &parentSelection
-// 				}
-// 				rules = append(rules, rule)
-// 			}
-// 		}
-// 	}
-
-// 	remapRules := remap.RemapRules{
-// 		Rules:           rules,
-// 		RetryCodes:      DefaultRetryCodes(),
-// 		Timeout:         &timeout,
-// 		ParentSelection: &parentSelection,
-// 		Stats:           remap.RemapRulesStats{Allow: allowedIPs},
-// 	}
-
-// 	return remapRules, nil
-// }
-
-func makeProfileNameMap(profiles []tc.Profile) map[string]tc.Profile {
-	m := map[string]tc.Profile{}
-	for _, profile := range profiles {
-		m[profile.Name] = profile
-	}
-	return m
-}
-
-func makeServersHostnameMap(servers []tc.Server) map[string]tc.Server {
-	m := map[string]tc.Server{}
-	for _, server := range servers {
-		m[server.HostName] = server
-	}
-	return m
-}
-
 func makeCachegroupsNameMap(cgs []tc.CacheGroupNullable) map[string]tc.CacheGroupNullable {
 	m := map[string]tc.CacheGroupNullable{}
 	for _, cg := range cgs {
@@ -697,36 +350,6 @@ func makeDSCertMap(sslKeys []tc.CDNSSLKeys) map[string]tc.CDNSSLKeys {
 	return m
 }
 
-func getParents(hostname string, servers map[string]tc.Server, cachegroups map[string]tc.CacheGroupNullable) ([]tc.Server, error) {
-	server, ok := servers[hostname]
-	if !ok {
-		return nil, fmt.Errorf("hostname not found in Servers")
-	}
-
-	cachegroup, ok := cachegroups[server.Cachegroup]
-	if !ok {
-		return nil, fmt.Errorf("server cachegroup '%v' not found in Cachegroups", server.Cachegroup)
-	}
-
-	parents := []tc.Server{}
-	for _, server := range servers {
-		if cachegroup.ParentName != nil && server.Cachegroup == *cachegroup.ParentName {
-			parents = append(parents, server)
-		}
-	}
-	return parents, nil
-}
-
-func filterParents(parents []tc.Server, include func(tc.Server) bool) []tc.Server {
-	newParents := []tc.Server{}
-	for _, parent := range parents {
-		if include(parent) {
-			newParents = append(newParents, parent)
-		}
-	}
-	return newParents
-}
-
 const ProtocolHTTP = 0
 const ProtocolHTTPS = 1
 const ProtocolHTTPAndHTTPS = 2
@@ -771,28 +394,6 @@ func dsTypeSkipsMid(ttype string) bool {
 	return false
 }
 
-// buildTo returns the to URL, and the Proxy URL (if any)
-func buildTo(parentServer tc.Server, protocol string, originURI string, dsType string) (string, string) {
-	// TODO add port?
-	to := originURI
-	proxy := ""
-	if !dsTypeSkipsMid(dsType) {
-		proxy = "http://" + parentServer.HostName + "." + parentServer.DomainName + ":" + strconv.Itoa(parentServer.TCPPort)
-	}
-	return to, proxy
-}
-
-// // buildToNew returns the to URL, and the Proxy URL (if any)
-// func buildToNew(parent tc.CacheConfigParent, protocol string, originURI string, dsType string) (string, string) {
-// 	// TODO add port?
-// 	to := originURI
-// 	proxy := ""
-// 	if !dsTypeSkipsMid(dsType) {
-// 		proxy = "http://" + parent.Host + "." + parent.Domain + ":" + strconv.FormatUint(uint64(parent.Port), 10)
-// 	}
-// 	return to, proxy
-// }
-
 const DeliveryServiceQueryStringCacheAndRemap = 0
 const DeliveryServiceQueryStringNoCacheRemap = 1
 const DeliveryServiceQueryStringNoCacheNoRemap = 2
@@ -854,201 +455,6 @@ func makeAllowIP(ips []string) ([]*net.IPNet, error) {
 	return cidrs, nil
 }
 
-func createRulesOld(
-	hostname string,
-	dses []tc.DeliveryServiceNullable,
-	parents []tc.Server,
-	dsRegexes map[string][]tc.DeliveryServiceRegex,
-	cdns map[string]tc.CDN,
-	hostParams []tc.Parameter,
-	dsCerts map[string]tc.CDNSSLKeys,
-	certDir string,
-) (remap.RemapRules, error) {
-	rules := []remapdata.RemapRule{}
-	allowedIPs, err := getAllowIP(hostParams)
-	if err != nil {
-		return remap.RemapRules{}, fmt.Errorf("getting allowed IPs: %v", err)
-	}
-
-	weight := DefaultRuleWeight
-	retryNum := DefaultRetryNum
-	timeout := DefaultTimeout
-	parentSelection := DefaultRuleParentSelection
-
-	for _, ds := range dses {
-		protocol := *ds.Protocol
-		queryStringRule, err := getQueryStringRule(ds.QStringIgnore)
-		if err != nil {
-			return remap.RemapRules{}, fmt.Errorf("getting deliveryservice %v Query String Rule: %v", ds.XMLID, err)
-		}
-
-		cdn, ok := cdns[*ds.CDNName]
-		if !ok {
-			return remap.RemapRules{}, fmt.Errorf("deliveryservice '%v' CDN '%v' not found", *ds.XMLID, *ds.CDNName)
-		}
-
-		protocolStrs := []ProtocolStr{}
-		switch protocol {
-		case ProtocolHTTP:
-			protocolStrs = append(protocolStrs, ProtocolStr{From: "http", To: "http"})
-		case ProtocolHTTPS:
-			protocolStrs = append(protocolStrs, ProtocolStr{From: "https", To: "https"})
-		case ProtocolHTTPAndHTTPS:
-			protocolStrs = append(protocolStrs, ProtocolStr{From: "http", To: "http"})
-			protocolStrs = append(protocolStrs, ProtocolStr{From: "https", To: "https"})
-		case ProtocolHTTPToHTTPS:
-			protocolStrs = append(protocolStrs, ProtocolStr{From: "http", To: "https"})
-			protocolStrs = append(protocolStrs, ProtocolStr{From: "https", To: "https"})
-		}
-
-		cert, hasCert := dsCerts[*ds.XMLID]
-		if protocol != ProtocolHTTP {
-			if !hasCert {
-				fmt.Fprint(os.Stderr, time.Now().Format(time.RFC3339Nano)+" HTTPS delivery service: "+*ds.XMLID+" has no certificate!\n")
-			} else if err := createCertificateFiles(cert, certDir); err != nil {
-				fmt.Fprint(os.Stderr, time.Now().Format(time.RFC3339Nano)+" HTTPS delivery service "+*ds.XMLID+" failed to create certificate: "+err.Error()+"\n")
-			}
-		}
-
-		dsType := strings.ToLower(string(*ds.Type))
-		if !strings.HasPrefix(dsType, "http") && !strings.HasPrefix(dsType, "dns") {
-			fmt.Printf(time.Now().Format(time.RFC3339Nano)+" createRules skipping deliveryservice %v - unknown type %v", *ds.XMLID, *ds.Type)
-			continue
-		}
-
-		toClientHeaders, toOriginHeaders, err := makeModHdrs(ds.EdgeHeaderRewrite, ds.RemapText)
-		if err != nil {
-			return remap.RemapRules{}, errors.New("Making headers for delivery service '" + *ds.XMLID + "':" + err.Error())
-		}
-		dsRemap := ""
-		if ds.RemapText != nil {
-			dsRemap = *ds.RemapText
-		}
-		acl, err := makeACL(dsRemap)
-		if err != nil {
-			fmt.Println(time.Now().Format(time.RFC3339Nano) + " createRules skipping deliveryservice '" + *ds.XMLID + "' - unsupported ACL " + dsRemap)
-			continue
-		}
-
-		orgServerFQDN := ""
-		if ds.OrgServerFQDN != nil {
-			orgServerFQDN = *ds.OrgServerFQDN
-		}
-
-		for _, protocolStr := range protocolStrs {
-			regexes, ok := dsRegexes[*ds.XMLID]
-			if !ok {
-				return remap.RemapRules{}, fmt.Errorf("deliveryservice '%v' has no regexes", *ds.XMLID)
-			}
-
-			for _, dsRegex := range regexes {
-				rule := remapdata.RemapRule{}
-				pattern, patternLiteralRegex := trimLiteralRegex(dsRegex.Pattern)
-				rule.Name = fmt.Sprintf("%s.%s.%s.%s", *ds.XMLID, protocolStr.From, protocolStr.To, pattern)
-				rule.From = buildFrom(protocolStr.From, pattern, patternLiteralRegex, hostname, dsType, cdn.DomainName)
-
-				if protocolStr.From == "https" && hasCert {
-					rule.CertificateFile = getCertFileName(cert, certDir)
-					rule.CertificateKeyFile = getCertKeyFileName(cert, certDir)
-					// fmt.Fprintf(os.Stderr, "HTTPS delivery service: "+ds.XMLID+" certificate %+v\n", cert)
-				}
-
-				rule.PluginsShared = map[string]json.RawMessage{}
-				// if the delivery service skips the mid's ie, http_no_cache, http_live, and dns_live
-				// only add the url rule to the origin.
-				if dsTypeSkipsMid(dsType) {
-					var proxyURLStr = ""
-					proxyURL, err := url.Parse(proxyURLStr)
-					if err != nil {
-						return remap.RemapRules{}, fmt.Errorf("error parsing deliveryservice %v proxy_url: %v", *ds.XMLID, proxyURLStr)
-					}
-					ruleTo := remapdata.RemapRuleTo{
-						RemapRuleToBase: remapdata.RemapRuleToBase{
-							URL:      orgServerFQDN,
-							Weight:   &weight,
-							RetryNum: &retryNum,
-						},
-						RetryCodes: DefaultRetryCodes(),
-						ProxyURL:   proxyURL,
-						Timeout:    &timeout,
-					}
-					rule.To = append(rule.To, ruleTo)
-					rule.RetryNum = &retryNum
-					rule.Timeout = &timeout
-					rule.RetryCodes = DefaultRetryCodes()
-					rule.QueryString = queryStringRule
-					rule.DSCP = *ds.DSCP
-					rule.ConnectionClose = DefaultRuleConnectionClose
-					rule.Allow = acl
-					rule.Plugins = map[string]interface{}{}
-					rule.Plugins["modify_headers"] = toClientHeaders
-					rule.Plugins["modify_parent_request_headers"] = toOriginHeaders
-					remapTextJSON, err := json.Marshal(dsRemap)
-					if err != nil {
-						return remap.RemapRules{}, fmt.Errorf("parsing deliveryservice '%v' remap text '%v' marshalling JSON: %v", *ds.XMLID, dsRemap, err)
-					}
-					rule.PluginsShared[web.RemapTextKey] = remapTextJSON
-				} else {
-					for _, parent := range parents {
-						to, proxyURLStr := buildTo(parent, protocolStr.To, orgServerFQDN, dsType)
-						proxyURL, err := url.Parse(proxyURLStr)
-						if err != nil {
-							return remap.RemapRules{}, fmt.Errorf("error parsing deliveryservice %v parent %v proxy_url: %v", *ds.XMLID, parent.HostName, proxyURLStr)
-						}
-
-						ruleTo := remapdata.RemapRuleTo{
-							RemapRuleToBase: remapdata.RemapRuleToBase{
-								URL:      to,
-								Weight:   &weight,
-								RetryNum: &retryNum,
-							},
-							ProxyURL:   proxyURL,
-							RetryCodes: DefaultRetryCodes(),
-							Timeout:    &timeout,
-						}
-						rule.To = append(rule.To, ruleTo)
-						// TODO get from TO?
-						rule.RetryNum = &retryNum
-						rule.Timeout = &timeout
-						rule.RetryCodes = DefaultRetryCodes()
-						rule.QueryString = queryStringRule
-						rule.DSCP = *ds.DSCP
-						rule.ConnectionClose = DefaultRuleConnectionClose
-						rule.ParentSelection = &parentSelection
-						rule.Allow = acl
-						rule.Plugins = map[string]interface{}{}
-						rule.Plugins["modify_headers"] = toClientHeaders
-						rule.Plugins["modify_parent_request_headers"] = toOriginHeaders
-						remapTextJSON, err := json.Marshal(dsRemap)
-						if err != nil {
-							return remap.RemapRules{}, fmt.Errorf("parsing deliveryservice '%v' remap text '%v' marshalling JSON: %v", *ds.XMLID, dsRemap, err)
-						}
-						rule.PluginsShared[web.RemapTextKey] = remapTextJSON
-					}
-				}
-				rules = append(rules, rule)
-			}
-		}
-	}
-
-	globalPlugins := map[string]interface{}{}
-	serverHeader := web.Hdr{Name: "Server", Value: "Grove/0.33"}
-	setHeaders := []web.Hdr{}
-	setHeaders = append(setHeaders, serverHeader)
-	globalHeaders := web.ModHdrs{Set: setHeaders}
-	globalPlugins["modify_response_headers_global"] = globalHeaders
-	remapRules := remap.RemapRules{
-		Rules:           rules,
-		RetryCodes:      DefaultRetryCodes(),
-		Timeout:         &timeout,
-		ParentSelection: &parentSelection,
-		Stats:           remapdata.RemapRulesStats{Allow: allowedIPs},
-		Plugins:         globalPlugins,
-	}
-
-	return remapRules, nil
-}
-
 func getCertFileName(cert tc.CDNSSLKeys, dir string) string {
 	return dir + string(os.PathSeparator) + strings.Replace(cert.Hostname, "*.", "", -1) + ".crt"
 }
@@ -0,0 +1,416 @@
+package main
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/toclientlib"
+
+	"github.com/apache/trafficcontrol/grove/config"
+	"github.com/apache/trafficcontrol/grove/remapdata"
+	"github.com/apache/trafficcontrol/grove/web"
+)
+
+// fakeTO is an in-memory Traffic Ops, serving the data of a single CDN.
+type fakeTO struct {
+	data          TOData
+	updatePending bool
+	updateCleared int
+}
+
+func (f *fakeTO) GetServerUpdateStatusWithHdr(hostName string, header http.Header) (tc.ServerUpdateStatus, toclientlib.ReqInf, error) {
+	return tc.ServerUpdateStatus{HostName: hostName, UpdatePending: f.updatePending}, toclientlib.ReqInf{}, nil
+}
+
+func (f *fakeTO) SetUpdateServerStatuses(serverName string, updateStatus *bool, revalStatus *bool) (toclientlib.ReqInf, error) {
+	if updateStatus != nil {
+		f.updatePending = *updateStatus
+		f.updateCleared++
+	}
+	return toclientlib.ReqInf{}, nil
+}
+
+func (f *fakeTO) GetServersWithHdr(params *url.Values, header http.Header) (tc.ServersV3Response, toclientlib.ReqInf, error) {
+	return tc.ServersV3Response{Response: f.data.Servers}, toclientlib.ReqInf{}, nil
+}
+
+func (f *fakeTO) GetProfileByNameWithHdr(name string, header http.Header) ([]tc.Profile, toclientlib.ReqInf, error) {
+	if name != f.data.Profile.Name {
+		return nil, toclientlib.ReqInf{}, nil
+	}
+	return []tc.Profile{f.data.Profile}, toclientlib.ReqInf{}, nil
+}
+
+func (f *fakeTO) GetParametersByProfileNameWithHdr(profileName string, header http.Header) ([]tc.Parameter, toclientlib.ReqInf, error) {
+	return f.data.ServerParams, toclientlib.ReqInf{}, nil
+}
+
+func (f *fakeTO) GetCacheGroupsNullableWithHdr(header http.Header) ([]tc.CacheGroupNullable, toclientlib.ReqInf, error) {
+	return f.data.Cachegroups, toclientlib.ReqInf{}, nil
+}
+
+func (f *fakeTO) GetDeliveryServicesV30WithHdr(header http.Header, params url.Values) ([]tc.DeliveryServiceNullableV30, toclientlib.ReqInf, error) {
+	return f.data.DeliveryServices, toclientlib.ReqInf{}, nil
+}
+
+func (f *fakeTO) GetDeliveryServiceRegexesWithHdr(header http.Header) ([]tc.DeliveryServiceRegexes, toclientlib.ReqInf, error) {
+	return f.data.DeliveryServiceRegexes, toclientlib.ReqInf{}, nil
+}
+
+func (f *fakeTO) GetDeliveryServiceServersWithLimitsWithHdr(limit int, deliveryServiceIDs []int, serverIDs []int, header http.Header) (tc.DeliveryServiceServerResponse, toclientlib.ReqInf, error) {
+	return tc.DeliveryServiceServerResponse{Response: f.data.DeliveryServiceServers}, toclientlib.ReqInf{}, nil
+}
+
+func (f *fakeTO) GetDeliveryServicesRequiredCapabilitiesWithHdr(deliveryServiceID *int, xmlID, capability *string, header http.Header) ([]tc.DeliveryServicesRequiredCapability, toclientlib.ReqInf, error) {
+	return f.data.DSRequiredCapabilities, toclientlib.ReqInf{}, nil
+}
+
+func (f *fakeTO) GetServerServerCapabilitiesWithHdr(serverID *int, serverHostName, serverCapability *string, header http.Header) ([]tc.ServerServerCapability, toclientlib.ReqInf, error) {
+	return f.data.ServerCapabilities, toclientlib.ReqInf{}, nil
+}
+
+func (f *fakeTO) GetTopologiesWithHdr(header http.Header) ([]tc.Topology, toclientlib.ReqInf, error) {
+	return f.data.Topologies, toclientlib.ReqInf{}, nil
+}
+
+func (f *fakeTO) GetOrigins() ([]tc.Origin, toclientlib.ReqInf, error) {
+	return f.data.Origins, toclientlib.ReqInf{}, nil
+}
+
+func (f *fakeTO) GetCDNsWithHdr(header http.Header) ([]tc.CDN, toclientlib.ReqInf, error) {
+	return f.data.CDNs, toclientlib.ReqInf{}, nil
+}
+
+func (f *fakeTO) GetCDNSSLKeysWithHdr(name string, header http.Header) ([]tc.CDNSSLKeys, toclientlib.ReqInf, error) {
+	return f.data.SSLKeys, toclientlib.ReqInf{}, nil
+}
+
+func strPtr(s string) *string { return &s }
+func intPtr(i int) *int       { return &i }
+func boolPtr(b bool) *bool    { return &b }
+
+func testServer(id int, host string, cachegroup string, serverType string, status string) tc.ServerV30 {
+	sv := tc.ServerV30{}
+	sv.ID = intPtr(id)
+	sv.HostName = strPtr(host)
+	sv.DomainName = strPtr("example.net")
+	sv.Cachegroup = strPtr(cachegroup)
+	sv.CDNName = strPtr("cdn0")
+	sv.Profile = strPtr("GROVE_EDGE")
+	sv.Status = strPtr(status)
+	sv.TCPPort = intPtr(80)
+	sv.Type = serverType
+	return sv
+}
+
+func testDS(id int, xmlID string, topology string) tc.DeliveryServiceNullableV30 {
+	ds := tc.DeliveryServiceNullableV30{}
+	ds.ID = intPtr(id)
+	ds.XMLID = strPtr(xmlID)
+	ds.Active = boolPtr(true)
+	ds.CDNName = strPtr("cdn0")
+	dsType := tc.DSTypeHTTP
+	ds.Type = &dsType
+	ds.Protocol = intPtr(ProtocolHTTP)
+	ds.OrgServerFQDN = strPtr("http://" + xmlID + ".fallback.example")
+	if topology != "" {
+		ds.Topology = strPtr(topology)
+	}
+	return ds
+}
+
+// testTOData returns the data of a CDN with an edge 'edge0' in cachegroup 'edge-cg', whose parent cachegroup is 'mid-cg', with the mids 'mid0', 'mid1' (without the 'big' capability), and 'mid2' (offline).
+func testTOData() TOData {
+	edgeCG := tc.CacheGroupNullable{Name: strPtr("edge-cg"), ParentName: strPtr("mid-cg")}
+	midCG := tc.CacheGroupNullable{Name: strPtr("mid-cg")}
+
+	topoDS := testDS(1, "topo-ds", "topo")
+	topoDS.FirstHeaderRewrite = strPtr("cond %{SEND_RESPONSE_HDR_HOOK} __RETURN__ set-header X-First first [L]")
+	topoDS.LastHeaderRewrite = strPtr("cond %{SEND_RESPONSE_HDR_HOOK} __RETURN__ set-header X-Last last [L]")
+	topoDS.EdgeHeaderRewrite = strPtr("cond %{SEND_RESPONSE_HDR_HOOK} __RETURN__ set-header X-Edge edge [L]")
+
+	assignedDS := testDS(2, "assigned-ds", "")
+	assignedDS.EdgeHeaderRewrite = strPtr("cond %{SEND_RESPONSE_HDR_HOOK} __RETURN__ set-header X-Edge edge [L]")
+
+	unassignedDS := testDS(3, "unassigned-ds", "")
+	capDS := testDS(4, "cap-ds", "topo")
+	otherTopoDS := testDS(5, "other-topo-ds", "other")
+
+	dses := []tc.DeliveryServiceNullableV30{topoDS, assignedDS, unassignedDS, capDS, otherTopoDS}
+	regexes := []tc.DeliveryServiceRegexes{}
+	for _, ds := range dses {
+		regexes = append(regexes, tc.DeliveryServiceRegexes{DSName: *ds.XMLID, Regexes: []tc.DeliveryServiceRegex{{Type: "HOST_REGEXP", Pattern: `.*\.` + *ds.XMLID + `\..*`}}})
+	}
+
+	edge := testServer(10, "edge0", "edge-cg", "EDGE", "REPORTED")
+	return TOData{
+		Server:  edge,
+		Profile: tc.Profile{Name: "GROVE_EDGE", Type: "ATS_PROFILE"},
+		Servers: []tc.ServerV30{
+			edge,
+			testServer(20, "mid0", "mid-cg", "MID", "REPORTED"),
+			testServer(21, "mid1", "mid-cg", "MID", "ONLINE"),
+			testServer(22, "mid2", "mid-cg", "MID", "OFFLINE"),
+		},
+		Cachegroups:            []tc.CacheGroupNullable{edgeCG, midCG},
+		DeliveryServices:       dses,
+		DeliveryServiceRegexes: regexes,
+		DeliveryServiceServers: []tc.DeliveryServiceServer{{Server: intPtr(10), DeliveryService: intPtr(2)}},
+		DSRequiredCapabilities: []tc.DeliveryServicesRequiredCapability{{DeliveryServiceID: intPtr(4), RequiredCapability: strPtr("big")}},
+		ServerCapabilities: []tc.ServerServerCapability{
+			{ServerID: intPtr(10), ServerCapability: strPtr("big")},
+			{ServerID: intPtr(20), ServerCapability: strPtr("big")},
+		},
+		Topologies: []tc.Topology{
+			{Name: "topo", Nodes: []tc.TopologyNode{{Cachegroup: "edge-cg", Parents: []int{1}}, {Cachegroup: "mid-cg"}}},
+			{Name: "other", Nodes: []tc.TopologyNode{{Cachegroup: "other-cg"}}},
+		},
+		Origins: []tc.Origin{
+			{DeliveryServiceID: intPtr(1), FQDN: strPtr("origin.topo.example"), Protocol: strPtr("https"), Port: intPtr(8443), IsPrimary: boolPtr(true)},
+			{DeliveryServiceID: intPtr(1), FQDN: strPtr("secondary.topo.example"), Protocol: strPtr("http"), IsPrimary: boolPtr(false)},
+		},
+		CDNs: []tc.CDN{{Name: "cdn0", DomainName: "cdn.example"}},
+	}
+}
+
+func ruleProxies(rule remapdata.RemapRule) []string {
+	proxies := []string{}
+	for _, to := range rule.To {
+		proxies = append(proxies, to.ProxyURL.String())
+	}
+	sort.Strings(proxies)
+	return proxies
+}
+
+func TestCreateRules(t *testing.T) {
+	data := testTOData()
+	rules, err := createRules(&data, os.TempDir())
+	if err != nil {
+		t.Fatalf("createRules expected nil error, actual %v", err)
+	}
+
+	ruleMap := map[string]remapdata.RemapRule{}
+	for _, rule := range rules.Rules {
+		ruleMap[rule.Name] = rule
+	}
+	if len(ruleMap) != 3 {
+		t.Errorf("createRules expected 3 rules (topo-ds, assigned-ds, cap-ds), actual %v: %+v", len(ruleMap), ruleMap)
+	}
+
+	topoRule, ok := ruleMap["topo-ds.http.http.topo-ds"]
+	if !ok {
+		t.Fatalf("createRules expected topology delivery service rule, actual missing")
+	}
+	if expected := "http://edge0.topo-ds.cdn.example"; topoRule.From != expected {
+		t.Errorf("createRules topology rule expected from %v, actual %v", expected, topoRule.From)
+	}
+	if expected, actual := []string{"http://mid0.example.net:80", "http://mid1.example.net:80"}, ruleProxies(topoRule); !equalStrs(expected, actual) {
+		t.Errorf("createRules topology rule expected available parents %v, actual %v", expected, actual)
+	}
+	if expected := "https://origin.topo.example:8443"; topoRule.To[0].URL != expected {
+		t.Errorf("createRules topology rule expected primary origin %v, actual %v", expected, topoRule.To[0].URL)
+	}
+	clientHdrs := topoRule.Plugins["modify_headers"].(web.ModHdrs)
+	if len(clientHdrs.Set) != 1 || clientHdrs.Set[0].Name != "X-First" {
+		t.Errorf("createRules topology edge rule expected only the first header rewrite, actual %+v", clientHdrs)
+	}
+
+	assignedRule, ok := ruleMap["assigned-ds.http.http.assigned-ds"]
+	if !ok {
+		t.Fatalf("createRules expected assigned delivery service rule, actual missing")
+	}
+	if expected, actual := []string{"http://mid0.example.net:80", "http://mid1.example.net:80"}, ruleProxies(assignedRule); !equalStrs(expected, actual) {
+		t.Errorf("createRules assigned rule expected parent cachegroup parents %v, actual %v", expected, actual)
+	}
+	if expected := "http://assigned-ds.fallback.example"; assignedRule.To[0].URL != expected {
+		t.Errorf("createRules assigned rule without origins expected origin server fqdn %v, actual %v", expected, assignedRule.To[0].URL)
+	}
+	clientHdrs = assignedRule.Plugins["modify_headers"].(web.ModHdrs)
+	if len(clientHdrs.Set) != 1 || clientHdrs.Set[0].Name != "X-Edge" {
+		t.Errorf("createRules non-topology edge rule expected the edge header rewrite, actual %+v", clientHdrs)
+	}
+
+	capRule, ok := ruleMap["cap-ds.http.http.cap-ds"]
+	if !ok {
+		t.Fatalf("createRules expected required capability delivery service rule, actual missing")
+	}
+	if expected, actual := []string{"http://mid0.example.net:80"}, ruleProxies(capRule); !equalStrs(expected, actual) {
+		t.Errorf("createRules required capability rule expected only parents with the capability %v, actual %v", expected, actual)
+	}
+}
+
+func TestCreateRulesMissingCapability(t *testing.T) {
+	data := testTOData()
+	data.ServerCapabilities = nil
+	rules, err := createRules(&data, os.TempDir())
+	if err != nil {
+		t.Fatalf("createRules expected nil error, actual %v", err)
+	}
+	for _, rule := range rules.Rules {
+		if rule.Name == "cap-ds.http.http.cap-ds" {
+			t.Errorf("createRules expected no rule for a delivery service requiring capabilities the server lacks, actual %+v", rule)
+		}
+	}
+}
+
+func TestCreateRulesMid(t *testing.T) {
+	data := testTOData()
+	data.Server = data.Servers[1]
+	data.DeliveryServiceServers = nil
+	rules, err := createRules(&data, os.TempDir())
+	if err != nil {
+		t.Fatalf("createRules expected nil error, actual %v", err)
+	}
+	for _, rule := range rules.Rules {
+		if len(rule.To) != 1 || rule.To[0].ProxyURL.String() != "" {
+			t.Errorf("createRules mid rule %v expected to request the origin directly, actual %v", rule.Name, ruleProxies(rule))
+		}
+		if rule.Name == "topo-ds.http.http.topo-ds" {
+			clientHdrs := rule.Plugins["modify_headers"].(web.ModHdrs)
+			if len(clientHdrs.Set) != 1 || clientHdrs.Set[0].Name != "X-Last" {
+				t.Errorf("createRules topology mid rule expected only the last header rewrite, actual %+v", clientHdrs)
+			}
+		}
+	}
+}
+
+func equalStrs(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// newTestUpdater returns an Updater of a fake Traffic Ops, whose config and remap rules are in a temp directory, and a pointer to the number of reloads.
+func newTestUpdater(t *testing.T) (*Updater, *fakeTO, string, *int) {
+	dir, err := ioutil.TempDir("", "grovetccfg")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	remapPath := filepath.Join(dir, "remap.json")
+	cfgPath := filepath.Join(dir, GroveConfigFile)
+	if err := ioutil.WriteFile(cfgPath, []byte(`{"remap_rules_file": "`+remapPath+`"}`), 0644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	toc := &fakeTO{data: testTOData(), updatePending: true}
+	reloads := 0
+	u := &Updater{
+		TO:      toc,
+		Host:    "edge0",
+		CfgPath: cfgPath,
+		CertDir: dir,
+		Reload:  func() error { reloads++; return nil },
+	}
+	return u, toc, remapPath, &reloads
+}
+
+func TestUpdaterUpdate(t *testing.T) {
+	u, toc, remapPath, reloads := newTestUpdater(t)
+	defer os.RemoveAll(filepath.Dir(remapPath))
+
+	updated, err := u.Update()
+	if err != nil {
+		t.Fatalf("Updater.Update expected nil error, actual %v", err)
+	}
+	if !updated {
+		t.Errorf("Updater.Update with update pending expected updated, actual not updated")
+	}
+	if _, err := os.Stat(remapPath); err != nil {
+		t.Errorf("Updater.Update expected remap rules file to be written, actual %v", err)
+	}
+	if _, err := os.Stat(NewFilename(remapPath)); !os.IsNotExist(err) {
+		t.Errorf("Updater.Update expected new remap rules file to be moved into place, actual %v", err)
+	}
+	if *reloads != 1 {
+		t.Errorf("Updater.Update expected 1 reload, actual %v", *reloads)
+	}
+	if toc.updatePending || toc.updateCleared != 1 {
+		t.Errorf("Updater.Update expected update flag to be cleared once, actual pending %v cleared %v", toc.updatePending, toc.updateCleared)
+	}
+
+	updated, err = u.Update()
+	if err != nil {
+		t.Fatalf("Updater.Update expected nil error, actual %v", err)
+	}
+	if updated || *reloads != 1 {
+		t.Errorf("Updater.Update without update pending expected no update or reload, actual updated %v reloads %v", updated, *reloads)
+	}
+}
+
+func TestUpdaterUpdateReloadError(t *testing.T) {
+	u, toc, remapPath, _ := newTestUpdater(t)
+	defer os.RemoveAll(filepath.Dir(remapPath))
+	u.Reload = func() error { return errors.New("reload failed") }
+
+	_, err := u.Update()
+	if _, ok := err.(ReloadError); !ok {
+		t.Fatalf("Updater.Update with failing reload expected ReloadError, actual %v", err)
+	}
+	if !toc.updatePending {
+		t.Errorf("Updater.Update with failing reload expected update flag to stay set, actual cleared")
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grovetccfg")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	validPath := filepath.Join(dir, "valid.json")
+	if err := ioutil.WriteFile(validPath, []byte(`{"parent_selection": "round-robin", "retry_num": 1, "timeout_ms": 1000, "retry_codes": [], "rules": [{"name": "a", "from": "http://a.example", "to": [{"url": "http://origin.example"}]}]}`), 0644); err != nil {
+		t.Fatalf("writing remap rules: %v", err)
+	}
+	if err := validateRules(validPath, config.DefaultConfig); err != nil {
+		t.Errorf("validateRules of valid rules expected nil error, actual %v", err)
+	}
+
+	invalidPath := filepath.Join(dir, "invalid.json")
+	if err := ioutil.WriteFile(invalidPath, []byte(`{"parent_selection": "round-robin", "retry_num": 1, "timeout_ms": 1000, "retry_codes": [], "rules": [{"name": "a", "from": "http://a.example", "to": []}]}`), 0644); err != nil {
+		t.Fatalf("writing remap rules: %v", err)
+	}
+	if err := validateRules(invalidPath, config.DefaultConfig); err == nil {
+		t.Errorf("validateRules of a rule without a to expected error, actual nil")
+	}
+
+	cachePath := filepath.Join(dir, "cache.json")
+	if err := ioutil.WriteFile(cachePath, []byte(`{"parent_selection": "round-robin", "retry_num": 1, "timeout_ms": 1000, "retry_codes": [], "rules": [{"name": "a", "from": "http://a.example", "cache_name": "disk", "to": [{"url": "http://origin.example"}]}]}`), 0644); err != nil {
+		t.Fatalf("writing remap rules: %v", err)
+	}
+	if err := validateRules(cachePath, config.DefaultConfig); err == nil {
+		t.Errorf("validateRules of a rule with a cache not in the config expected error, actual nil")
+	}
+	cfg := config.DefaultConfig
+	cfg.CacheFiles = map[string][]config.CacheFile{"disk": nil}
+	if err := validateRules(cachePath, cfg); err != nil {
+		t.Errorf("validateRules of a rule with a cache in the config expected nil error, actual %v", err)
+	}
+}
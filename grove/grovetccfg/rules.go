@@ -0,0 +1,459 @@
+package main
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+
+	"github.com/apache/trafficcontrol/grove/remap"
+	"github.com/apache/trafficcontrol/grove/remapdata"
+	"github.com/apache/trafficcontrol/grove/web"
+)
+
+// ServerTypeEdgePrefix and ServerTypeMidPrefix are the prefixes of the Traffic Ops server types of edge and mid caches.
+const ServerTypeEdgePrefix = "EDGE"
+const ServerTypeMidPrefix = "MID"
+
+// ruleTarget is a single remap rule destination: the origin URL, and the parent cache to proxy through, if any.
+type ruleTarget struct {
+	URL   string
+	Proxy string
+}
+
+// createRules creates the remap rules for the given data's server, from the Delivery Services assigned to it either by Topology or by Delivery Service Server assignment.
+func createRules(data *TOData, certDir string) (remap.RemapRules, error) {
+	host := *data.Server.HostName
+	rules := []remapdata.RemapRule{}
+	allowedIPs, err := getAllowIP(data.ServerParams)
+	if err != nil {
+		return remap.RemapRules{}, fmt.Errorf("getting allowed IPs: %v", err)
+	}
+
+	cdns := makeCDNMap(data.CDNs)
+	dsRegexes := makeDeliveryserviceRegexMap(data.DeliveryServiceRegexes)
+	dsCerts := makeDSCertMap(data.SSLKeys)
+	cachegroups := makeCachegroupsNameMap(data.Cachegroups)
+	topologies := makeTopologyNameMap(data.Topologies)
+	dsRequiredCaps := makeDSRequiredCapabilitiesMap(data.DSRequiredCapabilities)
+	serverCaps := makeServerCapabilitiesMap(data.ServerCapabilities)
+	assignedDSes := makeAssignedDSMap(data.DeliveryServiceServers, *data.Server.ID)
+	primaryOrigins := makePrimaryOriginMap(data.Origins)
+
+	weight := DefaultRuleWeight
+	retryNum := DefaultRetryNum
+	timeout := DefaultTimeout
+	parentSelection := DefaultRuleParentSelection
+
+	for _, ds := range data.DeliveryServices {
+		if ds.XMLID == nil || ds.ID == nil || ds.CDNName == nil || ds.Type == nil || ds.Protocol == nil {
+			continue
+		}
+		if ds.Active == nil || !*ds.Active || *ds.CDNName != *data.Server.CDNName {
+			continue
+		}
+
+		dsType := strings.ToLower(string(*ds.Type))
+		if !strings.HasPrefix(dsType, "http") && !strings.HasPrefix(dsType, "dns") {
+			fmt.Printf(time.Now().Format(time.RFC3339Nano)+" createRules skipping deliveryservice %v - unknown type %v\n", *ds.XMLID, *ds.Type)
+			continue
+		}
+
+		requiredCaps := dsRequiredCaps[*ds.ID]
+		if !hasCapabilities(serverCaps[*data.Server.ID], requiredCaps) {
+			continue
+		}
+
+		var parentCachegroups []string
+		var hdrRewrites []*string
+		if ds.Topology != nil && *ds.Topology != "" {
+			topology, ok := topologies[*ds.Topology]
+			if !ok {
+				return remap.RemapRules{}, errors.New("deliveryservice '" + *ds.XMLID + "' topology '" + *ds.Topology + "' not found")
+			}
+			nodeIdx := topologyNodeIndex(topology, *data.Server.Cachegroup)
+			if nodeIdx < 0 {
+				continue // the server's cachegroup isn't in the topology, so it doesn't serve the delivery service
+			}
+			parentCachegroups = topologyParentCachegroups(topology, nodeIdx)
+			hdrRewrites = topologyHeaderRewrites(ds, topology, nodeIdx)
+		} else {
+			if !serverServesNonTopologyDS(data.Server, *ds.ID, dsType, assignedDSes) {
+				continue
+			}
+			if strings.HasPrefix(data.Server.Type, ServerTypeEdgePrefix) && !dsTypeSkipsMid(dsType) {
+				if cg, ok := cachegroups[*data.Server.Cachegroup]; ok && cg.ParentName != nil {
+					parentCachegroups = []string{*cg.ParentName}
+				}
+			}
+			if strings.HasPrefix(data.Server.Type, ServerTypeMidPrefix) {
+				hdrRewrites = []*string{ds.MidHeaderRewrite}
+			} else {
+				hdrRewrites = []*string{ds.EdgeHeaderRewrite}
+			}
+		}
+
+		cdn, ok := cdns[*ds.CDNName]
+		if !ok {
+			return remap.RemapRules{}, fmt.Errorf("deliveryservice '%v' CDN '%v' not found", *ds.XMLID, *ds.CDNName)
+		}
+
+		originURL := getOriginURL(ds, primaryOrigins)
+		parents := getParents(data.Servers, parentCachegroups, *data.Server.CDNName, requiredCaps, serverCaps)
+		targets := []ruleTarget{}
+		for _, parent := range parents {
+			targets = append(targets, ruleTarget{URL: originURL, Proxy: parentProxyURL(parent)})
+		}
+		if len(targets) == 0 {
+			if len(parentCachegroups) > 0 {
+				fmt.Println(time.Now().Format(time.RFC3339Nano) + " Warning: deliveryservice '" + *ds.XMLID + "' has no available parents, requesting the origin directly")
+			}
+			targets = append(targets, ruleTarget{URL: originURL})
+		}
+
+		protocol := *ds.Protocol
+		queryStringRule, err := getQueryStringRule(ds.QStringIgnore)
+		if err != nil {
+			return remap.RemapRules{}, fmt.Errorf("getting deliveryservice %v Query String Rule: %v", *ds.XMLID, err)
+		}
+
+		protocolStrs := []ProtocolStr{}
+		switch protocol {
+		case ProtocolHTTP:
+			protocolStrs = append(protocolStrs, ProtocolStr{From: "http", To: "http"})
+		case ProtocolHTTPS:
+			protocolStrs = append(protocolStrs, ProtocolStr{From: "https", To: "https"})
+		case ProtocolHTTPAndHTTPS:
+			protocolStrs = append(protocolStrs, ProtocolStr{From: "http", To: "http"})
+			protocolStrs = append(protocolStrs, ProtocolStr{From: "https", To: "https"})
+		case ProtocolHTTPToHTTPS:
+			protocolStrs = append(protocolStrs, ProtocolStr{From: "http", To: "https"})
+			protocolStrs = append(protocolStrs, ProtocolStr{From: "https", To: "https"})
+		}
+
+		cert, hasCert := dsCerts[*ds.XMLID]
+		if protocol != ProtocolHTTP {
+			if !hasCert {
+				fmt.Fprint(os.Stderr, time.Now().Format(time.RFC3339Nano)+" HTTPS delivery service: "+*ds.XMLID+" has no certificate!\n")
+			} else if err := createCertificateFiles(cert, certDir); err != nil {
+				fmt.Fprint(os.Stderr, time.Now().Format(time.RFC3339Nano)+" HTTPS delivery service "+*ds.XMLID+" failed to create certificate: "+err.Error()+"\n")
+			}
+		}
+
+		toClientHeaders := web.ModHdrs{}
+		toOriginHeaders := web.ModHdrs{}
+		for _, hdrRewrite := range hdrRewrites {
+			clientHdrs, originHdrs, err := makeModHdrs(hdrRewrite, ds.RemapText)
+			if err != nil {
+				return remap.RemapRules{}, errors.New("Making headers for delivery service '" + *ds.XMLID + "':" + err.Error())
+			}
+			toClientHeaders = mergeModHdrs(toClientHeaders, clientHdrs)
+			toOriginHeaders = mergeModHdrs(toOriginHeaders, originHdrs)
+		}
+
+		dsRemap := ""
+		if ds.RemapText != nil {
+			dsRemap = *ds.RemapText
+		}
+		acl, err := makeACL(dsRemap)
+		if err != nil {
+			fmt.Println(time.Now().Format(time.RFC3339Nano) + " createRules skipping deliveryservice '" + *ds.XMLID + "' - unsupported ACL " + dsRemap)
+			continue
+		}
+		remapTextJSON, err := json.Marshal(dsRemap)
+		if err != nil {
+			return remap.RemapRules{}, fmt.Errorf("parsing deliveryservice '%v' remap text '%v' marshalling JSON: %v", *ds.XMLID, dsRemap, err)
+		}
+
+		dscp := 0
+		if ds.DSCP != nil {
+			dscp = *ds.DSCP
+		}
+
+		regexes, ok := dsRegexes[*ds.XMLID]
+		if !ok {
+			return remap.RemapRules{}, fmt.Errorf("deliveryservice '%v' has no regexes", *ds.XMLID)
+		}
+
+		for _, protocolStr := range protocolStrs {
+			for _, dsRegex := range regexes {
+				rule := remapdata.RemapRule{}
+				pattern, patternLiteralRegex := trimLiteralRegex(dsRegex.Pattern)
+				rule.Name = fmt.Sprintf("%s.%s.%s.%s", *ds.XMLID, protocolStr.From, protocolStr.To, pattern)
+				rule.From = buildFrom(protocolStr.From, pattern, patternLiteralRegex, host, dsType, cdn.DomainName)
+
+				if protocolStr.From == "https" && hasCert {
+					rule.CertificateFile = getCertFileName(cert, certDir)
+					rule.CertificateKeyFile = getCertKeyFileName(cert, certDir)
+				}
+
+				for _, target := range targets {
+					proxyURL, err := url.Parse(target.Proxy)
+					if err != nil {
+						return remap.RemapRules{}, fmt.Errorf("error parsing deliveryservice %v proxy_url: %v", *ds.XMLID, target.Proxy)
+					}
+					rule.To = append(rule.To, remapdata.RemapRuleTo{
+						RemapRuleToBase: remapdata.RemapRuleToBase{
+							URL:      target.URL,
+							Weight:   &weight,
+							RetryNum: &retryNum,
+						},
+						ProxyURL:   proxyURL,
+						RetryCodes: DefaultRetryCodes(),
+						Timeout:    &timeout,
+					})
+				}
+				if len(parents) > 0 {
+					rule.ParentSelection = &parentSelection
+				}
+
+				// TODO get from TO?
+				rule.RetryNum = &retryNum
+				rule.Timeout = &timeout
+				rule.RetryCodes = DefaultRetryCodes()
+				rule.QueryString = queryStringRule
+				rule.DSCP = dscp
+				rule.ConnectionClose = DefaultRuleConnectionClose
+				rule.Allow = acl
+				rule.Plugins = map[string]interface{}{}
+				rule.Plugins["modify_headers"] = toClientHeaders
+				rule.Plugins["modify_parent_request_headers"] = toOriginHeaders
+				rule.PluginsShared = map[string]json.RawMessage{web.RemapTextKey: remapTextJSON}
+				rules = append(rules, rule)
+			}
+		}
+	}
+
+	globalPlugins := map[string]interface{}{}
+	serverHeader := web.Hdr{Name: "Server", Value: "Grove/0.33"}
+	setHeaders := []web.Hdr{}
+	setHeaders = append(setHeaders, serverHeader)
+	globalHeaders := web.ModHdrs{Set: setHeaders}
+	globalPlugins["modify_response_headers_global"] = globalHeaders
+	remapRules := remap.RemapRules{
+		Rules:           rules,
+		RetryCodes:      DefaultRetryCodes(),
+		Timeout:         &timeout,
+		ParentSelection: &parentSelection,
+		Stats:           remapdata.RemapRulesStats{Allow: allowedIPs},
+		Plugins:         globalPlugins,
+	}
+
+	return remapRules, nil
+}
+
+// serverServesNonTopologyDS returns whether the server serves the given Delivery Service without a Topology. Edges serve the Delivery Services assigned to them, and mids serve every Delivery Service in their CDN which doesn't skip mids.
+func serverServesNonTopologyDS(server tc.ServerV30, dsID int, dsType string, assignedDSes map[int]struct{}) bool {
+	if strings.HasPrefix(server.Type, ServerTypeMidPrefix) {
+		return !dsTypeSkipsMid(dsType)
+	}
+	_, ok := assignedDSes[dsID]
+	return ok
+}
+
+// topologyNodeIndex returns the index of the node of the given cachegroup in the topology, or -1 if the cachegroup isn't in it.
+func topologyNodeIndex(topology tc.Topology, cachegroup string) int {
+	for i, node := range topology.Nodes {
+		if node.Cachegroup == cachegroup {
+			return i
+		}
+	}
+	return -1
+}
+
+// topologyParentCachegroups returns the cachegroups of the parents of the given topology node. An empty list means the node requests the origin directly.
+func topologyParentCachegroups(topology tc.Topology, nodeIdx int) []string {
+	parents := []string{}
+	for _, parentIdx := range topology.Nodes[nodeIdx].Parents {
+		if parentIdx < 0 || parentIdx >= len(topology.Nodes) {
+			continue
+		}
+		parents = append(parents, topology.Nodes[parentIdx].Cachegroup)
+	}
+	return parents
+}
+
+// topologyHeaderRewrites returns the Delivery Service header rewrites which apply to the given topology node. The first tier is the node which is no other node's parent, and the last tier is the node with no parents. A node in a single-tier topology is both.
+func topologyHeaderRewrites(ds tc.DeliveryServiceNullableV30, topology tc.Topology, nodeIdx int) []*string {
+	isFirst := true
+	for _, node := range topology.Nodes {
+		for _, parentIdx := range node.Parents {
+			if parentIdx == nodeIdx {
+				isFirst = false
+			}
+		}
+	}
+	isLast := len(topology.Nodes[nodeIdx].Parents) == 0
+
+	rewrites := []*string{}
+	if isFirst {
+		rewrites = append(rewrites, ds.FirstHeaderRewrite)
+	}
+	if !isFirst && !isLast {
+		rewrites = append(rewrites, ds.InnerHeaderRewrite)
+	}
+	if isLast {
+		rewrites = append(rewrites, ds.LastHeaderRewrite)
+	}
+	return rewrites
+}
+
+// getParents returns the servers in the given parent cachegroups which are available parents for a Delivery Service with the given required capabilities. The parents are sorted by hostname, so generated rules are deterministic.
+func getParents(servers []tc.ServerV30, parentCachegroups []string, cdnName string, requiredCaps []string, serverCaps map[int][]string) []tc.ServerV30 {
+	if len(parentCachegroups) == 0 {
+		return nil
+	}
+	parentCGs := map[string]struct{}{}
+	for _, cg := range parentCachegroups {
+		parentCGs[cg] = struct{}{}
+	}
+	statuses := AvailableStatuses()
+
+	parents := []tc.ServerV30{}
+	for _, sv := range servers {
+		if sv.Cachegroup == nil || sv.CDNName == nil || sv.Status == nil || sv.HostName == nil || sv.DomainName == nil || sv.ID == nil {
+			continue
+		}
+		if _, ok := parentCGs[*sv.Cachegroup]; !ok {
+			continue
+		}
+		if !strings.HasPrefix(sv.Type, ServerTypeEdgePrefix) && !strings.HasPrefix(sv.Type, ServerTypeMidPrefix) {
+			continue
+		}
+		if *sv.CDNName != cdnName {
+			continue
+		}
+		if _, ok := statuses[strings.ToLower(*sv.Status)]; !ok {
+			continue
+		}
+		if !hasCapabilities(serverCaps[*sv.ID], requiredCaps) {
+			continue
+		}
+		parents = append(parents, sv)
+	}
+	sort.Slice(parents, func(i, j int) bool { return *parents[i].HostName < *parents[j].HostName })
+	return parents
+}
+
+// parentProxyURL returns the proxy URL of the given parent cache.
+func parentProxyURL(parent tc.ServerV30) string {
+	port := 80
+	if parent.TCPPort != nil && *parent.TCPPort != 0 {
+		port = *parent.TCPPort
+	}
+	return "http://" + *parent.HostName + "." + *parent.DomainName + ":" + strconv.Itoa(port)
+}
+
+// getOriginURL returns the URL of the Delivery Service's primary Origin, or its Origin Server FQDN if it has no primary Origin.
+func getOriginURL(ds tc.DeliveryServiceNullableV30, primaryOrigins map[int]tc.Origin) string {
+	if origin, ok := primaryOrigins[*ds.ID]; ok && origin.FQDN != nil {
+		protocol := "http"
+		if origin.Protocol != nil && *origin.Protocol != "" {
+			protocol = *origin.Protocol
+		}
+		originURL := protocol + "://" + *origin.FQDN
+		if origin.Port != nil {
+			originURL += ":" + strconv.Itoa(*origin.Port)
+		}
+		return originURL
+	}
+	if ds.OrgServerFQDN != nil {
+		return *ds.OrgServerFQDN
+	}
+	return ""
+}
+
+// hasCapabilities returns whether the capabilities include all the required capabilities.
+func hasCapabilities(capabilities []string, required []string) bool {
+	has := map[string]struct{}{}
+	for _, capability := range capabilities {
+		has[capability] = struct{}{}
+	}
+	for _, capability := range required {
+		if _, ok := has[capability]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeModHdrs returns the header modifications of a followed by those of b.
+func mergeModHdrs(a web.ModHdrs, b web.ModHdrs) web.ModHdrs {
+	return web.ModHdrs{
+		Set:  append(a.Set, b.Set...),
+		Drop: append(a.Drop, b.Drop...),
+	}
+}
+
+func makeTopologyNameMap(topologies []tc.Topology) map[string]tc.Topology {
+	m := map[string]tc.Topology{}
+	for _, topology := range topologies {
+		m[topology.Name] = topology
+	}
+	return m
+}
+
+func makeDSRequiredCapabilitiesMap(caps []tc.DeliveryServicesRequiredCapability) map[int][]string {
+	m := map[int][]string{}
+	for _, capability := range caps {
+		if capability.DeliveryServiceID == nil || capability.RequiredCapability == nil {
+			continue
+		}
+		m[*capability.DeliveryServiceID] = append(m[*capability.DeliveryServiceID], *capability.RequiredCapability)
+	}
+	return m
+}
+
+func makeServerCapabilitiesMap(caps []tc.ServerServerCapability) map[int][]string {
+	m := map[int][]string{}
+	for _, capability := range caps {
+		if capability.ServerID == nil || capability.ServerCapability == nil {
+			continue
+		}
+		m[*capability.ServerID] = append(m[*capability.ServerID], *capability.ServerCapability)
+	}
+	return m
+}
+
+func makeAssignedDSMap(dsses []tc.DeliveryServiceServer, serverID int) map[int]struct{} {
+	m := map[int]struct{}{}
+	for _, dss := range dsses {
+		if dss.Server == nil || dss.DeliveryService == nil || *dss.Server != serverID {
+			continue
+		}
+		m[*dss.DeliveryService] = struct{}{}
+	}
+	return m
+}
+
+func makePrimaryOriginMap(origins []tc.Origin) map[int]tc.Origin {
+	m := map[int]tc.Origin{}
+	for _, origin := range origins {
+		if origin.DeliveryServiceID == nil || origin.IsPrimary == nil || !*origin.IsPrimary {
+			continue
+		}
+		m[*origin.DeliveryServiceID] = origin
+	}
+	return m
+}
@@ -0,0 +1,136 @@
+package main
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/toclientlib"
+)
+
+// TOClient is the subset of the Traffic Ops client used by grovetccfg. The real *client.Session implements it, and tests use an in-memory fake.
+type TOClient interface {
+	GetServerUpdateStatusWithHdr(hostName string, header http.Header) (tc.ServerUpdateStatus, toclientlib.ReqInf, error)
+	SetUpdateServerStatuses(serverName string, updateStatus *bool, revalStatus *bool) (toclientlib.ReqInf, error)
+	GetServersWithHdr(params *url.Values, header http.Header) (tc.ServersV3Response, toclientlib.ReqInf, error)
+	GetProfileByNameWithHdr(name string, header http.Header) ([]tc.Profile, toclientlib.ReqInf, error)
+	GetParametersByProfileNameWithHdr(profileName string, header http.Header) ([]tc.Parameter, toclientlib.ReqInf, error)
+	GetCacheGroupsNullableWithHdr(header http.Header) ([]tc.CacheGroupNullable, toclientlib.ReqInf, error)
+	GetDeliveryServicesV30WithHdr(header http.Header, params url.Values) ([]tc.DeliveryServiceNullableV30, toclientlib.ReqInf, error)
+	GetDeliveryServiceRegexesWithHdr(header http.Header) ([]tc.DeliveryServiceRegexes, toclientlib.ReqInf, error)
+	GetDeliveryServiceServersWithLimitsWithHdr(limit int, deliveryServiceIDs []int, serverIDs []int, header http.Header) (tc.DeliveryServiceServerResponse, toclientlib.ReqInf, error)
+	GetDeliveryServicesRequiredCapabilitiesWithHdr(deliveryServiceID *int, xmlID, capability *string, header http.Header) ([]tc.DeliveryServicesRequiredCapability, toclientlib.ReqInf, error)
+	GetServerServerCapabilitiesWithHdr(serverID *int, serverHostName, serverCapability *string, header http.Header) ([]tc.ServerServerCapability, toclientlib.ReqInf, error)
+	GetTopologiesWithHdr(header http.Header) ([]tc.Topology, toclientlib.ReqInf, error)
+	GetOrigins() ([]tc.Origin, toclientlib.ReqInf, error)
+	GetCDNsWithHdr(header http.Header) ([]tc.CDN, toclientlib.ReqInf, error)
+	GetCDNSSLKeysWithHdr(name string, header http.Header) ([]tc.CDNSSLKeys, toclientlib.ReqInf, error)
+}
+
+// MaxDeliveryServiceServers is the limit requested for the host's delivery service server assignments. Traffic Ops applies a small default limit if none is given.
+const MaxDeliveryServiceServers = 1000000
+
+// TOData is all the Traffic Ops data needed to generate the config of a single Grove server.
+type TOData struct {
+	Server                 tc.ServerV30
+	Profile                tc.Profile
+	ServerParams           []tc.Parameter
+	Servers                []tc.ServerV30
+	Cachegroups            []tc.CacheGroupNullable
+	DeliveryServices       []tc.DeliveryServiceNullableV30
+	DeliveryServiceRegexes []tc.DeliveryServiceRegexes
+	DeliveryServiceServers []tc.DeliveryServiceServer
+	DSRequiredCapabilities []tc.DeliveryServicesRequiredCapability
+	ServerCapabilities     []tc.ServerServerCapability
+	Topologies             []tc.Topology
+	Origins                []tc.Origin
+	CDNs                   []tc.CDN
+	SSLKeys                []tc.CDNSSLKeys
+}
+
+// getTOData fetches everything needed to generate the given host's config from Traffic Ops.
+func getTOData(toc TOClient, host string) (*TOData, error) {
+	data := &TOData{}
+
+	servers, _, err := toc.GetServersWithHdr(nil, nil)
+	if err != nil {
+		return nil, errors.New("getting servers: " + err.Error())
+	}
+	data.Servers = servers.Response
+
+	found := false
+	for _, sv := range data.Servers {
+		if sv.HostName != nil && *sv.HostName == host {
+			data.Server = sv
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errors.New("host '" + host + "' not in Servers")
+	}
+	if data.Server.ID == nil || data.Server.Profile == nil || data.Server.CDNName == nil || data.Server.Cachegroup == nil {
+		return nil, errors.New("host '" + host + "' missing id, profile, cdn, or cachegroup")
+	}
+
+	profiles, _, err := toc.GetProfileByNameWithHdr(*data.Server.Profile, nil)
+	if err != nil {
+		return nil, errors.New("getting profile '" + *data.Server.Profile + "': " + err.Error())
+	} else if len(profiles) != 1 {
+		return nil, errors.New("want exactly one profile named '" + *data.Server.Profile + "', got " + strconv.Itoa(len(profiles)))
+	}
+	data.Profile = profiles[0]
+
+	if data.ServerParams, _, err = toc.GetParametersByProfileNameWithHdr(*data.Server.Profile, nil); err != nil {
+		return nil, errors.New("getting parameters for profile '" + *data.Server.Profile + "': " + err.Error())
+	}
+	if data.Cachegroups, _, err = toc.GetCacheGroupsNullableWithHdr(nil); err != nil {
+		return nil, errors.New("getting cachegroups: " + err.Error())
+	}
+	if data.DeliveryServices, _, err = toc.GetDeliveryServicesV30WithHdr(nil, nil); err != nil {
+		return nil, errors.New("getting delivery services: " + err.Error())
+	}
+	if data.DeliveryServiceRegexes, _, err = toc.GetDeliveryServiceRegexesWithHdr(nil); err != nil {
+		return nil, errors.New("getting delivery service regexes: " + err.Error())
+	}
+	dss, _, err := toc.GetDeliveryServiceServersWithLimitsWithHdr(MaxDeliveryServiceServers, nil, []int{*data.Server.ID}, nil)
+	if err != nil {
+		return nil, errors.New("getting delivery service servers: " + err.Error())
+	}
+	data.DeliveryServiceServers = dss.Response
+	if data.DSRequiredCapabilities, _, err = toc.GetDeliveryServicesRequiredCapabilitiesWithHdr(nil, nil, nil, nil); err != nil {
+		return nil, errors.New("getting delivery service required capabilities: " + err.Error())
+	}
+	if data.ServerCapabilities, _, err = toc.GetServerServerCapabilitiesWithHdr(nil, nil, nil, nil); err != nil {
+		return nil, errors.New("getting server capabilities: " + err.Error())
+	}
+	if data.Topologies, _, err = toc.GetTopologiesWithHdr(nil); err != nil {
+		return nil, errors.New("getting topologies: " + err.Error())
+	}
+	if data.Origins, _, err = toc.GetOrigins(); err != nil {
+		return nil, errors.New("getting origins: " + err.Error())
+	}
+	if data.CDNs, _, err = toc.GetCDNsWithHdr(nil); err != nil {
+		return nil, errors.New("getting CDNs: " + err.Error())
+	}
+	if data.SSLKeys, _, err = toc.GetCDNSSLKeysWithHdr(*data.Server.CDNName, nil); err != nil {
+		return nil, errors.New("getting '" + *data.Server.CDNName + "' SSL keys: " + err.Error())
+	}
+	return data, nil
+}
@@ -0,0 +1,226 @@
+package main
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/config"
+	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/memcache"
+	"github.com/apache/trafficcontrol/grove/parenthealth"
+	"github.com/apache/trafficcontrol/grove/plugin"
+	"github.com/apache/trafficcontrol/grove/remap"
+)
+
+// ValidationCacheBytes is the size of the caches created to validate new remap rules. The caches are never used, they only need to exist for the rules to load.
+const ValidationCacheBytes = 1024
+
+// ReloadError is returned by Updater.Update when the new config was written, but Grove failed to reload it.
+type ReloadError struct{ error }
+
+// ClearUpdateFlagError is returned by Updater.Update when the new config was applied, but clearing the Traffic Ops update flag failed.
+type ClearUpdateFlagError struct{ error }
+
+// Updater generates a Grove server's config from Traffic Ops, validates it, swaps it in, and tells the running Grove to reload it.
+type Updater struct {
+	TO   TOClient
+	Host string
+	// CfgPath is the path of the Grove config file. The remap rules path is read from the config.
+	CfgPath string
+	CertDir string
+	Pretty  bool
+	// IgnoreUpdateFlag applies the config without checking or clearing the Traffic Ops update flag.
+	IgnoreUpdateFlag bool
+	// Reload tells the running Grove to reload its config. Grove reloads without dropping connections. If nil, Grove is not reloaded.
+	Reload func() error
+}
+
+// Update applies the Traffic Ops config, if the server has an update pending. Returns whether the config was applied, and any error. New remap rules are validated by loading them exactly as Grove would before they replace the old rules; if they fail to load, the old rules and config are left in place, and the update flag is not cleared.
+func (u *Updater) Update() (bool, error) {
+	if !u.IgnoreUpdateFlag {
+		status, _, err := u.TO.GetServerUpdateStatusWithHdr(u.Host, nil)
+		if err != nil {
+			return false, errors.New("getting update status from Traffic Ops: " + err.Error())
+		}
+		if !status.UpdatePending {
+			return false, nil
+		}
+	}
+
+	data, err := getTOData(u.TO, u.Host)
+	if err != nil {
+		return false, errors.New("getting Traffic Ops data: " + err.Error())
+	}
+
+	cfg, cfgBytes, err := u.makeGroveCfg(data)
+	if err != nil {
+		return false, errors.New("creating config: " + err.Error())
+	}
+
+	rules, err := createRules(data, u.CertDir)
+	if err != nil {
+		return false, errors.New("creating rules: " + err.Error())
+	}
+	jsonRules, err := remap.RemapRulesToJSON(rules)
+	if err != nil {
+		return false, errors.New("creating JSON remap rules: " + err.Error())
+	}
+	bts, err := u.marshal(jsonRules)
+	if err != nil {
+		return false, errors.New("marshalling rules JSON: " + err.Error())
+	}
+
+	remapPath := cfg.RemapRulesFile
+	if err := WriteNewFile(remapPath, bts); err != nil {
+		return false, errors.New("writing new remap rules file: " + err.Error())
+	}
+	if err := validateRules(NewFilename(remapPath), cfg); err != nil {
+		os.Remove(NewFilename(remapPath))
+		return false, errors.New("validating new remap rules: " + err.Error())
+	}
+
+	if cfgBytes != nil {
+		if err := WriteAndBackup(u.CfgPath, ConfigHistory, cfgBytes); err != nil {
+			return false, errors.New("writing new config file: " + err.Error())
+		}
+	}
+	if err := BackupFile(remapPath, RemapHistory); err != nil {
+		return false, errors.New("backing up remap rules file: " + err.Error())
+	}
+	if err := os.Rename(NewFilename(remapPath), remapPath); err != nil {
+		return false, errors.New("copying new remap rules file to real location: " + err.Error())
+	}
+
+	if u.Reload != nil {
+		if err := u.Reload(); err != nil {
+			return true, ReloadError{errors.New("reloading Grove (but successfully updated config files): " + err.Error())}
+		}
+	}
+
+	if !u.IgnoreUpdateFlag {
+		updatePending := false
+		if _, err := u.TO.SetUpdateServerStatuses(u.Host, &updatePending, nil); err != nil {
+			return true, ClearUpdateFlagError{errors.New("clearing update pending flag in Traffic Ops (but successfully updated config): " + err.Error())}
+		}
+	}
+	return true, nil
+}
+
+// makeGroveCfg returns the config Grove will run with after the update, and the bytes of the new config file, or nil if the config file doesn't need to change. The config is only created from Traffic Ops for servers with a GROVE_PROFILE profile, otherwise the existing config file is used.
+func (u *Updater) makeGroveCfg(data *TOData) (config.Config, []byte, error) {
+	if data.Profile.Type != GroveProfileType {
+		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Warning: the profile '" + data.Profile.Name + "' is not a '" + GroveProfileType + "', will not build a config from it.")
+		cfg, err := config.LoadConfig(u.CfgPath)
+		if err != nil {
+			return config.Config{}, nil, errors.New("loading Grove config file: " + err.Error())
+		}
+		return cfg, nil, nil
+	}
+
+	updateRequired, newCfg, err := createGroveCfg(data.ServerParams, u.CfgPath)
+	if err != nil {
+		return config.Config{}, nil, errors.New("getting config rules for '" + u.CfgPath + "': " + err.Error())
+	}
+	if !updateRequired {
+		cfg, err := config.LoadConfig(u.CfgPath)
+		if err != nil {
+			return config.Config{}, nil, errors.New("loading Grove config file: " + err.Error())
+		}
+		return cfg, nil, nil
+	}
+
+	cfgBytes, err := u.marshal(newCfg)
+	if err != nil {
+		return config.Config{}, nil, errors.New("marshalling config JSON: " + err.Error())
+	}
+	// Grove applies the file over its defaults, so do the same to get the config it will actually run with.
+	cfg := config.DefaultConfig
+	if err := json.Unmarshal(cfgBytes, &cfg); err != nil {
+		return config.Config{}, nil, errors.New("unmarshalling config JSON: " + err.Error())
+	}
+	return cfg, cfgBytes, nil
+}
+
+func (u *Updater) marshal(v interface{}) ([]byte, error) {
+	if u.Pretty {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return json.Marshal(v)
+}
+
+// validateRules loads the remap rules at the given path the way Grove would with the given config, and returns any error.
+func validateRules(path string, cfg config.Config) error {
+	caches := map[string]icache.Cache{"": memcache.New(ValidationCacheBytes, nil)}
+	for name := range cfg.CacheFiles {
+		caches[name] = memcache.New(ValidationCacheBytes, nil)
+	}
+	parentHealth := parenthealth.NewRegistry()
+	defer parentHealth.Retain(map[string]struct{}{}) // stop the probes of the validated rules' parents
+	_, _, _, err := remap.LoadRemapRules(path, plugin.Get(cfg.Plugins).LoadFuncs(), caches, &http.Transport{}, parentHealth)
+	return err
+}
+
+// RunDaemon calls Update on the given interval, until stop is closed. Errors are logged, and the update is retried on the next poll, since the update flag is only cleared after a successful update.
+func RunDaemon(u *Updater, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		updated, err := u.Update()
+		if err != nil {
+			fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error updating config: " + err.Error())
+		} else if updated {
+			fmt.Println(time.Now().Format(time.RFC3339Nano) + " Updated config")
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// serviceReloader reloads Grove with its init script, which signals it to reload its config.
+func serviceReloader() error {
+	return exec.Command("service", "grove", "reload").Run()
+}
+
+// signalReloader returns a reloader which sends SIGHUP to the Grove process whose pid is in the given file.
+func signalReloader(pidFile string) func() error {
+	return func() error {
+		pidBts, err := ioutil.ReadFile(pidFile)
+		if err != nil {
+			return errors.New("reading pid file: " + err.Error())
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(pidBts)))
+		if err != nil {
+			return errors.New("parsing pid file '" + pidFile + "': " + err.Error())
+		}
+		if err := syscall.Kill(pid, syscall.SIGHUP); err != nil {
+			return errors.New("signalling pid " + strconv.Itoa(pid) + ": " + err.Error())
+		}
+		return nil
+	}
+}
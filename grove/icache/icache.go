@@ -16,6 +16,7 @@ package icache
 
 import (
 	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/cachepolicy"
 )
 
 // TODO change to return errors
@@ -28,4 +29,6 @@ type Cache interface {
 	Keys() []string
 	Size() uint64
 	Close()
+	// PolicyStats returns the admission and eviction policy stats of each tier of the cache.
+	PolicyStats() []cachepolicy.TierStats
 }
@@ -63,6 +63,27 @@ func (c *LRU) RemoveOldest() (string, uint64, bool) {
 	return obj.key, obj.size, true
 }
 
+// Contains returns whether the key is in the LRU.
+func (c *LRU) Contains(key string) bool {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	_, ok := c.lElems[key]
+	return ok
+}
+
+// Oldest returns the key and size of the object which would be removed by RemoveOldest, and true if the LRU is nonempty; else false.
+func (c *LRU) Oldest() (string, uint64, bool) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	elem := c.l.Back()
+	if elem == nil {
+		return "", 0, false
+	}
+	obj := elem.Value.(*listObj)
+	return obj.key, obj.size, true
+}
+
 // Keys returns a string array of the keys
 func (c *LRU) Keys() []string {
 	c.m.RLock()
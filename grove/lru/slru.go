@@ -0,0 +1,147 @@
+package lru
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"container/list"
+	"sync"
+)
+
+// SLRU is a Segmented LRU. New keys are added to the probation segment, and keys which are added again (i.e. hit) while in probation are promoted to the protected segment. When the protected segment exceeds its capacity, its least recently used keys are demoted back to probation. Keys are always removed from probation first, so objects requested only once can't evict objects which have been requested multiple times.
+type SLRU struct {
+	probation     *list.List
+	protected     *list.List
+	elems         map[string]*list.Element
+	protectedSize uint64
+	protectedMax  uint64
+	m             sync.RWMutex
+}
+
+type slruObj struct {
+	key       string
+	size      uint64
+	protected bool
+}
+
+// NewSLRU creates a new SLRU, whose protected segment holds up to protectedBytes.
+func NewSLRU(protectedBytes uint64) *SLRU {
+	return &SLRU{
+		probation:    list.New(),
+		protected:    list.New(),
+		elems:        map[string]*list.Element{},
+		protectedMax: protectedBytes,
+	}
+}
+
+// Add adds the key to the SLRU, with the given size. If the key already exists, it is promoted to the protected segment. Returns the size of the the old size, or 0 if no key existed.
+func (c *SLRU) Add(key string, size uint64) uint64 {
+	c.m.Lock()
+	defer c.m.Unlock()
+	elem, ok := c.elems[key]
+	if !ok {
+		c.elems[key] = c.probation.PushFront(&slruObj{key: key, size: size})
+		return 0
+	}
+
+	obj := elem.Value.(*slruObj)
+	oldSize := obj.size
+	if obj.protected {
+		c.protectedSize = c.protectedSize - oldSize + size
+		obj.size = size
+		c.protected.MoveToFront(elem)
+	} else {
+		c.probation.Remove(elem)
+		obj.size = size
+		obj.protected = true
+		c.elems[key] = c.protected.PushFront(obj)
+		c.protectedSize += size
+	}
+	c.demote()
+	return oldSize
+}
+
+// demote moves the least recently used protected keys to probation, until the protected segment is within its capacity. The most recently added key is never demoted, even if it's larger than the protected capacity. Must be called with the mutex locked.
+func (c *SLRU) demote() {
+	for c.protectedSize > c.protectedMax && c.protected.Len() > 1 {
+		elem := c.protected.Back()
+		obj := elem.Value.(*slruObj)
+		c.protected.Remove(elem)
+		c.protectedSize -= obj.size
+		obj.protected = false
+		c.elems[obj.key] = c.probation.PushFront(obj)
+	}
+}
+
+// back returns the element which would be removed next, or nil if the SLRU is empty. Must be called with the mutex locked.
+func (c *SLRU) back() *list.Element {
+	if elem := c.probation.Back(); elem != nil {
+		return elem
+	}
+	return c.protected.Back()
+}
+
+// RemoveOldest removes the least recently used probation key, or the least recently used protected key if probation is empty. Returns the key, size, and true if the SLRU is nonempty; else false.
+func (c *SLRU) RemoveOldest() (string, uint64, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	elem := c.back()
+	if elem == nil {
+		return "", 0, false
+	}
+	obj := elem.Value.(*slruObj)
+	if obj.protected {
+		c.protected.Remove(elem)
+		c.protectedSize -= obj.size
+	} else {
+		c.probation.Remove(elem)
+	}
+	delete(c.elems, obj.key)
+	return obj.key, obj.size, true
+}
+
+// Contains returns whether the key is in either segment of the SLRU.
+func (c *SLRU) Contains(key string) bool {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	_, ok := c.elems[key]
+	return ok
+}
+
+// Oldest returns the key and size of the object which would be removed by RemoveOldest, and true if the SLRU is nonempty; else false.
+func (c *SLRU) Oldest() (string, uint64, bool) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	elem := c.back()
+	if elem == nil {
+		return "", 0, false
+	}
+	obj := elem.Value.(*slruObj)
+	return obj.key, obj.size, true
+}
+
+// Keys returns a string array of the keys, in the order they would be removed.
+func (c *SLRU) Keys() []string {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	arr := make([]string, 0, len(c.elems))
+	for _, l := range []*list.List{c.probation, c.protected} {
+		for e := l.Back(); e != nil; e = e.Prev() {
+			arr = append(arr, e.Value.(*slruObj).key)
+		}
+	}
+	return arr
+}
@@ -0,0 +1,67 @@
+package lru
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSLRUPromote(t *testing.T) {
+	c := NewSLRU(10)
+	c.Add("a", 1)
+	c.Add("b", 1)
+	c.Add("c", 1)
+	c.Add("a", 1) // promote
+
+	if expected, actual := []string{"b", "c", "a"}, c.Keys(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("SLRU.Keys expected %v, actual %v", expected, actual)
+	}
+	if key, _, _ := c.Oldest(); key != "b" {
+		t.Errorf("SLRU.Oldest expected b, actual %v", key)
+	}
+
+	for _, expected := range []string{"b", "c", "a"} {
+		key, _, ok := c.RemoveOldest()
+		if !ok || key != expected {
+			t.Errorf("SLRU.RemoveOldest expected %v true, actual %v %v", expected, key, ok)
+		}
+	}
+	if _, _, ok := c.RemoveOldest(); ok {
+		t.Errorf("SLRU.RemoveOldest on empty expected false, actual true")
+	}
+}
+
+func TestSLRUDemote(t *testing.T) {
+	c := NewSLRU(2)
+	for _, key := range []string{"a", "b", "c"} {
+		c.Add(key, 1)
+		c.Add(key, 1) // promote
+	}
+	// protected holds 2 bytes, so "a" was demoted to probation, and is removed first.
+	if key, _, _ := c.Oldest(); key != "a" {
+		t.Errorf("SLRU.Oldest expected demoted a, actual %v", key)
+	}
+	c.Add("d", 1)
+	if expected, actual := []string{"a", "d", "b", "c"}, c.Keys(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("SLRU.Keys expected %v, actual %v", expected, actual)
+	}
+	if old := c.Add("c", 5); old != 1 {
+		t.Errorf("SLRU.Add expected old size 1, actual %v", old)
+	}
+	if !c.Contains("b") || c.Contains("z") {
+		t.Errorf("SLRU.Contains expected b true z false")
+	}
+}
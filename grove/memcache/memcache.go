@@ -19,14 +19,14 @@ import (
 	"sync/atomic"
 
 	"github.com/apache/trafficcontrol/grove/cacheobj"
-	"github.com/apache/trafficcontrol/grove/lru"
+	"github.com/apache/trafficcontrol/grove/cachepolicy"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
 )
 
-// MemCache is a threadsafe memory cache with a soft byte limit, enforced via LRU.
+// MemCache is a threadsafe memory cache with a soft byte limit, enforced via its cache policy, which is LRU by default.
 type MemCache struct {
-	lru          *lru.LRU                      // threadsafe.
+	lru          *cachepolicy.Policy           // threadsafe.
 	cache        map[string]*cacheobj.CacheObj // mutexed: MUST NOT access without locking cacheM. TODO test performance of sync.Map
 	cacheM       sync.RWMutex                  // TODO test performance of one mutex for lru+cache
 	sizeBytes    uint64                        // atomic: MUST NOT access without sync.atomic
@@ -34,11 +34,15 @@ type MemCache struct {
 	gcChan       chan<- uint64
 }
 
-func New(bytes uint64) *MemCache {
+// New creates a new MemCache with the given capacity and policy. If policy is nil, the cache uses LRU eviction and admits every object.
+func New(bytes uint64, policy *cachepolicy.Policy) *MemCache {
 	log.Errorf("MemCache.New: creating cache with %d capacity.", bytes)
+	if policy == nil {
+		policy = cachepolicy.Default()
+	}
 	gcChan := make(chan uint64, 1)
 	c := &MemCache{
-		lru:          lru.NewLRU(),
+		lru:          policy,
 		cache:        map[string]*cacheobj.CacheObj{},
 		maxSizeBytes: bytes,
 		gcChan:       gcChan,
@@ -55,6 +59,7 @@ func (c *MemCache) Get(key string) (*cacheobj.CacheObj, bool) {
 		atomic.AddUint64(&obj.HitCount, 1)
 	}
 	c.cacheM.RUnlock()
+	c.lru.Record(key, ok)
 	return obj, ok
 }
 
@@ -66,6 +71,10 @@ func (c *MemCache) Peek(key string) (*cacheobj.CacheObj, bool) {
 }
 
 func (c *MemCache) Add(key string, val *cacheobj.CacheObj) bool {
+	if !c.lru.Admit(key, val.Size, atomic.LoadUint64(&c.sizeBytes), c.maxSizeBytes) {
+		log.Debugf("MemCache.Add key '%v' not admitted by policy %v\n", key, c.lru.Name)
+		return false
+	}
 	c.cacheM.Lock()
 	c.cache[key] = val
 	c.cacheM.Unlock()
@@ -116,6 +125,7 @@ func (c *MemCache) gc(cacheSizeBytes uint64) {
 		c.cacheM.Lock()
 		delete(c.cache, key)
 		c.cacheM.Unlock()
+		c.lru.Stats.AddEviction()
 
 		cacheSizeBytes = atomic.AddUint64(&c.sizeBytes, ^uint64(sizeBytes-1)) // subtract sizeBytes
 	}
@@ -128,3 +138,9 @@ func (c *MemCache) Keys() []string {
 func (c *MemCache) Capacity() uint64 {
 	return c.maxSizeBytes
 }
+
+const PolicyTier = "memory"
+
+func (c *MemCache) PolicyStats() []cachepolicy.TierStats {
+	return []cachepolicy.TierStats{{Tier: PolicyTier, Policy: c.lru.Name, Stats: c.lru.Stats}}
+}
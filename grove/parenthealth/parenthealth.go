@@ -0,0 +1,381 @@
+package parenthealth
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// parenthealth tracks the health of parents across requests, so that parents which are failing are marked down and skipped by parent selection, rather than being retried by every new request.
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+// Config is the parent health configuration. The zero value disables markdown, although failures are still counted.
+type Config struct {
+	// MaxFailures is the number of consecutive failures (connection failures and retry codes) after which a parent is marked down. If 0, parents are never marked down for failures.
+	MaxFailures uint64
+	// MaxTimeouts is the number of consecutive timeouts after which a parent is marked down. If 0, parents are never marked down for timeouts.
+	MaxTimeouts uint64
+	// RetryWindow is the time after which a down parent is passively retried, by allowing a single request through. If 0, down parents are only marked up by active probes.
+	RetryWindow time.Duration
+	// ProbePath is the path to request for active health probes, appended to the parent URL. If empty, active probes are disabled.
+	ProbePath     string
+	ProbeInterval time.Duration
+	ProbeTimeout  time.Duration
+}
+
+// ConfigJSON is the remap rules JSON representation of Config.
+type ConfigJSON struct {
+	MaxFailures     uint64 `json:"max_failures"`
+	MaxTimeouts     uint64 `json:"max_timeouts"`
+	RetryWindowMS   int    `json:"retry_window_ms"`
+	ProbePath       string `json:"probe_path"`
+	ProbeIntervalMS int    `json:"probe_interval_ms"`
+	ProbeTimeoutMS  int    `json:"probe_timeout_ms"`
+}
+
+const DefaultProbeInterval = 5 * time.Second
+const DefaultProbeTimeout = 2 * time.Second
+
+// ToConfig returns the Config for the given JSON, with defaults applied for unset probe times.
+func (c ConfigJSON) ToConfig() Config {
+	cfg := Config{
+		MaxFailures:   c.MaxFailures,
+		MaxTimeouts:   c.MaxTimeouts,
+		RetryWindow:   time.Duration(c.RetryWindowMS) * time.Millisecond,
+		ProbePath:     c.ProbePath,
+		ProbeInterval: time.Duration(c.ProbeIntervalMS) * time.Millisecond,
+		ProbeTimeout:  time.Duration(c.ProbeTimeoutMS) * time.Millisecond,
+	}
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = DefaultProbeInterval
+	}
+	if cfg.ProbeTimeout <= 0 {
+		cfg.ProbeTimeout = DefaultProbeTimeout
+	}
+	return cfg
+}
+
+// Parent is the health state of a single parent. It is safe for concurrent use.
+type Parent struct {
+	name   string
+	target atomic.Value // target
+
+	failures    uint64 // atomic - consecutive failures
+	timeouts    uint64 // atomic - consecutive timeouts
+	down        int32  // atomic - 1 if down
+	downSince   int64  // atomic - unix nanoseconds the parent was marked down
+	lastRetry   int64  // atomic - unix nanoseconds of the last passive retry
+	lastFailure int64  // atomic - unix nanoseconds of the last failure or timeout
+
+	probeStop chan struct{}
+}
+
+// target is the parent's probe URL, transport, and config. These may change when remap rules are reloaded, so they're stored together atomically.
+type target struct {
+	url       string
+	transport *http.Transport
+	cfg       Config
+}
+
+func newParent(name string, url string, transport *http.Transport, cfg Config) *Parent {
+	p := &Parent{name: name}
+	p.target.Store(target{url: url, transport: transport, cfg: cfg})
+	return p
+}
+
+func (p *Parent) Name() string   { return p.name }
+func (p *Parent) config() Config { return p.target.Load().(target).cfg }
+
+// Down returns whether the parent is currently marked down.
+func (p *Parent) Down() bool {
+	return atomic.LoadInt32(&p.down) == 1
+}
+
+// Available returns whether the parent may be requested. Parents which are up are always available. Parents which are down are available to a single caller once per retry window, so a request can passively check whether the parent has recovered. A nil Parent is always available.
+// Calling Available on a down parent consumes its retry, so callers selecting between parents should check Selectable first, and only call Available on the parent they will request.
+func (p *Parent) Available() bool {
+	if p == nil || !p.Down() {
+		return true
+	}
+	lastRetry, ok := p.retryDue()
+	if !ok {
+		return false
+	}
+	// only one caller gets the retry; everyone else keeps skipping the parent until the retry succeeds or the next window.
+	return atomic.CompareAndSwapInt64(&p.lastRetry, lastRetry, time.Now().UnixNano())
+}
+
+// Selectable returns whether Available would currently return true, without consuming a passive retry. A nil Parent is always selectable.
+func (p *Parent) Selectable() bool {
+	if p == nil || !p.Down() {
+		return true
+	}
+	_, ok := p.retryDue()
+	return ok
+}
+
+// retryDue returns whether the down parent's retry window has passed, and the last retry time the retry must be claimed against.
+func (p *Parent) retryDue() (int64, bool) {
+	window := p.config().RetryWindow
+	if window <= 0 {
+		return 0, false
+	}
+	lastRetry := atomic.LoadInt64(&p.lastRetry)
+	windowStart := lastRetry
+	if downSince := atomic.LoadInt64(&p.downSince); downSince > windowStart {
+		windowStart = downSince
+	}
+	return lastRetry, time.Now().UnixNano()-windowStart >= int64(window)
+}
+
+// Success records a successful response from the parent, resetting its failure counts and marking it up.
+func (p *Parent) Success() {
+	if p == nil {
+		return
+	}
+	atomic.StoreUint64(&p.failures, 0)
+	atomic.StoreUint64(&p.timeouts, 0)
+	if atomic.CompareAndSwapInt32(&p.down, 1, 0) {
+		log.Infof("parent health: parent %v marked up\n", p.name)
+	}
+}
+
+// Failure records a failed response from the parent, marking it down if it has exceeded the configured consecutive failures.
+func (p *Parent) Failure() {
+	if p == nil {
+		return
+	}
+	atomic.StoreUint64(&p.timeouts, 0)
+	failures := atomic.AddUint64(&p.failures, 1)
+	p.fail(failures, p.config().MaxFailures, "failures")
+}
+
+// Timeout records a timed out request to the parent, marking it down if it has exceeded the configured consecutive timeouts.
+func (p *Parent) Timeout() {
+	if p == nil {
+		return
+	}
+	atomic.StoreUint64(&p.failures, 0)
+	timeouts := atomic.AddUint64(&p.timeouts, 1)
+	p.fail(timeouts, p.config().MaxTimeouts, "timeouts")
+}
+
+func (p *Parent) fail(count uint64, max uint64, kind string) {
+	now := time.Now().UnixNano()
+	atomic.StoreInt64(&p.lastFailure, now)
+	if max == 0 || count < max {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&p.down, 0, 1) {
+		atomic.StoreInt64(&p.downSince, now)
+		log.Warnf("parent health: parent %v marked down after %v consecutive %v\n", p.name, count, kind)
+	}
+}
+
+// State is a snapshot of a parent's health, for reporting.
+type State struct {
+	Name                string     `json:"name"`
+	Available           bool       `json:"available"`
+	ConsecutiveFailures uint64     `json:"consecutive_failures"`
+	ConsecutiveTimeouts uint64     `json:"consecutive_timeouts"`
+	DownSince           *time.Time `json:"down_since,omitempty"`
+	LastFailure         *time.Time `json:"last_failure,omitempty"`
+	Probing             bool       `json:"probing"`
+}
+
+// State returns a snapshot of the parent's health. It does not consume a passive retry.
+func (p *Parent) State() State {
+	s := State{
+		Name:                p.name,
+		Available:           !p.Down(),
+		ConsecutiveFailures: atomic.LoadUint64(&p.failures),
+		ConsecutiveTimeouts: atomic.LoadUint64(&p.timeouts),
+		Probing:             p.config().ProbePath != "",
+	}
+	if !s.Available {
+		t := time.Unix(0, atomic.LoadInt64(&p.downSince))
+		s.DownSince = &t
+	}
+	if lastFailure := atomic.LoadInt64(&p.lastFailure); lastFailure != 0 {
+		t := time.Unix(0, lastFailure)
+		s.LastFailure = &t
+	}
+	return s
+}
+
+// probe requests the parent's probe path, and records the result. Any response below 500 is considered healthy.
+func (p *Parent) probe() {
+	t := p.target.Load().(target)
+	req, err := http.NewRequest(http.MethodGet, t.url+t.cfg.ProbePath, nil)
+	if err != nil {
+		log.Errorf("parent health: creating probe request for parent %v: %v\n", p.name, err)
+		return
+	}
+	client := &http.Client{Transport: t.transport, Timeout: t.cfg.ProbeTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Debugf("parent health: probe to parent %v failed: %v\n", p.name, err)
+		p.Failure()
+		return
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		log.Debugf("parent health: probe to parent %v returned %v\n", p.name, resp.StatusCode)
+		p.Failure()
+		return
+	}
+	p.Success()
+}
+
+func (p *Parent) startProbing() {
+	p.probeStop = make(chan struct{})
+	go func(stop chan struct{}) {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(p.config().ProbeInterval):
+				p.probe()
+			}
+		}
+	}(p.probeStop)
+}
+
+func (p *Parent) stopProbing() {
+	if p.probeStop != nil {
+		close(p.probeStop)
+		p.probeStop = nil
+	}
+}
+
+// Registry holds the health of all parents. Parents are keyed by name, so state is shared between remap rules with the same parent, and is kept across remap rule reloads.
+type Registry struct {
+	m       sync.Mutex
+	parents map[string]*Parent
+}
+
+func NewRegistry() *Registry {
+	return &Registry{parents: map[string]*Parent{}}
+}
+
+// Get returns the parent with the given name, creating it if it doesn't exist. The url is the URL requested by active probes, and the transport is used to make them. If the parent already exists, its config is updated, and probes are started or stopped as necessary.
+func (r *Registry) Get(name string, url string, transport *http.Transport, cfg Config) *Parent {
+	r.m.Lock()
+	defer r.m.Unlock()
+	p, ok := r.parents[name]
+	if !ok {
+		p = newParent(name, url, transport, cfg)
+		r.parents[name] = p
+	}
+	r.update(p, target{url: url, transport: transport, cfg: cfg})
+	return p
+}
+
+// update sets the parent's target, and starts or stops its probes as necessary. The registry mutex must be held.
+func (r *Registry) update(p *Parent, t target) {
+	p.target.Store(t)
+	if t.cfg.ProbePath != "" && p.probeStop == nil {
+		p.startProbing()
+	} else if t.cfg.ProbePath == "" {
+		p.stopProbing()
+	}
+}
+
+// Retain removes all parents not in the given names, and stops their active probes. This should be called after loading remap rules, to remove parents which no longer exist.
+func (r *Registry) Retain(names map[string]struct{}) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.retain(names)
+}
+
+func (r *Registry) retain(names map[string]struct{}) {
+	for name, p := range r.parents {
+		if _, ok := names[name]; ok {
+			continue
+		}
+		p.stopProbing()
+		delete(r.parents, name)
+	}
+}
+
+// Set is the parents of a remap rules load. Parents are taken from the registry, so their health is kept across loads, but nothing in the registry is changed, and no probes are started, until the set is committed. So a load which fails part way doesn't leak parents or probes.
+type Set struct {
+	r       *Registry
+	parents map[string]*Parent
+	targets map[string]target
+}
+
+// NewSet returns an empty set of parents, to be committed to the registry.
+func (r *Registry) NewSet() *Set {
+	return &Set{r: r, parents: map[string]*Parent{}, targets: map[string]target{}}
+}
+
+// Get returns the parent with the given name, from the registry if it exists there, otherwise a new parent. The url, transport, and config are applied when the set is committed; if the set gets the same parent more than once, the last is applied.
+func (s *Set) Get(name string, url string, transport *http.Transport, cfg Config) *Parent {
+	t := target{url: url, transport: transport, cfg: cfg}
+	s.targets[name] = t
+	if p, ok := s.parents[name]; ok {
+		return p
+	}
+	s.r.m.Lock()
+	p, ok := s.r.parents[name]
+	s.r.m.Unlock()
+	if !ok {
+		p = newParent(name, url, transport, cfg)
+	}
+	s.parents[name] = p
+	return p
+}
+
+// Commit registers the set's parents, applies their config, starts or stops their probes as necessary, and removes all parents not in the set. This should be called once the remap rules using the set have loaded successfully.
+func (r *Registry) Commit(s *Set) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	names := make(map[string]struct{}, len(s.parents))
+	for name, p := range s.parents {
+		if old, ok := r.parents[name]; ok && old != p {
+			old.stopProbing() // registered by another load since the set got it
+		}
+		r.parents[name] = p
+		r.update(p, s.targets[name])
+		names[name] = struct{}{}
+	}
+	r.retain(names)
+}
+
+// States returns a snapshot of the health of every parent, sorted by name.
+func (r *Registry) States() []State {
+	r.m.Lock()
+	parents := make([]*Parent, 0, len(r.parents))
+	for _, p := range r.parents {
+		parents = append(parents, p)
+	}
+	r.m.Unlock()
+
+	states := make([]State, 0, len(parents))
+	for _, p := range parents {
+		states = append(states, p.State())
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states
+}
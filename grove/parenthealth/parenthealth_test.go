@@ -0,0 +1,222 @@
+package parenthealth
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParentMarkdown(t *testing.T) {
+	r := NewRegistry()
+	p := r.Get("http://parent.example", "http://parent.example", nil, Config{MaxFailures: 3, MaxTimeouts: 2})
+
+	p.Failure()
+	p.Failure()
+	if !p.Available() {
+		t.Errorf("Parent.Available after 2 of 3 failures expected true, actual false")
+	}
+	p.Failure()
+	if p.Available() {
+		t.Errorf("Parent.Available after 3 of 3 failures expected false, actual true")
+	}
+	p.Success()
+	if !p.Available() {
+		t.Errorf("Parent.Available after success expected true, actual false")
+	}
+
+	p.Timeout()
+	p.Failure() // a failure resets consecutive timeouts
+	p.Timeout()
+	if !p.Available() {
+		t.Errorf("Parent.Available after non-consecutive timeouts expected true, actual false")
+	}
+	p.Timeout()
+	if p.Available() {
+		t.Errorf("Parent.Available after 2 of 2 consecutive timeouts expected false, actual true")
+	}
+}
+
+func TestParentDisabled(t *testing.T) {
+	p := NewRegistry().Get("foo", "http://foo.example", nil, Config{})
+	for i := 0; i < 100; i++ {
+		p.Failure()
+		p.Timeout()
+	}
+	if !p.Available() {
+		t.Errorf("Parent.Available with markdown disabled expected true, actual false")
+	}
+	if state := p.State(); state.ConsecutiveTimeouts != 1 {
+		t.Errorf("Parent.State.ConsecutiveTimeouts expected 1, actual %v", state.ConsecutiveTimeouts)
+	}
+
+	nilParent := (*Parent)(nil)
+	nilParent.Failure()
+	if !nilParent.Available() {
+		t.Errorf("nil Parent.Available expected true, actual false")
+	}
+}
+
+func TestParentRetryWindow(t *testing.T) {
+	window := 50 * time.Millisecond
+	p := NewRegistry().Get("foo", "http://foo.example", nil, Config{MaxFailures: 1, RetryWindow: window})
+	p.Failure()
+	if p.Available() {
+		t.Fatalf("Parent.Available before retry window expected false, actual true")
+	}
+	time.Sleep(window + 10*time.Millisecond)
+	if !p.Available() {
+		t.Fatalf("Parent.Available after retry window expected true, actual false")
+	}
+	if p.Available() {
+		t.Errorf("Parent.Available second caller in the same retry window expected false, actual true")
+	}
+
+	p.Failure() // the retry failed
+	if p.Available() {
+		t.Errorf("Parent.Available after failed retry expected false, actual true")
+	}
+	time.Sleep(window + 10*time.Millisecond)
+	if !p.Available() {
+		t.Fatalf("Parent.Available after second retry window expected true, actual false")
+	}
+	p.Success()
+	if p.Down() {
+		t.Errorf("Parent.Down after successful retry expected false, actual true")
+	}
+}
+
+func TestParentProbe(t *testing.T) {
+	healthy := int32(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			t.Errorf("probe path expected /health, actual %v", r.URL.Path)
+		}
+		if atomic.LoadInt32(&healthy) == 1 {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	r := NewRegistry()
+	p := r.Get(srv.URL, srv.URL, &http.Transport{}, Config{MaxFailures: 1, ProbePath: "/health", ProbeInterval: 10 * time.Millisecond, ProbeTimeout: time.Second})
+	defer r.Retain(map[string]struct{}{})
+
+	waitFor := func(down bool) bool {
+		for i := 0; i < 200; i++ {
+			if p.Down() == down {
+				return true
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		return false
+	}
+
+	if !waitFor(true) {
+		t.Fatalf("Parent.Down with failing probe expected true, actual false")
+	}
+	atomic.StoreInt32(&healthy, 1)
+	if !waitFor(false) {
+		t.Fatalf("Parent.Down with successful probe expected false, actual true")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	foo := r.Get("foo", "http://foo.example", nil, Config{MaxFailures: 1})
+	r.Get("bar", "http://bar.example", nil, Config{})
+	if r.Get("foo", "http://foo.example", nil, Config{MaxFailures: 1}) != foo {
+		t.Errorf("Registry.Get existing parent expected same parent, actual new parent")
+	}
+
+	foo.Failure()
+	r.Retain(map[string]struct{}{"foo": {}})
+
+	states := r.States()
+	if len(states) != 1 {
+		t.Fatalf("Registry.States after Retain expected 1 parent, actual %v", len(states))
+	}
+	if states[0].Name != "foo" || states[0].Available || states[0].DownSince == nil {
+		t.Errorf("Registry.States expected foo down, actual %+v", states[0])
+	}
+}
+
+func TestParentSelectable(t *testing.T) {
+	window := 50 * time.Millisecond
+	p := NewRegistry().Get("foo", "http://foo.example", nil, Config{MaxFailures: 1, RetryWindow: window})
+	p.Failure()
+	if p.Selectable() {
+		t.Fatalf("Parent.Selectable before retry window expected false, actual true")
+	}
+	time.Sleep(window + 10*time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if !p.Selectable() {
+			t.Fatalf("Parent.Selectable after retry window expected true, actual false")
+		}
+	}
+	if !p.Available() {
+		t.Fatalf("Parent.Available after Selectable expected true, actual false")
+	}
+	if p.Selectable() {
+		t.Errorf("Parent.Selectable after retry taken expected false, actual true")
+	}
+}
+
+func TestRegistrySet(t *testing.T) {
+	r := NewRegistry()
+	foo := r.Get("foo", "http://foo.example", nil, Config{MaxFailures: 1})
+	foo.Failure()
+	r.Get("bar", "http://bar.example", nil, Config{})
+
+	s := r.NewSet()
+	if s.Get("foo", "http://foo.example", nil, Config{MaxFailures: 2}) != foo {
+		t.Errorf("Set.Get registered parent expected same parent, actual new parent")
+	}
+	baz := s.Get("baz", "http://baz.example", nil, Config{ProbePath: "/health", ProbeInterval: time.Hour})
+	if s.Get("baz", "http://baz.example", nil, Config{ProbePath: "/health", ProbeInterval: time.Hour}) != baz {
+		t.Errorf("Set.Get parent already in the set expected same parent, actual new parent")
+	}
+	if states := r.States(); len(states) != 2 {
+		t.Fatalf("Registry.States before Commit expected 2 parents, actual %v", len(states))
+	}
+	if baz.probeStop != nil {
+		t.Errorf("Set.Get expected probes not to start before Commit, actual started")
+	}
+	if foo.config().MaxFailures != 1 {
+		t.Errorf("Set.Get expected config not to change before Commit, actual %+v", foo.config())
+	}
+
+	r.Commit(s)
+	defer r.Retain(map[string]struct{}{})
+
+	states := r.States()
+	if len(states) != 2 || states[0].Name != "baz" || states[1].Name != "foo" {
+		t.Fatalf("Registry.States after Commit expected baz and foo, actual %+v", states)
+	}
+	if states[1].Available {
+		t.Errorf("Registry.Commit expected foo to stay down, actual up")
+	}
+	if foo.config().MaxFailures != 2 {
+		t.Errorf("Registry.Commit expected foo config to be updated, actual %+v", foo.config())
+	}
+	if baz.probeStop == nil {
+		t.Errorf("Registry.Commit expected baz probes to start, actual not started")
+	}
+}
@@ -37,6 +37,9 @@ func init() {
 
 const StatsEndpoint = "/_astats"
 
+// DefaultCacheStatName is the name used in stats for the default memory cache, whose name is empty.
+const DefaultCacheStatName = "default"
+
 func stats(icfg interface{}, d OnRequestData) bool {
 	if !strings.HasPrefix(d.R.URL.Path, StatsEndpoint) {
 		log.Debugf("plugin onrequest http_stats returning, not in path '" + d.R.URL.Path + "'\n")
@@ -119,14 +122,37 @@ func LoadRemapStats(stats stat.Stats, httpConns *web.ConnMap, httpsConns *web.Co
 		jsonStats["plugin.remap_stats."+ruleName+".status_5xx"] = statsRemap.Status5xx()
 		jsonStats["plugin.remap_stats."+ruleName+".cache_hits"] = statsRemap.CacheHits()
 		jsonStats["plugin.remap_stats."+ruleName+".cache_misses"] = statsRemap.CacheMisses()
+		jsonStats["plugin.remap_stats."+ruleName+".negative_cache_hits"] = statsRemap.NegativeCacheHits()
 	}
 
 	jsonStats["proxy.process.http.current_client_connections"] = httpConns.Len() + httpsConns.Len()
 	jsonStats["proxy.process.http.cache_hits"] = stats.CacheHits()
 	jsonStats["proxy.process.http.cache_misses"] = stats.CacheMisses()
+	jsonStats["proxy.process.http.negative_cache_hits"] = stats.NegativeCacheHits()
 	jsonStats["proxy.process.http.cache_capacity_bytes"] = stats.CacheCapacity()
 	jsonStats["proxy.process.http.cache_size_bytes"] = stats.CacheSize()
 
+	for _, cacheName := range stats.CacheNames() {
+		tiers, ok := stats.CachePolicyStatsByName(cacheName)
+		if !ok {
+			continue
+		}
+		statName := cacheName
+		if statName == "" {
+			statName = DefaultCacheStatName
+		}
+		for _, tier := range tiers {
+			prefix := "plugin.cache_policy." + statName + "." + tier.Tier + "."
+			jsonStats[prefix+"policy"] = tier.Policy
+			jsonStats[prefix+"hits"] = tier.Stats.Hits()
+			jsonStats[prefix+"misses"] = tier.Stats.Misses()
+			jsonStats[prefix+"hit_ratio"] = tier.Stats.HitRatio()
+			jsonStats[prefix+"admitted"] = tier.Stats.Admitted()
+			jsonStats[prefix+"rejected"] = tier.Stats.Rejected()
+			jsonStats[prefix+"evictions"] = tier.Stats.Evictions()
+		}
+	}
+
 	return jsonStats
 }
 
@@ -28,6 +28,7 @@ import (
 	"github.com/apache/trafficcontrol/grove/cachedata"
 	"github.com/apache/trafficcontrol/grove/cacheobj"
 	"github.com/apache/trafficcontrol/grove/config"
+	"github.com/apache/trafficcontrol/grove/parenthealth"
 	"github.com/apache/trafficcontrol/grove/remapdata"
 	"github.com/apache/trafficcontrol/grove/stat"
 	"github.com/apache/trafficcontrol/grove/web"
@@ -70,6 +71,7 @@ type OnRequestData struct {
 	HTTPSConns    *web.ConnMap
 	RequestID     uint64
 	Context       *interface{}
+	ParentHealth  *parenthealth.Registry
 	cachedata.SrvrData
 }
 
@@ -95,8 +97,10 @@ type BeforeRespondData struct {
 type BeforeCacheLookUpData struct {
 	Req                  *http.Request
 	CacheKeyOverrideFunc func(string)
-	DefaultCacheKey      string
-	Context              *interface{}
+	// SliceFunc makes the request be served by fetching and caching the object from the parent in blocks of the given size in bytes, rather than as a single object. See the range_req_handler plugin.
+	SliceFunc       func(blockSize int64)
+	DefaultCacheKey string
+	Context         *interface{}
 }
 
 type AfterRespondData struct {
@@ -35,10 +35,15 @@ type byteRange struct {
 const MAXINT64 = 1<<63 - 1
 
 type rangeRequestConfig struct {
-	Mode              string `json:"mode"`
+	Mode string `json:"mode"`
+	// BlockSize is the size in bytes of the blocks fetched from the parent and cached, in slice mode.
+	BlockSize         int64  `json:"block_size"`
 	MultiPartBoundary string // not in the json
 }
 
+// DefaultSliceBlockSize is the block size used in slice mode, if none is configured.
+const DefaultSliceBlockSize = 1024 * 1024
+
 func init() {
 	AddPlugin(10000, Funcs{
 		load:                rangeReqHandleLoad,
@@ -59,9 +64,12 @@ func rangeReqHandleLoad(b json.RawMessage) interface{} {
 		log.Errorln("range_rew_handler  loading config, unmarshalling JSON: " + err.Error())
 		return nil
 	}
-	if !(cfg.Mode == "get_full_serve_range" || cfg.Mode == "patch") {
+	if !(cfg.Mode == "get_full_serve_range" || cfg.Mode == "patch" || cfg.Mode == "store_ranges" || cfg.Mode == "slice") {
 		log.Errorf("Unknown mode for range_req_handler plugin: %s\n", cfg.Mode)
 	}
+	if cfg.Mode == "slice" && cfg.BlockSize <= 0 {
+		cfg.BlockSize = DefaultSliceBlockSize
+	}
 
 	multipartBoundaryBytes := make([]byte, 16)
 	if _, err := rand.Read(multipartBoundaryBytes); err != nil {
@@ -88,13 +96,19 @@ func rangeReqHandlerOnRequest(icfg interface{}, d OnRequestData) bool {
 	return false
 }
 
-// rangeReqHandleBeforeCacheLookup is used to override the cacheKey when in store_ranges mode.
+// rangeReqHandleBeforeCacheLookup is used to override the cacheKey when in store_ranges mode, and to slice the object when in slice mode.
 func rangeReqHandleBeforeCacheLookup(icfg interface{}, d BeforeCacheLookUpData) {
 	cfg, ok := icfg.(*rangeRequestConfig)
 	if !ok {
 		log.Errorf("range_req_handler config '%v' type '%T' expected *rangeRequestConfig\n", icfg, icfg)
 		return
 	}
+	if cfg.Mode == "slice" {
+		// slice mode slices all requests, not just those with a Range header, so the object is cached in the same blocks regardless of what clients request.
+		d.SliceFunc(cfg.BlockSize)
+		log.Debugf("range_req_handler: slicing key %s with block size %d\n", d.DefaultCacheKey, cfg.BlockSize)
+		return
+	}
 	if cfg.Mode == "store_ranges" {
 		sep := "?"
 		if strings.Contains(d.DefaultCacheKey, "?") {
@@ -130,6 +144,7 @@ func rangeReqHandleBeforeParent(icfg interface{}, d BeforeParentRequestData) {
 // rangeReqHandleBeforeRespond builds the 206 response
 // Assume all the needed ranges have been put in cache before, which is the truth for "get_full_serve_range" mode which gets the whole object into cache.
 // If mode == store_ranges, do nothing, we just return the object stored-as is
+// If mode == slice, do nothing, the cache has already assembled the requested range from the object's blocks
 func rangeReqHandleBeforeRespond(icfg interface{}, d BeforeRespondData) {
 	log.Debugf("rangeReqHandleBeforeRespond calling\n")
 	ictx := d.Context
@@ -146,7 +161,7 @@ func rangeReqHandleBeforeRespond(icfg interface{}, d BeforeRespondData) {
 		log.Errorf("range_req_handler config '%v' type '%T' expected *rangeRequestConfig\n", icfg, icfg)
 		return
 	}
-	if cfg.Mode == "store_ranges" {
+	if cfg.Mode == "store_ranges" || cfg.Mode == "slice" {
 		return // no need to do anything here.
 	}
 
@@ -27,6 +27,7 @@ import (
 
 	"github.com/apache/trafficcontrol/grove/chash"
 	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/parenthealth"
 	"github.com/apache/trafficcontrol/grove/plugin"
 	"github.com/apache/trafficcontrol/grove/remapdata"
 	"github.com/apache/trafficcontrol/grove/web"
@@ -108,19 +109,26 @@ type Remapping struct {
 	RetryCodes      map[int]struct{}
 	Cache           icache.Cache
 	Transport       *http.Transport
+	// Health is the health of the selected parent, to which the result of the request should be reported. May be nil.
+	Health *parenthealth.Parent
+	// NegativeCache is the negative caching config of the rule. May be nil.
+	NegativeCache *remapdata.NegativeCache
 }
 
 // RemappingProducer takes an HTTP Request and returns a Remapping to be used for that request.
 // TODO rename? interface?
 type RemappingProducer struct {
-	oldURI   string
-	rule     remapdata.RemapRule
-	cacheKey string
-	failures int
+	oldURI         string
+	rule           remapdata.RemapRule
+	cacheKey       string
+	failures       int
+	sliceBlockSize int64
 }
 
 func (p *RemappingProducer) CacheKey() string                  { return p.cacheKey }
 func (p *RemappingProducer) OverrideCacheKey(newKey string)    { p.cacheKey = newKey }
+func (p *RemappingProducer) SliceBlockSize() int64             { return p.sliceBlockSize }
+func (p *RemappingProducer) Slice(blockSize int64)             { p.sliceBlockSize = blockSize }
 func (p *RemappingProducer) ConnectionClose() bool             { return p.rule.ConnectionClose }
 func (p *RemappingProducer) Name() string                      { return p.rule.Name }
 func (p *RemappingProducer) DSCP() int                         { return p.rule.DSCP }
@@ -169,13 +177,36 @@ func (hr simpleHTTPRequestRemapper) RemappingProducer(r *http.Request, scheme st
 	}, nil
 }
 
+// ForKey returns a new RemappingProducer for the same request and rule, with the given cache key and no failures. This is used to make multiple parent requests for a single client request, for example the blocks of a sliced object, each with its own retries.
+func (p *RemappingProducer) ForKey(cacheKey string) *RemappingProducer {
+	return &RemappingProducer{
+		oldURI:         p.oldURI,
+		rule:           p.rule,
+		cacheKey:       cacheKey,
+		sliceBlockSize: p.sliceBlockSize,
+	}
+}
+
+// WithCache returns a new RemappingProducer like this one, whose remappings add the objects they fetch to the given cache instead of the rule's.
+func (p *RemappingProducer) WithCache(cache icache.Cache) *RemappingProducer {
+	rule := p.rule
+	rule.Cache = cache
+	return &RemappingProducer{
+		oldURI:         p.oldURI,
+		rule:           rule,
+		cacheKey:       p.cacheKey,
+		failures:       p.failures,
+		sliceBlockSize: p.sliceBlockSize,
+	}
+}
+
 // GetNext returns the remapping to use to request, whether retries are allowed (i.e. if this is the last retry), or any error
 func (p *RemappingProducer) GetNext(r *http.Request) (Remapping, bool, error) {
 	if *p.rule.RetryNum < p.failures {
 		return Remapping{}, false, ErrNoMoreRetries
 	}
 
-	newURI, proxyURL, transport := p.rule.URI(p.oldURI, r.URL.Path, r.URL.RawQuery, p.failures)
+	newURI, proxyURL, transport, health := p.rule.URI(p.oldURI, r.URL.Path, r.URL.RawQuery, p.failures)
 	p.failures++
 	newReq, err := http.NewRequest(r.Method, newURI, nil)
 	if err != nil {
@@ -201,6 +232,8 @@ func (p *RemappingProducer) GetNext(r *http.Request) (Remapping, bool, error) {
 		RetryCodes:      p.rule.RetryCodes,
 		Cache:           p.rule.Cache,
 		Transport:       transport,
+		Health:          health,
+		NegativeCache:   p.rule.NegativeCache,
 	}, retryAllowed, nil
 }
 
@@ -272,6 +305,10 @@ type RemapRulesStatsJSON struct {
 type RemapRulesBase struct {
 	RetryNum      *int                       `json:"retry_num"`
 	PluginsShared map[string]json.RawMessage `json:"plugins_shared"`
+	// ParentHealth is the parent health markdown config, for all parents. If nil, parents are never marked down.
+	ParentHealth *parenthealth.ConfigJSON `json:"parent_health"`
+	// NegativeCache is the default negative caching config of rules which don't have their own. If nil, rules without their own don't negatively cache.
+	NegativeCache *remapdata.NegativeCacheJSON `json:"negative_cache"`
 }
 
 type RemapRulesJSON struct {
@@ -308,18 +345,20 @@ type HdrModder interface {
 
 type RemapRuleJSON struct {
 	remapdata.RemapRuleBase
-	TimeoutMS       *int                       `json:"timeout_ms"`
-	ParentSelection *string                    `json:"parent_selection"`
-	To              []RemapRuleToJSON          `json:"to"`
-	Allow           []string                   `json:"allow"`
-	Deny            []string                   `json:"deny"`
-	RetryCodes      *[]int                     `json:"retry_codes"`
-	CacheName       *string                    `json:"cache_name"`
-	Plugins         map[string]json.RawMessage `json:"plugins"`
-}
-
-// LoadRemapRules returns the loaded rules, the global plugins, the Stats remap rules, and any error
-func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc, caches map[string]icache.Cache, baseTransport *http.Transport) ([]remapdata.RemapRule, map[string]interface{}, *remapdata.RemapRulesStats, error) {
+	TimeoutMS       *int                         `json:"timeout_ms"`
+	ParentSelection *string                      `json:"parent_selection"`
+	To              []RemapRuleToJSON            `json:"to"`
+	Allow           []string                     `json:"allow"`
+	Deny            []string                     `json:"deny"`
+	RetryCodes      *[]int                       `json:"retry_codes"`
+	CacheName       *string                      `json:"cache_name"`
+	Plugins         map[string]json.RawMessage   `json:"plugins"`
+	NegativeCache   *remapdata.NegativeCacheJSON `json:"negative_cache"`
+}
+
+// LoadRemapRules returns the loaded rules, the global plugins, the Stats remap rules, and any error.
+// The parentHealth registry is shared across loads, so parent health is kept when rules are reloaded. The registry is only changed if the load succeeds, when parents no longer in any rule are removed from it.
+func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc, caches map[string]icache.Cache, baseTransport *http.Transport, parentHealth *parenthealth.Registry) ([]remapdata.RemapRule, map[string]interface{}, *remapdata.RemapRulesStats, error) {
 	fmt.Println(time.Now().Format(time.RFC3339Nano) + " Loading Remap Rules")
 	defer func() {
 		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Loaded Remap Rules")
@@ -376,6 +415,19 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 		}
 	}
 
+	parentHealthCfg := parenthealth.Config{}
+	if remapRulesJSON.ParentHealth != nil {
+		parentHealthCfg = remapRulesJSON.ParentHealth.ToConfig()
+	}
+	parents := parentHealth.NewSet()
+
+	negativeCache := (*remapdata.NegativeCache)(nil)
+	if remapRulesJSON.NegativeCache != nil {
+		if negativeCache, err = remapRulesJSON.NegativeCache.ToNegativeCache(); err != nil {
+			return nil, nil, nil, fmt.Errorf("error parsing rules negative_cache: %v", err)
+		}
+	}
+
 	rules := make([]remapdata.RemapRule, len(remapRulesJSON.Rules))
 	for i, jsonRule := range remapRulesJSON.Rules {
 		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Creating Remap Rule " + jsonRule.Name)
@@ -422,6 +474,14 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 			rule.PluginsShared = remapRules.PluginsShared
 		}
 
+		if jsonRule.NegativeCache != nil {
+			if rule.NegativeCache, err = jsonRule.NegativeCache.ToNegativeCache(); err != nil {
+				return nil, nil, nil, fmt.Errorf("error parsing rule %v negative_cache: %v", rule.Name, err)
+			}
+		} else {
+			rule.NegativeCache = negativeCache
+		}
+
 		cacheName := "" // default string is the default cache
 		if jsonRule.CacheName != nil {
 			cacheName = *jsonRule.CacheName
@@ -437,7 +497,7 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 		if rule.Deny, err = makeIPNets(jsonRule.Deny); err != nil {
 			return nil, nil, nil, fmt.Errorf("error parsing rule %v denys: %v", rule.Name, err)
 		}
-		if rule.To, err = makeTo(jsonRule.To, rule, baseTransport); err != nil {
+		if rule.To, err = makeTo(jsonRule.To, rule, baseTransport, parents, parentHealthCfg); err != nil {
 			return nil, nil, nil, fmt.Errorf("error parsing rule %v to: %v", rule.Name, err)
 		}
 		if jsonRule.ParentSelection != nil {
@@ -460,10 +520,13 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 		if *rule.ParentSelection == remapdata.ParentSelectionTypeConsistentHash {
 			rule.ConsistentHash = makeRuleHash(rule)
 		} else {
+			rule.RoundRobin = new(uint64)
 		}
 		rules[i] = rule
 	}
 
+	parentHealth.Commit(parents)
+
 	return rules, remapRules.Plugins, &remapRules.Stats, nil
 }
 
@@ -472,7 +535,7 @@ const DefaultReplicas = 1024
 func makeRuleHash(rule remapdata.RemapRule) chash.ATSConsistentHash {
 	h := chash.NewSimpleATSConsistentHash(DefaultReplicas)
 	for _, to := range rule.To {
-		h.Insert(&chash.ATSConsistentHashNode{Name: to.URL, ProxyURL: to.ProxyURL, Transport: to.Transport}, *to.Weight)
+		h.Insert(&chash.ATSConsistentHashNode{Name: to.URL, ProxyURL: to.ProxyURL, Transport: to.Transport, Health: to.Health}, *to.Weight)
 	}
 	if h.First() == nil {
 		fmt.Println(time.Now().Format(time.RFC3339Nano) + " ERROR  makeRuleHash " + rule.Name + " NodeMap empty!")
@@ -481,7 +544,7 @@ func makeRuleHash(rule remapdata.RemapRule) chash.ATSConsistentHash {
 	return h
 }
 
-func makeTo(tosJSON []RemapRuleToJSON, rule remapdata.RemapRule, baseTransport *http.Transport) ([]remapdata.RemapRuleTo, error) {
+func makeTo(tosJSON []RemapRuleToJSON, rule remapdata.RemapRule, baseTransport *http.Transport, parents *parenthealth.Set, parentHealthCfg parenthealth.Config) ([]remapdata.RemapRuleTo, error) {
 	tos := make([]remapdata.RemapRuleTo, len(tosJSON))
 	for i, toJSON := range tosJSON {
 		if toJSON.Weight == nil {
@@ -533,11 +596,20 @@ func makeTo(tosJSON []RemapRuleToJSON, rule remapdata.RemapRule, baseTransport *
 		} else if to.RetryCodes == nil {
 			return nil, fmt.Errorf("error parsing to %v - no retry_codes - must be set at rules, rule, or to level", to.URL)
 		}
+		to.Health = parents.Get(parentHealthName(to), to.URL, to.Transport, parentHealthCfg)
 		tos[i] = to
 	}
 	return tos, nil
 }
 
+// parentHealthName returns the name to track the given parent's health under. If the parent is a forward proxy, that's the proxy, otherwise it's the parent URL.
+func parentHealthName(to remapdata.RemapRuleTo) string {
+	if to.ProxyURL != nil && to.ProxyURL.Host != "" {
+		return to.ProxyURL.String()
+	}
+	return to.URL
+}
+
 func makeIPNets(netStrs []string) ([]*net.IPNet, error) {
 	nets := make([]*net.IPNet, 0, len(netStrs))
 	for _, netStr := range netStrs {
@@ -562,8 +634,8 @@ func makeIPNet(cidr string) (*net.IPNet, error) {
 	return cidrnet, nil
 }
 
-func LoadRemapper(path string, pluginConfigLoaders map[string]plugin.LoadFunc, caches map[string]icache.Cache, baseTransport *http.Transport) (HTTPRequestRemapper, error) {
-	rules, plugins, statRules, err := LoadRemapRules(path, pluginConfigLoaders, caches, baseTransport)
+func LoadRemapper(path string, pluginConfigLoaders map[string]plugin.LoadFunc, caches map[string]icache.Cache, baseTransport *http.Transport, parentHealth *parenthealth.Registry) (HTTPRequestRemapper, error) {
+	rules, plugins, statRules, err := LoadRemapRules(path, pluginConfigLoaders, caches, baseTransport, parentHealth)
 	if err != nil {
 		return nil, err
 	}
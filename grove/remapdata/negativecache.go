@@ -0,0 +1,85 @@
+package remapdata
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultNegativeCacheMaxBytes is the largest response body which is negatively cached, if the config doesn't specify one. Error responses are typically small, and large ones aren't worth evicting real objects for.
+const DefaultNegativeCacheMaxBytes = 64 * 1024
+
+// NegativeCacheJSON is the JSON negative caching config of a remap rule.
+type NegativeCacheJSON struct {
+	// TTLsMS are the milliseconds to cache responses, keyed by status code, e.g. "404", or class, e.g. "5xx". Codes take precedence over classes.
+	TTLsMS map[string]int `json:"ttls_ms"`
+	// MaxBytes is the largest response body to negatively cache. If nil, DefaultNegativeCacheMaxBytes is used.
+	MaxBytes *uint64 `json:"max_bytes"`
+}
+
+// NegativeCache is the negative caching config of a remap rule: how long to cache error responses which the parent didn't give an explicit freshness lifetime, which would otherwise not be cached, or be cached for a heuristic lifetime.
+type NegativeCache struct {
+	codeTTLs  map[int]time.Duration
+	classTTLs map[int]time.Duration
+	maxBytes  uint64
+}
+
+// ToNegativeCache validates the JSON config, and returns the NegativeCache it describes.
+func (j NegativeCacheJSON) ToNegativeCache() (*NegativeCache, error) {
+	nc := &NegativeCache{
+		codeTTLs:  map[int]time.Duration{},
+		classTTLs: map[int]time.Duration{},
+		maxBytes:  DefaultNegativeCacheMaxBytes,
+	}
+	if j.MaxBytes != nil {
+		nc.maxBytes = *j.MaxBytes
+	}
+	for key, ms := range j.TTLsMS {
+		if ms < 0 {
+			return nil, errors.New("ttl for '" + key + "' must not be negative")
+		}
+		ttl := time.Duration(ms) * time.Millisecond
+		key = strings.ToLower(key)
+		if len(key) == 3 && strings.HasSuffix(key, "xx") {
+			class, err := strconv.Atoi(key[:1])
+			if err != nil || class < 1 || class > 5 {
+				return nil, errors.New("invalid status class '" + key + "'")
+			}
+			nc.classTTLs[class] = ttl
+			continue
+		}
+		code, err := strconv.Atoi(key)
+		if err != nil || code < 100 || code > 599 {
+			return nil, errors.New("invalid status code '" + key + "'")
+		}
+		nc.codeTTLs[code] = ttl
+	}
+	return nc, nil
+}
+
+// TTL returns how long to negatively cache a response with the given code and body size, and whether it should be negatively cached at all. It is safe to call on a nil NegativeCache, which never caches.
+func (nc *NegativeCache) TTL(code int, bodyBytes int) (time.Duration, bool) {
+	if nc == nil || uint64(bodyBytes) > nc.maxBytes {
+		return 0, false
+	}
+	ttl, ok := nc.codeTTLs[code]
+	if !ok {
+		ttl, ok = nc.classTTLs[code/100]
+	}
+	return ttl, ok && ttl > 0
+}
@@ -0,0 +1,63 @@
+package remapdata
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNegativeCacheTTL(t *testing.T) {
+	maxBytes := uint64(100)
+	nc, err := NegativeCacheJSON{TTLsMS: map[string]int{"404": 1000, "5xx": 2000, "503": 0, "4XX": 3000}, MaxBytes: &maxBytes}.ToNegativeCache()
+	if err != nil {
+		t.Fatalf("ToNegativeCache expected nil error, actual %v", err)
+	}
+
+	tests := []struct {
+		code  int
+		bytes int
+		ttl   time.Duration
+		ok    bool
+	}{
+		{code: 404, bytes: 10, ttl: time.Second, ok: true},
+		{code: 410, bytes: 10, ttl: 3 * time.Second, ok: true},
+		{code: 500, bytes: 10, ttl: 2 * time.Second, ok: true},
+		{code: 503, bytes: 10, ok: false}, // a 0 code TTL overrides its class
+		{code: 404, bytes: 101, ok: false},
+		{code: 200, bytes: 10, ok: false},
+	}
+	for _, test := range tests {
+		ttl, ok := nc.TTL(test.code, test.bytes)
+		if ok != test.ok || ttl != test.ttl {
+			t.Errorf("NegativeCache.TTL(%v, %v) expected %v %v, actual %v %v", test.code, test.bytes, test.ttl, test.ok, ttl, ok)
+		}
+	}
+
+	if _, ok := (*NegativeCache)(nil).TTL(404, 0); ok {
+		t.Errorf("nil NegativeCache.TTL expected not ok, actual ok")
+	}
+}
+
+func TestNegativeCacheJSONInvalid(t *testing.T) {
+	for _, key := range []string{"abc", "600", "99", "6xx", "0xx", "x"} {
+		if _, err := (NegativeCacheJSON{TTLsMS: map[string]int{key: 1000}}).ToNegativeCache(); err == nil {
+			t.Errorf("ToNegativeCache with key '%v' expected error, actual nil", key)
+		}
+	}
+	if _, err := (NegativeCacheJSON{TTLsMS: map[string]int{"404": -1}}).ToNegativeCache(); err == nil {
+		t.Errorf("ToNegativeCache with negative TTL expected error, actual nil")
+	}
+}
@@ -22,10 +22,12 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/apache/trafficcontrol/grove/chash"
 	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/parenthealth"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
 )
@@ -109,8 +111,12 @@ type RemapRule struct {
 	Deny            []*net.IPNet
 	RetryCodes      map[int]struct{}
 	ConsistentHash  chash.ATSConsistentHash
-	Cache           icache.Cache
-	Plugins         map[string]interface{}
+	// RoundRobin is the index of the next parent for round-robin parent selection. It must be accessed atomically, and is a pointer so it's shared by copies of the rule.
+	RoundRobin *uint64
+	Cache      icache.Cache
+	Plugins    map[string]interface{}
+	// NegativeCache is the rule's negative caching config. If nil, responses are only cached per their HTTP cache headers.
+	NegativeCache *NegativeCache
 }
 
 func (r *RemapRule) Allowed(ip net.IP) bool {
@@ -133,41 +139,43 @@ func (r *RemapRule) Allowed(ip net.IP) bool {
 	return false
 }
 
-// URI takes a request URI and maps it to the real URI to proxy-and-cache. The `failures` parameter indicates how many parents have tried and failed, indicating to skip to the nth hashed parent. Returns the URI to request, and the proxy URL (if any)
-func (r RemapRule) URI(fromURI string, path string, query string, failures int) (string, *url.URL, *http.Transport) {
+// URI takes a request URI and maps it to the real URI to proxy-and-cache. The `failures` parameter indicates how many parents have tried and failed, indicating to skip to the nth available parent. Parents marked down by their health are skipped. Returns the URI to request, the proxy URL (if any), the transport, and the health of the selected parent (which may be nil).
+func (r RemapRule) URI(fromURI string, path string, query string, failures int) (string, *url.URL, *http.Transport, *parenthealth.Parent) {
 	fromHash := path
 	if r.QueryString.Remap && query != "" {
 		fromHash += "?" + query
 	}
 
 	// fmt.Println("RemapRule.URI fromURI " + fromHash)
-	to, proxyURI, transport := r.uriGetTo(fromHash, failures)
+	to, proxyURI, transport, health := r.uriGetTo(fromHash, failures)
 	uri := to + fromURI[len(r.From):]
 	if !r.QueryString.Remap {
 		if i := strings.Index(uri, "?"); i != -1 {
 			uri = uri[:i]
 		}
 	}
-	return uri, proxyURI, transport
+	return uri, proxyURI, transport, health
 }
 
 // uriGetTo is a helper func for URI. It returns the To URL, based on the Parent Selection type. In the event of failure, it logs the error and returns the first parent. Also returns the URL's Proxy URI (if any).
-func (r RemapRule) uriGetTo(fromURI string, failures int) (string, *url.URL, *http.Transport) {
+func (r RemapRule) uriGetTo(fromURI string, failures int) (string, *url.URL, *http.Transport, *parenthealth.Parent) {
 	switch *r.ParentSelection {
 	case ParentSelectionTypeConsistentHash:
 		return r.uriGetToConsistentHash(fromURI, failures)
+	case ParentSelectionTypeRoundRobin:
+		return r.uriGetToRoundRobin(failures)
 	default:
 		log.Errorf("RemapRule.URI: Rule '%v': Unknown Parent Selection type %v - using first URI in rule\n", r.Name, r.ParentSelection)
-		return r.To[0].URL, r.To[0].ProxyURL, r.To[0].Transport
+		return r.To[0].URL, r.To[0].ProxyURL, r.To[0].Transport, r.To[0].Health
 	}
 }
 
-// uriGetToConsistentHash is a helper func for URI, uriGetTo. It returns the To URL using Consistent Hashing. In the event of failure, it logs the error and returns the first parent. Also returns the Proxy URI (if any).
-func (r RemapRule) uriGetToConsistentHash(fromURI string, failures int) (string, *url.URL, *http.Transport) {
+// uriGetToConsistentHash is a helper func for URI, uriGetTo. It returns the To URL using Consistent Hashing, skipping parents which are down. In the event of failure, it logs the error and returns the first parent. Also returns the Proxy URI (if any).
+func (r RemapRule) uriGetToConsistentHash(fromURI string, failures int) (string, *url.URL, *http.Transport, *parenthealth.Parent) {
 	// fmt.Printf("DEBUGL uriGetToConsistentHash RemapRule %+v\n", r)
 	if r.ConsistentHash == nil {
 		log.Errorf("RemapRule.URI: Rule '%v': Parent Selection Type ConsistentHash, but rule.ConsistentHash is nil! Using first parent\n", r.Name)
-		return r.To[0].URL, r.To[0].ProxyURL, r.To[0].Transport
+		return r.To[0].URL, r.To[0].ProxyURL, r.To[0].Transport, r.To[0].Health
 	}
 
 	// fmt.Printf("DEBUGL uriGetToConsistentHash\n")
@@ -178,14 +186,75 @@ func (r RemapRule) uriGetToConsistentHash(fromURI string, failures int) (string,
 		// }
 		// fmt.Printf("DEBUGL uriGetToConsistentHash fromURI '%v' err %v returning '%v'\n", fromURI, err, r.To[0].URL)
 		log.Errorf("RemapRule.URI: Rule '%v': Error looking up Consistent Hash! Using first parent\n", r.Name)
-		return r.To[0].URL, r.To[0].ProxyURL, r.To[0].Transport
+		return r.To[0].URL, r.To[0].ProxyURL, r.To[0].Transport, r.To[0].Health
 	}
 
-	for i := 0; i < failures; i++ {
-		iter = iter.NextWrap()
+	// Walk the ring from the hashed position, visiting each distinct parent once, in ring order. The ring has many replicas per parent, so adjacent positions are frequently the same parent.
+	start := iter.Index()
+	seen := make(map[*chash.ATSConsistentHashNode]struct{}, len(r.To))
+	nodes := make([]*chash.ATSConsistentHashNode, 0, len(r.To))
+	for {
+		node := iter.Val()
+		if _, ok := seen[node]; !ok {
+			seen[node] = struct{}{}
+			nodes = append(nodes, node)
+			if len(nodes) == len(r.To) {
+				break
+			}
+		}
+		if iter = iter.NextWrap(); iter.Index() == start {
+			break
+		}
 	}
 
-	return iter.Val().Name, iter.Val().ProxyURL, iter.Val().Transport
+	node := selectAvailableNode(nodes, failures)
+	return node.Name, node.ProxyURL, node.Transport, node.Health
+}
+
+// selectAvailableNode returns the nth available node, skipping failed and down nodes. If every node is down, health is ignored, and the nth node is returned, wrapping, so requests are still attempted rather than failing outright.
+// Only the returned node's passive retry is consumed, so skipped down nodes keep theirs.
+func selectAvailableNode(nodes []*chash.ATSConsistentHashNode, n int) *chash.ATSConsistentHashNode {
+	available := 0
+	for _, node := range nodes {
+		if !node.Health.Selectable() {
+			continue
+		}
+		if available == n {
+			if !node.Health.Available() {
+				continue // another request took the retry
+			}
+			return node
+		}
+		available++
+	}
+	return nodes[n%len(nodes)]
+}
+
+// uriGetToRoundRobin is a helper func for URI, uriGetTo. It returns the next To URL in round-robin order, skipping parents which are down, without consuming the passive retries of skipped parents. Also returns the Proxy URI (if any).
+func (r RemapRule) uriGetToRoundRobin(failures int) (string, *url.URL, *http.Transport, *parenthealth.Parent) {
+	next := uint64(0)
+	if r.RoundRobin != nil {
+		next = atomic.AddUint64(r.RoundRobin, 1) - 1
+	} else {
+		log.Errorf("RemapRule.URI: Rule '%v': Parent Selection Type RoundRobin, but rule.RoundRobin is nil! Starting at first parent\n", r.Name)
+	}
+
+	available := 0
+	for i := 0; i < len(r.To); i++ {
+		to := r.To[(next+uint64(i))%uint64(len(r.To))]
+		if !to.Health.Selectable() {
+			continue
+		}
+		if available == failures {
+			if !to.Health.Available() {
+				continue // another request took the retry
+			}
+			return to.URL, to.ProxyURL, to.Transport, to.Health
+		}
+		available++
+	}
+	to := r.To[(next+uint64(failures))%uint64(len(r.To))]
+	return to.URL, to.ProxyURL, to.Transport, to.Health
 }
 
 func (r RemapRule) CacheKey(method string, fromURI string) string {
@@ -217,6 +286,8 @@ type RemapRuleTo struct {
 	Timeout    *time.Duration
 	RetryCodes map[int]struct{}
 	Transport  *http.Transport
+	// Health is the shared health of the parent, used to skip parents which are down.
+	Health *parenthealth.Parent
 }
 
 type QueryStringRule struct {
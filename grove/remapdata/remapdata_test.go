@@ -0,0 +1,116 @@
+package remapdata
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/chash"
+	"github.com/apache/trafficcontrol/grove/parenthealth"
+)
+
+func makeTestRule(selection ParentSelectionType, names []string) (RemapRule, map[string]*parenthealth.Parent) {
+	registry := parenthealth.NewRegistry()
+	healths := map[string]*parenthealth.Parent{}
+	rule := RemapRule{ParentSelection: &selection, RoundRobin: new(uint64)}
+	rule.From = "http://from.example"
+	h := chash.NewSimpleATSConsistentHash(chash.DefaultSimpleATSConsistentHashReplicas)
+	for _, name := range names {
+		health := registry.Get(name, name, nil, parenthealth.Config{MaxFailures: 1})
+		healths[name] = health
+		to := RemapRuleTo{Health: health}
+		to.URL = name
+		rule.To = append(rule.To, to)
+		h.Insert(&chash.ATSConsistentHashNode{Name: name, Health: health}, 1.0)
+	}
+	rule.ConsistentHash = h
+	return rule, healths
+}
+
+func TestURIConsistentHashSkipsDown(t *testing.T) {
+	names := []string{"http://a.example", "http://b.example", "http://c.example"}
+	rule, healths := makeTestRule(ParentSelectionTypeConsistentHash, names)
+
+	path := "/foo/bar"
+	first, _, _, _ := rule.URI(rule.From+path, path, "", 0)
+	second, _, _, _ := rule.URI(rule.From+path, path, "", 1)
+	if first == second {
+		t.Fatalf("RemapRule.URI with 1 failure expected a different parent than %v, actual the same", first)
+	}
+
+	firstParent := first[:len(first)-len(path)]
+	healths[firstParent].Failure()
+
+	uri, _, _, health := rule.URI(rule.From+path, path, "", 0)
+	if uri != second {
+		t.Errorf("RemapRule.URI with first parent down expected %v, actual %v", second, uri)
+	}
+	if health == healths[firstParent] {
+		t.Errorf("RemapRule.URI with first parent down expected a different parent health, actual the down parent")
+	}
+
+	for _, health := range healths {
+		health.Failure()
+	}
+	if uri, _, _, _ := rule.URI(rule.From+path, path, "", 0); uri != first {
+		t.Errorf("RemapRule.URI with all parents down expected hashed parent %v, actual %v", first, uri)
+	}
+}
+
+func TestURIRoundRobinSkipsDown(t *testing.T) {
+	names := []string{"http://a.example", "http://b.example", "http://c.example"}
+	rule, healths := makeTestRule(ParentSelectionTypeRoundRobin, names)
+
+	for i := 0; i < len(names)*2; i++ {
+		uri, _, _, _ := rule.URI(rule.From+"/", "/", "", 0)
+		if expected := names[i%len(names)] + "/"; uri != expected {
+			t.Errorf("RemapRule.URI round-robin request %v expected %v, actual %v", i, expected, uri)
+		}
+	}
+
+	healths["http://b.example"].Failure()
+	for i := 0; i < len(names)*2; i++ {
+		if uri, _, _, _ := rule.URI(rule.From+"/", "/", "", 0); uri == "http://b.example/" {
+			t.Errorf("RemapRule.URI round-robin expected down parent to be skipped, actual %v", uri)
+		}
+	}
+}
+
+func TestURIRoundRobinKeepsSkippedRetry(t *testing.T) {
+	registry := parenthealth.NewRegistry()
+	rule := RemapRule{RoundRobin: new(uint64)}
+	selection := ParentSelectionTypeRoundRobin
+	rule.ParentSelection = &selection
+	rule.From = "http://from.example"
+	healths := []*parenthealth.Parent{}
+	for _, name := range []string{"http://a.example", "http://b.example"} {
+		health := registry.Get(name, name, nil, parenthealth.Config{MaxFailures: 1, RetryWindow: time.Nanosecond})
+		healths = append(healths, health)
+		to := RemapRuleTo{Health: health}
+		to.URL = name
+		rule.To = append(rule.To, to)
+	}
+	healths[0].Failure()
+	time.Sleep(time.Millisecond)
+
+	// the first attempt failed, so the second parent is requested, and the down first parent is skipped
+	if uri, _, _, _ := rule.URI(rule.From+"/", "/", "", 1); uri != "http://b.example/" {
+		t.Fatalf("RemapRule.URI with 1 failure expected http://b.example/, actual %v", uri)
+	}
+	if !healths[0].Available() {
+		t.Errorf("RemapRule.URI expected the skipped down parent to keep its retry, actual retry consumed")
+	}
+}
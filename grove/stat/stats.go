@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/cachepolicy"
 	"github.com/apache/trafficcontrol/grove/icache"
 	"github.com/apache/trafficcontrol/grove/remapdata"
 	"github.com/apache/trafficcontrol/grove/web"
@@ -53,28 +54,33 @@ type Stats interface {
 	AddCacheHit()
 	CacheMisses() uint64
 	AddCacheMiss()
+	NegativeCacheHits() uint64
+	AddNegativeCacheHit()
 
 	CacheSize() uint64
 	CacheCapacity() uint64
 
-	// Write writes to the remapRuleStats of s, and returns the bytes written to the connection
-	Write(w http.ResponseWriter, conn *web.InterceptConn, reqFQDN string, remoteAddr string, code int, bytesWritten uint64, cacheHit bool) uint64
+	// Write writes to the remapRuleStats of s, and returns the bytes written to the connection. Negative cache hits are counted separately from other cache hits.
+	Write(w http.ResponseWriter, conn *web.InterceptConn, reqFQDN string, remoteAddr string, code int, bytesWritten uint64, cacheHit bool, negativeCacheHit bool) uint64
 
 	CacheKeys(string) []string
 	CacheSizeByName(string) (uint64, bool)
 	CacheCapacityByName(string) (uint64, bool)
 	CacheNames() []string
 	CachePeek(string, string) (*cacheobj.CacheObj, bool)
+	CachePolicyStatsByName(string) ([]cachepolicy.TierStats, bool)
 }
 
 func New(remapRules []remapdata.RemapRule, caches map[string]icache.Cache, cacheCapacityBytes uint64, httpConns *web.ConnMap, httpsConns *web.ConnMap, version string) Stats {
 	cacheHits := uint64(0)
 	cacheMisses := uint64(0)
+	negativeCacheHits := uint64(0)
 	return &stats{
 		system:             NewStatsSystem(version),
 		remap:              NewStatsRemaps(remapRules),
 		cacheHits:          &cacheHits,
 		cacheMisses:        &cacheMisses,
+		negativeCacheHits:  &negativeCacheHits,
 		caches:             caches,
 		cacheCapacityBytes: cacheCapacityBytes,
 		httpConns:          httpConns,
@@ -83,7 +89,7 @@ func New(remapRules []remapdata.RemapRule, caches map[string]icache.Cache, cache
 }
 
 // Write writes to the remapRuleStats of s, and returns the bytes written to the connection
-func (stats *stats) Write(w http.ResponseWriter, conn *web.InterceptConn, reqFQDN string, remoteAddr string, code int, bytesWritten uint64, cacheHit bool) uint64 {
+func (stats *stats) Write(w http.ResponseWriter, conn *web.InterceptConn, reqFQDN string, remoteAddr string, code int, bytesWritten uint64, cacheHit bool, negativeCacheHit bool) uint64 {
 	remapRuleStats, ok := stats.Remap().Stats(reqFQDN)
 	if !ok {
 		log.Errorf("Remap rule %v not in Stats\n", reqFQDN)
@@ -107,7 +113,10 @@ func (stats *stats) Write(w http.ResponseWriter, conn *web.InterceptConn, reqFQD
 	remapRuleStats.AddInBytes(uint64(bytesRead))
 	remapRuleStats.AddOutBytes(uint64(bytesWritten))
 
-	if cacheHit {
+	if negativeCacheHit {
+		stats.AddNegativeCacheHit()
+		remapRuleStats.AddNegativeCacheHit()
+	} else if cacheHit {
 		stats.AddCacheHit()
 		remapRuleStats.AddCacheHit()
 	} else {
@@ -138,6 +147,7 @@ type stats struct {
 	remap              StatsRemaps
 	cacheHits          *uint64
 	cacheMisses        *uint64
+	negativeCacheHits  *uint64
 	caches             map[string]icache.Cache
 	cacheCapacityBytes uint64
 	httpConns          *web.ConnMap
@@ -154,12 +164,14 @@ func (s stats) Connections() uint64 {
 	}
 	return l
 }
-func (s stats) CacheHits() uint64    { return atomic.LoadUint64(s.cacheHits) }
-func (s stats) AddCacheHit()         { atomic.AddUint64(s.cacheHits, 1) }
-func (s stats) CacheMisses() uint64  { return atomic.LoadUint64(s.cacheMisses) }
-func (s stats) AddCacheMiss()        { atomic.AddUint64(s.cacheMisses, 1) }
-func (s *stats) System() StatsSystem { return StatsSystem(s.system) }
-func (s *stats) Remap() StatsRemaps  { return s.remap }
+func (s stats) CacheHits() uint64         { return atomic.LoadUint64(s.cacheHits) }
+func (s stats) AddCacheHit()              { atomic.AddUint64(s.cacheHits, 1) }
+func (s stats) CacheMisses() uint64       { return atomic.LoadUint64(s.cacheMisses) }
+func (s stats) AddCacheMiss()             { atomic.AddUint64(s.cacheMisses, 1) }
+func (s stats) NegativeCacheHits() uint64 { return atomic.LoadUint64(s.negativeCacheHits) }
+func (s stats) AddNegativeCacheHit()      { atomic.AddUint64(s.negativeCacheHits, 1) }
+func (s *stats) System() StatsSystem      { return StatsSystem(s.system) }
+func (s *stats) Remap() StatsRemaps       { return s.remap }
 
 // CacheSizeByName returns the size of tha cache for a particular cache
 func (s stats) CacheSizeByName(cName string) (uint64, bool) {
@@ -206,6 +218,14 @@ func (s stats) CacheCapacityByName(cName string) (uint64, bool) {
 
 func (s stats) CacheCapacity() uint64 { return s.cacheCapacityBytes }
 
+// CachePolicyStatsByName returns the admission and eviction policy stats of each tier of a particular cache
+func (s stats) CachePolicyStatsByName(cName string) ([]cachepolicy.TierStats, bool) {
+	if cache, ok := s.caches[cName]; ok {
+		return cache.PolicyStats(), true
+	}
+	return nil, false
+}
+
 type StatsRemaps interface {
 	Stats(fqdn string) (StatsRemap, bool)
 	Rules() []string
@@ -229,6 +249,8 @@ type StatsRemap interface {
 	AddCacheHit()
 	CacheMisses() uint64
 	AddCacheMiss()
+	NegativeCacheHits() uint64
+	AddNegativeCacheHit()
 }
 
 func getFromFQDN(r remapdata.RemapRule) string {
@@ -273,14 +295,15 @@ func NewStatsRemap() StatsRemap {
 }
 
 type statsRemap struct {
-	inBytes     uint64
-	outBytes    uint64
-	status2xx   uint64
-	status3xx   uint64
-	status4xx   uint64
-	status5xx   uint64
-	cacheHits   uint64
-	cacheMisses uint64
+	inBytes           uint64
+	outBytes          uint64
+	status2xx         uint64
+	status3xx         uint64
+	status4xx         uint64
+	status5xx         uint64
+	cacheHits         uint64
+	cacheMisses       uint64
+	negativeCacheHits uint64
 }
 
 func (r *statsRemap) InBytes() uint64       { return atomic.LoadUint64(&r.inBytes) }
@@ -302,6 +325,9 @@ func (r *statsRemap) AddCacheHit()      { atomic.AddUint64(&r.cacheHits, 1) }
 func (r *statsRemap) CacheMisses() uint64 { return atomic.LoadUint64(&r.cacheMisses) }
 func (r *statsRemap) AddCacheMiss()       { atomic.AddUint64(&r.cacheMisses, 1) }
 
+func (r *statsRemap) NegativeCacheHits() uint64 { return atomic.LoadUint64(&r.negativeCacheHits) }
+func (r *statsRemap) AddNegativeCacheHit()      { atomic.AddUint64(&r.negativeCacheHits, 1) }
+
 func NewStatsSystem(version string) StatsSystem {
 	return &statsSystem{version: version}
 }
@@ -16,6 +16,7 @@ package tiercache
 
 import (
 	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/cachepolicy"
 	"github.com/apache/trafficcontrol/grove/icache"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
@@ -88,3 +89,8 @@ func (c *TierCache) Keys() []string {
 
 // Capacity returns the maximum size in bytes of the cache
 func (c *TierCache) Capacity() uint64 { return c.second.Capacity() }
+
+// PolicyStats returns the policy stats of the first cache's tiers, followed by the second's.
+func (c *TierCache) PolicyStats() []cachepolicy.TierStats {
+	return append(c.first.PolicyStats(), c.second.PolicyStats()...)
+}
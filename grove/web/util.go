@@ -116,6 +116,9 @@ func Request(transport *http.Transport, r *http.Request) (int, http.Header, []by
 	resp, err := transport.RoundTrip(rr)
 	respTime := time.Now()
 	if err != nil {
+		if IsTimeout(err) {
+			return 0, nil, nil, reqTime, respTime, TimeoutError{errors.New("request timed out: " + err.Error())}
+		}
 		return 0, nil, nil, reqTime, respTime, errors.New("request error: " + err.Error())
 	}
 	defer resp.Body.Close()
@@ -124,12 +127,27 @@ func Request(transport *http.Transport, r *http.Request) (int, http.Header, []by
 	// TODO determine if respTime should go here
 
 	if err != nil {
+		if IsTimeout(err) {
+			return 0, nil, nil, reqTime, respTime, TimeoutError{errors.New("reading response body timed out: " + err.Error())}
+		}
 		return 0, nil, nil, reqTime, respTime, errors.New("reading response body: " + err.Error())
 	}
 
 	return resp.StatusCode, resp.Header, body, reqTime, respTime, nil
 }
 
+// TimeoutError is returned by Request when the request to the parent timed out, as opposed to otherwise failing.
+type TimeoutError struct{ error }
+
+// IsTimeout returns whether the given error is a network timeout, or a TimeoutError returned by Request.
+func IsTimeout(err error) bool {
+	if _, ok := err.(TimeoutError); ok {
+		return true
+	}
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
 // Respond writes the given code, header, and body to the ResponseWriter. If connectionClose, a Connection: Close header is also written. Returns the bytes written, and any error.
 func Respond(w http.ResponseWriter, code int, header http.Header, body []byte, connectionClose bool) (uint64, error) {
 	// TODO move connectionClose to modhdr plugin
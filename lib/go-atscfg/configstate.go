@@ -0,0 +1,92 @@
+package atscfg
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// ConfigFileChecksum returns the checksum of the given config file text.
+//
+// Comment lines and blank lines are ignored, as is whitespace at the start and end of lines,
+// so the same config generated at different times, with different header comments, has the same checksum.
+// This allows a cache's applied config to be compared to the config generated now.
+func ConfigFileChecksum(text string, lineComment string) string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if lineComment != "" && strings.HasPrefix(line, lineComment) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// MakeServerProfileConfigFile makes the named config file, if it's generated solely from the server and the Parameters on its Profile.
+//
+// This allows the config files which only depend on a server's Profile to be generated without all the data needed for other config files,
+// for example to verify a cache's applied config.
+//
+// Returns false if the file isn't generated solely from the server and its Profile Parameters.
+func MakeServerProfileConfigFile(
+	fileName string,
+	server *Server,
+	serverParams []tc.Parameter,
+	hdrComment string,
+) (Cfg, bool, error) {
+	makeF := (func(*Server, []tc.Parameter, string) (Cfg, error))(nil)
+	switch fileName {
+	case "50-ats.rules":
+		makeF = MakeATSDotRules
+	case AstatsFileName:
+		makeF = MakeAStatsDotConfig
+	case LoggingFileName:
+		makeF = MakeLoggingDotConfig
+	case LoggingYAMLFileName:
+		makeF = MakeLoggingDotYAML
+	case LogsXMLFileName:
+		makeF = MakeLogsXMLDotConfig
+	case PluginFileName:
+		makeF = MakePluginDotConfig
+	case StorageFileName:
+		makeF = MakeStorageDotConfig
+	case SysctlFileName:
+		makeF = MakeSysCtlDotConf
+	case "volume.config":
+		makeF = MakeVolumeDotConfig
+	default:
+		return Cfg{}, false, nil
+	}
+	cfg, err := makeF(server, serverParams, hdrComment)
+	if err != nil {
+		return Cfg{}, true, err
+	}
+	cfg.Text = PreprocessConfigFile(server, cfg.Text)
+	return cfg, true, nil
+}
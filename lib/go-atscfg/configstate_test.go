@@ -0,0 +1,64 @@
+package atscfg
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigFileChecksum(t *testing.T) {
+	a := "# DO NOT EDIT - Generated for myserver on 2021-01-01\nfoo bar\n\n  baz  \n"
+	b := "# DO NOT EDIT - Generated for myserver on 2021-02-02\n# another comment\nfoo bar\nbaz"
+	if ConfigFileChecksum(a, LineCommentHash) != ConfigFileChecksum(b, LineCommentHash) {
+		t.Errorf("expected files differing only in comments and whitespace to have the same checksum")
+	}
+	if ConfigFileChecksum(a, LineCommentHash) == ConfigFileChecksum(a+"qux\n", LineCommentHash) {
+		t.Errorf("expected files with different lines to have different checksums")
+	}
+	if ConfigFileChecksum(a, "") == ConfigFileChecksum(b, "") {
+		t.Errorf("expected comments to be significant with no line comment")
+	}
+}
+
+func TestMakeServerProfileConfigFile(t *testing.T) {
+	profileName := "serverProfile"
+	server := makeGenericServer()
+	server.Profile = &profileName
+
+	params := makeParamsFromMap(profileName, PluginFileName, map[string]string{
+		"param0.so": "__HOSTNAME__",
+	})
+
+	cfg, ok, err := MakeServerProfileConfigFile(PluginFileName, server, params, "myHeaderComment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatalf("expected %v to be a server profile config file", PluginFileName)
+	}
+	if !strings.Contains(cfg.Text, "param0.so "+*server.HostName) {
+		t.Errorf("expected config to be preprocessed with the server hostname, actual: '%v'", cfg.Text)
+	}
+
+	if _, ok, err := MakeServerProfileConfigFile(RecordsFileName, server, params, "myHeaderComment"); ok || err != nil {
+		t.Errorf("expected %v not to be a server profile config file, actual ok %v err %v", RecordsFileName, ok, err)
+	}
+}
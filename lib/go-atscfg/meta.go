@@ -218,6 +218,11 @@ func addMetaObjConfigDir(
 			if err != nil {
 				return nil, warnings, errors.New("getting topology placement: " + err.Error())
 			}
+			if placement.InTopology && useStrategies(atsMajorVer) {
+				if configFilesM, err = ensureConfigFile(configFilesM, StrategiesYAMLFileName, configDir); err != nil {
+					warnings = append(warnings, "ensuring config file '"+StrategiesYAMLFileName+"': "+err.Error())
+				}
+			}
 			if placement.IsFirstCacheTier {
 				if (ds.FirstHeaderRewrite != nil && *ds.FirstHeaderRewrite != "") || ds.MaxOriginConnections != nil || ds.ServiceCategory != nil {
 					fileName := FirstHeaderRewriteConfigFileName(*ds.XMLID)
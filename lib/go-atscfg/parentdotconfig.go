@@ -265,6 +265,12 @@ func MakeParentDotConfig(
 	dsOrigins, dsOriginWarns := makeDSOrigins(dss, dses, servers)
 	warnings = append(warnings, dsOriginWarns...)
 
+	// strategy warnings are in strategies.yaml, so they aren't repeated here.
+	strategyDSNames, _, err := StrategyDSNames(dses, server, servers, topologies, tcServerParams, tcParentConfigParams, serverCapabilities, dsRequiredCapabilities, cacheGroupArr, dss)
+	if err != nil {
+		return Cfg{}, makeErr(warnings, "getting strategies: "+err.Error())
+	}
+
 	for _, ds := range dses {
 		if ds.XMLID == nil || *ds.XMLID == "" {
 			warnings = append(warnings, "got ds with missing XMLID, skipping!")
@@ -304,6 +310,9 @@ func MakeParentDotConfig(
 
 		// TODO put these in separate functions. No if-statement should be this long.
 		if ds.Topology != nil && *ds.Topology != "" {
+			if _, ok := strategyDSNames[*ds.XMLID]; ok {
+				continue // ATS 9+ Topology parentage is generated in strategies.yaml, and referenced by remap.config @strategy directives.
+			}
 			txt, topoWarnings, err := getTopologyParentConfigLine(
 				server,
 				servers,
@@ -957,18 +966,24 @@ func serverParentStr(sv *Server, svParams profileCache) (string, error) {
 	if svParams.NotAParent {
 		return "", nil
 	}
-	host := ""
+	host, err := serverParentHost(sv, svParams)
+	if err != nil {
+		return "", err
+	}
+	return host + ":" + strconv.Itoa(svParams.Port) + "|" + svParams.Weight, nil
+}
+
+// serverParentHost returns the host children should use to request the given parent server: its IP if its Profile Parameters say to use it, otherwise its FQDN.
+func serverParentHost(sv *Server, svParams profileCache) (string, error) {
 	if svParams.UseIP {
 		// TODO get service interface here
 		ip := getServerIPAddress(sv)
 		if ip == nil {
 			return "", errors.New("server params Use IP, but has no valid IPv4 Service Address")
 		}
-		host = ip.String()
-	} else {
-		host = *sv.HostName + "." + *sv.DomainName
+		return ip.String(), nil
 	}
-	return host + ":" + strconv.Itoa(svParams.Port) + "|" + svParams.Weight, nil
+	return *sv.HostName + "." + *sv.DomainName, nil
 }
 
 // GetTopologyParents returns the parents, secondary parents, any warnings, and any error.
@@ -995,6 +1010,48 @@ func getTopologyParents(
 		return []string{orgURI.Host}, nil, warnings, nil
 	}
 
+	parents, secondaryParents, parentWarns, err := getTopologyParentServers(server, ds, servers, parentConfigParams, topology, serverCapabilities, dsRequiredCapabilities, dsOrigins)
+	warnings = append(warnings, parentWarns...)
+	if err != nil {
+		return nil, nil, warnings, err
+	}
+
+	parentStrs := []string{}
+	secondaryParentStrs := []string{}
+	for _, sv := range parents {
+		parentStr, err := serverParentStr(&sv.Server, sv.Params)
+		if err != nil {
+			return nil, nil, warnings, errors.New("getting server parent string: " + err.Error())
+		}
+		if parentStr != "" { // will be empty if server is not_a_parent (possibly other reasons)
+			parentStrs = append(parentStrs, parentStr)
+		}
+	}
+	for _, sv := range secondaryParents {
+		parentStr, err := serverParentStr(&sv.Server, sv.Params)
+		if err != nil {
+			return nil, nil, warnings, errors.New("getting server parent string: " + err.Error())
+		}
+		secondaryParentStrs = append(secondaryParentStrs, parentStr)
+	}
+
+	return parentStrs, secondaryParentStrs, warnings, nil
+}
+
+// getTopologyParentServers returns the servers in the primary and secondary parent cachegroups of the server's node in the topology, sorted by rank, any warnings, and any error.
+// Servers which are not_a_parent are included; callers must omit them.
+// This must not be called for the last tier, whose parent is the origin.
+func getTopologyParentServers(
+	server *Server,
+	ds *DeliveryService,
+	servers []Server,
+	parentConfigParams []parameterWithProfilesMap, // all params with configFile parent.config
+	topology tc.Topology,
+	serverCapabilities map[int]map[ServerCapability]struct{},
+	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	dsOrigins map[ServerID]struct{}, // for Topology DSes, MSO still needs DeliveryServiceServer assignments.
+) ([]serverWithParams, []serverWithParams, []string, error) {
+	warnings := []string{}
 	svNode := tc.TopologyNode{}
 	for _, node := range topology.Nodes {
 		if node.Cachegroup == *server.Cachegroup {
@@ -1029,9 +1086,6 @@ func getTopologyParents(
 		return nil, nil, warnings, errors.New("Server '" + *server.HostName + "' DS " + *ds.XMLID + " topology '" + *ds.Topology + "' cachegroup '" + *server.Cachegroup + "' topology node parent " + strconv.Itoa(svNode.Parents[0]) + " is not in the topology!")
 	}
 
-	parentStrs := []string{}
-	secondaryParentStrs := []string{}
-
 	serversWithParams := []serverWithParams{}
 	for _, sv := range servers {
 		serverParentParams, parentWarns := serverParentageParams(&sv, parentConfigParams)
@@ -1043,6 +1097,8 @@ func getTopologyParents(
 	}
 	sort.Sort(serversWithParamsSortByRank(serversWithParams))
 
+	parents := []serverWithParams{}
+	secondaryParents := []serverWithParams{}
 	for _, sv := range serversWithParams {
 		if sv.ID == nil {
 			warnings = append(warnings, "TO Servers server had nil ID, skipping")
@@ -1075,24 +1131,14 @@ func getTopologyParents(
 			continue
 		}
 		if *sv.Cachegroup == parentCG {
-			parentStr, err := serverParentStr(&sv.Server, sv.Params)
-			if err != nil {
-				return nil, nil, warnings, errors.New("getting server parent string: " + err.Error())
-			}
-			if parentStr != "" { // will be empty if server is not_a_parent (possibly other reasons)
-				parentStrs = append(parentStrs, parentStr)
-			}
+			parents = append(parents, sv)
 		}
 		if *sv.Cachegroup == secondaryParentCG {
-			parentStr, err := serverParentStr(&sv.Server, sv.Params)
-			if err != nil {
-				return nil, nil, warnings, errors.New("getting server parent string: " + err.Error())
-			}
-			secondaryParentStrs = append(secondaryParentStrs, parentStr)
+			secondaryParents = append(secondaryParents, sv)
 		}
 	}
 
-	return parentStrs, secondaryParentStrs, warnings, nil
+	return parents, secondaryParents, warnings, nil
 }
 
 // getOriginURI returns the URL, any warnings, and any error.
@@ -49,6 +49,7 @@ func MakeRemapDotConfig(
 	cacheGroupArr []tc.CacheGroupNullable,
 	serverCapabilities map[int]map[ServerCapability]struct{},
 	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	strategyDSNames map[string]struct{}, // the Delivery Services with a strategy in strategies.yaml, from StrategyDSNames
 	hdrComment string,
 ) (Cfg, error) {
 	warnings := []string{}
@@ -91,9 +92,9 @@ func MakeRemapDotConfig(
 	txt := ""
 	typeWarns := []string{}
 	if tc.CacheTypeFromString(server.Type) == tc.CacheTypeMid {
-		txt, typeWarns, err = getServerConfigRemapDotConfigForMid(atsMajorVersion, dsProfilesCacheKeyConfigParams, dses, dsRegexes, hdr, server, nameTopologies, cacheGroups, serverCapabilities, dsRequiredCapabilities)
+		txt, typeWarns, err = getServerConfigRemapDotConfigForMid(atsMajorVersion, dsProfilesCacheKeyConfigParams, dses, dsRegexes, hdr, server, nameTopologies, cacheGroups, serverCapabilities, dsRequiredCapabilities, strategyDSNames)
 	} else {
-		txt, typeWarns, err = getServerConfigRemapDotConfigForEdge(cacheURLConfigParams, dsProfilesCacheKeyConfigParams, serverPackageParamData, dses, dsRegexes, atsMajorVersion, hdr, server, nameTopologies, cacheGroups, serverCapabilities, dsRequiredCapabilities, cdnDomain)
+		txt, typeWarns, err = getServerConfigRemapDotConfigForEdge(cacheURLConfigParams, dsProfilesCacheKeyConfigParams, serverPackageParamData, dses, dsRegexes, atsMajorVersion, hdr, server, nameTopologies, cacheGroups, serverCapabilities, dsRequiredCapabilities, strategyDSNames, cdnDomain)
 	}
 	warnings = append(warnings, typeWarns...)
 	if err != nil {
@@ -120,6 +121,7 @@ func getServerConfigRemapDotConfigForMid(
 	cacheGroups map[tc.CacheGroupName]tc.CacheGroupNullable,
 	serverCapabilities map[int]map[ServerCapability]struct{},
 	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	strategyDSNames map[string]struct{},
 ) (string, []string, error) {
 	warnings := []string{}
 	midRemaps := map[string]string{}
@@ -156,7 +158,7 @@ func getServerConfigRemapDotConfigForMid(
 		// So for now, keep track of it, so we can log an error when it happens.
 		hasCacheKey := false
 
-		midRemap := ""
+		midRemap := makeStrategyRemapTxt(ds, atsMajorVersion, strategyDSNames)
 
 		if *ds.Topology != "" {
 			topoTxt, err := makeDSTopologyHeaderRewriteTxt(ds, tc.CacheGroupName(*server.Cachegroup), topology, cacheGroups)
@@ -227,6 +229,7 @@ func getServerConfigRemapDotConfigForEdge(
 	cacheGroups map[tc.CacheGroupName]tc.CacheGroupNullable,
 	serverCapabilities map[int]map[ServerCapability]struct{},
 	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	strategyDSNames map[string]struct{},
 	cdnDomain string,
 ) (string, []string, error) {
 	warnings := []string{}
@@ -271,7 +274,7 @@ func getServerConfigRemapDotConfigForEdge(
 					profilecacheKeyConfigParams = profilesCacheKeyConfigParams[*ds.ProfileID]
 				}
 				remapWarns := []string{}
-				remapText, remapWarns, err = buildEdgeRemapLine(cacheURLConfigParams, atsMajorVersion, server, serverPackageParamData, remapText, ds, dsRegex, line.From, line.To, profilecacheKeyConfigParams, cacheGroups, nameTopologies)
+				remapText, remapWarns, err = buildEdgeRemapLine(cacheURLConfigParams, atsMajorVersion, server, serverPackageParamData, remapText, ds, dsRegex, line.From, line.To, profilecacheKeyConfigParams, cacheGroups, nameTopologies, strategyDSNames)
 				warnings = append(warnings, remapWarns...)
 				if err != nil {
 					return "", warnings, err
@@ -307,15 +310,17 @@ func buildEdgeRemapLine(
 	cacheKeyConfigParams map[string]string,
 	cacheGroups map[tc.CacheGroupName]tc.CacheGroupNullable,
 	nameTopologies map[TopologyName]tc.Topology,
+	strategyDSNames map[string]struct{},
 ) (string, []string, error) {
 	warnings := []string{}
 	// ds = 'remap' in perl
 	mapFrom = strings.Replace(mapFrom, `__http__`, *server.HostName, -1)
 
+	strategyTxt := makeStrategyRemapTxt(ds, atsMajorVersion, strategyDSNames)
 	if _, hasDSCPRemap := pData["dscp_remap"]; hasDSCPRemap {
-		text += "map	" + mapFrom + "     " + mapTo + ` @plugin=dscp_remap.so @pparam=` + strconv.Itoa(*ds.DSCP)
+		text += "map	" + mapFrom + "     " + mapTo + strategyTxt + ` @plugin=dscp_remap.so @pparam=` + strconv.Itoa(*ds.DSCP)
 	} else {
-		text += "map	" + mapFrom + "     " + mapTo + ` @plugin=header_rewrite.so @pparam=dscp/set_dscp_` + strconv.Itoa(*ds.DSCP) + ".config"
+		text += "map	" + mapFrom + "     " + mapTo + strategyTxt + ` @plugin=header_rewrite.so @pparam=dscp/set_dscp_` + strconv.Itoa(*ds.DSCP) + ".config"
 	}
 
 	if *ds.Topology != "" {
@@ -642,13 +647,23 @@ func remapFilterDSes(server *Server, dss []tc.DeliveryServiceServer, dses []Deli
 // makeDSProfilesCacheKeyConfigParams returns a map[ProfileID][ParamName]ParamValue for the cache key params for each profile.
 // Returns the params, any warnings, and any error.
 func makeDSProfilesCacheKeyConfigParams(server *Server, dses []DeliveryService, cacheKeyParams []tc.Parameter) (map[int]map[string]string, []string, error) {
+	params, warnings, err := makeDSProfilesConfigParams(dses, cacheKeyParams)
+	if err != nil {
+		return nil, warnings, errors.New("cache key: " + err.Error())
+	}
+	return params, warnings, nil
+}
+
+// makeDSProfilesConfigParams returns a map[ProfileID][ParamName]ParamValue of the given params, for each Delivery Service profile they're assigned to.
+// Returns the params, any warnings, and any error.
+func makeDSProfilesConfigParams(dses []DeliveryService, params []tc.Parameter) (map[int]map[string]string, []string, error) {
 	warnings := []string{}
-	cacheKeyParamsWithProfiles, err := tcParamsToParamsWithProfiles(cacheKeyParams)
+	paramsWithProfiles, err := tcParamsToParamsWithProfiles(params)
 	if err != nil {
-		return nil, warnings, errors.New("decoding cache key parameter profiles: " + err.Error())
+		return nil, warnings, errors.New("decoding parameter profiles: " + err.Error())
 	}
 
-	cacheKeyParamsWithProfilesMap := parameterWithProfilesToMap(cacheKeyParamsWithProfiles)
+	paramsWithProfilesMap := parameterWithProfilesToMap(paramsWithProfiles)
 
 	dsProfileNamesToIDs := map[string]int{}
 	for _, ds := range dses {
@@ -658,14 +673,14 @@ func makeDSProfilesCacheKeyConfigParams(server *Server, dses []DeliveryService,
 		dsProfileNamesToIDs[*ds.ProfileName] = *ds.ProfileID
 	}
 
-	dsProfilesCacheKeyConfigParams := map[int]map[string]string{}
-	for _, param := range cacheKeyParamsWithProfilesMap {
+	dsProfilesConfigParams := map[int]map[string]string{}
+	for _, param := range paramsWithProfilesMap {
 		for dsProfileName, dsProfileID := range dsProfileNamesToIDs {
 			if _, ok := param.ProfileNames[dsProfileName]; ok {
-				if _, ok := dsProfilesCacheKeyConfigParams[dsProfileID]; !ok {
-					dsProfilesCacheKeyConfigParams[dsProfileID] = map[string]string{}
+				if _, ok := dsProfilesConfigParams[dsProfileID]; !ok {
+					dsProfilesConfigParams[dsProfileID] = map[string]string{}
 				}
-				if val, ok := dsProfilesCacheKeyConfigParams[dsProfileID][param.Name]; ok {
+				if val, ok := dsProfilesConfigParams[dsProfileID][param.Name]; ok {
 					if val < param.Value {
 						warnings = append(warnings, "got multiple parameters for name '"+param.Name+"' - ignoring '"+param.Value+"'")
 						continue
@@ -673,11 +688,11 @@ func makeDSProfilesCacheKeyConfigParams(server *Server, dses []DeliveryService,
 						warnings = append(warnings, "got multiple parameters for name '"+param.Name+"' - ignoring '"+val+"'")
 					}
 				}
-				dsProfilesCacheKeyConfigParams[dsProfileID][param.Name] = param.Value
+				dsProfilesConfigParams[dsProfileID][param.Name] = param.Value
 			}
 		}
 	}
-	return dsProfilesCacheKeyConfigParams, warnings, nil
+	return dsProfilesConfigParams, warnings, nil
 }
 
 type deliveryServiceRegexesSortByTypeThenSetNum []tc.DeliveryServiceRegex
@@ -0,0 +1,384 @@
+package atscfg
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+const SNIYAMLFileName = "sni.yaml"
+const ContentTypeSNIDotYAML = ContentTypeIPAllowDotYAML
+const LineCommentSNIDotYAML = LineCommentHash
+
+// SNIParameterConfigFile is the Parameter ConfigFile of Delivery Service Profile Parameters which set the Delivery Service's TLS policy in sni.yaml.
+const SNIParameterConfigFile = SNIYAMLFileName
+
+// The Parameter Names of Delivery Service Profile Parameters with the ConfigFile SNIParameterConfigFile.
+const (
+	SNIParamHTTP2               = "http2"
+	SNIParamVerifyClient        = "verify_client"
+	SNIParamVerifyClientCACerts = "verify_client_ca_certs"
+	SNIParamValidTLSVersionsIn  = "valid_tls_versions_in"
+	SNIParamMinTLSVersion       = "minimum_tls_version"
+	SNIParamTunnelRoute         = "tunnel_route"
+)
+
+// SNIValidTLSVersionsInMinATSMajorVersion is the first ATS major version which accepts valid_tls_versions_in in sni.yaml. Older versions reject the whole file.
+const SNIValidTLSVersionsInMinATSMajorVersion = 9
+
+// sniTLSVersions is every TLS version sni.yaml can enable, in order from oldest to newest.
+var sniTLSVersions = []string{"TLSv1", "TLSv1_1", "TLSv1_2", "TLSv1_3"}
+
+// sniVerifyClientValues is the set of valid verify_client values.
+var sniVerifyClientValues = map[string]struct{}{"NONE": {}, "MODERATE": {}, "STRICT": {}}
+
+// sniPolicy is the TLS policy of a single sni.yaml fqdn entry. Empty fields are omitted.
+type sniPolicy struct {
+	HTTP2               string
+	VerifyClient        string
+	VerifyClientCACerts string
+	ValidTLSVersionsIn  []string
+	TunnelRoute         string
+}
+
+type sniEntry struct {
+	FQDN   string
+	DSName string
+	Policy sniPolicy
+}
+
+// MakeSNIDotYAML returns the sni.yaml for the given server.
+// The file contains an entry for every fqdn of every HTTPS Delivery Service assigned to the server, with the TLS policy of the Parameters with the ConfigFile SNIParameterConfigFile on the Delivery Service's Profile.
+func MakeSNIDotYAML(
+	server *Server,
+	unfilteredDSes []DeliveryService,
+	dss []tc.DeliveryServiceServer,
+	dsRegexArr []tc.DeliveryServiceRegexes,
+	sniParams []tc.Parameter,
+	serverParams []tc.Parameter,
+	cdn *tc.CDN,
+	topologies []tc.Topology,
+	serverCapabilities map[int]map[ServerCapability]struct{},
+	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	hdrComment string,
+) (Cfg, error) {
+	warnings := []string{}
+	if server.HostName == nil {
+		return Cfg{}, makeErr(warnings, "server HostName missing")
+	} else if server.ID == nil {
+		return Cfg{}, makeErr(warnings, "server ID missing")
+	} else if server.Cachegroup == nil {
+		return Cfg{}, makeErr(warnings, "server Cachegroup missing")
+	} else if cdn == nil || cdn.DomainName == "" {
+		return Cfg{}, makeErr(warnings, "server CDN domain missing")
+	}
+
+	dsRegexes := makeDSRegexMap(dsRegexArr)
+	// Returned DSes are guaranteed to have a non-nil XMLID, Type, DSCP, ID, Active, and Topology.
+	dses, dsWarns := remapFilterDSes(server, dss, unfilteredDSes, nil)
+	warnings = append(warnings, dsWarns...)
+
+	dsProfilesSNIParams, paramWarns, err := makeDSProfilesConfigParams(dses, sniParams)
+	warnings = append(warnings, paramWarns...)
+	if err != nil {
+		warnings = append(warnings, "making Delivery Service sni.yaml Params, TLS policies will be missing! : "+err.Error())
+	}
+
+	atsMajorVer, verWarns := getATSMajorVersion(serverParams)
+	warnings = append(warnings, verWarns...)
+
+	nameTopologies := makeTopologyNameMap(topologies)
+
+	entries := []sniEntry{}
+	for _, ds := range dses {
+		if !sniDSUsesTLS(ds) {
+			continue
+		}
+		if !hasRequiredCapabilities(serverCapabilities[*server.ID], dsRequiredCapabilities[*ds.ID]) {
+			continue
+		}
+		if *ds.Topology != "" {
+			topology, ok := nameTopologies[TopologyName(*ds.Topology)]
+			if !ok {
+				warnings = append(warnings, "DS '"+*ds.XMLID+"' topology '"+*ds.Topology+"' not found, skipping!")
+				continue
+			}
+			topoIncludesServer, err := topologyIncludesServerNullable(topology, server)
+			if err != nil {
+				return Cfg{}, makeErr(warnings, "getting topology server inclusion: "+err.Error())
+			}
+			if !topoIncludesServer {
+				continue
+			}
+		}
+
+		policy := sniPolicy{}
+		if ds.ProfileID != nil {
+			policyWarns := []string{}
+			policy, policyWarns = makeSNIPolicy(dsProfilesSNIParams[*ds.ProfileID])
+			for _, warn := range policyWarns {
+				warnings = append(warnings, "DS '"+*ds.XMLID+"' "+warn)
+			}
+			if len(policy.ValidTLSVersionsIn) > 0 && atsMajorVer < SNIValidTLSVersionsInMinATSMajorVersion {
+				warnings = append(warnings, "DS '"+*ds.XMLID+"' has TLS version parameters, but server ATS version "+strconv.Itoa(atsMajorVer)+" doesn't support "+SNIParamValidTLSVersionsIn+", which requires ATS "+strconv.Itoa(SNIValidTLSVersionsInMinATSMajorVersion)+", ignoring!")
+				policy.ValidTLSVersionsIn = nil
+			}
+		}
+
+		for _, dsRegex := range dsRegexes[tc.DeliveryServiceName(*ds.XMLID)] {
+			fqdn, err := getSNIFQDN(ds, dsRegex, cdn.DomainName)
+			if err != nil {
+				warnings = append(warnings, "DS '"+*ds.XMLID+"' regex '"+dsRegex.Pattern+"' - skipping! : "+err.Error())
+				continue
+			}
+			if fqdn == "" {
+				continue
+			}
+			entries = append(entries, sniEntry{FQDN: fqdn, DSName: *ds.XMLID, Policy: policy})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].FQDN != entries[j].FQDN {
+			return entries[i].FQDN < entries[j].FQDN
+		}
+		return entries[i].DSName < entries[j].DSName
+	})
+
+	txt := makeHdrComment(hdrComment)
+	if len(entries) == 0 {
+		txt += "sni: []\n"
+	} else {
+		txt += "sni:\n"
+	}
+	prevEntry := sniEntry{}
+	for _, entry := range entries {
+		if entry.FQDN == prevEntry.FQDN {
+			if entry.DSName != prevEntry.DSName {
+				warnings = append(warnings, "fqdn '"+entry.FQDN+"' is used by Delivery Services '"+prevEntry.DSName+"' and '"+entry.DSName+"', ignoring '"+entry.DSName+"'")
+			}
+			continue
+		}
+		prevEntry = entry
+		txt += makeSNIEntryText(entry)
+	}
+
+	return Cfg{
+		Text:        txt,
+		ContentType: ContentTypeSNIDotYAML,
+		LineComment: LineCommentSNIDotYAML,
+		Warnings:    warnings,
+	}, nil
+}
+
+// sniDSUsesTLS returns whether the given DS serves HTTPS, and should therefore be in sni.yaml.
+func sniDSUsesTLS(ds DeliveryService) bool {
+	if *ds.Type == tc.DSTypeAnyMap || ds.Type.IsSteering() {
+		return false
+	}
+	if ds.Protocol == nil {
+		return false
+	}
+	return *ds.Protocol == tc.DSProtocolHTTPS || *ds.Protocol == tc.DSProtocolHTTPToHTTPS || *ds.Protocol == tc.DSProtocolHTTPAndHTTPS
+}
+
+// getSNIFQDN returns the sni.yaml fqdn of the given Delivery Service regex.
+// Host regexes of the usual form `.*\.foo\..*` become the DNS routing name or, for HTTP Delivery Services, a wildcard, followed by the regex and the CDN domain.
+// Other host regexes must be literal host names.
+// Returns an empty string if the regex is not a host regex.
+func getSNIFQDN(ds DeliveryService, dsRegex tc.DeliveryServiceRegex, cdnDomain string) (string, error) {
+	if tc.DSMatchType(dsRegex.Type) != tc.DSMatchTypeHostRegex {
+		return "", nil
+	}
+	if dsRegex.Pattern == "" {
+		return "", errors.New("missing regex pattern")
+	}
+
+	if strings.HasSuffix(dsRegex.Pattern, `.*`) {
+		re := dsRegex.Pattern
+		re = strings.Replace(re, `\`, ``, -1)
+		re = strings.Replace(re, `.*`, ``, -1)
+
+		hName := "*"
+		if ds.Type.IsDNS() {
+			if ds.RoutingName == nil {
+				return "", errors.New("ds is dns, but missing routing name")
+			}
+			hName = *ds.RoutingName
+		}
+		return strings.ToLower(hName + re + cdnDomain), nil
+	}
+
+	host := strings.Replace(dsRegex.Pattern, `\.`, `.`, -1)
+	if strings.ContainsAny(host, `\^$*+?()[]{}|`) {
+		return "", errors.New("host regex is not a literal host name")
+	}
+	return strings.ToLower(host), nil
+}
+
+// makeSNIPolicy returns the sni.yaml policy of the given Delivery Service Profile Parameters, and any warnings.
+// Invalid and unknown Parameters are warned about and omitted.
+func makeSNIPolicy(params map[string]string) (sniPolicy, []string) {
+	warnings := []string{}
+	policy := sniPolicy{}
+	for name, val := range params {
+		val = strings.TrimSpace(val)
+		switch name {
+		case SNIParamHTTP2:
+			val = strings.ToLower(val)
+			if val != "on" && val != "off" {
+				warnings = append(warnings, "parameter '"+name+"' value '"+val+"' must be 'on' or 'off', ignoring!")
+				continue
+			}
+			policy.HTTP2 = val
+		case SNIParamVerifyClient:
+			val = strings.ToUpper(val)
+			if _, ok := sniVerifyClientValues[val]; !ok {
+				warnings = append(warnings, "parameter '"+name+"' value '"+val+"' must be 'NONE', 'MODERATE', or 'STRICT', ignoring!")
+				continue
+			}
+			policy.VerifyClient = val
+		case SNIParamVerifyClientCACerts:
+			policy.VerifyClientCACerts = val
+		case SNIParamValidTLSVersionsIn:
+			versions, err := parseSNITLSVersions(val)
+			if err != nil {
+				warnings = append(warnings, "parameter '"+name+"' value '"+val+"' invalid, ignoring! : "+err.Error())
+				continue
+			}
+			policy.ValidTLSVersionsIn = versions
+		case SNIParamMinTLSVersion:
+			// handled below, because an explicit valid_tls_versions_in takes precedence
+		case SNIParamTunnelRoute:
+			if _, port, err := net.SplitHostPort(val); err != nil {
+				warnings = append(warnings, "parameter '"+name+"' value '"+val+"' must be host:port, ignoring! : "+err.Error())
+				continue
+			} else if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+				warnings = append(warnings, "parameter '"+name+"' value '"+val+"' port is not a number, ignoring!")
+				continue
+			}
+			policy.TunnelRoute = val
+		default:
+			warnings = append(warnings, "unknown parameter '"+name+"', ignoring!")
+		}
+	}
+
+	if minVersion, ok := params[SNIParamMinTLSVersion]; ok {
+		versions, err := getSNITLSVersionsFrom(strings.TrimSpace(minVersion))
+		if err != nil {
+			warnings = append(warnings, "parameter '"+SNIParamMinTLSVersion+"' value '"+minVersion+"' invalid, ignoring! : "+err.Error())
+		} else if len(policy.ValidTLSVersionsIn) > 0 {
+			warnings = append(warnings, "has both '"+SNIParamMinTLSVersion+"' and '"+SNIParamValidTLSVersionsIn+"' parameters, ignoring '"+SNIParamMinTLSVersion+"'")
+		} else {
+			policy.ValidTLSVersionsIn = versions
+		}
+	}
+	return policy, warnings
+}
+
+// normalizeSNITLSVersion returns the sni.yaml name of the given TLS version, which may be a sni.yaml name such as 'TLSv1_2' or a number such as '1.2'.
+func normalizeSNITLSVersion(version string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(version)) {
+	case "tlsv1", "tlsv1_0", "1.0", "1":
+		return "TLSv1", nil
+	case "tlsv1_1", "1.1":
+		return "TLSv1_1", nil
+	case "tlsv1_2", "1.2":
+		return "TLSv1_2", nil
+	case "tlsv1_3", "1.3":
+		return "TLSv1_3", nil
+	}
+	return "", errors.New("unknown TLS version '" + version + "'")
+}
+
+// parseSNITLSVersions parses a comma-delimited list of TLS versions, and returns their sni.yaml names in order from oldest to newest.
+func parseSNITLSVersions(val string) ([]string, error) {
+	versionSet := map[string]struct{}{}
+	for _, version := range strings.Split(val, ",") {
+		if strings.TrimSpace(version) == "" {
+			continue
+		}
+		normalized, err := normalizeSNITLSVersion(version)
+		if err != nil {
+			return nil, err
+		}
+		versionSet[normalized] = struct{}{}
+	}
+	versions := []string{}
+	for _, version := range sniTLSVersions {
+		if _, ok := versionSet[version]; ok {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, errors.New("no TLS versions")
+	}
+	return versions, nil
+}
+
+// getSNITLSVersionsFrom returns the sni.yaml names of the given TLS version and every newer version.
+func getSNITLSVersionsFrom(minVersion string) ([]string, error) {
+	normalized, err := normalizeSNITLSVersion(minVersion)
+	if err != nil {
+		return nil, err
+	}
+	for i, version := range sniTLSVersions {
+		if version == normalized {
+			return append([]string{}, sniTLSVersions[i:]...), nil
+		}
+	}
+	return nil, errors.New("unknown TLS version '" + minVersion + "'") // should never happen
+}
+
+// makeSNIEntryText returns the sni.yaml text of the given entry.
+func makeSNIEntryText(entry sniEntry) string {
+	txt := "- fqdn: " + sniYAMLQuote(entry.FQDN) + "\n"
+	if entry.Policy.HTTP2 != "" {
+		txt += "  http2: " + entry.Policy.HTTP2 + "\n"
+	}
+	if entry.Policy.VerifyClient != "" {
+		txt += "  verify_client: " + entry.Policy.VerifyClient + "\n"
+	}
+	if entry.Policy.VerifyClientCACerts != "" {
+		txt += "  verify_client_ca_certs: " + sniYAMLQuote(entry.Policy.VerifyClientCACerts) + "\n"
+	}
+	if len(entry.Policy.ValidTLSVersionsIn) > 0 {
+		versions := make([]string, 0, len(entry.Policy.ValidTLSVersionsIn))
+		for _, version := range entry.Policy.ValidTLSVersionsIn {
+			versions = append(versions, sniYAMLQuote(version))
+		}
+		txt += "  valid_tls_versions_in: [" + strings.Join(versions, ", ") + "]\n"
+	}
+	if entry.Policy.TunnelRoute != "" {
+		txt += "  tunnel_route: " + sniYAMLQuote(entry.Policy.TunnelRoute) + "\n"
+	}
+	return txt
+}
+
+// sniYAMLQuote returns the given value as a single-quoted YAML string, so values from Parameters and regexes can't change the structure of the file.
+func sniYAMLQuote(s string) string {
+	return `'` + strings.Replace(s, `'`, `''`, -1) + `'`
+}
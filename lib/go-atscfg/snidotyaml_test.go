@@ -0,0 +1,251 @@
+package atscfg
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+
+	"gopkg.in/yaml.v2"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata with the generated config files")
+
+// checkGolden compares the given config text to the golden file testdata/name, or writes it if the -update flag was given.
+func checkGolden(t *testing.T, name string, txt string) {
+	goldenPath := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := ioutil.WriteFile(goldenPath, []byte(txt), 0644); err != nil {
+			t.Fatalf("writing golden file '%v': %v", goldenPath, err)
+		}
+		return
+	}
+	golden, err := ioutil.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("reading golden file '%v': %v", goldenPath, err)
+	}
+	if txt != string(golden) {
+		t.Errorf("expected '%v' to match golden file, actual:\n%v\nexpected:\n%v", name, txt, string(golden))
+	}
+}
+
+func makeSNITestDS(id int, name string, dsType tc.DSType, protocol int, profile string) DeliveryService {
+	ds := makeGenericDS()
+	ds.ID = util.IntPtr(id)
+	ds.XMLID = util.StrPtr(name)
+	ds.Type = &dsType
+	ds.Protocol = util.IntPtr(protocol)
+	ds.RoutingName = util.StrPtr("cdn")
+	ds.DSCP = util.IntPtr(0)
+	if profile != "" {
+		ds.ProfileID = util.IntPtr(id * 100)
+		ds.ProfileName = util.StrPtr(profile)
+	}
+	return *ds
+}
+
+func makeSNITestRegexes(dsName string, patterns ...string) tc.DeliveryServiceRegexes {
+	regexes := tc.DeliveryServiceRegexes{DSName: dsName}
+	for i, pattern := range patterns {
+		regexes.Regexes = append(regexes.Regexes, tc.DeliveryServiceRegex{
+			Type:      string(tc.DSMatchTypeHostRegex),
+			SetNumber: i,
+			Pattern:   pattern,
+		})
+	}
+	return regexes
+}
+
+func TestMakeSNIDotYAML(t *testing.T) {
+	hdr := "myHeaderComment"
+
+	server := makeGenericServer()
+	cdn := &tc.CDN{Name: "mycdn", DomainName: "mycdn.example.net"}
+
+	dnsDS := makeSNITestDS(1, "dns-ds", tc.DSTypeDNS, tc.DSProtocolHTTPS, "dns-ds-profile")
+	httpDS := makeSNITestDS(2, "http-ds", tc.DSTypeHTTP, tc.DSProtocolHTTPAndHTTPS, "")
+	plainDS := makeSNITestDS(3, "plain-ds", tc.DSTypeHTTP, tc.DSProtocolHTTP, "")
+	unassignedDS := makeSNITestDS(4, "unassigned-ds", tc.DSTypeHTTP, tc.DSProtocolHTTPS, "")
+	topoDS := makeSNITestDS(5, "topo-ds", tc.DSTypeHTTP, tc.DSProtocolHTTPToHTTPS, "topo-ds-profile")
+	topoDS.Topology = util.StrPtr("t0")
+	otherTopoDS := makeSNITestDS(6, "other-topo-ds", tc.DSTypeHTTP, tc.DSProtocolHTTPS, "")
+	otherTopoDS.Topology = util.StrPtr("t1")
+	capDS := makeSNITestDS(7, "cap-ds", tc.DSTypeHTTP, tc.DSProtocolHTTPS, "")
+
+	dses := []DeliveryService{dnsDS, httpDS, plainDS, unassignedDS, topoDS, otherTopoDS, capDS}
+	dss := makeDSS([]Server{*server}, []DeliveryService{dnsDS, httpDS, plainDS, capDS})
+
+	dsRegexes := []tc.DeliveryServiceRegexes{
+		makeSNITestRegexes("dns-ds", `.*\.dns-ds\..*`, `dns-ds\.example\.com`, `dns-ds[0-9]\.example\.com`),
+		makeSNITestRegexes("http-ds", `.*\.http-ds\..*`),
+		makeSNITestRegexes("plain-ds", `.*\.plain-ds\..*`),
+		makeSNITestRegexes("unassigned-ds", `.*\.unassigned-ds\..*`),
+		makeSNITestRegexes("topo-ds", `.*\.topo-ds\..*`, `TOPO.example.com`),
+		makeSNITestRegexes("other-topo-ds", `.*\.other-topo-ds\..*`),
+		makeSNITestRegexes("cap-ds", `.*\.cap-ds\..*`),
+	}
+
+	params := []tc.Parameter{}
+	params = append(params, makeParamsFromMap("dns-ds-profile", SNIParameterConfigFile, map[string]string{
+		SNIParamHTTP2:               "off",
+		SNIParamMinTLSVersion:       "1.2",
+		SNIParamVerifyClient:        "strict",
+		SNIParamVerifyClientCACerts: "/opt/trafficserver/etc/trafficserver/ssl/clients.pem",
+	})...)
+	params = append(params, makeParamsFromMap("topo-ds-profile", SNIParameterConfigFile, map[string]string{
+		SNIParamValidTLSVersionsIn: "1.3,TLSv1_2",
+		SNIParamTunnelRoute:        "tunnel.example.net:443",
+		"not_a_real_param":         "foo",
+	})...)
+
+	topologies := []tc.Topology{
+		{Name: "t0", Nodes: []tc.TopologyNode{{Cachegroup: *server.Cachegroup}}},
+		{Name: "t1", Nodes: []tc.TopologyNode{{Cachegroup: "not-our-cg"}}},
+	}
+
+	dsRequiredCapabilities := map[int]map[ServerCapability]struct{}{
+		*capDS.ID: {"the-cap": {}},
+	}
+
+	serverParams := makeParamsFromMapArr("serverProfile", "package", map[string][]string{"trafficserver": {"9.0.0"}})
+
+	cfg, err := MakeSNIDotYAML(server, dses, dss, dsRegexes, params, serverParams, cdn, topologies, nil, dsRequiredCapabilities, hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txt := cfg.Text
+
+	if !strings.HasPrefix(txt, "# "+hdr+"\n") {
+		t.Errorf("expected: header comment text '" + hdr + "', actual: missing")
+	}
+
+	sni := struct {
+		SNI []map[string]interface{} `yaml:"sni"`
+	}{}
+	if err := yaml.Unmarshal([]byte(txt), &sni); err != nil {
+		t.Fatalf("expected sni.yaml to be valid YAML, actual error: %v\n%v", err, txt)
+	}
+	if len(sni.SNI) != 5 {
+		t.Errorf("expected 5 sni entries, actual %v", len(sni.SNI))
+	}
+
+	checkGolden(t, "sni.yaml", txt)
+
+	warnings := strings.Join(cfg.Warnings, "\n")
+	if !strings.Contains(warnings, `dns-ds[0-9]\.example\.com`) {
+		t.Errorf("expected warning for non-literal host regex, actual: %v", cfg.Warnings)
+	}
+	if !strings.Contains(warnings, "not_a_real_param") {
+		t.Errorf("expected warning for unknown parameter, actual: %v", cfg.Warnings)
+	}
+}
+
+func TestMakeSNIDotYAMLEmpty(t *testing.T) {
+	server := makeGenericServer()
+	cdn := &tc.CDN{Name: "mycdn", DomainName: "mycdn.example.net"}
+
+	cfg, err := MakeSNIDotYAML(server, nil, nil, nil, nil, nil, cdn, nil, nil, nil, "myHeaderComment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "# myHeaderComment\nsni: []\n"; cfg.Text != expected {
+		t.Errorf("expected '%v', actual '%v'", expected, cfg.Text)
+	}
+}
+
+func TestMakeSNIDotYAMLOldATS(t *testing.T) {
+	server := makeGenericServer()
+	cdn := &tc.CDN{Name: "mycdn", DomainName: "mycdn.example.net"}
+	ds := makeSNITestDS(1, "ds", tc.DSTypeHTTP, tc.DSProtocolHTTPS, "ds-profile")
+	dss := makeDSS([]Server{*server}, []DeliveryService{ds})
+	dsRegexes := []tc.DeliveryServiceRegexes{makeSNITestRegexes("ds", `ds\.example\.com`)}
+	params := makeParamsFromMap("ds-profile", SNIParameterConfigFile, map[string]string{
+		SNIParamHTTP2:         "on",
+		SNIParamMinTLSVersion: "1.2",
+	})
+	serverParams := makeParamsFromMapArr("serverProfile", "package", map[string][]string{"trafficserver": {"8.1.0"}})
+
+	cfg, err := MakeSNIDotYAML(server, []DeliveryService{ds}, dss, dsRegexes, params, serverParams, cdn, nil, nil, nil, "myHeaderComment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(cfg.Text, "valid_tls_versions_in") {
+		t.Errorf("expected no valid_tls_versions_in for ATS 8, actual: '%v'", cfg.Text)
+	}
+	if !strings.Contains(cfg.Text, "http2: on") {
+		t.Errorf("expected the rest of the policy for ATS 8, actual: '%v'", cfg.Text)
+	}
+	if !strings.Contains(strings.Join(cfg.Warnings, "\n"), SNIParamValidTLSVersionsIn) {
+		t.Errorf("expected a warning for TLS versions on ATS 8, actual: %v", cfg.Warnings)
+	}
+}
+
+func TestSNIYAMLQuote(t *testing.T) {
+	entry := sniEntry{FQDN: "a.example.net", Policy: sniPolicy{VerifyClientCACerts: "/etc/it's.pem', evil: true", ValidTLSVersionsIn: []string{"TLSv1_3"}}}
+	sni := []map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(makeSNIEntryText(entry)), &sni); err != nil {
+		t.Fatalf("expected valid YAML, actual error: %v", err)
+	}
+	if len(sni) != 1 || sni[0]["verify_client_ca_certs"] != "/etc/it's.pem', evil: true" || len(sni[0]) != 3 {
+		t.Errorf("expected quoted values to round-trip, actual: %+v", sni)
+	}
+}
+
+func TestMakeSNIPolicy(t *testing.T) {
+	tests := []struct {
+		params   map[string]string
+		expected sniPolicy
+		warns    int
+	}{
+		{
+			params:   map[string]string{SNIParamMinTLSVersion: "TLSv1_1"},
+			expected: sniPolicy{ValidTLSVersionsIn: []string{"TLSv1_1", "TLSv1_2", "TLSv1_3"}},
+		},
+		{
+			params:   map[string]string{SNIParamMinTLSVersion: "1.1", SNIParamValidTLSVersionsIn: "1.3"},
+			expected: sniPolicy{ValidTLSVersionsIn: []string{"TLSv1_3"}},
+			warns:    1,
+		},
+		{
+			params:   map[string]string{SNIParamHTTP2: "maybe", SNIParamVerifyClient: "sometimes", SNIParamTunnelRoute: "no-port.example.net", SNIParamMinTLSVersion: "2.0"},
+			expected: sniPolicy{},
+			warns:    4,
+		},
+		{
+			params:   map[string]string{SNIParamHTTP2: "ON", SNIParamVerifyClient: "moderate"},
+			expected: sniPolicy{HTTP2: "on", VerifyClient: "MODERATE"},
+		},
+	}
+	for _, test := range tests {
+		policy, warns := makeSNIPolicy(test.params)
+		if len(warns) != test.warns {
+			t.Errorf("makeSNIPolicy(%+v) expected %v warnings, actual %v: %v", test.params, test.warns, len(warns), warns)
+		}
+		if policy.HTTP2 != test.expected.HTTP2 || policy.VerifyClient != test.expected.VerifyClient || policy.TunnelRoute != test.expected.TunnelRoute || strings.Join(policy.ValidTLSVersionsIn, ",") != strings.Join(test.expected.ValidTLSVersionsIn, ",") {
+			t.Errorf("makeSNIPolicy(%+v) expected %+v, actual %+v", test.params, test.expected, policy)
+		}
+	}
+}
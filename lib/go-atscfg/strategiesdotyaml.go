@@ -0,0 +1,576 @@
+package atscfg
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+const StrategiesYAMLFileName = "strategies.yaml"
+const ContentTypeStrategiesDotYAML = ContentTypeIPAllowDotYAML
+const LineCommentStrategiesDotYAML = LineCommentHash
+
+// StrategiesMinATSMajorVersion is the first ATS major version with next hop strategies.
+// Caches of this version or later have Topology Delivery Service parentage generated in strategies.yaml, and referenced from remap.config with @strategy, instead of in parent.config.
+const StrategiesMinATSMajorVersion = 9
+
+const StrategyPolicyConsistentHash = "consistent_hash"
+const StrategyPolicyRoundRobinStrict = "rr_strict"
+const StrategyPolicyRoundRobinIP = "rr_ip"
+const StrategyPolicyFirstLive = "first_live"
+const StrategyPolicyLatched = "latched"
+
+const StrategyRingModeExhaust = "exhaust_ring"
+const StrategyRingModeAlternate = "alternate_ring"
+
+const StrategyHashKeyPath = "path"
+const StrategyHashKeyPathQuery = "path+query"
+
+const StrategyParentRetrySimple = "simple_retry"
+const StrategyParentRetryUnavailable = "unavailable_server_retry"
+const StrategyParentRetryBoth = "both"
+
+// StrategyDefaultSimpleRetryResponseCodes are the response codes which cause a simple retry, which are the codes ATS parent.config uses for simple_retry.
+var StrategyDefaultSimpleRetryResponseCodes = []string{"404"}
+
+// StrategyDefaultMarkdownCodes are the response codes which mark a parent down, when the unavailable_server_retry_responses Parameter doesn't exist. This is the ATS parent.config default.
+var StrategyDefaultMarkdownCodes = []string{"503"}
+
+// StrategiesYAMLOpts contains settings to configure strategies.yaml generation options.
+type StrategiesYAMLOpts struct {
+	// AddComments is whether to add informative comments to the generated file, about what was generated and why.
+	// Note this does not include the header comment, which is configured separately with HdrComment.
+	// These comments are human-readable and not guarnateed to be consistent between versions. Automating anything based on them is strongly discouraged.
+	AddComments bool
+
+	// HdrComment is the header comment to include at the beginning of the file.
+	// This should be the text desired, without comment syntax (like # or //). The file's comment syntax will be added.
+	// To omit the header comment, pass the empty string.
+	HdrComment string
+}
+
+// MakeStrategiesDotYAML creates the strategies.yaml ATS 9+ config file, which contains a next hop strategy for every Topology Delivery Service the server is in.
+// The parameters are the same as MakeParentDotConfig, and Delivery Service parent.config Parameters are used for the same settings.
+// If the server's ATS version is older than StrategiesMinATSMajorVersion, the file has no strategies, and a warning is returned.
+func MakeStrategiesDotYAML(
+	dses []DeliveryService,
+	server *Server,
+	servers []Server,
+	topologies []tc.Topology,
+	tcServerParams []tc.Parameter,
+	tcParentConfigParams []tc.Parameter,
+	serverCapabilities map[int]map[ServerCapability]struct{},
+	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	cacheGroupArr []tc.CacheGroupNullable,
+	dss []tc.DeliveryServiceServer,
+	cdn *tc.CDN,
+	opt StrategiesYAMLOpts,
+) (Cfg, error) {
+	warnings := []string{}
+
+	if server.HostName == nil || *server.HostName == "" {
+		return Cfg{}, makeErr(warnings, "server HostName missing")
+	} else if server.ID == nil {
+		return Cfg{}, makeErr(warnings, "server ID missing")
+	} else if server.CDNName == nil || *server.CDNName == "" {
+		return Cfg{}, makeErr(warnings, "server CDNName missing")
+	} else if server.Cachegroup == nil || *server.Cachegroup == "" {
+		return Cfg{}, makeErr(warnings, "server Cachegroup missing")
+	} else if server.Profile == nil || *server.Profile == "" {
+		return Cfg{}, makeErr(warnings, "server Profile missing")
+	}
+
+	hdr := ""
+	if opt.HdrComment != "" {
+		hdr = makeHdrComment(opt.HdrComment)
+	}
+
+	atsMajorVer, verWarns := getATSMajorVersion(tcServerParams)
+	warnings = append(warnings, verWarns...)
+	if !useStrategies(atsMajorVer) {
+		warnings = append(warnings, "server ATS version "+strconv.Itoa(atsMajorVer)+" doesn't support strategies, which require ATS "+strconv.Itoa(StrategiesMinATSMajorVersion)+"! Topology parents are in parent.config, not generating strategies!")
+		return Cfg{
+			Text:        hdr,
+			ContentType: ContentTypeStrategiesDotYAML,
+			LineComment: LineCommentStrategiesDotYAML,
+			Warnings:    warnings,
+		}, nil
+	}
+
+	hosts, strategies, stWarns, err := makeStrategies(dses, server, servers, topologies, tcParentConfigParams, serverCapabilities, dsRequiredCapabilities, cacheGroupArr, dss)
+	warnings = append(warnings, stWarns...)
+	if err != nil {
+		return Cfg{}, makeErr(warnings, err.Error())
+	}
+
+	txt := hdr + makeStrategiesYAMLText(hosts, strategies, opt.AddComments)
+
+	return Cfg{
+		Text:        txt,
+		ContentType: ContentTypeStrategiesDotYAML,
+		LineComment: LineCommentStrategiesDotYAML,
+		Warnings:    warnings,
+	}, nil
+}
+
+// StrategyDSNames returns the XMLIDs of the Delivery Services which have a strategy in the server's strategies.yaml, and any warnings.
+// These are the only Delivery Services remap.config may reference with @strategy; the parentage of Topology Delivery Services whose strategy couldn't be generated is in parent.config.
+// The arguments are the same as MakeStrategiesDotYAML. If the server's ATS version doesn't support strategies, there are none.
+func StrategyDSNames(
+	dses []DeliveryService,
+	server *Server,
+	servers []Server,
+	topologies []tc.Topology,
+	tcServerParams []tc.Parameter,
+	tcParentConfigParams []tc.Parameter,
+	serverCapabilities map[int]map[ServerCapability]struct{},
+	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	cacheGroupArr []tc.CacheGroupNullable,
+	dss []tc.DeliveryServiceServer,
+) (map[string]struct{}, []string, error) {
+	names := map[string]struct{}{}
+	atsMajorVer, warnings := getATSMajorVersion(tcServerParams)
+	if !useStrategies(atsMajorVer) {
+		return names, warnings, nil
+	}
+	_, strategies, stWarns, err := makeStrategies(dses, server, servers, topologies, tcParentConfigParams, serverCapabilities, dsRequiredCapabilities, cacheGroupArr, dss)
+	warnings = append(warnings, stWarns...)
+	if err != nil {
+		return nil, warnings, err
+	}
+	for _, st := range strategies {
+		names[st.DSName] = struct{}{}
+	}
+	return names, warnings, nil
+}
+
+// makeStrategies returns the strategies of every Topology Delivery Service the server is in, the hosts they reference by anchor, any warnings, and any error.
+// Delivery Services whose strategy can't be generated are skipped with a warning.
+func makeStrategies(
+	dses []DeliveryService,
+	server *Server,
+	servers []Server,
+	topologies []tc.Topology,
+	tcParentConfigParams []tc.Parameter,
+	serverCapabilities map[int]map[ServerCapability]struct{},
+	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	cacheGroupArr []tc.CacheGroupNullable,
+	dss []tc.DeliveryServiceServer,
+) (map[string]strategyHost, []strategy, []string, error) {
+	warnings := []string{}
+
+	cacheGroups, err := makeCGMap(cacheGroupArr)
+	if err != nil {
+		return nil, nil, warnings, errors.New("making CacheGroup map: " + err.Error())
+	}
+
+	parentConfigParamsWithProfiles, err := tcParamsToParamsWithProfiles(tcParentConfigParams)
+	if err != nil {
+		warnings = append(warnings, "error getting profiles from Traffic Ops Parameters, Parameters will not be considered for generation! : "+err.Error())
+		parentConfigParamsWithProfiles = []parameterWithProfiles{}
+	}
+	parentConfigParams := parameterWithProfilesToMap(parentConfigParamsWithProfiles)
+
+	profileParentConfigParams := map[string]map[string]string{} // map[profileName][paramName]paramVal
+	for _, param := range parentConfigParamsWithProfiles {
+		for _, profile := range param.ProfileNames {
+			if _, ok := profileParentConfigParams[profile]; !ok {
+				profileParentConfigParams[profile] = map[string]string{}
+			}
+			profileParentConfigParams[profile][param.Name] = param.Value
+		}
+	}
+
+	serverParams := map[string]string{}
+	for name, val := range profileParentConfigParams[*server.Profile] {
+		if name == ParentConfigParamQStringHandling ||
+			name == ParentConfigParamAlgorithm ||
+			name == ParentConfigParamQString {
+			serverParams[name] = val
+		}
+	}
+
+	nameTopologies := makeTopologyNameMap(topologies)
+
+	dsOrigins, dsOriginWarns := makeDSOrigins(dss, dses, servers)
+	warnings = append(warnings, dsOriginWarns...)
+
+	dses = append([]DeliveryService{}, dses...) // don't reorder the caller's Delivery Services
+	sort.Sort(dsesSortByName(dses))
+
+	hosts := map[string]strategyHost{} // map[anchor]host
+	strategies := []strategy{}
+	for _, ds := range dses {
+		if ds.XMLID == nil || *ds.XMLID == "" {
+			warnings = append(warnings, "got ds with missing XMLID, skipping!")
+			continue
+		} else if ds.ID == nil {
+			warnings = append(warnings, "got ds with missing ID, skipping!")
+			continue
+		} else if ds.Type == nil {
+			warnings = append(warnings, "got ds with missing Type, skipping!")
+			continue
+		}
+		if ds.Topology == nil || *ds.Topology == "" {
+			continue // non-Topology DSes are still in parent.config
+		}
+		if !ds.Type.IsHTTP() && !ds.Type.IsDNS() {
+			continue // skip ANY_MAP, STEERING, etc
+		}
+		if ds.OrgServerFQDN == nil || *ds.OrgServerFQDN == "" {
+			warnings = append(warnings, "DS '"+*ds.XMLID+"' has no origin server! Skipping!")
+			continue
+		}
+
+		dsParams, dsParamsWarnings := getParentDSParams(ds, profileParentConfigParams)
+		warnings = append(warnings, dsParamsWarnings...)
+
+		st, stWarns, err := getTopologyStrategy(
+			server,
+			servers,
+			&ds,
+			serverParams,
+			parentConfigParams,
+			nameTopologies,
+			serverCapabilities,
+			dsRequiredCapabilities,
+			cacheGroups,
+			dsParams,
+			dsOrigins[DeliveryServiceID(*ds.ID)],
+		)
+		warnings = append(warnings, stWarns...)
+		if err != nil {
+			// we don't want to fail generation with an error if one ds is malformed
+			warnings = append(warnings, err.Error()+" remap.config will not reference a strategy, parent.config will be used!")
+			continue
+		}
+		if st == nil {
+			continue // server isn't in the Topology, or doesn't have the Required Capabilities
+		}
+		for _, group := range st.Groups {
+			for _, member := range group.Members {
+				hosts[member.Host.Anchor()] = member.Host
+			}
+		}
+		strategies = append(strategies, *st)
+	}
+	return hosts, strategies, warnings, nil
+}
+
+// useStrategies returns whether a cache of the given ATS major version uses strategies.yaml for Topology parentage.
+func useStrategies(atsMajorVer int) bool {
+	return atsMajorVer >= StrategiesMinATSMajorVersion
+}
+
+// StrategyName returns the name of the strategies.yaml strategy of the given Delivery Service, which is referenced by remap.config @strategy directives.
+func StrategyName(dsName string) string {
+	return "strategy-" + dsName
+}
+
+// makeStrategyRemapTxt returns the remap.config @strategy directive for the given Delivery Service, or the empty string if it doesn't have a strategy in strategyDSNames.
+func makeStrategyRemapTxt(ds DeliveryService, atsMajorVer int, strategyDSNames map[string]struct{}) string {
+	if !useStrategies(atsMajorVer) || ds.Topology == nil || *ds.Topology == "" || ds.XMLID == nil {
+		return ""
+	}
+	if _, ok := strategyDSNames[*ds.XMLID]; !ok {
+		return ""
+	}
+	return ` @strategy=` + StrategyName(*ds.XMLID)
+}
+
+type strategyHost struct {
+	Host   string
+	Scheme string
+	Port   string
+}
+
+// Anchor returns the YAML anchor of the host. It's unique for the host and port, so Delivery Services with the same parents share a host.
+func (h strategyHost) Anchor() string {
+	return "host__" + yamlAnchorEscape(h.Host) + "__" + h.Port
+}
+
+// yamlAnchorEscape replaces characters which many YAML parsers don't allow in anchors, such as the dots of FQDNs and IPs, and the colons of IPv6 addresses, with underscores.
+func yamlAnchorEscape(s string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+type strategyGroupMember struct {
+	Host   strategyHost
+	Weight string
+}
+
+type strategyGroup struct {
+	Anchor  string
+	Members []strategyGroupMember
+}
+
+type strategyFailover struct {
+	RingMode              string
+	MaxSimpleRetries      string
+	MaxUnavailableRetries string
+	ResponseCodes         []string
+	MarkdownCodes         []string
+}
+
+type strategy struct {
+	Name          string
+	DSName        string
+	Topology      string
+	Policy        string
+	HashKey       string
+	GoDirect      bool
+	ParentIsProxy bool
+	Scheme        string
+	Groups        []strategyGroup
+	Failover      strategyFailover
+}
+
+// getTopologyStrategy returns the strategy of the given Topology Delivery Service, any warnings, and any error.
+// Returns a nil strategy and no error if the server isn't in the Topology, or doesn't have the Delivery Service's required capabilities.
+func getTopologyStrategy(
+	server *Server,
+	servers []Server,
+	ds *DeliveryService,
+	serverParams map[string]string,
+	parentConfigParams []parameterWithProfilesMap, // all params with configFile parent.config
+	nameTopologies map[TopologyName]tc.Topology,
+	serverCapabilities map[int]map[ServerCapability]struct{},
+	dsRequiredCapabilities map[int]map[ServerCapability]struct{},
+	cacheGroups map[tc.CacheGroupName]tc.CacheGroupNullable,
+	dsParams parentDSParams,
+	dsOrigins map[ServerID]struct{},
+) (*strategy, []string, error) {
+	warnings := []string{}
+
+	if !hasRequiredCapabilities(serverCapabilities[*server.ID], dsRequiredCapabilities[*ds.ID]) {
+		return nil, warnings, nil
+	}
+
+	orgURI, orgWarns, err := getOriginURI(*ds.OrgServerFQDN)
+	warnings = append(warnings, orgWarns...)
+	if err != nil {
+		return nil, warnings, errors.New("DS '" + *ds.XMLID + "' has malformed origin URI: '" + *ds.OrgServerFQDN + "': skipping!" + err.Error())
+	}
+
+	topology := nameTopologies[TopologyName(*ds.Topology)]
+	if topology.Name == "" {
+		return nil, warnings, errors.New("DS " + *ds.XMLID + " topology '" + *ds.Topology + "' not found in Topologies!")
+	}
+
+	serverPlacement, err := getTopologyPlacement(tc.CacheGroupName(*server.Cachegroup), topology, cacheGroups, ds)
+	if err != nil {
+		return nil, warnings, errors.New("getting topology placement: " + err.Error())
+	}
+	if !serverPlacement.InTopology {
+		return nil, warnings, nil // server isn't in topology, no error
+	}
+
+	st := &strategy{
+		Name:          StrategyName(*ds.XMLID),
+		DSName:        *ds.XMLID,
+		Topology:      *ds.Topology,
+		Policy:        getStrategyPolicy(getTopologyRoundRobin(ds, serverParams, serverPlacement.IsLastCacheTier, dsParams.Algorithm)),
+		HashKey:       StrategyHashKeyPath,
+		GoDirect:      getTopologyGoDirect(ds, serverPlacement.IsLastTier) == "true",
+		ParentIsProxy: !serverPlacement.IsLastCacheTier,
+		Scheme:        "http",
+		Failover:      getStrategyFailover(serverPlacement.IsLastCacheTier, dsParams),
+	}
+	if getTopologyQueryString(ds, serverParams, serverPlacement.IsLastCacheTier, dsParams.Algorithm, dsParams.QueryStringHandling) == "consider" {
+		st.HashKey = StrategyHashKeyPathQuery
+	}
+
+	// If it's the last tier, then the parent is the origin.
+	// Note this doesn't include MSO, whose final tier cachegroup points to the origin cachegroup.
+	if serverPlacement.IsLastTier {
+		if orgURI.Scheme == "https" {
+			st.Scheme = "https"
+		}
+		st.Groups = []strategyGroup{{
+			Anchor:  strategyGroupAnchor(*ds.XMLID, 0),
+			Members: []strategyGroupMember{{Host: strategyHost{Host: orgURI.Hostname(), Scheme: st.Scheme, Port: orgURI.Port()}, Weight: defaultProfileCache().Weight}},
+		}}
+		return st, warnings, nil
+	}
+
+	parents, secondaryParents, parentWarns, err := getTopologyParentServers(server, ds, servers, parentConfigParams, topology, serverCapabilities, dsRequiredCapabilities, dsOrigins)
+	warnings = append(warnings, parentWarns...)
+	if err != nil {
+		return nil, warnings, errors.New("getting topology parents for '" + *ds.XMLID + "': skipping! " + err.Error())
+	}
+
+	for i, groupServers := range [][]serverWithParams{parents, secondaryParents} {
+		group := strategyGroup{Anchor: strategyGroupAnchor(*ds.XMLID, i)}
+		for _, sv := range groupServers {
+			if sv.Params.NotAParent {
+				continue
+			}
+			host, err := serverParentHost(&sv.Server, sv.Params)
+			if err != nil {
+				return nil, warnings, errors.New("getting server parent host: " + err.Error())
+			}
+			group.Members = append(group.Members, strategyGroupMember{
+				Host:   strategyHost{Host: host, Scheme: st.Scheme, Port: strconv.Itoa(sv.Params.Port)},
+				Weight: sv.Params.Weight,
+			})
+		}
+		if len(group.Members) > 0 {
+			st.Groups = append(st.Groups, group)
+		}
+	}
+	if len(st.Groups) == 0 {
+		return nil, warnings, errors.New("getting topology parents for '" + *ds.XMLID + "': no parents found! skipping! (Does your Topology have a CacheGroup with no servers in it?)")
+	}
+	return st, warnings, nil
+}
+
+func strategyGroupAnchor(dsName string, i int) string {
+	return "group__" + yamlAnchorEscape(dsName) + "__" + strconv.Itoa(i)
+}
+
+// getStrategyPolicy returns the strategy policy for the given parent.config round_robin value.
+func getStrategyPolicy(roundRobin string) string {
+	switch strings.TrimSpace(roundRobin) {
+	case "true", "strict":
+		return StrategyPolicyRoundRobinStrict
+	case "false":
+		return StrategyPolicyFirstLive
+	case StrategyPolicyLatched:
+		return StrategyPolicyLatched
+	default:
+		return StrategyPolicyConsistentHash
+	}
+}
+
+// getStrategyFailover returns the strategy failover settings from the Delivery Service parent.config Parameters.
+// Like parent.config, retries are only configured for the last cache tier, and only if the parent_retry Parameter exists.
+func getStrategyFailover(isLastCacheTier bool, dsParams parentDSParams) strategyFailover {
+	failover := strategyFailover{RingMode: StrategyRingModeAlternate}
+	if dsParams.TryAllPrimariesBeforeSecondary {
+		failover.RingMode = StrategyRingModeExhaust
+	}
+	if !isLastCacheTier || dsParams.ParentRetry == "" {
+		return failover
+	}
+
+	if dsParams.ParentRetry == StrategyParentRetrySimple || dsParams.ParentRetry == StrategyParentRetryBoth {
+		failover.MaxSimpleRetries = dsParams.MaxSimpleRetries
+		if failover.MaxSimpleRetries == "" {
+			failover.MaxSimpleRetries = ParentConfigDSParamDefaultMaxSimpleRetries
+		}
+		failover.ResponseCodes = StrategyDefaultSimpleRetryResponseCodes
+	}
+	if dsParams.ParentRetry == StrategyParentRetryUnavailable || dsParams.ParentRetry == StrategyParentRetryBoth {
+		failover.MaxUnavailableRetries = dsParams.MaxUnavailableServerRetries
+		if failover.MaxUnavailableRetries == "" {
+			failover.MaxUnavailableRetries = ParentConfigDSParamDefaultMaxUnavailableServerRetries
+		}
+		failover.MarkdownCodes = StrategyDefaultMarkdownCodes
+		if dsParams.UnavailableServerRetryResponses != "" { // getParentDSParams verified it's valid
+			failover.MarkdownCodes = strings.Split(strings.Trim(strings.TrimSpace(dsParams.UnavailableServerRetryResponses), `"`), ",")
+		}
+	}
+	return failover
+}
+
+// makeStrategiesYAMLText returns the strategies.yaml text of the given hosts and strategies.
+// Hosts and groups are YAML anchors, referenced by the strategies.
+func makeStrategiesYAMLText(hosts map[string]strategyHost, strategies []strategy, addComments bool) string {
+	if len(strategies) == 0 {
+		return "strategies: []\n"
+	}
+
+	hostAnchors := []string{}
+	for anchor, _ := range hosts {
+		hostAnchors = append(hostAnchors, anchor)
+	}
+	sort.Strings(hostAnchors)
+
+	txt := "hosts:\n"
+	for _, anchor := range hostAnchors {
+		host := hosts[anchor]
+		txt += `  - &` + anchor + `
+    host: ` + host.Host + `
+    protocol:
+      - scheme: ` + host.Scheme + `
+        port: ` + host.Port + "\n"
+	}
+
+	txt += "groups:\n"
+	for _, st := range strategies {
+		for _, group := range st.Groups {
+			txt += `  - &` + group.Anchor + "\n"
+			for _, member := range group.Members {
+				txt += `    - <<: *` + member.Host.Anchor() + `
+      weight: ` + member.Weight + "\n"
+			}
+		}
+	}
+
+	txt += "strategies:\n"
+	for _, st := range strategies {
+		if addComments {
+			txt += "  # ds '" + st.DSName + "' topology '" + st.Topology + "'\n"
+		}
+		txt += `  - strategy: '` + st.Name + `'
+    policy: ` + st.Policy + `
+    hash_key: ` + st.HashKey + `
+    go_direct: ` + strconv.FormatBool(st.GoDirect) + `
+    parent_is_proxy: ` + strconv.FormatBool(st.ParentIsProxy) + `
+    ignore_self_detect: false
+    groups:` + "\n"
+		for _, group := range st.Groups {
+			txt += `      - *` + group.Anchor + "\n"
+		}
+		txt += `    scheme: ` + st.Scheme + `
+    failover:
+      ring_mode: ` + st.Failover.RingMode + "\n"
+		if st.Failover.MaxSimpleRetries != "" {
+			txt += `      max_simple_retries: ` + st.Failover.MaxSimpleRetries + "\n"
+		}
+		if st.Failover.MaxUnavailableRetries != "" {
+			txt += `      max_unavailable_retries: ` + st.Failover.MaxUnavailableRetries + "\n"
+		}
+		if len(st.Failover.ResponseCodes) > 0 {
+			txt += "      response_codes:\n"
+			for _, code := range st.Failover.ResponseCodes {
+				txt += `        - ` + code + "\n"
+			}
+		}
+		if len(st.Failover.MarkdownCodes) > 0 {
+			txt += "      markdown_codes:\n"
+			for _, code := range st.Failover.MarkdownCodes {
+				txt += `        - ` + code + "\n"
+			}
+		}
+		txt += "      health_check:\n        - passive\n"
+	}
+	return txt
+}
@@ -0,0 +1,490 @@
+package atscfg
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+
+	"gopkg.in/yaml.v2"
+)
+
+type strategiesTestData struct {
+	dses                   []DeliveryService
+	server                 *Server
+	servers                []Server
+	topologies             []tc.Topology
+	serverParams           []tc.Parameter
+	parentConfigParams     []tc.Parameter
+	serverCapabilities     map[int]map[ServerCapability]struct{}
+	dsRequiredCapabilities map[int]map[ServerCapability]struct{}
+	cgs                    []tc.CacheGroupNullable
+	dss                    []tc.DeliveryServiceServer
+	cdn                    *tc.CDN
+}
+
+// makeStrategiesTestData returns an ATS 9 edge in a Topology with primary and secondary mid parent cachegroups, a Topology DS, and a non-Topology DS.
+func makeStrategiesTestData() strategiesTestData {
+	ds0 := makeParentDS()
+	ds0Type := tc.DSTypeHTTP
+	ds0.Type = &ds0Type
+	ds0.XMLID = util.StrPtr("ds0")
+	ds0.ID = util.IntPtr(42)
+	ds0.OrgServerFQDN = util.StrPtr("http://ds0.example.net")
+
+	ds1 := makeParentDS()
+	ds1.ID = util.IntPtr(43)
+	ds1Type := tc.DSTypeHTTP
+	ds1.Type = &ds1Type
+	ds1.QStringIgnore = util.IntPtr(int(tc.QStringIgnoreUseInCacheKeyAndPassUp))
+	ds1.OrgServerFQDN = util.StrPtr("http://ds1.example.net")
+	ds1.Topology = util.StrPtr("t0")
+	ds1.ProfileName = util.StrPtr("ds1Profile")
+
+	serverParams := []tc.Parameter{
+		tc.Parameter{
+			Name:       "trafficserver",
+			ConfigFile: "package",
+			Value:      "9.0.0",
+			Profiles:   []byte(`["global"]`),
+		},
+	}
+
+	parentConfigParams := []tc.Parameter{
+		tc.Parameter{
+			Name:       ParentConfigParamAlgorithm,
+			ConfigFile: "parent.config",
+			Value:      "true",
+			Profiles:   []byte(`["ds1Profile"]`),
+		},
+		tc.Parameter{
+			Name:       ParentConfigParamParentRetry,
+			ConfigFile: "parent.config",
+			Value:      "both",
+			Profiles:   []byte(`["ds1Profile"]`),
+		},
+		tc.Parameter{
+			Name:       ParentConfigParamUnavailableServerRetryResponses,
+			ConfigFile: "parent.config",
+			Value:      `"500,502,503"`,
+			Profiles:   []byte(`["ds1Profile"]`),
+		},
+		tc.Parameter{
+			Name:       ParentConfigParamMaxSimpleRetries,
+			ConfigFile: "parent.config",
+			Value:      "14",
+			Profiles:   []byte(`["ds1Profile"]`),
+		},
+		tc.Parameter{
+			Name:       ParentConfigParamSecondaryMode,
+			ConfigFile: "parent.config",
+			Value:      "",
+			Profiles:   []byte(`["ds1Profile"]`),
+		},
+		tc.Parameter{
+			Name:       ParentConfigCacheParamWeight,
+			ConfigFile: "parent.config",
+			Value:      "0.5",
+			Profiles:   []byte(`["midprofile"]`),
+		},
+	}
+
+	server := makeTestParentServer()
+	server.Cachegroup = util.StrPtr("edgeCG")
+	server.CachegroupID = util.IntPtr(400)
+
+	mid0 := makeTestParentServer()
+	mid0.Cachegroup = util.StrPtr("midCG")
+	mid0.CachegroupID = util.IntPtr(500)
+	mid0.HostName = util.StrPtr("mymid0")
+	mid0.ID = util.IntPtr(45)
+	mid0.Type = tc.MidTypePrefix
+	mid0.Profile = util.StrPtr("midprofile")
+	setIP(mid0, "192.168.2.2")
+
+	mid1 := makeTestParentServer()
+	mid1.Cachegroup = util.StrPtr("midCG2")
+	mid1.CachegroupID = util.IntPtr(501)
+	mid1.HostName = util.StrPtr("mymid1")
+	mid1.ID = util.IntPtr(46)
+	mid1.Type = tc.MidTypePrefix
+	setIP(mid1, "192.168.2.3")
+
+	topologies := []tc.Topology{
+		tc.Topology{
+			Name: "t0",
+			Nodes: []tc.TopologyNode{
+				tc.TopologyNode{
+					Cachegroup: "edgeCG",
+					Parents:    []int{1, 2},
+				},
+				tc.TopologyNode{
+					Cachegroup: "midCG",
+				},
+				tc.TopologyNode{
+					Cachegroup: "midCG2",
+				},
+			},
+		},
+	}
+
+	eCG := &tc.CacheGroupNullable{}
+	eCG.Name = server.Cachegroup
+	eCG.ID = server.CachegroupID
+	eCG.ParentName = mid0.Cachegroup
+	eCG.ParentCachegroupID = mid0.CachegroupID
+	eCGType := tc.CacheGroupEdgeTypeName
+	eCG.Type = &eCGType
+
+	mCG := &tc.CacheGroupNullable{}
+	mCG.Name = mid0.Cachegroup
+	mCG.ID = mid0.CachegroupID
+	mCGType := tc.CacheGroupMidTypeName
+	mCG.Type = &mCGType
+
+	mCG2 := &tc.CacheGroupNullable{}
+	mCG2.Name = mid1.Cachegroup
+	mCG2.ID = mid1.CachegroupID
+	mCG2.Type = &mCGType
+
+	return strategiesTestData{
+		dses:                   []DeliveryService{*ds0, *ds1},
+		server:                 server,
+		servers:                []Server{*server, *mid0, *mid1},
+		topologies:             topologies,
+		serverParams:           serverParams,
+		parentConfigParams:     parentConfigParams,
+		serverCapabilities:     map[int]map[ServerCapability]struct{}{},
+		dsRequiredCapabilities: map[int]map[ServerCapability]struct{}{},
+		cgs:                    []tc.CacheGroupNullable{*eCG, *mCG, *mCG2},
+		dss: []tc.DeliveryServiceServer{
+			tc.DeliveryServiceServer{
+				Server:          util.IntPtr(*server.ID),
+				DeliveryService: util.IntPtr(*ds0.ID),
+			},
+		},
+		cdn: &tc.CDN{
+			DomainName: "cdndomain.example",
+			Name:       "my-cdn-name",
+		},
+	}
+}
+
+func (d strategiesTestData) makeStrategies(t *testing.T, opt StrategiesYAMLOpts) (Cfg, map[string]interface{}) {
+	cfg, err := MakeStrategiesDotYAML(d.dses, d.server, d.servers, d.topologies, d.serverParams, d.parentConfigParams, d.serverCapabilities, d.dsRequiredCapabilities, d.cgs, d.dss, d.cdn, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	yml := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(cfg.Text), &yml); err != nil {
+		t.Fatalf("expected valid yaml, actual error '%v' text '%v'", err, cfg.Text)
+	}
+	return cfg, yml
+}
+
+// getYAMLStrategy returns the strategy with the given name from the parsed strategies.yaml, or nil if it doesn't exist.
+func getYAMLStrategy(t *testing.T, yml map[string]interface{}, name string) map[interface{}]interface{} {
+	strategies, ok := yml["strategies"].([]interface{})
+	if !ok {
+		t.Fatalf("expected strategies list, actual: %+v", yml["strategies"])
+	}
+	for _, stI := range strategies {
+		st, ok := stI.(map[interface{}]interface{})
+		if !ok {
+			t.Fatalf("expected strategy object, actual: %+v", stI)
+		}
+		if st["strategy"] == name {
+			return st
+		}
+	}
+	return nil
+}
+
+func TestMakeStrategiesDotYAML(t *testing.T) {
+	data := makeStrategiesTestData()
+	opt := StrategiesYAMLOpts{HdrComment: "myHeaderComment"}
+	cfg, yml := data.makeStrategies(t, opt)
+	txt := cfg.Text
+
+	testComment(t, txt, opt.HdrComment)
+
+	if getYAMLStrategy(t, yml, StrategyName("ds0")) != nil {
+		t.Errorf("expected no strategy for non-topology DS, actual: '%v'", txt)
+	}
+	st := getYAMLStrategy(t, yml, StrategyName("ds1"))
+	if st == nil {
+		t.Fatalf("expected strategy for topology DS, actual: '%v'", txt)
+	}
+
+	if st["policy"] != StrategyPolicyConsistentHash {
+		t.Errorf("expected policy for non-last cache tier '%v', actual: '%v'", StrategyPolicyConsistentHash, st["policy"])
+	}
+	if st["hash_key"] != StrategyHashKeyPathQuery {
+		t.Errorf("expected hash_key for inner tier with qstring use-in-cache-key '%v', actual: '%v'", StrategyHashKeyPathQuery, st["hash_key"])
+	}
+	if st["go_direct"] != false {
+		t.Errorf("expected go_direct false for non-last tier, actual: '%v'", st["go_direct"])
+	}
+	if st["parent_is_proxy"] != true {
+		t.Errorf("expected parent_is_proxy true for non-last cache tier, actual: '%v'", st["parent_is_proxy"])
+	}
+
+	groups, ok := st["groups"].([]interface{})
+	if !ok || len(groups) != 2 {
+		t.Fatalf("expected primary and secondary groups, actual: '%v'", txt)
+	}
+	expectedHosts := []string{"mymid0.mydomain.example.net", "mymid1.mydomain.example.net"}
+	expectedWeights := []string{"0.5", "0.999"}
+	for i, groupI := range groups {
+		group, ok := groupI.([]interface{})
+		if !ok || len(group) != 1 {
+			t.Fatalf("expected group %v to have 1 host, actual: '%v'", i, txt)
+		}
+		host, ok := group[0].(map[interface{}]interface{})
+		if !ok {
+			t.Fatalf("expected group %v host object, actual: '%v'", i, txt)
+		}
+		if host["host"] != expectedHosts[i] {
+			t.Errorf("expected group %v host '%v', actual: '%v'", i, expectedHosts[i], host["host"])
+		}
+		if weight := fmt.Sprint(host["weight"]); weight != expectedWeights[i] {
+			t.Errorf("expected group %v host weight '%v', actual: '%v'", i, expectedWeights[i], weight)
+		}
+	}
+
+	failover, ok := st["failover"].(map[interface{}]interface{})
+	if !ok {
+		t.Fatalf("expected failover, actual: '%v'", txt)
+	}
+	if failover["ring_mode"] != StrategyRingModeExhaust {
+		t.Errorf("expected ring_mode from secondary mode param '%v', actual: '%v'", StrategyRingModeExhaust, failover["ring_mode"])
+	}
+	if _, ok := failover["max_simple_retries"]; ok {
+		t.Errorf("expected no retries for non-last cache tier, actual: '%v'", txt)
+	}
+}
+
+func TestMakeStrategiesDotYAMLLastTier(t *testing.T) {
+	data := makeStrategiesTestData()
+	data.server = &data.servers[1] // mid0, in the last tier of the Topology
+	cfg, yml := data.makeStrategies(t, StrategiesYAMLOpts{})
+	txt := cfg.Text
+
+	st := getYAMLStrategy(t, yml, StrategyName("ds1"))
+	if st == nil {
+		t.Fatalf("expected strategy for topology DS, actual: '%v'", txt)
+	}
+	if st["policy"] != StrategyPolicyRoundRobinStrict {
+		t.Errorf("expected policy from DS algorithm param '%v', actual: '%v'", StrategyPolicyRoundRobinStrict, st["policy"])
+	}
+	if st["go_direct"] != true {
+		t.Errorf("expected go_direct true for last tier, actual: '%v'", st["go_direct"])
+	}
+	if st["parent_is_proxy"] != false {
+		t.Errorf("expected parent_is_proxy false for last cache tier, actual: '%v'", st["parent_is_proxy"])
+	}
+	if st["hash_key"] != StrategyHashKeyPath {
+		t.Errorf("expected hash_key for non-MSO last tier '%v', actual: '%v'", StrategyHashKeyPath, st["hash_key"])
+	}
+	if !strings.Contains(txt, "host: ds1.example.net") || !strings.Contains(txt, "port: 80") {
+		t.Errorf("expected last tier parent to be origin 'ds1.example.net' port 80, actual: '%v'", txt)
+	}
+
+	failover, ok := st["failover"].(map[interface{}]interface{})
+	if !ok {
+		t.Fatalf("expected failover, actual: '%v'", txt)
+	}
+	expected := map[string]string{
+		"max_simple_retries":      "14",
+		"max_unavailable_retries": ParentConfigDSParamDefaultMaxUnavailableServerRetries,
+		"response_codes":          "[404]",
+		"markdown_codes":          "[500 502 503]",
+	}
+	for key, val := range expected {
+		if actual := fmt.Sprint(failover[key]); actual != val {
+			t.Errorf("expected failover %v '%v', actual: '%v'", key, val, actual)
+		}
+	}
+}
+
+func TestMakeStrategiesDotYAMLCapabilities(t *testing.T) {
+	data := makeStrategiesTestData()
+	data.dsRequiredCapabilities = map[int]map[ServerCapability]struct{}{
+		43: {"FOO": {}},
+	}
+	data.serverCapabilities = map[int]map[ServerCapability]struct{}{
+		*data.server.ID:     {"FOO": {}},
+		*data.servers[2].ID: {"FOO": {}},
+	}
+	cfg, yml := data.makeStrategies(t, StrategiesYAMLOpts{})
+	txt := cfg.Text
+
+	st := getYAMLStrategy(t, yml, StrategyName("ds1"))
+	if st == nil {
+		t.Fatalf("expected strategy for topology DS, actual: '%v'", txt)
+	}
+	if groups, ok := st["groups"].([]interface{}); !ok || len(groups) != 1 {
+		t.Errorf("expected 1 group of parents with the required capability, actual: '%v'", txt)
+	}
+	if strings.Contains(txt, "mymid0") {
+		t.Errorf("expected parent without required capability to be omitted, actual: '%v'", txt)
+	}
+
+	data.serverCapabilities = map[int]map[ServerCapability]struct{}{}
+	cfg, yml = data.makeStrategies(t, StrategiesYAMLOpts{})
+	if getYAMLStrategy(t, yml, StrategyName("ds1")) != nil {
+		t.Errorf("expected no strategy for server without required capability, actual: '%v'", cfg.Text)
+	}
+}
+
+func TestMakeStrategiesDotYAMLOldATS(t *testing.T) {
+	data := makeStrategiesTestData()
+	data.serverParams[0].Value = "8.1.0"
+	cfg, _ := data.makeStrategies(t, StrategiesYAMLOpts{HdrComment: "myHeaderComment"})
+	if strings.Contains(cfg.Text, "strategy") {
+		t.Errorf("expected no strategies for ATS 8, actual: '%v'", cfg.Text)
+	}
+	if len(cfg.Warnings) == 0 {
+		t.Errorf("expected warning for ATS 8, actual: none")
+	}
+}
+
+func TestMakeParentDotConfigStrategies(t *testing.T) {
+	data := makeStrategiesTestData()
+	opt := ParentConfigOpts{HdrComment: "myHeaderComment"}
+	cfg, err := MakeParentDotConfig(data.dses, data.server, data.servers, data.topologies, data.serverParams, data.parentConfigParams, data.serverCapabilities, data.dsRequiredCapabilities, data.cgs, data.dss, data.cdn, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(cfg.Text, "dest_domain=ds1.example.net") {
+		t.Errorf("expected ATS 9 topology DS to be omitted from parent.config, actual: '%v'", cfg.Text)
+	}
+	if !strings.Contains(cfg.Text, "dest_domain=ds0.example.net") {
+		t.Errorf("expected ATS 9 non-topology DS in parent.config, actual: '%v'", cfg.Text)
+	}
+
+	data.serverParams[0].Value = "8.1.0"
+	cfg, err = MakeParentDotConfig(data.dses, data.server, data.servers, data.topologies, data.serverParams, data.parentConfigParams, data.serverCapabilities, data.dsRequiredCapabilities, data.cgs, data.dss, data.cdn, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(cfg.Text, "dest_domain=ds1.example.net") {
+		t.Errorf("expected ATS 8 topology DS in parent.config, actual: '%v'", cfg.Text)
+	}
+}
+
+func TestMakeRemapDotConfigStrategies(t *testing.T) {
+	data := makeStrategiesTestData()
+	ds := data.dses[1]
+	ds.Active = util.BoolPtr(true)
+	ds.DSCP = util.IntPtr(0)
+	ds.Protocol = util.IntPtr(int(tc.DSProtocolHTTP))
+	ds.RoutingName = util.StrPtr("myroutingname")
+	dses := []DeliveryService{ds}
+
+	dsRegexes := []tc.DeliveryServiceRegexes{
+		tc.DeliveryServiceRegexes{
+			DSName: *ds.XMLID,
+			Regexes: []tc.DeliveryServiceRegex{
+				tc.DeliveryServiceRegex{
+					Type:      string(tc.DSMatchTypeHostRegex),
+					SetNumber: 0,
+					Pattern:   `.*\.ds1\..*`,
+				},
+			},
+		},
+	}
+
+	for _, ver := range []string{"9.0.0", "8.1.0"} {
+		data.serverParams[0].Value = ver
+		for _, server := range []*Server{data.server, &data.servers[1]} {
+			strategyDSNames, _, err := StrategyDSNames(data.dses, server, data.servers, data.topologies, data.serverParams, data.parentConfigParams, data.serverCapabilities, data.dsRequiredCapabilities, data.cgs, data.dss)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := MakeRemapDotConfig(server, dses, data.dss, dsRegexes, data.serverParams, data.cdn, nil, data.topologies, data.cgs, data.serverCapabilities, data.dsRequiredCapabilities, strategyDSNames, "myHeaderComment")
+			if err != nil {
+				t.Fatal(err)
+			}
+			hasStrategy := strings.Contains(cfg.Text, "@strategy="+StrategyName("ds1"))
+			if expected := ver == "9.0.0"; hasStrategy != expected {
+				t.Errorf("ATS %v server type %v expected remap.config @strategy %v, actual: '%v'", ver, server.Type, expected, cfg.Text)
+			}
+		}
+	}
+}
+
+func TestMakeRemapDotConfigSkippedStrategy(t *testing.T) {
+	data := makeStrategiesTestData()
+	ds := data.dses[1]
+	ds.Active = util.BoolPtr(true)
+	ds.DSCP = util.IntPtr(0)
+	ds.Protocol = util.IntPtr(int(tc.DSProtocolHTTP))
+	ds.RoutingName = util.StrPtr("myroutingname")
+
+	dsRegexes := []tc.DeliveryServiceRegexes{
+		tc.DeliveryServiceRegexes{
+			DSName: *ds.XMLID,
+			Regexes: []tc.DeliveryServiceRegex{
+				tc.DeliveryServiceRegex{
+					Type:      string(tc.DSMatchTypeHostRegex),
+					SetNumber: 0,
+					Pattern:   `.*\.ds1\..*`,
+				},
+			},
+		},
+	}
+
+	// without the parent servers, the edge's strategy has no parents, so it's skipped.
+	servers := []Server{*data.server}
+	strategyDSNames, warnings, err := StrategyDSNames(data.dses, data.server, servers, data.topologies, data.serverParams, data.parentConfigParams, data.serverCapabilities, data.dsRequiredCapabilities, data.cgs, data.dss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := strategyDSNames["ds1"]; ok {
+		t.Fatalf("expected no strategy for topology DS without parents, actual: %+v", strategyDSNames)
+	}
+	if len(warnings) == 0 {
+		t.Errorf("expected a warning for the skipped strategy, actual: none")
+	}
+
+	yml, err := MakeStrategiesDotYAML(data.dses, data.server, servers, data.topologies, data.serverParams, data.parentConfigParams, data.serverCapabilities, data.dsRequiredCapabilities, data.cgs, data.dss, data.cdn, StrategiesYAMLOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(yml.Text, StrategyName("ds1")) {
+		t.Errorf("expected strategies.yaml to omit the skipped strategy, actual: '%v'", yml.Text)
+	}
+
+	cfg, err := MakeRemapDotConfig(data.server, []DeliveryService{ds}, data.dss, dsRegexes, data.serverParams, data.cdn, nil, data.topologies, data.cgs, data.serverCapabilities, data.dsRequiredCapabilities, strategyDSNames, "myHeaderComment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(cfg.Text, "ds1") {
+		t.Fatalf("expected remap.config to have the topology DS, actual: '%v'", cfg.Text)
+	}
+	if strings.Contains(cfg.Text, "@strategy=") {
+		t.Errorf("expected remap.config not to reference the skipped strategy, actual: '%v'", cfg.Text)
+	}
+}
@@ -0,0 +1,149 @@
+package tc
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-util"
+)
+
+// These are the names of the Stats Summary statistics Traffic Stats stores for
+// each billing period. Each is stored with the StatDate and StatEndDate of the
+// period, for a Delivery Service, for all the Delivery Services of a Tenant
+// (DeliveryService "all"), or for a whole CDN (DeliveryService "all" and no
+// Tenant).
+const (
+	// BillingStatP95Gbps is the 95th percentile of the 5-minute average
+	// bandwidth over the period, in gigabits per second.
+	BillingStatP95Gbps = "billing_p95_gbps"
+	// BillingStatPeakGbps is the highest 5-minute average bandwidth over the
+	// period, in gigabits per second.
+	BillingStatPeakGbps = "billing_peak_gbps"
+	// BillingStatTotalBytes is the number of bytes served over the period.
+	BillingStatTotalBytes = "billing_total_bytes"
+)
+
+// BillingStatNames are the names of all the billing statistics.
+var BillingStatNames = []string{BillingStatP95Gbps, BillingStatPeakGbps, BillingStatTotalBytes}
+
+// BillingReport is the billing summary of a Delivery Service, a Tenant, or a
+// CDN over a period, made from the billing statistics of the period.
+type BillingReport struct {
+	CDNName         string  `json:"cdnName"`
+	DeliveryService string  `json:"deliveryServiceName"`
+	TenantName      *string `json:"tenantName"`
+	// StartDate is the first day of the period.
+	StartDate time.Time `json:"startDate"`
+	// EndDate is the day after the last day of the period.
+	EndDate     time.Time `json:"endDate"`
+	P95Gbps     *float64  `json:"p95Gbps"`
+	PeakGbps    *float64  `json:"peakGbps"`
+	TotalBytes  *float64  `json:"totalBytes"`
+	SummaryTime time.Time `json:"summaryTime"`
+}
+
+// BillingReportsResponse is the type of a response from the billing_reports
+// Traffic Ops API endpoint.
+type BillingReportsResponse struct {
+	Response []BillingReport `json:"response"`
+	Alerts
+}
+
+// MarshalJSON implements the encoding/json.Marshaler interface, to force the
+// date format of the period.
+func (br BillingReport) MarshalJSON() ([]byte, error) {
+	type Alias BillingReport
+	resp := struct {
+		StartDate   string `json:"startDate"`
+		EndDate     string `json:"endDate"`
+		SummaryTime string `json:"summaryTime"`
+		Alias
+	}{
+		StartDate:   br.StartDate.Format(dateFormat),
+		EndDate:     br.EndDate.Format(dateFormat),
+		SummaryTime: br.SummaryTime.Format(TimeLayout),
+		Alias:       (Alias)(br),
+	}
+	return json.Marshal(&resp)
+}
+
+// UnmarshalJSON implements the encoding/json.Unmarshaler interface, to accept
+// the date format of the period.
+func (br *BillingReport) UnmarshalJSON(data []byte) error {
+	type Alias BillingReport
+	resp := struct {
+		StartDate   string `json:"startDate"`
+		EndDate     string `json:"endDate"`
+		SummaryTime string `json:"summaryTime"`
+		*Alias
+	}{
+		Alias: (*Alias)(br),
+	}
+	err := json.Unmarshal(data, &resp)
+	if err != nil {
+		return err
+	}
+	if br.StartDate, err = parseTime(resp.StartDate); err != nil {
+		return errors.New("invalid date given for startDate")
+	}
+	if br.EndDate, err = parseTime(resp.EndDate); err != nil {
+		return errors.New("invalid date given for endDate")
+	}
+	if br.SummaryTime, err = parseTime(resp.SummaryTime); err != nil {
+		return errors.New("invalid timestamp given for summaryTime")
+	}
+	return nil
+}
+
+// BillingReportStatsSummaries returns the Stats Summaries which store the
+// billing statistics of the given report, computed at the report's
+// SummaryTime. Statistics the report doesn't have are omitted.
+func BillingReportStatsSummaries(br BillingReport) []StatsSummary {
+	stats := []struct {
+		name  string
+		value *float64
+	}{
+		{name: BillingStatP95Gbps, value: br.P95Gbps},
+		{name: BillingStatPeakGbps, value: br.PeakGbps},
+		{name: BillingStatTotalBytes, value: br.TotalBytes},
+	}
+	summaries := []StatsSummary{}
+	for _, stat := range stats {
+		if stat.value == nil {
+			continue
+		}
+		startDate := br.StartDate
+		endDate := br.EndDate
+		summaries = append(summaries, StatsSummary{
+			CDNName:         util.StrPtr(br.CDNName),
+			DeliveryService: util.StrPtr(br.DeliveryService),
+			StatName:        util.StrPtr(stat.name),
+			StatValue:       util.FloatPtr(*stat.value),
+			SummaryTime:     br.SummaryTime,
+			StatDate:        &startDate,
+			StatEndDate:     &endDate,
+			TenantName:      br.TenantName,
+		})
+	}
+	return summaries
+}
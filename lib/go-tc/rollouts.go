@@ -0,0 +1,196 @@
+package tc
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc/tovalidate"
+	"github.com/apache/trafficcontrol/lib/go-util"
+
+	"github.com/go-ozzo/ozzo-validation"
+)
+
+// RolloutStatus is the state of a rollout of queued updates.
+type RolloutStatus string
+
+const (
+	// RolloutStatusInProgress is a rollout whose waves are being advanced.
+	RolloutStatusInProgress = RolloutStatus("in_progress")
+	// RolloutStatusPaused is a rollout which was paused, and won't advance until it's resumed.
+	RolloutStatusPaused = RolloutStatus("paused")
+	// RolloutStatusFailed is a rollout whose current wave failed, and won't advance until it's resumed.
+	RolloutStatusFailed = RolloutStatus("failed")
+	// RolloutStatusCompleted is a rollout all of whose waves succeeded.
+	RolloutStatusCompleted = RolloutStatus("completed")
+	// RolloutStatusAborted is a rollout which was stopped before all its waves were started.
+	RolloutStatusAborted = RolloutStatus("aborted")
+	// RolloutStatusRolledBack is a rollout whose updated servers were queued to update again, to apply reverted config.
+	RolloutStatusRolledBack = RolloutStatus("rolled_back")
+)
+
+// IsActive returns whether a rollout with the status may still advance, in which case it's the only active rollout of its CDN.
+func (s RolloutStatus) IsActive() bool {
+	return s == RolloutStatusInProgress || s == RolloutStatusPaused || s == RolloutStatusFailed
+}
+
+// RolloutWaveStatus is the state of one wave of a rollout.
+type RolloutWaveStatus string
+
+const (
+	// RolloutWaveStatusPending is a wave which hasn't started.
+	RolloutWaveStatusPending = RolloutWaveStatus("pending")
+	// RolloutWaveStatusUpdating is a wave whose servers have updates queued, and haven't all applied them.
+	RolloutWaveStatusUpdating = RolloutWaveStatus("updating")
+	// RolloutWaveStatusSoaking is a wave all of whose servers applied their updates, waiting for its soak time to pass.
+	RolloutWaveStatusSoaking = RolloutWaveStatus("soaking")
+	// RolloutWaveStatusSucceeded is a wave whose servers all applied their updates and were available after its soak time.
+	RolloutWaveStatusSucceeded = RolloutWaveStatus("succeeded")
+	// RolloutWaveStatusFailed is a wave a server of which failed to apply its update, or was unavailable after its soak time.
+	RolloutWaveStatusFailed = RolloutWaveStatus("failed")
+	// RolloutWaveStatusCanceled is a wave which won't complete, because its rollout was aborted or rolled back.
+	RolloutWaveStatusCanceled = RolloutWaveStatus("canceled")
+)
+
+// RolloutAction is a manual control of a rollout.
+type RolloutAction string
+
+const (
+	// RolloutActionPause stops an in-progress rollout from advancing.
+	RolloutActionPause = RolloutAction("pause")
+	// RolloutActionResume continues a paused or failed rollout. A failed wave is retried.
+	RolloutActionResume = RolloutAction("resume")
+	// RolloutActionAbort stops a rollout, and dequeues the updates of servers in its current wave which haven't applied them.
+	RolloutActionAbort = RolloutAction("abort")
+	// RolloutActionRollback queues updates on every server the rollout queued, so they apply the current, reverted config.
+	RolloutActionRollback = RolloutAction("rollback")
+)
+
+// RolloutWaveRequest is one wave of a RolloutRequest. Exactly one of
+// CacheGroups and Percent must be given.
+type RolloutWaveRequest struct {
+	// CacheGroups is the names of the Cache Groups whose servers are in the wave.
+	CacheGroups []string `json:"cachegroups"`
+	// Percent is the cumulative percent of the rollout's servers which are updated by the end of the wave.
+	Percent *int `json:"percent"`
+	// SoakSeconds is how long all the wave's servers must have applied their updates, before they're checked for availability.
+	SoakSeconds int `json:"soakSeconds"`
+}
+
+// RolloutRequest encodes the request data for the POST rollouts endpoint.
+type RolloutRequest struct {
+	CDNID    int                  `json:"cdnId"`
+	Topology *string              `json:"topology"`
+	Waves    []RolloutWaveRequest `json:"waves"`
+}
+
+// Validate validates the RolloutRequest is valid for creation. It doesn't
+// check the CDN, Topology, or Cache Groups exist.
+func (r *RolloutRequest) Validate(tx *sql.Tx) error {
+	errs := validation.Errors{
+		"cdnId": validation.Validate(r.CDNID, validation.Required),
+		"waves": validation.Validate(r.Waves, validation.Required),
+	}
+	errList := tovalidate.ToErrors(errs)
+	prevPercent := 0
+	for i, wave := range r.Waves {
+		prefix := "waves[" + strconv.Itoa(i) + "]: "
+		if (len(wave.CacheGroups) == 0) == (wave.Percent == nil) {
+			errList = append(errList, errors.New(prefix+"exactly one of cachegroups and percent is required"))
+		}
+		if wave.Percent != nil {
+			if *wave.Percent < 1 || *wave.Percent > 100 {
+				errList = append(errList, errors.New(prefix+"percent must be between 1 and 100"))
+			} else if *wave.Percent < prevPercent {
+				errList = append(errList, errors.New(prefix+"percent must not be less than the percent of an earlier wave, because it's cumulative"))
+			} else {
+				prevPercent = *wave.Percent
+			}
+		}
+		if wave.SoakSeconds < 0 {
+			errList = append(errList, errors.New(prefix+"soakSeconds must not be negative"))
+		}
+	}
+	return util.JoinErrs(errList)
+}
+
+// RolloutActionRequest encodes the request data for the POST
+// rollouts/{{ID}}/action endpoint.
+type RolloutActionRequest struct {
+	Action RolloutAction `json:"action"`
+}
+
+// Validate validates the RolloutActionRequest is a known action.
+func (r *RolloutActionRequest) Validate(tx *sql.Tx) error {
+	switch r.Action {
+	case RolloutActionPause, RolloutActionResume, RolloutActionAbort, RolloutActionRollback:
+		return nil
+	}
+	return errors.New("action must be one of '" + string(RolloutActionPause) + "', '" + string(RolloutActionResume) + "', '" + string(RolloutActionAbort) + "', or '" + string(RolloutActionRollback) + "'")
+}
+
+// RolloutWave is one wave of a Rollout.
+type RolloutWave struct {
+	Number      int               `json:"number" db:"number"`
+	CacheGroups []string          `json:"cachegroups" db:"cachegroups"`
+	Percent     *int              `json:"percent" db:"percent"`
+	SoakSeconds int               `json:"soakSeconds" db:"soak_seconds"`
+	Status      RolloutWaveStatus `json:"status" db:"status"`
+	// Servers is the host names of the wave's servers, which are chosen when the wave starts.
+	Servers []string `json:"servers"`
+	// PendingServers is the host names of the wave's servers which haven't applied their queued updates.
+	PendingServers []string   `json:"pendingServers"`
+	StartedAt      *time.Time `json:"startedAt" db:"started_at"`
+	SoakStartedAt  *time.Time `json:"soakStartedAt" db:"soak_started_at"`
+	CompletedAt    *time.Time `json:"completedAt" db:"completed_at"`
+	FailureReason  string     `json:"failureReason" db:"failure_reason"`
+}
+
+// Rollout is a plan to queue updates on the cache servers of a CDN in
+// ordered waves, each of which starts only if the previous wave succeeded.
+type Rollout struct {
+	ID          int           `json:"id" db:"id"`
+	CDNID       int           `json:"cdnId" db:"cdn_id"`
+	CDNName     string        `json:"cdnName" db:"cdn_name"`
+	Topology    *string       `json:"topology" db:"topology"`
+	Status      RolloutStatus `json:"status" db:"status"`
+	CurrentWave int           `json:"currentWave" db:"current_wave"`
+	CreatedBy   string        `json:"createdBy" db:"created_by"`
+	CreatedAt   time.Time     `json:"createdAt" db:"created_at"`
+	LastUpdated time.Time     `json:"lastUpdated" db:"last_updated"`
+	Waves       []RolloutWave `json:"waves"`
+}
+
+// RolloutResponse is the type of a response from the Traffic Ops API to a
+// request for a single rollout, or to create or control one.
+type RolloutResponse struct {
+	Response Rollout `json:"response"`
+	Alerts
+}
+
+// RolloutsResponse is the type of a response from the Traffic Ops API to a
+// request to its rollouts endpoint.
+type RolloutsResponse struct {
+	Response []Rollout `json:"response"`
+	Alerts
+}
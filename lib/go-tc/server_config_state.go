@@ -0,0 +1,149 @@
+package tc
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc/tovalidate"
+	"github.com/apache/trafficcontrol/lib/go-util"
+
+	"github.com/go-ozzo/ozzo-validation"
+)
+
+// ServerConfigFileState is the checksum of a config file applied on a cache server.
+type ServerConfigFileState struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Checksum string `json:"checksum"`
+}
+
+// ServerConfigStateRequest encodes the request data for the POST
+// servers/{{ID}}/config_state endpoint.
+//
+// If Files is nil, the cache server didn't apply any config, e.g. because it
+// failed before generating it, so the outcome of the run is recorded, but its
+// config file checksums and the time its config was applied are unchanged.
+type ServerConfigStateRequest struct {
+	RunMode     string                   `json:"runMode"`
+	Success     bool                     `json:"success"`
+	FailedStage string                   `json:"failedStage"`
+	FailedFile  string                   `json:"failedFile"`
+	Error       string                   `json:"error"`
+	RolledBack  bool                     `json:"rolledBack"`
+	Files       *[]ServerConfigFileState `json:"files"`
+}
+
+// Validate validates the ServerConfigStateRequest is valid for creation.
+func (r *ServerConfigStateRequest) Validate(tx *sql.Tx) error {
+	errs := validation.Errors{
+		"runMode": validation.Validate(r.RunMode, validation.Required),
+	}
+	errList := tovalidate.ToErrors(errs)
+	if r.Files != nil {
+		names := map[string]struct{}{}
+		for i, file := range *r.Files {
+			if file.Name == "" || file.Checksum == "" {
+				errList = append(errList, errors.New("files["+strconv.Itoa(i)+"]: name and checksum are required"))
+				continue
+			}
+			if _, ok := names[file.Name]; ok {
+				errList = append(errList, errors.New("files: duplicate name '"+file.Name+"'"))
+			}
+			names[file.Name] = struct{}{}
+		}
+	}
+	return util.JoinErrs(errList)
+}
+
+// ServerConfigState is the state of the config on a cache server, as last
+// reported by the cache server.
+type ServerConfigState struct {
+	ServerID    int                     `json:"serverId" db:"server"`
+	HostName    string                  `json:"hostName" db:"host_name"`
+	RunMode     string                  `json:"runMode" db:"run_mode"`
+	Success     bool                    `json:"success" db:"success"`
+	FailedStage string                  `json:"failedStage" db:"failed_stage"`
+	FailedFile  string                  `json:"failedFile" db:"failed_file"`
+	Error       string                  `json:"error" db:"error"`
+	RolledBack  bool                    `json:"rolledBack" db:"rolled_back"`
+	Files       []ServerConfigFileState `json:"files"`
+	Applied     *time.Time              `json:"applied" db:"applied"`
+	LastChecked time.Time               `json:"lastChecked" db:"last_checked"`
+}
+
+// ServerConfigStateResponse is the type of a response from the Traffic Ops
+// API to a request to its servers/{{ID}}/config_state endpoint.
+type ServerConfigStateResponse struct {
+	Response ServerConfigState `json:"response"`
+	Alerts
+}
+
+// ServerConfigDriftReason is why a cache server's config is reported as drifted.
+type ServerConfigDriftReason string
+
+const (
+	// ServerConfigDriftNoState is a cache server which has never reported its config state.
+	ServerConfigDriftNoState = ServerConfigDriftReason("noState")
+	// ServerConfigDriftStale is a cache server which hasn't checked in within the requested time.
+	ServerConfigDriftStale = ServerConfigDriftReason("stale")
+	// ServerConfigDriftApplyFailed is a cache server whose last attempt to apply config failed.
+	ServerConfigDriftApplyFailed = ServerConfigDriftReason("applyFailed")
+	// ServerConfigDriftChecksumMismatch is a cache server whose applied config files differ from what Traffic Ops generates now.
+	ServerConfigDriftChecksumMismatch = ServerConfigDriftReason("checksumMismatch")
+)
+
+// ServerConfigFileDrift is a config file whose checksum on a cache server
+// differs from the checksum of the file Traffic Ops generates now.
+type ServerConfigFileDrift struct {
+	Name             string `json:"name"`
+	Path             string `json:"path"`
+	AppliedChecksum  string `json:"appliedChecksum"`
+	ExpectedChecksum string `json:"expectedChecksum"`
+}
+
+// ServerConfigDrift is a cache server whose config has drifted from Traffic Ops.
+//
+// UnknownFiles are the names of the applied config files which Traffic Ops
+// can't generate to compare, so whether they drifted is unknown. They aren't
+// a reason for a server to have drifted.
+type ServerConfigDrift struct {
+	ServerID     int                       `json:"serverId"`
+	HostName     string                    `json:"hostName"`
+	CDNName      string                    `json:"cdnName"`
+	Status       string                    `json:"status"`
+	UpdPending   bool                      `json:"updPending"`
+	RevalPending bool                      `json:"revalPending"`
+	Applied      *time.Time                `json:"applied"`
+	LastChecked  *time.Time                `json:"lastChecked"`
+	Reasons      []ServerConfigDriftReason `json:"reasons"`
+	Files        []ServerConfigFileDrift   `json:"files"`
+	UnknownFiles []string                  `json:"unknownFiles"`
+}
+
+// ServerConfigDriftResponse is the type of a response from the Traffic Ops
+// API to a request to its servers/config_drift endpoint.
+type ServerConfigDriftResponse struct {
+	Response []ServerConfigDrift `json:"response"`
+	Alerts
+}
@@ -46,6 +46,11 @@ type StatsSummary struct {
 	StatValue       *float64   `json:"statValue"  db:"stat_value"`
 	SummaryTime     time.Time  `json:"summaryTime"  db:"summary_time"`
 	StatDate        *time.Time `json:"statDate"  db:"stat_date"`
+	// StatEndDate is the (exclusive) end of the period summarized by a
+	// statistic that covers more than the single day of its StatDate.
+	StatEndDate *time.Time `json:"statEndDate,omitempty"  db:"stat_end_date"`
+	// TenantName is the Tenant a statistic belongs to, if any.
+	TenantName *string `json:"tenantName,omitempty"  db:"tenant_name"`
 }
 
 func (ss StatsSummary) Validate(tx *sql.Tx) error {
@@ -53,6 +58,9 @@ func (ss StatsSummary) Validate(tx *sql.Tx) error {
 		"statName":  validation.Validate(ss.StatName, validation.Required),
 		"statValue": validation.Validate(ss.StatValue, validation.Required),
 	})
+	if ss.StatEndDate != nil && (ss.StatDate == nil || !ss.StatEndDate.After(*ss.StatDate)) {
+		errs = append(errs, errors.New("statEndDate: must be after statDate"))
+	}
 	return util.JoinErrs(errs)
 }
 
@@ -62,6 +70,7 @@ func (ss *StatsSummary) UnmarshalJSON(data []byte) error {
 	resp := struct {
 		SummaryTime string  `json:"summaryTime"`
 		StatDate    *string `json:"statDate"`
+		StatEndDate *string `json:"statEndDate"`
 		*Alias
 	}{
 		Alias: (*Alias)(ss),
@@ -77,6 +86,13 @@ func (ss *StatsSummary) UnmarshalJSON(data []byte) error {
 		}
 		ss.StatDate = &statDate
 	}
+	if resp.StatEndDate != nil {
+		statEndDate, err := parseTime(*resp.StatEndDate)
+		if err != nil {
+			return errors.New("invalid timestamp given for statEndDate")
+		}
+		ss.StatEndDate = &statEndDate
+	}
 
 	ss.SummaryTime, err = parseTime(resp.SummaryTime)
 	if err != nil {
@@ -102,6 +118,7 @@ func (ss StatsSummary) MarshalJSON() ([]byte, error) {
 	type Alias StatsSummary
 	resp := struct {
 		StatDate    *string `json:"statDate"`
+		StatEndDate *string `json:"statEndDate,omitempty"`
 		SummaryTime string  `json:"summaryTime"`
 		Alias
 	}{
@@ -111,6 +128,9 @@ func (ss StatsSummary) MarshalJSON() ([]byte, error) {
 	if ss.StatDate != nil {
 		resp.StatDate = util.StrPtr(ss.StatDate.Format(dateFormat))
 	}
+	if ss.StatEndDate != nil {
+		resp.StatEndDate = util.StrPtr(ss.StatEndDate.Format(dateFormat))
+	}
 	return json.Marshal(&resp)
 }
 
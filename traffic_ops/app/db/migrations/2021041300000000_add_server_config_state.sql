@@ -0,0 +1,49 @@
+/*
+
+    Licensed under the Apache License, Version 2.0 (the "License");
+    you may not use this file except in compliance with the License.
+    You may obtain a copy of the License at
+
+        http://www.apache.org/licenses/LICENSE-2.0
+
+    Unless required by applicable law or agreed to in writing, software
+    distributed under the License is distributed on an "AS IS" BASIS,
+    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+    See the License for the specific language governing permissions and
+    limitations under the License.
+*/
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE IF NOT EXISTS server_config_state (
+    server bigint NOT NULL,
+    run_mode TEXT NOT NULL,
+    success boolean NOT NULL,
+    failed_stage TEXT NOT NULL DEFAULT '',
+    failed_file TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    rolled_back boolean NOT NULL DEFAULT FALSE,
+    applied timestamp with time zone,
+    last_checked timestamp with time zone DEFAULT now() NOT NULL,
+
+    PRIMARY KEY (server),
+    CONSTRAINT fk_server_config_state_server FOREIGN KEY (server) REFERENCES server(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS server_config_file_state (
+    server bigint NOT NULL,
+    name TEXT NOT NULL,
+    path TEXT NOT NULL DEFAULT '',
+    checksum TEXT NOT NULL,
+
+    PRIMARY KEY (server, name),
+    CONSTRAINT fk_server_config_file_state_server FOREIGN KEY (server) REFERENCES server_config_state(server) ON DELETE CASCADE
+);
+
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS server_config_file_state;
+DROP TABLE IF EXISTS server_config_state;
@@ -0,0 +1,58 @@
+/*
+
+    Licensed under the Apache License, Version 2.0 (the "License");
+    you may not use this file except in compliance with the License.
+    You may obtain a copy of the License at
+
+        http://www.apache.org/licenses/LICENSE-2.0
+
+    Unless required by applicable law or agreed to in writing, software
+    distributed under the License is distributed on an "AS IS" BASIS,
+    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+    See the License for the specific language governing permissions and
+    limitations under the License.
+*/
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE IF NOT EXISTS rollout (
+    id bigserial NOT NULL,
+    cdn_id bigint NOT NULL,
+    topology TEXT,
+    status TEXT NOT NULL DEFAULT 'in_progress',
+    current_wave bigint NOT NULL DEFAULT 1,
+    created_by TEXT NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    last_updated timestamp with time zone DEFAULT now() NOT NULL,
+
+    PRIMARY KEY (id),
+    CONSTRAINT fk_rollout_cdn FOREIGN KEY (cdn_id) REFERENCES cdn(id) ON DELETE CASCADE
+);
+
+-- a CDN may only have one rollout which may still advance
+CREATE UNIQUE INDEX IF NOT EXISTS rollout_cdn_active_idx ON rollout (cdn_id) WHERE status IN ('in_progress', 'paused', 'failed');
+
+CREATE TABLE IF NOT EXISTS rollout_wave (
+    rollout bigint NOT NULL,
+    number bigint NOT NULL,
+    cachegroups TEXT[] NOT NULL DEFAULT '{}',
+    percent bigint,
+    soak_seconds bigint NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'pending',
+    servers bigint[] NOT NULL DEFAULT '{}',
+    started_at timestamp with time zone,
+    soak_started_at timestamp with time zone,
+    completed_at timestamp with time zone,
+    failure_reason TEXT NOT NULL DEFAULT '',
+
+    PRIMARY KEY (rollout, number),
+    CONSTRAINT fk_rollout_wave_rollout FOREIGN KEY (rollout) REFERENCES rollout(id) ON DELETE CASCADE
+);
+
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE IF EXISTS rollout_wave;
+DROP TABLE IF EXISTS rollout;
@@ -0,0 +1,30 @@
+/*
+
+    Licensed under the Apache License, Version 2.0 (the "License");
+    you may not use this file except in compliance with the License.
+    You may obtain a copy of the License at
+
+        http://www.apache.org/licenses/LICENSE-2.0
+
+    Unless required by applicable law or agreed to in writing, software
+    distributed under the License is distributed on an "AS IS" BASIS,
+    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+    See the License for the specific language governing permissions and
+    limitations under the License.
+*/
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- billing statistics summarize a period from stat_date up to stat_end_date, for a tenant's delivery services
+ALTER TABLE stats_summary ADD COLUMN IF NOT EXISTS stat_end_date date;
+ALTER TABLE stats_summary ADD COLUMN IF NOT EXISTS tenant_name text;
+
+CREATE INDEX IF NOT EXISTS stats_summary_stat_name_stat_date_idx ON stats_summary (stat_name, stat_date);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX IF EXISTS stats_summary_stat_name_stat_date_idx;
+ALTER TABLE stats_summary DROP COLUMN IF EXISTS tenant_name;
+ALTER TABLE stats_summary DROP COLUMN IF EXISTS stat_end_date;
@@ -0,0 +1,160 @@
+package v4
+
+/*
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+	toclient "github.com/apache/trafficcontrol/traffic_ops/v4-client"
+)
+
+func TestBillingReports(t *testing.T) {
+	WithObjs(t, []TCObj{Tenants, Parameters, Users}, func() {
+		CreateTestBillingReports(t)
+		GetTestBillingReports(t)
+		GetTestBillingReportsTenancy(t)
+	})
+}
+
+var (
+	billingStart       = time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	billingEnd         = time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC)
+	billingSummaryTime = time.Date(2021, time.April, 1, 0, 5, 0, 0, time.UTC)
+)
+
+func testBillingReports() []tc.BillingReport {
+	report := func(ds string, tenant *string, p95 float64) tc.BillingReport {
+		return tc.BillingReport{
+			CDNName:         "billingcdn",
+			DeliveryService: ds,
+			TenantName:      tenant,
+			StartDate:       billingStart,
+			EndDate:         billingEnd,
+			P95Gbps:         util.FloatPtr(p95),
+			PeakGbps:        util.FloatPtr(p95 * 2),
+			TotalBytes:      util.FloatPtr(p95 * 1e12),
+			SummaryTime:     billingSummaryTime,
+		}
+	}
+	return []tc.BillingReport{
+		report("all", nil, 30),
+		report("all", util.StrPtr("tenant1"), 20),
+		report("billing-ds1", util.StrPtr("tenant1"), 20),
+		report("billing-ds4", util.StrPtr("tenant4"), 10),
+	}
+}
+
+func CreateTestBillingReports(t *testing.T) {
+	for _, br := range testBillingReports() {
+		for _, ss := range tc.BillingReportStatsSummaries(br) {
+			if _, _, err := TOSession.CreateSummaryStats(ss); err != nil {
+				t.Errorf("creating billing stats summary %v: %v", *ss.StatName, err)
+			}
+		}
+	}
+}
+
+func billingReportsParams(ds string) url.Values {
+	params := url.Values{}
+	params.Set("cdnName", "billingcdn")
+	params.Set("startDate", billingStart.Format("2006-01-02"))
+	params.Set("endDate", billingEnd.Format("2006-01-02"))
+	if ds != "" {
+		params.Set("deliveryServiceName", ds)
+	}
+	return params
+}
+
+func GetTestBillingReports(t *testing.T) {
+	resp, _, err := TOSession.GetBillingReports(billingReportsParams(""), nil)
+	if err != nil {
+		t.Fatalf("getting billing reports: %v", err)
+	}
+	expected := testBillingReports()
+	if len(resp.Response) != len(expected) {
+		t.Fatalf("expected %v billing reports, actual %v", len(expected), len(resp.Response))
+	}
+	for _, ebr := range expected {
+		found := false
+		for _, br := range resp.Response {
+			if br.DeliveryService != ebr.DeliveryService || (br.TenantName == nil) != (ebr.TenantName == nil) || (br.TenantName != nil && *br.TenantName != *ebr.TenantName) {
+				continue
+			}
+			found = true
+			if br.P95Gbps == nil || *br.P95Gbps != *ebr.P95Gbps || br.PeakGbps == nil || *br.PeakGbps != *ebr.PeakGbps || br.TotalBytes == nil || *br.TotalBytes != *ebr.TotalBytes {
+				t.Errorf("expected billing report %+v, actual %+v", ebr, br)
+			}
+			if !br.StartDate.Equal(billingStart) || !br.EndDate.Equal(billingEnd) {
+				t.Errorf("expected billing period %v - %v, actual %v - %v", billingStart, billingEnd, br.StartDate, br.EndDate)
+			}
+		}
+		if !found {
+			t.Errorf("expected to find billing report of %v in billing reports response", ebr.DeliveryService)
+		}
+	}
+
+	resp, _, err = TOSession.GetBillingReports(billingReportsParams("billing-ds1"), nil)
+	if err != nil {
+		t.Fatalf("getting billing reports of billing-ds1: %v", err)
+	}
+	if len(resp.Response) != 1 || resp.Response[0].DeliveryService != "billing-ds1" {
+		t.Errorf("expected only the billing report of billing-ds1, actual %+v", resp.Response)
+	}
+
+	params := billingReportsParams("")
+	params.Set("startDate", billingEnd.Format("2006-01-02"))
+	params.Del("endDate")
+	resp, _, err = TOSession.GetBillingReports(params, nil)
+	if err != nil {
+		t.Fatalf("getting billing reports after the billing period: %v", err)
+	}
+	if len(resp.Response) != 0 {
+		t.Errorf("expected no billing reports after the billing period, actual %v", len(resp.Response))
+	}
+}
+
+func GetTestBillingReportsTenancy(t *testing.T) {
+	toReqTimeout := time.Second * time.Duration(Config.Default.Session.TimeoutInSecs)
+	tenant4TOClient, _, err := toclient.LoginWithAgent(TOSession.URL, "tenant4user", "pa$$word", true, "to-api-v4-client-tests/tenant4user", true, toReqTimeout)
+	if err != nil {
+		t.Fatalf("failed to log in with tenant4user: %v", err)
+	}
+
+	resp, _, err := tenant4TOClient.GetBillingReports(billingReportsParams(""), nil)
+	if err != nil {
+		t.Fatalf("tenant4user getting billing reports: %v", err)
+	}
+	// tenant4user may see the reports of tenant4, but not those of tenant1, nor the CDN report, which includes the traffic of every tenant
+	if len(resp.Response) != 1 {
+		t.Errorf("expected tenant4user to get 1 billing report, actual %v", len(resp.Response))
+	}
+	for _, br := range resp.Response {
+		if br.TenantName == nil {
+			t.Error("expected tenant4user not to get the billing report of the whole CDN")
+		} else if *br.TenantName != "tenant4" {
+			t.Errorf("expected tenant4user not to get billing reports of tenant %v", *br.TenantName)
+		}
+	}
+
+	ss := tc.BillingReportStatsSummaries(testBillingReports()[2])[0]
+	if _, _, err := tenant4TOClient.CreateSummaryStats(ss); err == nil {
+		t.Error("expected tenant4user not to be able to create billing stats of tenant1, actual no error")
+	}
+}
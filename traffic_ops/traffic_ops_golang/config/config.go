@@ -97,6 +97,10 @@ type ConfigTrafficOpsGolang struct {
 	PluginSharedConfig       map[string]interface{}     `json:"plugin_shared_config"`
 	ProfilingEnabled         bool                       `json:"profiling_enabled"`
 	ProfilingLocation        string                     `json:"profiling_location"`
+	// RolloutAdvanceIntervalSeconds is how often in-progress rollouts are advanced in the background.
+	RolloutAdvanceIntervalSeconds int `json:"rollout_advance_interval_seconds"`
+	// RolloutUpdatingTimeoutSeconds is how long the servers of a rollout wave may take to apply their updates before the wave fails.
+	RolloutUpdatingTimeoutSeconds int `json:"rollout_updating_timeout_seconds"`
 	// Deprecated: use 'port' in traffic_vault_config instead.
 	RiakPort             *uint    `json:"riak_port"`
 	WhitelistedOAuthUrls []string `json:"whitelisted_oauth_urls"`
@@ -215,6 +219,8 @@ func NewFakeConfig() Config {
 
 const DefaultLDAPTimeoutSecs = 60
 const DefaultDBQueryTimeoutSecs = 20
+const DefaultRolloutAdvanceIntervalSecs = 60
+const DefaultRolloutUpdatingTimeoutSecs = 3600
 
 // ErrorLog - critical messages
 func (c Config) ErrorLog() log.LogLocation {
@@ -392,6 +398,12 @@ func ParseConfig(cfg Config) (Config, error) {
 	if cfg.DBQueryTimeoutSeconds == 0 {
 		cfg.DBQueryTimeoutSeconds = DefaultDBQueryTimeoutSecs
 	}
+	if cfg.RolloutAdvanceIntervalSeconds == 0 {
+		cfg.RolloutAdvanceIntervalSeconds = DefaultRolloutAdvanceIntervalSecs
+	}
+	if cfg.RolloutUpdatingTimeoutSeconds == 0 {
+		cfg.RolloutUpdatingTimeoutSeconds = DefaultRolloutUpdatingTimeoutSecs
+	}
 
 	invalidTOURLStr := ""
 	var err error
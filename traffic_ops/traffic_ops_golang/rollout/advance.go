@@ -0,0 +1,626 @@
+package rollout
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/util/monitorhlp"
+
+	"github.com/lib/pq"
+)
+
+// Rollouts are advanced in the background of every Traffic Ops instance, by StartAdvancing, and when they're created or resumed.
+// Each rollout is locked while it's advanced, skipping locked rollouts, so instances never advance the same rollout at once.
+//
+// Traffic Monitor is never requested while a transaction is open: the availability of the cache servers of each CDN with a
+// wave whose soak time has passed is requested first, and the rollouts are advanced with it after. A wave whose soak time
+// passes without its CDN's availability, e.g. because Traffic Monitor failed, keeps soaking until it's advanced again.
+//
+// A wave whose servers haven't all applied their updates within the updating timeout fails, so a server which never checks in,
+// e.g. because it's down, doesn't stall the rollout forever.
+
+// cdnAvailability is whether each cache server is available, according to Traffic Monitor, keyed on CDN name and then host name.
+type cdnAvailability map[tc.CDNName]map[string]bool
+
+// rolloutState is the state of a rollout needed to advance it.
+type rolloutState struct {
+	ID          int
+	CDNID       int
+	CDNName     tc.CDNName
+	Topology    *string
+	Status      tc.RolloutStatus
+	CurrentWave int
+	NumWaves    int
+}
+
+// waveState is the state of a rollout wave needed to advance it.
+type waveState struct {
+	Number        int
+	CacheGroups   []string
+	Percent       *int
+	SoakSeconds   int
+	Status        tc.RolloutWaveStatus
+	ServerIDs     []int64
+	StartedAt     *time.Time
+	SoakStartedAt *time.Time
+	CompletedAt   *time.Time
+	FailureReason string
+}
+
+// rolloutServer is a cache server targeted by a rollout.
+type rolloutServer struct {
+	ID         int64
+	HostName   string
+	CacheGroup string
+}
+
+// waveServerState is the update state of a server in a rollout wave.
+type waveServerState struct {
+	HostName   string
+	UpdPending bool
+	// ConfigStateChecked is when the server last reported its config state, if it ever has.
+	ConfigStateChecked *time.Time
+	ConfigStateSuccess bool
+	ConfigStateError   string
+}
+
+// StartAdvancing advances all in-progress rollouts every interval, in the background, until the process exits.
+// Each transaction is limited to dbTimeout. Waves fail if their servers haven't applied their updates within updatingTimeout.
+func StartAdvancing(db *sql.DB, interval time.Duration, dbTimeout time.Duration, updatingTimeout time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if err := Advance(db, dbTimeout, updatingTimeout); err != nil {
+				log.Errorln("advancing rollouts: " + err.Error())
+			}
+		}
+	}()
+}
+
+// Advance advances all in-progress rollouts.
+// Traffic Monitor is requested for the CDNs of soaked waves before the rollouts are locked, and never while a transaction is open.
+func Advance(db *sql.DB, dbTimeout time.Duration, updatingTimeout time.Duration) error {
+	availability, err := getSoakedAvailability(db, dbTimeout, time.Now())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.New("beginning transaction: " + err.Error())
+	}
+	if err := advanceInProgressRollouts(tx, availability, updatingTimeout); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return errors.New(err.Error() + ", and rolling back: " + rbErr.Error())
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.New("committing transaction: " + err.Error())
+	}
+	return nil
+}
+
+// advanceInProgressRollouts advances all in-progress rollouts which aren't locked, with the given cache server availability.
+// On error, any changes it made are rolled back, and the rest of the transaction may continue.
+func advanceInProgressRollouts(tx *sql.Tx, availability cdnAvailability, updatingTimeout time.Duration) error {
+	return withSavepoint(tx, func() error {
+		rows, err := tx.Query(`
+SELECT id
+FROM rollout
+WHERE status = $1
+FOR UPDATE SKIP LOCKED
+`, tc.RolloutStatusInProgress)
+		if err != nil {
+			return errors.New("querying in-progress rollouts: " + err.Error())
+		}
+		ids, err := scanIDs(rows)
+		if err != nil {
+			return errors.New("scanning in-progress rollouts: " + err.Error())
+		}
+		return advanceRollouts(tx, ids, time.Now(), availability, updatingTimeout)
+	})
+}
+
+// getSoakedAvailability returns the availability of the cache servers of each CDN with an in-progress rollout whose
+// current wave's soak time has passed as of now. The transaction it reads the CDNs and monitors in is closed before
+// Traffic Monitor is requested. CDNs whose availability can't be requested are logged and omitted.
+func getSoakedAvailability(db *sql.DB, dbTimeout time.Duration, now time.Time) (cdnAvailability, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, errors.New("beginning transaction: " + err.Error())
+	}
+	cdns, monitors, client, err := getSoakedMonitors(tx, now)
+	if rbErr := tx.Rollback(); rbErr != nil && err == nil {
+		err = errors.New("closing transaction: " + rbErr.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	availability := cdnAvailability{}
+	for _, cdn := range cdns {
+		cdnAvail, err := getTMAvailability(monitors, client, cdn)
+		if err != nil {
+			log.Warnln("rollouts soaked on CDN '" + string(cdn) + "' can't be advanced: " + err.Error())
+			continue
+		}
+		availability[cdn] = cdnAvail
+	}
+	return availability, nil
+}
+
+// getSoakedMonitors returns the CDNs with an in-progress rollout whose current wave's soak time has passed as of now,
+// and the monitors and client to request their availability with, if there are any.
+func getSoakedMonitors(tx *sql.Tx, now time.Time) ([]tc.CDNName, map[tc.CDNName]string, *http.Client, error) {
+	rows, err := tx.Query(`
+SELECT DISTINCT c.name
+FROM rollout r
+JOIN cdn c ON c.id = r.cdn_id
+JOIN rollout_wave w ON w.rollout = r.id AND w.number = r.current_wave
+WHERE r.status = $1
+AND w.status = $2
+AND w.soak_started_at + make_interval(secs => w.soak_seconds) <= $3
+`, tc.RolloutStatusInProgress, tc.RolloutWaveStatusSoaking, now)
+	if err != nil {
+		return nil, nil, nil, errors.New("querying soaked rollout CDNs: " + err.Error())
+	}
+	defer log.Close(rows, "getSoakedMonitors(): unable to close db connection")
+	cdns := []tc.CDNName{}
+	for rows.Next() {
+		cdn := tc.CDNName("")
+		if err := rows.Scan(&cdn); err != nil {
+			return nil, nil, nil, errors.New("scanning soaked rollout CDNs: " + err.Error())
+		}
+		cdns = append(cdns, cdn)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, errors.New("scanning soaked rollout CDNs: " + err.Error())
+	}
+	if len(cdns) == 0 {
+		return cdns, nil, nil, nil
+	}
+
+	monitors, err := monitorhlp.GetURLs(tx)
+	if err != nil {
+		return nil, nil, nil, errors.New("getting monitors: " + err.Error())
+	}
+	client, err := monitorhlp.GetClient(tx)
+	if err != nil {
+		return nil, nil, nil, errors.New("getting monitor client: " + err.Error())
+	}
+	return cdns, monitors, client, nil
+}
+
+// withSavepoint calls f in a savepoint of tx, which is rolled back if f returns an error.
+func withSavepoint(tx *sql.Tx, f func() error) error {
+	if _, err := tx.Exec(`SAVEPOINT rollout_advance`); err != nil {
+		return errors.New("creating savepoint: " + err.Error())
+	}
+	if err := f(); err != nil {
+		if _, rbErr := tx.Exec(`ROLLBACK TO SAVEPOINT rollout_advance`); rbErr != nil {
+			return errors.New(err.Error() + ", and rolling back to savepoint: " + rbErr.Error())
+		}
+		return err
+	}
+	if _, err := tx.Exec(`RELEASE SAVEPOINT rollout_advance`); err != nil {
+		return errors.New("releasing savepoint: " + err.Error())
+	}
+	return nil
+}
+
+// scanIDs returns the IDs in rows, and closes them.
+func scanIDs(rows *sql.Rows) ([]int, error) {
+	defer log.Close(rows, "scanIDs(): unable to close db connection")
+	ids := []int{}
+	for rows.Next() {
+		id := 0
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// advanceRollouts advances each of the given rollouts, which must already be locked.
+func advanceRollouts(tx *sql.Tx, ids []int, now time.Time, availability cdnAvailability, updatingTimeout time.Duration) error {
+	for _, id := range ids {
+		ro, err := getRolloutState(tx, id)
+		if err != nil {
+			return errors.New("getting rollout " + strconv.Itoa(id) + ": " + err.Error())
+		}
+		if err := advanceRollout(tx, ro, now, availability, updatingTimeout); err != nil {
+			return errors.New("advancing rollout " + strconv.Itoa(id) + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// advanceRollout advances the rollout through as many wave states as it can, until it's waiting on cache servers or a soak time,
+// or it fails or completes. The rollout must already be locked.
+// A wave whose soak time has passed is only evaluated if availability has its CDN; availability may be nil.
+// A wave fails if its servers haven't applied their updates within updatingTimeout of it starting.
+func advanceRollout(tx *sql.Tx, ro rolloutState, now time.Time, availability cdnAvailability, updatingTimeout time.Duration) error {
+	for ro.Status == tc.RolloutStatusInProgress {
+		wave, err := getWaveState(tx, ro.ID, ro.CurrentWave)
+		if err != nil {
+			return errors.New("getting wave " + strconv.Itoa(ro.CurrentWave) + ": " + err.Error())
+		}
+
+		switch wave.Status {
+		case tc.RolloutWaveStatusPending:
+			if err := startWave(tx, ro, &wave, now); err != nil {
+				return errors.New("starting wave " + strconv.Itoa(wave.Number) + ": " + err.Error())
+			}
+			if wave.Status == tc.RolloutWaveStatusSucceeded {
+				ro = completeWave(ro)
+			}
+		case tc.RolloutWaveStatusUpdating:
+			states, err := getWaveServerStates(tx, wave.ServerIDs)
+			if err != nil {
+				return errors.New("getting wave " + strconv.Itoa(wave.Number) + " servers: " + err.Error())
+			}
+			status, reason := evaluateUpdatingWave(*wave.StartedAt, now, updatingTimeout, states)
+			if status == tc.RolloutWaveStatusUpdating {
+				return nil
+			}
+			wave.Status = status
+			wave.FailureReason = reason
+			if status == tc.RolloutWaveStatusSoaking {
+				wave.SoakStartedAt = &now
+			} else {
+				wave.CompletedAt = &now
+				ro.Status = tc.RolloutStatusFailed
+			}
+		case tc.RolloutWaveStatusSoaking:
+			if now.Before(wave.SoakStartedAt.Add(time.Duration(wave.SoakSeconds) * time.Second)) {
+				return nil
+			}
+			cdnAvail, ok := availability[ro.CDNName]
+			if !ok {
+				return nil // Traffic Monitor wasn't requested for this CDN; the wave is evaluated when it's advanced again.
+			}
+			states, err := getWaveServerStates(tx, wave.ServerIDs)
+			if err != nil {
+				return errors.New("getting wave " + strconv.Itoa(wave.Number) + " servers: " + err.Error())
+			}
+			wave.Status, wave.FailureReason = evaluateSoakedWave(states, cdnAvail)
+			wave.CompletedAt = &now
+			if wave.Status == tc.RolloutWaveStatusFailed {
+				ro.Status = tc.RolloutStatusFailed
+			} else {
+				ro = completeWave(ro)
+			}
+		default:
+			return errors.New("in-progress rollout has wave " + strconv.Itoa(wave.Number) + " with status " + string(wave.Status))
+		}
+
+		if err := updateWaveState(tx, ro.ID, wave); err != nil {
+			return errors.New("updating wave " + strconv.Itoa(wave.Number) + ": " + err.Error())
+		}
+		if err := updateRolloutState(tx, ro); err != nil {
+			return errors.New("updating rollout: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// completeWave returns the rollout after its current wave succeeded: on its next wave, or completed if there are no more.
+func completeWave(ro rolloutState) rolloutState {
+	if ro.CurrentWave >= ro.NumWaves {
+		ro.Status = tc.RolloutStatusCompleted
+	} else {
+		ro.CurrentWave++
+	}
+	return ro
+}
+
+// startWave chooses the servers of the wave and queues their updates. A wave with no servers succeeds immediately.
+func startWave(tx *sql.Tx, ro rolloutState, wave *waveState, now time.Time) error {
+	targets, err := getTargetServers(tx, ro.CDNID, ro.Topology)
+	if err != nil {
+		return errors.New("getting rollout servers: " + err.Error())
+	}
+	prior, err := getPriorWaveServers(tx, ro.ID, wave.Number)
+	if err != nil {
+		return errors.New("getting servers of earlier waves: " + err.Error())
+	}
+
+	wave.ServerIDs = []int64{}
+	for _, sv := range selectWaveServers(wave.CacheGroups, wave.Percent, targets, prior, wave.Number == ro.NumWaves) {
+		wave.ServerIDs = append(wave.ServerIDs, sv.ID)
+	}
+	wave.StartedAt = &now
+	if len(wave.ServerIDs) == 0 {
+		wave.Status = tc.RolloutWaveStatusSucceeded
+		wave.CompletedAt = &now
+		return nil
+	}
+	if _, err := tx.Exec(`UPDATE server SET upd_pending = TRUE WHERE id = ANY($1::bigint[])`, pq.Array(wave.ServerIDs)); err != nil {
+		return errors.New("queueing updates: " + err.Error())
+	}
+	wave.Status = tc.RolloutWaveStatusUpdating
+	return nil
+}
+
+// selectWaveServers returns the servers of a wave, from the rollout's target servers sorted by ID, excluding servers of earlier waves.
+//
+// A wave of Cache Groups is the remaining servers in those Cache Groups. A wave of a percent is enough of the remaining servers
+// that the cumulative percent of the targets in this and earlier waves is at least the percent. The last wave is always all the
+// remaining servers, so servers not in any wave, e.g. ones added during the rollout, are still updated.
+func selectWaveServers(cacheGroups []string, percent *int, targets []rolloutServer, prior map[int64]struct{}, isLast bool) []rolloutServer {
+	remaining := []rolloutServer{}
+	priorTargets := 0
+	for _, sv := range targets {
+		if _, ok := prior[sv.ID]; ok {
+			priorTargets++
+			continue
+		}
+		remaining = append(remaining, sv)
+	}
+	if isLast {
+		return remaining
+	}
+
+	if percent != nil {
+		count := int(math.Ceil(float64(*percent)*float64(len(targets))/100)) - priorTargets
+		if count <= 0 {
+			return []rolloutServer{}
+		}
+		if count > len(remaining) {
+			count = len(remaining)
+		}
+		return remaining[:count]
+	}
+
+	cgs := map[string]struct{}{}
+	for _, cg := range cacheGroups {
+		cgs[cg] = struct{}{}
+	}
+	servers := []rolloutServer{}
+	for _, sv := range remaining {
+		if _, ok := cgs[sv.CacheGroup]; ok {
+			servers = append(servers, sv)
+		}
+	}
+	return servers
+}
+
+// evaluateUpdatingWave returns the status of a wave whose servers were queued at startedAt, as of now, and why if it failed.
+//
+// The wave failed if any server reported failing to apply its config since the wave started, or if any server still hasn't
+// applied its update after updatingTimeout. Otherwise, it's soaking if every server applied its update, else it's still updating.
+func evaluateUpdatingWave(startedAt time.Time, now time.Time, updatingTimeout time.Duration, servers []waveServerState) (tc.RolloutWaveStatus, string) {
+	failed := []string{}
+	pending := []string{}
+	for _, sv := range servers {
+		if sv.ConfigStateChecked != nil && !sv.ConfigStateChecked.Before(startedAt) && !sv.ConfigStateSuccess {
+			failed = append(failed, sv.HostName+" ("+sv.ConfigStateError+")")
+		}
+		if sv.UpdPending {
+			pending = append(pending, sv.HostName)
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return tc.RolloutWaveStatusFailed, "servers failed to apply config: " + strings.Join(failed, ", ")
+	}
+	if len(pending) == 0 {
+		return tc.RolloutWaveStatusSoaking, ""
+	}
+	if now.Before(startedAt.Add(updatingTimeout)) {
+		return tc.RolloutWaveStatusUpdating, ""
+	}
+	sort.Strings(pending)
+	return tc.RolloutWaveStatusFailed, "servers didn't apply their updates within " + updatingTimeout.String() + ": " + strings.Join(pending, ", ")
+}
+
+// evaluateSoakedWave returns the status of a wave whose soak time has passed, and why if it failed.
+//
+// The wave failed if Traffic Monitor reports any of its servers unavailable, or if any was queued again during the soak,
+// e.g. because another update was queued. Servers Traffic Monitor doesn't monitor, e.g. because they're OFFLINE, are ignored.
+func evaluateSoakedWave(servers []waveServerState, availability map[string]bool) (tc.RolloutWaveStatus, string) {
+	unavailable := []string{}
+	pending := []string{}
+	for _, sv := range servers {
+		if available, ok := availability[sv.HostName]; ok && !available {
+			unavailable = append(unavailable, sv.HostName)
+		}
+		if sv.UpdPending {
+			pending = append(pending, sv.HostName)
+		}
+	}
+	reasons := []string{}
+	if len(unavailable) > 0 {
+		sort.Strings(unavailable)
+		reasons = append(reasons, "servers unavailable after soaking: "+strings.Join(unavailable, ", "))
+	}
+	if len(pending) > 0 {
+		sort.Strings(pending)
+		reasons = append(reasons, "servers queued for updates again while soaking: "+strings.Join(pending, ", "))
+	}
+	if len(reasons) > 0 {
+		return tc.RolloutWaveStatusFailed, strings.Join(reasons, "; ")
+	}
+	return tc.RolloutWaveStatusSucceeded, ""
+}
+
+// getTMAvailability returns whether each cache server of the CDN is available, from the CRStates of an online Traffic Monitor.
+// It must not be called while a transaction is open.
+func getTMAvailability(monitors map[tc.CDNName]string, client *http.Client, cdn tc.CDNName) (map[string]bool, error) {
+	monitorFQDN, ok := monitors[cdn]
+	if !ok {
+		return nil, errors.New("no online monitor for CDN '" + string(cdn) + "'")
+	}
+	crStates, err := monitorhlp.GetCRStates(monitorFQDN, client)
+	if err != nil {
+		return nil, errors.New("getting CRStates for CDN '" + string(cdn) + "': " + err.Error())
+	}
+	availability := map[string]bool{}
+	for cacheName, avail := range crStates.Caches {
+		availability[string(cacheName)] = avail.IsAvailable
+	}
+	return availability, nil
+}
+
+// getRolloutState returns the state of the rollout needed to advance it.
+func getRolloutState(tx *sql.Tx, id int) (rolloutState, error) {
+	ro := rolloutState{ID: id}
+	err := tx.QueryRow(`
+SELECT r.cdn_id, c.name, r.topology, r.status, r.current_wave, (SELECT COUNT(*) FROM rollout_wave w WHERE w.rollout = r.id)
+FROM rollout r
+JOIN cdn c ON c.id = r.cdn_id
+WHERE r.id = $1
+`, id).Scan(&ro.CDNID, &ro.CDNName, &ro.Topology, &ro.Status, &ro.CurrentWave, &ro.NumWaves)
+	return ro, err
+}
+
+// getWaveState returns the state of the rollout's wave needed to advance it.
+func getWaveState(tx *sql.Tx, rolloutID int, number int) (waveState, error) {
+	wave := waveState{Number: number}
+	cacheGroups := pq.StringArray{}
+	serverIDs := pq.Int64Array{}
+	percent := sql.NullInt64{}
+	err := tx.QueryRow(`
+SELECT cachegroups, percent, soak_seconds, status, servers, started_at, soak_started_at, completed_at, failure_reason
+FROM rollout_wave
+WHERE rollout = $1
+AND number = $2
+`, rolloutID, number).Scan(&cacheGroups, &percent, &wave.SoakSeconds, &wave.Status, &serverIDs, &wave.StartedAt, &wave.SoakStartedAt, &wave.CompletedAt, &wave.FailureReason)
+	if err != nil {
+		return waveState{}, err
+	}
+	wave.CacheGroups = cacheGroups
+	wave.ServerIDs = serverIDs
+	if percent.Valid {
+		p := int(percent.Int64)
+		wave.Percent = &p
+	}
+	return wave, nil
+}
+
+// updateWaveState writes the state of the rollout's wave.
+func updateWaveState(tx *sql.Tx, rolloutID int, wave waveState) error {
+	_, err := tx.Exec(`
+UPDATE rollout_wave SET
+  status = $1,
+  servers = $2,
+  started_at = $3,
+  soak_started_at = $4,
+  completed_at = $5,
+  failure_reason = $6
+WHERE rollout = $7
+AND number = $8
+`, wave.Status, pq.Array(wave.ServerIDs), wave.StartedAt, wave.SoakStartedAt, wave.CompletedAt, wave.FailureReason, rolloutID, wave.Number)
+	return err
+}
+
+// updateRolloutState writes the status and current wave of the rollout.
+func updateRolloutState(tx *sql.Tx, ro rolloutState) error {
+	_, err := tx.Exec(`UPDATE rollout SET status = $1, current_wave = $2, last_updated = now() WHERE id = $3`, ro.Status, ro.CurrentWave, ro.ID)
+	return err
+}
+
+// getTargetServers returns the REPORTED and ONLINE cache servers of the CDN, and of the Topology if it isn't nil, sorted by ID.
+// Servers with other statuses, e.g. OFFLINE or ADMIN_DOWN, don't apply updates, so they'd never finish updating.
+func getTargetServers(tx *sql.Tx, cdnID int, topology *string) ([]rolloutServer, error) {
+	rows, err := tx.Query(`
+SELECT s.id, s.host_name, c.name
+FROM server s
+JOIN cachegroup c ON c.id = s.cachegroup
+JOIN type t ON t.id = s.type
+JOIN status st ON st.id = s.status
+WHERE s.cdn_id = $1
+AND (t.name LIKE $2 OR t.name LIKE $3)
+AND st.name = ANY($5::text[])
+AND ($4::text IS NULL OR c.name IN (SELECT tc.cachegroup FROM topology_cachegroup tc WHERE tc.topology = $4::text))
+ORDER BY s.id
+`, cdnID, tc.EdgeTypePrefix+"%", tc.MidTypePrefix+"%", topology, pq.Array([]string{string(tc.CacheStatusReported), string(tc.CacheStatusOnline)}))
+	if err != nil {
+		return nil, errors.New("querying: " + err.Error())
+	}
+	defer log.Close(rows, "getTargetServers(): unable to close db connection")
+	servers := []rolloutServer{}
+	for rows.Next() {
+		sv := rolloutServer{}
+		if err := rows.Scan(&sv.ID, &sv.HostName, &sv.CacheGroup); err != nil {
+			return nil, errors.New("scanning: " + err.Error())
+		}
+		servers = append(servers, sv)
+	}
+	return servers, rows.Err()
+}
+
+// getPriorWaveServers returns the IDs of the servers of the rollout's waves before the given wave.
+func getPriorWaveServers(tx *sql.Tx, rolloutID int, number int) (map[int64]struct{}, error) {
+	rows, err := tx.Query(`SELECT UNNEST(servers) FROM rollout_wave WHERE rollout = $1 AND number < $2`, rolloutID, number)
+	if err != nil {
+		return nil, errors.New("querying: " + err.Error())
+	}
+	defer log.Close(rows, "getPriorWaveServers(): unable to close db connection")
+	ids := map[int64]struct{}{}
+	for rows.Next() {
+		id := int64(0)
+		if err := rows.Scan(&id); err != nil {
+			return nil, errors.New("scanning: " + err.Error())
+		}
+		ids[id] = struct{}{}
+	}
+	return ids, rows.Err()
+}
+
+// getWaveServerStates returns the update state of the given servers. Servers which were deleted are omitted.
+func getWaveServerStates(tx *sql.Tx, ids []int64) ([]waveServerState, error) {
+	rows, err := tx.Query(`
+SELECT s.host_name, s.upd_pending, cs.last_checked, COALESCE(cs.success, FALSE), COALESCE(cs.error, '')
+FROM server s
+LEFT JOIN server_config_state cs ON cs.server = s.id
+WHERE s.id = ANY($1::bigint[])
+ORDER BY s.host_name
+`, pq.Array(ids))
+	if err != nil {
+		return nil, errors.New("querying: " + err.Error())
+	}
+	defer log.Close(rows, "getWaveServerStates(): unable to close db connection")
+	states := []waveServerState{}
+	for rows.Next() {
+		st := waveServerState{}
+		if err := rows.Scan(&st.HostName, &st.UpdPending, &st.ConfigStateChecked, &st.ConfigStateSuccess, &st.ConfigStateError); err != nil {
+			return nil, errors.New("scanning: " + err.Error())
+		}
+		states = append(states, st)
+	}
+	return states, rows.Err()
+}
@@ -0,0 +1,236 @@
+package rollout
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func serverIDs(servers []rolloutServer) []int64 {
+	ids := []int64{}
+	for _, sv := range servers {
+		ids = append(ids, sv.ID)
+	}
+	return ids
+}
+
+func TestSelectWaveServers(t *testing.T) {
+	targets := []rolloutServer{}
+	for i := int64(1); i <= 10; i++ {
+		cg := "cg-a"
+		if i > 5 {
+			cg = "cg-b"
+		}
+		targets = append(targets, rolloutServer{ID: i, CacheGroup: cg})
+	}
+	ten := 10
+	fifty := 50
+	fiftyFive := 55
+
+	if ids := serverIDs(selectWaveServers(nil, &ten, targets, map[int64]struct{}{}, false)); !reflect.DeepEqual(ids, []int64{1}) {
+		t.Errorf("expected 10%% wave to be the first server, actual %v", ids)
+	}
+
+	prior := map[int64]struct{}{1: {}}
+	if ids := serverIDs(selectWaveServers(nil, &fiftyFive, targets, prior, false)); !reflect.DeepEqual(ids, []int64{2, 3, 4, 5, 6}) {
+		t.Errorf("expected cumulative 55%% wave to round up to the next 5 servers, actual %v", ids)
+	}
+
+	prior = map[int64]struct{}{1: {}, 2: {}, 3: {}, 4: {}, 5: {}, 6: {}}
+	if ids := serverIDs(selectWaveServers(nil, &fifty, targets, prior, false)); len(ids) != 0 {
+		t.Errorf("expected 50%% wave after 60%% to be empty, actual %v", ids)
+	}
+
+	prior = map[int64]struct{}{1: {}, 6: {}}
+	if ids := serverIDs(selectWaveServers([]string{"cg-b"}, nil, targets, prior, false)); !reflect.DeepEqual(ids, []int64{7, 8, 9, 10}) {
+		t.Errorf("expected cachegroup wave to be its servers not in earlier waves, actual %v", ids)
+	}
+
+	if ids := serverIDs(selectWaveServers([]string{"cg-b"}, nil, targets, prior, true)); !reflect.DeepEqual(ids, []int64{2, 3, 4, 5, 7, 8, 9, 10}) {
+		t.Errorf("expected last wave to be all servers not in earlier waves, actual %v", ids)
+	}
+}
+
+func TestEvaluateUpdatingWave(t *testing.T) {
+	started := time.Now()
+	before := started.Add(-time.Minute)
+	after := started.Add(time.Minute)
+
+	servers := []waveServerState{
+		{HostName: "a", UpdPending: false, ConfigStateChecked: &after, ConfigStateSuccess: true},
+		{HostName: "b", UpdPending: true, ConfigStateChecked: &before, ConfigStateSuccess: false, ConfigStateError: "old failure"},
+		{HostName: "c", UpdPending: true},
+	}
+	if status, _ := evaluateUpdatingWave(started, after, time.Hour, servers); status != tc.RolloutWaveStatusUpdating {
+		t.Errorf("expected wave with pending servers and only failures before it started to be updating, actual %v", status)
+	}
+
+	status, reason := evaluateUpdatingWave(started, started.Add(time.Hour), time.Hour, servers)
+	if status != tc.RolloutWaveStatusFailed {
+		t.Errorf("expected wave with pending servers after the updating timeout to be failed, actual %v", status)
+	}
+	if expected := "servers didn't apply their updates within 1h0m0s: b, c"; reason != expected {
+		t.Errorf("expected reason '%v', actual '%v'", expected, reason)
+	}
+
+	servers[1].UpdPending = false
+	servers[2].UpdPending = false
+	if status, _ := evaluateUpdatingWave(started, started.Add(time.Hour), time.Hour, servers); status != tc.RolloutWaveStatusSoaking {
+		t.Errorf("expected wave with no pending servers to be soaking, actual %v", status)
+	}
+
+	servers[2].ConfigStateChecked = &after
+	servers[2].ConfigStateError = "reload failed"
+	status, reason = evaluateUpdatingWave(started, after, time.Hour, servers)
+	if status != tc.RolloutWaveStatusFailed {
+		t.Errorf("expected wave with a server which failed since it started to be failed, actual %v", status)
+	}
+	if expected := "servers failed to apply config: c (reload failed)"; reason != expected {
+		t.Errorf("expected reason '%v', actual '%v'", expected, reason)
+	}
+}
+
+func TestEvaluateSoakedWave(t *testing.T) {
+	servers := []waveServerState{{HostName: "a"}, {HostName: "b"}, {HostName: "offline"}}
+	availability := map[string]bool{"a": true, "b": true, "other": false}
+	if status, reason := evaluateSoakedWave(servers, availability); status != tc.RolloutWaveStatusSucceeded {
+		t.Errorf("expected wave with available and unmonitored servers to succeed, actual %v: %v", status, reason)
+	}
+
+	availability["b"] = false
+	servers[0].UpdPending = true
+	status, reason := evaluateSoakedWave(servers, availability)
+	if status != tc.RolloutWaveStatusFailed {
+		t.Errorf("expected wave with an unavailable server to fail, actual %v", status)
+	}
+	if expected := "servers unavailable after soaking: b; servers queued for updates again while soaking: a"; reason != expected {
+		t.Errorf("expected reason '%v', actual '%v'", expected, reason)
+	}
+}
+
+func TestAdvanceRolloutSoaked(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer mockDB.Close()
+
+	now := time.Now()
+	started := now.Add(-time.Hour)
+	soakStarted := now.Add(-time.Minute)
+	waveCols := []string{"cachegroups", "percent", "soak_seconds", "status", "servers", "started_at", "soak_started_at", "completed_at", "failure_reason"}
+	waveRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows(waveCols).AddRow("{}", 100, 30, string(tc.RolloutWaveStatusSoaking), "{1}", started, soakStarted, nil, "")
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT cachegroups").WillReturnRows(waveRows())
+	mock.ExpectQuery("SELECT cachegroups").WillReturnRows(waveRows())
+	mock.ExpectQuery("FROM server s").WillReturnRows(sqlmock.NewRows([]string{"host_name", "upd_pending", "last_checked", "success", "error"}).AddRow("a", false, started, true, ""))
+	mock.ExpectExec("UPDATE rollout_wave").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE rollout SET").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	tx, err := mockDB.Begin()
+	if err != nil {
+		t.Fatalf("creating transaction: %v", err)
+	}
+	ro := rolloutState{ID: 1, CDNID: 1, CDNName: "mycdn", Status: tc.RolloutStatusInProgress, CurrentWave: 1, NumWaves: 1}
+
+	// without the CDN's availability, the soaked wave waits, without Traffic Monitor being requested
+	if err := advanceRollout(tx, ro, now, nil, time.Hour); err != nil {
+		t.Errorf("advancing soaked rollout without availability: expected nil error, actual %v", err)
+	}
+	if err := advanceRollout(tx, ro, now, cdnAvailability{"mycdn": {"a": true}}, time.Hour); err != nil {
+		t.Errorf("advancing soaked rollout: expected nil error, actual %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("committing transaction: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expected the rollout to wait without availability, and complete with it: %v", err)
+	}
+}
+
+func TestActionAllowed(t *testing.T) {
+	allowed := map[tc.RolloutAction][]tc.RolloutStatus{
+		tc.RolloutActionPause:    {tc.RolloutStatusInProgress},
+		tc.RolloutActionResume:   {tc.RolloutStatusPaused, tc.RolloutStatusFailed},
+		tc.RolloutActionAbort:    {tc.RolloutStatusInProgress, tc.RolloutStatusPaused, tc.RolloutStatusFailed},
+		tc.RolloutActionRollback: {tc.RolloutStatusInProgress, tc.RolloutStatusPaused, tc.RolloutStatusFailed, tc.RolloutStatusAborted},
+	}
+	statuses := []tc.RolloutStatus{
+		tc.RolloutStatusInProgress,
+		tc.RolloutStatusPaused,
+		tc.RolloutStatusFailed,
+		tc.RolloutStatusCompleted,
+		tc.RolloutStatusAborted,
+		tc.RolloutStatusRolledBack,
+	}
+	for action, allowedStatuses := range allowed {
+		for _, status := range statuses {
+			expected := false
+			for _, allowedStatus := range allowedStatuses {
+				expected = expected || status == allowedStatus
+			}
+			if actual := actionAllowed(action, status); actual != expected {
+				t.Errorf("expected %v of a %v rollout allowed %v, actual %v", action, status, expected, actual)
+			}
+		}
+	}
+}
+
+func TestGetTargetServers(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer mockDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM server s").
+		WithArgs(1, tc.EdgeTypePrefix+"%", tc.MidTypePrefix+"%", sqlmock.AnyArg(), `{"REPORTED","ONLINE"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "host_name", "name"}).AddRow(1, "a", "cg-a"))
+	mock.ExpectCommit()
+
+	tx, err := mockDB.Begin()
+	if err != nil {
+		t.Fatalf("creating transaction: %v", err)
+	}
+	servers, err := getTargetServers(tx, 1, nil)
+	if err != nil {
+		t.Errorf("expected nil error, actual %v", err)
+	}
+	if len(servers) != 1 || servers[0].HostName != "a" || servers[0].CacheGroup != "cg-a" {
+		t.Errorf("expected server a in cg-a, actual %+v", servers)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("committing transaction: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expected only REPORTED and ONLINE servers to be targeted: %v", err)
+	}
+}
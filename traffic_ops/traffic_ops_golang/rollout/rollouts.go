@@ -0,0 +1,490 @@
+// Package rollout implements the rollouts endpoints, which queue updates on the cache servers of a CDN in ordered waves.
+package rollout
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/dbhelpers"
+
+	"github.com/lib/pq"
+)
+
+// CDNQueryParam is the query parameter of the CDN name to limit rollouts to.
+const CDNQueryParam = "cdn"
+
+// StatusQueryParam is the query parameter of the status to limit rollouts to.
+const StatusQueryParam = "status"
+
+// GetHandler is the handler for GET requests to rollouts.
+func GetHandler(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, nil, nil)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	rollouts, err := getRollouts(inf.Tx.Tx, nil, inf.Params[CDNQueryParam], inf.Params[StatusQueryParam])
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting rollouts: %v", err))
+		return
+	}
+	api.WriteResp(w, r, rollouts)
+}
+
+// GetIDHandler is the handler for GET requests to rollouts/{id}.
+func GetIDHandler(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, []string{"id"}, []string{"id"})
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	id := inf.IntParams["id"]
+	rollout, ok, err := getRollout(inf.Tx.Tx, id)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting rollout: %v", err))
+		return
+	} else if !ok {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusNotFound, fmt.Errorf("no rollout with id '%v' found", id), nil)
+		return
+	}
+	api.WriteResp(w, r, rollout)
+}
+
+// CreateHandler is the handler for POST requests to rollouts.
+// It creates the rollout, and starts its first wave.
+func CreateHandler(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, nil, nil)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+	tx := inf.Tx.Tx
+
+	req := tc.RolloutRequest{}
+	if err := api.Parse(r.Body, tx, &req); err != nil {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, err, nil)
+		return
+	}
+
+	cdnName, ok, err := dbhelpers.GetCDNNameFromID(tx, int64(req.CDNID))
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("getting CDN name: %v", err))
+		return
+	} else if !ok {
+		api.HandleErr(w, r, tx, http.StatusNotFound, fmt.Errorf("no CDN with id '%v' found", req.CDNID), nil)
+		return
+	}
+	if req.Topology != nil {
+		if ok, err := dbhelpers.TopologyExists(tx, *req.Topology); err != nil {
+			api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("checking topology existence: %v", err))
+			return
+		} else if !ok {
+			api.HandleErr(w, r, tx, http.StatusNotFound, fmt.Errorf("no topology named '%v' found", *req.Topology), nil)
+			return
+		}
+	}
+	if missing, err := getMissingCacheGroups(tx, req.Waves); err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("checking cachegroup existence: %v", err))
+		return
+	} else if len(missing) > 0 {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, errors.New("no cachegroups named "+strings.Join(missing, ", ")+" found"), nil)
+		return
+	}
+
+	if activeID, ok, err := getActiveRolloutID(tx, req.CDNID); err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("checking for active rollouts: %v", err))
+		return
+	} else if ok {
+		api.HandleErr(w, r, tx, http.StatusConflict, fmt.Errorf("CDN '%v' already has rollout %v which is not completed, aborted, or rolled back", cdnName, activeID), nil)
+		return
+	}
+
+	id, err := insertRollout(tx, req, inf.User.UserName)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("inserting rollout: %v", err))
+		return
+	}
+	ro, err := getRolloutState(tx, id)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("getting rollout: %v", err))
+		return
+	}
+	if err := advanceRollout(tx, ro, time.Now(), nil, time.Duration(inf.Config.RolloutUpdatingTimeoutSeconds)*time.Second); err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("starting rollout: %v", err))
+		return
+	}
+
+	rollout, _, err := getRollout(tx, id)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("getting rollout: %v", err))
+		return
+	}
+
+	msg := "ROLLOUT: " + strconv.Itoa(id) + ", CDN: " + string(cdnName) + ", ACTION: Created rollout with " + strconv.Itoa(len(req.Waves)) + " waves"
+	api.CreateChangeLogRawTx(api.ApiChange, msg, inf.User, tx)
+	api.WriteRespAlertObj(w, r, tc.SuccessLevel, "Rollout was created.", rollout)
+}
+
+// ActionHandler is the handler for POST requests to rollouts/{id}/action, which pause, resume, abort, or roll back a rollout.
+func ActionHandler(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, []string{"id"}, []string{"id"})
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+	tx := inf.Tx.Tx
+
+	req := tc.RolloutActionRequest{}
+	if err := api.Parse(r.Body, tx, &req); err != nil {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, err, nil)
+		return
+	}
+
+	id := inf.IntParams["id"]
+	status := tc.RolloutStatus("")
+	if err := tx.QueryRow(`SELECT status FROM rollout WHERE id = $1 FOR UPDATE`, id).Scan(&status); err != nil {
+		if err == sql.ErrNoRows {
+			api.HandleErr(w, r, tx, http.StatusNotFound, fmt.Errorf("no rollout with id '%v' found", id), nil)
+			return
+		}
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("locking rollout: %v", err))
+		return
+	}
+	if !actionAllowed(req.Action, status) {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, fmt.Errorf("cannot %v a rollout which is %v", req.Action, status), nil)
+		return
+	}
+
+	ro, err := getRolloutState(tx, id)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("getting rollout: %v", err))
+		return
+	}
+	if err := doAction(tx, ro, req.Action, time.Now(), time.Duration(inf.Config.RolloutUpdatingTimeoutSeconds)*time.Second); err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("%v rollout: %v", req.Action, err))
+		return
+	}
+
+	rollout, _, err := getRollout(tx, id)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, fmt.Errorf("getting rollout: %v", err))
+		return
+	}
+
+	msg := "ROLLOUT: " + strconv.Itoa(id) + ", CDN: " + rollout.CDNName + ", ACTION: " + string(req.Action)
+	api.CreateChangeLogRawTx(api.ApiChange, msg, inf.User, tx)
+	api.WriteRespAlertObj(w, r, tc.SuccessLevel, "Rollout action '"+string(req.Action)+"' was performed.", rollout)
+}
+
+// actionAllowed returns whether the action may be performed on a rollout with the given status.
+func actionAllowed(action tc.RolloutAction, status tc.RolloutStatus) bool {
+	switch action {
+	case tc.RolloutActionPause:
+		return status == tc.RolloutStatusInProgress
+	case tc.RolloutActionResume:
+		return status == tc.RolloutStatusPaused || status == tc.RolloutStatusFailed
+	case tc.RolloutActionAbort:
+		return status.IsActive()
+	case tc.RolloutActionRollback:
+		return status.IsActive() || status == tc.RolloutStatusAborted
+	}
+	return false
+}
+
+// doAction performs the action on the rollout, which must be locked, and allowed to have the action performed on it.
+// Resumed rollouts are advanced, with the given updating timeout.
+func doAction(tx *sql.Tx, ro rolloutState, action tc.RolloutAction, now time.Time, updatingTimeout time.Duration) error {
+	switch action {
+	case tc.RolloutActionPause:
+		ro.Status = tc.RolloutStatusPaused
+		return updateRolloutState(tx, ro)
+	case tc.RolloutActionResume:
+		if ro.Status == tc.RolloutStatusFailed {
+			// retry the failed wave, waiting for its servers to apply their updates again, or to be available after soaking again
+			if _, err := tx.Exec(`
+UPDATE rollout_wave SET
+  status = $1,
+  started_at = $2,
+  soak_started_at = NULL,
+  completed_at = NULL,
+  failure_reason = ''
+WHERE rollout = $3
+AND number = $4
+AND status = $5
+`, tc.RolloutWaveStatusUpdating, now, ro.ID, ro.CurrentWave, tc.RolloutWaveStatusFailed); err != nil {
+				return errors.New("retrying failed wave: " + err.Error())
+			}
+		}
+		ro.Status = tc.RolloutStatusInProgress
+		if err := updateRolloutState(tx, ro); err != nil {
+			return err
+		}
+		return advanceRollout(tx, ro, now, nil, updatingTimeout)
+	case tc.RolloutActionAbort:
+		if _, err := tx.Exec(`
+UPDATE server SET upd_pending = FALSE
+WHERE upd_pending
+AND id = ANY(SELECT UNNEST(servers) FROM rollout_wave WHERE rollout = $1 AND number = $2 AND status = $3)
+`, ro.ID, ro.CurrentWave, tc.RolloutWaveStatusUpdating); err != nil {
+			return errors.New("dequeueing updates: " + err.Error())
+		}
+		if err := cancelWaves(tx, ro.ID, now); err != nil {
+			return err
+		}
+		ro.Status = tc.RolloutStatusAborted
+		return updateRolloutState(tx, ro)
+	case tc.RolloutActionRollback:
+		if _, err := tx.Exec(`
+UPDATE server SET upd_pending = TRUE
+WHERE id = ANY(SELECT UNNEST(servers) FROM rollout_wave WHERE rollout = $1 AND started_at IS NOT NULL)
+`, ro.ID); err != nil {
+			return errors.New("queueing updates: " + err.Error())
+		}
+		if err := cancelWaves(tx, ro.ID, now); err != nil {
+			return err
+		}
+		ro.Status = tc.RolloutStatusRolledBack
+		return updateRolloutState(tx, ro)
+	}
+	return errors.New("unknown action '" + string(action) + "'")
+}
+
+// cancelWaves cancels the rollout's waves which haven't succeeded, failed, or been canceled.
+func cancelWaves(tx *sql.Tx, rolloutID int, now time.Time) error {
+	statuses := []string{string(tc.RolloutWaveStatusPending), string(tc.RolloutWaveStatusUpdating), string(tc.RolloutWaveStatusSoaking)}
+	if _, err := tx.Exec(`
+UPDATE rollout_wave SET
+  status = $1,
+  completed_at = CASE WHEN started_at IS NULL THEN NULL ELSE $2::timestamptz END
+WHERE rollout = $3
+AND status = ANY($4)
+`, tc.RolloutWaveStatusCanceled, now, rolloutID, pq.Array(statuses)); err != nil {
+		return errors.New("canceling waves: " + err.Error())
+	}
+	return nil
+}
+
+// getMissingCacheGroups returns the names of the Cache Groups of the waves which don't exist.
+func getMissingCacheGroups(tx *sql.Tx, waves []tc.RolloutWaveRequest) ([]string, error) {
+	names := []string{}
+	for _, wave := range waves {
+		names = append(names, wave.CacheGroups...)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	missing := []string{}
+	if err := tx.QueryRow(`
+SELECT ARRAY(
+  SELECT DISTINCT n FROM UNNEST($1::text[]) AS n
+  WHERE NOT EXISTS (SELECT 1 FROM cachegroup c WHERE c.name = n)
+  ORDER BY n
+)
+`, pq.Array(names)).Scan(pq.Array(&missing)); err != nil {
+		return nil, errors.New("querying cachegroups: " + err.Error())
+	}
+	return missing, nil
+}
+
+// getActiveRolloutID returns the ID of the CDN's rollout which may still advance, and whether it has one.
+func getActiveRolloutID(tx *sql.Tx, cdnID int) (int, bool, error) {
+	statuses := []string{string(tc.RolloutStatusInProgress), string(tc.RolloutStatusPaused), string(tc.RolloutStatusFailed)}
+	id := 0
+	if err := tx.QueryRow(`SELECT id FROM rollout WHERE cdn_id = $1 AND status = ANY($2)`, cdnID, pq.Array(statuses)).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, nil
+		}
+		return 0, false, errors.New("querying rollouts: " + err.Error())
+	}
+	return id, true, nil
+}
+
+// insertRollout inserts the rollout and its pending waves, and returns its ID.
+func insertRollout(tx *sql.Tx, req tc.RolloutRequest, userName string) (int, error) {
+	id := 0
+	if err := tx.QueryRow(`
+INSERT INTO rollout (cdn_id, topology, status, current_wave, created_by)
+VALUES ($1, $2, $3, 1, $4)
+RETURNING id
+`, req.CDNID, req.Topology, tc.RolloutStatusInProgress, userName).Scan(&id); err != nil {
+		return 0, errors.New("inserting rollout: " + err.Error())
+	}
+	for i, wave := range req.Waves {
+		cacheGroups := wave.CacheGroups
+		if cacheGroups == nil {
+			cacheGroups = []string{}
+		}
+		if _, err := tx.Exec(`
+INSERT INTO rollout_wave (rollout, number, cachegroups, percent, soak_seconds, status)
+VALUES ($1, $2, $3, $4, $5, $6)
+`, id, i+1, pq.Array(cacheGroups), wave.Percent, wave.SoakSeconds, tc.RolloutWaveStatusPending); err != nil {
+			return 0, errors.New("inserting wave " + strconv.Itoa(i+1) + ": " + err.Error())
+		}
+	}
+	return id, nil
+}
+
+// getRollout returns the rollout with the given ID, and whether it exists.
+func getRollout(tx *sql.Tx, id int) (tc.Rollout, bool, error) {
+	rollouts, err := getRollouts(tx, &id, "", "")
+	if err != nil {
+		return tc.Rollout{}, false, err
+	}
+	if len(rollouts) == 0 {
+		return tc.Rollout{}, false, nil
+	}
+	return rollouts[0], true, nil
+}
+
+// getRollouts returns the rollouts, with their waves, newest first.
+// If id isn't nil, or cdn or status aren't empty, only the matching rollouts are returned.
+func getRollouts(tx *sql.Tx, id *int, cdn string, status string) ([]tc.Rollout, error) {
+	rows, err := tx.Query(`
+SELECT
+  r.id,
+  r.cdn_id,
+  c.name AS cdn_name,
+  r.topology,
+  r.status,
+  r.current_wave,
+  r.created_by,
+  r.created_at,
+  r.last_updated
+FROM rollout r
+JOIN cdn c ON c.id = r.cdn_id
+WHERE ($1::bigint IS NULL OR r.id = $1::bigint)
+AND ($2 = '' OR c.name = $2)
+AND ($3 = '' OR r.status = $3)
+ORDER BY r.id DESC
+`, id, cdn, status)
+	if err != nil {
+		return nil, errors.New("querying rollouts: " + err.Error())
+	}
+	defer log.Close(rows, "getRollouts(): unable to close db connection")
+
+	rollouts := []tc.Rollout{}
+	ids := []int{}
+	for rows.Next() {
+		ro := tc.Rollout{}
+		if err := rows.Scan(&ro.ID, &ro.CDNID, &ro.CDNName, &ro.Topology, &ro.Status, &ro.CurrentWave, &ro.CreatedBy, &ro.CreatedAt, &ro.LastUpdated); err != nil {
+			return nil, errors.New("scanning rollouts: " + err.Error())
+		}
+		ro.Waves = []tc.RolloutWave{}
+		rollouts = append(rollouts, ro)
+		ids = append(ids, ro.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.New("iterating rollouts: " + err.Error())
+	}
+	if len(rollouts) == 0 {
+		return rollouts, nil
+	}
+
+	waves, err := getWaves(tx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i, ro := range rollouts {
+		if rolloutWaves, ok := waves[ro.ID]; ok {
+			rollouts[i].Waves = rolloutWaves
+		}
+	}
+	return rollouts, nil
+}
+
+// getWaves returns the waves of the given rollouts in order, keyed on rollout ID.
+func getWaves(tx *sql.Tx, rolloutIDs []int) (map[int][]tc.RolloutWave, error) {
+	rows, err := tx.Query(`
+SELECT
+  w.rollout,
+  w.number,
+  w.cachegroups,
+  w.percent,
+  w.soak_seconds,
+  w.status,
+  ARRAY(SELECT s.host_name FROM server s WHERE s.id = ANY(w.servers) ORDER BY s.host_name) AS servers,
+  ARRAY(SELECT s.host_name FROM server s WHERE s.id = ANY(w.servers) AND s.upd_pending ORDER BY s.host_name) AS pending_servers,
+  w.started_at,
+  w.soak_started_at,
+  w.completed_at,
+  w.failure_reason
+FROM rollout_wave w
+WHERE w.rollout = ANY($1)
+ORDER BY w.rollout, w.number
+`, pq.Array(rolloutIDs))
+	if err != nil {
+		return nil, errors.New("querying waves: " + err.Error())
+	}
+	defer log.Close(rows, "getWaves(): unable to close db connection")
+
+	waves := map[int][]tc.RolloutWave{}
+	for rows.Next() {
+		rolloutID := 0
+		wave := tc.RolloutWave{}
+		percent := sql.NullInt64{}
+		if err := rows.Scan(
+			&rolloutID,
+			&wave.Number,
+			pq.Array(&wave.CacheGroups),
+			&percent,
+			&wave.SoakSeconds,
+			&wave.Status,
+			pq.Array(&wave.Servers),
+			pq.Array(&wave.PendingServers),
+			&wave.StartedAt,
+			&wave.SoakStartedAt,
+			&wave.CompletedAt,
+			&wave.FailureReason,
+		); err != nil {
+			return nil, errors.New("scanning waves: " + err.Error())
+		}
+		if percent.Valid {
+			p := int(percent.Int64)
+			wave.Percent = &p
+		}
+		if wave.CacheGroups == nil {
+			wave.CacheGroups = []string{}
+		}
+		if wave.Servers == nil {
+			wave.Servers = []string{}
+		}
+		if wave.PendingServers == nil {
+			wave.PendingServers = []string{}
+		}
+		waves[rolloutID] = append(waves[rolloutID], wave)
+	}
+	return waves, rows.Err()
+}
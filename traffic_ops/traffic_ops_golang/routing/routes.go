@@ -73,6 +73,7 @@ import (
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/profileparameter"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/region"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/role"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/rollout"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/routing/middleware"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/server"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/servercapability"
@@ -321,6 +322,17 @@ func Routes(d ServerData) ([]Route, []RawRoute, http.Handler, error) {
 		{api.Version{Major: 4, Minor: 0}, http.MethodGet, `servers/{host_name}/update_status$`, server.GetServerUpdateStatusHandler, auth.PrivLevelReadOnly, Authenticated, nil, 4384515993},
 		{api.Version{Major: 4, Minor: 0}, http.MethodPost, `servers/{id-or-name}/update$`, server.UpdateHandler, auth.PrivLevelOperations, Authenticated, nil, 443813233},
 
+		//Server config state
+		{api.Version{Major: 4, Minor: 0}, http.MethodGet, `servers/{id}/config_state/?$`, server.GetConfigStateHandler, auth.PrivLevelReadOnly, Authenticated, nil, 4270831891},
+		{api.Version{Major: 4, Minor: 0}, http.MethodPost, `servers/{id}/config_state/?$`, server.PostConfigStateHandler, auth.PrivLevelOperations, Authenticated, nil, 4270831892},
+		{api.Version{Major: 4, Minor: 0}, http.MethodGet, `servers/config_drift/?$`, server.GetConfigDriftHandler, auth.PrivLevelReadOnly, Authenticated, nil, 4270831893},
+
+		//Rollouts
+		{api.Version{Major: 4, Minor: 0}, http.MethodGet, `rollouts/?$`, rollout.GetHandler, auth.PrivLevelReadOnly, Authenticated, nil, 4281533301},
+		{api.Version{Major: 4, Minor: 0}, http.MethodPost, `rollouts/?$`, rollout.CreateHandler, auth.PrivLevelOperations, Authenticated, nil, 4281533302},
+		{api.Version{Major: 4, Minor: 0}, http.MethodGet, `rollouts/{id}/?$`, rollout.GetIDHandler, auth.PrivLevelReadOnly, Authenticated, nil, 4281533303},
+		{api.Version{Major: 4, Minor: 0}, http.MethodPost, `rollouts/{id}/action/?$`, rollout.ActionHandler, auth.PrivLevelOperations, Authenticated, nil, 4281533304},
+
 		//Server: CRUD
 		{api.Version{Major: 4, Minor: 0}, http.MethodGet, `servers/?$`, server.Read, auth.PrivLevelReadOnly, Authenticated, nil, 47209592853},
 		{api.Version{Major: 4, Minor: 0}, http.MethodPut, `servers/{id}$`, server.Update, auth.PrivLevelOperations, Authenticated, nil, 4586341033},
@@ -521,6 +533,7 @@ func Routes(d ServerData) ([]Route, []RawRoute, http.Handler, error) {
 		// Stats Summary
 		{api.Version{Major: 4, Minor: 0}, http.MethodGet, `stats_summary/?$`, trafficstats.GetStatsSummary, auth.PrivLevelReadOnly, Authenticated, nil, 4804985983},
 		{api.Version{Major: 4, Minor: 0}, http.MethodPost, `stats_summary/?$`, trafficstats.CreateStatsSummary, auth.PrivLevelReadOnly, Authenticated, nil, 4804915983},
+		{api.Version{Major: 4, Minor: 0}, http.MethodGet, `billing_reports/?$`, trafficstats.GetBillingReports, auth.PrivLevelReadOnly, Authenticated, nil, 4804925983},
 
 		//Pattern based consistent hashing endpoint
 		{api.Version{Major: 4, Minor: 0}, http.MethodPost, `consistenthash/?$`, consistenthash.Post, auth.PrivLevelReadOnly, Authenticated, nil, 4607550763},
@@ -543,6 +556,20 @@ func Routes(d ServerData) ([]Route, []RawRoute, http.Handler, error) {
 		{api.Version{Major: 3, Minor: 1}, http.MethodPut, `acme_accounts/?$`, acme.Update, auth.PrivLevelAdmin, Authenticated, nil, 2034390563},
 		{api.Version{Major: 3, Minor: 1}, http.MethodDelete, `acme_accounts/{provider}/{email}?$`, acme.Delete, auth.PrivLevelAdmin, Authenticated, nil, 2034390564},
 
+		// Server config state
+		{api.Version{Major: 3, Minor: 1}, http.MethodGet, `servers/{id}/config_state/?$`, server.GetConfigStateHandler, auth.PrivLevelReadOnly, Authenticated, nil, 2270831891},
+		{api.Version{Major: 3, Minor: 1}, http.MethodPost, `servers/{id}/config_state/?$`, server.PostConfigStateHandler, auth.PrivLevelOperations, Authenticated, nil, 2270831892},
+		{api.Version{Major: 3, Minor: 1}, http.MethodGet, `servers/config_drift/?$`, server.GetConfigDriftHandler, auth.PrivLevelReadOnly, Authenticated, nil, 2270831893},
+
+		// Billing reports
+		{api.Version{Major: 3, Minor: 1}, http.MethodGet, `billing_reports/?$`, trafficstats.GetBillingReports, auth.PrivLevelReadOnly, Authenticated, nil, 2804925983},
+
+		//Rollouts
+		{api.Version{Major: 3, Minor: 1}, http.MethodGet, `rollouts/?$`, rollout.GetHandler, auth.PrivLevelReadOnly, Authenticated, nil, 2281533301},
+		{api.Version{Major: 3, Minor: 1}, http.MethodPost, `rollouts/?$`, rollout.CreateHandler, auth.PrivLevelOperations, Authenticated, nil, 2281533302},
+		{api.Version{Major: 3, Minor: 1}, http.MethodGet, `rollouts/{id}/?$`, rollout.GetIDHandler, auth.PrivLevelReadOnly, Authenticated, nil, 2281533303},
+		{api.Version{Major: 3, Minor: 1}, http.MethodPost, `rollouts/{id}/action/?$`, rollout.ActionHandler, auth.PrivLevelOperations, Authenticated, nil, 2281533304},
+
 		// API Capability
 		{api.Version{Major: 3, Minor: 0}, http.MethodGet, `api_capabilities/?$`, apicapability.GetAPICapabilitiesHandler, auth.PrivLevelReadOnly, Authenticated, nil, 28132065893},
 
@@ -0,0 +1,485 @@
+package server
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/dbhelpers"
+
+	"github.com/lib/pq"
+)
+
+// ConfigDriftStaleAfterQueryParam is the query parameter of the number of seconds since a cache server last checked in, after which it's reported as stale.
+const ConfigDriftStaleAfterQueryParam = "staleAfter"
+
+// ConfigDriftDefaultStaleAfter is the time since a cache server last checked in, after which it's reported as stale, if the staleAfter query parameter is absent.
+const ConfigDriftDefaultStaleAfter = time.Hour
+
+// ConfigDriftCDNQueryParam is the query parameter of the CDN name to limit the config drift report to.
+const ConfigDriftCDNQueryParam = "cdn"
+
+// GetConfigStateHandler is the handler for GET requests to servers/{id}/config_state.
+func GetConfigStateHandler(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, []string{"id"}, []string{"id"})
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	serverID := inf.IntParams["id"]
+	hostName, ok, err := dbhelpers.GetServerNameFromID(inf.Tx.Tx, serverID)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting server name: %v", err))
+		return
+	} else if !ok {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusNotFound, fmt.Errorf("no server with id '%v' found", serverID), nil)
+		return
+	}
+
+	state, ok, err := getConfigState(inf.Tx.Tx, serverID)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting config state: %v", err))
+		return
+	} else if !ok {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusNotFound, fmt.Errorf("server '%v' has not reported its config state", hostName), nil)
+		return
+	}
+	state.HostName = hostName
+	api.WriteResp(w, r, state)
+}
+
+// PostConfigStateHandler is the handler for POST requests to servers/{id}/config_state.
+// It records the checksums of the config files the server has applied, and the outcome of applying them.
+func PostConfigStateHandler(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, []string{"id"}, []string{"id"})
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	req := tc.ServerConfigStateRequest{}
+	if err := api.Parse(r.Body, inf.Tx.Tx, &req); err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, err, nil)
+		return
+	}
+
+	serverID := inf.IntParams["id"]
+	hostName, ok, err := dbhelpers.GetServerNameFromID(inf.Tx.Tx, serverID)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting server name: %v", err))
+		return
+	} else if !ok {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusNotFound, fmt.Errorf("no server with id '%v' found", serverID), nil)
+		return
+	}
+
+	if err := setConfigState(inf.Tx.Tx, serverID, req); err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("setting config state: %v", err))
+		return
+	}
+
+	state, _, err := getConfigState(inf.Tx.Tx, serverID)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting config state: %v", err))
+		return
+	}
+	state.HostName = hostName
+	api.WriteRespAlertObj(w, r, tc.SuccessLevel, "Server config state was updated.", state)
+}
+
+// GetConfigDriftHandler is the handler for GET requests to servers/config_drift.
+// It returns every cache server whose applied config has drifted from the config Traffic Ops generates now,
+// which has never reported its config state, whose last apply failed, or which hasn't checked in recently.
+func GetConfigDriftHandler(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, nil, nil)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+
+	staleAfter := ConfigDriftDefaultStaleAfter
+	if staleAfterStr, ok := inf.Params[ConfigDriftStaleAfterQueryParam]; ok {
+		staleAfterSecs, err := strconv.Atoi(staleAfterStr)
+		if err != nil || staleAfterSecs < 0 {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusBadRequest, errors.New(ConfigDriftStaleAfterQueryParam+" must be a non-negative integer number of seconds"), nil)
+			return
+		}
+		staleAfter = time.Duration(staleAfterSecs) * time.Second
+	}
+
+	cdn := inf.Params[ConfigDriftCDNQueryParam]
+	if cdn != "" {
+		if ok, err := dbhelpers.CDNExists(cdn, inf.Tx.Tx); err != nil {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("checking CDN existence: %v", err))
+			return
+		} else if !ok {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusNotFound, fmt.Errorf("no CDN named '%v' found", cdn), nil)
+			return
+		}
+	}
+
+	servers, err := getConfigDriftServers(inf.Tx.Tx, cdn)
+	if err != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, fmt.Errorf("getting servers: %v", err))
+		return
+	}
+
+	drifts := makeConfigDrift(servers, staleAfter, time.Now())
+	api.WriteResp(w, r, drifts)
+}
+
+// getConfigState returns the config state last reported by the given server, and whether it has reported any.
+func getConfigState(tx *sql.Tx, serverID int) (tc.ServerConfigState, bool, error) {
+	qry := `
+SELECT
+  run_mode,
+  success,
+  failed_stage,
+  failed_file,
+  error,
+  rolled_back,
+  applied,
+  last_checked
+FROM server_config_state
+WHERE server = $1
+`
+	state := tc.ServerConfigState{ServerID: serverID}
+	if err := tx.QueryRow(qry, serverID).Scan(
+		&state.RunMode,
+		&state.Success,
+		&state.FailedStage,
+		&state.FailedFile,
+		&state.Error,
+		&state.RolledBack,
+		&state.Applied,
+		&state.LastChecked,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return tc.ServerConfigState{}, false, nil
+		}
+		return tc.ServerConfigState{}, false, errors.New("querying config state: " + err.Error())
+	}
+
+	files, err := getConfigFileStates(tx, []int{serverID})
+	if err != nil {
+		return tc.ServerConfigState{}, false, err
+	}
+	state.Files = files[serverID]
+	if state.Files == nil {
+		state.Files = []tc.ServerConfigFileState{}
+	}
+	return state, true, nil
+}
+
+// getConfigFileStates returns the config file checksums last reported by the given servers.
+func getConfigFileStates(tx *sql.Tx, serverIDs []int) (map[int][]tc.ServerConfigFileState, error) {
+	qry := `
+SELECT
+  server,
+  name,
+  path,
+  checksum
+FROM server_config_file_state
+WHERE server = ANY($1)
+ORDER BY server, name
+`
+	rows, err := tx.Query(qry, pq.Array(serverIDs))
+	if err != nil {
+		return nil, errors.New("querying config file states: " + err.Error())
+	}
+	defer log.Close(rows, "getConfigFileStates(): unable to close db connection")
+
+	files := map[int][]tc.ServerConfigFileState{}
+	for rows.Next() {
+		serverID := 0
+		file := tc.ServerConfigFileState{}
+		if err := rows.Scan(&serverID, &file.Name, &file.Path, &file.Checksum); err != nil {
+			return nil, errors.New("scanning config file states: " + err.Error())
+		}
+		files[serverID] = append(files[serverID], file)
+	}
+	return files, nil
+}
+
+// setConfigState records the config state reported by the given server.
+// The outcome of the run is always recorded, but if the request has no files, e.g. because t3c failed before
+// generating them, the server's file checksums and the time its config was last applied are left as they were.
+func setConfigState(tx *sql.Tx, serverID int, req tc.ServerConfigStateRequest) error {
+	hasFiles := req.Files != nil
+	qry := `
+INSERT INTO server_config_state (server, run_mode, success, failed_stage, failed_file, error, rolled_back, applied, last_checked)
+VALUES ($1, $2, $3, $4, $5, $6, $7, CASE WHEN $8 THEN now() END, now())
+ON CONFLICT (server) DO UPDATE SET
+  run_mode = EXCLUDED.run_mode,
+  success = EXCLUDED.success,
+  failed_stage = EXCLUDED.failed_stage,
+  failed_file = EXCLUDED.failed_file,
+  error = EXCLUDED.error,
+  rolled_back = EXCLUDED.rolled_back,
+  applied = CASE WHEN $8 THEN now() ELSE server_config_state.applied END,
+  last_checked = now()
+`
+	if _, err := tx.Exec(qry, serverID, req.RunMode, req.Success, req.FailedStage, req.FailedFile, req.Error, req.RolledBack, hasFiles); err != nil {
+		return errors.New("updating config state: " + err.Error())
+	}
+	if !hasFiles {
+		return nil
+	}
+
+	if _, err := tx.Exec(`DELETE FROM server_config_file_state WHERE server = $1`, serverID); err != nil {
+		return errors.New("deleting old config file states: " + err.Error())
+	}
+
+	names := []string{}
+	paths := []string{}
+	checksums := []string{}
+	for _, file := range *req.Files {
+		names = append(names, file.Name)
+		paths = append(paths, file.Path)
+		checksums = append(checksums, file.Checksum)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	qry = `
+INSERT INTO server_config_file_state (server, name, path, checksum)
+SELECT $1, unnest($2::text[]), unnest($3::text[]), unnest($4::text[])
+`
+	if _, err := tx.Exec(qry, serverID, pq.Array(names), pq.Array(paths), pq.Array(checksums)); err != nil {
+		return errors.New("inserting config file states: " + err.Error())
+	}
+	return nil
+}
+
+// configDriftServer is a cache server, its last reported config state, and the data needed to generate its config.
+type configDriftServer struct {
+	Server       atscfg.Server
+	Params       []tc.Parameter
+	CDNName      string
+	Status       string
+	UpdPending   bool
+	RevalPending bool
+	HasState     bool
+	Success      bool
+	Applied      *time.Time
+	LastChecked  *time.Time
+	Files        []tc.ServerConfigFileState
+}
+
+// getConfigDriftServers returns every cache server which is expected to be running t3c,
+// on the given CDN or all CDNs if cdn is empty.
+func getConfigDriftServers(tx *sql.Tx, cdn string) ([]configDriftServer, error) {
+	qry := `
+SELECT
+  s.id,
+  s.host_name,
+  s.domain_name,
+  s.tcp_port,
+  p.name AS profile,
+  c.name AS cdn_name,
+  st.name AS status,
+  s.upd_pending,
+  s.reval_pending,
+  cs.server IS NOT NULL AS has_state,
+  COALESCE(cs.success, FALSE),
+  cs.applied,
+  cs.last_checked
+FROM server s
+JOIN type t ON t.id = s.type
+JOIN profile p ON p.id = s.profile
+JOIN cdn c ON c.id = s.cdn_id
+JOIN status st ON st.id = s.status
+LEFT JOIN server_config_state cs ON cs.server = s.id
+WHERE (t.name LIKE $1 OR t.name LIKE $2)
+AND st.name = ANY($3)
+AND ($4 = '' OR c.name = $4)
+ORDER BY s.host_name
+`
+	statuses := []string{string(tc.CacheStatusOnline), string(tc.CacheStatusReported), string(tc.CacheStatusAdminDown)}
+	rows, err := tx.Query(qry, tc.EdgeTypePrefix+"%", tc.MidTypePrefix+"%", pq.Array(statuses), cdn)
+	if err != nil {
+		return nil, errors.New("querying servers: " + err.Error())
+	}
+	defer log.Close(rows, "getConfigDriftServers(): unable to close db connection")
+
+	servers := []configDriftServer{}
+	serverIDs := []int{}
+	profiles := []string{}
+	for rows.Next() {
+		sv := configDriftServer{}
+		if err := rows.Scan(
+			&sv.Server.ID,
+			&sv.Server.HostName,
+			&sv.Server.DomainName,
+			&sv.Server.TCPPort,
+			&sv.Server.Profile,
+			&sv.CDNName,
+			&sv.Status,
+			&sv.UpdPending,
+			&sv.RevalPending,
+			&sv.HasState,
+			&sv.Success,
+			&sv.Applied,
+			&sv.LastChecked,
+		); err != nil {
+			return nil, errors.New("scanning servers: " + err.Error())
+		}
+		servers = append(servers, sv)
+		serverIDs = append(serverIDs, *sv.Server.ID)
+		profiles = append(profiles, *sv.Server.Profile)
+	}
+	if len(servers) == 0 {
+		return servers, nil
+	}
+
+	files, err := getConfigFileStates(tx, serverIDs)
+	if err != nil {
+		return nil, err
+	}
+	interfaces, err := dbhelpers.GetServersInterfaces(serverIDs, tx)
+	if err != nil {
+		return nil, errors.New("getting server interfaces: " + err.Error())
+	}
+	params, err := getProfilesParams(tx, profiles)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, sv := range servers {
+		servers[i].Files = files[*sv.Server.ID]
+		servers[i].Params = params[*sv.Server.Profile]
+		for _, iface := range interfaces[*sv.Server.ID] {
+			servers[i].Server.Interfaces = append(servers[i].Server.Interfaces, iface.ServerInterfaceInfo)
+		}
+	}
+	return servers, nil
+}
+
+// getProfilesParams returns the Parameters of each of the given Profiles, keyed on Profile name.
+func getProfilesParams(tx *sql.Tx, profiles []string) (map[string][]tc.Parameter, error) {
+	qry := `
+SELECT
+  pr.name,
+  pa.name,
+  pa.config_file,
+  pa.value
+FROM parameter pa
+JOIN profile_parameter pp ON pp.parameter = pa.id
+JOIN profile pr ON pr.id = pp.profile
+WHERE pr.name = ANY($1)
+`
+	rows, err := tx.Query(qry, pq.Array(profiles))
+	if err != nil {
+		return nil, errors.New("querying profile parameters: " + err.Error())
+	}
+	defer log.Close(rows, "getProfilesParams(): unable to close db connection")
+
+	params := map[string][]tc.Parameter{}
+	for rows.Next() {
+		profile := ""
+		param := tc.Parameter{}
+		if err := rows.Scan(&profile, &param.Name, &param.ConfigFile, &param.Value); err != nil {
+			return nil, errors.New("scanning profile parameters: " + err.Error())
+		}
+		param.Profiles = []byte(`["` + profile + `"]`)
+		params[profile] = append(params[profile], param)
+	}
+	return params, nil
+}
+
+// makeConfigDrift returns the servers whose config has drifted, or may have drifted, as of now.
+// Servers are stale if they haven't checked in within staleAfter; if staleAfter is 0, servers are never stale.
+// Applied files which Traffic Ops can't generate are listed as unknown, but aren't a reason for a server to have drifted,
+// so a server is only reported if it drifted in a way Traffic Ops can determine.
+func makeConfigDrift(servers []configDriftServer, staleAfter time.Duration, now time.Time) []tc.ServerConfigDrift {
+	drifts := []tc.ServerConfigDrift{}
+	for _, sv := range servers {
+		drift := tc.ServerConfigDrift{
+			ServerID:     *sv.Server.ID,
+			HostName:     *sv.Server.HostName,
+			CDNName:      sv.CDNName,
+			Status:       sv.Status,
+			UpdPending:   sv.UpdPending,
+			RevalPending: sv.RevalPending,
+			Applied:      sv.Applied,
+			LastChecked:  sv.LastChecked,
+			Reasons:      []tc.ServerConfigDriftReason{},
+			Files:        []tc.ServerConfigFileDrift{},
+			UnknownFiles: []string{},
+		}
+
+		if !sv.HasState {
+			drift.Reasons = append(drift.Reasons, tc.ServerConfigDriftNoState)
+			drifts = append(drifts, drift)
+			continue
+		}
+		if staleAfter > 0 && sv.LastChecked != nil && now.Sub(*sv.LastChecked) > staleAfter {
+			drift.Reasons = append(drift.Reasons, tc.ServerConfigDriftStale)
+		}
+		if !sv.Success {
+			drift.Reasons = append(drift.Reasons, tc.ServerConfigDriftApplyFailed)
+		}
+
+		server := sv.Server
+		for _, file := range sv.Files {
+			cfg, ok, err := atscfg.MakeServerProfileConfigFile(file.Name, &server, sv.Params, "")
+			if err != nil {
+				log.Warnf("config drift: generating '%v' for server '%v': %v", file.Name, *sv.Server.HostName, err)
+			}
+			if !ok || err != nil {
+				// Traffic Ops can't generate this file without the full config generation data, so whether it drifted is unknown.
+				drift.UnknownFiles = append(drift.UnknownFiles, file.Name)
+				continue
+			}
+			expected := atscfg.ConfigFileChecksum(cfg.Text, cfg.LineComment)
+			if expected == file.Checksum {
+				continue
+			}
+			drift.Files = append(drift.Files, tc.ServerConfigFileDrift{
+				Name:             file.Name,
+				Path:             file.Path,
+				AppliedChecksum:  file.Checksum,
+				ExpectedChecksum: expected,
+			})
+		}
+		if len(drift.Files) > 0 {
+			drift.Reasons = append(drift.Reasons, tc.ServerConfigDriftChecksumMismatch)
+		}
+
+		if len(drift.Reasons) > 0 {
+			drifts = append(drifts, drift)
+		}
+	}
+	return drifts
+}
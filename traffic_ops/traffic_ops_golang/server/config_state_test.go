@@ -0,0 +1,146 @@
+package server
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+
+	"github.com/jmoiron/sqlx"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func makeTestConfigDriftServer(id int, hostName string) configDriftServer {
+	sv := configDriftServer{
+		CDNName: "mycdn",
+		Status:  string(tc.CacheStatusReported),
+		Params: []tc.Parameter{
+			{Name: "param0.so", ConfigFile: atscfg.PluginFileName, Value: "", Profiles: []byte(`["myprofile"]`)},
+		},
+	}
+	sv.Server.ID = util.IntPtr(id)
+	sv.Server.HostName = util.StrPtr(hostName)
+	sv.Server.DomainName = util.StrPtr("example.net")
+	sv.Server.TCPPort = util.IntPtr(80)
+	sv.Server.Profile = util.StrPtr("myprofile")
+	return sv
+}
+
+func TestMakeConfigDrift(t *testing.T) {
+	now := time.Now()
+	recent := now.Add(-time.Minute)
+	old := now.Add(-time.Hour)
+
+	upToDate := makeTestConfigDriftServer(1, "uptodate")
+	server := upToDate.Server
+	expected, ok, err := atscfg.MakeServerProfileConfigFile(atscfg.PluginFileName, &server, upToDate.Params, "")
+	if err != nil || !ok {
+		t.Fatalf("making expected plugin.config: ok %v err %v", ok, err)
+	}
+	upToDate.HasState = true
+	upToDate.Success = true
+	upToDate.LastChecked = &recent
+	upToDate.Files = []tc.ServerConfigFileState{
+		{Name: atscfg.PluginFileName, Checksum: atscfg.ConfigFileChecksum(expected.Text, expected.LineComment)},
+	}
+
+	noState := makeTestConfigDriftServer(2, "nostate")
+
+	mismatch := makeTestConfigDriftServer(3, "mismatch")
+	mismatch.HasState = true
+	mismatch.Success = true
+	mismatch.LastChecked = &recent
+	mismatch.Files = []tc.ServerConfigFileState{{Name: atscfg.PluginFileName, Checksum: "old"}}
+
+	stale := makeTestConfigDriftServer(4, "stale")
+	stale.HasState = true
+	stale.LastChecked = &old
+
+	unknown := makeTestConfigDriftServer(5, "unknown")
+	unknown.HasState = true
+	unknown.Success = true
+	unknown.LastChecked = &recent
+	unknown.Files = append(upToDate.Files, tc.ServerConfigFileState{Name: "remap.config", Checksum: "not generated by Traffic Ops"})
+
+	unknownMismatch := makeTestConfigDriftServer(6, "unknownmismatch")
+	unknownMismatch.HasState = true
+	unknownMismatch.Success = true
+	unknownMismatch.LastChecked = &recent
+	unknownMismatch.Files = append(mismatch.Files, tc.ServerConfigFileState{Name: "remap.config", Checksum: "not generated by Traffic Ops"})
+
+	// a server whose only files which might have drifted are those Traffic Ops can't generate isn't reported.
+	drifts := makeConfigDrift([]configDriftServer{upToDate, noState, mismatch, stale, unknown, unknownMismatch}, 30*time.Minute, now)
+	if len(drifts) != 4 {
+		t.Fatalf("expected 4 drifted servers, actual %+v", drifts)
+	}
+
+	if drifts[0].HostName != "nostate" || len(drifts[0].Reasons) != 1 || drifts[0].Reasons[0] != tc.ServerConfigDriftNoState {
+		t.Errorf("expected nostate to have reason %v, actual %+v", tc.ServerConfigDriftNoState, drifts[0])
+	}
+	if drifts[1].HostName != "mismatch" || len(drifts[1].Reasons) != 1 || drifts[1].Reasons[0] != tc.ServerConfigDriftChecksumMismatch {
+		t.Errorf("expected mismatch to have reason %v, actual %+v", tc.ServerConfigDriftChecksumMismatch, drifts[1])
+	}
+	if len(drifts[1].Files) != 1 || drifts[1].Files[0].AppliedChecksum != "old" || drifts[1].Files[0].ExpectedChecksum == "" || len(drifts[1].UnknownFiles) != 0 {
+		t.Errorf("expected mismatch to have 1 drifted file and no unknown files, actual %+v %v", drifts[1].Files, drifts[1].UnknownFiles)
+	}
+	if drifts[2].HostName != "stale" || len(drifts[2].Reasons) != 2 || drifts[2].Reasons[0] != tc.ServerConfigDriftStale || drifts[2].Reasons[1] != tc.ServerConfigDriftApplyFailed {
+		t.Errorf("expected stale to have reasons %v and %v, actual %+v", tc.ServerConfigDriftStale, tc.ServerConfigDriftApplyFailed, drifts[2])
+	}
+	if drifts[3].HostName != "unknownmismatch" || len(drifts[3].Reasons) != 1 || drifts[3].Reasons[0] != tc.ServerConfigDriftChecksumMismatch {
+		t.Errorf("expected unknownmismatch to have reason %v, actual %+v", tc.ServerConfigDriftChecksumMismatch, drifts[3])
+	}
+	if len(drifts[3].Files) != 1 || drifts[3].Files[0].Name != atscfg.PluginFileName || len(drifts[3].UnknownFiles) != 1 || drifts[3].UnknownFiles[0] != "remap.config" {
+		t.Errorf("expected unknownmismatch to have drifted file %v and unknown file remap.config, actual %+v %v", atscfg.PluginFileName, drifts[3].Files, drifts[3].UnknownFiles)
+	}
+
+	if drifts := makeConfigDrift([]configDriftServer{stale}, 0, now); len(drifts) != 1 || len(drifts[0].Reasons) != 1 {
+		t.Errorf("expected servers never to be stale with no staleAfter, actual %+v", drifts)
+	}
+}
+
+func TestSetConfigStateWithoutFiles(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer mockDB.Close()
+
+	db := sqlx.NewDb(mockDB, "sqlmock")
+	defer db.Close()
+
+	// a run which failed before generating any files must still record its failure, without touching the file states.
+	req := tc.ServerConfigStateRequest{RunMode: "syncds", Success: false, FailedStage: "packages", Error: "installing packages failed"}
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO server_config_state").WithArgs(1, "syncds", false, "packages", "", "installing packages failed", false, false).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	tx := db.MustBegin().Tx
+	if err := setConfigState(tx, 1, req); err != nil {
+		t.Fatalf("setting config state: %v", err)
+	}
+	tx.Commit()
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expectations were not met: %v", err)
+	}
+}
@@ -39,6 +39,7 @@ import (
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/auth"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/config"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/plugin"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/rollout"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/routing"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/trafficvault"
 	_ "github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/trafficvault/backends" // init traffic vault backends
@@ -169,6 +170,8 @@ func main() {
 
 	plugins.OnStartup(plugin.StartupData{Data: plugin.Data{SharedCfg: cfg.PluginSharedConfig, AppCfg: cfg}})
 
+	rollout.StartAdvancing(db.DB, time.Duration(cfg.RolloutAdvanceIntervalSeconds)*time.Second, time.Duration(cfg.DBQueryTimeoutSeconds)*time.Second, time.Duration(cfg.RolloutUpdatingTimeoutSeconds)*time.Second)
+
 	log.Infof("Listening on " + cfg.Port)
 
 	server := &http.Server{
@@ -0,0 +1,275 @@
+package trafficstats
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/auth"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/tenant"
+
+	"github.com/lib/pq"
+)
+
+const billingDateFormat = "2006-01-02"
+
+var (
+	billingJSON = rfc.MimeType{Name: rfc.ApplicationJSON}
+	billingCSV  = rfc.MimeType{Name: rfc.ContentTypeTextCSV}
+)
+
+// billingReportsCSVHeader is the header row of billing reports in CSV.
+var billingReportsCSVHeader = []string{
+	"cdnName",
+	"deliveryServiceName",
+	"tenantName",
+	"startDate",
+	"endDate",
+	"p95Gbps",
+	"peakGbps",
+	"totalBytes",
+	"summaryTime",
+}
+
+// GetBillingReports handler for getting the billing reports made from the
+// billing stats summaries Traffic Stats stores, as JSON or, if requested by
+// the Accept header, CSV.
+func GetBillingReports(w http.ResponseWriter, r *http.Request) {
+	inf, userErr, sysErr, errCode := api.NewInfo(r, nil, nil)
+	if userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+	defer inf.Close()
+	tx := inf.Tx.Tx
+
+	asCSV, err := billingReportsAcceptCSV(r)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusNotAcceptable, err, nil)
+		return
+	}
+
+	startDate, err := parseBillingDate(inf.Params["startDate"])
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, errors.New("startDate: must be a date in the format YYYY-MM-DD"), nil)
+		return
+	}
+	endDate, err := parseBillingDate(inf.Params["endDate"])
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, errors.New("endDate: must be a date in the format YYYY-MM-DD"), nil)
+		return
+	}
+	if startDate != nil && endDate != nil && !endDate.After(*startDate) {
+		api.HandleErr(w, r, tx, http.StatusBadRequest, errors.New("endDate: must be after startDate"), nil)
+		return
+	}
+
+	tenantNames, allTenants, err := getUserTenantNames(tx, inf.User)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, err)
+		return
+	}
+
+	reports, err := getBillingReports(tx, startDate, endDate, inf.Params["cdnName"], inf.Params["deliveryServiceName"], inf.Params["tenantName"], tenantNames, allTenants)
+	if err != nil {
+		api.HandleErr(w, r, tx, http.StatusInternalServerError, nil, err)
+		return
+	}
+
+	if !asCSV {
+		api.WriteResp(w, r, reports)
+		return
+	}
+	w.Header().Set(rfc.ContentType, rfc.ContentTypeTextCSV)
+	w.Header().Set(rfc.ContentDisposition, `attachment; filename="billing_reports.csv"`)
+	w.Header().Set(rfc.Vary, "Accept")
+	if err := writeBillingReportsCSV(w, reports); err != nil {
+		log.Errorf("writing billing reports CSV: %v", err)
+	}
+}
+
+// billingReportsAcceptCSV returns whether the client asked for billing reports
+// in CSV, by preferring text/csv to application/json in its Accept header. An
+// error is returned if the client accepts neither.
+func billingReportsAcceptCSV(r *http.Request) (bool, error) {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return false, nil
+	}
+	mimes, err := rfc.MimeTypesFromAccept(accept)
+	if err != nil {
+		log.Warnf("Failed to negotiate content, Accept line '%s', error: %v", accept, err)
+		return false, nil
+	}
+	for _, m := range mimes {
+		if billingJSON.Satisfy(m) {
+			return false, nil
+		}
+		if billingCSV.Satisfy(m) {
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("Failed to negotiate content; cannot produce output satisfying %s", accept)
+}
+
+// parseBillingDate parses an optional date query parameter, returning nil if
+// it's empty.
+func parseBillingDate(raw string) (*time.Time, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(billingDateFormat, raw)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// getUserTenantNames returns the names of the Tenants the user may see the
+// stats of, and whether those are all of the Tenants, in which case the user
+// may also see the stats of whole CDNs.
+func getUserTenantNames(tx *sql.Tx, user *auth.CurrentUser) ([]string, bool, error) {
+	tenantIDs, err := tenant.GetUserTenantIDListTx(tx, user.TenantID)
+	if err != nil {
+		return nil, false, errors.New("getting user tenants: " + err.Error())
+	}
+	names := []string{}
+	allTenants := false
+	if err := tx.QueryRow(`
+SELECT
+  ARRAY(SELECT name FROM tenant WHERE id = ANY($1::bigint[])),
+  NOT EXISTS(SELECT 1 FROM tenant WHERE NOT id = ANY($1::bigint[]))
+`, pq.Array(tenantIDs)).Scan(pq.Array(&names), &allTenants); err != nil {
+		return nil, false, errors.New("getting user tenant names: " + err.Error())
+	}
+	return names, allTenants, nil
+}
+
+// getBillingReports returns the billing reports of the periods between
+// startDate and endDate, if they aren't nil, optionally limited to a CDN,
+// Delivery Service, and Tenant. Only the reports of the given Tenants are
+// returned, and those of whole CDNs, which have no Tenant, only if allTenants
+// is true. If a period was summarized more than once, each
+// statistic is taken from its latest summary.
+func getBillingReports(tx *sql.Tx, startDate, endDate *time.Time, cdn, ds, tenantName string, userTenantNames []string, allTenants bool) ([]tc.BillingReport, error) {
+	rows, err := tx.Query(`
+WITH latest AS (
+  SELECT DISTINCT ON (cdn_name, deliveryservice_name, tenant_name, stat_date, stat_end_date, stat_name)
+    cdn_name,
+    deliveryservice_name,
+    tenant_name,
+    stat_date,
+    stat_end_date,
+    stat_name,
+    stat_value,
+    summary_time
+  FROM stats_summary
+  WHERE stat_name = ANY($1::text[])
+  AND stat_date IS NOT NULL
+  AND stat_end_date IS NOT NULL
+  AND ($2::date IS NULL OR stat_date >= $2::date)
+  AND ($3::date IS NULL OR stat_end_date <= $3::date)
+  AND ($4 = '' OR cdn_name = $4)
+  AND ($5 = '' OR deliveryservice_name = $5)
+  AND ($6 = '' OR tenant_name = $6)
+  AND (tenant_name = ANY($7::text[]) OR (tenant_name IS NULL AND $11::boolean))
+  ORDER BY cdn_name, deliveryservice_name, tenant_name, stat_date, stat_end_date, stat_name, summary_time DESC
+)
+SELECT
+  cdn_name,
+  deliveryservice_name,
+  tenant_name,
+  stat_date,
+  stat_end_date,
+  MAX(stat_value) FILTER (WHERE stat_name = $8) AS p95_gbps,
+  MAX(stat_value) FILTER (WHERE stat_name = $9) AS peak_gbps,
+  MAX(stat_value) FILTER (WHERE stat_name = $10) AS total_bytes,
+  MAX(summary_time) AS summary_time
+FROM latest
+GROUP BY cdn_name, deliveryservice_name, tenant_name, stat_date, stat_end_date
+ORDER BY stat_date, stat_end_date, cdn_name, tenant_name NULLS FIRST, deliveryservice_name
+`, pq.Array(tc.BillingStatNames), startDate, endDate, cdn, ds, tenantName, pq.Array(userTenantNames), tc.BillingStatP95Gbps, tc.BillingStatPeakGbps, tc.BillingStatTotalBytes, allTenants)
+	if err != nil {
+		return nil, errors.New("querying billing reports: " + err.Error())
+	}
+	defer log.Close(rows, "getBillingReports(): unable to close db connection")
+
+	reports := []tc.BillingReport{}
+	for rows.Next() {
+		br := tc.BillingReport{}
+		if err := rows.Scan(&br.CDNName, &br.DeliveryService, &br.TenantName, &br.StartDate, &br.EndDate, &br.P95Gbps, &br.PeakGbps, &br.TotalBytes, &br.SummaryTime); err != nil {
+			return nil, errors.New("scanning billing reports: " + err.Error())
+		}
+		reports = append(reports, br)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.New("iterating billing reports: " + err.Error())
+	}
+	return reports, nil
+}
+
+// writeBillingReportsCSV writes the reports as CSV, with a header row. Missing
+// statistics and Tenants are written as empty fields.
+func writeBillingReportsCSV(w io.Writer, reports []tc.BillingReport) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(billingReportsCSVHeader); err != nil {
+		return err
+	}
+	for _, br := range reports {
+		tenantName := ""
+		if br.TenantName != nil {
+			tenantName = *br.TenantName
+		}
+		record := []string{
+			br.CDNName,
+			br.DeliveryService,
+			tenantName,
+			br.StartDate.Format(billingDateFormat),
+			br.EndDate.Format(billingDateFormat),
+			formatBillingStat(br.P95Gbps),
+			formatBillingStat(br.PeakGbps),
+			formatBillingStat(br.TotalBytes),
+			br.SummaryTime.Format(tc.TimeLayout),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatBillingStat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
@@ -0,0 +1,164 @@
+package trafficstats
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+
+	"github.com/jmoiron/sqlx"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestBillingReportsAcceptCSV(t *testing.T) {
+	testCases := []struct {
+		accept string
+		csv    bool
+		err    bool
+	}{
+		{accept: "", csv: false},
+		{accept: "*/*", csv: false},
+		{accept: "application/json", csv: false},
+		{accept: "text/csv", csv: true},
+		{accept: "text/*", csv: true},
+		{accept: "text/csv, application/json;q=0.5", csv: true},
+		{accept: "text/csv;q=0.5, application/json", csv: false},
+		{accept: "image/png", err: true},
+	}
+	for _, tc := range testCases {
+		r, err := http.NewRequest(http.MethodGet, "/billing_reports", nil)
+		if err != nil {
+			t.Fatalf("creating request: %v", err)
+		}
+		if tc.accept != "" {
+			r.Header.Set("Accept", tc.accept)
+		}
+		csv, err := billingReportsAcceptCSV(r)
+		if tc.err {
+			if err == nil {
+				t.Errorf("Accept '%s': expected error, actual: nil", tc.accept)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Accept '%s': expected no error, actual: %v", tc.accept, err)
+		} else if csv != tc.csv {
+			t.Errorf("Accept '%s': expected CSV %v, actual: %v", tc.accept, tc.csv, csv)
+		}
+	}
+}
+
+func TestGetBillingReports(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer mockDB.Close()
+
+	db := sqlx.NewDb(mockDB, "sqlmock")
+	defer db.Close()
+
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC)
+	summaryTime := time.Date(2021, time.April, 1, 0, 5, 0, 0, time.UTC)
+
+	cols := []string{"cdn_name", "deliveryservice_name", "tenant_name", "stat_date", "stat_end_date", "p95_gbps", "peak_gbps", "total_bytes", "summary_time"}
+	rows := sqlmock.NewRows(cols).
+		AddRow("cdn1", "all", nil, start, end, 12.5, 20.0, 5e15, summaryTime).
+		AddRow("cdn1", "ds1", "tenant1", start, end, 2.5, 4.0, nil, summaryTime)
+
+	mock.ExpectBegin()
+	anyArg := sqlmock.AnyArg()
+	mock.ExpectQuery("SELECT").WithArgs(anyArg, anyArg, anyArg, "cdn1", "", "", anyArg, anyArg, anyArg, anyArg, true).WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	tx := db.MustBegin().Tx
+	reports, err := getBillingReports(tx, &start, &end, "cdn1", "", "", []string{"tenant1"}, true)
+	if err != nil {
+		t.Fatalf("getting billing reports: %v", err)
+	}
+	tx.Commit()
+
+	if len(reports) != 2 {
+		t.Fatalf("expected 2 billing reports, actual: %v", len(reports))
+	}
+	if reports[0].TenantName != nil {
+		t.Errorf("expected the CDN report to have no tenant, actual: %v", *reports[0].TenantName)
+	}
+	if reports[1].TenantName == nil || *reports[1].TenantName != "tenant1" {
+		t.Errorf("expected the Delivery Service report to have tenant 'tenant1', actual: %v", reports[1].TenantName)
+	}
+	if reports[1].P95Gbps == nil || *reports[1].P95Gbps != 2.5 {
+		t.Errorf("expected the Delivery Service report to have p95 2.5, actual: %v", reports[1].P95Gbps)
+	}
+	if reports[1].TotalBytes != nil {
+		t.Errorf("expected the Delivery Service report to have no total bytes, actual: %v", *reports[1].TotalBytes)
+	}
+	if !reports[0].StartDate.Equal(start) || !reports[0].EndDate.Equal(end) {
+		t.Errorf("expected period %v - %v, actual: %v - %v", start, end, reports[0].StartDate, reports[0].EndDate)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expectations were not met: %v", err)
+	}
+}
+
+func TestWriteBillingReportsCSV(t *testing.T) {
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC)
+	summaryTime := time.Date(2021, time.April, 1, 0, 5, 0, 0, time.UTC)
+
+	reports := []tc.BillingReport{
+		{
+			CDNName:         "cdn1",
+			DeliveryService: "all",
+			StartDate:       start,
+			EndDate:         end,
+			P95Gbps:         util.FloatPtr(12.5),
+			PeakGbps:        util.FloatPtr(20),
+			TotalBytes:      util.FloatPtr(5e15),
+			SummaryTime:     summaryTime,
+		},
+		{
+			CDNName:         "cdn1",
+			DeliveryService: "ds,1",
+			TenantName:      util.StrPtr("tenant1"),
+			StartDate:       start,
+			EndDate:         end,
+			P95Gbps:         util.FloatPtr(2.5),
+			SummaryTime:     summaryTime,
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := writeBillingReportsCSV(buf, reports); err != nil {
+		t.Fatalf("writing billing reports CSV: %v", err)
+	}
+	expected := "cdnName,deliveryServiceName,tenantName,startDate,endDate,p95Gbps,peakGbps,totalBytes,summaryTime\n" +
+		"cdn1,all,,2021-03-01,2021-04-01,12.5,20,5000000000000000,2021-04-01 00:05:00+00\n" +
+		"cdn1,\"ds,1\",tenant1,2021-03-01,2021-04-01,2.5,,,2021-04-01 00:05:00+00\n"
+	if actual := buf.String(); actual != expected {
+		t.Errorf("expected CSV:\n%s\nactual:\n%s", expected, actual)
+	}
+}
@@ -20,14 +20,18 @@ package trafficstats
  */
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/lib/go-util"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/api"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/auth"
 	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/dbhelpers"
 )
 
@@ -72,17 +76,50 @@ func getLastSummaryDate(w http.ResponseWriter, r *http.Request, inf *api.APIInfo
 	api.WriteResp(w, r, resp)
 }
 
+// statsSummaryHasPeriods returns whether the given API version supports stats
+// summaries of periods and Tenants, with statEndDate and tenantName.
+func statsSummaryHasPeriods(version *api.Version) bool {
+	return version.Major > 3 || (version.Major == 3 && version.Minor >= 1)
+}
+
 func getStatsSummary(w http.ResponseWriter, r *http.Request, inf *api.APIInfo) {
 	queryParamsToSQLCols := map[string]dbhelpers.WhereColumnInfo{
 		"statName":            dbhelpers.WhereColumnInfo{Column: "stat_name"},
 		"cdnName":             dbhelpers.WhereColumnInfo{Column: "cdn_name"},
 		"deliveryServiceName": dbhelpers.WhereColumnInfo{Column: "deliveryservice_name"},
 	}
+	hasPeriods := statsSummaryHasPeriods(inf.Version)
+	if hasPeriods {
+		queryParamsToSQLCols["tenantName"] = dbhelpers.WhereColumnInfo{Column: "tenant_name"}
+	}
 	where, orderBy, pagination, queryValues, errs := dbhelpers.BuildWhereAndOrderByAndPagination(inf.Params, queryParamsToSQLCols)
 	if len(errs) > 0 {
 		api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, util.JoinErrs(errs))
 		return
 	}
+
+	if where == "" {
+		where = dbhelpers.BaseWhere + " "
+	} else {
+		where += " AND "
+	}
+	if hasPeriods {
+		// stats of a Tenant, like billing stats, are only shown to the users of the Tenant, and billing stats of whole
+		// CDNs only to users who can see every Tenant
+		tenantNames, allTenants, err := getUserTenantNames(inf.Tx.Tx, inf.User)
+		if err != nil {
+			api.HandleErr(w, r, inf.Tx.Tx, http.StatusInternalServerError, nil, err)
+			return
+		}
+		where += "(tenant_name = ANY(CAST(:user_tenant_names AS text[])) OR (tenant_name IS NULL AND (CAST(:all_tenants AS boolean) OR NOT stat_name = ANY(CAST(:billing_stat_names AS text[])))))"
+		queryValues["user_tenant_names"] = pq.Array(tenantNames)
+		queryValues["all_tenants"] = allTenants
+		queryValues["billing_stat_names"] = pq.Array(tc.BillingStatNames)
+	} else {
+		// older versions don't have stats of periods or Tenants
+		where += "(tenant_name IS NULL AND stat_end_date IS NULL)"
+	}
+
 	query := selectQuery() + where + orderBy + pagination
 	statsSummaries, err := queryStatsSummary(inf.Tx, query, queryValues)
 	if err != nil {
@@ -136,6 +173,17 @@ func CreateStatsSummary(w http.ResponseWriter, r *http.Request) {
 		ss.DeliveryService = util.StrPtr("all")
 	}
 
+	if !statsSummaryHasPeriods(inf.Version) {
+		// older versions don't have stats of periods or Tenants
+		ss.StatEndDate = nil
+		ss.TenantName = nil
+	}
+
+	if userErr, sysErr, errCode := checkStatsSummaryAuth(inf.Tx.Tx, inf.User, ss); userErr != nil || sysErr != nil {
+		api.HandleErr(w, r, inf.Tx.Tx, errCode, userErr, sysErr)
+		return
+	}
+
 	id := -1
 	rows, err := inf.Tx.NamedQuery(insertQuery(), &ss)
 	if err != nil {
@@ -157,6 +205,46 @@ func CreateStatsSummary(w http.ResponseWriter, r *http.Request) {
 	api.WriteRespAlert(w, r, tc.SuccessLevel, successMsg)
 }
 
+// checkStatsSummaryAuth returns an error if the user isn't authorized to
+// create the stats summary. Stats of a Tenant require the user to have that
+// Tenant. Billing stats are what Tenants are billed for, so they also require
+// the operations privilege level, and billing stats of whole CDNs, which have
+// no Tenant, require the user to have every Tenant.
+func checkStatsSummaryAuth(tx *sql.Tx, user *auth.CurrentUser, ss tc.StatsSummary) (error, error, int) {
+	isBilling := false
+	if ss.StatName != nil {
+		for _, name := range tc.BillingStatNames {
+			if *ss.StatName == name {
+				isBilling = true
+				break
+			}
+		}
+	}
+	if isBilling && user.PrivLevel < auth.PrivLevelOperations {
+		return errors.New("not authorized to create billing stats"), nil, http.StatusForbidden
+	}
+	if ss.TenantName == nil && !isBilling {
+		return nil, nil, http.StatusOK
+	}
+
+	tenantNames, allTenants, err := getUserTenantNames(tx, user)
+	if err != nil {
+		return nil, err, http.StatusInternalServerError
+	}
+	if ss.TenantName == nil {
+		if !allTenants {
+			return errors.New("not authorized to create billing stats of whole CDNs"), nil, http.StatusForbidden
+		}
+		return nil, nil, http.StatusOK
+	}
+	for _, name := range tenantNames {
+		if name == *ss.TenantName {
+			return nil, nil, http.StatusOK
+		}
+	}
+	return errors.New("not authorized on this tenant"), nil, http.StatusForbidden
+}
+
 func selectQuery() string {
 	return `SELECT
 cdn_name,
@@ -164,7 +252,9 @@ deliveryservice_name,
 stat_name,
 stat_value,
 summary_time,
-stat_date
+stat_date,
+stat_end_date,
+tenant_name
 FROM stats_summary`
 }
 
@@ -176,13 +266,17 @@ INSERT INTO stats_summary (
 	stat_name,
 	stat_value,
 	summary_time,
-	stat_date)
+	stat_date,
+	stat_end_date,
+	tenant_name)
 VALUES (
 	:cdn_name,
 	:deliveryservice_name,
 	:stat_name,
 	:stat_value,
 	:summary_time,
-	:stat_date) RETURNING id
+	:stat_date,
+	:stat_end_date,
+	:tenant_name) RETURNING id
 `
 }
@@ -0,0 +1,88 @@
+package trafficstats
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+	"github.com/apache/trafficcontrol/traffic_ops/traffic_ops_golang/auth"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestCheckStatsSummaryAuth(t *testing.T) {
+	type testCase struct {
+		name       string
+		privLevel  int
+		statName   string
+		tenantName *string
+		// queriesTenants is whether the user's Tenants are queried, and allTenants whether they're every Tenant.
+		queriesTenants bool
+		allTenants     bool
+		expectedCode   int
+	}
+	cases := []testCase{
+		{"non-billing stat", auth.PrivLevelReadOnly, "daily_maxgbps", nil, false, false, http.StatusOK},
+		{"non-billing stat of another tenant", auth.PrivLevelReadOnly, "daily_maxgbps", util.StrPtr("other"), true, false, http.StatusForbidden},
+		{"billing stat below operations", auth.PrivLevelReadOnly, tc.BillingStatP95Gbps, util.StrPtr("tenant1"), false, false, http.StatusForbidden},
+		{"billing stat of the user's tenant", auth.PrivLevelOperations, tc.BillingStatP95Gbps, util.StrPtr("tenant1"), true, false, http.StatusOK},
+		{"billing stat of a CDN without all tenants", auth.PrivLevelOperations, tc.BillingStatTotalBytes, nil, true, false, http.StatusForbidden},
+		{"billing stat of a CDN with all tenants", auth.PrivLevelAdmin, tc.BillingStatTotalBytes, nil, true, true, http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer mockDB.Close()
+
+			mock.ExpectBegin()
+			if c.queriesTenants {
+				mock.ExpectQuery("user_tenant_children").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"names", "all"}).AddRow("{tenant1}", c.allTenants))
+			}
+			mock.ExpectCommit()
+
+			tx, err := mockDB.Begin()
+			if err != nil {
+				t.Fatalf("creating transaction: %v", err)
+			}
+			user := &auth.CurrentUser{UserName: "user", TenantID: 1, PrivLevel: c.privLevel}
+			ss := tc.StatsSummary{StatName: util.StrPtr(c.statName), TenantName: c.tenantName}
+			userErr, sysErr, code := checkStatsSummaryAuth(tx, user, ss)
+			if sysErr != nil {
+				t.Errorf("expected nil system error, actual %v", sysErr)
+			}
+			if code != c.expectedCode || (userErr == nil) != (c.expectedCode == http.StatusOK) {
+				t.Errorf("expected code %v, actual %v: %v", c.expectedCode, code, userErr)
+			}
+			if err := tx.Commit(); err != nil {
+				t.Fatalf("committing transaction: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("expected queries: %v", err)
+			}
+		})
+	}
+}
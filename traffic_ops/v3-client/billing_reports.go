@@ -0,0 +1,45 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package client
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/toclientlib"
+)
+
+// APIBillingReports is the API version-relative path to the /billing_reports
+// API endpoint.
+const APIBillingReports = "/billing_reports"
+
+// GetBillingReports retrieves the billing reports of the periods summarized by
+// Traffic Stats. The 'startDate', 'endDate', 'cdnName', 'deliveryServiceName',
+// and 'tenantName' query parameters are supported.
+func (to *Session) GetBillingReports(params url.Values, header http.Header) (tc.BillingReportsResponse, toclientlib.ReqInf, error) {
+	path := APIBillingReports
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	resp := tc.BillingReportsResponse{}
+	reqInf, err := to.get(path, header, &resp)
+	return resp, reqInf, err
+}
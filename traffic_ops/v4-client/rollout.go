@@ -0,0 +1,69 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops/toclientlib"
+)
+
+// APIRollouts is the API version-relative path to the /rollouts API endpoint.
+const APIRollouts = "/rollouts"
+
+// CreateRollout creates a rollout, which queues updates on the cache servers
+// of a CDN in waves, and starts its first wave.
+func (to *Session) CreateRollout(req tc.RolloutRequest, header http.Header) (tc.RolloutResponse, toclientlib.ReqInf, error) {
+	resp := tc.RolloutResponse{}
+	reqInf, err := to.post(APIRollouts, req, header, &resp)
+	return resp, reqInf, err
+}
+
+// GetRollouts retrieves rollouts, newest first. The 'cdn' and 'status' query
+// parameters are supported.
+func (to *Session) GetRollouts(params url.Values, header http.Header) (tc.RolloutsResponse, toclientlib.ReqInf, error) {
+	path := APIRollouts
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	resp := tc.RolloutsResponse{}
+	reqInf, err := to.get(path, header, &resp)
+	return resp, reqInf, err
+}
+
+// GetRollout retrieves the rollout identified by 'id'.
+func (to *Session) GetRollout(id int, header http.Header) (tc.RolloutResponse, toclientlib.ReqInf, error) {
+	resp := tc.RolloutResponse{}
+	path := fmt.Sprintf(APIRollouts+"/%d", id)
+	reqInf, err := to.get(path, header, &resp)
+	return resp, reqInf, err
+}
+
+// RolloutAction pauses, resumes, aborts, or rolls back the rollout identified
+// by 'id'.
+func (to *Session) RolloutAction(id int, action tc.RolloutAction, header http.Header) (tc.RolloutResponse, toclientlib.ReqInf, error) {
+	resp := tc.RolloutResponse{}
+	path := fmt.Sprintf(APIRollouts+"/%d/action", id)
+	reqInf, err := to.post(path, tc.RolloutActionRequest{Action: action}, header, &resp)
+	return resp, reqInf, err
+}
@@ -18,6 +18,8 @@ package client
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -75,3 +77,33 @@ func (to *Session) SetUpdateServerStatuses(serverName string, updateStatus *bool
 	reqInf, err := to.post(path, nil, nil, &alerts)
 	return reqInf, err
 }
+
+// SetServerConfigState records the checksums of the config files applied on
+// the server identified by 'serverID', and the outcome of applying them.
+func (to *Session) SetServerConfigState(serverID int, req tc.ServerConfigStateRequest, header http.Header) (tc.ServerConfigStateResponse, toclientlib.ReqInf, error) {
+	resp := tc.ServerConfigStateResponse{}
+	path := fmt.Sprintf("servers/%d/config_state", serverID)
+	reqInf, err := to.post(path, req, header, &resp)
+	return resp, reqInf, err
+}
+
+// GetServerConfigState retrieves the config state last reported by the server
+// identified by 'serverID'.
+func (to *Session) GetServerConfigState(serverID int, header http.Header) (tc.ServerConfigStateResponse, toclientlib.ReqInf, error) {
+	resp := tc.ServerConfigStateResponse{}
+	path := fmt.Sprintf("servers/%d/config_state", serverID)
+	reqInf, err := to.get(path, header, &resp)
+	return resp, reqInf, err
+}
+
+// GetServerConfigDrift retrieves the cache servers whose config has drifted
+// from Traffic Ops. The 'cdn' and 'staleAfter' query parameters are supported.
+func (to *Session) GetServerConfigDrift(params url.Values, header http.Header) (tc.ServerConfigDriftResponse, toclientlib.ReqInf, error) {
+	path := "servers/config_drift"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	resp := tc.ServerConfigDriftResponse{}
+	reqInf, err := to.get(path, header, &resp)
+	return resp, reqInf, err
+}
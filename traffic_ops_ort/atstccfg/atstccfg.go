@@ -49,6 +49,8 @@ package main
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"sort"
 	"strings"
@@ -87,6 +89,37 @@ func main() {
 	plugins := plugin.Get(cfg)
 	plugins.OnStartup(plugin.StartupData{Cfg: cfg})
 
+	var tccfg config.TCCfg
+	var toData *config.TOData
+	var toIPs []net.Addr
+	if cfg.FromData != "" {
+		tccfg, toData, toIPs = getBundleData(cfg)
+	} else {
+		tccfg, toData, toIPs = getTOData(cfg)
+	}
+
+	configs, err := cfgfile.GetAllConfigs(toData, config.UserAgent, toIPs, tccfg)
+	if err != nil {
+		log.Errorln("Getting config for'" + tccfg.CacheHostName + "': " + err.Error())
+		os.Exit(config.ExitCodeErrGeneric)
+	}
+
+	modifyFilesData := plugin.ModifyFilesData{Cfg: tccfg, TOData: toData, Files: configs}
+	configs = plugins.ModifyFiles(modifyFilesData)
+
+	sort.Sort(config.ATSConfigFiles(configs))
+
+	if err := cfgfile.WriteConfigs(configs, os.Stdout); err != nil {
+		log.Errorln("Writing configs for '" + tccfg.CacheHostName + "': " + err.Error())
+		os.Exit(config.ExitCodeErrGeneric)
+	}
+
+	os.Exit(config.ExitCodeSuccess)
+}
+
+// getTOData gets the data to generate config from Traffic Ops, and writes it to the --capture-data bundle if any.
+// If a --get-data or --set-* argument was given, this performs it and exits.
+func getTOData(cfg config.Cfg) (config.TCCfg, *config.TOData, []net.Addr) {
 	toClient, err := toreq.New(cfg.TOURL, cfg.TOUser, cfg.TOPass, cfg.TOInsecure, cfg.TOTimeout, config.UserAgent)
 	if err != nil {
 		log.Errorln(err)
@@ -115,27 +148,62 @@ func main() {
 		os.Exit(config.ExitCodeSuccess)
 	}
 
+	if tccfg.SetConfigState {
+		if err := getdata.SetConfigState(tccfg, os.Stdin); err != nil {
+			log.Errorln("setting config state: " + err.Error())
+			os.Exit(config.ExitCodeErrGeneric)
+		}
+		os.Exit(config.ExitCodeSuccess)
+	}
+
 	toData, toIPs, err := cfgfile.GetTOData(tccfg)
 	if err != nil {
 		log.Errorln("getting data from traffic ops: " + err.Error())
 		os.Exit(config.ExitCodeErrGeneric)
 	}
 
-	configs, err := cfgfile.GetAllConfigs(toData, config.UserAgent, toIPs, tccfg)
+	if cfg.CaptureData != "" {
+		bundle, err := cfgfile.MakeDataBundle(toData, toIPs, cfgfile.GetTOURL(tccfg), config.UserAgent, cfg, cfg.CaptureRedact)
+		if err != nil {
+			log.Errorln("making data bundle: " + err.Error())
+			os.Exit(config.ExitCodeErrGeneric)
+		}
+		if err := cfgfile.WriteDataBundle(cfg.CaptureData, bundle); err != nil {
+			log.Errorln(err.Error())
+			os.Exit(config.ExitCodeErrGeneric)
+		}
+		log.Infoln("captured data to '" + cfg.CaptureData + "'")
+	}
+	return tccfg, toData, toIPs
+}
+
+// getBundleData gets the data to generate config from the --from-data bundle, without Traffic Ops.
+func getBundleData(cfg config.Cfg) (config.TCCfg, *config.TOData, []net.Addr) {
+	bundle, err := cfgfile.ReadDataBundle(cfg.FromData)
 	if err != nil {
-		log.Errorln("Getting config for'" + cfg.CacheHostName + "': " + err.Error())
+		log.Errorln(err.Error())
 		os.Exit(config.ExitCodeErrGeneric)
 	}
 
-	modifyFilesData := plugin.ModifyFilesData{Cfg: tccfg, TOData: toData, Files: configs}
-	configs = plugins.ModifyFiles(modifyFilesData)
-
-	sort.Sort(config.ATSConfigFiles(configs))
-
-	if err := cfgfile.WriteConfigs(configs, os.Stdout); err != nil {
-		log.Errorln("Writing configs for '" + cfg.CacheHostName + "': " + err.Error())
+	if cfg.CacheHostName == "" {
+		cfg.CacheHostName = bundle.CacheHostName
+	} else if cfg.CacheHostName != bundle.CacheHostName {
+		log.Errorln("cache host name '" + cfg.CacheHostName + "' doesn't match data bundle server '" + bundle.CacheHostName + "'")
 		os.Exit(config.ExitCodeErrGeneric)
 	}
+	if bundle.Options.RevalOnly && !cfg.RevalOnly {
+		log.Errorln("data bundle was captured with --revalidate-only, and only has the data to generate revalidate config")
+		os.Exit(config.ExitCodeErrGeneric)
+	}
+	if bundle.Redacted {
+		log.Warnln("data bundle is redacted, config with secrets will not match Traffic Ops")
+	}
 
-	os.Exit(config.ExitCodeSuccess)
+	if bundle.TOURL != "" {
+		if cfg.TOURL, err = url.Parse(bundle.TOURL); err != nil {
+			log.Warnln("data bundle Traffic Ops URL '" + bundle.TOURL + "' invalid, omitting from headers: " + err.Error())
+		}
+	}
+	log.Infoln("generating config from data bundle '" + cfg.FromData + "' captured " + bundle.Time.String() + " by " + bundle.AppVersion)
+	return config.TCCfg{Cfg: cfg}, bundle.Data, bundle.Addrs()
 }
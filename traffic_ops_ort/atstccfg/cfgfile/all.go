@@ -27,14 +27,11 @@ import (
 	"mime/multipart"
 	"net"
 	"path/filepath"
-	"regexp"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/apache/trafficcontrol/lib/go-atscfg"
-	"github.com/apache/trafficcontrol/lib/go-log"
 	"github.com/apache/trafficcontrol/lib/go-rfc"
 	"github.com/apache/trafficcontrol/traffic_ops_ort/atstccfg/config"
 )
@@ -57,7 +54,7 @@ func GetAllConfigs(
 	}
 
 	genTime := time.Now()
-	hdrCommentTxt := makeHeaderComment(*toData.Server.HostName, appVersion, cfg.TOClient.C.URL, toIPs, genTime)
+	hdrCommentTxt := makeHeaderComment(*toData.Server.HostName, appVersion, GetTOURL(cfg), toIPs, genTime)
 
 	hasSSLMultiCertConfig := false
 	configs := []config.ATSConfigFile{}
@@ -143,58 +140,22 @@ func (p ATSConfigFiles) Less(i, j int) bool {
 	return p[i].Name < p[j].Name
 }
 
-var returnRegex = regexp.MustCompile(`\s*__RETURN__\s*`)
-
 // PreprocessConfigFile does global preprocessing on the given config file cfgFile.
-// This is mostly string replacements of __X__ directives. See the code for the full list of replacements.
-// These things were formerly done by ORT, but need to be processed by atstccfg now, because ORT no longer has the metadata necessary.
+// See atscfg.PreprocessConfigFile.
 func PreprocessConfigFile(server *atscfg.Server, cfgFile string) string {
-	if server.TCPPort != nil && *server.TCPPort != 80 && *server.TCPPort != 0 {
-		cfgFile = strings.Replace(cfgFile, `__SERVER_TCP_PORT__`, strconv.Itoa(*server.TCPPort), -1)
-	} else {
-		cfgFile = strings.Replace(cfgFile, `:__SERVER_TCP_PORT__`, ``, -1)
-	}
-
-	ipAddr := ""
-	for _, iFace := range server.Interfaces {
-		for _, addr := range iFace.IPAddresses {
-			if !addr.ServiceAddress {
-				continue
-			}
-			addrStr := addr.Address
-			ip := net.ParseIP(addrStr)
-			if ip == nil {
-				err := error(nil)
-				ip, _, err = net.ParseCIDR(addrStr)
-				if err != nil {
-					ip = nil // don't bother with the error, just skip
-				}
-			}
-			if ip == nil || ip.To4() == nil {
-				continue
-			}
-			ipAddr = addrStr
-			break
-		}
-	}
-	if ipAddr != "" {
-		cfgFile = strings.Replace(cfgFile, `__CACHE_IPV4__`, ipAddr, -1)
-	} else {
-		log.Errorln("Preprocessing: this server had a missing or malformed IPv4 Service Interface, cannot replace __CACHE_IPV4__ directives!")
-	}
+	return atscfg.PreprocessConfigFile(server, cfgFile)
+}
 
-	if server.HostName == nil || *server.HostName == "" {
-		log.Errorln("Preprocessing: this server missing HostName, cannot replace __HOSTNAME__ directives!")
-	} else {
-		cfgFile = strings.Replace(cfgFile, `__HOSTNAME__`, *server.HostName, -1)
+// GetTOURL returns the URL of the Traffic Ops config is generated from.
+// This is the URL the client is using, which may be the Traffic Ops proxy, or cfg.TOURL if there's no client, e.g. generating from a data bundle.
+func GetTOURL(cfg config.TCCfg) string {
+	if cfg.TOClient != nil && cfg.TOClient.C != nil {
+		return cfg.TOClient.C.URL
 	}
-	if server.HostName == nil || *server.HostName == "" || server.DomainName == nil || *server.DomainName == "" {
-		log.Errorln("Preprocessing: this server missing HostName or DomainName, cannot replace __FULL_HOSTNAME__ directives!")
-	} else {
-		cfgFile = strings.Replace(cfgFile, `__FULL_HOSTNAME__`, *server.HostName+`.`+*server.DomainName, -1)
+	if cfg.TOURL == nil {
+		return ""
 	}
-	cfgFile = returnRegex.ReplaceAllString(cfgFile, "\n")
-	return cfgFile
+	return cfg.TOURL.String()
 }
 
 func makeHeaderComment(serverHostName string, appVersion string, toURL string, toIPs []net.Addr, genTime time.Time) string {
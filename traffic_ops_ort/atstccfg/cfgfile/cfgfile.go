@@ -314,6 +314,16 @@ func GetTOData(cfg config.TCCfg) (*config.TOData, []net.Addr, error) {
 		toData.CacheKeyParams = params
 		return nil
 	}
+	sniParamsF := func() error {
+		defer func(start time.Time) { log.Infof("sniParamsF took %v\n", time.Since(start)) }(time.Now())
+		params, toAddr, err := cfg.TOClient.GetConfigFileParameters(atscfg.SNIParameterConfigFile)
+		if err != nil {
+			return errors.New("getting sni.yaml parameters: " + err.Error())
+		}
+		toIPs.Store(toAddr, nil)
+		toData.SNIParams = params
+		return nil
+	}
 	parentConfigParamsF := func() error {
 		defer func(start time.Time) { log.Infof("parentConfigParamsF took %v\n", time.Since(start)) }(time.Now())
 		parentConfigParams, toAddr, err := cfg.TOClient.GetConfigFileParameters("parent.config") // TODO make const in lib/go-atscfg
@@ -339,7 +349,7 @@ func GetTOData(cfg config.TCCfg) (*config.TOData, []net.Addr, error) {
 	fs := []func() error{serversF, cgF, jobsF}
 	if !cfg.RevalOnly {
 		// skip data not needed for reval, if we're reval-only
-		fs = append([]func() error{dsrF, cacheKeyParamsF, parentConfigParamsF, capsF, dsCapsF, topologiesF}, fs...)
+		fs = append([]func() error{dsrF, cacheKeyParamsF, sniParamsF, parentConfigParamsF, capsF, dsCapsF, topologiesF}, fs...)
 	}
 	errs := runParallel(fs)
 
@@ -0,0 +1,231 @@
+package cfgfile
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+	"github.com/apache/trafficcontrol/traffic_ops_ort/atstccfg/config"
+)
+
+// DataBundleVersion is the version of the data bundle format written by this app.
+// It must be incremented whenever config.TOData changes in a way older bundles can't be read into.
+const DataBundleVersion = 1
+
+// RedactedValue replaces secrets in redacted data bundles.
+const RedactedValue = "REDACTED"
+
+// DataBundle is all the Traffic Ops data used to generate config for a server, captured so it can be regenerated without Traffic Ops.
+type DataBundle struct {
+	// Version is the DataBundleVersion of the bundle.
+	Version int `json:"version"`
+
+	// AppVersion is the version of the app which captured the bundle.
+	AppVersion string `json:"appVersion"`
+
+	// Time is when the bundle was captured.
+	Time time.Time `json:"time"`
+
+	// CacheHostName is the server the data was fetched for.
+	CacheHostName string `json:"cacheHostName"`
+
+	// TOURL is the Traffic Ops URL the data was fetched from, which may be the Traffic Ops proxy.
+	TOURL string `json:"toURL"`
+
+	// TOIPs is the addresses of all Traffic Ops requested.
+	TOIPs []string `json:"toIPs"`
+
+	// Redacted is whether secrets were replaced with RedactedValue.
+	Redacted bool `json:"redacted"`
+
+	// Options is the config generation options the bundle was captured with.
+	// They're informational; config generated from the bundle uses the current options.
+	Options DataBundleOptions `json:"options"`
+
+	// Data is the data from Traffic Ops.
+	Data *config.TOData `json:"data"`
+}
+
+// DataBundleOptions is the options which affect config generation, as of when a DataBundle was captured.
+type DataBundleOptions struct {
+	Dir             string `json:"dir"`
+	RevalOnly       bool   `json:"revalOnly"`
+	ViaRelease      bool   `json:"viaRelease"`
+	SetDNSLocalBind bool   `json:"dnsLocalBind"`
+	ParentComments  bool   `json:"parentComments"`
+}
+
+// MakeDataBundle returns the bundle of the given data, as fetched by GetTOData.
+// If redact is true, secrets in the data are replaced with RedactedValue. The given data is never modified.
+func MakeDataBundle(toData *config.TOData, toIPs []net.Addr, toURL string, appVersion string, cfg config.Cfg, redact bool) (DataBundle, error) {
+	ipStrs := []string{}
+	for _, ip := range toIPs {
+		if ip == nil {
+			continue
+		}
+		ipStrs = append(ipStrs, ip.String())
+	}
+	sort.Strings(ipStrs)
+
+	bundle := DataBundle{
+		Version:       DataBundleVersion,
+		AppVersion:    appVersion,
+		Time:          time.Now(),
+		CacheHostName: cfg.CacheHostName,
+		TOURL:         toURL,
+		TOIPs:         ipStrs,
+		Redacted:      redact,
+		Options: DataBundleOptions{
+			Dir:             cfg.Dir,
+			RevalOnly:       cfg.RevalOnly,
+			ViaRelease:      cfg.ViaRelease,
+			SetDNSLocalBind: cfg.SetDNSLocalBind,
+			ParentComments:  cfg.ParentComments,
+		},
+		Data: toData,
+	}
+	if redact {
+		redacted, err := RedactTOData(toData)
+		if err != nil {
+			return DataBundle{}, errors.New("redacting: " + err.Error())
+		}
+		bundle.Data = redacted
+	}
+	return bundle, nil
+}
+
+// WriteDataBundle writes the bundle as JSON to the file at path.
+func WriteDataBundle(path string, bundle DataBundle) error {
+	bts, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return errors.New("marshalling data bundle: " + err.Error())
+	}
+	if err := ioutil.WriteFile(path, bts, 0600); err != nil {
+		return errors.New("writing data bundle '" + path + "': " + err.Error())
+	}
+	return nil
+}
+
+// ReadDataBundle reads the bundle written by WriteDataBundle from the file at path.
+// Returns an error if the bundle isn't a version this app can read.
+func ReadDataBundle(path string) (DataBundle, error) {
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		return DataBundle{}, errors.New("reading data bundle '" + path + "': " + err.Error())
+	}
+	bundle := DataBundle{}
+	if err := json.Unmarshal(bts, &bundle); err != nil {
+		return DataBundle{}, errors.New("decoding data bundle '" + path + "': " + err.Error())
+	}
+	if bundle.Version != DataBundleVersion {
+		return DataBundle{}, errors.New("data bundle '" + path + "' version " + strconv.Itoa(bundle.Version) + " unsupported, expected " + strconv.Itoa(DataBundleVersion))
+	}
+	if bundle.Data == nil || bundle.Data.Server == nil {
+		return DataBundle{}, errors.New("data bundle '" + path + "' missing server data")
+	}
+	return bundle, nil
+}
+
+// Addrs returns the Traffic Ops addresses of the bundle, for generating config file header comments.
+func (bundle DataBundle) Addrs() []net.Addr {
+	addrs := []net.Addr{}
+	for _, ip := range bundle.TOIPs {
+		addrs = append(addrs, dataBundleAddr(ip))
+	}
+	return addrs
+}
+
+// dataBundleAddr is a net.Addr of a Traffic Ops address read from a data bundle.
+type dataBundleAddr string
+
+func (addr dataBundleAddr) Network() string { return "tcp" }
+func (addr dataBundleAddr) String() string  { return string(addr) }
+
+// RedactTOData returns a copy of toData with all secrets replaced with RedactedValue.
+//
+// Secrets are secure Parameter values, server ILO and XMPP passwords, URL Sig and URI Signing keys, and SSL private keys.
+// SSL keys remain valid base64, so config can still be generated from redacted data.
+func RedactTOData(toData *config.TOData) (*config.TOData, error) {
+	// copy by serializing, so the caller's data is never modified and new fields are always copied.
+	bts, err := json.Marshal(toData)
+	if err != nil {
+		return nil, errors.New("copying data: " + err.Error())
+	}
+	redacted := &config.TOData{}
+	if err := json.Unmarshal(bts, redacted); err != nil {
+		return nil, errors.New("copying data: " + err.Error())
+	}
+
+	for _, params := range [][]tc.Parameter{redacted.GlobalParams, redacted.ServerParams, redacted.CacheKeyParams, redacted.SNIParams, redacted.ParentConfigParams} {
+		redactParams(params)
+	}
+	for i, param := range redacted.Profile.Parameters {
+		if param.Secure != nil && *param.Secure && param.Value != nil {
+			redacted.Profile.Parameters[i].Value = util.StrPtr(RedactedValue)
+		}
+	}
+
+	redactServer := func(sv *tc.CommonServerProperties) {
+		if sv.ILOPassword != nil && *sv.ILOPassword != "" {
+			sv.ILOPassword = util.StrPtr(RedactedValue)
+		}
+		if sv.XMPPPasswd != nil && *sv.XMPPPasswd != "" {
+			sv.XMPPPasswd = util.StrPtr(RedactedValue)
+		}
+	}
+	for i := range redacted.Servers {
+		redactServer(&redacted.Servers[i].CommonServerProperties)
+	}
+	if redacted.Server != nil {
+		redactServer(&redacted.Server.CommonServerProperties)
+	}
+
+	for ds, keys := range redacted.URLSigKeys {
+		for name := range keys {
+			keys[name] = RedactedValue
+		}
+		redacted.URLSigKeys[ds] = keys
+	}
+	for ds := range redacted.URISigningKeys {
+		redacted.URISigningKeys[ds] = []byte(RedactedValue)
+	}
+	for i := range redacted.SSLKeys {
+		redacted.SSLKeys[i].Certificate.Key = base64.StdEncoding.EncodeToString([]byte(RedactedValue))
+	}
+	return redacted, nil
+}
+
+// redactParams replaces the values of all secure Parameters in params with RedactedValue.
+func redactParams(params []tc.Parameter) {
+	for i, param := range params {
+		if param.Secure {
+			params[i].Value = RedactedValue
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package cfgfile
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+	"github.com/apache/trafficcontrol/traffic_ops_ort/atstccfg/config"
+)
+
+func TestDataBundleRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atstccfg-databundle-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	toData := MakeFakeTOData()
+	cfg := config.TCCfg{}
+	cfg.Dir = "/etc/trafficserver/"
+	cfg.CacheHostName = *toData.Server.HostName
+
+	bundle, err := MakeDataBundle(toData, nil, "https://to.invalid", "atstccfg/test", cfg.Cfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "bundle.json")
+	if err := WriteDataBundle(path, bundle); err != nil {
+		t.Fatal(err)
+	}
+	readBundle, err := ReadDataBundle(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readBundle.Version != DataBundleVersion || readBundle.CacheHostName != cfg.CacheHostName || readBundle.TOURL != "https://to.invalid" || readBundle.Redacted {
+		t.Errorf("expected bundle metadata to round trip, actual %+v", readBundle)
+	}
+
+	writeAll := func(toData *config.TOData) string {
+		configs, err := GetAllConfigs(toData, "", nil, cfg)
+		if err != nil {
+			t.Fatalf("getting configs: %v", err)
+		}
+		buf := &bytes.Buffer{}
+		if err := WriteConfigs(configs, buf); err != nil {
+			t.Fatalf("writing configs: %v", err)
+		}
+		return removeComments(buf.String())
+	}
+	if expected, actual := writeAll(toData), writeAll(readBundle.Data); expected != actual {
+		t.Errorf("expected config from data bundle to be the same as from the original data, expected '''%v''' actual '''%v'''", expected, actual)
+	}
+
+	bundle.Version = DataBundleVersion + 1
+	if err := WriteDataBundle(path, bundle); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadDataBundle(path); err == nil {
+		t.Errorf("expected reading unsupported data bundle version to error, actual nil")
+	}
+}
+
+func TestRedactTOData(t *testing.T) {
+	toData := MakeFakeTOData()
+	toData.ServerParams = append(toData.ServerParams, tc.Parameter{Name: "secret", ConfigFile: "records.config", Value: "hunter2", Secure: true})
+	toData.Server.ILOPassword = util.StrPtr("hunter2")
+	origServerParamsLen := len(toData.ServerParams)
+
+	redacted, err := RedactTOData(toData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if toData.ServerParams[origServerParamsLen-1].Value != "hunter2" || *toData.Server.ILOPassword != "hunter2" {
+		t.Errorf("expected RedactTOData not to modify the original data")
+	}
+	if val := redacted.ServerParams[origServerParamsLen-1].Value; val != RedactedValue {
+		t.Errorf("expected secure parameter redacted, actual '%v'", val)
+	}
+	if val := redacted.ServerParams[0].Value; val != toData.ServerParams[0].Value {
+		t.Errorf("expected insecure parameter '%v', actual '%v'", toData.ServerParams[0].Value, val)
+	}
+	if val := *redacted.Server.ILOPassword; val != RedactedValue {
+		t.Errorf("expected server ILO password redacted, actual '%v'", val)
+	}
+	for ds, keys := range redacted.URLSigKeys {
+		for name, key := range keys {
+			if key != RedactedValue {
+				t.Errorf("expected delivery service '%v' url sig key '%v' redacted, actual '%v'", ds, name, key)
+			}
+		}
+	}
+	for ds, keys := range redacted.URISigningKeys {
+		if string(keys) != RedactedValue {
+			t.Errorf("expected delivery service '%v' uri signing keys redacted, actual '%v'", ds, string(keys))
+		}
+	}
+	for _, keys := range redacted.SSLKeys {
+		if key, err := base64.StdEncoding.DecodeString(keys.Certificate.Key); err != nil || string(key) != RedactedValue {
+			t.Errorf("expected delivery service '%v' ssl key redacted and base64, actual '%v'", keys.DeliveryService, keys.Certificate.Key)
+		}
+	}
+}
@@ -95,8 +95,10 @@ var configFileLiteralFuncs = []ConfigFileLiteralFunc{
 	{"records.config", MakeRecordsDotConfig},
 	{"regex_revalidate.config", MakeRegexRevalidateDotConfig},
 	{"remap.config", MakeRemapDotConfig},
+	{"sni.yaml", MakeSNIDotYAML},
 	{"ssl_multicert.config", MakeSSLMultiCertDotConfig},
 	{"storage.config", MakeStorageDotConfig},
+	{"strategies.yaml", MakeStrategiesDotYAML},
 	{"sysctl.conf", MakeSysCtlDotConf},
 	{"volume.config", MakeVolumeDotConfig},
 }
@@ -20,6 +20,8 @@ package cfgfile
  */
 
 import (
+	"errors"
+
 	"github.com/apache/trafficcontrol/lib/go-atscfg"
 	"github.com/apache/trafficcontrol/traffic_ops_ort/atstccfg/config"
 )
@@ -158,6 +160,22 @@ func MakeRegexRevalidateDotConfig(toData *config.TOData, fileName string, hdrCom
 }
 
 func MakeRemapDotConfig(toData *config.TOData, fileName string, hdrCommentTxt string, cfg config.TCCfg) (atscfg.Cfg, error) {
+	// strategy warnings are in strategies.yaml, so they aren't repeated here.
+	strategyDSNames, _, err := atscfg.StrategyDSNames(
+		toData.DeliveryServices,
+		toData.Server,
+		toData.Servers,
+		toData.Topologies,
+		toData.ServerParams,
+		toData.ParentConfigParams,
+		toData.ServerCapabilities,
+		toData.DSRequiredCapabilities,
+		toData.CacheGroups,
+		toData.DeliveryServiceServers,
+	)
+	if err != nil {
+		return atscfg.Cfg{}, errors.New("getting strategies: " + err.Error())
+	}
 	return atscfg.MakeRemapDotConfig(
 		toData.Server,
 		toData.DeliveryServices,
@@ -170,6 +188,23 @@ func MakeRemapDotConfig(toData *config.TOData, fileName string, hdrCommentTxt st
 		toData.CacheGroups,
 		toData.ServerCapabilities,
 		toData.DSRequiredCapabilities,
+		strategyDSNames,
+		hdrCommentTxt,
+	)
+}
+
+func MakeSNIDotYAML(toData *config.TOData, fileName string, hdrCommentTxt string, cfg config.TCCfg) (atscfg.Cfg, error) {
+	return atscfg.MakeSNIDotYAML(
+		toData.Server,
+		toData.DeliveryServices,
+		toData.DeliveryServiceServers,
+		toData.DeliveryServiceRegexes,
+		toData.SNIParams,
+		toData.ServerParams,
+		toData.CDN,
+		toData.Topologies,
+		toData.ServerCapabilities,
+		toData.DSRequiredCapabilities,
 		hdrCommentTxt,
 	)
 }
@@ -182,6 +217,26 @@ func MakeStorageDotConfig(toData *config.TOData, fileName string, hdrCommentTxt
 	return atscfg.MakeStorageDotConfig(toData.Server, toData.ServerParams, hdrCommentTxt)
 }
 
+func MakeStrategiesDotYAML(toData *config.TOData, fileName string, hdrCommentTxt string, cfg config.TCCfg) (atscfg.Cfg, error) {
+	return atscfg.MakeStrategiesDotYAML(
+		toData.DeliveryServices,
+		toData.Server,
+		toData.Servers,
+		toData.Topologies,
+		toData.ServerParams,
+		toData.ParentConfigParams,
+		toData.ServerCapabilities,
+		toData.DSRequiredCapabilities,
+		toData.CacheGroups,
+		toData.DeliveryServiceServers,
+		toData.CDN,
+		atscfg.StrategiesYAMLOpts{
+			HdrComment:  hdrCommentTxt,
+			AddComments: cfg.ParentComments,
+		},
+	)
+}
+
 func MakeSysCtlDotConf(toData *config.TOData, fileName string, hdrCommentTxt string, cfg config.TCCfg) (atscfg.Cfg, error) {
 	return atscfg.MakeSysCtlDotConf(toData.Server, toData.ServerParams, hdrCommentTxt)
 }
@@ -49,7 +49,10 @@ var ErrBadRequest = errors.New("bad request")
 
 type Cfg struct {
 	CacheHostName   string
+	CaptureData     string
+	CaptureRedact   bool
 	DisableProxy    bool
+	FromData        string
 	GetData         string
 	ListPlugins     bool
 	LogLocationErr  string
@@ -59,6 +62,7 @@ type Cfg struct {
 	RevalOnly       bool
 	SetQueueStatus  string
 	SetRevalStatus  string
+	SetConfigState  bool
 	TOInsecure      bool
 	TOPass          string
 	TOTimeout       time.Duration
@@ -99,6 +103,10 @@ func GetCfg() (Cfg, error) {
 	getData := flag.StringP("get-data", "d", "", "non-config-file Traffic Ops Data to get. Valid values are update-status, packages, chkconfig, system-info, and statuses")
 	setQueueStatus := flag.StringP("set-queue-status", "q", "", "POSTs to Traffic Ops setting the queue status of the server. Must be 'true' or 'false'. Requires --set-reval-status also be set")
 	setRevalStatus := flag.StringP("set-reval-status", "a", "", "POSTs to Traffic Ops setting the revalidate status of the server. Must be 'true' or 'false'. Requires --set-queue-status also be set")
+	setConfigState := flag.BoolP("set-config-state", "", false, "POSTs to Traffic Ops the config state of the server, read as JSON from stdin")
+	captureData := flag.StringP("capture-data", "", "", "Write all Traffic Ops data used to generate config to this file, as a data bundle which can be used with --from-data")
+	captureRedact := flag.BoolP("capture-redact", "", false, "Whether to replace secrets, such as secure Parameters and keys, in the --capture-data bundle")
+	fromData := flag.StringP("from-data", "", "", "Generate config from this data bundle written by --capture-data, instead of Traffic Ops. No Traffic Ops arguments are required.")
 	revalOnly := flag.BoolP("revalidate-only", "y", false, "Whether to exclude files not named 'regex_revalidate.config'")
 	disableProxy := flag.BoolP("traffic-ops-disable-proxy", "p", false, "Whether to not use the Traffic Ops proxy specified in the GLOBAL Parameter tm.rev_proxy.url")
 	dir := flag.StringP("dir", "D", "", "ATS config directory, used for config files without location parameters or with relative paths. May be blank. If blank and any required config file location parameter is missing or relative, will error.")
@@ -118,6 +126,28 @@ func GetCfg() (Cfg, error) {
 		return Cfg{ListPlugins: true}, nil
 	}
 
+	if *fromData != "" {
+		if *getData != "" || *setQueueStatus != "" || *setRevalStatus != "" || *setConfigState || *captureData != "" {
+			return Cfg{}, errors.New("--from-data may only be used to generate config, not with --get-data, --set-queue-status, --set-reval-status, --set-config-state, or --capture-data")
+		}
+		cfg := Cfg{
+			LogLocationErr:  *logLocationErr,
+			LogLocationWarn: *logLocationWarn,
+			LogLocationInfo: *logLocationInfo,
+			CacheHostName:   *cacheHostName,
+			FromData:        *fromData,
+			RevalOnly:       *revalOnly,
+			Dir:             *dir,
+			ViaRelease:      *viaRelease,
+			SetDNSLocalBind: *dnsLocalBind,
+			ParentComments:  !(*disableParentConfigComments),
+		}
+		if err := log.InitCfg(cfg); err != nil {
+			return Cfg{}, errors.New("Initializing loggers: " + err.Error() + "\n")
+		}
+		return cfg, nil
+	}
+
 	urlSourceStr := "argument" // for error messages
 	if *toURL == "" {
 		urlSourceStr = "environment variable"
@@ -170,9 +200,12 @@ func GetCfg() (Cfg, error) {
 		TOUser:          *toUser,
 		ListPlugins:     *listPlugins,
 		CacheHostName:   *cacheHostName,
+		CaptureData:     *captureData,
+		CaptureRedact:   *captureRedact,
 		GetData:         *getData,
 		SetRevalStatus:  *setRevalStatus,
 		SetQueueStatus:  *setQueueStatus,
+		SetConfigState:  *setConfigState,
 		RevalOnly:       *revalOnly,
 		DisableProxy:    *disableProxy,
 		Dir:             *dir,
@@ -240,6 +273,9 @@ type TOData struct {
 	// CacheKeyParams must be all Parameters with the ConfigFile atscfg.CacheKeyParameterConfigFile.
 	CacheKeyParams []tc.Parameter
 
+	// SNIParams must be all Parameters with the ConfigFile atscfg.SNIParameterConfigFile.
+	SNIParams []tc.Parameter
+
 	// ParentConfigParams must be all Parameters with the ConfigFile "parent.config.
 	ParentConfigParams []tc.Parameter
 
@@ -18,7 +18,7 @@
  */
 
 // package getdata gets and posts non-config data from Traffic Ops which is related to config generation and needed by ORT.
-// For example, the --get-data, --set-queue-status, and --set-reval-status arguments.
+// For example, the --get-data, --set-queue-status, --set-reval-status, and --set-config-state arguments.
 package getdata
 
 import (
@@ -206,3 +206,23 @@ func SetUpdateStatus(cfg config.TCCfg, serverName tc.CacheName, queue bool, reva
 	}
 	return nil
 }
+
+// SetConfigState reads the JSON config state of the server from input, and sets it in Traffic Ops.
+func SetConfigState(cfg config.TCCfg, input io.Reader) error {
+	req := tc.ServerConfigStateRequest{}
+	if err := json.NewDecoder(input).Decode(&req); err != nil {
+		return errors.New("decoding config state: " + err.Error())
+	}
+
+	server, _, err := cfg.TOClient.GetServerByHostName(cfg.CacheHostName)
+	if err != nil {
+		return errors.New("getting server '" + cfg.CacheHostName + "': " + err.Error())
+	} else if server.ID == nil {
+		return errors.New("server '" + cfg.CacheHostName + "' missing ID")
+	}
+
+	if _, err := cfg.TOClient.SetServerConfigState(*server.ID, req); err != nil {
+		return err
+	}
+	return nil
+}
@@ -630,3 +630,16 @@ func (cl *TOClient) GetServerUpdateStatus(cacheHostName tc.CacheName) (tc.Server
 	}
 	return status, toAddr, nil
 }
+
+// SetServerConfigState posts the config state of the given server to Traffic Ops, and returns the Traffic Ops address and any error.
+// This isn't supported by the previous major Traffic Ops API version, and returns an error if the client fell back.
+func (cl *TOClient) SetServerConfigState(serverID int, req tc.ServerConfigStateRequest) (net.Addr, error) {
+	if cl.C == nil {
+		return nil, errors.New("setting server config state: not supported by the previous major Traffic Ops API version")
+	}
+	_, reqInf, err := cl.C.SetServerConfigState(serverID, req, nil)
+	if err != nil {
+		return reqInf.RemoteAddr, errors.New("setting server config state in Traffic Ops '" + torequtil.MaybeIPStr(reqInf.RemoteAddr) + "': " + err.Error())
+	}
+	return reqInf.RemoteAddr, nil
+}
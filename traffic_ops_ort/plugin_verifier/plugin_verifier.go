@@ -18,6 +18,11 @@ Description
   existence in the filesystem or relative to the ATS configuration files
   directory is verified.
 
+  The configs of known plugins are also validated: header_rewrite rule
+  syntax, regex_remap regexes, url_sig keys, uri_signing JSON keys, cachekey
+  parameters, and regex_revalidate lines. Each invalid config is logged with
+  its file, line, and reason.
+
   The configuration file argument is optional.  If no config file argument is
   supplied, the plugin_verifier reads its config file input from 'stdin'
 
@@ -28,9 +33,9 @@ Options
   --trafficserver-config-dir=[value] | -c [value], where to find ATS config files, default is '/opt/trafficserver/etc/trafficserver' --trafficserver-plugin-dir=[value] | -p [value], where to find ATS plugins, default is '/opt/trafficserver/libexec/trafficserver' --help | -h, this help message
 
 Exit Status
-  Returns 0 if no missing plugin DSO or config files are found.
-  Otherwise the total number of missing plugin DSO and config files
-  are returned.
+  Returns 0 if no missing plugin DSO or config files or invalid plugin configs
+  are found. Otherwise the total number of missing plugin DSO and config files
+  and invalid plugin configs are returned.
 */
 
 package main
@@ -66,6 +71,7 @@ import (
 
 	"github.com/apache/trafficcontrol/lib/go-log"
 	"github.com/apache/trafficcontrol/traffic_ops_ort/plugin_verifier/config"
+	"github.com/apache/trafficcontrol/traffic_ops_ort/t3cutil"
 )
 
 var (
@@ -261,6 +267,32 @@ func verifyPlugin(filename string) bool {
 	return true
 }
 
+// readPluginConfigfile returns the contents of a plugin config file, at the
+// complete file path or relative to the ATS configuration files directory.
+func readPluginConfigfile(filename string) ([]byte, error) {
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(cfg.TrafficServerConfigDir, filename)
+	}
+	return ioutil.ReadFile(filename)
+}
+
+// validate the configs of the plugins used in the config file text, with
+// the validators for known plugins, e.g. header_rewrite and url_sig.
+//
+// Returns the count of invalid plugin configs, not including warnings.
+func validatePluginConfigs(filename string, text string) int {
+	invalid := 0
+	for _, err := range t3cutil.ValidatePluginConfigs(filename, text, readPluginConfigfile) {
+		if err.Warning {
+			log.Warnf("plugin config may be invalid: %s\n", err.Error())
+			continue
+		}
+		log.Errorf("invalid plugin config: %s\n", err.Error())
+		invalid++
+	}
+	return invalid
+}
+
 func main() {
 	// The count of plugins that could not be verified is returned
 	// to the calling program.
@@ -283,6 +315,7 @@ func main() {
 
 	var scanner *bufio.Scanner
 	var reader io.Reader
+	filename := "stdin"
 
 	// open the indicated 'filename' argument or os.Stdin.
 	length := len(args)
@@ -290,6 +323,7 @@ func main() {
 	case 0:
 		reader = os.Stdin
 	case 1:
+		filename = args[0]
 		reader, err = os.Open(args[0])
 		if err != nil {
 			log.Errorf("%v\n", err)
@@ -305,11 +339,13 @@ func main() {
 	lineNumber := 1
 	line := ""
 	textArray := make([]string, 0)
+	allText := make([]string, 0)
 
 	// scan the stream line by line
 	for scanner.Scan() {
 		text := scanner.Text()
 		log.Debugf("parsing: %s\n", text)
+		allText = append(allText, text)
 
 		// skip lines beginning with a comment.
 		if strings.HasPrefix(text, "#") {
@@ -332,6 +368,9 @@ func main() {
 		textArray = make([]string, 0)
 	}
 
+	// validate the plugin configs, once all the plugins and their config files are verified.
+	pluginErrorCount += validatePluginConfigs(filename, strings.Join(allText, "\n"))
+
 	if pluginErrorCount > 0 {
 		log.Errorf("there are '%d' plugins that could not be verified\n", pluginErrorCount)
 		os.Exit(pluginErrorCount)
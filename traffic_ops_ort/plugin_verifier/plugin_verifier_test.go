@@ -100,3 +100,10 @@ func TestBadPluConfig(t *testing.T) {
 		t.Errorf("expected 0 errors got %d errors\n", rc)
 	}
 }
+
+func TestBadPluginConfigRemapConfig(t *testing.T) {
+	rc, _ := plugin_verifier_exec("./test-files/etc/bad-plugin-config-remap.config", t)
+	if rc != -1 {
+		t.Errorf("expected invalid plugin configs to be errors, got %d errors\n", rc)
+	}
+}
@@ -22,17 +22,17 @@ package main
 import (
 	"fmt"
 	"os"
-	"regexp"
+	"path/filepath"
 	"strings"
 
 	"github.com/apache/trafficcontrol/traffic_ops_ort/t3cutil"
-	"github.com/kylelemons/godebug/diff"
 	"github.com/pborman/getopt/v2"
 )
 
 func main() {
 	tropsFile := getopt.StringLong("trops-file", 't', "", "Required: Config file name in Traffic Ops")
 	diskFile := getopt.StringLong("disk-file", 'd', "", "Required: Config file on disk")
+	fileName := getopt.StringLong("file-name", 'n', "", "Config file name, which determines its format. Default is the name of the disk file")
 	help := getopt.BoolLong("help", 'h', "Print usage info and exit")
 	getopt.ParseV2()
 
@@ -44,28 +44,13 @@ func main() {
 		getopt.PrintUsage(os.Stdout)
 		os.Exit(1)
 	}
+	if *fileName == "" {
+		*fileName = filepath.Base(*diskFile)
+	}
 	trafOpsInput := t3cutil.ReadFile(*tropsFile)
 	diskInput := t3cutil.ReadFile(*diskFile)
 
-	trOpsData := strings.Split(string(trafOpsInput), "\n")
-	trOpsData = t3cutil.UnencodeFilter(trOpsData)
-	trOpsData = t3cutil.CommentsFilter(trOpsData)
-	trOps := strings.Join(trOpsData, "\n")
-	trOps = t3cutil.NewLineFilter(trOps)
-
-	diskData := strings.Split(string(diskInput), "\n")
-	diskData = t3cutil.UnencodeFilter(diskData)
-	diskData = t3cutil.CommentsFilter(diskData)
-	disk := strings.Join(diskData, "\n")
-	disk = t3cutil.NewLineFilter(disk)
-
-	if trOps != disk {
-		match := regexp.MustCompile(`(?m)^\+.*|^-.*`)
-		changes := diff.Diff(disk, trOps)
-		for _, change := range match.FindAllString(changes, -1) {
-			fmt.Println(change)
-		}
-	} else {
-		os.Exit(0)
+	for _, change := range t3cutil.SemanticDiff(*fileName, string(diskInput), string(trafOpsInput)) {
+		fmt.Println(change)
 	}
 }
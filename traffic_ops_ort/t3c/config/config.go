@@ -38,9 +38,16 @@ var TSConfigDir string = "/opt/trafficserver/etc/trafficserver"
 const (
 	StatusDir          = "/opt/ort/status"
 	AtsTcConfig        = "/opt/ort/atstccfg"
+	Apt                = "/usr/bin/apt-get"
+	AptCache           = "/usr/bin/apt-cache"
 	Chkconfig          = "/sbin/chkconfig"
+	DNF                = "/usr/bin/dnf"
+	DpkgQuery          = "/usr/bin/dpkg-query"
+	Env                = "/usr/bin/env"
+	Rpm                = "/bin/rpm"
 	Service            = "/sbin/service"
 	SystemCtl          = "/bin/systemctl"
+	Yum                = "/usr/bin/yum"
 	TmpBase            = "/tmp/ort"
 	TrafficCtl         = "/bin/traffic_ctl"
 	TrafficServerOwner = "ats"
@@ -69,6 +76,25 @@ func (m Mode) String() string {
 	return ""
 }
 
+type ReportFormat string
+
+const (
+	ReportFormatText    = ReportFormat("text")
+	ReportFormatJSON    = ReportFormat("json")
+	ReportFormatInvalid = ReportFormat("")
+)
+
+func StrToReportFormat(str string) ReportFormat {
+	switch ReportFormat(strings.ToLower(strings.TrimSpace(str))) {
+	case ReportFormatText:
+		return ReportFormatText
+	case ReportFormatJSON:
+		return ReportFormatJSON
+	default:
+		return ReportFormatInvalid
+	}
+}
+
 type SvcManagement int
 
 const (
@@ -89,6 +115,31 @@ func (s SvcManagement) String() string {
 	return "Unknown"
 }
 
+// PkgManagement is the OS package manager used to query and install packages.
+type PkgManagement string
+
+const (
+	PkgManagementAuto    = PkgManagement("auto")
+	PkgManagementYum     = PkgManagement("yum")
+	PkgManagementDNF     = PkgManagement("dnf")
+	PkgManagementApt     = PkgManagement("apt")
+	PkgManagementUnknown = PkgManagement("")
+)
+
+// StrToPkgManagement returns the PkgManagement named by str, or PkgManagementUnknown if str isn't a package manager.
+func StrToPkgManagement(str string) PkgManagement {
+	switch pm := PkgManagement(strings.ToLower(strings.TrimSpace(str))); pm {
+	case PkgManagementAuto, PkgManagementYum, PkgManagementDNF, PkgManagementApt:
+		return pm
+	}
+	return PkgManagementUnknown
+}
+
+// IsRPM returns whether the package manager installs RPM packages, and packages can be queried with rpm.
+func (p PkgManagement) IsRPM() bool {
+	return p == PkgManagementYum || p == PkgManagementDNF
+}
+
 type Cfg struct {
 	Dispersion          time.Duration
 	LogLocationDebug    string
@@ -98,10 +149,12 @@ type Cfg struct {
 	LoginDispersion     time.Duration
 	CacheHostName       string
 	SvcManagement       SvcManagement
+	PkgManagement       PkgManagement
 	Retries             int
 	RevalWaitTime       time.Duration
 	ReverseProxyDisable bool
 	RunMode             Mode
+	ReportFormat        ReportFormat
 	SkipOSCheck         bool
 	TOInsecure          bool
 	TOTimeoutMS         time.Duration
@@ -111,6 +164,12 @@ type Cfg struct {
 	DNSLocalBind        bool
 	WaitForParents      bool
 	YumOptions          string
+	// HealthProbeURL is an optional URL requested after applying config, to verify ATS is serving.
+	HealthProbeURL string
+	// HealthWaitTime is how long to wait for ATS to become healthy after applying config, before rolling back.
+	HealthWaitTime time.Duration
+	// RollbackDisable is whether to leave new config in place when ATS fails to reload or become healthy, rather than restoring the previous config.
+	RollbackDisable bool
 	// UseGit is whether to create and maintain a git repo of config changes.
 	// Note this only applies to the ATS config directory inferred or set via the flag.
 	//      It does not do anything for config files generated outside that location.
@@ -146,6 +205,14 @@ func (cfg Cfg) InfoLog() log.LogLocation    { return log.LogLocation(cfg.LogLoca
 func (cfg Cfg) DebugLog() log.LogLocation   { return log.LogLocation(cfg.LogLocationDebug) }
 func (cfg Cfg) EventLog() log.LogLocation   { return log.LogLocation(log.LogLocationNull) } // event logging is not used.
 
+func fileExists(fn string) (bool, os.FileInfo) {
+	info, err := os.Stat(fn)
+	if err != nil {
+		return false, nil
+	}
+	return !info.IsDir(), info
+}
+
 func directoryExists(dir string) (bool, os.FileInfo) {
 	info, err := os.Stat(dir)
 	if os.IsNotExist(err) {
@@ -155,17 +222,21 @@ func directoryExists(dir string) (bool, os.FileInfo) {
 }
 
 // derives the ATS Installation directory from
-// the rpm config file list.
-func GetTSPackageHome() string {
+// the package config file list.
+func GetTSPackageHome(pkgManagement PkgManagement) string {
 	var dir []string
 	var output bytes.Buffer
 	var tsHome string = ""
 	var files []string
 
-	cmd := exec.Command("/bin/rpm", "-q", "-c", "trafficserver")
+	cmd := exec.Command(Rpm, "-q", "-c", "trafficserver")
+	if pkgManagement == PkgManagementApt {
+		// each conffile is listed with its checksum, which doesn't contain 'etc/trafficserver'.
+		cmd = exec.Command(DpkgQuery, "--show", "--showformat=${Conffiles}\n", "trafficserver")
+	}
 	cmd.Stdout = &output
 	err := cmd.Run()
-	// on error or if the trafficserver rpm is not installed indicated
+	// on error or if the trafficserver package is not installed indicated
 	// by a return code of '1', return an empty string.
 	if err != nil || cmd.ProcessState.ExitCode() == 1 {
 		return ""
@@ -178,7 +249,7 @@ func GetTSPackageHome() string {
 		for ii := range files {
 			line := strings.TrimSpace(files[ii])
 			if strings.Contains(line, "etc/trafficserver") {
-				dir = strings.Split(line, "/etc")
+				dir = strings.Split(strings.Fields(line)[0], "/etc")
 				break
 			}
 		}
@@ -205,7 +276,9 @@ func GetCfg() (Cfg, error) {
 	revalWaitTimePtr := getopt.IntLong("reval-wait-time", 'T', 60, "[seconds] wait a random number of seconds between 0 and [seconds] before revlidation, default is 60")
 	reverseProxyDisablePtr := getopt.BoolLong("reverse-proxy-disable", 'p', "[false | true] bypass the reverse proxy even if one has been configured default is false")
 	runModePtr := getopt.StringLong("run-mode", 'm', "report", "[badass | report | revalidate | syncds] run mode, default is 'report'")
+	reportFormatPtr := getopt.StringLong("report-format", 0, "text", "[text | json] if json, print a single JSON document describing all config, package, and service changes to stdout on exit, default is 'text'")
 	skipOSCheckPtr := getopt.BoolLong("skip-os-check", 's', "[false | true] skip os check, default is false")
+	pkgManagementPtr := getopt.StringLong("package-manager", 0, "auto", "[auto | yum | dnf | apt] the OS package manager. If auto, the first of yum, dnf, and apt which is installed is used, default is auto")
 	toInsecurePtr := getopt.BoolLong("traffic-ops-insecure", 'I', "[true | false] ignore certificate errors from Traffic Ops")
 	toTimeoutMSPtr := getopt.IntLong("traffic-ops-timeout-milliseconds", 't', 30000, "Timeout in milli-seconds for Traffic Ops requests, default is 30000")
 	toURLPtr := getopt.StringLong("traffic-ops-url", 'u', "", "Traffic Ops URL. Must be the full URL, including the scheme. Required. May also be set with the environment variable TO_URL")
@@ -215,6 +288,9 @@ func GetCfg() (Cfg, error) {
 	waitForParentsPtr := getopt.BoolLong("wait-for-parents", 'W', "[true | false] do not update if parent_pending = 1 in the update json. default is false, wait for parents")
 	dnsLocalBindPtr := getopt.BoolLong("dns-local-bind", 'b', "[true | false] whether to use the server's Service Addresses to set the ATS DNS local bind address")
 	helpPtr := getopt.BoolLong("help", 'h', "Print usage information and exit")
+	healthProbeURLPtr := getopt.StringLong("health-probe-url", 0, "", "URL to request after applying config, to verify ATS is serving. A connection failure or 5xx response fails the apply and rolls back. Default is none")
+	healthWaitTimePtr := getopt.IntLong("health-wait-time", 0, 10, "[seconds] wait up to [seconds] for ATS to become healthy after applying config, before rolling back, default is 10")
+	rollbackDisablePtr := getopt.BoolLong("rollback-disable", 0, "[false | true] leave new config in place if ATS fails to reload or become healthy, rather than restoring the previous config, default is false")
 	useGitStr := getopt.StringLong("git", 'g', "auto", "Create and use a git repo in the config directory. Options are yes, no, and auto. If yes, create and use. If auto, use if it exist. Default is auto.")
 	getopt.Parse()
 
@@ -252,6 +328,9 @@ func GetCfg() (Cfg, error) {
 	toPass := *toPassPtr
 	waitForParents := *waitForParentsPtr
 	dnsLocalBind := *dnsLocalBindPtr
+	healthProbeURL := *healthProbeURLPtr
+	healthWaitTime := time.Second * time.Duration(*healthWaitTimePtr)
+	rollbackDisable := *rollbackDisablePtr
 	help := *helpPtr
 
 	if help {
@@ -259,6 +338,21 @@ func GetCfg() (Cfg, error) {
 		return Cfg{}, nil
 	}
 
+	reportFormat := StrToReportFormat(*reportFormatPtr)
+	if reportFormat == ReportFormatInvalid {
+		return Cfg{}, errors.New("Invalid report format '" + *reportFormatPtr + "'. Valid options are text, json.")
+	}
+	// the JSON report must be the only thing written to stdout, so it can be parsed.
+	stdout := os.Stdout
+	if reportFormat == ReportFormatJSON {
+		stdout = os.Stderr
+		for _, logLocation := range []string{logLocationDebug, logLocationError, logLocationInfo, logLocationWarn} {
+			if logLocation == log.LogLocationStdout {
+				return Cfg{}, errors.New("--report-format=json requires that no logs are written to stdout")
+			}
+		}
+	}
+
 	runModeStr := strings.ToUpper(*runModePtr)
 	runMode := Mode(Report)
 	switch runModeStr {
@@ -287,29 +381,36 @@ func GetCfg() (Cfg, error) {
 		toPass = os.Getenv("TO_PASS")
 	}
 
+	pkgManagement := StrToPkgManagement(*pkgManagementPtr)
+	if pkgManagement == PkgManagementUnknown {
+		return Cfg{}, errors.New("Invalid package manager '" + *pkgManagementPtr + "'. Valid options are auto, yum, dnf, apt.")
+	} else if pkgManagement == PkgManagementAuto {
+		pkgManagement = getOSPkgManagement()
+	}
+
 	// set TSHome
 	var tsHome = ""
 	if *tsHomePtr != "" {
 		tsHome = *tsHomePtr
-		fmt.Printf("set TSHome from command line: '%s'\n\n", TSHome)
+		fmt.Fprintf(stdout, "set TSHome from command line: '%s'\n\n", TSHome)
 	}
-	if *tsHomePtr == "" { // evironment or rpm check.
+	if *tsHomePtr == "" { // evironment or package check.
 		tsHome = os.Getenv("TS_HOME") // check for the environment variable.
 		if tsHome != "" {
-			fmt.Printf("set TSHome from TS_HOME environment variable '%s'\n", TSHome)
-		} else { // finally check using the config file listing from the rpm package.
-			tsHome = GetTSPackageHome()
+			fmt.Fprintf(stdout, "set TSHome from TS_HOME environment variable '%s'\n", TSHome)
+		} else { // finally check using the config file listing from the package.
+			tsHome = GetTSPackageHome(pkgManagement)
 			if tsHome != "" {
-				fmt.Printf("set TSHome from the RPM config file  list '%s'\n", tsHome)
+				fmt.Fprintf(stdout, "set TSHome from the package config file list '%s'\n", tsHome)
 			} else {
-				fmt.Printf("no override for TSHome was found, using the configured default: '%s'\n", TSHome)
+				fmt.Fprintf(stdout, "no override for TSHome was found, using the configured default: '%s'\n", TSHome)
 			}
 		}
 	}
 	if tsHome != "" {
 		TSHome = tsHome
 		TSConfigDir = tsHome + "/etc/trafficserver"
-		fmt.Printf("TSHome: %s, TSConfigDir: %s\n", TSHome, TSConfigDir)
+		fmt.Fprintf(stdout, "TSHome: %s, TSConfigDir: %s\n", TSHome, TSConfigDir)
 	}
 
 	usageStr := "basic usage: t3c  --traffic-ops-url=myurl --traffic-ops-user=myuser --traffic-ops-password=mypass --cache-host-name=my-cache"
@@ -345,10 +446,12 @@ func GetCfg() (Cfg, error) {
 		LoginDispersion:     loginDispersion,
 		CacheHostName:       cacheHostName,
 		SvcManagement:       svcManagement,
+		PkgManagement:       pkgManagement,
 		Retries:             retries,
 		RevalWaitTime:       revalWaitTime,
 		ReverseProxyDisable: reverseProxyDisable,
 		RunMode:             runMode,
+		ReportFormat:        reportFormat,
 		SkipOSCheck:         skipOsCheck,
 		TOInsecure:          toInsecure,
 		TOTimeoutMS:         toTimeoutMS,
@@ -358,6 +461,9 @@ func GetCfg() (Cfg, error) {
 		DNSLocalBind:        dnsLocalBind,
 		WaitForParents:      waitForParents,
 		YumOptions:          yumOptions,
+		HealthProbeURL:      healthProbeURL,
+		HealthWaitTime:      healthWaitTime,
+		RollbackDisable:     rollbackDisable,
 		UseGit:              useGit,
 	}
 
@@ -393,20 +499,29 @@ func isCommandAvailable(name string) bool {
 	return true
 }
 
+// getOSSvcManagement returns the service management of the OS. SystemV requires chkconfig to enable services, SystemD doesn't.
 func getOSSvcManagement() SvcManagement {
-	var _svcManager SvcManagement
-
 	if isCommandAvailable(SystemCtl) {
-		_svcManager = SystemD
-	} else if isCommandAvailable(Service) {
-		_svcManager = SystemV
+		return SystemD
 	}
-	if !isCommandAvailable(Chkconfig) {
-		return Unknown
+	if isCommandAvailable(Service) && isCommandAvailable(Chkconfig) {
+		return SystemV
 	}
+	return Unknown
+}
 
-	// we have what we need
-	return _svcManager
+// getOSPkgManagement returns the package manager of the OS, preferring yum where both yum and dnf are installed, as on CentOS 8.
+func getOSPkgManagement() PkgManagement {
+	if ok, _ := fileExists(Yum); ok {
+		return PkgManagementYum
+	}
+	if ok, _ := fileExists(DNF); ok {
+		return PkgManagementDNF
+	}
+	if ok, _ := fileExists(Apt); ok {
+		return PkgManagementApt
+	}
+	return PkgManagementUnknown
 }
 
 func printConfig(cfg Cfg) {
@@ -418,10 +533,12 @@ func printConfig(cfg Cfg) {
 	log.Debugf("LoginDispersion: %d\n", cfg.LoginDispersion)
 	log.Debugf("CacheHostName: %s\n", cfg.CacheHostName)
 	log.Debugf("SvcManagement: %s\n", cfg.SvcManagement)
+	log.Debugf("PkgManagement: %s\n", cfg.PkgManagement)
 	log.Debugf("Retries: %d\n", cfg.Retries)
 	log.Debugf("RevalWaitTime: %d\n", cfg.RevalWaitTime)
 	log.Debugf("ReverseProxyDisable: %t\n", cfg.ReverseProxyDisable)
 	log.Debugf("RunMode: %s\n", cfg.RunMode)
+	log.Debugf("ReportFormat: %s\n", cfg.ReportFormat)
 	log.Debugf("SkipOSCheck: %t\n", cfg.SkipOSCheck)
 	log.Debugf("TOInsecure: %t\n", cfg.TOInsecure)
 	log.Debugf("TOTimeoutMS: %d\n", cfg.TOTimeoutMS)
@@ -431,6 +548,9 @@ func printConfig(cfg Cfg) {
 	log.Debugf("TSHome: %s\n", TSHome)
 	log.Debugf("WaitForParents: %t\n", cfg.WaitForParents)
 	log.Debugf("YumOptions: %s\n", cfg.YumOptions)
+	log.Debugf("HealthProbeURL: %s\n", cfg.HealthProbeURL)
+	log.Debugf("HealthWaitTime: %d\n", cfg.HealthWaitTime)
+	log.Debugf("RollbackDisable: %t\n", cfg.RollbackDisable)
 }
 
 func Usage() {
@@ -443,11 +563,13 @@ func Usage() {
 	fmt.Println("\t  --log-location-info=[value] | -i [value], Where to log info. May be a file path, stdout, stderr, or null, default stderr")
 	fmt.Println("\t  --log-location-warning=[value] | -w [value], Where to log warnings. May be a file path, stdout, stderr, or null, default stderr")
 	fmt.Println("\t  --run-mode=[mode] | -m [mode] where mode is one of [ report | badass | syncds | revalidate ], default = report")
+	fmt.Println("\t  --report-format=[format] where format is one of [ text | json ]. If json, a single JSON document describing all config, package, and service changes is printed to stdout on exit, default = text")
 	fmt.Println("\t  --cache-hostname=[hostname] | -H [hostname], Host name of the cache to generate config for. Must be the server host name in Traffic Ops, not a URL, and not the FQDN")
 	fmt.Println("\t  --num-retries=[number] | -r [number], retry connection to Traffic Ops URL [number] times, default is 3")
 	fmt.Println("\t  --reval-wait-time=[seconds] | -T [seconds] wait a random number of seconds between 0 and [seconds] before revlidation, default is 60")
 	fmt.Println("\t  --rev-proxy-disable=[true|false] | -p [true|false] bypass the reverse proxy even if one has been configured, default = false")
-	fmt.Println("\t  --skip-os-check=[true|false] | -s [true | false] bypass the check for a supported CentOS version. default = false")
+	fmt.Println("\t  --skip-os-check=[true|false] | -s [true | false] bypass the check for supported package and service management tools. default = false")
+	fmt.Println("\t  --package-manager=[manager] where manager is one of [ auto | yum | dnf | apt ]. If auto, the first of yum, dnf, and apt which is installed is used, default = auto")
 	fmt.Println("\t  --traffic-ops-insecure=[true|false] -I [true | false] Whether to ignore HTTPS certificate errors from Traffic Ops. It is HIGHLY RECOMMENDED to never use this in a production environment, but only for debugging, default = false")
 	fmt.Println("\t  --traffic-ops-timeout-milliseconds=[milliseconds] | -t [milliseconds] the Traffic Ops request timeout in milliseconds. Default = 30000 (30 seconds)")
 	fmt.Println("\t  --traffic-ops-url=[url] | -u [url], Traffic Ops URL. Must be the full URL, including the scheme. Required. May also be set with the environment variable TO_URL")
@@ -455,5 +577,8 @@ func Usage() {
 	fmt.Println("\t  --traffic-ops-password=[password] | -P [password], Traffic Ops password. Required. May also be set with the environment variable TO_PASS")
 	fmt.Println("\t  --trafficserver-home=[value] | -R [value], Trafficserver Package directory. May also be set with the environment variable TS_HOME")
 	fmt.Println("\t  --wait-for-parents | -W [true | false] do not update if parent_pending = 1 in the update json. default = true, wait for parents\n")
+	fmt.Println("\t  --health-probe-url=[url], URL to request after applying config, to verify ATS is serving. A connection failure or 5xx response fails the apply and rolls back. Default is none")
+	fmt.Println("\t  --health-wait-time=[seconds], wait up to [seconds] for ATS to become healthy after applying config, before rolling back, default = 10")
+	fmt.Println("\t  --rollback-disable=[true|false], leave new config in place if ATS fails to reload or become healthy, rather than restoring the previous config, default = false")
 	fmt.Println("\t  --help | -h, Print usage information and exit")
 }
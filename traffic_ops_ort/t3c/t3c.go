@@ -41,8 +41,24 @@ const (
 	ServicesError     = 138
 	SyncDSError       = 139
 	UserCheckError    = 140
+	ApplyError        = 141
 )
 
+// exitStatuses are the names of the exit codes, for the JSON report.
+var exitStatuses = map[int]string{
+	Success:           "Success",
+	AlreadyRunning:    "AlreadyRunning",
+	ConfigFilesError:  "ConfigFilesError",
+	ConfigError:       "ConfigError",
+	GeneralFailure:    "GeneralFailure",
+	PackagingError:    "PackagingError",
+	RevalidationError: "RevalidationError",
+	ServicesError:     "ServicesError",
+	SyncDSError:       "SyncDSError",
+	UserCheckError:    "UserCheckError",
+	ApplyError:        "ApplyError",
+}
+
 func runSysctl(cfg config.Cfg) {
 	if cfg.RunMode == config.BadAss {
 		_, rc, err := util.ExecCommand("/usr/sbin/sysctl", "-p")
@@ -86,26 +102,35 @@ func main() {
 
 	trops := torequest.NewTrafficOpsReq(cfg)
 
-	// if doing os checks, insure there is a 'systemctl' or 'service' and 'chkconfig' commands.
+	// if doing os checks, insure there is a 'systemctl' or 'service' and 'chkconfig' commands,
+	// and a known package manager.
 	if !cfg.SkipOSCheck && cfg.SvcManagement == config.Unknown {
 		log.Errorln("OS checks are enabled and unable to find any know service management tools.")
 	}
+	if !cfg.SkipOSCheck && cfg.PkgManagement == config.PkgManagementUnknown {
+		log.Errorln("OS checks are enabled and unable to find any known package manager, one of yum, dnf, or apt.")
+	}
 
 	// create and clean the config.TmpBase (/tmp/ort)
-	if !util.MkDir(config.TmpBase, cfg) {
-		os.Exit(GeneralFailure)
-	} else if !util.CleanTmpDir() {
+	if !util.MkDir(config.TmpBase, cfg) || !util.CleanTmpDir() {
+		WriteReport(GeneralFailure, cfg, trops)
 		os.Exit(GeneralFailure)
 	}
 	if cfg.RunMode != config.Report {
 		if !lock.GetLock(config.TmpBase + "/to_ort.lock") {
+			WriteReport(AlreadyRunning, cfg, trops)
 			os.Exit(AlreadyRunning)
 		}
 	}
 
-	fmt.Println(time.Now().Format(time.UnixDate))
+	if cfg.ReportFormat == config.ReportFormatJSON {
+		fmt.Fprintln(os.Stderr, time.Now().Format(time.UnixDate))
+	} else {
+		fmt.Println(time.Now().Format(time.UnixDate))
+	}
 
 	if !util.CheckUser(cfg) {
+		WriteReport(UserCheckError, cfg, trops)
 		lock.UnlockAndExit(UserCheckError)
 	}
 
@@ -120,16 +145,16 @@ func main() {
 			if err != nil {
 				log.Errorln(err)
 			}
-			GitCommitAndExit(RevalidationError, cfg)
+			GitCommitAndExit(RevalidationError, cfg, trops)
 		}
 	} else {
 		syncdsUpdate, err = trops.CheckSyncDSState()
 		if err != nil {
 			log.Errorln(err)
-			GitCommitAndExit(SyncDSError, cfg)
+			GitCommitAndExit(SyncDSError, cfg, trops)
 		}
 		if cfg.RunMode == config.SyncDS && syncdsUpdate == torequest.UpdateTropsNotNeeded {
-			GitCommitAndExit(Success, cfg)
+			GitCommitAndExit(Success, cfg, trops)
 		}
 	}
 
@@ -140,14 +165,14 @@ func main() {
 		err = trops.ProcessPackages()
 		if err != nil {
 			log.Errorf("Error processing packages: %s\n", err)
-			GitCommitAndExit(PackagingError, cfg)
+			GitCommitAndExit(PackagingError, cfg, trops)
 		}
 
 		// check and make sure packages are enabled for startup
 		err = trops.CheckSystemServices()
 		if err != nil {
 			log.Errorf("Error verifying system services: %s\n", err.Error())
-			GitCommitAndExit(ServicesError, cfg)
+			GitCommitAndExit(ServicesError, cfg, trops)
 		}
 	}
 
@@ -155,7 +180,7 @@ func main() {
 	err = trops.GetConfigFileList()
 	if err != nil {
 		log.Errorf("Unable to continue: %s\n", err)
-		GitCommitAndExit(ConfigFilesError, cfg)
+		GitCommitAndExit(ConfigFilesError, cfg, trops)
 	}
 	syncdsUpdate, err = trops.ProcessConfigFiles()
 	if err != nil {
@@ -174,18 +199,24 @@ func main() {
 
 	// start trafficserver
 	result := trops.StartServices(&syncdsUpdate)
+
+	// verify ATS is healthy with the new config, and roll back if not
+	applied := trops.VerifyApply(&syncdsUpdate, result)
 	if !result {
 		log.Errorf("failed to start services.\n")
-		GitCommitAndExit(ServicesError, cfg)
+		GitCommitAndExit(ServicesError, cfg, trops)
+	} else if !applied {
+		log.Errorf("failed to apply config, stage '%s' file '%s': %s\n", trops.ApplyResult.FailedStage, trops.ApplyResult.FailedFile, trops.ApplyResult.Error)
+		GitCommitAndExit(ApplyError, cfg, trops)
 	}
 
 	// start 'teakd' if installed.
-	if trops.IsPackageInstalled("teakd") {
-		svcStatus, pid, err := util.GetServiceStatus("teakd")
+	if trops.IsPackageInstalled("teakd") && trops.ServiceManager != nil {
+		svcStatus, pid, err := trops.ServiceManager.Status("teakd")
 		if err != nil {
 			log.Errorf("not starting 'teakd', error getting 'teakd' run status: %s\n", err)
 		} else if svcStatus == util.SvcNotRunning {
-			running, err := util.ServiceStart("teakd", "start")
+			running, err := trops.ServiceManager.Start("teakd", "start")
 			if err != nil {
 				log.Errorf("'teakd' was not started: %s\n", err)
 			} else if running {
@@ -209,20 +240,34 @@ func main() {
 		log.Infoln("Traffic Ops has been updated.")
 	}
 
-	GitCommitAndExit(Success, cfg)
+	GitCommitAndExit(Success, cfg, trops)
 }
 
 // TODO change code to always create git commits, if the dir is a repo
 // We only want --use-git to init the repo. If someone init'd the repo, t3c should _always_ commit.
 // We don't want someone doing manual badass's and not having that log
 
-// GitCommitAndExit attempts to git commit all changes, logs any error, and calls os.Exit with the given code.
-func GitCommitAndExit(exitCode int, cfg config.Cfg) {
+// GitCommitAndExit attempts to git commit all changes, logs any error, sends the config state to Traffic Ops, writes the report, and calls os.Exit with the given code.
+func GitCommitAndExit(exitCode int, cfg config.Cfg, trops *torequest.TrafficOpsReq) {
 	success := exitCode == Success
 	if cfg.UseGit == config.UseGitYes || cfg.UseGit == config.UseGitAuto {
 		if err := util.MakeGitCommitAll(config.TSConfigDir, util.GitChangeIsSelf, cfg.RunMode, success); err != nil {
 			log.Errorln("git committing existing changes, dir '" + config.TSConfigDir + "': " + err.Error())
 		}
 	}
+	if err := trops.SendConfigState(success, exitStatuses[exitCode]); err != nil {
+		log.Warnln("Traffic Ops config state not updated: " + err.Error())
+	}
+	WriteReport(exitCode, cfg, trops)
 	os.Exit(exitCode)
 }
+
+// WriteReport prints the JSON report to stdout, if the report format is JSON.
+func WriteReport(exitCode int, cfg config.Cfg, trops *torequest.TrafficOpsReq) {
+	if cfg.ReportFormat != config.ReportFormatJSON {
+		return
+	}
+	if err := trops.WriteReport(os.Stdout, exitCode, exitStatuses[exitCode]); err != nil {
+		log.Errorln("writing report: " + err.Error())
+	}
+}
@@ -0,0 +1,308 @@
+package torequest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/traffic_ops_ort/t3c/config"
+	"github.com/apache/trafficcontrol/traffic_ops_ort/t3c/util"
+)
+
+// stagedFileSuffix is appended to the path of a config file to get the path it's staged at before being swapped in.
+// Staged files are in the same directory as the file they replace, so the swap is an atomic rename.
+const stagedFileSuffix = ".t3c-staged"
+
+// ApplyResultFileName is the name of the file in the run's backup directory, to which the ApplyResult is written.
+const ApplyResultFileName = "apply_result.json"
+
+// ApplyStage is a step of applying config files.
+type ApplyStage string
+
+const (
+	ApplyStageValidate = ApplyStage("validate")
+	ApplyStageStage    = ApplyStage("stage")
+	ApplyStageSwap     = ApplyStage("swap")
+	ApplyStageReload   = ApplyStage("reload")
+	ApplyStageHealth   = ApplyStage("health")
+	ApplyStageInvalid  = ApplyStage("")
+)
+
+// ApplyResult is the outcome of applying the changed config files from Traffic Ops.
+// It's written to ApplyResultFileName, and reported to Traffic Ops by SendConfigState.
+type ApplyResult struct {
+	// Files is the paths of every config file which was changed, or would have been if the apply hadn't failed.
+	Files []string `json:"files"`
+	// Success is whether all files were applied, ATS was reloaded, and ATS is healthy.
+	Success bool `json:"success"`
+	// FailedStage is the stage at which applying failed, if Success is false.
+	FailedStage ApplyStage `json:"failedStage,omitempty"`
+	// FailedFile is the path of the file which failed to stage or swap, if any.
+	// Note reload and health failures can't be attributed to a single file, so this is empty for them.
+	FailedFile string `json:"failedFile,omitempty"`
+	// Error is the error message of the failure, if Success is false.
+	Error string `json:"error,omitempty"`
+	// RolledBack is whether the previous config files were restored after a failure.
+	RolledBack bool `json:"rolledBack"`
+}
+
+// stageCfgFile writes the given data to the staging path of the given config file, and adds it to the files to be swapped in by swapStagedCfgFiles.
+func (r *TrafficOpsReq) stageCfgFile(cfg *ConfigFile, data []byte) error {
+	stagedPath := cfg.Path + stagedFileSuffix
+	if _, err := r.writeCfgFileTo(cfg, stagedPath, data); err != nil {
+		return errors.New("staging '" + cfg.Path + "': " + err.Error())
+	}
+	r.stagedFiles = append(r.stagedFiles, cfg)
+	r.ApplyResult.Files = append(r.ApplyResult.Files, cfg.Path)
+	return nil
+}
+
+// swapStagedCfgFiles renames all staged config files over the files they replace.
+// If any rename fails, the files which were already swapped are restored, so the config on disk is either entirely old or entirely new.
+func (r *TrafficOpsReq) swapStagedCfgFiles() error {
+	swapped := []*ConfigFile{}
+	for _, cfg := range r.stagedFiles {
+		if err := os.Rename(cfg.Path+stagedFileSuffix, cfg.Path); err != nil {
+			r.failApply(ApplyStageSwap, cfg.Path, err)
+			r.removeStagedCfgFiles()
+			r.restoreCfgFiles(swapped)
+			return errors.New("swapping in '" + cfg.Path + "': " + err.Error())
+		}
+		swapped = append(swapped, cfg)
+	}
+	for _, cfg := range swapped {
+		cfg.ChangeApplied = true
+		log.Debugf("Setting change applied for '%s'\n", cfg.Name)
+		r.setReloadFlags(cfg)
+	}
+	r.appliedFiles = swapped
+	r.stagedFiles = nil
+	return nil
+}
+
+// removeStagedCfgFiles removes any staged files which haven't been swapped in.
+func (r *TrafficOpsReq) removeStagedCfgFiles() {
+	for _, cfg := range r.stagedFiles {
+		if err := os.Remove(cfg.Path + stagedFileSuffix); err != nil && !os.IsNotExist(err) {
+			log.Errorf("removing staged file '%s': %s\n", cfg.Path+stagedFileSuffix, err.Error())
+		}
+	}
+	r.stagedFiles = nil
+}
+
+// restoreCfgFiles restores the backups of the given config files made by backUpFile, or removes them if they didn't exist before.
+// Returns whether every file was restored.
+func (r *TrafficOpsReq) restoreCfgFiles(cfgs []*ConfigFile) bool {
+	restored := true
+	for i := len(cfgs) - 1; i >= 0; i-- {
+		cfg := cfgs[i]
+		if exists, _ := util.FileExists(cfg.CfgBackup); !exists {
+			log.Infof("Rolling back '%s', which didn't previously exist, by removing it\n", cfg.Path)
+			if err := os.Remove(cfg.Path); err != nil && !os.IsNotExist(err) {
+				log.Errorf("rolling back '%s': removing: %s\n", cfg.Path, err.Error())
+				restored = false
+			}
+			cfg.ChangeApplied = false
+			continue
+		}
+		log.Infof("Rolling back '%s' from '%s'\n", cfg.Path, cfg.CfgBackup)
+		data, err := util.ReadFile(cfg.CfgBackup)
+		if err != nil {
+			log.Errorf("rolling back '%s': reading backup: %s\n", cfg.Path, err.Error())
+			restored = false
+			continue
+		}
+		if _, err := r.writeCfgFileTo(cfg, cfg.Path+stagedFileSuffix, data); err != nil {
+			log.Errorf("rolling back '%s': %s\n", cfg.Path, err.Error())
+			restored = false
+			continue
+		}
+		if err := os.Rename(cfg.Path+stagedFileSuffix, cfg.Path); err != nil {
+			log.Errorf("rolling back '%s': %s\n", cfg.Path, err.Error())
+			restored = false
+			continue
+		}
+		cfg.ChangeApplied = false
+	}
+	return restored
+}
+
+// failApply records the failure of applying config files in r.ApplyResult.
+func (r *TrafficOpsReq) failApply(stage ApplyStage, file string, err error) {
+	r.ApplyResult.Success = false
+	r.ApplyResult.FailedStage = stage
+	r.ApplyResult.FailedFile = file
+	r.ApplyResult.Error = err.Error()
+}
+
+// VerifyApply checks that ATS is healthy after config files were applied and services were started or reloaded.
+// The startSuccess argument is the result of StartServices.
+// If applying failed or ATS isn't healthy, the previous config files are restored and ATS is reloaded again, unless rollback is disabled.
+// Returns whether the new config was successfully applied. If no config files were changed, returns startSuccess.
+func (r *TrafficOpsReq) VerifyApply(syncdsUpdate *UpdateStatus, startSuccess bool) bool {
+	if len(r.appliedFiles) == 0 {
+		if r.ApplyResult.FailedStage != ApplyStageInvalid {
+			r.writeApplyResult()
+			return false
+		}
+		return startSuccess
+	}
+
+	err := error(nil)
+	if !startSuccess {
+		err = errors.New("failed to start or reload services")
+		r.failApply(ApplyStageReload, "", err)
+	} else if err = r.waitForATSHealth(); err != nil {
+		r.failApply(ApplyStageHealth, "", err)
+	}
+	if err == nil {
+		r.ApplyResult.Success = true
+		r.appliedFiles = nil
+		r.writeApplyResult()
+		return true
+	}
+
+	log.Errorf("applying config failed, ATS is not healthy: %s\n", err.Error())
+	if *syncdsUpdate == UpdateTropsNeeded || *syncdsUpdate == UpdateTropsSuccessful {
+		*syncdsUpdate = UpdateTropsFailed
+	}
+	if r.Cfg.RollbackDisable {
+		log.Errorln("rollback is disabled, leaving the new config in place")
+		r.writeApplyResult()
+		return false
+	}
+
+	log.Errorln("rolling back to the previous config")
+	r.ApplyResult.RolledBack = r.restoreCfgFiles(r.appliedFiles)
+	if !r.ApplyResult.RolledBack {
+		log.Errorln("failed to restore all previous config files, ATS config may be inconsistent!")
+	}
+	r.appliedFiles = nil
+	r.reloadATS()
+	if err := r.waitForATSHealth(); err != nil {
+		log.Errorf("ATS is not healthy after rolling back: %s\n", err.Error())
+	} else {
+		log.Infoln("ATS is healthy after rolling back")
+	}
+	r.writeApplyResult()
+	return false
+}
+
+// reloadATS reloads or restarts ATS, whichever the changed config files required. It's used after rolling back.
+func (r *TrafficOpsReq) reloadATS() {
+	if !r.IsPackageInstalled("trafficserver") {
+		return
+	}
+	svcStatus, _, err := r.getServiceStatus("trafficserver")
+	if err != nil {
+		log.Errorf("error getting 'trafficserver' run status: %s\n", err.Error())
+		return
+	}
+	if r.TrafficServerRestart || svcStatus != util.SvcRunning {
+		cmd := "restart"
+		if svcStatus != util.SvcRunning {
+			cmd = "start"
+		}
+		if _, err := r.startService("trafficserver", cmd); err != nil {
+			log.Errorf("failed to %s trafficserver: %s\n", cmd, err.Error())
+		}
+		return
+	}
+	if r.TrafficCtlReload {
+		if _, _, err := util.ExecCommand(config.TSHome+config.TrafficCtl, "config", "reload"); err != nil {
+			log.Errorf("'traffic_ctl config reload' failed: %s\n", err.Error())
+		}
+	}
+}
+
+// waitForATSHealth checks ATS health until it's healthy or the configured health wait time elapses.
+// Returns nil if ATS is healthy, or the last health check error.
+func (r *TrafficOpsReq) waitForATSHealth() error {
+	deadline := time.Now().Add(r.Cfg.HealthWaitTime)
+	for {
+		err := r.checkATSHealth()
+		if err == nil || !time.Now().Before(deadline) {
+			return err
+		}
+		log.Infof("ATS is not yet healthy, retrying: %s\n", err.Error())
+		time.Sleep(time.Second)
+	}
+}
+
+// checkATSHealth returns nil if ATS is running, 'traffic_ctl config status' succeeds, and the health probe URL, if configured, doesn't return a server error.
+// If trafficserver isn't installed, it's considered healthy, because there's nothing to check.
+func (r *TrafficOpsReq) checkATSHealth() error {
+	if !r.IsPackageInstalled("trafficserver") {
+		return nil
+	}
+	svcStatus, _, err := r.getServiceStatus("trafficserver")
+	if err != nil {
+		return errors.New("getting 'trafficserver' run status: " + err.Error())
+	} else if svcStatus != util.SvcRunning {
+		return errors.New("trafficserver is not running")
+	}
+	if _, _, err := util.ExecCommand(config.TSHome+config.TrafficCtl, "config", "status"); err != nil {
+		return errors.New("'traffic_ctl config status' failed: " + err.Error())
+	}
+	if r.Cfg.HealthProbeURL != "" {
+		if err := probeHealth(r.Cfg.HealthProbeURL, r.Cfg.TOTimeoutMS); err != nil {
+			return errors.New("health probe '" + r.Cfg.HealthProbeURL + "' failed: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// probeHealth requests the given URL, and returns an error if the request fails or the response is a server error.
+func probeHealth(url string, timeout time.Duration) error {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return errors.New("response code " + strconv.Itoa(resp.StatusCode))
+	}
+	return nil
+}
+
+// writeApplyResult writes r.ApplyResult as JSON to the run's backup directory, so the outcome of the run can be inspected after t3c exits.
+func (r *TrafficOpsReq) writeApplyResult() {
+	bts, err := json.MarshalIndent(r.ApplyResult, "", "  ")
+	if err != nil {
+		log.Errorf("encoding apply result: %s\n", err.Error())
+		return
+	}
+	if err := os.MkdirAll(r.baseBackupDir, 0755); err != nil {
+		log.Errorf("creating backup directory '%s': %s\n", r.baseBackupDir, err.Error())
+		return
+	}
+	fileName := filepath.Join(r.baseBackupDir, ApplyResultFileName)
+	if _, err := util.WriteFile(fileName, bts, 0644); err != nil {
+		log.Errorf("writing apply result: %s\n", err.Error())
+	}
+}
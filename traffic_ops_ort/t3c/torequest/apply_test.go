@@ -0,0 +1,222 @@
+package torequest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func makeApplyTestCfgFile(t *testing.T, dir string, name string, oldBody string) *ConfigFile {
+	cfg := &ConfigFile{
+		Name:      name,
+		Dir:       dir,
+		Path:      filepath.Join(dir, name),
+		Service:   "trafficserver",
+		CfgBackup: filepath.Join(dir, "backup", name),
+		Perm:      0644,
+		Uid:       os.Getuid(),
+		Gid:       os.Getgid(),
+	}
+	if oldBody != "" {
+		if err := ioutil.WriteFile(cfg.Path, []byte(oldBody), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(cfg.CfgBackup, []byte(oldBody), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cfg
+}
+
+func readApplyTestFile(t *testing.T, path string) (string, bool) {
+	bts, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", false
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return string(bts), true
+}
+
+func TestStageSwapRestoreCfgFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "t3c-apply-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "backup"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	trops := NewTrafficOpsReq(testCfg)
+	trops.baseBackupDir = dir
+
+	remap := makeApplyTestCfgFile(t, dir, "remap.config", "old remap")
+	sni := makeApplyTestCfgFile(t, dir, "sni.yaml", "")
+
+	if err := trops.stageCfgFile(remap, []byte("new remap")); err != nil {
+		t.Fatal(err)
+	}
+	if err := trops.stageCfgFile(sni, []byte("new sni")); err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := readApplyTestFile(t, remap.Path); body != "old remap" {
+		t.Errorf("stageCfgFile expected file unchanged until swap, actual '%v'", body)
+	}
+	if _, exists := readApplyTestFile(t, sni.Path); exists {
+		t.Errorf("stageCfgFile expected new file not to exist until swap, actual exists")
+	}
+	if trops.RemapConfigReload || trops.TrafficCtlReload {
+		t.Errorf("stageCfgFile expected no reload until swap, actual remap %v trafficctl %v", trops.RemapConfigReload, trops.TrafficCtlReload)
+	}
+
+	if err := trops.swapStagedCfgFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := readApplyTestFile(t, remap.Path); body != "new remap" {
+		t.Errorf("swapStagedCfgFiles expected 'new remap', actual '%v'", body)
+	}
+	if body, _ := readApplyTestFile(t, sni.Path); body != "new sni" {
+		t.Errorf("swapStagedCfgFiles expected 'new sni', actual '%v'", body)
+	}
+	if _, exists := readApplyTestFile(t, remap.Path+stagedFileSuffix); exists {
+		t.Errorf("swapStagedCfgFiles expected staged file to be gone, actual exists")
+	}
+	if !remap.ChangeApplied || !sni.ChangeApplied {
+		t.Errorf("swapStagedCfgFiles expected changes applied, actual remap %v sni %v", remap.ChangeApplied, sni.ChangeApplied)
+	}
+	if !trops.TrafficCtlReload {
+		t.Errorf("swapStagedCfgFiles expected traffic_ctl reload, actual false")
+	}
+
+	if !trops.restoreCfgFiles(trops.appliedFiles) {
+		t.Errorf("restoreCfgFiles expected true, actual false")
+	}
+	if body, _ := readApplyTestFile(t, remap.Path); body != "old remap" {
+		t.Errorf("restoreCfgFiles expected 'old remap', actual '%v'", body)
+	}
+	if _, exists := readApplyTestFile(t, sni.Path); exists {
+		t.Errorf("restoreCfgFiles expected new file to be removed, actual exists")
+	}
+}
+
+func TestSwapFailureSetsNoReloadFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "t3c-apply-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "backup"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	trops := NewTrafficOpsReq(testCfg)
+	trops.baseBackupDir = dir
+
+	remap := makeApplyTestCfgFile(t, dir, "remap.config", "old remap")
+	plugin := makeApplyTestCfgFile(t, dir, "plugin.config", "old plugin")
+	if err := trops.stageCfgFile(remap, []byte("new remap")); err != nil {
+		t.Fatal(err)
+	}
+	if err := trops.stageCfgFile(plugin, []byte("new plugin")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(plugin.Path + stagedFileSuffix); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := trops.swapStagedCfgFiles(); err == nil {
+		t.Fatal("swapStagedCfgFiles with missing staged file expected error, actual nil")
+	}
+	if body, _ := readApplyTestFile(t, remap.Path); body != "old remap" {
+		t.Errorf("swapStagedCfgFiles failure expected 'old remap' restored, actual '%v'", body)
+	}
+	if trops.RemapConfigReload || trops.TrafficCtlReload || trops.TrafficServerRestart {
+		t.Errorf("swapStagedCfgFiles failure expected no reload or restart, actual remap %v trafficctl %v restart %v", trops.RemapConfigReload, trops.TrafficCtlReload, trops.TrafficServerRestart)
+	}
+	if remap.ChangeApplied {
+		t.Errorf("swapStagedCfgFiles failure expected change not applied, actual applied")
+	}
+}
+
+func TestVerifyApplyRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "t3c-apply-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "backup"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	trops := NewTrafficOpsReq(testCfg)
+	trops.baseBackupDir = dir
+
+	remap := makeApplyTestCfgFile(t, dir, "remap.config", "old remap")
+	if err := trops.stageCfgFile(remap, []byte("new remap")); err != nil {
+		t.Fatal(err)
+	}
+	if err := trops.swapStagedCfgFiles(); err != nil {
+		t.Fatal(err)
+	}
+
+	updateStatus := UpdateTropsSuccessful
+	if trops.VerifyApply(&updateStatus, false) {
+		t.Errorf("VerifyApply with failed start expected false, actual true")
+	}
+	if updateStatus != UpdateTropsFailed {
+		t.Errorf("VerifyApply with failed start expected update status %v, actual %v", UpdateTropsFailed, updateStatus)
+	}
+	if body, _ := readApplyTestFile(t, remap.Path); body != "old remap" {
+		t.Errorf("VerifyApply with failed start expected rollback to 'old remap', actual '%v'", body)
+	}
+	if !trops.ApplyResult.RolledBack || trops.ApplyResult.FailedStage != ApplyStageReload {
+		t.Errorf("VerifyApply with failed start expected rolled back reload failure, actual %+v", trops.ApplyResult)
+	}
+	if _, exists := readApplyTestFile(t, filepath.Join(dir, ApplyResultFileName)); !exists {
+		t.Errorf("VerifyApply expected apply result file to be written, actual missing")
+	}
+}
+
+func TestProbeHealth(t *testing.T) {
+	code := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}))
+	defer server.Close()
+
+	if err := probeHealth(server.URL, time.Second); err != nil {
+		t.Errorf("probeHealth of 200 expected nil error, actual %v", err)
+	}
+	code = http.StatusNotFound
+	if err := probeHealth(server.URL, time.Second); err != nil {
+		t.Errorf("probeHealth of 404 expected nil error, actual %v", err)
+	}
+	code = http.StatusBadGateway
+	if err := probeHealth(server.URL, time.Second); err == nil {
+		t.Errorf("probeHealth of 502 expected error, actual nil")
+	}
+}
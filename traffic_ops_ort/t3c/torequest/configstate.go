@@ -0,0 +1,91 @@
+package torequest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_ops_ort/t3c/config"
+)
+
+// MakeConfigState returns the config state of this server to send to Traffic Ops.
+//
+// If the config files were fetched from Traffic Ops, the state includes the checksum of every config file on disk,
+// so Traffic Ops can detect drift. Otherwise, e.g. if no update was needed, it's only a check-in.
+// The success and errStatus are the outcome of the run, if it failed before applying config files.
+func (r *TrafficOpsReq) MakeConfigState(success bool, errStatus string) tc.ServerConfigStateRequest {
+	req := tc.ServerConfigStateRequest{
+		RunMode:     r.Cfg.RunMode.String(),
+		Success:     success && r.ApplyResult.FailedStage == ApplyStageInvalid,
+		FailedStage: string(r.ApplyResult.FailedStage),
+		FailedFile:  r.ApplyResult.FailedFile,
+		Error:       r.ApplyResult.Error,
+		RolledBack:  r.ApplyResult.RolledBack,
+	}
+	if !req.Success && req.Error == "" {
+		req.Error = errStatus
+	}
+
+	// revalidate runs only fetch regex_revalidate.config, so they can't report the whole config.
+	if r.Cfg.RunMode == config.Revalidate || len(r.configFiles) == 0 {
+		return req
+	}
+
+	files := []tc.ServerConfigFileState{}
+	for _, cfg := range r.configFiles {
+		data, err := r.readCfgFile(cfg, "")
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Warnf("reading config file '%s' for config state: %s\n", cfg.Path, err.Error())
+			}
+			continue
+		}
+		files = append(files, tc.ServerConfigFileState{
+			Name:     cfg.Name,
+			Path:     cfg.Path,
+			Checksum: atscfg.ConfigFileChecksum(string(data), cfg.Header.Get("Line-Comment")),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	req.Files = &files
+	return req
+}
+
+// SendConfigState sends the config state of this server to Traffic Ops. See MakeConfigState.
+// Report mode doesn't change anything, and doesn't send the config state.
+func (r *TrafficOpsReq) SendConfigState(success bool, errStatus string) error {
+	if r.Cfg.RunMode == config.Report {
+		return nil
+	}
+	bts, err := json.Marshal(r.MakeConfigState(success, errStatus))
+	if err != nil {
+		return errors.New("marshalling config state: " + err.Error())
+	}
+	if _, err := r.atsTcExecCommandInput("config-state", -1, -1, bts); err != nil {
+		return errors.New("sending config state: " + err.Error())
+	}
+	return nil
+}
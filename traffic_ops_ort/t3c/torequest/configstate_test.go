@@ -0,0 +1,73 @@
+package torequest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"io/ioutil"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-atscfg"
+	"github.com/apache/trafficcontrol/traffic_ops_ort/t3c/config"
+)
+
+func TestMakeConfigState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "t3c-configstate-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := testCfg
+	cfg.RunMode = config.SyncDS
+	trops := NewTrafficOpsReq(cfg)
+
+	if req := trops.MakeConfigState(false, "SyncDSError"); req.Files != nil || req.Success || req.Error != "SyncDSError" {
+		t.Errorf("expected failed check-in with no files, actual %+v", req)
+	}
+
+	body := "# DO NOT EDIT\nfoo.so\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "plugin.config"), []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Line-Comment", "#")
+	trops.configFiles["plugin.config"] = &ConfigFile{Header: header, Name: "plugin.config", Path: filepath.Join(dir, "plugin.config")}
+	trops.configFiles["sni.yaml"] = &ConfigFile{Name: "sni.yaml", Path: filepath.Join(dir, "sni.yaml")}
+
+	req := trops.MakeConfigState(true, "Success")
+	if !req.Success || req.Error != "" {
+		t.Errorf("expected success, actual %+v", req)
+	}
+	if req.Files == nil || len(*req.Files) != 1 {
+		t.Fatalf("expected 1 file on disk, actual %+v", req.Files)
+	}
+	if file := (*req.Files)[0]; file.Name != "plugin.config" || file.Checksum != atscfg.ConfigFileChecksum(body, "#") {
+		t.Errorf("expected plugin.config checksum '%v', actual %+v", atscfg.ConfigFileChecksum(body, "#"), file)
+	}
+
+	trops.ApplyResult.FailedStage = ApplyStageHealth
+	trops.ApplyResult.Error = "unhealthy"
+	if req := trops.MakeConfigState(true, "Success"); req.Success || req.Error != "unhealthy" || req.FailedStage != string(ApplyStageHealth) {
+		t.Errorf("expected apply failure, actual %+v", req)
+	}
+}
@@ -0,0 +1,342 @@
+package torequest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/traffic_ops_ort/t3c/config"
+	"github.com/apache/trafficcontrol/traffic_ops_ort/t3cutil"
+
+	"github.com/kylelemons/godebug/diff"
+)
+
+// ChangeReason is why a config file on disk differs from Traffic Ops.
+type ChangeReason string
+
+const (
+	ChangeReasonNew     = ChangeReason("new")
+	ChangeReasonChanged = ChangeReason("changed")
+	ChangeReasonRemoved = ChangeReason("removed")
+	ChangeReasonNone    = ChangeReason("")
+)
+
+// Special processing performed on a config file, in addition to comparing it to disk.
+const (
+	SpecialProcessingRemapOverrides     = "remap_overrides"
+	SpecialProcessingPluginVerification = "plugin_verification"
+	SpecialProcessingUdevRules          = "udev_rules"
+)
+
+// Package actions, for packages required by Traffic Ops.
+const (
+	PackageActionNone    = "none"
+	PackageActionInstall = "install"
+	PackageActionUpgrade = "upgrade"
+	PackageActionRemove  = "remove"
+)
+
+// Chkconfig actions, for services Traffic Ops requires be enabled at startup.
+const (
+	ChkconfigActionNone   = "none"
+	ChkconfigActionEnable = "enable"
+)
+
+// reportDiffContext is the number of unchanged lines shown around each change in a config file diff.
+const reportDiffContext = 3
+
+// Report is the structured result of a t3c run, printed when the report format is JSON.
+type Report struct {
+	RunMode            string             `json:"runMode"`
+	CacheHostName      string             `json:"cacheHostName"`
+	Time               time.Time          `json:"time"`
+	ExitCode           int                `json:"exitCode"`
+	ExitStatus         string             `json:"exitStatus"`
+	UpdatePending      bool               `json:"updatePending"`
+	RevalPending       bool               `json:"revalPending"`
+	ParentPending      bool               `json:"parentPending"`
+	ParentRevalPending bool               `json:"parentRevalPending"`
+	Packages           []PackageReport    `json:"packages"`
+	Chkconfig          []ChkconfigReport  `json:"chkconfig"`
+	ConfigFiles        []ConfigFileReport `json:"configFiles"`
+	Apply              *ApplyResult       `json:"apply,omitempty"`
+}
+
+// PackageReport is the state of one package required by Traffic Ops.
+type PackageReport struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Installed string `json:"installed"`
+	Action    string `json:"action"`
+}
+
+// ChkconfigReport is the state of one service Traffic Ops requires be enabled at startup.
+type ChkconfigReport struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Action  string `json:"action"`
+	Applied bool   `json:"applied"`
+	Error   string `json:"error,omitempty"`
+}
+
+// PluginReport is the result of verifying one ATS plugin is installed.
+type PluginReport struct {
+	Name     string `json:"name"`
+	Verified bool   `json:"verified"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ConfigFileReport is the state of one config file from Traffic Ops.
+type ConfigFileReport struct {
+	Name               string                      `json:"name"`
+	Path               string                      `json:"path"`
+	Service            string                      `json:"service"`
+	Changed            bool                        `json:"changed"`
+	Reason             ChangeReason                `json:"reason,omitempty"`
+	Diff               string                      `json:"diff,omitempty"`
+	SpecialProcessing  []string                    `json:"specialProcessing"`
+	Plugins            []PluginReport              `json:"plugins"`
+	Applied            bool                        `json:"applied"`
+	AuditFailed        bool                        `json:"auditFailed"`
+	PreReqFailed       bool                        `json:"preReqFailed"`
+	PluginConfigErrors []t3cutil.PluginConfigError `json:"pluginConfigErrors"`
+	Error              string                      `json:"error,omitempty"`
+}
+
+// stdout returns the writer for human-oriented output, which must not be stdout if the report is JSON.
+func (r *TrafficOpsReq) stdout() io.Writer {
+	if r.Cfg.ReportFormat == config.ReportFormatJSON {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// reportPackage records the state of a package required by Traffic Ops.
+func (r *TrafficOpsReq) reportPackage(pkg Package, installed string, action string) {
+	r.packageReports = append(r.packageReports, PackageReport{
+		Name:      pkg.Name,
+		Version:   pkg.Version,
+		Installed: installed,
+		Action:    action,
+	})
+}
+
+// reportPlugin records the result of verifying a plugin used by the given config file.
+func (r *TrafficOpsReq) reportPlugin(cfg *ConfigFile, plugin string, err error) {
+	pr := PluginReport{Name: plugin, Verified: err == nil}
+	if err != nil {
+		pr.Error = err.Error()
+	}
+	cfg.plugins = append(cfg.plugins, pr)
+}
+
+// MakeReport returns the report of everything t3c found and did, with the given exit code and status.
+func (r *TrafficOpsReq) MakeReport(exitCode int, exitStatus string) Report {
+	rp := Report{
+		RunMode:       r.Cfg.RunMode.String(),
+		CacheHostName: r.Cfg.CacheHostName,
+		Time:          time.Now(),
+		ExitCode:      exitCode,
+		ExitStatus:    exitStatus,
+		Packages:      r.packageReports,
+		Chkconfig:     r.chkconfigReports,
+		ConfigFiles:   []ConfigFileReport{},
+	}
+	if r.updateStatus != nil {
+		rp.UpdatePending = r.updateStatus.UpdatePending
+		rp.RevalPending = r.updateStatus.RevalPending
+		rp.ParentPending = r.updateStatus.ParentPending
+		rp.ParentRevalPending = r.updateStatus.ParentRevalPending
+	}
+	if rp.Packages == nil {
+		rp.Packages = []PackageReport{}
+	}
+	if rp.Chkconfig == nil {
+		rp.Chkconfig = []ChkconfigReport{}
+	}
+	if len(r.ApplyResult.Files) > 0 || r.ApplyResult.FailedStage != ApplyStageInvalid {
+		applyResult := r.ApplyResult
+		rp.Apply = &applyResult
+	}
+
+	for _, cfg := range r.configFiles {
+		cr := ConfigFileReport{
+			Name:               cfg.Name,
+			Path:               cfg.Path,
+			Service:            cfg.Service,
+			Changed:            cfg.ChangeNeeded,
+			Reason:             cfg.changeReason,
+			Diff:               cfg.diff,
+			SpecialProcessing:  cfg.specialProcessing,
+			Plugins:            cfg.plugins,
+			Applied:            cfg.ChangeApplied,
+			AuditFailed:        cfg.AuditFailed,
+			PreReqFailed:       cfg.PreReqFailed,
+			PluginConfigErrors: cfg.pluginConfigErrs,
+			Error:              cfg.checkErr,
+		}
+		if cr.SpecialProcessing == nil {
+			cr.SpecialProcessing = []string{}
+		}
+		if cr.Plugins == nil {
+			cr.Plugins = []PluginReport{}
+		}
+		if cr.PluginConfigErrors == nil {
+			cr.PluginConfigErrors = []t3cutil.PluginConfigError{}
+		}
+		rp.ConfigFiles = append(rp.ConfigFiles, cr)
+	}
+	sort.Slice(rp.ConfigFiles, func(i, j int) bool { return rp.ConfigFiles[i].Path < rp.ConfigFiles[j].Path })
+	return rp
+}
+
+// WriteReport writes the JSON report of everything t3c found and did to w.
+func (r *TrafficOpsReq) WriteReport(w io.Writer, exitCode int, exitStatus string) error {
+	bts, err := json.MarshalIndent(r.MakeReport(exitCode, exitStatus), "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshalling report: %v", err)
+	}
+	bts = append(bts, '\n')
+	if _, err := w.Write(bts); err != nil {
+		return fmt.Errorf("writing report: %v", err)
+	}
+	return nil
+}
+
+// getChangeReason returns why the disk file must change to match Traffic Ops,
+// given whether it exists on disk and the filtered Traffic Ops text.
+func getChangeReason(fileExists bool, trops string) ChangeReason {
+	if !fileExists {
+		return ChangeReasonNew
+	}
+	if strings.TrimSpace(trops) == "" {
+		return ChangeReasonRemoved
+	}
+	return ChangeReasonChanged
+}
+
+// unifiedDiff returns a unified diff from the lines a to the lines b, with the given file names in the header.
+// Returns the empty string if a and b are the same.
+func unifiedDiff(aName string, bName string, a []string, b []string) string {
+	type diffLine struct {
+		op   byte
+		text string
+	}
+
+	lines := []diffLine{}
+	for _, chunk := range diff.DiffChunks(a, b) {
+		for _, line := range chunk.Deleted {
+			lines = append(lines, diffLine{op: '-', text: line})
+		}
+		for _, line := range chunk.Added {
+			lines = append(lines, diffLine{op: '+', text: line})
+		}
+		for _, line := range chunk.Equal {
+			lines = append(lines, diffLine{op: ' ', text: line})
+		}
+	}
+
+	// aLines[i] and bLines[i] are the number of lines of a and b before lines[i]
+	aLines := make([]int, len(lines)+1)
+	bLines := make([]int, len(lines)+1)
+	for i, line := range lines {
+		aLines[i+1] = aLines[i]
+		bLines[i+1] = bLines[i]
+		if line.op != '+' {
+			aLines[i+1]++
+		}
+		if line.op != '-' {
+			bLines[i+1]++
+		}
+	}
+
+	sb := strings.Builder{}
+	for i := 0; i < len(lines); {
+		for i < len(lines) && lines[i].op == ' ' {
+			i++
+		}
+		if i == len(lines) {
+			break
+		}
+
+		start := i - reportDiffContext
+		if start < 0 {
+			start = 0
+		}
+
+		// extend the hunk over every change separated by no more than twice the context.
+		end := i
+		for {
+			for end < len(lines) && lines[end].op != ' ' {
+				end++
+			}
+			next := end
+			for next < len(lines) && lines[next].op == ' ' && next-end < reportDiffContext*2 {
+				next++
+			}
+			if next == len(lines) || lines[next].op == ' ' {
+				break
+			}
+			end = next
+		}
+
+		stop := end + reportDiffContext
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+
+		if sb.Len() == 0 {
+			sb.WriteString("--- " + aName + "\n")
+			sb.WriteString("+++ " + bName + "\n")
+		}
+		sb.WriteString("@@ -" + hunkRange(aLines[start], aLines[stop]-aLines[start]) + " +" + hunkRange(bLines[start], bLines[stop]-bLines[start]) + " @@\n")
+		for _, line := range lines[start:stop] {
+			sb.WriteByte(line.op)
+			sb.WriteString(line.text + "\n")
+		}
+		i = stop
+	}
+	return sb.String()
+}
+
+// diffLines splits text into lines for unifiedDiff, where empty text has no lines.
+func diffLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// hunkRange returns the unified diff range of a hunk, given the number of lines before it and its length.
+func hunkRange(before int, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, length)
+}
@@ -0,0 +1,136 @@
+package torequest
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := strings.Split("a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm", "\n")
+	b := strings.Split("a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn", "\n")
+
+	expected := `--- old
++++ new
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -11,3 +11,4 @@
+ k
+ l
+ m
++n
+`
+	if actual := unifiedDiff("old", "new", a, b); actual != expected {
+		t.Errorf("unifiedDiff expected:\n%v\nactual:\n%v", expected, actual)
+	}
+
+	// changes separated by no more than twice the context are one hunk
+	b = strings.Split("a\nB\nc\nd\ne\nf\ng\nH\ni\nj\nk\nl\nm", "\n")
+	if actual := unifiedDiff("old", "new", a, b); strings.Count(actual, "@@ -") != 1 || !strings.Contains(actual, "@@ -1,11 +1,11 @@\n") {
+		t.Errorf("unifiedDiff expected one hunk '@@ -1,11 +1,11 @@', actual:\n%v", actual)
+	}
+
+	if actual := unifiedDiff("old", "new", a, a); actual != "" {
+		t.Errorf("unifiedDiff of identical lines expected empty, actual:\n%v", actual)
+	}
+
+	if actual := unifiedDiff("old", "new", nil, []string{"x"}); actual != "--- old\n+++ new\n@@ -0,0 +1 @@\n+x\n" {
+		t.Errorf("unifiedDiff of new file expected add hunk, actual:\n%v", actual)
+	}
+}
+
+func TestGetChangeReason(t *testing.T) {
+	if reason := getChangeReason(false, "foo"); reason != ChangeReasonNew {
+		t.Errorf("getChangeReason of missing file expected '%v', actual '%v'", ChangeReasonNew, reason)
+	}
+	if reason := getChangeReason(true, "\n"); reason != ChangeReasonRemoved {
+		t.Errorf("getChangeReason of empty Traffic Ops file expected '%v', actual '%v'", ChangeReasonRemoved, reason)
+	}
+	if reason := getChangeReason(true, "foo"); reason != ChangeReasonChanged {
+		t.Errorf("getChangeReason of existing file expected '%v', actual '%v'", ChangeReasonChanged, reason)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	trops := NewTrafficOpsReq(testCfg)
+	trops.updateStatus = &tc.ServerUpdateStatus{UpdatePending: true, ParentPending: true}
+	trops.reportPackage(Package{Name: "trafficserver", Version: "8.1.0"}, "trafficserver-8.0.0", PackageActionUpgrade)
+	trops.configFiles["remap.config"] = &ConfigFile{
+		Name:              "remap.config",
+		Path:              "/opt/trafficserver/etc/trafficserver/remap.config",
+		ChangeNeeded:      true,
+		changeReason:      ChangeReasonChanged,
+		diff:              "--- a\n+++ b\n",
+		specialProcessing: []string{SpecialProcessingPluginVerification},
+	}
+	trops.reportPlugin(trops.configFiles["remap.config"], "header_rewrite.so", nil)
+	trops.configFiles["astats.config"] = &ConfigFile{
+		Name: "astats.config",
+		Path: "/opt/trafficserver/etc/trafficserver/astats.config",
+	}
+
+	buf := &bytes.Buffer{}
+	if err := trops.WriteReport(buf, 139, "SyncDSError"); err != nil {
+		t.Fatal(err)
+	}
+
+	report := Report{}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("expected report to be valid JSON, actual error: %v\n%v", err, buf.String())
+	}
+	if report.ExitCode != 139 || report.ExitStatus != "SyncDSError" {
+		t.Errorf("expected exit 139 SyncDSError, actual %v %v", report.ExitCode, report.ExitStatus)
+	}
+	if !report.UpdatePending || !report.ParentPending || report.RevalPending {
+		t.Errorf("expected update and parent pending, actual %+v", report)
+	}
+	if len(report.Packages) != 1 || report.Packages[0].Action != PackageActionUpgrade {
+		t.Errorf("expected 1 package upgrade, actual %+v", report.Packages)
+	}
+	if report.Chkconfig == nil {
+		t.Errorf("expected empty chkconfig list, actual null")
+	}
+	if report.Apply != nil {
+		t.Errorf("expected no apply result, actual %+v", report.Apply)
+	}
+	if len(report.ConfigFiles) != 2 {
+		t.Fatalf("expected 2 config files, actual %v", len(report.ConfigFiles))
+	}
+	if report.ConfigFiles[0].Name != "astats.config" || report.ConfigFiles[0].Changed {
+		t.Errorf("expected unchanged astats.config first, actual %+v", report.ConfigFiles[0])
+	}
+	remap := report.ConfigFiles[1]
+	if !remap.Changed || remap.Reason != ChangeReasonChanged || remap.Diff == "" {
+		t.Errorf("expected changed remap.config with diff, actual %+v", remap)
+	}
+	if len(remap.Plugins) != 1 || !remap.Plugins[0].Verified {
+		t.Errorf("expected 1 verified plugin, actual %+v", remap.Plugins)
+	}
+}
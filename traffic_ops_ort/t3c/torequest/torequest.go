@@ -29,6 +29,7 @@ import (
 	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/traffic_ops_ort/t3c/config"
 	"github.com/apache/trafficcontrol/traffic_ops_ort/t3c/util"
+	"github.com/apache/trafficcontrol/traffic_ops_ort/t3cutil"
 	"io"
 	"io/ioutil"
 	"mime"
@@ -40,6 +41,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -62,17 +64,25 @@ type Package struct {
 
 type TrafficOpsReq struct {
 	Cfg                  config.Cfg
-	pkgs                 map[string]bool // map of installed packages
-	plugins              map[string]bool // map of verified plugins
+	PackageManager       util.PackageManager // nil if the OS package manager is unknown
+	ServiceManager       util.ServiceManager // nil if the OS service management is unknown
+	pkgs                 map[string]bool     // map of installed packages
+	plugins              map[string]bool     // map of verified plugins
 	configFiles          map[string]*ConfigFile
 	baseBackupDir        string
-	TrafficCtlReload     bool   // a traffic_ctl_reload is required
-	SysCtlReload         bool   // a reload of the sysctl.conf is required
-	NtpdRestart          bool   // ntpd needs restarting
-	TeakdRestart         bool   // a restart of teakd is required
-	TrafficServerRestart bool   // a trafficserver restart is required
-	RemapConfigReload    bool   // remap.config should be reloaded
-	unixTimeStr          string // unix time string at program startup.
+	TrafficCtlReload     bool                   // a traffic_ctl_reload is required
+	SysCtlReload         bool                   // a reload of the sysctl.conf is required
+	NtpdRestart          bool                   // ntpd needs restarting
+	TeakdRestart         bool                   // a restart of teakd is required
+	TrafficServerRestart bool                   // a trafficserver restart is required
+	RemapConfigReload    bool                   // remap.config should be reloaded
+	unixTimeStr          string                 // unix time string at program startup.
+	stagedFiles          []*ConfigFile          // changed files written to their staging path, but not yet swapped in
+	appliedFiles         []*ConfigFile          // changed files which have been swapped in
+	ApplyResult          ApplyResult            // the outcome of applying changed config files
+	updateStatus         *tc.ServerUpdateStatus // the last update status fetched from Traffic Ops
+	packageReports       []PackageReport        // the state of packages required by Traffic Ops
+	chkconfigReports     []ChkconfigReport      // the state of services required to be enabled at startup
 }
 
 type ConfigFile struct {
@@ -90,9 +100,15 @@ type ConfigFile struct {
 	PreReqFailed      bool   // failed plugin prerequiste check
 	RemapPluginConfig bool   // file is a remap plugin config file
 	Body              []byte
-	Perm              os.FileMode // default file permissions
-	Uid               int         // owner uid, default is 0
-	Gid               int         // owner gid, default is 0
+	Perm              os.FileMode                 // default file permissions
+	Uid               int                         // owner uid, default is 0
+	Gid               int                         // owner gid, default is 0
+	changeReason      ChangeReason                // why the file on disk differs from Traffic Ops
+	diff              string                      // unified diff from the file on disk to Traffic Ops
+	specialProcessing []string                    // special processing performed on the file
+	plugins           []PluginReport              // results of verifying the plugins the file uses
+	checkErr          string                      // error checking the file, if any
+	pluginConfigErrs  []t3cutil.PluginConfigError // reasons the file's plugin configs are invalid
 }
 
 func (u UpdateStatus) String() string {
@@ -174,13 +190,24 @@ func (r *TrafficOpsReq) DumpConfigFiles() {
 func NewTrafficOpsReq(cfg config.Cfg) *TrafficOpsReq {
 	unixTimeString := strconv.FormatInt(time.Now().Unix(), 10)
 
+	pkgMgr, err := util.NewPackageManager(cfg.PkgManagement, cfg.YumOptions, util.ExecCommand)
+	if err != nil {
+		log.Errorln("packages cannot be processed: " + err.Error())
+	}
+	svcMgr, err := util.NewServiceManager(cfg.SvcManagement, util.ExecCommand)
+	if err != nil {
+		log.Errorln("services cannot be managed: " + err.Error())
+	}
+
 	return &TrafficOpsReq{
-		Cfg:           cfg,
-		pkgs:          make(map[string]bool),
-		plugins:       make(map[string]bool),
-		configFiles:   make(map[string]*ConfigFile),
-		baseBackupDir: config.TmpBase + "/" + unixTimeString,
-		unixTimeStr:   unixTimeString,
+		Cfg:            cfg,
+		PackageManager: pkgMgr,
+		ServiceManager: svcMgr,
+		pkgs:           make(map[string]bool),
+		plugins:        make(map[string]bool),
+		configFiles:    make(map[string]*ConfigFile),
+		baseBackupDir:  config.TmpBase + "/" + unixTimeString,
+		unixTimeStr:    unixTimeString,
 	}
 }
 
@@ -193,6 +220,11 @@ func (r *TrafficOpsReq) atsTcExec(cmdstr string) ([]byte, error) {
 
 // atsTcExecCommand is used to run the atstccfg command.
 func (r *TrafficOpsReq) atsTcExecCommand(cmdstr string, queueState int, revalState int) ([]byte, error) {
+	return r.atsTcExecCommandInput(cmdstr, queueState, revalState, nil)
+}
+
+// atsTcExecCommandInput is used to run the atstccfg command, with the given stdin.
+func (r *TrafficOpsReq) atsTcExecCommandInput(cmdstr string, queueState int, revalState int, stdin []byte) ([]byte, error) {
 	// adjust log locations used for atstccfg
 	// cannot use stdout as this will cause json parsing errors.
 	errorLocation := r.Cfg.LogLocationErr
@@ -254,6 +286,8 @@ func (r *TrafficOpsReq) atsTcExecCommand(cmdstr string, queueState int, revalSta
 		}
 		args = append(args, "--set-queue-status="+queueStatus)
 		args = append(args, "--set-reval-status="+revalStatus)
+	case "config-state":
+		args = append(args, "--set-config-state")
 	case "get-config-files":
 		if r.Cfg.RunMode == config.Revalidate {
 			args = append(args, "--revalidate-only")
@@ -268,6 +302,9 @@ func (r *TrafficOpsReq) atsTcExecCommand(cmdstr string, queueState int, revalSta
 
 	cmd.Stdout = &outbuf
 	cmd.Stderr = &errbuf
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
 
 	err := cmd.Run()
 	if err != nil {
@@ -344,6 +381,7 @@ func (r *TrafficOpsReq) checkConfigFile(cfg *ConfigFile) error {
 	log.Debugf("======== Start processing config file: %s ========\n", cfg.Name)
 
 	if cfg.Name == "remap.config" {
+		cfg.specialProcessing = append(cfg.specialProcessing, SpecialProcessingRemapOverrides)
 		err := r.processRemapOverrides(cfg)
 		if err != nil {
 			return err
@@ -352,6 +390,7 @@ func (r *TrafficOpsReq) checkConfigFile(cfg *ConfigFile) error {
 
 	// perform plugin verification
 	if cfg.Name == "remap.config" || cfg.Name == "plugin.config" {
+		cfg.specialProcessing = append(cfg.specialProcessing, SpecialProcessingPluginVerification)
 		err := r.verifyPlugins(cfg)
 		if err != nil {
 			return err
@@ -365,13 +404,15 @@ func (r *TrafficOpsReq) checkConfigFile(cfg *ConfigFile) error {
 	tropsData = commentsFilter(tropsData)
 
 	var diskData []string
+	var diskText string
 	fileExists, _ := util.FileExists(cfg.Path)
 	if fileExists {
 		data, err := r.readCfgFile(cfg, "")
 		if err != nil {
 			return errors.New("reading from '" + cfg.Path + "' failed: " + err.Error())
 		}
-		diskData = strings.Split(string(data), "\n")
+		diskText = string(data)
+		diskData = strings.Split(diskText, "\n")
 	} else { // file doesn't exist on, it's new from Traffic Ops.
 		cfg.AuditComplete = true
 		cfg.ChangeNeeded = true
@@ -390,8 +431,11 @@ func (r *TrafficOpsReq) checkConfigFile(cfg *ConfigFile) error {
 	trops := strings.Join(tropsData, "\n")
 	trops = newLineFilter(trops)
 
-	if disk != trops {
+	// compare semantically, so e.g. reordered records.config lines don't cause a needless reload.
+	if !t3cutil.SemanticEqual(cfg.Name, diskText, string(cfg.Body)) {
 		cfg.ChangeNeeded = true
+		cfg.changeReason = getChangeReason(fileExists, trops)
+		cfg.diff = unifiedDiff(cfg.Path, cfg.Path+" (Traffic Ops)", diffLines(disk), diffLines(trops))
 		log.Infof("change needed to %s\n", cfg.Name)
 		err := r.backUpFile(cfg)
 		if err != nil {
@@ -403,6 +447,7 @@ func (r *TrafficOpsReq) checkConfigFile(cfg *ConfigFile) error {
 	}
 
 	if cfg.Name == "50-ats.rules" {
+		cfg.specialProcessing = append(cfg.specialProcessing, SpecialProcessingUdevRules)
 		err := r.processUdevRules(cfg)
 		if err != nil {
 			return errors.New("unable to process udev rules in '" + cfg.Name + "': " + err.Error())
@@ -422,7 +467,10 @@ func (r *TrafficOpsReq) checkPlugin(plugin string) error {
 		return nil
 	}
 	pluginFile := filepath.Join(config.TSHome, "/libexec/trafficserver/", plugin)
-	pkgs, err := util.PackageInfo("pkg-provides", pluginFile)
+	if r.PackageManager == nil {
+		return errors.New("unable to verify plugin " + pluginFile + ": no package manager")
+	}
+	pkgs, err := r.PackageManager.Provides(pluginFile)
 	if err != nil {
 		return errors.New("unable to verify plugin " + pluginFile + ": " + err.Error())
 	}
@@ -520,6 +568,7 @@ func (r *TrafficOpsReq) getUpdateStatus() (*tc.ServerUpdateStatus, error) {
 		return nil, err
 	}
 	log.Debugf("ServerUpdateStatus: %#v\n", status)
+	r.updateStatus = &status
 	return &status, nil
 }
 
@@ -676,39 +725,16 @@ func (r *TrafficOpsReq) readCfgFile(cfg *ConfigFile, dir string) ([]byte, error)
 func (r *TrafficOpsReq) replaceCfgFile(cfg *ConfigFile) error {
 	if r.Cfg.RunMode == config.BadAss || r.Cfg.RunMode == config.SyncDS || r.Cfg.RunMode == config.Revalidate {
 
-		log.Infof("Copying '%s' to '%s'\n", cfg.TropsBackup, cfg.Path)
+		log.Infof("Staging '%s' for '%s'\n", cfg.TropsBackup, cfg.Path)
 		data, err := util.ReadFile(cfg.TropsBackup)
 		if err != nil {
 			return errors.New("Unable to read the config file '" + cfg.TropsBackup + "': " + err.Error())
 		}
-		_, err = r.writeCfgFile(cfg, "", data)
+		err = r.stageCfgFile(cfg, data)
 		if err != nil {
 			return errors.New("Failed to write the new config file: " + err.Error())
 		}
-		cfg.ChangeApplied = true
-
-		r.RemapConfigReload = cfg.RemapPluginConfig ||
-			cfg.Name == "remap.config" ||
-			strings.HasPrefix(cfg.Name, "url_sig_") ||
-			strings.HasPrefix(cfg.Name, "uri_signing") ||
-			strings.HasPrefix(cfg.Name, "hdr_rw_") ||
-			strings.HasPrefix(cfg.Name, "regex_remap_") ||
-			strings.HasPrefix(cfg.Name, "bg_fetch") ||
-			strings.HasSuffix(cfg.Name, ".lua")
-
-		r.TrafficCtlReload = r.TrafficCtlReload ||
-			strings.HasSuffix(cfg.Dir, "trafficserver") ||
-			r.RemapConfigReload ||
-			cfg.Name == "ssl_multicert.config" ||
-			(strings.HasSuffix(cfg.Dir, "ssl") && strings.HasSuffix(cfg.Name, ".cer")) ||
-			(strings.HasSuffix(cfg.Dir, "ssl") && strings.HasSuffix(cfg.Name, ".key"))
-
-		r.TrafficServerRestart = cfg.Name == "plugin.config"
-		r.NtpdRestart = cfg.Name == "ntpd.conf"
-		r.SysCtlReload = cfg.Name == "sysctl.conf"
-
-		log.Debugf("Setting change applied for '%s'\n", cfg.Name)
-
+		// the reload and restart flags are set by setReloadFlags, once the staged file is swapped in.
 	} else {
 		log.Infof("You elected not to replace %s with the version from Traffic Ops.\n", cfg.Name)
 		cfg.ChangeApplied = false
@@ -716,6 +742,31 @@ func (r *TrafficOpsReq) replaceCfgFile(cfg *ConfigFile) error {
 	return nil
 }
 
+// setReloadFlags sets the reload and restart flags the given config file requires. It's called once the file is swapped in, so a failed apply doesn't reload or restart anything for files which were never applied.
+func (r *TrafficOpsReq) setReloadFlags(cfg *ConfigFile) {
+	r.RemapConfigReload = cfg.RemapPluginConfig ||
+		cfg.Name == "remap.config" ||
+		cfg.Name == "strategies.yaml" ||
+		strings.HasPrefix(cfg.Name, "url_sig_") ||
+		strings.HasPrefix(cfg.Name, "uri_signing") ||
+		strings.HasPrefix(cfg.Name, "hdr_rw_") ||
+		strings.HasPrefix(cfg.Name, "regex_remap_") ||
+		strings.HasPrefix(cfg.Name, "bg_fetch") ||
+		strings.HasSuffix(cfg.Name, ".lua")
+
+	r.TrafficCtlReload = r.TrafficCtlReload ||
+		strings.HasSuffix(cfg.Dir, "trafficserver") ||
+		r.RemapConfigReload ||
+		cfg.Name == "ssl_multicert.config" ||
+		cfg.Name == "sni.yaml" ||
+		(strings.HasSuffix(cfg.Dir, "ssl") && strings.HasSuffix(cfg.Name, ".cer")) ||
+		(strings.HasSuffix(cfg.Dir, "ssl") && strings.HasSuffix(cfg.Name, ".key"))
+
+	r.TrafficServerRestart = cfg.Name == "plugin.config"
+	r.NtpdRestart = cfg.Name == "ntpd.conf"
+	r.SysCtlReload = cfg.Name == "sysctl.conf"
+}
+
 func (r *TrafficOpsReq) sleepTimer(serverStatus *tc.ServerUpdateStatus) {
 	randDispSec := time.Duration(0)
 	revalClockSec := time.Duration(0)
@@ -745,11 +796,11 @@ func (r *TrafficOpsReq) sleepTimer(serverStatus *tc.ServerUpdateStatus) {
 	}
 
 	for randDispSec > 0 {
-		fmt.Printf(".")
+		fmt.Fprintf(r.stdout(), ".")
 		time.Sleep(time.Second)
 		revalClockSec--
 		if revalClockSec < 1 && r.Cfg.RunMode != config.BadAss && serverStatus.UseRevalPending {
-			fmt.Printf("\n")
+			fmt.Fprintf(r.stdout(), "\n")
 			log.Infoln("Interrupting dispersion sleep period for revalidation check.")
 			_, err := r.RevalidateWhileSleeping()
 			if r.Cfg.RevalWaitTime > 0 {
@@ -771,7 +822,7 @@ func (r *TrafficOpsReq) sleepTimer(serverStatus *tc.ServerUpdateStatus) {
 		}
 		randDispSec--
 	}
-	fmt.Printf("\n")
+	fmt.Fprintf(r.stdout(), "\n")
 }
 
 // writeCfgFile writes the 'data' from Traffic Ops to an ATS config file.
@@ -783,7 +834,11 @@ func (r *TrafficOpsReq) writeCfgFile(cfg *ConfigFile, dir string, data []byte) (
 	} else {
 		fullFileName = dir + "/" + cfg.Name
 	}
+	return r.writeCfgFileTo(cfg, fullFileName, data)
+}
 
+// writeCfgFileTo writes 'data' to fullFileName, with the permissions and ownership of the config file cfg.
+func (r *TrafficOpsReq) writeCfgFileTo(cfg *ConfigFile, fullFileName string, data []byte) (int, error) {
 	fd, err := os.OpenFile(fullFileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, cfg.Perm)
 	if err != nil {
 		return 0, errors.New("unable to open '" + fullFileName + "' for writing: " + err.Error())
@@ -826,9 +881,11 @@ func (r *TrafficOpsReq) verifyPlugins(cfg *ConfigFile) error {
 				plugin := fields[0]
 				// already verified
 				if r.plugins[plugin] == true {
+					r.reportPlugin(cfg, plugin, nil)
 					continue
 				}
 				err := r.checkPlugin(plugin)
+				r.reportPlugin(cfg, plugin, err)
 				if err != nil {
 					cfg.PreReqFailed = true
 					return err
@@ -865,9 +922,11 @@ func (r *TrafficOpsReq) verifyPlugins(cfg *ConfigFile) error {
 						if strings.HasSuffix(plugin, ".so") {
 							// already verified
 							if r.plugins[plugin] == true {
+								r.reportPlugin(cfg, plugin, nil)
 								continue
 							}
 							err := r.checkPlugin(plugin)
+							r.reportPlugin(cfg, plugin, err)
 							if err != nil {
 								cfg.PreReqFailed = true
 								return err
@@ -893,65 +952,123 @@ func (r *TrafficOpsReq) verifyPlugins(cfg *ConfigFile) error {
 			}
 		}
 	}
-	return nil
+	return r.validatePluginConfigs(cfg)
+}
+
+// validatePluginConfigs validates the configs of the plugins used by the given plugin.config or remap.config.
+// Errors are recorded on the config file containing the invalid config, if it's from Traffic Ops, otherwise on cfg.
+// Config files with invalid plugin configs are never applied, see ProcessConfigFiles. Warnings are only logged.
+func (r *TrafficOpsReq) validatePluginConfigs(cfg *ConfigFile) error {
+	invalid := 0
+	for _, err := range t3cutil.ValidatePluginConfigs(cfg.Name, string(cfg.Body), r.readPluginConfigFile) {
+		if err.Warning {
+			log.Warnf("plugin config may be invalid: %s\n", err.Error())
+			continue
+		}
+		log.Errorf("invalid plugin config: %s\n", err.Error())
+		errCfg, ok := r.configFiles[filepath.Base(err.File)]
+		if !ok {
+			errCfg = cfg
+		}
+		errCfg.pluginConfigErrs = append(errCfg.pluginConfigErrs, err)
+		invalid++
+	}
+	if invalid == 0 {
+		return nil
+	}
+	return errors.New(strconv.Itoa(invalid) + " invalid plugin configs used by " + cfg.Name)
+}
+
+// readPluginConfigFile returns the contents of a plugin config file, from Traffic Ops if it's one of the config files
+// being applied, otherwise from disk, relative to the ATS config directory if the path is relative.
+func (r *TrafficOpsReq) readPluginConfigFile(path string) ([]byte, error) {
+	if cfg, ok := r.configFiles[filepath.Base(path)]; ok {
+		return cfg.Body, nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(config.TSConfigDir, path)
+	}
+	return ioutil.ReadFile(path)
 }
 
 // CheckSystemServices is used to verify that packages installed
-// are enabled for startup.
+// are enabled for startup. In report mode with the JSON report format, the
+// services which would be enabled are only reported.
 func (r *TrafficOpsReq) CheckSystemServices() error {
-	if r.Cfg.RunMode == config.BadAss {
-		out, err := r.atsTcExec("chkconfig")
+	reportOnly := r.Cfg.RunMode == config.Report && r.Cfg.ReportFormat == config.ReportFormatJSON
+	if r.Cfg.RunMode != config.BadAss && !reportOnly {
+		return nil
+	}
+	out, err := r.atsTcExec("chkconfig")
+	if err != nil {
+		log.Errorln(err)
+		return err
+	}
+	var result []map[string]string
+	if err = json.Unmarshal(out, &result); err != nil {
+		return err
+	}
+	for ii := range result {
+		name := result[ii]["name"]
+		value := result[ii]["value"]
+		arrv := strings.Fields(value)
+		var level []string
+		var enabled bool = false
+		for jj := range arrv {
+			nv := strings.Split(arrv[jj], ":")
+			if len(nv) == 2 && strings.Contains(nv[1], "on") {
+				level = append(level, nv[0])
+				enabled = true
+			}
+		}
+		if enabled == false {
+			r.chkconfigReports = append(r.chkconfigReports, ChkconfigReport{Name: name, Value: value, Action: ChkconfigActionNone})
+			continue
+		}
+		if reportOnly {
+			log.Infof("In Report mode and the %s service needs to be enabled\n", name)
+			r.chkconfigReports = append(r.chkconfigReports, ChkconfigReport{Name: name, Value: value, Action: ChkconfigActionEnable})
+			continue
+		}
+		err := r.enableService(name, level)
+		chkReport := ChkconfigReport{Name: name, Value: value, Action: ChkconfigActionEnable, Applied: err == nil}
+		if err != nil {
+			chkReport.Error = err.Error()
+		}
+		r.chkconfigReports = append(r.chkconfigReports, chkReport)
 		if err != nil {
-			log.Errorln(err)
 			return err
-		} else {
-			var result []map[string]string
-			if err = json.Unmarshal(out, &result); err != nil {
-				return err
-			}
-			for ii := range result {
-				name := result[ii]["name"]
-				value := result[ii]["value"]
-				arrv := strings.Fields(value)
-				var level []string
-				var enabled bool = false
-				for jj := range arrv {
-					nv := strings.Split(arrv[jj], ":")
-					if len(nv) == 2 && strings.Contains(nv[1], "on") {
-						level = append(level, nv[0])
-						enabled = true
-					}
-				}
-				if enabled == true {
-					if r.Cfg.SvcManagement == config.SystemD {
-						out, rc, err := util.ExecCommand("/bin/systemctl", "enable", name)
-						if err != nil {
-							log.Errorf(string(out))
-							return errors.New("Unable to enable service " + name + ": " + err.Error())
-						}
-						if rc == 0 {
-							log.Infof("The %s service has been enabled\n", name)
-						}
-					} else if r.Cfg.SvcManagement == config.SystemV {
-						levelValue := strings.Join(level, "")
-						_, rc, err := util.ExecCommand("/bin/chkconfig", "--level", levelValue, name, "on")
-						if err != nil {
-							return errors.New("Unable to enable service " + name + ": " + err.Error())
-						}
-						if rc == 0 {
-							log.Infof("The %s service has been enabled\n", name)
-						}
-					} else {
-						log.Errorf("Unable to insure %s service is enabled, SvcMananagement type is %s\n", name, r.Cfg.SvcManagement)
-					}
-				}
-			}
 		}
 	}
 	return nil
 }
 
-// IsPackageInstalled returns true/false if the named rpm package is installed.
+// enableService enables the named service for startup at the given SystemV run levels.
+func (r *TrafficOpsReq) enableService(name string, level []string) error {
+	if r.ServiceManager == nil {
+		log.Errorf("Unable to insure %s service is enabled, SvcMananagement type is %s\n", name, r.Cfg.SvcManagement)
+		return nil
+	}
+	return r.ServiceManager.Enable(name, level)
+}
+
+// getServiceStatus returns whether the named service is running, and its main PID if it's known.
+func (r *TrafficOpsReq) getServiceStatus(name string) (util.ServiceStatus, int, error) {
+	if r.ServiceManager == nil {
+		return util.SvcUnknown, -1, errors.New("could not get status for service '" + name + "', SvcManagement type is " + r.Cfg.SvcManagement.String())
+	}
+	return r.ServiceManager.Status(name)
+}
+
+// startService starts or restarts the named service, where cmd is 'start' or 'restart', and returns whether it was started.
+func (r *TrafficOpsReq) startService(name string, cmd string) (bool, error) {
+	if r.ServiceManager == nil {
+		return false, errors.New("could not " + cmd + " service '" + name + "', SvcManagement type is " + r.Cfg.SvcManagement.String())
+	}
+	return r.ServiceManager.Start(name, cmd)
+}
+
+// IsPackageInstalled returns true/false if the named package is installed.
 // the prefix before the version is matched.
 func (r *TrafficOpsReq) IsPackageInstalled(name string) bool {
 	for k, v := range r.pkgs {
@@ -1186,6 +1303,8 @@ func (r *TrafficOpsReq) CheckSyncDSState() (UpdateStatus, error) {
 // ProcessConfigFiles processes all config files retrieved from Traffic Ops.
 func (r *TrafficOpsReq) ProcessConfigFiles() (UpdateStatus, error) {
 	var updateStatus UpdateStatus = UpdateTropsNotNeeded
+	r.ApplyResult = ApplyResult{}
+	r.appliedFiles = nil
 
 	log.Infoln(" ======== Start processing config files ========")
 
@@ -1210,10 +1329,25 @@ func (r *TrafficOpsReq) ProcessConfigFiles() (UpdateStatus, error) {
 
 		err := r.checkConfigFile(cfg)
 		if err != nil {
+			cfg.checkErr = err.Error()
 			log.Errorln(err)
 		}
 	}
 
+	// invalid plugin configs could break ATS, and files are applied all or nothing, so none are applied.
+	invalidPaths := []string{}
+	for _, cfg := range r.configFiles {
+		if len(cfg.pluginConfigErrs) > 0 {
+			invalidPaths = append(invalidPaths, cfg.Path)
+		}
+	}
+	if len(invalidPaths) > 0 {
+		sort.Strings(invalidPaths)
+		err := errors.New("invalid plugin configs in " + strings.Join(invalidPaths, ", "))
+		r.failApply(ApplyStageValidate, invalidPaths[0], err)
+		return UpdateTropsFailed, errors.New("refusing to apply config files, no config files were changed: " + err.Error())
+	}
+
 	changesRequired := 0
 
 	for _, cfg := range r.configFiles {
@@ -1236,12 +1370,22 @@ func (r *TrafficOpsReq) ProcessConfigFiles() (UpdateStatus, error) {
 				log.Debugf("All Prereqs passed for replacing %s on disk with that in Traffic Ops.\n", cfg.Name)
 				err := r.replaceCfgFile(cfg)
 				if err != nil {
-					log.Errorf("failed to replace the config file, '%s',  on disk with data in Traffic Ops.\n", cfg.Name)
+					// files are applied all or nothing, so one failure means none are applied.
+					r.failApply(ApplyStageStage, cfg.Path, err)
+					r.removeStagedCfgFiles()
+					return UpdateTropsFailed, errors.New("failed to replace the config file '" + cfg.Name + "' on disk with data in Traffic Ops, no config files were changed: " + err.Error())
 				}
 			}
 		}
 	}
 
+	if len(r.stagedFiles) > 0 {
+		log.Infof("Swapping in %d changed config files\n", len(r.stagedFiles))
+		if err := r.swapStagedCfgFiles(); err != nil {
+			return UpdateTropsFailed, errors.New("failed to swap in changed config files, no config files were changed: " + err.Error())
+		}
+	}
+
 	if updateStatus != UpdateTropsFailed && changesRequired > 0 {
 		return UpdateTropsNeeded, nil
 	}
@@ -1256,6 +1400,10 @@ func (r *TrafficOpsReq) ProcessPackages() error {
 	var install []string   // install package list.
 	var uninstall []string // uninstall package list
 
+	if r.PackageManager == nil {
+		return errors.New("unable to process packages, PkgManagement type is '" + string(r.Cfg.PkgManagement) + "'")
+	}
+
 	// get the package list for this cache from Traffic Ops.
 	out, err := r.atsTcExec("packages")
 	if err != nil {
@@ -1268,29 +1416,24 @@ func (r *TrafficOpsReq) ProcessPackages() error {
 
 	// loop through the package list to build an install and uninstall list.
 	for ii := range pkgs {
-		var instpkg string // installed package
-		var reqpkg string  // required package
+		var reqpkg string // required package
 		log.Infof("Processing package %s-%s\n", pkgs[ii].Name, pkgs[ii].Version)
 		// check to see if any package by name is installed.
-		arr, err := util.PackageInfo("pkg-query", pkgs[ii].Name)
+		instpkg, err := r.PackageManager.Query(pkgs[ii].Name)
 		if err != nil {
 			return err
 		}
-		// go needs the ternary operator :)
-		if len(arr) == 1 {
-			instpkg = arr[0]
-		} else {
-			instpkg = ""
-		}
 		// check if the full package version is installed
-		fullPackage := pkgs[ii].Name + "-" + pkgs[ii].Version
+		fullPackage := r.PackageManager.FullName(pkgs[ii].Name, pkgs[ii].Version)
 
 		if r.Cfg.RunMode == config.BadAss {
 			if instpkg == fullPackage {
 				log.Infof("%s Currently installed and not marked for removal\n", reqpkg)
 				r.pkgs[fullPackage] = true
+				r.reportPackage(pkgs[ii], instpkg, PackageActionNone)
 				continue
 			} else if instpkg != "" { // the installed package needs upgrading.
+				r.reportPackage(pkgs[ii], instpkg, PackageActionUpgrade)
 				log.Infof("%s Currently installed and marked for removal\n", instpkg)
 				uninstall = append(uninstall, instpkg)
 				// the required package needs installing.
@@ -1298,7 +1441,7 @@ func (r *TrafficOpsReq) ProcessPackages() error {
 				install = append(install, fullPackage)
 				// get a list of packages that depend on this one and mark dependencies
 				// for deletion.
-				arr, err = util.PackageInfo("pkg-requires", instpkg)
+				arr, err := r.PackageManager.Requires(instpkg)
 				if err != nil {
 					return err
 				}
@@ -1306,6 +1449,7 @@ func (r *TrafficOpsReq) ProcessPackages() error {
 					for jj := range arr {
 						log.Infof("%s is Currently installed and depends on %s and needs to be removed.", arr[jj], instpkg)
 						uninstall = append(uninstall, arr[jj])
+						r.reportPackage(Package{Name: arr[jj]}, arr[jj], PackageActionRemove)
 					}
 				}
 			} else {
@@ -1313,19 +1457,23 @@ func (r *TrafficOpsReq) ProcessPackages() error {
 				log.Infof("%s is Not installed and is marked for installation.\n", fullPackage)
 				log.Errorf("%s is Not installed and is marked for installation.\n", fullPackage)
 				install = append(install, fullPackage)
+				r.reportPackage(pkgs[ii], instpkg, PackageActionInstall)
 			}
-		} else if r.Cfg.RunMode == config.SyncDS {
+		} else if r.Cfg.RunMode == config.SyncDS || r.Cfg.RunMode == config.Report {
 			// Only check if packages exist and complain if they are wrong.
 			if instpkg == fullPackage {
 				log.Infof("%s Currently installed.\n", reqpkg)
 				r.pkgs[fullPackage] = true
+				r.reportPackage(pkgs[ii], instpkg, PackageActionNone)
 				continue
 			} else if instpkg != "" { // the installed package needs upgrading.
 				log.Errorf("%s Wrong version currently installed.\n", instpkg)
 				r.pkgs[instpkg] = true
+				r.reportPackage(pkgs[ii], instpkg, PackageActionUpgrade)
 			} else {
 				// the required package needs installing.
 				log.Errorf("%s is Not installed.\n", fullPackage)
+				r.reportPackage(pkgs[ii], instpkg, PackageActionInstall)
 			}
 		}
 	}
@@ -1342,9 +1490,9 @@ func (r *TrafficOpsReq) ProcessPackages() error {
 
 		if len(install) > 0 {
 			for ii := range install {
-				result, err := util.PackageAction("info", install[ii])
+				result, err := r.PackageManager.Available(install[ii])
 				if err != nil || result != true {
-					return errors.New("Package " + install[ii] + " is not available to install: " + err.Error())
+					return errors.New("Package " + install[ii] + " is not available to install: " + fmt.Sprint(err))
 				}
 			}
 			log.Infoln("All packages available.. proceding..")
@@ -1353,25 +1501,23 @@ func (r *TrafficOpsReq) ProcessPackages() error {
 			if len(install) > 0 && r.Cfg.RunMode == config.BadAss {
 				for jj := range uninstall {
 					log.Infof("Uninstalling %s\n", install[jj])
-					r, err := util.PackageAction("remove", uninstall[jj])
+					err := r.PackageManager.Remove(uninstall[jj])
 					if err != nil {
 						return errors.New("Unable to uninstall " + uninstall[jj] + " : " + err.Error())
-					} else if r == true {
-						log.Infof("Package %s was uninstalled\n", uninstall[jj])
 					}
+					log.Infof("Package %s was uninstalled\n", uninstall[jj])
 				}
 
 				// install the required packages
 				for jj := range install {
 					pkg := install[jj]
 					log.Infof("Installing %s\n", pkg)
-					result, err := util.PackageAction("install", pkg)
+					err := r.PackageManager.Install(pkg)
 					if err != nil {
 						return errors.New("Unable to install " + pkg + " : " + err.Error())
-					} else if result == true {
-						r.pkgs[pkg] = true
-						log.Infof("Package %s was installed\n", pkg)
 					}
+					r.pkgs[pkg] = true
+					log.Infof("Package %s was installed\n", pkg)
 				}
 			}
 		}
@@ -1403,8 +1549,11 @@ func (r *TrafficOpsReq) RevalidateWhileSleeping() (UpdateStatus, error) {
 		}
 
 		result := r.StartServices(&updateStatus)
+		applied := r.VerifyApply(&updateStatus, result)
 		if !result {
 			return updateStatus, errors.New("failed to start services.")
+		} else if !applied {
+			return updateStatus, errors.New("failed to apply config: " + r.ApplyResult.Error)
 		}
 
 		// update Traffic Ops
@@ -1424,13 +1573,13 @@ func (r *TrafficOpsReq) StartServices(syncdsUpdate *UpdateStatus) bool {
 
 	// start ATS
 	if r.IsPackageInstalled("trafficserver") {
-		svcStatus, _, err := util.GetServiceStatus("trafficserver")
+		svcStatus, _, err := r.getServiceStatus("trafficserver")
 		if err != nil {
 			log.Errorf("error getting 'trafficserver' run status: %s", err)
 			startSuccess = false
 		} else if r.Cfg.RunMode == config.BadAss {
 			if svcStatus == util.SvcRunning {
-				running, err := util.ServiceStart("trafficserver", "restart")
+				running, err := r.startService("trafficserver", "restart")
 				if err != nil {
 					log.Errorf("failed to restart trafficserver.")
 					startSuccess = false
@@ -1442,7 +1591,7 @@ func (r *TrafficOpsReq) StartServices(syncdsUpdate *UpdateStatus) bool {
 					}
 				}
 			} else {
-				running, err := util.ServiceStart("trafficserver", "start")
+				running, err := r.startService("trafficserver", "start")
 				if err != nil {
 					startSuccess = false
 					log.Errorf("trafficserver failed to start, running 'traffic_ctl config reload' will also fail: %s\n", err.Error())
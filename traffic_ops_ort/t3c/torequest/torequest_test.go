@@ -149,3 +149,59 @@ func TestGetConfigFile(t *testing.T) {
 		t.Errorf("GetConfigFile('remap.config') failed, expected 'remap.config' got '" + cfg.Name + "'.")
 	}
 }
+
+func TestValidatePluginConfigs(t *testing.T) {
+	trops := NewTrafficOpsReq(testCfg)
+	remap := &ConfigFile{
+		Name: "remap.config",
+		Dir:  "/tmp",
+		Path: "/tmp/remap.config",
+		Body: []byte("map http://a.example.net/ http://origin.example.net/ @plugin=header_rewrite.so @pparam=hdr_rw_a.config @plugin=cachekey.so @pparam=bogus\n"),
+	}
+	hdrRw := &ConfigFile{
+		Name: "hdr_rw_a.config",
+		Dir:  "/tmp",
+		Path: "/tmp/hdr_rw_a.config",
+		Body: []byte("cond %{REMAP_PSEUDO_HOOK}\nset-header X-Foo\n"),
+	}
+	trops.configFiles[remap.Name] = remap
+	trops.configFiles[hdrRw.Name] = hdrRw
+
+	if err := trops.validatePluginConfigs(remap); err == nil {
+		t.Fatalf("expected invalid plugin configs to be an error")
+	}
+	if len(remap.pluginConfigErrs) != 1 || remap.pluginConfigErrs[0].Line != 1 {
+		t.Errorf("expected the invalid cachekey parameter to be recorded on remap.config, actual %+v", remap.pluginConfigErrs)
+	}
+	if len(hdrRw.pluginConfigErrs) != 1 || hdrRw.pluginConfigErrs[0].Line != 2 {
+		t.Errorf("expected the invalid header rewrite to be recorded on its file, actual %+v", hdrRw.pluginConfigErrs)
+	}
+
+	remap.AuditComplete = true
+	hdrRw.AuditComplete = true
+	remap.ChangeNeeded = true
+	if status, err := trops.ProcessConfigFiles(); err == nil || status != UpdateTropsFailed {
+		t.Errorf("expected invalid plugin configs to fail processing, actual status %v err %v", status, err)
+	}
+	if trops.ApplyResult.FailedStage != ApplyStageValidate || trops.ApplyResult.FailedFile != hdrRw.Path {
+		t.Errorf("expected apply to fail at stage %v for %s, actual %+v", ApplyStageValidate, hdrRw.Path, trops.ApplyResult)
+	}
+	if remap.ChangeApplied || len(trops.stagedFiles) != 0 {
+		t.Errorf("expected no config files to be applied")
+	}
+
+	// unknown header_rewrite operators are warnings, which don't prevent applying
+	trops = NewTrafficOpsReq(testCfg)
+	remap.Body = []byte("map http://a.example.net/ http://origin.example.net/ @plugin=header_rewrite.so @pparam=hdr_rw_a.config\n")
+	remap.pluginConfigErrs = nil
+	hdrRw.Body = []byte("cond %{REMAP_PSEUDO_HOOK}\nset-body-from http://example.net/error\n")
+	hdrRw.pluginConfigErrs = nil
+	trops.configFiles[remap.Name] = remap
+	trops.configFiles[hdrRw.Name] = hdrRw
+	if err := trops.validatePluginConfigs(remap); err != nil {
+		t.Errorf("expected unknown header_rewrite operator not to be an error, actual %v", err)
+	}
+	if len(hdrRw.pluginConfigErrs) != 0 {
+		t.Errorf("expected no plugin config errors recorded for unknown operator, actual %+v", hdrRw.pluginConfigErrs)
+	}
+}
@@ -0,0 +1,315 @@
+package util
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/traffic_ops_ort/t3c/config"
+)
+
+// CommandExecutor runs a command, and returns its stdout and exit code, and an error if it failed.
+// ExecCommand runs commands on the host; tests may use a fake.
+type CommandExecutor func(fullCommand string, arg ...string) ([]byte, int, error)
+
+// PackageManager queries, installs, and removes OS packages.
+//
+// Packages are identified by their full name, which includes their version, in the form the package manager uses
+// to install that version. Full names of installed packages are returned by Query, and of required packages by FullName.
+type PackageManager interface {
+	// Name returns the name of the package manager, e.g. "yum".
+	Name() string
+	// FullName returns the full name of the given version of the package.
+	FullName(name string, version string) string
+	// Query returns the full name of the installed package with the given name, or the empty string if it isn't installed.
+	Query(name string) (string, error)
+	// Requires returns the full names of the installed packages which depend on the installed package with the given full name.
+	Requires(fullName string) ([]string, error)
+	// Provides returns the full names of the installed packages which provide the given file.
+	Provides(file string) ([]string, error)
+	// ConfigFiles returns the paths of the config files of the installed package with the given name,
+	// or nil if it isn't installed.
+	ConfigFiles(name string) ([]string, error)
+	// Available returns whether the package with the given full name is available to install.
+	Available(fullName string) (bool, error)
+	// Install installs the package with the given full name.
+	Install(fullName string) error
+	// Remove removes the installed package with the given full name.
+	Remove(fullName string) error
+}
+
+// NewPackageManager returns the PackageManager for the given package management, which runs commands with exec.
+// The options are extra arguments to yum or dnf, e.g. from YUM_OPTIONS, and are ignored by apt.
+func NewPackageManager(pkgManagement config.PkgManagement, options string, exec CommandExecutor) (PackageManager, error) {
+	switch pkgManagement {
+	case config.PkgManagementYum:
+		return &rpmPackageManager{name: string(pkgManagement), command: config.Yum, options: strings.Fields(options), exec: exec}, nil
+	case config.PkgManagementDNF:
+		return &rpmPackageManager{name: string(pkgManagement), command: config.DNF, options: strings.Fields(options), exec: exec}, nil
+	case config.PkgManagementApt:
+		return &aptPackageManager{exec: exec}, nil
+	}
+	return nil, errors.New("unknown package manager '" + string(pkgManagement) + "'")
+}
+
+// splitLines returns the trimmed, non-empty lines of the output.
+func splitLines(output []byte) []string {
+	lines := []string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// rpmPackageManager is a PackageManager which installs packages with yum or dnf, and queries them with rpm.
+//
+// rpm returns an exit code of 1 when the queried package or file isn't installed or provided by any package,
+// which isn't an error.
+type rpmPackageManager struct {
+	name    string
+	command string
+	options []string
+	exec    CommandExecutor
+}
+
+func (m *rpmPackageManager) Name() string { return m.name }
+
+func (m *rpmPackageManager) FullName(name string, version string) string {
+	return name + "-" + version
+}
+
+func (m *rpmPackageManager) Query(name string) (string, error) {
+	lines, err := m.rpmQuery(name)
+	if len(lines) == 0 || err != nil {
+		return "", err
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (m *rpmPackageManager) Requires(fullName string) ([]string, error) {
+	return m.rpmQuery("--whatrequires", fullName)
+}
+
+func (m *rpmPackageManager) Provides(file string) ([]string, error) {
+	return m.rpmQuery("--whatprovides", file)
+}
+
+func (m *rpmPackageManager) ConfigFiles(name string) ([]string, error) {
+	return m.rpmQuery("-c", name)
+}
+
+// rpmQuery runs 'rpm -q' with the given arguments, and returns the lines of its output, or nil if nothing was found.
+func (m *rpmPackageManager) rpmQuery(arg ...string) ([]string, error) {
+	output, rc, err := m.exec(config.Rpm, append([]string{"-q"}, arg...)...)
+	if rc == 1 {
+		return nil, nil
+	} else if rc != 0 || err != nil {
+		if err == nil {
+			err = errors.New("exit code " + strconv.Itoa(rc))
+		}
+		return nil, err
+	}
+	log.Debugf("rpm query %v output: %s\n", arg, string(output))
+	return splitLines(output), nil
+}
+
+func (m *rpmPackageManager) Available(fullName string) (bool, error) {
+	return m.run("info", fullName)
+}
+
+func (m *rpmPackageManager) Install(fullName string) error {
+	_, err := m.run("install", "-y", fullName)
+	return err
+}
+
+func (m *rpmPackageManager) Remove(fullName string) error {
+	_, err := m.run("remove", "-y", fullName)
+	return err
+}
+
+// run runs yum or dnf with the given arguments, and returns whether it succeeded.
+func (m *rpmPackageManager) run(arg ...string) (bool, error) {
+	args := append(append([]string{}, m.options...), arg...)
+	_, rc, err := m.exec(m.command, args...)
+	if rc == 0 {
+		return true, nil
+	}
+	if err == nil {
+		err = errors.New(m.name + " exit code " + strconv.Itoa(rc))
+	}
+	return false, err
+}
+
+// aptPackageManager is a PackageManager which installs packages with apt-get, and queries them with dpkg-query and apt-cache.
+// Full names are in the form 'name=version', which apt-get installs.
+type aptPackageManager struct {
+	exec CommandExecutor
+}
+
+func (m *aptPackageManager) Name() string { return string(config.PkgManagementApt) }
+
+func (m *aptPackageManager) FullName(name string, version string) string {
+	return name + "=" + version
+}
+
+// packageName returns the name of the package with the given full name.
+func (m *aptPackageManager) packageName(fullName string) string {
+	return strings.SplitN(fullName, "=", 2)[0]
+}
+
+// dpkgQuery runs dpkg-query with the given arguments, and returns its output, or false if the package or file is unknown,
+// which dpkg-query indicates with an exit code of 1.
+func (m *aptPackageManager) dpkgQuery(arg ...string) ([]byte, bool, error) {
+	output, rc, err := m.exec(config.DpkgQuery, arg...)
+	if rc == 1 {
+		return nil, false, nil
+	} else if rc != 0 || err != nil {
+		if err == nil {
+			err = errors.New("dpkg-query exit code " + strconv.Itoa(rc))
+		}
+		return nil, false, err
+	}
+	return output, true, nil
+}
+
+func (m *aptPackageManager) Query(name string) (string, error) {
+	output, ok, err := m.dpkgQuery("--show", "--showformat=${db:Status-Abbrev}\t${Version}\n", m.packageName(name))
+	if !ok || err != nil {
+		return "", err
+	}
+	for _, line := range splitLines(output) {
+		// packages which were removed but whose config files remain are known, but not installed.
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "ii" {
+			return m.FullName(m.packageName(name), fields[1]), nil
+		}
+	}
+	return "", nil
+}
+
+func (m *aptPackageManager) Requires(fullName string) ([]string, error) {
+	output, rc, err := m.exec(config.AptCache, "rdepends", "--installed", m.packageName(fullName))
+	if rc != 0 || err != nil {
+		if err == nil {
+			err = errors.New("apt-cache exit code " + strconv.Itoa(rc))
+		}
+		return nil, err
+	}
+	names := map[string]struct{}{}
+	inDepends := false
+	for _, line := range splitLines(output) {
+		if line == "Reverse Depends:" {
+			inDepends = true
+			continue
+		}
+		if inDepends {
+			names[strings.TrimPrefix(line, "|")] = struct{}{}
+		}
+	}
+	return m.queryAll(names)
+}
+
+func (m *aptPackageManager) Provides(file string) ([]string, error) {
+	output, ok, err := m.dpkgQuery("--search", file)
+	if !ok || err != nil {
+		return nil, err
+	}
+	names := map[string]struct{}{}
+	for _, line := range splitLines(output) {
+		// lines are 'package[, package...]: path'
+		pkgs := strings.SplitN(line, ": ", 2)[0]
+		for _, name := range strings.Split(pkgs, ",") {
+			// multi-arch packages are listed with their architecture, e.g. 'package:amd64'.
+			names[strings.SplitN(strings.TrimSpace(name), ":", 2)[0]] = struct{}{}
+		}
+	}
+	return m.queryAll(names)
+}
+
+// queryAll returns the sorted full names of the installed packages with the given names.
+func (m *aptPackageManager) queryAll(names map[string]struct{}) ([]string, error) {
+	fullNames := []string{}
+	for name := range names {
+		fullName, err := m.Query(name)
+		if err != nil {
+			return nil, err
+		}
+		if fullName != "" {
+			fullNames = append(fullNames, fullName)
+		}
+	}
+	if len(fullNames) == 0 {
+		return nil, nil
+	}
+	sort.Strings(fullNames)
+	return fullNames, nil
+}
+
+func (m *aptPackageManager) ConfigFiles(name string) ([]string, error) {
+	output, ok, err := m.dpkgQuery("--show", "--showformat=${Conffiles}\n", m.packageName(name))
+	if !ok || err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, line := range splitLines(output) {
+		// lines are 'path checksum'
+		files = append(files, strings.Fields(line)[0])
+	}
+	return files, nil
+}
+
+func (m *aptPackageManager) Available(fullName string) (bool, error) {
+	output, rc, err := m.exec(config.AptCache, "show", fullName)
+	if rc == 0 && len(splitLines(output)) > 0 {
+		return true, nil
+	}
+	if err == nil {
+		err = errors.New("apt-cache exit code " + strconv.Itoa(rc))
+	}
+	return false, err
+}
+
+func (m *aptPackageManager) Install(fullName string) error {
+	return m.aptGet("install", "-y", fullName)
+}
+
+func (m *aptPackageManager) Remove(fullName string) error {
+	return m.aptGet("remove", "-y", m.packageName(fullName))
+}
+
+// aptGet runs apt-get with the given arguments, and returns an error if it fails.
+// It runs non-interactively, keeping the installed version of any changed conffile, because a prompt would hang t3c.
+func (m *aptPackageManager) aptGet(arg ...string) error {
+	envArgs := []string{"DEBIAN_FRONTEND=noninteractive", config.Apt, "-o", "Dpkg::Options::=--force-confold"}
+	_, rc, err := m.exec(config.Env, append(envArgs, arg...)...)
+	if rc == 0 {
+		return nil
+	}
+	if err == nil {
+		err = errors.New("apt-get exit code " + strconv.Itoa(rc))
+	}
+	return err
+}
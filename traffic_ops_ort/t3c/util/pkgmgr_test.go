@@ -0,0 +1,155 @@
+package util
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apache/trafficcontrol/traffic_ops_ort/t3c/config"
+)
+
+// fakeCommandResult is the output and exit code of a fake command.
+type fakeCommandResult struct {
+	Output string
+	RC     int
+}
+
+// fakeExecutor is a CommandExecutor which returns the results of commands by their full command line,
+// and records the commands it ran. Unknown commands fail with an exit code of 1.
+type fakeExecutor struct {
+	Results map[string]fakeCommandResult
+	Ran     []string
+}
+
+func (f *fakeExecutor) Exec(fullCommand string, arg ...string) ([]byte, int, error) {
+	cmd := strings.Join(append([]string{fullCommand}, arg...), " ")
+	f.Ran = append(f.Ran, cmd)
+	result, ok := f.Results[cmd]
+	if !ok {
+		result = fakeCommandResult{RC: 1}
+	}
+	if result.RC != 0 {
+		return []byte(result.Output), result.RC, errors.New("Error executing '" + fullCommand + "'")
+	}
+	return []byte(result.Output), 0, nil
+}
+
+func TestRPMPackageManager(t *testing.T) {
+	exec := &fakeExecutor{Results: map[string]fakeCommandResult{
+		"/bin/rpm -q trafficserver":                                                               {Output: "trafficserver-8.1.1-1.el7.x86_64\n"},
+		"/bin/rpm -q --whatrequires trafficserver-8.1.1-1.el7.x86_64":                             {Output: "astats_over_http-1.5-1.el7.x86_64\n"},
+		"/bin/rpm -q --whatprovides /opt/trafficserver/libexec/trafficserver/astats_over_http.so": {Output: "astats_over_http-1.5-1.el7.x86_64\n"},
+		"/usr/bin/yum --enablerepo=cdn info trafficserver-9.0.0-1.el7.x86_64":                     {},
+		"/usr/bin/yum --enablerepo=cdn install -y trafficserver-9.0.0-1.el7.x86_64":               {},
+	}}
+	pm, err := NewPackageManager(config.PkgManagementYum, "--enablerepo=cdn", exec.Exec)
+	if err != nil {
+		t.Fatalf("expected no error creating yum package manager, actual %v", err)
+	}
+
+	if fullName := pm.FullName("trafficserver", "9.0.0-1.el7.x86_64"); fullName != "trafficserver-9.0.0-1.el7.x86_64" {
+		t.Errorf("expected full name 'trafficserver-9.0.0-1.el7.x86_64', actual '%v'", fullName)
+	}
+	if installed, err := pm.Query("trafficserver"); err != nil || installed != "trafficserver-8.1.1-1.el7.x86_64" {
+		t.Errorf("expected installed 'trafficserver-8.1.1-1.el7.x86_64', actual '%v' %v", installed, err)
+	}
+	if installed, err := pm.Query("teakd"); err != nil || installed != "" {
+		t.Errorf("expected package not installed, actual '%v' %v", installed, err)
+	}
+	if reqs, err := pm.Requires("trafficserver-8.1.1-1.el7.x86_64"); err != nil || !reflect.DeepEqual(reqs, []string{"astats_over_http-1.5-1.el7.x86_64"}) {
+		t.Errorf("expected requires 'astats_over_http-1.5-1.el7.x86_64', actual %v %v", reqs, err)
+	}
+	if pkgs, err := pm.Provides("/opt/trafficserver/libexec/trafficserver/astats_over_http.so"); err != nil || !reflect.DeepEqual(pkgs, []string{"astats_over_http-1.5-1.el7.x86_64"}) {
+		t.Errorf("expected provides 'astats_over_http-1.5-1.el7.x86_64', actual %v %v", pkgs, err)
+	}
+	if ok, err := pm.Available("trafficserver-9.0.0-1.el7.x86_64"); err != nil || !ok {
+		t.Errorf("expected package available, actual %v %v", ok, err)
+	}
+	if err := pm.Install("trafficserver-9.0.0-1.el7.x86_64"); err != nil {
+		t.Errorf("expected install to succeed, actual %v", err)
+	}
+	if err := pm.Remove("trafficserver-8.1.1-1.el7.x86_64"); err == nil {
+		t.Errorf("expected failed remove to return an error")
+	}
+}
+
+func TestAptPackageManager(t *testing.T) {
+	exec := &fakeExecutor{Results: map[string]fakeCommandResult{
+		"/usr/bin/dpkg-query --show --showformat=${db:Status-Abbrev}\t${Version}\n trafficserver":                                          {Output: "ii \t8.1.1-1\n"},
+		"/usr/bin/dpkg-query --show --showformat=${db:Status-Abbrev}\t${Version}\n astats-over-http":                                       {Output: "ii \t1.5-1\n"},
+		"/usr/bin/dpkg-query --show --showformat=${db:Status-Abbrev}\t${Version}\n teakd":                                                  {Output: "rc \t2.0-1\n"},
+		"/usr/bin/dpkg-query --show --showformat=${Conffiles}\n trafficserver":                                                             {Output: " /opt/trafficserver/etc/trafficserver/records.config 0e4b3ffa7ec6a4b0\n"},
+		"/usr/bin/apt-cache rdepends --installed trafficserver":                                                                            {Output: "trafficserver\nReverse Depends:\n  astats-over-http\n |astats-over-http\n"},
+		"/usr/bin/dpkg-query --search /opt/trafficserver/libexec/trafficserver/astats_over_http.so":                                        {Output: "astats-over-http:amd64: /opt/trafficserver/libexec/trafficserver/astats_over_http.so\n"},
+		"/usr/bin/apt-cache show trafficserver=9.0.0-1":                                                                                    {Output: "Package: trafficserver\nVersion: 9.0.0-1\n"},
+		"/usr/bin/env DEBIAN_FRONTEND=noninteractive /usr/bin/apt-get -o Dpkg::Options::=--force-confold install -y trafficserver=9.0.0-1": {},
+		"/usr/bin/env DEBIAN_FRONTEND=noninteractive /usr/bin/apt-get -o Dpkg::Options::=--force-confold remove -y trafficserver":          {},
+	}}
+	pm, err := NewPackageManager(config.PkgManagementApt, "--enablerepo=cdn", exec.Exec)
+	if err != nil {
+		t.Fatalf("expected no error creating apt package manager, actual %v", err)
+	}
+
+	if fullName := pm.FullName("trafficserver", "9.0.0-1"); fullName != "trafficserver=9.0.0-1" {
+		t.Errorf("expected full name 'trafficserver=9.0.0-1', actual '%v'", fullName)
+	}
+	if installed, err := pm.Query("trafficserver"); err != nil || installed != "trafficserver=8.1.1-1" {
+		t.Errorf("expected installed 'trafficserver=8.1.1-1', actual '%v' %v", installed, err)
+	}
+	if installed, err := pm.Query("teakd"); err != nil || installed != "" {
+		t.Errorf("expected removed package with remaining config not installed, actual '%v' %v", installed, err)
+	}
+	if installed, err := pm.Query("unknown"); err != nil || installed != "" {
+		t.Errorf("expected unknown package not installed, actual '%v' %v", installed, err)
+	}
+	if reqs, err := pm.Requires("trafficserver=8.1.1-1"); err != nil || !reflect.DeepEqual(reqs, []string{"astats-over-http=1.5-1"}) {
+		t.Errorf("expected requires 'astats-over-http=1.5-1', actual %v %v", reqs, err)
+	}
+	if pkgs, err := pm.Provides("/opt/trafficserver/libexec/trafficserver/astats_over_http.so"); err != nil || !reflect.DeepEqual(pkgs, []string{"astats-over-http=1.5-1"}) {
+		t.Errorf("expected provides 'astats-over-http=1.5-1', actual %v %v", pkgs, err)
+	}
+	if files, err := pm.ConfigFiles("trafficserver"); err != nil || !reflect.DeepEqual(files, []string{"/opt/trafficserver/etc/trafficserver/records.config"}) {
+		t.Errorf("expected config file '/opt/trafficserver/etc/trafficserver/records.config', actual %v %v", files, err)
+	}
+	if ok, err := pm.Available("trafficserver=9.0.0-1"); err != nil || !ok {
+		t.Errorf("expected package available, actual %v %v", ok, err)
+	}
+	if ok, _ := pm.Available("trafficserver=10.0.0-1"); ok {
+		t.Errorf("expected unknown version not available")
+	}
+	if err := pm.Install("trafficserver=9.0.0-1"); err != nil {
+		t.Errorf("expected install to succeed, actual %v", err)
+	}
+	if err := pm.Remove("trafficserver=8.1.1-1"); err != nil {
+		t.Errorf("expected remove by package name to succeed, actual %v", err)
+	}
+	for _, cmd := range exec.Ran {
+		if strings.Contains(cmd, "--enablerepo") {
+			t.Errorf("expected yum options to be ignored by apt, actual '%v'", cmd)
+		}
+	}
+
+	if _, err := NewPackageManager(config.PkgManagementUnknown, "", exec.Exec); err == nil {
+		t.Errorf("expected an error creating an unknown package manager")
+	}
+}
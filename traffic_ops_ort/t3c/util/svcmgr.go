@@ -0,0 +1,165 @@
+package util
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/traffic_ops_ort/t3c/config"
+)
+
+// ServiceManager queries, starts, and enables OS services.
+type ServiceManager interface {
+	// Name returns the name of the service management, e.g. "SystemD".
+	Name() string
+	// Status returns whether the service is running, and its main PID if it's known, else -1.
+	Status(name string) (ServiceStatus, int, error)
+	// Start starts or restarts the service, where cmd is 'start' or 'restart'.
+	// Returns whether the service was started; starting a service which is already running does nothing.
+	Start(name string, cmd string) (bool, error)
+	// Enable enables the service at startup. The SystemV run levels are ignored by SystemD.
+	Enable(name string, levels []string) error
+}
+
+// NewServiceManager returns the ServiceManager for the given service management, which runs commands with exec.
+func NewServiceManager(svcManagement config.SvcManagement, exec CommandExecutor) (ServiceManager, error) {
+	switch svcManagement {
+	case config.SystemD:
+		return &systemDServiceManager{exec: exec}, nil
+	case config.SystemV:
+		return &systemVServiceManager{exec: exec}, nil
+	}
+	return nil, errors.New("unknown service management '" + svcManagement.String() + "'")
+}
+
+// startService starts or restarts the service with the given manager, unless cmd is 'start' and it's already running.
+func startService(m ServiceManager, name string, cmd string, run func() (int, error)) (bool, error) {
+	log.Infof("ServiceStart called for '%s'\n", name)
+	svcStatus, pid, err := m.Status(name)
+	if err != nil {
+		return false, errors.New("Could not get status for '" + name + "' : " + err.Error())
+	} else if svcStatus == SvcRunning && cmd == "start" {
+		log.Infof("service '%s' is already running, pid: %d\n", name, pid)
+		return false, nil
+	}
+	rc, err := run()
+	if err != nil {
+		return false, errors.New("Could not " + cmd + " the '" + name + "' service: " + err.Error())
+	}
+	return rc == 0, nil
+}
+
+// systemDServiceManager is a ServiceManager which manages services with systemctl.
+type systemDServiceManager struct {
+	exec CommandExecutor
+}
+
+func (m *systemDServiceManager) Name() string { return config.SystemD.String() }
+
+func (m *systemDServiceManager) Status(name string) (ServiceStatus, int, error) {
+	pid := -1
+	output, rc, err := m.exec(config.SystemCtl, "status", name)
+	// service is down
+	if rc == 3 {
+		return SvcNotRunning, pid, nil
+	} else if err != nil {
+		return SvcUnknown, pid, errors.New("could not get status for service '" + name + "'\n")
+	}
+	active := false
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.Contains(line, "Active: active") {
+			active = true
+		}
+		if active && strings.Contains(line, "Main PID: ") {
+			fmt.Sscanf(line, "Main PID: %d", &pid)
+		}
+	}
+	if active {
+		return SvcRunning, pid, nil
+	}
+	return SvcNotRunning, pid, nil
+}
+
+func (m *systemDServiceManager) Start(name string, cmd string) (bool, error) {
+	return startService(m, name, cmd, func() (int, error) {
+		_, rc, err := m.exec(config.SystemCtl, cmd, name)
+		return rc, err
+	})
+}
+
+func (m *systemDServiceManager) Enable(name string, levels []string) error {
+	out, rc, err := m.exec(config.SystemCtl, "enable", name)
+	if err != nil {
+		log.Errorf(string(out))
+		return errors.New("Unable to enable service " + name + ": " + err.Error())
+	}
+	if rc == 0 {
+		log.Infof("The %s service has been enabled\n", name)
+	}
+	return nil
+}
+
+// systemVServiceManager is a ServiceManager which manages legacy System V init services with service and chkconfig.
+type systemVServiceManager struct {
+	exec CommandExecutor
+}
+
+// systemVPIDRe matches the PID in the status of a running System V service, e.g. 'trafficserver (pid 1234) is running...'.
+var systemVPIDRe = regexp.MustCompile(`pid\s+(\d+)`)
+
+func (m *systemVServiceManager) Name() string { return config.SystemV.String() }
+
+func (m *systemVServiceManager) Status(name string) (ServiceStatus, int, error) {
+	pid := -1
+	output, rc, err := m.exec(config.Service, name, "status")
+	// LSB init scripts exit 3 when the service isn't running
+	if rc == 3 {
+		return SvcNotRunning, pid, nil
+	} else if err != nil {
+		return SvcUnknown, pid, errors.New("could not get status for service '" + name + "'\n")
+	}
+	if match := systemVPIDRe.FindStringSubmatch(string(output)); match != nil {
+		fmt.Sscanf(match[1], "%d", &pid)
+	}
+	return SvcRunning, pid, nil
+}
+
+func (m *systemVServiceManager) Start(name string, cmd string) (bool, error) {
+	return startService(m, name, cmd, func() (int, error) {
+		_, rc, err := m.exec(config.Service, name, cmd)
+		return rc, err
+	})
+}
+
+func (m *systemVServiceManager) Enable(name string, levels []string) error {
+	_, rc, err := m.exec(config.Chkconfig, "--level", strings.Join(levels, ""), name, "on")
+	if err != nil {
+		return errors.New("Unable to enable service " + name + ": " + err.Error())
+	}
+	if rc == 0 {
+		log.Infof("The %s service has been enabled\n", name)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package util
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/apache/trafficcontrol/traffic_ops_ort/t3c/config"
+)
+
+func TestSystemDServiceManager(t *testing.T) {
+	exec := &fakeExecutor{Results: map[string]fakeCommandResult{
+		"/bin/systemctl status trafficserver":  {Output: "● trafficserver.service - Apache Traffic Server\n   Active: active (running) since Tue 2021-04-13 17:32:05 UTC\n Main PID: 1234 (traffic_manager)\n"},
+		"/bin/systemctl status teakd":          {RC: 3},
+		"/bin/systemctl start teakd":           {},
+		"/bin/systemctl restart trafficserver": {},
+		"/bin/systemctl enable teakd":          {},
+	}}
+	sm, err := NewServiceManager(config.SystemD, exec.Exec)
+	if err != nil {
+		t.Fatalf("expected no error creating SystemD service manager, actual %v", err)
+	}
+
+	if status, pid, err := sm.Status("trafficserver"); err != nil || status != SvcRunning || pid != 1234 {
+		t.Errorf("expected trafficserver running with pid 1234, actual %v %v %v", status, pid, err)
+	}
+	if status, _, err := sm.Status("teakd"); err != nil || status != SvcNotRunning {
+		t.Errorf("expected teakd not running, actual %v %v", status, err)
+	}
+	if started, err := sm.Start("trafficserver", "start"); err != nil || started {
+		t.Errorf("expected starting a running service to do nothing, actual %v %v", started, err)
+	}
+	if started, err := sm.Start("trafficserver", "restart"); err != nil || !started {
+		t.Errorf("expected restarting a running service to restart it, actual %v %v", started, err)
+	}
+	if started, err := sm.Start("teakd", "start"); err != nil || !started {
+		t.Errorf("expected starting a stopped service to start it, actual %v %v", started, err)
+	}
+	if err := sm.Enable("teakd", []string{"2", "3"}); err != nil {
+		t.Errorf("expected enable to succeed, actual %v", err)
+	}
+	if err := sm.Enable("unknown", nil); err == nil {
+		t.Errorf("expected enabling an unknown service to fail")
+	}
+}
+
+func TestSystemVServiceManager(t *testing.T) {
+	exec := &fakeExecutor{Results: map[string]fakeCommandResult{
+		"/sbin/service trafficserver status":    {Output: "traffic_cop (pid 1234) is running...\n"},
+		"/sbin/service teakd status":            {RC: 3},
+		"/sbin/service teakd start":             {},
+		"/sbin/chkconfig --level 2345 teakd on": {},
+	}}
+	sm, err := NewServiceManager(config.SystemV, exec.Exec)
+	if err != nil {
+		t.Fatalf("expected no error creating SystemV service manager, actual %v", err)
+	}
+
+	if status, pid, err := sm.Status("trafficserver"); err != nil || status != SvcRunning || pid != 1234 {
+		t.Errorf("expected trafficserver running with pid 1234, actual %v %v %v", status, pid, err)
+	}
+	if started, err := sm.Start("teakd", "start"); err != nil || !started {
+		t.Errorf("expected starting a stopped service to start it, actual %v %v", started, err)
+	}
+	if err := sm.Enable("teakd", []string{"2", "3", "4", "5"}); err != nil {
+		t.Errorf("expected enable to succeed, actual %v", err)
+	}
+	expected := []string{
+		"/sbin/service trafficserver status",
+		"/sbin/service teakd status",
+		"/sbin/service teakd start",
+		"/sbin/chkconfig --level 2345 teakd on",
+	}
+	if !reflect.DeepEqual(exec.Ran, expected) {
+		t.Errorf("expected commands %v, actual %v", expected, exec.Ran)
+	}
+
+	if _, err := NewServiceManager(config.Unknown, exec.Exec); err == nil {
+		t.Errorf("expected an error creating an unknown service manager")
+	}
+}
@@ -22,7 +22,6 @@ package util
 import (
 	"bytes"
 	"errors"
-	"fmt"
 	"github.com/apache/trafficcontrol/lib/go-log"
 	"github.com/apache/trafficcontrol/traffic_ops_ort/t3c/config"
 	"github.com/gofrs/flock"
@@ -143,56 +142,6 @@ func ReadFile(fn string) ([]byte, error) {
 	return data, nil
 }
 
-func GetServiceStatus(name string) (ServiceStatus, int, error) {
-	var pid int = -1
-	var active bool = false
-
-	output, rc, err := ExecCommand("/usr/sbin/service", name, "status")
-	// service is down
-	if rc == 3 {
-		return SvcNotRunning, pid, nil
-	} else if err != nil {
-		return SvcUnknown, pid, errors.New("could not get status for service '" + name + "'\n")
-	}
-	lines := strings.Split(string(output), "\n")
-	for ii := range lines {
-		line := strings.TrimSpace(lines[ii])
-		if strings.Contains(line, "Active: active") {
-			active = true
-		}
-		if active && strings.Contains(line, "Main PID: ") {
-			fmt.Sscanf(line, "Main PID: %d", &pid)
-		}
-	}
-
-	if active {
-		return SvcRunning, pid, nil
-	} else {
-		return SvcNotRunning, pid, nil
-	}
-}
-
-// start or restart the service 'service'. cmd is 'start | restart'
-func ServiceStart(service string, cmd string) (bool, error) {
-	log.Infof("ServiceStart called for '%s'\n", service)
-	svcStatus, pid, err := GetServiceStatus(service)
-	if err != nil {
-		return false, errors.New("Could not get status for '" + service + "' : " + err.Error())
-	} else if svcStatus == SvcRunning && cmd == "start" {
-		log.Infof("service '%s' is already running, pid: %d\n", service, pid)
-	} else {
-		_, rc, err := ExecCommand("/usr/sbin/service", service, cmd)
-		if err != nil {
-			return false, errors.New("Could not " + cmd + " the '" + service + "' service: " + err.Error())
-		} else if rc == 0 {
-			// service was sucessfully started
-			return true, nil
-		}
-	}
-	// not started, service is already running
-	return false, nil
-}
-
 func WriteFile(fn string, data []byte, perm os.FileMode) (int, error) {
 	return WriteFileWithOwner(fn, data, -1, -1, perm)
 }
@@ -218,101 +167,6 @@ func WriteFileWithOwner(fn string, data []byte, uid int, gid int, perm os.FileMo
 	return c, nil
 }
 
-func PackageAction(cmdstr string, name string) (bool, error) {
-	var rc int = -1
-	var err error = nil
-	var result bool = false
-
-	switch cmdstr {
-	case "info":
-		_, rc, err = ExecCommand("/usr/bin/yum", "info", name)
-	case "install":
-		_, rc, err = ExecCommand("/usr/bin/yum", "install", "-y", name)
-	case "remove":
-		_, rc, err = ExecCommand("/usr/bin/yum", "remove", "-y", name)
-	}
-
-	if rc == 0 {
-		result = true
-		err = nil
-	}
-	return result, err
-}
-
-// runs the rpm command.
-// if the return code from rpm == 0, then a valid package list is returned.
-//
-// if the return code is 1, the the 'name' queried for is not part of a
-//   package or is not installed.
-//
-// otherwise, if the return code is not 0 or 1 and error is set, a general
-// rpm command execution error is assumed and the error is returned.
-func PackageInfo(cmdstr string, name string) ([]string, error) {
-	var result []string
-	switch cmdstr {
-	case "cfg-files": // returns a list of the package configuration files.
-		output, rc, err := ExecCommand("/bin/rpm", "-q", "-c", name)
-		if rc == 1 { // rpm package for 'name' was not found.
-			return nil, nil
-		} else if rc == 0 { // add the package name the file belongs to.
-			log.Debugf("output from cfg-files query: %s\n", string(output))
-			files := strings.Split(string(output), "\n")
-			for ii := range files {
-				result = append(result, strings.TrimSpace(files[ii]))
-			}
-			log.Debugf("result length: %d, result: %s\n", len(result), string(output))
-		} else if err != nil {
-			return nil, err
-		}
-	case "file-query": // returns the rpm name that owns the file 'name'
-		output, rc, err := ExecCommand("/bin/rpm", "-q", "-f", name)
-		if rc == 1 { // file is not part of any package.
-			return nil, nil
-		} else if rc == 0 { // add the package name the file belongs to.
-			log.Debugf("output from file-query: %s\n", string(output))
-			result = append(result, string(strings.TrimSpace(string(output))))
-			log.Debugf("result length: %d, result: %s\n", len(result), string(output))
-		} else if err != nil {
-			return nil, err
-		}
-	case "pkg-provides": // returns the package name that provides 'name'
-		output, rc, err := ExecCommand("/bin/rpm", "-q", "--whatprovides", name)
-		log.Debugf("pkg-provides - name: %s, output: %s\n", name, output)
-		if rc == 1 { // no package provides 'name'
-			return nil, nil
-		} else if rc == 0 {
-			pkgs := strings.Split(string(output), "\n")
-			for ii := range pkgs {
-				result = append(result, strings.TrimSpace(pkgs[ii]))
-			}
-		} else if err != nil {
-			return nil, err
-		}
-	case "pkg-query": // returns the package name for 'name'.
-		output, rc, err := ExecCommand("/bin/rpm", "-q", name)
-		if rc == 1 { // the package is not installed.
-			return nil, nil
-		} else if rc == 0 { // add the rpm name
-			result = append(result, string(strings.TrimSpace(string(output))))
-		} else if err != nil {
-			return nil, err
-		}
-	case "pkg-requires": // returns a list of packages that requires package 'name'
-		output, rc, err := ExecCommand("/bin/rpm", "-q", "--whatrequires", name)
-		if rc == 1 { // no package reuires package 'name'
-			return nil, nil
-		} else if rc == 0 {
-			pkgs := strings.Split(string(output), "\n")
-			for ii := range pkgs {
-				result = append(result, strings.TrimSpace(pkgs[ii]))
-			}
-		} else if err != nil {
-			return nil, err
-		}
-	}
-	return result, nil
-}
-
 func RandomDuration(max time.Duration) time.Duration {
 	rand.Seed(time.Now().UnixNano())
 	return time.Duration(rand.Int63n(int64(max)))
@@ -0,0 +1,635 @@
+package t3cutil
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PluginConfigError is a reason a plugin config is invalid.
+type PluginConfigError struct {
+	// File is the file containing the invalid config.
+	File string `json:"file"`
+
+	// Line is the line number in File of the invalid config, starting at 1, or 0 if it isn't on any one line.
+	Line int `json:"line"`
+
+	// Reason is why the config is invalid.
+	Reason string `json:"reason"`
+
+	// Warning is whether the config may be valid, e.g. it uses a plugin operator or option the validator doesn't know.
+	// Warnings should be logged, but shouldn't prevent the config from being applied.
+	Warning bool `json:"warning,omitempty"`
+}
+
+func (err PluginConfigError) Error() string {
+	if err.Line == 0 {
+		return err.File + ": " + err.Reason
+	}
+	return err.File + ":" + strconv.Itoa(err.Line) + ": " + err.Reason
+}
+
+// PluginValidator validates the config of one ATS plugin.
+type PluginValidator struct {
+	// Args validates the plugin's arguments, from plugin.config or the @pparams of a remap.config rule.
+	// The returned errors need not have a File or Line, the caller sets them. May be nil.
+	Args func(args []string) []PluginConfigError
+
+	// Config validates the text of a config file given as an argument to the plugin.
+	// The returned errors need not have a File, the caller sets it. May be nil.
+	Config func(text string) []PluginConfigError
+}
+
+// PluginValidators is the validators of plugin configs, keyed on the plugin DSO file name.
+// Plugins without a validator aren't validated. To validate another plugin, add its validator.
+var PluginValidators = map[string]PluginValidator{
+	"cachekey.so":         {Args: validateCacheKeyArgs},
+	"header_rewrite.so":   {Config: validateHeaderRewrite},
+	"regex_remap.so":      {Config: validateRegexRemap},
+	"regex_revalidate.so": {Config: validateRegexRevalidate},
+	"uri_signing.so":      {Config: validateURISigning},
+	"url_sig.so":          {Config: validateURLSig},
+}
+
+// PluginConfigReader returns the contents of the plugin config file at path, which may be relative to the ATS config directory.
+// If the file doesn't exist, it must return an error for which os.IsNotExist is true.
+type PluginConfigReader func(path string) ([]byte, error)
+
+// pluginConfigFileRe matches plugin arguments which are config files, and captures the file name,
+// e.g. 'hdr_rw.config' or '--config=astats.config'.
+var pluginConfigFileRe = regexp.MustCompile(`^(?:-[^=]*=)?([^=\s]+\.(?:config|cfg|txt|yml|yaml|json))$`)
+
+// ValidatePluginConfigs validates the config of every plugin with a validator in PluginValidators,
+// used in the given plugin.config or remap.config text. The fileName is the name of the text, for errors.
+//
+// Plugin arguments are validated in place. Arguments which are config files are read with readFile and validated,
+// each only once. Config files which don't exist aren't validated; verifying they exist is left to the caller.
+// Returned errors with Warning set don't make the config invalid.
+func ValidatePluginConfigs(fileName string, text string, readFile PluginConfigReader) []PluginConfigError {
+	errs := []PluginConfigError{}
+	validatedFiles := map[string]struct{}{}
+	for _, line := range pluginConfigLines(text) {
+		for _, use := range pluginUses(line.Text) {
+			validator, ok := PluginValidators[filepath.Base(use.Plugin)]
+			if !ok {
+				continue
+			}
+			if validator.Args != nil {
+				for _, argErr := range validator.Args(use.Args) {
+					argErr.File = fileName
+					argErr.Line = line.Number
+					argErr.Reason = use.Plugin + ": " + argErr.Reason
+					errs = append(errs, argErr)
+				}
+			}
+			if validator.Config == nil {
+				continue
+			}
+			for _, arg := range use.Args {
+				match := pluginConfigFileRe.FindStringSubmatch(arg)
+				if match == nil {
+					continue
+				}
+				configFile := match[1]
+				if _, ok := validatedFiles[use.Plugin+" "+configFile]; ok {
+					continue
+				}
+				validatedFiles[use.Plugin+" "+configFile] = struct{}{}
+
+				bts, err := readFile(configFile)
+				if err != nil {
+					if !os.IsNotExist(err) {
+						errs = append(errs, PluginConfigError{File: configFile, Reason: "reading " + use.Plugin + " config: " + err.Error()})
+					}
+					continue
+				}
+				for _, configErr := range validator.Config(string(bts)) {
+					configErr.File = configFile
+					configErr.Reason = use.Plugin + ": " + configErr.Reason
+					errs = append(errs, configErr)
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// pluginConfigLine is a line of a plugin.config or remap.config, with continuations joined.
+type pluginConfigLine struct {
+	Text string
+	// Number is the line number of the first line of Text.
+	Number int
+}
+
+// pluginConfigLines returns the non-comment lines of text, with lines ending in a backslash joined with the next line.
+func pluginConfigLines(text string) []pluginConfigLine {
+	lines := []pluginConfigLine{}
+	current := pluginConfigLine{}
+	for i, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if current.Text == "" {
+			if strings.HasPrefix(strings.TrimSpace(line), "#") {
+				continue
+			}
+			current.Number = i + 1
+		}
+		if strings.HasSuffix(line, `\`) {
+			current.Text += strings.TrimSuffix(line, `\`) + " "
+			continue
+		}
+		current.Text += line
+		if strings.TrimSpace(current.Text) != "" {
+			lines = append(lines, current)
+		}
+		current = pluginConfigLine{}
+	}
+	if strings.TrimSpace(current.Text) != "" {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+// pluginUse is a plugin and its arguments, from a line of a plugin.config or remap.config.
+type pluginUse struct {
+	Plugin string
+	Args   []string
+}
+
+// pluginUses returns the plugins used by a plugin.config or remap.config line, in order.
+func pluginUses(line string) []pluginUse {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	uses := []pluginUse{}
+	for _, field := range fields {
+		switch {
+		case strings.HasPrefix(field, "@plugin="):
+			uses = append(uses, pluginUse{Plugin: strings.TrimPrefix(field, "@plugin=")})
+		case strings.HasPrefix(field, "@pparam=") && len(uses) > 0:
+			uses[len(uses)-1].Args = append(uses[len(uses)-1].Args, strings.TrimPrefix(field, "@pparam="))
+		}
+	}
+	if len(uses) > 0 {
+		return uses // remap.config rule
+	}
+
+	if !strings.HasSuffix(fields[0], ".so") {
+		return nil
+	}
+	return []pluginUse{{Plugin: fields[0], Args: fields[1:]}} // plugin.config line
+}
+
+// configLines calls f with each non-blank, non-comment line of a plugin config, with surrounding whitespace removed, and its line number.
+func configLines(text string, f func(line string, number int)) {
+	for i, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f(line, i+1)
+	}
+}
+
+// checkRegex returns why the PCRE regex re is invalid, or the empty string if it's valid.
+//
+// ATS plugins use PCRE, which has syntax Go doesn't, e.g. lookaheads and backreferences,
+// so regexes Go can't compile are only reported if they're also invalid in PCRE.
+func checkRegex(re string) string {
+	_, err := syntax.Parse(re, syntax.Perl)
+	if err == nil {
+		return ""
+	}
+	synErr, ok := err.(*syntax.Error)
+	if !ok {
+		return ""
+	}
+	switch synErr.Code {
+	case syntax.ErrMissingBracket, syntax.ErrMissingParen, syntax.ErrUnexpectedParen, syntax.ErrTrailingBackslash, syntax.ErrMissingRepeatArgument, syntax.ErrInvalidCharRange:
+		return "invalid regex '" + re + "': " + string(synErr.Code)
+	}
+	return ""
+}
+
+// headerRewriteFlags is the flags valid on header_rewrite conditions and operators.
+var headerRewriteFlags = map[string]struct{}{
+	"AND": {}, "OR": {}, "NOT": {}, "NOCASE": {}, "NC": {}, "PRE": {}, "SUF": {}, "MID": {}, "EXT": {},
+	"L": {}, "LAST": {}, "QSA": {}, "I": {}, "INV": {},
+}
+
+// headerRewriteOperatorArgs is the minimum number of arguments of header_rewrite operators which require them.
+var headerRewriteOperatorArgs = map[string]int{
+	"add-cookie":      2,
+	"add-header":      2,
+	"counter":         1,
+	"rm-cookie":       1,
+	"rm-header":       1,
+	"set-config":      2,
+	"set-conn-dscp":   1,
+	"set-conn-mark":   1,
+	"set-cookie":      2,
+	"set-destination": 2,
+	"set-header":      2,
+	"set-redirect":    2,
+	"set-status":      1,
+}
+
+// headerRewriteCondRe matches a header_rewrite condition, e.g. '%{CLIENT-HEADER:Host}'.
+var headerRewriteCondRe = regexp.MustCompile(`^%\{[A-Z][A-Z0-9_-]*(:[^}]*)?\}$`)
+
+// validateHeaderRewrite validates a header_rewrite config, which is conditions and operators, one per line.
+func validateHeaderRewrite(text string) []PluginConfigError {
+	errs := []PluginConfigError{}
+	configLines(text, func(line string, number int) {
+		addErr := func(reason string) { errs = append(errs, PluginConfigError{Line: number, Reason: reason}) }
+
+		tokens, ok := headerRewriteTokens(line)
+		if !ok {
+			addErr("unterminated quote")
+			return
+		}
+
+		args := tokens[1:]
+		for len(args) > 0 && strings.HasPrefix(args[len(args)-1], "[") {
+			flags := args[len(args)-1]
+			args = args[:len(args)-1]
+			if !strings.HasSuffix(flags, "]") {
+				addErr("malformed flags '" + flags + "'")
+				continue
+			}
+			for _, flag := range strings.Split(strings.Trim(flags, "[]"), ",") {
+				if _, ok := headerRewriteFlags[strings.TrimSpace(flag)]; !ok {
+					addErr("unknown flag '" + flag + "'")
+				}
+			}
+		}
+
+		switch op := tokens[0]; {
+		case op == "cond":
+			if len(args) == 0 {
+				addErr("cond missing condition")
+			} else if !headerRewriteCondRe.MatchString(args[0]) {
+				addErr("malformed condition '" + args[0] + "'")
+			}
+		case strings.HasPrefix(op, "set-") || strings.HasPrefix(op, "add-") || strings.HasPrefix(op, "rm-") ||
+			op == "counter" || op == "no-op" || op == "skip-remap" || op == "run-plugin":
+			if minArgs := headerRewriteOperatorArgs[op]; len(args) < minArgs {
+				addErr(op + " requires " + strconv.Itoa(minArgs) + " arguments, found " + strconv.Itoa(len(args)))
+				return
+			}
+			if op == "set-status" || op == "set-redirect" {
+				if code, err := strconv.Atoi(args[0]); err != nil || code < 100 || code > 599 {
+					addErr(op + " status '" + args[0] + "' is not an HTTP status code")
+				}
+			}
+		default:
+			// the validator doesn't know every operator of every ATS version, so unknown operators don't reject the config.
+			errs = append(errs, PluginConfigError{Line: number, Reason: "unknown operator '" + op + "'", Warning: true})
+		}
+	})
+	return errs
+}
+
+// headerRewriteTokens splits a header_rewrite line into whitespace-separated tokens, where double-quoted strings are one token.
+// Returns false if a quote is unterminated.
+func headerRewriteTokens(line string) ([]string, bool) {
+	tokens := []string{}
+	token := strings.Builder{}
+	inToken := false
+	inQuote := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && inQuote && i+1 < len(line):
+			token.WriteByte(c)
+			token.WriteByte(line[i+1])
+			i++
+		case c == '"':
+			inQuote = !inQuote
+			inToken = true
+			token.WriteByte(c)
+		case (c == ' ' || c == '\t') && !inQuote:
+			if inToken {
+				tokens = append(tokens, token.String())
+				token.Reset()
+				inToken = false
+			}
+		default:
+			inToken = true
+			token.WriteByte(c)
+		}
+	}
+	if inToken {
+		tokens = append(tokens, token.String())
+	}
+	return tokens, !inQuote
+}
+
+// regexRemapIntOptions is the regex_remap rule options with integer values.
+var regexRemapIntOptions = map[string]struct{}{
+	"@status": {}, "@active_timeout": {}, "@no_activity_timeout": {}, "@connect_timeout": {}, "@dns_timeout": {},
+}
+
+// validateRegexRemap validates a regex_remap config, which is a regex, substitution, and options per line.
+// Unknown options are warnings, because they may be valid in a newer regex_remap.
+func validateRegexRemap(text string) []PluginConfigError {
+	errs := []PluginConfigError{}
+	configLines(text, func(line string, number int) {
+		addErr := func(reason string) { errs = append(errs, PluginConfigError{Line: number, Reason: reason}) }
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			addErr("expected a regex and a substitution")
+			return
+		}
+		if reason := checkRegex(fields[0]); reason != "" {
+			addErr(reason)
+		}
+		for _, opt := range fields[2:] {
+			name := opt
+			val := ""
+			if i := strings.Index(opt, "="); i >= 0 {
+				name, val = opt[:i], opt[i+1:]
+			}
+			_, isInt := regexRemapIntOptions[name]
+			switch {
+			case name == "@caseless" || name == "@lowercase_substitutions" || name == "@overridable-config":
+			case isInt:
+				if _, err := strconv.Atoi(val); err != nil {
+					addErr("option " + name + " value '" + val + "' is not an integer")
+				}
+			default:
+				errs = append(errs, PluginConfigError{Line: number, Reason: "unknown option '" + opt + "'", Warning: true})
+			}
+		}
+	})
+	return errs
+}
+
+// urlSigMaxKeys is the number of keys url_sig supports, named key0 through key15.
+const urlSigMaxKeys = 16
+
+// validateURLSig validates a url_sig config, which is 'name = value' per line.
+func validateURLSig(text string) []PluginConfigError {
+	errs := []PluginConfigError{}
+	keys := map[string]int{}
+	hasKeys := false
+	configLines(text, func(line string, number int) {
+		addErr := func(reason string) { errs = append(errs, PluginConfigError{Line: number, Reason: reason}) }
+
+		i := strings.Index(line, "=")
+		if i < 0 {
+			addErr("expected 'name = value'")
+			return
+		}
+		name := strings.TrimSpace(line[:i])
+		val := strings.TrimSpace(line[i+1:])
+
+		switch {
+		case strings.HasPrefix(name, "key"):
+			hasKeys = true
+			num, err := strconv.Atoi(strings.TrimPrefix(name, "key"))
+			if err != nil || num < 0 || num >= urlSigMaxKeys {
+				addErr("invalid key name '" + name + "', must be key0 through key" + strconv.Itoa(urlSigMaxKeys-1))
+				return
+			}
+			if prevLine, ok := keys[name]; ok {
+				addErr("duplicate key '" + name + "', also on line " + strconv.Itoa(prevLine))
+				return
+			}
+			keys[name] = number
+			if val == "" || strings.ContainsAny(val, " \t") {
+				addErr("key '" + name + "' must be a non-empty value without whitespace")
+			}
+		case name == "error_url":
+			fields := strings.Fields(val)
+			if len(fields) == 0 || (fields[0] != "403" && fields[0] != "302") {
+				addErr("error_url must be '403' or '302 <url>'")
+			} else if fields[0] == "302" && len(fields) != 2 {
+				addErr("error_url '302' requires a url")
+			}
+		case name == "url_type":
+			if val != "remap" && val != "pristine" {
+				addErr("url_type must be 'remap' or 'pristine'")
+			}
+		case name == "excl_regex":
+			if reason := checkRegex(val); reason != "" {
+				addErr(reason)
+			}
+		case name == "sig_anchor" || name == "ignore_expiry":
+		default:
+			addErr("unknown parameter '" + name + "'")
+		}
+	})
+	if !hasKeys {
+		errs = append(errs, PluginConfigError{Reason: "no keys"})
+	}
+	return errs
+}
+
+// uriSigningIssuer is the config of one issuer in a uri_signing config.
+type uriSigningIssuer struct {
+	RenewalKID *string                  `json:"renewal_kid"`
+	Keys       []map[string]interface{} `json:"keys"`
+}
+
+// validateURISigning validates a uri_signing config, which is a JSON object of issuers and their JSON Web Keys.
+func validateURISigning(text string) []PluginConfigError {
+	issuers := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(text), &issuers); err != nil {
+		line := 0
+		if synErr, ok := err.(*json.SyntaxError); ok {
+			line = lineOfOffset(text, int(synErr.Offset))
+		}
+		return []PluginConfigError{{Line: line, Reason: "malformed JSON: " + err.Error()}}
+	}
+	if len(issuers) == 0 {
+		return []PluginConfigError{{Reason: "no issuers"}}
+	}
+
+	names := []string{}
+	for name := range issuers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := []PluginConfigError{}
+	for _, name := range names {
+		addErr := func(reason string) {
+			errs = append(errs, PluginConfigError{Line: lineOfString(text, strconv.Quote(name)), Reason: "issuer '" + name + "' " + reason})
+		}
+
+		issuer := uriSigningIssuer{}
+		if err := json.Unmarshal(issuers[name], &issuer); err != nil {
+			addErr("malformed: " + err.Error())
+			continue
+		}
+		if len(issuer.Keys) == 0 {
+			addErr("has no keys")
+			continue
+		}
+		kids := map[string]struct{}{}
+		for i, key := range issuer.Keys {
+			kty, _ := key["kty"].(string)
+			if kty == "" {
+				addErr("key " + strconv.Itoa(i) + " missing kty")
+			} else if _, ok := key["k"].(string); kty == "oct" && !ok {
+				addErr("key " + strconv.Itoa(i) + " of type oct missing k")
+			}
+			if kid, ok := key["kid"].(string); ok {
+				kids[kid] = struct{}{}
+			}
+		}
+		if issuer.RenewalKID != nil {
+			if _, ok := kids[*issuer.RenewalKID]; !ok {
+				addErr("renewal_kid '" + *issuer.RenewalKID + "' is not the kid of any key")
+			}
+		}
+	}
+	return errs
+}
+
+// lineOfOffset returns the line number of the byte offset in text, starting at 1.
+func lineOfOffset(text string, offset int) int {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	return strings.Count(text[:offset], "\n") + 1
+}
+
+// lineOfString returns the line number of the first occurrence of str in text, starting at 1, or 0 if text doesn't contain str.
+func lineOfString(text string, str string) int {
+	i := strings.Index(text, str)
+	if i < 0 {
+		return 0
+	}
+	return lineOfOffset(text, i)
+}
+
+// validateRegexRevalidate validates a regex_revalidate config, which is a regex, expiration epoch, and optional type per line.
+func validateRegexRevalidate(text string) []PluginConfigError {
+	errs := []PluginConfigError{}
+	configLines(text, func(line string, number int) {
+		addErr := func(reason string) { errs = append(errs, PluginConfigError{Line: number, Reason: reason}) }
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 && len(fields) != 3 {
+			addErr("expected a regex, an expiration, and an optional type")
+			return
+		}
+		if reason := checkRegex(fields[0]); reason != "" {
+			addErr(reason)
+		}
+		if epoch, err := strconv.ParseInt(fields[1], 10, 64); err != nil || epoch <= 0 {
+			addErr("expiration '" + fields[1] + "' is not a unix epoch")
+		}
+		if len(fields) == 3 && fields[2] != "MISS" && fields[2] != "STALE" {
+			addErr("type '" + fields[2] + "' must be MISS or STALE")
+		}
+	})
+	return errs
+}
+
+// cacheKeyRegexOptions is the cachekey options whose values are regexes.
+var cacheKeyRegexOptions = map[string]struct{}{
+	"include-match-params": {}, "exclude-match-params": {}, "ua-capture": {},
+}
+
+// cacheKeyCaptureOptions is the cachekey options whose values are a regex or a '/regex/replacement/'.
+var cacheKeyCaptureOptions = map[string]struct{}{
+	"capture-prefix": {}, "capture-prefix-uri": {}, "capture-path": {}, "capture-path-uri": {},
+}
+
+// cacheKeyOptions is the cachekey options without special values.
+var cacheKeyOptions = map[string]struct{}{
+	"exclude-params": {}, "include-params": {}, "sort-params": {}, "remove-all-params": {},
+	"include-headers": {}, "include-cookies": {}, "ua-whitelist": {}, "ua-blacklist": {}, "ua-allowlist": {}, "ua-denylist": {},
+	"static-prefix": {}, "remove-prefix": {}, "remove-path": {}, "separator": {}, "capture-header": {}, "canonical-prefix": {},
+	"config": {},
+}
+
+// cacheKeyKeyTypes is the valid values of the cachekey --key-type option.
+var cacheKeyKeyTypes = map[string]struct{}{"cache_key": {}, "parent_selection_url": {}}
+
+// validateCacheKeyArgs validates cachekey arguments, which are all long options.
+// Unknown options are warnings, because they may be valid in a newer cachekey.
+func validateCacheKeyArgs(args []string) []PluginConfigError {
+	errs := []PluginConfigError{}
+	addErr := func(reason string) { errs = append(errs, PluginConfigError{Reason: reason}) }
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") {
+			addErr("argument '" + arg + "' is not an option")
+			continue
+		}
+		name := strings.TrimPrefix(arg, "--")
+		val := ""
+		if i := strings.Index(name, "="); i >= 0 {
+			name, val = name[:i], name[i+1:]
+		}
+
+		if _, ok := cacheKeyOptions[name]; ok {
+			continue
+		}
+		if _, ok := cacheKeyRegexOptions[name]; ok {
+			if reason := checkRegex(val); reason != "" {
+				addErr("option --" + name + " " + reason)
+			}
+			continue
+		}
+		if _, ok := cacheKeyCaptureOptions[name]; ok {
+			re := val
+			if strings.HasPrefix(val, "/") {
+				parts := strings.Split(val, "/")
+				if len(parts) < 4 || parts[len(parts)-1] != "" {
+					addErr("option --" + name + " value '" + val + "' must be a regex or '/regex/replacement/'")
+					continue
+				}
+				re = strings.Join(parts[1:len(parts)-2], "/")
+			}
+			if reason := checkRegex(re); reason != "" {
+				addErr("option --" + name + " " + reason)
+			}
+			continue
+		}
+
+		switch name {
+		case "uri-type":
+			if val != "remap" && val != "pristine" {
+				addErr("option --uri-type must be 'remap' or 'pristine'")
+			}
+		case "key-type":
+			for _, keyType := range strings.Split(val, ",") {
+				if _, ok := cacheKeyKeyTypes[keyType]; !ok {
+					addErr("option --key-type has unknown type '" + keyType + "'")
+				}
+			}
+		default:
+			errs = append(errs, PluginConfigError{Reason: "unknown option '--" + name + "'", Warning: true})
+		}
+	}
+	return errs
+}
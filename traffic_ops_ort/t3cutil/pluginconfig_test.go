@@ -0,0 +1,240 @@
+package t3cutil
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func makeTestPluginConfigReader(files map[string]string) PluginConfigReader {
+	return func(path string) ([]byte, error) {
+		text, ok := files[path]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(text), nil
+	}
+}
+
+func TestValidatePluginConfigs(t *testing.T) {
+	remap := `# remap.config
+map http://a.example.net/ http://origin.example.net/ @plugin=header_rewrite.so @pparam=hdr_rw_a.config @plugin=regex_remap.so @pparam=regex_remap_a.config
+map http://b.example.net/ http://origin.example.net/ @plugin=header_rewrite.so @pparam=hdr_rw_a.config \
+  @plugin=cachekey.so @pparam=--separator= @pparam=--remove-all-params=true @pparam=--capture-prefix-uri=/^([^?]*)/$1/ @pparam=--bogus
+map http://c.example.net/ http://origin.example.net/ @plugin=url_sig.so @pparam=url_sig_c.config @plugin=uri_signing.so @pparam=uri_signing_missing.config
+`
+	files := map[string]string{
+		"hdr_rw_a.config": `# header rewrite
+cond %{REMAP_PSEUDO_HOOK}
+set-conn-dscp 8 [L]
+set-header "X-Foo" "bar"
+`,
+		"regex_remap_a.config": `^/foo(.*)$ http://origin.example.net/bar$1 @status=301
+^/bar([a-z$ http://origin.example.net/baz
+`,
+		"url_sig_c.config": `error_url = 403
+key0 = abc
+key16 = def
+`,
+	}
+
+	errs := ValidatePluginConfigs("remap.config", remap, makeTestPluginConfigReader(files))
+	expected := []string{
+		"regex_remap_a.config:2: regex_remap.so: invalid regex '^/bar([a-z$': missing closing ]",
+		"remap.config:3: cachekey.so: unknown option '--bogus'",
+		"url_sig_c.config:3: url_sig.so: invalid key name 'key16', must be key0 through key15",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, actual %+v", len(expected), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected error %d '%s', actual '%s'", i, expected[i], err.Error())
+		}
+	}
+
+	readErr := func(path string) ([]byte, error) { return nil, errors.New("permission denied") }
+	if errs := ValidatePluginConfigs("plugin.config", "regex_revalidate.so --config regex_revalidate.config\n", readErr); len(errs) != 1 || errs[0].File != "regex_revalidate.config" {
+		t.Errorf("expected a read error for regex_revalidate.config, actual %+v", errs)
+	}
+}
+
+func TestValidateHeaderRewrite(t *testing.T) {
+	valid := `cond %{REMAP_PSEUDO_HOOK}
+cond %{CLIENT-HEADER:Host} /example/ [NOT,OR]
+set-header X-Foo "bar baz"
+rm-header X-Bar
+set-redirect 302 http://example.net/%{PATH} [QSA]
+set-config proxy.config.http.origin_max_connections 5
+`
+	if errs := validateHeaderRewrite(valid); len(errs) != 0 {
+		t.Errorf("expected no errors, actual %+v", errs)
+	}
+
+	invalid := `cond REMAP_PSEUDO_HOOK
+set-header X-Foo
+set-status 1000
+set-header X-Foo "bar
+bogus-op
+rm-header X-Foo [BOGUS]
+`
+	errs := validateHeaderRewrite(invalid)
+	lines := []int{}
+	for _, err := range errs {
+		lines = append(lines, err.Line)
+	}
+	if len(errs) != 6 {
+		t.Fatalf("expected 6 errors, actual %+v", errs)
+	}
+	for i, line := range lines {
+		if line != i+1 {
+			t.Errorf("expected error %d on line %d, actual %+v", i, i+1, errs[i])
+		}
+		if warning := line == 5; errs[i].Warning != warning {
+			t.Errorf("expected error %d warning %v, actual %+v", i, warning, errs[i])
+		}
+	}
+}
+
+func TestValidateRegexRemap(t *testing.T) {
+	valid := `^/foo/(.*)$ http://origin.example.net/$1 @status=302 @caseless
+^/(?!bar)(.*)$ http://origin.example.net/$1
+`
+	if errs := validateRegexRemap(valid); len(errs) != 0 {
+		t.Errorf("expected no errors, lookaheads to be allowed, actual %+v", errs)
+	}
+
+	invalid := `^/foo(.*$ http://origin.example.net/$1
+^/foo
+^/foo http://origin.example.net/ @status=abc @bogus
+`
+	errs := validateRegexRemap(invalid)
+	if len(errs) != 4 {
+		t.Fatalf("expected 4 errors, actual %+v", errs)
+	}
+	if errs[0].Line != 1 || errs[1].Line != 2 || errs[2].Line != 3 || errs[3].Line != 3 {
+		t.Errorf("expected errors on lines 1, 2, 3, 3, actual %+v", errs)
+	}
+	for i, err := range errs {
+		if warning := i == 3; err.Warning != warning {
+			t.Errorf("expected error %d warning %v, actual %+v", i, warning, err)
+		}
+	}
+}
+
+func TestValidateURLSig(t *testing.T) {
+	valid := `error_url = 302 http://example.net/denied
+sig_anchor = urlsig
+url_type = pristine
+key0 = Ab1cD2
+key15 = eF3gH4
+`
+	if errs := validateURLSig(valid); len(errs) != 0 {
+		t.Errorf("expected no errors, actual %+v", errs)
+	}
+
+	invalid := `error_url = 500
+key0 = abc
+key0 = def
+key1
+bogus = x
+`
+	errs := validateURLSig(invalid)
+	if len(errs) != 4 {
+		t.Fatalf("expected 4 errors, actual %+v", errs)
+	}
+	if errs[0].Line != 1 || errs[1].Line != 3 || errs[2].Line != 4 || errs[3].Line != 5 {
+		t.Errorf("expected errors on lines 1, 3, 4, 5, actual %+v", errs)
+	}
+
+	if errs := validateURLSig("error_url = 403\n"); len(errs) != 1 || errs[0].Reason != "no keys" {
+		t.Errorf("expected a config without keys to be invalid, actual %+v", errs)
+	}
+}
+
+func TestValidateURISigning(t *testing.T) {
+	valid := `{
+  "Kabletown URI Authority": {
+    "renewal_kid": "Second Key",
+    "keys": [
+      {"alg": "HS256", "kid": "First Key", "kty": "oct", "k": "Kh_RkUMj-fzbD37qBnDf_3e_RvQ3RP9PaSmVEpE24AM"},
+      {"alg": "HS256", "kid": "Second Key", "kty": "oct", "k": "fZBpDBNbk2GqhwoB_DGBAsBxqQZVix04rIoLJ7p_RlE"}
+    ]
+  }
+}`
+	if errs := validateURISigning(valid); len(errs) != 0 {
+		t.Errorf("expected no errors, actual %+v", errs)
+	}
+
+	invalid := `{
+  "issuer": {
+    "renewal_kid": "missing",
+    "keys": [{"kid": "a", "kty": "oct"}]
+  }
+}`
+	if errs := validateURISigning(invalid); len(errs) != 2 || errs[0].Line != 2 || errs[1].Line != 2 {
+		t.Errorf("expected 2 errors on line 2, actual %+v", errs)
+	}
+
+	if errs := validateURISigning("{\n\"issuer\": {\n,\n}"); len(errs) != 1 || errs[0].Line != 3 {
+		t.Errorf("expected 1 malformed JSON error on line 3, actual %+v", errs)
+	}
+}
+
+func TestValidateRegexRevalidate(t *testing.T) {
+	valid := `http://example.net/foo/.* 1617000000
+http://example.net/bar/(a|b)\.jpg 1617000000 STALE
+`
+	if errs := validateRegexRevalidate(valid); len(errs) != 0 {
+		t.Errorf("expected no errors, actual %+v", errs)
+	}
+
+	invalid := `http://example.net/foo/.*
+http://example.net/bar/[a 1617000000
+http://example.net/baz/.* yesterday HIT
+`
+	errs := validateRegexRevalidate(invalid)
+	if len(errs) != 4 {
+		t.Fatalf("expected 4 errors, actual %+v", errs)
+	}
+	if errs[0].Line != 1 || errs[1].Line != 2 || errs[2].Line != 3 || errs[3].Line != 3 {
+		t.Errorf("expected errors on lines 1, 2, 3, 3, actual %+v", errs)
+	}
+}
+
+func TestValidateCacheKeyArgs(t *testing.T) {
+	valid := []string{"--separator=", "--remove-all-params=true", "--capture-prefix-uri=/^([^?]*)/$1/", "--include-match-params=^a.*", "--uri-type=pristine", "--key-type=cache_key,parent_selection_url"}
+	if errs := validateCacheKeyArgs(valid); len(errs) != 0 {
+		t.Errorf("expected no errors, actual %+v", errs)
+	}
+
+	invalid := []string{"separator", "--bogus", "--include-match-params=(a", "--capture-path=/a/", "--uri-type=other", "--key-type=cache_key,other"}
+	errs := validateCacheKeyArgs(invalid)
+	if len(errs) != len(invalid) {
+		t.Fatalf("expected %d errors, actual %+v", len(invalid), errs)
+	}
+	for i, err := range errs {
+		if warning := invalid[i] == "--bogus"; err.Warning != warning {
+			t.Errorf("expected error %d warning %v, actual %+v", i, warning, err)
+		}
+	}
+}
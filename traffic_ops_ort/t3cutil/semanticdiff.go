@@ -0,0 +1,304 @@
+package t3cutil
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/kylelemons/godebug/diff"
+	"gopkg.in/yaml.v2"
+)
+
+// SemanticDiff returns the differences between the disk and Traffic Ops text of the config file with the given name,
+// which are significant to the format of the file, as lines prefixed with '-' for disk and '+' for Traffic Ops.
+// Returns nil if the files are semantically the same.
+//
+// Comments, whitespace, and HTML escapes are never significant. Additionally:
+//
+//   records.config   the order of records isn't significant.
+//   remap.config     the order of rules is significant, as is the order of plugins and their parameters, but not of other rule options.
+//   parent.config    the order of lines is significant, but not the order of fields in a line.
+//   *.yaml, *.yml    the order of mapping keys isn't significant.
+//
+// Files of other formats, and YAML which fails to parse, are compared line by line.
+func SemanticDiff(fileName string, disk string, trops string) []string {
+	switch name := filepath.Base(fileName); {
+	case name == "records.config":
+		return recordsDiff(filterLines(disk), filterLines(trops))
+	case name == "remap.config":
+		return remapDiff(filterLines(disk), filterLines(trops))
+	case name == "parent.config":
+		return parentDiff(filterLines(disk), filterLines(trops))
+	case strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml"):
+		if changes, ok := yamlDiff(disk, trops); ok {
+			return changes
+		}
+	}
+	return lineDiff(filterText(disk), filterText(trops))
+}
+
+// SemanticEqual returns whether the disk and Traffic Ops text of the config file with the given name are semantically the same.
+// See SemanticDiff.
+func SemanticEqual(fileName string, disk string, trops string) bool {
+	return len(SemanticDiff(fileName, disk, trops)) == 0
+}
+
+// filterText applies the comparison filters to text, and returns the filtered text.
+func filterText(text string) string {
+	lines := strings.Split(text, "\n")
+	lines = UnencodeFilter(lines)
+	lines = CommentsFilter(lines)
+	return NewLineFilter(strings.Join(lines, "\n"))
+}
+
+// filterLines applies the comparison filters to text, and returns its non-blank lines.
+func filterLines(text string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(filterText(text), "\n") {
+		if line == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// lineDiff returns the changed lines between the filtered disk and Traffic Ops text.
+func lineDiff(disk string, trops string) []string {
+	if disk == trops {
+		return nil
+	}
+	return orderedDiff(diffSplit(disk), diffSplit(trops))
+}
+
+// diffSplit splits text into lines, where empty text has no lines.
+func diffSplit(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// orderedDiff returns the lines deleted from disk and added from trops, where the order of lines is significant.
+func orderedDiff(disk []string, trops []string) []string {
+	changes := []string{}
+	for _, chunk := range diff.DiffChunks(disk, trops) {
+		for _, line := range chunk.Deleted {
+			changes = append(changes, "-"+line)
+		}
+		for _, line := range chunk.Added {
+			changes = append(changes, "+"+line)
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+// unorderedDiff returns the lines deleted from disk and added from trops, where the order of lines isn't significant.
+// Duplicate lines are significant.
+func unorderedDiff(disk []string, trops []string) []string {
+	counts := map[string]int{}
+	for _, line := range disk {
+		counts[line]--
+	}
+	for _, line := range trops {
+		counts[line]++
+	}
+
+	lines := []string{}
+	for line := range counts {
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+
+	changes := []string{}
+	for _, line := range lines {
+		for i := counts[line]; i < 0; i++ {
+			changes = append(changes, "-"+line)
+		}
+		for i := 0; i < counts[line]; i++ {
+			changes = append(changes, "+"+line)
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+// recordsDiff returns the changed records between the filtered disk and Traffic Ops lines of a records.config.
+// Records are keyed on their name. If a name is duplicated, the last record is used, as ATS does.
+func recordsDiff(disk []string, trops []string) []string {
+	parse := func(lines []string) (map[string]string, []string) {
+		records := map[string]string{}
+		others := []string{}
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) < 4 || (fields[0] != "CONFIG" && fields[0] != "LOCAL") {
+				others = append(others, line)
+				continue
+			}
+			records[fields[1]] = strings.Join(fields, " ")
+		}
+		return records, others
+	}
+	diskRecords, diskOthers := parse(disk)
+	tropsRecords, tropsOthers := parse(trops)
+
+	names := map[string]struct{}{}
+	for name := range diskRecords {
+		names[name] = struct{}{}
+	}
+	for name := range tropsRecords {
+		names[name] = struct{}{}
+	}
+	sortedNames := []string{}
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+
+	changes := []string{}
+	for _, name := range sortedNames {
+		diskRecord, onDisk := diskRecords[name]
+		tropsRecord, inTrops := tropsRecords[name]
+		if diskRecord == tropsRecord {
+			continue
+		}
+		if onDisk {
+			changes = append(changes, "-"+diskRecord)
+		}
+		if inTrops {
+			changes = append(changes, "+"+tropsRecord)
+		}
+	}
+	changes = append(changes, unorderedDiff(diskOthers, tropsOthers)...)
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+// remapDiff returns the changed rules between the filtered disk and Traffic Ops lines of a remap.config.
+// Rules are compared in order, because ATS uses the first matching rule.
+func remapDiff(disk []string, trops []string) []string {
+	return orderedDiff(remapRules(disk), remapRules(trops))
+}
+
+// remapRules returns the canonical text of each rule in the given remap.config lines.
+//
+// Lines ending in a backslash are joined with the next line.
+// Plugins keep their order, each followed by its parameters in order, after all other options, which are sorted.
+// Directives, e.g. .definefilter, are kept as-is.
+func remapRules(lines []string) []string {
+	joined := []string{}
+	continued := ""
+	for _, line := range lines {
+		if strings.HasSuffix(line, `\`) {
+			continued += strings.TrimSuffix(line, `\`) + " "
+			continue
+		}
+		joined = append(joined, continued+line)
+		continued = ""
+	}
+	if continued != "" {
+		joined = append(joined, continued)
+	}
+
+	rules := []string{}
+	for _, line := range joined {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || strings.HasPrefix(fields[0], ".") {
+			rules = append(rules, strings.Join(fields, " "))
+			continue
+		}
+
+		options := []string{}
+		plugins := []string{}
+		for _, field := range fields[3:] {
+			switch {
+			case strings.HasPrefix(field, "@plugin="):
+				plugins = append(plugins, field)
+			case strings.HasPrefix(field, "@pparam=") && len(plugins) > 0:
+				plugins[len(plugins)-1] += " " + field
+			default:
+				options = append(options, field)
+			}
+		}
+		sort.Strings(options)
+
+		rule := append(fields[:3:3], options...)
+		rule = append(rule, plugins...)
+		rules = append(rules, strings.Join(rule, " "))
+	}
+	return rules
+}
+
+// parentDiff returns the changed lines between the filtered disk and Traffic Ops lines of a parent.config.
+// Lines are compared in order, because ATS uses the first matching line, but the order of the fields in a line isn't significant.
+func parentDiff(disk []string, trops []string) []string {
+	canonical := func(lines []string) []string {
+		canonicalLines := []string{}
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			sort.Strings(fields)
+			canonicalLines = append(canonicalLines, strings.Join(fields, " "))
+		}
+		return canonicalLines
+	}
+	return orderedDiff(canonical(disk), canonical(trops))
+}
+
+// yamlDiff returns the changes between the disk and Traffic Ops text of a YAML file, where the order of mapping keys isn't significant.
+// Returns false if either fails to parse, in which case the caller should compare them some other way.
+func yamlDiff(disk string, trops string) ([]string, bool) {
+	diskObj := interface{}(nil)
+	if err := yaml.Unmarshal([]byte(strings.ReplaceAll(disk, "\r\n", "\n")), &diskObj); err != nil {
+		return nil, false
+	}
+	tropsObj := interface{}(nil)
+	if err := yaml.Unmarshal([]byte(strings.ReplaceAll(trops, "\r\n", "\n")), &tropsObj); err != nil {
+		return nil, false
+	}
+	if reflect.DeepEqual(diskObj, tropsObj) {
+		return nil, true
+	}
+
+	// mappings are marshalled with sorted keys, so differences are only real changes.
+	diskYAML, err := yaml.Marshal(diskObj)
+	if err != nil {
+		return nil, false
+	}
+	tropsYAML, err := yaml.Marshal(tropsObj)
+	if err != nil {
+		return nil, false
+	}
+	changes := orderedDiff(diffSplit(strings.TrimSpace(string(diskYAML))), diffSplit(strings.TrimSpace(string(tropsYAML))))
+	if len(changes) == 0 {
+		// DeepEqual found a difference the canonical text doesn't show, e.g. between an int and a string.
+		changes = []string{"-" + strings.TrimSpace(string(diskYAML)), "+" + strings.TrimSpace(string(tropsYAML))}
+	}
+	return changes, true
+}
@@ -0,0 +1,121 @@
+package t3cutil
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSemanticDiffRecords(t *testing.T) {
+	disk := "# header\nCONFIG proxy.config.a INT 1\nCONFIG proxy.config.b STRING foo bar\n\nLOCAL proxy.local.c INT 2\n"
+	trops := "# other header\nLOCAL proxy.local.c INT 2\nCONFIG   proxy.config.b STRING foo   bar\nCONFIG proxy.config.a INT 1\n"
+	if changes := SemanticDiff("/opt/trafficserver/etc/trafficserver/records.config", disk, trops); changes != nil {
+		t.Errorf("expected reordered records to be the same, actual changes %v", changes)
+	}
+
+	trops = "CONFIG proxy.config.a INT 2\nCONFIG proxy.config.b STRING foo bar\nCONFIG proxy.config.d INT 3\n"
+	expected := []string{
+		"-CONFIG proxy.config.a INT 1",
+		"+CONFIG proxy.config.a INT 2",
+		"+CONFIG proxy.config.d INT 3",
+		"-LOCAL proxy.local.c INT 2",
+	}
+	if changes := SemanticDiff("records.config", disk, trops); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected changes %v, actual %v", expected, changes)
+	}
+}
+
+func TestSemanticDiffRemap(t *testing.T) {
+	disk := "map http://a/ http://b/ @action=allow @src_ip=10.0.0.1 @plugin=a.so @pparam=1 @pparam=2 @plugin=b.so\n" +
+		"map http://c/ \\\n  http://d/\n"
+	trops := "map http://a/ http://b/ @src_ip=10.0.0.1 @plugin=a.so @pparam=1 @pparam=2 @action=allow @plugin=b.so\n" +
+		"map http://c/ http://d/\n"
+	if changes := SemanticDiff("remap.config", disk, trops); changes != nil {
+		t.Errorf("expected reordered non-plugin options and continued lines to be the same, actual changes %v", changes)
+	}
+
+	// plugin parameter order is significant
+	trops = "map http://a/ http://b/ @action=allow @src_ip=10.0.0.1 @plugin=a.so @pparam=2 @pparam=1 @plugin=b.so\nmap http://c/ http://d/\n"
+	if changes := SemanticDiff("remap.config", disk, trops); len(changes) != 2 {
+		t.Errorf("expected reordered plugin parameters to be a change, actual changes %v", changes)
+	}
+
+	// plugin order is significant
+	trops = "map http://a/ http://b/ @action=allow @src_ip=10.0.0.1 @plugin=b.so @plugin=a.so @pparam=1 @pparam=2\nmap http://c/ http://d/\n"
+	if changes := SemanticDiff("remap.config", disk, trops); len(changes) != 2 {
+		t.Errorf("expected reordered plugins to be a change, actual changes %v", changes)
+	}
+
+	// rule order is significant
+	trops = "map http://c/ http://d/\nmap http://a/ http://b/ @action=allow @src_ip=10.0.0.1 @plugin=a.so @pparam=1 @pparam=2 @plugin=b.so\n"
+	if changes := SemanticDiff("remap.config", disk, trops); changes == nil {
+		t.Errorf("expected reordered rules to be a change, actual none")
+	}
+}
+
+func TestSemanticDiffParent(t *testing.T) {
+	disk := "dest_domain=a port=80 parent=\"p1:80|0.999;p2:80|0.999\" round_robin=consistent_hash\ndest_domain=. parent=\"p3:80|0.999\"\n"
+	trops := "round_robin=consistent_hash dest_domain=a parent=\"p1:80|0.999;p2:80|0.999\" port=80\ndest_domain=. parent=\"p3:80|0.999\"\n"
+	if changes := SemanticDiff("parent.config", disk, trops); changes != nil {
+		t.Errorf("expected reordered fields to be the same, actual changes %v", changes)
+	}
+
+	// line order is significant, because ATS uses the first matching line
+	trops = "dest_domain=. parent=\"p3:80|0.999\"\ndest_domain=a port=80 parent=\"p1:80|0.999;p2:80|0.999\" round_robin=consistent_hash\n"
+	if changes := SemanticDiff("parent.config", disk, trops); len(changes) == 0 {
+		t.Errorf("expected swapped lines to be a change, actual none")
+	}
+
+	// parent order is significant
+	trops = "dest_domain=a port=80 parent=\"p2:80|0.999;p1:80|0.999\" round_robin=consistent_hash\ndest_domain=. parent=\"p3:80|0.999\"\n"
+	if changes := SemanticDiff("parent.config", disk, trops); len(changes) != 2 {
+		t.Errorf("expected reordered parents to be a change, actual changes %v", changes)
+	}
+}
+
+func TestSemanticDiffYAML(t *testing.T) {
+	disk := "# comment\nip_allow:\n  - apply: in\n    ip_addrs: 127.0.0.1\n    action: allow\n    methods: ALL\n"
+	trops := "ip_allow:\n- action: allow\n  methods: ALL\n  apply: in\n  ip_addrs: 127.0.0.1\n"
+	if changes := SemanticDiff("ip_allow.yaml", disk, trops); changes != nil {
+		t.Errorf("expected reordered keys to be the same, actual changes %v", changes)
+	}
+
+	trops = "ip_allow:\n- action: deny\n  methods: ALL\n  apply: in\n  ip_addrs: 127.0.0.1\n"
+	expected := []string{"-- action: allow", "+- action: deny"}
+	if changes := SemanticDiff("ip_allow.yaml", disk, trops); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected changes %v, actual %v", expected, changes)
+	}
+
+	// invalid YAML is compared line by line
+	if changes := SemanticDiff("logging.yaml", "a: [", "a: ["); changes != nil {
+		t.Errorf("expected identical invalid YAML to be the same, actual changes %v", changes)
+	}
+}
+
+func TestSemanticDiffLines(t *testing.T) {
+	if changes := SemanticDiff("plugin.config", "#comment\na.so  1\r\nb.so\n", "a.so 1\nb.so"); changes != nil {
+		t.Errorf("expected files differing only in comments and whitespace to be the same, actual changes %v", changes)
+	}
+	expected := []string{"+b.so"}
+	if changes := SemanticDiff("plugin.config", "a.so 1\n", "b.so\na.so 1\n"); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected line changes, actual %v", changes)
+	}
+}
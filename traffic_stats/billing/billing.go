@@ -0,0 +1,162 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+// Package billing computes the 95th percentile billing summaries of delivery services, tenants, and CDNs.
+package billing
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+)
+
+// BucketInterval is the interval bandwidth is averaged over, before its percentile is taken.
+const BucketInterval = 5 * time.Minute
+
+// Percentile is the percentile of the bucketed bandwidth which is billed.
+const Percentile = 95
+
+// AllDeliveryServices is the delivery service name of tenant and CDN summaries.
+const AllDeliveryServices = "all"
+
+const (
+	kilobitsPerGigabit = 1000000.0
+	bytesPerKilobit    = 1000.0 / 8.0
+)
+
+// Series is the bandwidth of a delivery service on a CDN over a period.
+type Series struct {
+	CDN             string
+	DeliveryService string
+	// Tenant is the tenant of the delivery service, or empty if it's unknown.
+	Tenant string
+	// Buckets is the average bandwidth in kilobits per second over each BucketInterval, by the start of the interval.
+	Buckets map[time.Time]float64
+	// Kilobits is the amount of data served over the period.
+	Kilobits float64
+}
+
+// Summary is the billing summary of a delivery service, a tenant, or a CDN over a period.
+type Summary struct {
+	CDN string
+	// DeliveryService is AllDeliveryServices for tenant and CDN summaries.
+	DeliveryService string
+	// Tenant is empty for CDN summaries.
+	Tenant   string
+	P95Kbps  float64
+	PeakKbps float64
+	Kilobits float64
+}
+
+// Report returns the billing report of the summary, for the period from start up to end, computed at summaryTime.
+func (s Summary) Report(start, end, summaryTime time.Time) tc.BillingReport {
+	br := tc.BillingReport{
+		CDNName:         s.CDN,
+		DeliveryService: s.DeliveryService,
+		StartDate:       start,
+		EndDate:         end,
+		P95Gbps:         util.FloatPtr(s.P95Kbps / kilobitsPerGigabit),
+		PeakGbps:        util.FloatPtr(s.PeakKbps / kilobitsPerGigabit),
+		TotalBytes:      util.FloatPtr(math.Round(s.Kilobits * bytesPerKilobit)),
+		SummaryTime:     summaryTime,
+	}
+	if s.Tenant != "" {
+		br.TenantName = util.StrPtr(s.Tenant)
+	}
+	return br
+}
+
+// Summarize returns the summaries of each series, of all the series of each tenant on each CDN, and of all the series of each CDN.
+// The bandwidth of a tenant or CDN is the sum of the bandwidth of its series in each bucket, so its percentile is that of its total traffic,
+// not the sum of the percentiles of its delivery services.
+// Series whose tenant is unknown are only summarized as part of their CDN, so their traffic isn't reported to the wrong tenant.
+// Summaries are sorted by CDN, tenant, then delivery service, with the tenant and CDN summaries first.
+func Summarize(series []Series) []Summary {
+	type aggregate struct {
+		buckets  map[time.Time]float64
+		kilobits float64
+	}
+	aggregates := map[Summary]*aggregate{}
+	add := func(key Summary, s Series) {
+		agg, ok := aggregates[key]
+		if !ok {
+			agg = &aggregate{buckets: map[time.Time]float64{}}
+			aggregates[key] = agg
+		}
+		for t, kbps := range s.Buckets {
+			agg.buckets[t] += kbps
+		}
+		agg.kilobits += s.Kilobits
+	}
+
+	for _, s := range series {
+		add(Summary{CDN: s.CDN, DeliveryService: AllDeliveryServices}, s)
+		if s.Tenant == "" {
+			continue
+		}
+		add(Summary{CDN: s.CDN, DeliveryService: AllDeliveryServices, Tenant: s.Tenant}, s)
+		add(Summary{CDN: s.CDN, DeliveryService: s.DeliveryService, Tenant: s.Tenant}, s)
+	}
+
+	summaries := make([]Summary, 0, len(aggregates))
+	for key, agg := range aggregates {
+		values := make([]float64, 0, len(agg.buckets))
+		for _, kbps := range agg.buckets {
+			values = append(values, kbps)
+		}
+		sort.Float64s(values)
+		summary := key
+		summary.P95Kbps = percentile(values, Percentile)
+		if len(values) > 0 {
+			summary.PeakKbps = values[len(values)-1]
+		}
+		summary.Kilobits = agg.kilobits
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.CDN != b.CDN {
+			return a.CDN < b.CDN
+		}
+		if a.Tenant != b.Tenant {
+			return a.Tenant < b.Tenant
+		}
+		if (a.DeliveryService == AllDeliveryServices) != (b.DeliveryService == AllDeliveryServices) {
+			return a.DeliveryService == AllDeliveryServices
+		}
+		return a.DeliveryService < b.DeliveryService
+	})
+	return summaries
+}
+
+// percentile returns the p-th percentile of the sorted values by the nearest-rank method, which is how 95th percentile billing
+// discards the highest 5% of the buckets and bills the highest remaining one. It returns 0 if there are no values.
+func percentile(sorted []float64, p int) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100 // ceil(p/100 * len) without rounding error
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,94 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package billing
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	testCases := []struct {
+		n        int
+		expected float64
+	}{
+		{n: 0, expected: 0},
+		{n: 1, expected: 1},
+		{n: 19, expected: 19},
+		{n: 20, expected: 19},
+		{n: 100, expected: 95},
+		{n: 8640, expected: 8208},
+	}
+	for _, tc := range testCases {
+		values := []float64{}
+		for i := 1; i <= tc.n; i++ {
+			values = append(values, float64(i))
+		}
+		if actual := percentile(values, Percentile); actual != tc.expected {
+			t.Errorf("95th percentile of 1 to %v expected %v, actual %v", tc.n, tc.expected, actual)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	start := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	ds1 := Series{CDN: "cdn1", DeliveryService: "ds1", Tenant: "tenant1", Buckets: map[time.Time]float64{}, Kilobits: 100}
+	ds2 := Series{CDN: "cdn1", DeliveryService: "ds2", Tenant: "tenant1", Buckets: map[time.Time]float64{}, Kilobits: 200}
+	unknown := Series{CDN: "cdn1", DeliveryService: "deleted", Buckets: map[time.Time]float64{}, Kilobits: 400}
+	for i := 0; i < 20; i++ {
+		bucket := start.Add(time.Duration(i) * BucketInterval)
+		ds1.Buckets[bucket] = float64(i + 1)
+		ds2.Buckets[bucket] = 10
+		unknown.Buckets[bucket] = 5
+	}
+
+	expected := []Summary{
+		{CDN: "cdn1", DeliveryService: AllDeliveryServices, P95Kbps: 34, PeakKbps: 35, Kilobits: 700},
+		{CDN: "cdn1", DeliveryService: AllDeliveryServices, Tenant: "tenant1", P95Kbps: 29, PeakKbps: 30, Kilobits: 300},
+		{CDN: "cdn1", DeliveryService: "ds1", Tenant: "tenant1", P95Kbps: 19, PeakKbps: 20, Kilobits: 100},
+		{CDN: "cdn1", DeliveryService: "ds2", Tenant: "tenant1", P95Kbps: 10, PeakKbps: 10, Kilobits: 200},
+	}
+	if actual := Summarize([]Series{ds2, unknown, ds1}); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected summaries %+v, actual %+v", expected, actual)
+	}
+}
+
+func TestReport(t *testing.T) {
+	start := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)
+	summaryTime := time.Date(2021, 4, 1, 0, 5, 0, 0, time.UTC)
+
+	report := Summary{CDN: "cdn1", DeliveryService: AllDeliveryServices, P95Kbps: 2500000, PeakKbps: 4000000, Kilobits: 8000}.Report(start, end, summaryTime)
+	if report.TenantName != nil {
+		t.Errorf("expected CDN report to have no tenant, actual %v", *report.TenantName)
+	}
+	if *report.P95Gbps != 2.5 || *report.PeakGbps != 4 || *report.TotalBytes != 1000000 {
+		t.Errorf("expected 2.5 p95 Gbps, 4 peak Gbps and 1000000 bytes, actual %v, %v and %v", *report.P95Gbps, *report.PeakGbps, *report.TotalBytes)
+	}
+	if !report.StartDate.Equal(start) || !report.EndDate.Equal(end) || !report.SummaryTime.Equal(summaryTime) {
+		t.Errorf("expected period %v - %v summarized at %v, actual %v - %v summarized at %v", start, end, summaryTime, report.StartDate, report.EndDate, report.SummaryTime)
+	}
+
+	report = Summary{CDN: "cdn1", DeliveryService: "ds1", Tenant: "tenant1"}.Report(start, end, summaryTime)
+	if report.TenantName == nil || *report.TenantName != "tenant1" {
+		t.Errorf("expected delivery service report to have tenant 'tenant1', actual %v", report.TenantName)
+	}
+}
@@ -76,7 +76,8 @@ func createDeliveryServiceStats(client influx.Client, replication int) {
 	db := deliveryService
 	createDatabase(client, db)
 	createRetentionPolicy(client, db, "daily", "26h", replication, true)
-	createRetentionPolicy(client, db, "monthly", "30d", replication, false)
+	// Billing stats are summarized from monthly after each calendar month ends, so it must keep the longest month and then some.
+	createRetentionPolicy(client, db, "monthly", "35d", replication, false)
 	createRetentionPolicy(client, db, "indefinite", "INF", replication, false)
 	createContinuousQuery(client, "tps_2xx_ds_1min", `CREATE CONTINUOUS QUERY tps_2xx_ds_1min ON deliveryservice_stats RESAMPLE FOR 2m BEGIN SELECT mean(value) AS "value" INTO "deliveryservice_stats"."monthly"."tps_2xx.ds.1min" FROM "deliveryservice_stats"."daily".tps_2xx WHERE cachegroup = 'total' GROUP BY time(1m), * END`)
 	createContinuousQuery(client, "tps_3xx_ds_1min", `CREATE CONTINUOUS QUERY tps_3xx_ds_1min ON deliveryservice_stats RESAMPLE FOR 2m BEGIN SELECT mean(value) AS "value" INTO "deliveryservice_stats"."monthly"."tps_3xx.ds.1min" FROM "deliveryservice_stats"."daily".tps_3xx WHERE cachegroup = 'total' GROUP BY time(1m), * END`)
@@ -0,0 +1,120 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sync"
+
+	log "github.com/cihub/seelog"
+	influx "github.com/influxdata/influxdb/client/v2"
+)
+
+// InfluxDB is an InfluxDB 1.x sink, which writes to one of its servers at random.
+type InfluxDB struct {
+	URLs     []string
+	User     string
+	Password string
+	m        sync.Mutex
+	clients  map[string]influx.Client // the last HTTP client of each URL, to close when it's replaced
+}
+
+// NewInfluxDB returns an InfluxDB 1.x sink of the given servers, which may be HTTP or UDP URLs.
+func NewInfluxDB(urls []string, user string, password string) *InfluxDB {
+	return &InfluxDB{URLs: urls, User: user, Password: password, clients: map[string]influx.Client{}}
+}
+
+// Name returns the name of the sink.
+func (i *InfluxDB) Name() string {
+	return "InfluxDB"
+}
+
+// Connect returns a client of a random server which can be connected to.
+func (i *InfluxDB) Connect() (influx.Client, error) {
+	i.m.Lock()
+	defer i.m.Unlock()
+	hosts := append([]string(nil), i.URLs...)
+	for len(hosts) > 0 {
+		n := rand.Intn(len(hosts))
+		host := hosts[n]
+		hosts = append(hosts[:n], hosts[n+1:]...)
+		parsedURL, err := url.Parse(host)
+		if err != nil {
+			log.Errorf("An error occurred parsing InfluxDB URL %v: %v", host, err)
+			continue
+		}
+		if parsedURL.Scheme == "udp" {
+			conf := influx.UDPConfig{
+				Addr: parsedURL.Host,
+			}
+			con, err := influx.NewUDPClient(conf)
+			if err != nil {
+				log.Error(fmt.Errorf("An error occurred creating udp client. %v\n", err))
+				continue
+			}
+			return con, nil
+		}
+		//if not udp assume HTTP client
+		conf := influx.HTTPConfig{
+			Addr:     parsedURL.String(),
+			Username: i.User,
+			Password: i.Password,
+		}
+		con, err := influx.NewHTTPClient(conf)
+		if err != nil {
+			log.Error(fmt.Errorf("An error occurred creating HTTP client.  %v\n", err))
+			continue
+		}
+		//Close old connections explicitly
+		if old, ok := i.clients[host]; ok {
+			old.Close()
+		}
+		i.clients[host] = con
+		_, _, err = con.Ping(10)
+		if err != nil {
+			log.Warn(err)
+			continue
+		}
+		return con, nil
+	}
+	return nil, errors.New("Could not connect to any of the InfluxDb servers defined in the influxUrls config.")
+}
+
+// Open returns a client of a random server which can be connected to, to write to.
+func (i *InfluxDB) Open() (Writer, error) {
+	client, err := i.Connect()
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// Close closes the connections to the servers.
+func (i *InfluxDB) Close() {
+	i.m.Lock()
+	defer i.m.Unlock()
+	for host, client := range i.clients {
+		client.Close()
+		delete(i.clients, host)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package sink
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+
+	influx "github.com/influxdata/influxdb/client/v2"
+)
+
+// InfluxDB2Config is the config of an InfluxDB 2.x sink.
+type InfluxDB2Config struct {
+	URL   string `json:"url"`
+	Org   string `json:"org"`
+	Token string `json:"token"`
+	// Bucket is the bucket to write to. If it's empty, stats are written to the bucket named database/retention-policy,
+	// the name InfluxDB 2.x gives buckets upgraded from InfluxDB 1.x databases, or just the database if they have no retention policy.
+	Bucket string `json:"bucket"`
+}
+
+// InfluxDB2 is an InfluxDB 2.x sink, which writes with the HTTP write API.
+type InfluxDB2 struct {
+	Config InfluxDB2Config
+	client *http.Client
+}
+
+// NewInfluxDB2 returns an InfluxDB 2.x sink with the given config.
+func NewInfluxDB2(config InfluxDB2Config) *InfluxDB2 {
+	return &InfluxDB2{Config: config, client: &http.Client{Timeout: DefaultTimeout}}
+}
+
+// Open returns the sink, which writes with its own HTTP client.
+func (i *InfluxDB2) Open() (Writer, error) {
+	return i, nil
+}
+
+// Name returns the name of the sink.
+func (i *InfluxDB2) Name() string {
+	return "InfluxDB 2.x " + i.Config.URL
+}
+
+// bucket returns the bucket to write the given points to.
+func (i *InfluxDB2) bucket(bps influx.BatchPoints) string {
+	if i.Config.Bucket != "" {
+		return i.Config.Bucket
+	}
+	if bps.RetentionPolicy() == "" {
+		return bps.Database()
+	}
+	return bps.Database() + "/" + bps.RetentionPolicy()
+}
+
+// Write writes the given points, in line protocol.
+func (i *InfluxDB2) Write(bps influx.BatchPoints) error {
+	body := bytes.Buffer{}
+	for _, pt := range bps.Points() {
+		body.WriteString(pt.PrecisionString(bps.Precision()))
+		body.WriteByte('\n')
+	}
+
+	// InfluxDB 2.x names the nanosecond and microsecond precisions differently.
+	precision := bps.Precision()
+	switch precision {
+	case "", "n":
+		precision = "ns"
+	case "u":
+		precision = "us"
+	}
+	params := url.Values{}
+	params.Set("org", i.Config.Org)
+	params.Set("bucket", i.bucket(bps))
+	params.Set("precision", precision)
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(i.Config.URL, "/")+"/api/v2/write?"+params.Encode(), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+i.Config.Token)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	return send(i.client, req)
+}
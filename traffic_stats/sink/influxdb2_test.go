@@ -0,0 +1,76 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package sink
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestInfluxDB2(t *testing.T) {
+	var req *http.Request
+	body := ""
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bts, _ := ioutil.ReadAll(r.Body)
+		req, body = r, string(bts)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	i := NewInfluxDB2(InfluxDB2Config{URL: srv.URL + "/", Org: "my-org", Token: "my-token"})
+	if err := i.Write(testBatch(t, 2)); err != nil {
+		t.Fatalf("writing: %v", err)
+	}
+	if req.Method != http.MethodPost || req.URL.Path != "/api/v2/write" || req.Header.Get("Authorization") != "Token my-token" {
+		t.Errorf("expected an authorized request to the write API, actual %v %v %v", req.Method, req.URL.Path, req.Header.Get("Authorization"))
+	}
+	if params := req.URL.Query(); params.Get("org") != "my-org" || params.Get("bucket") != "cache_stats/daily" || params.Get("precision") != "ms" {
+		t.Errorf("expected the org, the database and retention policy bucket, and the precision, actual %v", params)
+	}
+	expected := "bandwidth,cdn=cdn1,hostname=edge-1 value=0 1577836800000\nbandwidth,cdn=cdn1,hostname=edge-1 value=1 1577836800001\n"
+	if body != expected {
+		t.Errorf("expected line protocol %q, actual %q", expected, body)
+	}
+
+	i.Config.Bucket = "my-bucket"
+	for _, status = range []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity} {
+		if err := i.Write(testBatch(t, 1)); err == nil || !strings.Contains(err.Error(), strconv.Itoa(status)) {
+			t.Errorf("expected a %v response to error, actual %v", status, err)
+		} else if _, ok := err.(*RejectedError); !ok {
+			t.Errorf("expected a %v response to be rejected, actual %T", status, err)
+		}
+	}
+	if bucket := req.URL.Query().Get("bucket"); bucket != "my-bucket" {
+		t.Errorf("expected the configured bucket, actual %v", bucket)
+	}
+
+	for _, status = range []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		if err := i.Write(testBatch(t, 1)); err == nil {
+			t.Errorf("expected a %v response to error", status)
+		} else if _, ok := err.(*RejectedError); ok {
+			t.Errorf("expected a %v response to be retryable, actual rejected", status)
+		}
+	}
+}
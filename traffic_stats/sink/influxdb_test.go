@@ -0,0 +1,66 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package sink
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInfluxDB(t *testing.T) {
+	writes := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ping":
+			w.WriteHeader(http.StatusNoContent)
+		case "/write":
+			body, _ := ioutil.ReadAll(r.Body)
+			writes = append(writes, r.URL.Query().Get("db")+" "+r.URL.Query().Get("rp")+" "+r.URL.Query().Get("precision")+" "+string(body))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	i := NewInfluxDB([]string{srv.URL}, "user", "pass")
+	defer i.Close()
+	w, err := i.Open()
+	if err != nil {
+		t.Fatalf("opening: %v", err)
+	}
+	if err := w.Write(testBatch(t, 1)); err != nil {
+		t.Fatalf("writing: %v", err)
+	}
+	if len(writes) != 1 || !strings.HasPrefix(writes[0], "cache_stats daily ms bandwidth,cdn=cdn1,hostname=edge-1 value=0 1577836800000") {
+		t.Errorf("expected the points to be written to the database and retention policy, actual %v", writes)
+	}
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	if _, err := NewInfluxDB([]string{down.URL}, "", "").Open(); err == nil {
+		t.Error("expected opening a server which can't be pinged to error")
+	}
+}
@@ -0,0 +1,223 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package sink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/golang/snappy"
+	influx "github.com/influxdata/influxdb/client/v2"
+)
+
+// PrometheusConfig is the config of a Prometheus remote write sink.
+type PrometheusConfig struct {
+	URL      string `json:"url"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+// Prometheus is a Prometheus remote write sink, which writes to any Prometheus-compatible storage accepting remote writes.
+// Each point field is a sample of the metric named database_measurement, or database_measurement_field for fields other than "value",
+// with the point's tags as labels. Non-numeric fields are skipped.
+type Prometheus struct {
+	Config PrometheusConfig
+	client *http.Client
+}
+
+// NewPrometheus returns a Prometheus remote write sink with the given config.
+func NewPrometheus(config PrometheusConfig) *Prometheus {
+	return &Prometheus{Config: config, client: &http.Client{Timeout: DefaultTimeout}}
+}
+
+// Open returns the sink, which writes with its own HTTP client.
+func (p *Prometheus) Open() (Writer, error) {
+	return p, nil
+}
+
+// Name returns the name of the sink.
+func (p *Prometheus) Name() string {
+	return "Prometheus remote write " + p.Config.URL
+}
+
+// Write writes the given points, as a snappy compressed protobuf remote write request.
+func (p *Prometheus) Write(bps influx.BatchPoints) error {
+	req, err := http.NewRequest(http.MethodPost, p.Config.URL, bytes.NewReader(snappy.Encode(nil, marshalWriteRequest(timeSeries(bps)))))
+	if err != nil {
+		return err
+	}
+	if p.Config.User != "" {
+		req.SetBasicAuth(p.Config.User, p.Config.Password)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	return send(p.client, req)
+}
+
+type label struct {
+	name  string
+	value string
+}
+
+type sample struct {
+	value     float64
+	timestamp int64 // milliseconds
+}
+
+type series struct {
+	labels  []label // sorted by name
+	samples []sample
+}
+
+// timeSeries returns the series of the given points, sorted by their labels, with their samples sorted by time.
+func timeSeries(bps influx.BatchPoints) []*series {
+	byLabels := map[string]*series{}
+	for _, pt := range bps.Points() {
+		fields, err := pt.Fields()
+		if err != nil {
+			continue
+		}
+		tagLabels := []label{}
+		for name, value := range pt.Tags() {
+			if value != "" {
+				tagLabels = append(tagLabels, label{name: metricName(name, false), value: value})
+			}
+		}
+		for field, val := range fields {
+			value, ok := floatValue(val)
+			if !ok {
+				continue
+			}
+			name := bps.Database() + "_" + pt.Name()
+			if field != "value" {
+				name += "_" + field
+			}
+			labels := append([]label{{name: "__name__", value: metricName(name, true)}}, tagLabels...)
+			sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+
+			key := strings.Builder{}
+			for _, l := range labels {
+				key.WriteString(l.name + "\xff" + l.value + "\xff")
+			}
+			s, ok := byLabels[key.String()]
+			if !ok {
+				s = &series{labels: labels}
+				byLabels[key.String()] = s
+			}
+			s.samples = append(s.samples, sample{value: value, timestamp: pt.UnixNano() / 1e6})
+		}
+	}
+
+	keys := make([]string, 0, len(byLabels))
+	for key := range byLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	all := make([]*series, 0, len(keys))
+	for _, key := range keys {
+		s := byLabels[key]
+		sort.SliceStable(s.samples, func(i, j int) bool { return s.samples[i].timestamp < s.samples[j].timestamp })
+		all = append(all, s)
+	}
+	return all
+}
+
+// floatValue returns the given field value as a float, and false if it isn't numeric.
+func floatValue(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// metricName returns the given name with the characters Prometheus doesn't allow in metric names, or label names if metric is false, replaced with underscores.
+func metricName(name string, metric bool) string {
+	b := []byte(name)
+	for i, c := range b {
+		valid := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') || (metric && c == ':')
+		if !valid {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// marshalWriteRequest returns the given series as a Prometheus remote write WriteRequest protobuf message.
+func marshalWriteRequest(all []*series) []byte {
+	req := []byte{}
+	for _, s := range all {
+		ts := []byte{}
+		for _, l := range s.labels {
+			lbl := appendBytes(nil, 1, []byte(l.name))
+			lbl = appendBytes(lbl, 2, []byte(l.value))
+			ts = appendBytes(ts, 1, lbl)
+		}
+		for _, smpl := range s.samples {
+			smp := appendTag(nil, 1, wireFixed64)
+			smp = appendFixed64(smp, math.Float64bits(smpl.value))
+			smp = appendTag(smp, 2, wireVarint)
+			smp = appendVarint(smp, uint64(smpl.timestamp))
+			ts = appendBytes(ts, 2, smp)
+		}
+		req = appendBytes(req, 1, ts)
+	}
+	return req
+}
+
+// The protobuf wire types used by remote write requests.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func appendTag(b []byte, field int, wireType int) []byte {
+	return appendVarint(b, uint64(field<<3|wireType))
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	buf := [binary.MaxVarintLen64]byte{}
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendFixed64(b []byte, v uint64) []byte {
+	buf := [8]byte{}
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendBytes(b []byte, field int, data []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
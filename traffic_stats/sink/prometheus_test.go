@@ -0,0 +1,132 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package sink
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	influx "github.com/influxdata/influxdb/client/v2"
+)
+
+// protoFields decodes the fields of a protobuf message, as the bytes of length-delimited fields and the values of numeric fields.
+func protoFields(t *testing.T, msg []byte) map[int][]interface{} {
+	fields := map[int][]interface{}{}
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		msg = msg[n:]
+		field := int(tag >> 3)
+		switch tag & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(msg)
+			fields[field] = append(fields[field], int64(v))
+			msg = msg[n:]
+		case wireFixed64:
+			fields[field] = append(fields[field], math.Float64frombits(binary.LittleEndian.Uint64(msg)))
+			msg = msg[8:]
+		case wireBytes:
+			l, n := binary.Uvarint(msg)
+			fields[field] = append(fields[field], msg[n:n+int(l)])
+			msg = msg[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %v", tag&7)
+		}
+	}
+	return fields
+}
+
+// decodeWriteRequest decodes the series of a remote write request, as their labels and their samples' values and timestamps.
+func decodeWriteRequest(t *testing.T, req []byte) ([]map[string]string, [][][2]float64) {
+	labels := []map[string]string{}
+	samples := [][][2]float64{}
+	for _, ts := range protoFields(t, req)[1] {
+		tsFields := protoFields(t, ts.([]byte))
+		lbls := map[string]string{}
+		for _, lbl := range tsFields[1] {
+			lblFields := protoFields(t, lbl.([]byte))
+			lbls[string(lblFields[1][0].([]byte))] = string(lblFields[2][0].([]byte))
+		}
+		smpls := [][2]float64{}
+		for _, smp := range tsFields[2] {
+			smpFields := protoFields(t, smp.([]byte))
+			smpls = append(smpls, [2]float64{smpFields[1][0].(float64), float64(smpFields[2][0].(int64))})
+		}
+		labels = append(labels, lbls)
+		samples = append(samples, smpls)
+	}
+	return labels, samples
+}
+
+func TestPrometheus(t *testing.T) {
+	var req *http.Request
+	body := []byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	bps := testBatch(t, 2)
+	pt, err := influx.NewPoint("tps.2xx", map[string]string{"deliveryservice": "ds1"}, map[string]interface{}{"value": 2.5, "count": int64(3), "name": "skipped"}, time.Unix(0, 0))
+	if err != nil {
+		t.Fatalf("creating point: %v", err)
+	}
+	bps.AddPoint(pt)
+	// samples out of order are sorted
+	bps.Points()[0], bps.Points()[1] = bps.Points()[1], bps.Points()[0]
+
+	p := NewPrometheus(PrometheusConfig{URL: srv.URL + "/api/v1/write", User: "user", Password: "pass"})
+	if err := p.Write(bps); err != nil {
+		t.Fatalf("writing: %v", err)
+	}
+	if user, pass, _ := req.BasicAuth(); req.URL.Path != "/api/v1/write" || user != "user" || pass != "pass" {
+		t.Errorf("expected an authorized request to the remote write URL, actual %v %v %v", req.URL.Path, user, pass)
+	}
+	if req.Header.Get("Content-Encoding") != "snappy" || req.Header.Get("Content-Type") != "application/x-protobuf" || req.Header.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" {
+		t.Errorf("expected remote write headers, actual %v", req.Header)
+	}
+
+	decoded, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("decoding snappy: %v", err)
+	}
+	labels, samples := decodeWriteRequest(t, decoded)
+	expectedLabels := []map[string]string{
+		{"__name__": "cache_stats_bandwidth", "cdn": "cdn1", "hostname": "edge-1"},
+		{"__name__": "cache_stats_tps_2xx_count", "deliveryservice": "ds1"},
+		{"__name__": "cache_stats_tps_2xx", "deliveryservice": "ds1"},
+	}
+	expectedSamples := [][][2]float64{
+		{{0, 1577836800000}, {1, 1577836800001}},
+		{{3, 0}},
+		{{2.5, 0}},
+	}
+	if !reflect.DeepEqual(labels, expectedLabels) || !reflect.DeepEqual(samples, expectedSamples) {
+		t.Errorf("expected series %v %v, actual %v %v", expectedLabels, expectedSamples, labels, samples)
+	}
+}
@@ -0,0 +1,194 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+// Package sink contains the time-series databases Traffic Stats writes its stats to.
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+	influx "github.com/influxdata/influxdb/client/v2"
+)
+
+// Sink is a time-series database which stats are written to.
+// Stats are InfluxDB batch points, whose database and retention policy are the InfluxDB 1.x database they belong to.
+type Sink interface {
+	// Name returns the name of the sink, used in log messages.
+	Name() string
+	// Open returns a writer of the sink, which every point of a publish is written with.
+	Open() (Writer, error)
+}
+
+// Writer writes points to a sink.
+type Writer interface {
+	// Write writes the given points, returning an error if they weren't all written.
+	Write(bps influx.BatchPoints) error
+}
+
+// RejectedError is the error of a write which the sink rejected, and would reject again if it were retried, such as an HTTP 400 response.
+type RejectedError struct {
+	Err error
+}
+
+func (e *RejectedError) Error() string {
+	return e.Err.Error()
+}
+
+// Buffered writes points to a Sink in chunks of at most a maximum size, and buffers the chunks which fail to be written, to retry them on the next publish.
+// Chunks the sink rejects are dropped rather than retried.
+// It's safe for concurrent use, and publishes one at a time.
+type Buffered struct {
+	Sink           Sink
+	maxPublishSize int
+	maxBufferSize  int
+	m              sync.Mutex
+	buffered       []influx.BatchPoints
+	bufferedPoints int
+}
+
+// NewBuffered returns a Buffered writing to the given sink at most maxPublishSize points at a time,
+// and buffering at most maxBufferSize points to retry. If the buffer is full, the oldest points are dropped.
+func NewBuffered(sink Sink, maxPublishSize int, maxBufferSize int) *Buffered {
+	return &Buffered{Sink: sink, maxPublishSize: maxPublishSize, maxBufferSize: maxBufferSize}
+}
+
+// Publish writes the buffered points and the given points to the sink.
+// If retry is true, points which fail to be written are buffered, unless the sink rejected them, and otherwise they're dropped.
+func (b *Buffered) Publish(batches []influx.BatchPoints, retry bool) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	batches = append(b.buffered, batches...)
+	b.buffered = nil
+	b.bufferedPoints = 0
+	if len(batches) == 0 {
+		return
+	}
+
+	writer, openErr := b.Sink.Open()
+	for _, bps := range batches {
+		for _, chunk := range chunks(bps, b.maxPublishSize) {
+			err := openErr
+			if err == nil {
+				err = writer.Write(chunk)
+			}
+			if err != nil {
+				if _, ok := err.(*RejectedError); ok {
+					log.Errorf("%v rejected %v stats for %v, dropping them: %v", b.Sink.Name(), len(chunk.Points()), chunk.Database(), err)
+					continue
+				}
+				log.Errorf("writing %v stats for %v to %v: %v", len(chunk.Points()), chunk.Database(), b.Sink.Name(), err)
+				if retry {
+					b.buffer(chunk)
+				}
+				continue
+			}
+			log.Info(fmt.Sprintf("Sent %v stats for %v to %v", len(chunk.Points()), chunk.Database(), b.Sink.Name()))
+		}
+	}
+}
+
+// Buffer buffers the given points to be written on the next publish, without writing them now.
+func (b *Buffered) Buffer(batches []influx.BatchPoints) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	for _, bps := range batches {
+		b.buffer(bps)
+	}
+}
+
+// Drain returns the buffered points, and empties the buffer.
+func (b *Buffered) Drain() []influx.BatchPoints {
+	b.m.Lock()
+	defer b.m.Unlock()
+	batches := b.buffered
+	b.buffered = nil
+	b.bufferedPoints = 0
+	return batches
+}
+
+// buffer buffers the given points, dropping the oldest buffered points if the buffer is full. It must be called with the lock held.
+func (b *Buffered) buffer(bps influx.BatchPoints) {
+	b.buffered = append(b.buffered, bps)
+	b.bufferedPoints += len(bps.Points())
+	for b.bufferedPoints > b.maxBufferSize && len(b.buffered) > 0 {
+		dropped := b.buffered[0]
+		b.buffered = b.buffered[1:]
+		b.bufferedPoints -= len(dropped.Points())
+		log.Warnf("%v retry buffer is full, dropping %v stats for %v", b.Sink.Name(), len(dropped.Points()), dropped.Database())
+	}
+}
+
+// chunks splits the given points into batches of at most size points, with the same database, retention policy, and precision.
+func chunks(bps influx.BatchPoints, size int) []influx.BatchPoints {
+	chunks := []influx.BatchPoints{}
+	pts := bps.Points()
+	for len(pts) > 0 {
+		n := len(pts)
+		if size > 0 && size < n {
+			n = size
+		}
+		chunk, err := influx.NewBatchPoints(influx.BatchPointsConfig{
+			Database:        bps.Database(),
+			Precision:       bps.Precision(),
+			RetentionPolicy: bps.RetentionPolicy(),
+		})
+		if err != nil {
+			// only possible with an invalid precision, which the given batch would have already failed with
+			log.Errorf("creating %v stats batch: %v", bps.Database(), err)
+			return chunks
+		}
+		chunk.AddPoints(pts[:n])
+		chunks = append(chunks, chunk)
+		pts = pts[n:]
+	}
+	return chunks
+}
+
+// DefaultTimeout is the timeout of HTTP sink requests.
+const DefaultTimeout = 30 * time.Second
+
+// send sends the given write request, returning an error if it fails or doesn't succeed.
+// Responses rejecting the request itself, 400 Bad Request, 413 Payload Too Large, and 422 Unprocessable Entity, are returned
+// as a *RejectedError, because retrying the same request would fail the same way. Other errors, including other client errors
+// such as 401 Unauthorized or 404 Not Found, which may be fixed by fixing the sink's config, are retryable.
+func send(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("%v responded with %v: %s", req.URL.Host, resp.Status, bytes.TrimSpace(body))
+		switch resp.StatusCode {
+		case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+			return &RejectedError{Err: err}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package sink
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	influx "github.com/influxdata/influxdb/client/v2"
+)
+
+// testBatch returns a batch of the given number of cache_stats points, a millisecond apart from 2020-01-01.
+func testBatch(t *testing.T, n int) influx.BatchPoints {
+	bps, err := influx.NewBatchPoints(influx.BatchPointsConfig{Database: "cache_stats", Precision: "ms", RetentionPolicy: "daily"})
+	if err != nil {
+		t.Fatalf("creating batch: %v", err)
+	}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		pt, err := influx.NewPoint("bandwidth", map[string]string{"cdn": "cdn1", "hostname": "edge-1", "type": ""}, map[string]interface{}{"value": float64(i)}, start.Add(time.Duration(i)*time.Millisecond))
+		if err != nil {
+			t.Fatalf("creating point: %v", err)
+		}
+		bps.AddPoint(pt)
+	}
+	return bps
+}
+
+// testSink records the sizes of the batches written to it, and the number of times it's opened,
+// and fails while fail is true, and rejects writes while reject is true.
+type testSink struct {
+	m      sync.Mutex
+	fail   bool
+	reject bool
+	opens  int
+	writes []int
+}
+
+func (s *testSink) Name() string {
+	return "test"
+}
+
+func (s *testSink) Open() (Writer, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.opens++
+	return s, nil
+}
+
+func (s *testSink) Write(bps influx.BatchPoints) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.reject {
+		return &RejectedError{Err: errors.New("rejecting")}
+	}
+	if s.fail {
+		return errors.New("failing")
+	}
+	s.writes = append(s.writes, len(bps.Points()))
+	return nil
+}
+
+func (s *testSink) setFail(fail bool) []int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.fail = fail
+	writes := s.writes
+	s.writes = nil
+	return writes
+}
+
+func TestBuffered(t *testing.T) {
+	s := &testSink{}
+	b := NewBuffered(s, 4, 8)
+
+	b.Publish([]influx.BatchPoints{testBatch(t, 10), testBatch(t, 1)}, true)
+	if writes := s.setFail(true); len(writes) != 4 || writes[0] != 4 || writes[1] != 4 || writes[2] != 2 || writes[3] != 1 {
+		t.Errorf("expected batches to be written in chunks of the max publish size, actual %v", writes)
+	}
+	if s.opens != 1 {
+		t.Errorf("expected the sink to be opened once per publish, actual %v", s.opens)
+	}
+
+	// 10 points fail in chunks of 4, 4, and 2, and the oldest chunk is dropped to keep the buffer at 8 points.
+	b.Publish([]influx.BatchPoints{testBatch(t, 10)}, true)
+	if writes := s.setFail(false); len(writes) != 0 {
+		t.Errorf("expected failing sink to write nothing, actual %v", writes)
+	}
+	b.Publish([]influx.BatchPoints{testBatch(t, 1)}, true)
+	if writes := s.setFail(true); len(writes) != 3 || writes[0] != 4 || writes[1] != 2 || writes[2] != 1 {
+		t.Errorf("expected buffered points to be retried before new points, without the dropped oldest chunk, actual %v", writes)
+	}
+
+	b.Publish([]influx.BatchPoints{testBatch(t, 3)}, false)
+	if drained := b.Drain(); len(drained) != 0 {
+		t.Errorf("expected points to not be buffered without retry, actual %v batches", len(drained))
+	}
+
+	s.reject = true
+	b.Publish([]influx.BatchPoints{testBatch(t, 3)}, true)
+	if drained := b.Drain(); len(drained) != 0 {
+		t.Errorf("expected rejected points to be dropped rather than buffered, actual %v batches", len(drained))
+	}
+
+	b.Buffer([]influx.BatchPoints{testBatch(t, 2)})
+	if drained := b.Drain(); len(drained) != 1 || len(drained[0].Points()) != 2 || len(b.Drain()) != 0 {
+		t.Errorf("expected buffered points to be drained once, actual %v", drained)
+	}
+}
@@ -25,9 +25,7 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"math/rand"
 	"net/http"
-	"net/url"
 	"os"
 	"os/signal"
 	"strconv"
@@ -37,8 +35,11 @@ import (
 
 	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/lib/go-util"
+	"github.com/apache/trafficcontrol/traffic_stats/billing"
+	"github.com/apache/trafficcontrol/traffic_stats/sink"
 
 	client "github.com/apache/trafficcontrol/traffic_ops/v2-client"
+	toclient "github.com/apache/trafficcontrol/traffic_ops/v3-client"
 	log "github.com/cihub/seelog"
 	influx "github.com/influxdata/influxdb/client/v2"
 )
@@ -61,28 +62,34 @@ const (
 	defaultConfigInterval              = 300
 	defaultPublishingInterval          = 30
 	defaultMaxPublishSize              = 10000
+	defaultRetryBufferSize             = 100000
 )
 
 // StartupConfig contains all fields necessary to create a traffic stats session.
 type StartupConfig struct {
-	ToUser                      string   `json:"toUser"`
-	ToPasswd                    string   `json:"toPasswd"`
-	ToURL                       string   `json:"toUrl"`
-	InfluxUser                  string   `json:"influxUser"`
-	InfluxPassword              string   `json:"influxPassword"`
-	InfluxURLs                  []string `json:"influxUrls"`
-	PollingInterval             int      `json:"pollingInterval"`
-	DailySummaryPollingInterval int      `json:"dailySummaryPollingInterval"`
-	PublishingInterval          int      `json:"publishingInterval"`
-	ConfigInterval              int      `json:"configInterval"`
-	MaxPublishSize              int      `json:"maxPublishSize"`
-	StatusToMon                 string   `json:"statusToMon"`
-	SeelogConfig                string   `json:"seelogConfig"`
-	CacheRetentionPolicy        string   `json:"cacheRetentionPolicy"`
-	DsRetentionPolicy           string   `json:"dsRetentionPolicy"`
-	DailySummaryRetentionPolicy string   `json:"dailySummaryRetentionPolicy"`
+	ToUser                      string                  `json:"toUser"`
+	ToPasswd                    string                  `json:"toPasswd"`
+	ToURL                       string                  `json:"toUrl"`
+	InfluxUser                  string                  `json:"influxUser"`
+	InfluxPassword              string                  `json:"influxPassword"`
+	InfluxURLs                  []string                `json:"influxUrls"`
+	InfluxDB2                   []sink.InfluxDB2Config  `json:"influxDB2"`
+	PrometheusRemoteWrite       []sink.PrometheusConfig `json:"prometheusRemoteWrite"`
+	PollingInterval             int                     `json:"pollingInterval"`
+	DailySummaryPollingInterval int                     `json:"dailySummaryPollingInterval"`
+	PublishingInterval          int                     `json:"publishingInterval"`
+	ConfigInterval              int                     `json:"configInterval"`
+	MaxPublishSize              int                     `json:"maxPublishSize"`
+	RetryBufferSize             int                     `json:"retryBufferSize"`
+	StatusToMon                 string                  `json:"statusToMon"`
+	SeelogConfig                string                  `json:"seelogConfig"`
+	CacheRetentionPolicy        string                  `json:"cacheRetentionPolicy"`
+	DsRetentionPolicy           string                  `json:"dsRetentionPolicy"`
+	DailySummaryRetentionPolicy string                  `json:"dailySummaryRetentionPolicy"`
+	BillingSummary              bool                    `json:"billingSummary"`
 	BpsChan                     chan influx.BatchPoints
-	InfluxDBs                   []*InfluxDBProps
+	Influx                      *sink.InfluxDB   // the InfluxDB 1.x sink, which daily summaries are queried from, or nil if there are no influxUrls
+	Sinks                       []*sink.Buffered // every sink stats are written to
 }
 
 // RunningConfig is used to store runtime configuration for Traffic Stats.  This includes information
@@ -91,12 +98,8 @@ type RunningConfig struct {
 	HealthUrls      map[string]map[string]string // the 1st map key is CDN_name, the second is DsStats or CacheStats
 	CacheMap        map[string]tc.Server         // map hostName to cache
 	LastSummaryTime time.Time
-}
-
-//InfluxDBProps contains URL and connection information for InfluxDB servers
-type InfluxDBProps struct {
-	URL          string
-	InfluxClient influx.Client
+	// LastBillingSummaryTime is when billing stats were last summarized, if config.BillingSummary is set
+	LastBillingSummaryTime time.Time
 }
 
 //Timers struct contains all the timers
@@ -114,6 +117,8 @@ func main() {
 	var tickers Timers
 
 	configFile := flag.String("cfg", "", "The config file")
+	billingStart := flag.String("billingStart", "", "Summarize billing stats from this date (YYYY-MM-DD), then quit")
+	billingEnd := flag.String("billingEnd", "", "Summarize billing stats up to, but not including, this date (YYYY-MM-DD), then quit")
 	flag.Parse()
 
 	config, err = loadStartupConfig(*configFile, config)
@@ -122,6 +127,18 @@ func main() {
 		errHndlr(err, FATAL)
 	}
 
+	if *billingStart != "" || *billingEnd != "" {
+		start, end, err := parseBillingPeriod(*billingStart, *billingEnd)
+		if err != nil {
+			errHndlr(err, FATAL)
+		}
+		if err := calcBillingSummary(start, end, config); err != nil {
+			errHndlr(err, FATAL)
+		}
+		log.Flush()
+		os.Exit(0)
+	}
+
 	Bps = make(map[string]influx.BatchPoints)
 	config.BpsChan = make(chan influx.BatchPoints)
 
@@ -152,14 +169,15 @@ func main() {
 			}
 		case <-termChan:
 			log.Info("Shutdown Request Received - Sending stored metrics then quitting")
-			for _, val := range Bps {
-				sendMetrics(config, runningConfig, val, false)
+			batches := takeBatches(Bps)
+			for _, s := range config.Sinks {
+				s.Publish(batches, false)
 			}
 			os.Exit(0)
 		case <-tickers.Publish:
-			for key, val := range Bps {
-				go sendMetrics(config, runningConfig, val, true)
-				delete(Bps, key)
+			batches := takeBatches(Bps)
+			for _, s := range config.Sinks {
+				go s.Publish(batches, true)
 			}
 		case runningConfig = <-configChan:
 		case <-tickers.Config:
@@ -173,6 +191,15 @@ func main() {
 			}
 		case now := <-tickers.DailySummary:
 			go calcDailySummary(now, config, runningConfig)
+			if start, end := billingMonth(now); config.BillingSummary && runningConfig.LastBillingSummaryTime.Before(end) {
+				// don't summarize the month again before the stats summary time is next fetched from Traffic Ops
+				runningConfig.LastBillingSummaryTime = now
+				go func() {
+					if err := calcBillingSummary(start, end, config); err != nil {
+						errHndlr(err, ERROR)
+					}
+				}()
+			}
 		case batchPoints := <-config.BpsChan:
 			log.Debug("Received ", len(batchPoints.Points()), " stats")
 			key := fmt.Sprintf("%s%s", batchPoints.Database(), batchPoints.RetentionPolicy())
@@ -190,6 +217,16 @@ func main() {
 	}
 }
 
+// takeBatches returns the aggregated batches of points, and removes them from the map.
+func takeBatches(bps map[string]influx.BatchPoints) []influx.BatchPoints {
+	batches := make([]influx.BatchPoints, 0, len(bps))
+	for key, val := range bps {
+		batches = append(batches, val)
+		delete(bps, key)
+	}
+	return batches
+}
+
 func setTimers(config StartupConfig) Timers {
 	var timers Timers
 
@@ -236,6 +273,9 @@ func loadStartupConfig(configFile string, oldConfig StartupConfig) (StartupConfi
 	if config.MaxPublishSize == 0 {
 		config.MaxPublishSize = defaultMaxPublishSize
 	}
+	if config.RetryBufferSize == 0 {
+		config.RetryBufferSize = defaultRetryBufferSize
+	}
 
 	logger, err := log.LoggerFromConfigAsFile(config.SeelogConfig)
 	if err != nil {
@@ -244,26 +284,43 @@ func loadStartupConfig(configFile string, oldConfig StartupConfig) (StartupConfi
 	log.ReplaceLogger(logger)
 	log.Info("Replaced logger, see log file according to", config.SeelogConfig)
 
-	if len(config.InfluxURLs) == 0 {
-		return config, fmt.Errorf("No InfluxDB urls provided in influxUrls, please provide at least one valid URL.  e.g. \"influxUrls\": [\"http://localhost:8086\"]")
-	}
-	for _, url := range config.InfluxURLs {
-		influxDBProps := InfluxDBProps{
-			URL: url,
-		}
-		config.InfluxDBs = append(config.InfluxDBs, &influxDBProps)
+	if len(config.InfluxURLs) == 0 && len(config.InfluxDB2) == 0 && len(config.PrometheusRemoteWrite) == 0 {
+		return config, fmt.Errorf("No sinks provided in influxUrls, influxDB2, or prometheusRemoteWrite, please provide at least one.  e.g. \"influxUrls\": [\"http://localhost:8086\"]")
 	}
+	config.Sinks = newSinks(&config)
 
-	//Close old connections explicitly
-	for _, host := range oldConfig.InfluxDBs {
-		if host.InfluxClient != nil {
-			host.InfluxClient.Close()
+	//Close old connections explicitly, and keep the points old sinks are waiting to retry
+	if oldConfig.Influx != nil {
+		oldConfig.Influx.Close()
+	}
+	for _, oldSink := range oldConfig.Sinks {
+		for _, newSink := range config.Sinks {
+			if newSink.Sink.Name() == oldSink.Sink.Name() {
+				newSink.Buffer(oldSink.Drain())
+				break
+			}
 		}
 	}
 
 	return config, nil
 }
 
+// newSinks creates the sinks of the given config, and its InfluxDB 1.x sink.
+func newSinks(config *StartupConfig) []*sink.Buffered {
+	sinks := []*sink.Buffered{}
+	if len(config.InfluxURLs) > 0 {
+		config.Influx = sink.NewInfluxDB(config.InfluxURLs, config.InfluxUser, config.InfluxPassword)
+		sinks = append(sinks, sink.NewBuffered(config.Influx, config.MaxPublishSize, config.RetryBufferSize))
+	}
+	for _, influxDB2Config := range config.InfluxDB2 {
+		sinks = append(sinks, sink.NewBuffered(sink.NewInfluxDB2(influxDB2Config), config.MaxPublishSize, config.RetryBufferSize))
+	}
+	for _, prometheusConfig := range config.PrometheusRemoteWrite {
+		sinks = append(sinks, sink.NewBuffered(sink.NewPrometheus(prometheusConfig), config.MaxPublishSize, config.RetryBufferSize))
+	}
+	return sinks
+}
+
 func calcDailySummary(now time.Time, config StartupConfig, runningConfig RunningConfig) {
 	log.Infof("lastSummaryTime is %v", runningConfig.LastSummaryTime)
 	if runningConfig.LastSummaryTime.Day() != now.Day() {
@@ -272,7 +329,11 @@ func calcDailySummary(now time.Time, config StartupConfig, runningConfig Running
 		log.Info("Summarizing from ", startTime, " (", startTime.Unix(), ") to ", endTime, " (", endTime.Unix(), ")")
 
 		// influx connection
-		influxClient, err := influxConnect(config)
+		if config.Influx == nil {
+			log.Warn("No InfluxDB urls provided in influxUrls, not getting daily summary stats")
+			return
+		}
+		influxClient, err := config.Influx.Connect()
 		if err != nil {
 			log.Error("Could not connect to InfluxDb to get daily summary stats!!")
 			errHndlr(err, ERROR)
@@ -403,6 +464,191 @@ func calcDailyBytesServed(client influx.Client, bp influx.BatchPoints, startTime
 	}
 }
 
+// billingMonth returns the start and end of the calendar month before the one of now, which is billed at now.
+func billingMonth(now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	end := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return end.AddDate(0, -1, 0), end
+}
+
+// parseBillingPeriod parses the start and end dates of a billing period.
+func parseBillingPeriod(startDate string, endDate string) (time.Time, time.Time, error) {
+	start, err := time.Parse("2006-01-02", startDate)
+	if err != nil {
+		return start, start, fmt.Errorf("invalid billing start date '%s', must be YYYY-MM-DD", startDate)
+	}
+	end, err := time.Parse("2006-01-02", endDate)
+	if err != nil {
+		return start, end, fmt.Errorf("invalid billing end date '%s', must be YYYY-MM-DD", endDate)
+	}
+	if !end.After(start) {
+		return start, end, fmt.Errorf("billing end date %s must be after start date %s", endDate, startDate)
+	}
+	return start, end, nil
+}
+
+// calcBillingSummary summarizes the 95th percentile, peak bandwidth, and bytes served of every delivery service, tenant,
+// and CDN from start up to end, and stores them in Traffic Ops as billing stats summaries.
+func calcBillingSummary(start time.Time, end time.Time, config StartupConfig) error {
+	log.Info("Summarizing billing stats from ", start, " to ", end)
+	if config.Influx == nil {
+		return errors.New("no InfluxDB urls provided in influxUrls, not summarizing billing stats")
+	}
+	influxClient, err := config.Influx.Connect()
+	if err != nil {
+		return fmt.Errorf("could not connect to InfluxDb to summarize billing stats: %v", err)
+	}
+	retention, err := queryBillingRetention(influxClient)
+	if err != nil {
+		return err
+	}
+	if err := checkBillingRetention(start, time.Now(), retention); err != nil {
+		return err
+	}
+
+	// billing stats summaries have periods and tenants, which need API 3.1
+	to, _, err := toclient.LoginWithAgent(config.ToURL, config.ToUser, config.ToPasswd, true, UserAgent, false, TrafficOpsRequestTimeout)
+	if err != nil {
+		return fmt.Errorf("could not summarize billing stats! Error logging in to %v: %v", config.ToURL, err)
+	}
+	deliveryServices, _, err := to.GetDeliveryServicesNullable()
+	if err != nil {
+		return fmt.Errorf("could not summarize billing stats! Error getting delivery services from %v: %v", config.ToURL, err)
+	}
+	tenants := map[string]string{}
+	for _, ds := range deliveryServices {
+		if ds.XMLID != nil && ds.Tenant != nil {
+			tenants[*ds.XMLID] = *ds.Tenant
+		}
+	}
+
+	series, err := queryBillingSeries(influxClient, start, end, tenants)
+	if err != nil {
+		return err
+	}
+
+	summaryTime := time.Now()
+	failed := 0
+	for _, summary := range billing.Summarize(series) {
+		for _, statsSummary := range tc.BillingReportStatsSummaries(summary.Report(start, end, summaryTime)) {
+			if _, _, err := to.CreateSummaryStats(statsSummary); err != nil {
+				log.Errorf("Could not store billing stat %s of %s %s: %v", *statsSummary.StatName, *statsSummary.CDNName, *statsSummary.DeliveryService, err)
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("could not store %d billing stats from %v to %v", failed, start, end)
+	}
+	log.Info("Summarized billing stats of ", len(series), " delivery services from ", start, " to ", end)
+	return nil
+}
+
+// billingRetentionPolicy is the retention policy of the deliveryservice_stats database which billing stats are summarized from.
+const billingRetentionPolicy = "monthly"
+
+// queryBillingRetention returns the duration of the retention policy billing stats are summarized from, which is 0 if
+// it keeps stats forever.
+func queryBillingRetention(client influx.Client) (time.Duration, error) {
+	res, err := queryDB(client, "show retention policies", "deliveryservice_stats")
+	if err != nil {
+		return 0, fmt.Errorf("could not get deliveryservice_stats retention policies for billing stats: %v", err)
+	}
+	if len(res) > 0 {
+		for _, row := range res[0].Series {
+			nameCol, durationCol := -1, -1
+			for i, col := range row.Columns {
+				switch col {
+				case "name":
+					nameCol = i
+				case "duration":
+					durationCol = i
+				}
+			}
+			if nameCol < 0 || durationCol < 0 {
+				continue
+			}
+			for _, record := range row.Values {
+				if name, _ := record[nameCol].(string); name != billingRetentionPolicy {
+					continue
+				}
+				durationStr, _ := record[durationCol].(string)
+				duration, err := time.ParseDuration(durationStr)
+				if err != nil {
+					return 0, fmt.Errorf("could not parse duration '%s' of deliveryservice_stats retention policy %s: %v", durationStr, billingRetentionPolicy, err)
+				}
+				return duration, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("deliveryservice_stats has no retention policy %s to summarize billing stats from", billingRetentionPolicy)
+}
+
+// checkBillingRetention returns an error if a billing period from start, summarized at now, begins before the oldest
+// stats kept by a retention policy of the given duration, in which case its summary would be missing the stats which
+// were dropped. A duration of 0 keeps stats forever.
+func checkBillingRetention(start time.Time, now time.Time, retention time.Duration) error {
+	if retention == 0 || !start.Before(now.Add(-retention)) {
+		return nil
+	}
+	return fmt.Errorf("not summarizing billing stats from %v: the deliveryservice_stats retention policy %s only keeps stats for %v, since %v; increase its duration to cover the billing period", start, billingRetentionPolicy, retention, now.Add(-retention))
+}
+
+// queryBillingSeries returns the bandwidth of each delivery service on each CDN from start up to end, in buckets of
+// billing.BucketInterval. Every bucket in the period is included, with 0 bandwidth if there was no traffic in it, so
+// percentiles are taken over the whole period. The tenants map delivery services to their tenant.
+func queryBillingSeries(client influx.Client, start time.Time, end time.Time, tenants map[string]string) ([]billing.Series, error) {
+	sampleTimeSecs := 60.00
+	queryString := fmt.Sprintf(`select mean(value), sum(value) from "%s"."kbps.ds.1min" where time >= '%s' and time < '%s' group by time(%dm), deliveryservice, cdn fill(0)`, billingRetentionPolicy, start.Format(time.RFC3339), end.Format(time.RFC3339), int(billing.BucketInterval.Minutes()))
+	log.Infof("queryString = %v\n", queryString)
+	res, err := queryDB(client, queryString, "deliveryservice_stats")
+	if err != nil {
+		return nil, fmt.Errorf("could not get delivery service bandwidth for billing stats: %v", err)
+	}
+	series := []billing.Series{}
+	if len(res) == 0 {
+		return series, nil
+	}
+	for _, row := range res[0].Series {
+		s := billing.Series{
+			CDN:             row.Tags["cdn"],
+			DeliveryService: row.Tags["deliveryservice"],
+			Tenant:          tenants[row.Tags["deliveryservice"]],
+			Buckets:         map[time.Time]float64{},
+		}
+		for bucket := start.Truncate(billing.BucketInterval); bucket.Before(end); bucket = bucket.Add(billing.BucketInterval) {
+			s.Buckets[bucket] = 0
+		}
+		if s.Tenant == "" {
+			log.Warnf("No tenant found for delivery service %s, only billing it as part of cdn %s", s.DeliveryService, s.CDN)
+		}
+		for _, record := range row.Values {
+			if record[1] == nil || record[2] == nil {
+				continue // no bandwidth in the bucket, which is already 0
+			}
+			bucket, err := time.Parse(time.RFC3339, record[0].(string))
+			if err != nil {
+				log.Errorf("Couldn't parse time from record %v\n", record)
+				continue
+			}
+			mean, err := record[1].(json.Number).Float64()
+			if err != nil {
+				log.Errorf("Couldn't parse value from record %v\n", record)
+				continue
+			}
+			sum, err := record[2].(json.Number).Float64()
+			if err != nil {
+				log.Errorf("Couldn't parse value from record %v\n", record)
+				continue
+			}
+			s.Buckets[bucket] = mean
+			s.Kilobits += sum * sampleTimeSecs
+		}
+		series = append(series, s)
+	}
+	return series, nil
+}
+
 func queryDB(con influx.Client, cmd string, database string) (res []influx.Result, err error) {
 	q := influx.Query{
 		Command:  cmd,
@@ -513,6 +759,15 @@ func getToData(config StartupConfig, init bool, configChan chan RunningConfig) {
 		runningConfig.LastSummaryTime = *lastSummaryTimeResponse.Response.SummaryTime
 	}
 
+	if config.BillingSummary {
+		lastBillingTimeResponse, _, err := to.GetSummaryStatsLastUpdated(util.StrPtr(tc.BillingStatP95Gbps))
+		if err != nil {
+			errHndlr(err, ERROR)
+		} else if lastBillingTimeResponse.Response.SummaryTime != nil {
+			runningConfig.LastBillingSummaryTime = *lastBillingTimeResponse.Response.SummaryTime
+		}
+	}
+
 	configChan <- runningConfig
 }
 
@@ -725,98 +980,6 @@ func getURL(url string) ([]byte, error) {
 	return body, nil
 }
 
-func influxConnect(config StartupConfig) (influx.Client, error) {
-	hosts := config.InfluxDBs
-	for len(hosts) > 0 {
-		n := rand.Intn(len(hosts))
-		host := hosts[n]
-		hosts = append(hosts[:n], hosts[n+1:]...)
-		parsedURL, _ := url.Parse(host.URL)
-		if parsedURL.Scheme == "udp" {
-			conf := influx.UDPConfig{
-				Addr: parsedURL.Host,
-			}
-			con, err := influx.NewUDPClient(conf)
-			if err != nil {
-				errHndlr(fmt.Errorf("An error occurred creating udp client. %v\n", err), ERROR)
-				continue
-			}
-			return con, nil
-		}
-		//if not udp assume HTTP client
-		conf := influx.HTTPConfig{
-			Addr:     parsedURL.String(),
-			Username: config.InfluxUser,
-			Password: config.InfluxPassword,
-		}
-		con, err := influx.NewHTTPClient(conf)
-		if err != nil {
-			errHndlr(fmt.Errorf("An error occurred creating HTTP client.  %v\n", err), ERROR)
-			continue
-		}
-		//Close old connections explicitly
-		if host.InfluxClient != nil {
-			host.InfluxClient.Close()
-		}
-		host.InfluxClient = con
-		_, _, err = con.Ping(10)
-		if err != nil {
-			errHndlr(err, WARN)
-			continue
-		}
-		return con, nil
-	}
-	err := errors.New("Could not connect to any of the InfluxDb servers defined in the influxUrls config.")
-	return nil, err
-}
-
-func sendMetrics(config StartupConfig, runningConfig RunningConfig, bps influx.BatchPoints, retry bool) {
-	influxClient, err := influxConnect(config)
-	if err != nil {
-		if retry {
-			config.BpsChan <- bps
-		}
-		errHndlr(err, ERROR)
-		return
-	}
-
-	pts := bps.Points()
-	for len(pts) > 0 {
-		chunkBps, err := influx.NewBatchPoints(influx.BatchPointsConfig{
-			Database:        bps.Database(),
-			Precision:       bps.Precision(),
-			RetentionPolicy: bps.RetentionPolicy(),
-		})
-		if err != nil {
-			if retry {
-				config.BpsChan <- chunkBps
-			}
-			errHndlr(err, ERROR)
-		}
-		for _, p := range pts[:intMin(config.MaxPublishSize, len(pts))] {
-			chunkBps.AddPoint(p)
-		}
-		pts = pts[intMin(config.MaxPublishSize, len(pts)):]
-
-		err = influxClient.Write(chunkBps)
-		if err != nil {
-			if retry {
-				config.BpsChan <- chunkBps
-			}
-			errHndlr(err, ERROR)
-		} else {
-			log.Info(fmt.Sprintf("Sent %v stats for %v", len(chunkBps.Points()), chunkBps.Database()))
-		}
-	}
-}
-
-func intMin(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
 func floatMax(a, b float64) float64 {
 	if a > b {
 		return a
@@ -21,6 +21,8 @@ under the License.
 
 import (
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -155,3 +157,113 @@ func TestCalcCacheValues(t *testing.T) {
 		}
 	}
 }
+
+func TestBillingMonth(t *testing.T) {
+	start, end := billingMonth(time.Date(2021, 3, 1, 0, 10, 0, 0, time.UTC))
+	if expected := time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC); !start.Equal(expected) {
+		t.Errorf("expected billing month to start at %v, actual %v", expected, start)
+	}
+	if expected := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC); !end.Equal(expected) {
+		t.Errorf("expected billing month to end at %v, actual %v", expected, end)
+	}
+
+	start, end = billingMonth(time.Date(2021, 1, 15, 12, 0, 0, 0, time.UTC))
+	if expected := time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC); !start.Equal(expected) {
+		t.Errorf("expected billing month to start at %v, actual %v", expected, start)
+	}
+	if expected := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC); !end.Equal(expected) {
+		t.Errorf("expected billing month to end at %v, actual %v", expected, end)
+	}
+}
+
+func TestParseBillingPeriod(t *testing.T) {
+	if _, _, err := parseBillingPeriod("2021-03-01", "2021-04-01"); err != nil {
+		t.Errorf("expected no error parsing billing period, actual %v", err)
+	}
+	if _, _, err := parseBillingPeriod("2021-03-01", ""); err == nil {
+		t.Error("expected error parsing billing period without end date, actual nil")
+	}
+	if _, _, err := parseBillingPeriod("2021-04-01", "2021-03-01"); err == nil {
+		t.Error("expected error parsing billing period ending before it starts, actual nil")
+	}
+}
+
+func TestCheckBillingRetention(t *testing.T) {
+	start, end := billingMonth(time.Date(2021, 3, 1, 0, 10, 0, 0, time.UTC))
+	if err := checkBillingRetention(start, end.Add(10*time.Minute), 30*24*time.Hour); err != nil {
+		t.Errorf("expected 28 day month to be kept by 30 day retention policy, actual %v", err)
+	}
+	start, end = billingMonth(time.Date(2021, 2, 1, 0, 10, 0, 0, time.UTC))
+	if err := checkBillingRetention(start, end.Add(10*time.Minute), 30*24*time.Hour); err == nil {
+		t.Error("expected error summarizing 31 day month with 30 day retention policy, actual nil")
+	}
+	if err := checkBillingRetention(start, end.Add(10*time.Minute), 35*24*time.Hour); err != nil {
+		t.Errorf("expected 31 day month to be kept by 35 day retention policy, actual %v", err)
+	}
+	if err := checkBillingRetention(start, end.AddDate(1, 0, 0), 0); err != nil {
+		t.Errorf("expected infinite retention policy to keep every month, actual %v", err)
+	}
+}
+
+func TestQueryBillingRetention(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if db := r.FormValue("db"); db != "deliveryservice_stats" {
+			t.Errorf("expected query of database deliveryservice_stats, actual %v", db)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"results":[{"statement_id":0,"series":[{"columns":["name","duration","shardGroupDuration","replicaN","default"],"values":[` +
+			`["autogen","0s","168h0m0s",1,false],["monthly","720h0m0s","24h0m0s",1,true]]}]}]}`))
+	}))
+	defer srv.Close()
+
+	client, err := influx.NewHTTPClient(influx.HTTPConfig{Addr: srv.URL})
+	if err != nil {
+		t.Fatalf("creating InfluxDB client: %v", err)
+	}
+	if retention, err := queryBillingRetention(client); err != nil || retention != 30*24*time.Hour {
+		t.Errorf("expected monthly retention of 720h, actual %v, error %v", retention, err)
+	}
+}
+
+func TestQueryBillingSeries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if db := r.FormValue("db"); db != "deliveryservice_stats" {
+			t.Errorf("expected query of database deliveryservice_stats, actual %v", db)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"results":[{"statement_id":0,"series":[` +
+			`{"name":"kbps.ds.1min","tags":{"cdn":"cdn1","deliveryservice":"ds1"},"columns":["time","mean","sum"],"values":[["2021-03-01T00:00:00Z",10,50],["2021-03-01T00:05:00Z",null,null],["2021-03-01T00:10:00Z",20,100]]},` +
+			`{"name":"kbps.ds.1min","tags":{"cdn":"cdn1","deliveryservice":"deleted"},"columns":["time","mean","sum"],"values":[["2021-03-01T00:00:00Z",1,5]]}` +
+			`]}]}`))
+	}))
+	defer srv.Close()
+
+	client, err := influx.NewHTTPClient(influx.HTTPConfig{Addr: srv.URL})
+	if err != nil {
+		t.Fatalf("creating InfluxDB client: %v", err)
+	}
+	start := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	series, err := queryBillingSeries(client, start, start.AddDate(0, 1, 0), map[string]string{"ds1": "tenant1"})
+	if err != nil {
+		t.Fatalf("querying billing series: %v", err)
+	}
+	if len(series) != 2 {
+		t.Fatalf("expected 2 series, actual %v", len(series))
+	}
+	if series[0].DeliveryService != "ds1" || series[0].CDN != "cdn1" || series[0].Tenant != "tenant1" {
+		t.Errorf("expected series of ds1 on cdn1 for tenant1, actual %+v", series[0])
+	}
+	// every 5 minute bucket of March is billed, with 0 kbps when there's no traffic
+	if buckets := 31 * 24 * 12; len(series[0].Buckets) != buckets || len(series[1].Buckets) != buckets {
+		t.Errorf("expected %v buckets in each series, actual %v and %v", buckets, len(series[0].Buckets), len(series[1].Buckets))
+	}
+	if series[0].Buckets[start] != 10 || series[0].Buckets[start.Add(5*time.Minute)] != 0 || series[0].Buckets[start.Add(10*time.Minute)] != 20 || series[0].Buckets[start.Add(15*time.Minute)] != 0 {
+		t.Errorf("expected buckets of 10, 0, 20, and 0 kbps, actual %v, %v, %v, and %v", series[0].Buckets[start], series[0].Buckets[start.Add(5*time.Minute)], series[0].Buckets[start.Add(10*time.Minute)], series[0].Buckets[start.Add(15*time.Minute)])
+	}
+	if series[0].Kilobits != 150*60 {
+		t.Errorf("expected %v kilobits, actual %v", 150*60, series[0].Kilobits)
+	}
+	if series[1].Tenant != "" {
+		t.Errorf("expected no tenant for deleted delivery service, actual %v", series[1].Tenant)
+	}
+}